@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/postfix/cctvscan/internal/cvedb"
+	"github.com/postfix/cctvscan/internal/fingerprint"
+	"github.com/postfix/cctvscan/internal/update"
+)
+
+// updateCVEsCommand is the subcommand that pulls the CVEs of every known brand
+// from the NVD
+const updateCVEsCommand = "update-cves"
+
+// cveStaleAge is the age of the CVE data from which scans warn it is stale
+const cveStaleAge = 30 * 24 * time.Hour
+
+// runUpdateCVEs fetches the CVEs of the vendors of every signature and stores
+// them where scans load them from, or moves them through an offline bundle
+func runUpdateCVEs(args []string) error {
+	fs := flag.NewFlagSet(updateCVEsCommand, flag.ExitOnError)
+	urlFlag := fs.String("url", cvedb.DefaultNVDURL, "NVD 2.0 CVE API URL")
+	epssFlag := fs.String("epss-url", cvedb.DefaultEPSSURL, "EPSS API URL (empty = keep the current scores)")
+	kevFlag := fs.String("kev-url", cvedb.DefaultKEVURL, "CISA Known Exploited Vulnerabilities feed URL (empty = keep the current catalog)")
+	keyFlag := fs.String("api-key", os.Getenv("NVD_API_KEY"), "NVD API key, which raises the rate limit tenfold (default $NVD_API_KEY)")
+	dirFlag := fs.String("dir", "", "Directory to store the CVEs in (empty = the user data directory)")
+	timeoutFlag := fs.Duration("timeout", time.Hour, "Timeout of the whole update")
+	exportFlag := fs.String("export", "", "Write the stored CVE data to this offline bundle instead of updating, for air-gapped hosts")
+	importFlag := fs.String("import", "", "Install an offline bundle written with -export instead of updating")
+	fullFlag := fs.Bool("full", false, "Fetch every CVE again instead of those modified since the last update")
+	fs.Parse(args)
+
+	dir := *dirFlag
+	if dir == "" {
+		var err error
+		if dir, err = update.DataDir(); err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+	path := filepath.Join(dir, update.CVEStoreFile)
+	store, err := cvedb.OpenStore(path)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	switch {
+	case *exportFlag != "":
+		b, err := cvedb.NewBundle(store)
+		if err != nil {
+			return fmt.Errorf("%w (run %s first)", err, updateCVEsCommand)
+		}
+		if err := cvedb.SaveBundle(*exportFlag, b); err != nil {
+			return err
+		}
+		fmt.Printf("Exported CVE bundle %s to %s\n", b.Version(), *exportFlag)
+		return nil
+	case *importFlag != "":
+		b, err := cvedb.ReadBundle(*importFlag)
+		if err != nil {
+			return err
+		}
+		if err := b.Install(store); err != nil {
+			return err
+		}
+		fmt.Printf("Installed CVE bundle %s to %s\n", b.Version(), path)
+		return nil
+	}
+
+	// Brands of an installed bundle are looked up too
+	if path := update.Installed(update.SignaturesFile); path != "" {
+		if err := fingerprint.LoadSignatures(path); err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeoutFlag)
+	defer cancel()
+	nvd := cvedb.NewNVD(*keyFlag)
+	nvd.URL = *urlFlag
+	vendors := fingerprint.CPEVendors()
+
+	// Only the CVEs modified since the last update are fetched, unless that was
+	// longer ago than the NVD answers for
+	since := store.Updated()
+	incremental := !*fullFlag && !since.IsZero() && time.Since(since) < cvedb.MaxModifiedRange
+	if incremental {
+		nvd.Since = since
+		fmt.Printf("Fetching the CVEs of %d brands modified since %s from %s\n", len(vendors), since.Format(time.DateOnly), nvd.URL)
+	} else {
+		fmt.Printf("Fetching the CVEs of %d brands from %s\n", len(vendors), nvd.URL)
+	}
+	feed, err := nvd.Sync(ctx, vendors)
+	if err != nil {
+		return err
+	}
+	if incremental {
+		changed, err := store.Merge(feed)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Stored %d new or changed CVEs in %s\n", changed, path)
+	} else {
+		total, err := store.Replace(feed)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Stored %d CVEs of %d brands in %s\n", total, len(feed.Brands), path)
+	}
+	cvedb.Use(store)
+
+	if *epssFlag != "" {
+		scores, err := cvedb.FetchEPSS(ctx, http.DefaultClient, *epssFlag, cvedb.IDs())
+		if err != nil {
+			return err
+		}
+		if err := store.PutEPSS(scores); err != nil {
+			return err
+		}
+		fmt.Printf("Stored the EPSS scores of %d CVEs in %s\n", len(scores), path)
+	}
+
+	if *kevFlag != "" {
+		data, err := cvedb.FetchKEV(ctx, http.DefaultClient, *kevFlag)
+		if err != nil {
+			return err
+		}
+		n, err := store.PutKEV(data)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Stored the %d entries of the KEV catalog in %s\n", n, path)
+	}
+	return nil
+}
+
+// checkCVEAge prints how old the loaded CVE data is, warning when it is stale,
+// and fails when it is older than maxAge, or missing, unless maxAge is 0
+func checkCVEAge(maxAge time.Duration) {
+	updated := cvedb.Updated()
+	if updated.IsZero() {
+		if maxAge > 0 {
+			log.Fatalf("No CVE data installed, only the built-in list (-cve-max-age %s): run %s, or %s -import a bundle", maxAge, updateCVEsCommand, updateCVEsCommand)
+		}
+		fmt.Printf("CVE data: built-in list only, run %s for the NVD feed\n", updateCVEsCommand)
+		return
+	}
+	age := time.Since(updated)
+	days := int(age.Hours() / 24)
+	fmt.Printf("CVE data from %s (%d days old)\n", updated.Format(time.DateOnly), days)
+	switch {
+	case maxAge > 0 && age > maxAge:
+		log.Fatalf("CVE data is %d days old, older than -cve-max-age %s: run %s, or %s -import a newer bundle", days, maxAge, updateCVEsCommand, updateCVEsCommand)
+	case age > cveStaleAge:
+		log.Printf("WARNING: CVE data is %d days old, CVEs published since are missing: run %s", days, updateCVEsCommand)
+	}
+}
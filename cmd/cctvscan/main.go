@@ -2,35 +2,120 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"time"
 
+	"github.com/postfix/cctvscan/internal/control"
+	"github.com/postfix/cctvscan/internal/credbrute"
+	"github.com/postfix/cctvscan/internal/cvedb"
+	"github.com/postfix/cctvscan/internal/eol"
+	"github.com/postfix/cctvscan/internal/fingerprint"
+	"github.com/postfix/cctvscan/internal/nuclei"
 	"github.com/postfix/cctvscan/internal/portscan"
+	"github.com/postfix/cctvscan/internal/probe"
 	"github.com/postfix/cctvscan/internal/processor"
+	"github.com/postfix/cctvscan/internal/streams"
 	"github.com/postfix/cctvscan/internal/targets"
+	"github.com/postfix/cctvscan/internal/update"
+	"github.com/postfix/cctvscan/internal/util"
+)
+
+// How long to collect answers to the LAN discovery multicasts
+const (
+	wsDiscoveryWait = 3 * time.Second
+	sadpWait        = 3 * time.Second
+	mdnsWait        = 3 * time.Second
 )
 
 var (
-	portsFlag     = flag.String("ports", "0-65535", "Port range to scan (e.g., '80,443,8000-9000')")
-	rateFlag      = flag.Int("rate", 1000, "Packets per second rate for naabu")
-	retryFlag     = flag.Int("retry", 3, "Number of retries for port scanning")
-	waitFlag      = flag.Int("wait", 1, "Seconds to wait for late replies")
-	adapterFlag   = flag.String("adapter", "", "Network adapter name for naabu")
-	adapterIPFlag = flag.String("adapter-ip", "", "Source IP address for naabu")
-	timeoutFlag   = flag.String("timeout", "30m", "Overall scan timeout (e.g., '30m', '1h')")
-	credsFlag     = flag.String("creds", "/etc/cctvscan/credentials.txt", "Credentials file for brute force")
-	outputFlag    = flag.String("output", ".", "Output directory for results")
-	debugFlag     = flag.Bool("debug", false, "Enable debug mode with verbose output")
-	helpFlag      = flag.Bool("help", false, "Show help message")
+	scannerFlag      = flag.String("scanner", "hybrid", "Port scanner backend (hybrid, masscan, naabu, internetdb)")
+	portsFlag        = flag.String("ports", "0-65535", "Port range to scan (e.g., '80,443,8000-9000')")
+	rateFlag         = flag.Int("rate", 1000, "Packets per second rate for naabu")
+	subnetRateFlag   = flag.Int("subnet-rate", 0, "Max packets per second per destination subnet (0 = unlimited)")
+	subnetPrefixFlag = flag.Int("subnet-prefix", 24, "IPv4 prefix length that defines a subnet for -subnet-rate")
+	retryFlag        = flag.Int("retry", 3, "Number of retries for port scanning")
+	waitFlag         = flag.Int("wait", 1, "Seconds to wait for late replies")
+	masscanWaitFlag  = flag.Int("masscan-wait", 0, "Override -wait for masscan (seconds, 0 = use -wait)")
+	naabuWaitFlag    = flag.Int("naabu-wait", 0, "Override -wait for naabu (seconds, 0 = use -wait)")
+	adapterFlag      = flag.String("adapter", "", "Network adapter name for naabu")
+	adapterIPFlag    = flag.String("adapter-ip", "", "Source IP address for naabu")
+	sctpPortsFlag    = flag.String("sctp-ports", "", "SCTP ports to INIT-scan with masscan, e.g. '2905,3868,38412' (empty = off)")
+	srcPortFlag      = flag.String("source-port", "", "Source port for SYN scans: a port, a power-of-two range (masscan), or 'random'")
+	bogonsFlag       = flag.String("bogons", "auto", "Filter private/reserved addresses: auto (drop from public CIDRs), drop, or keep")
+	passiveFlag      = flag.Bool("passive", false, "Fetch open ports from Shodan InternetDB instead of active port scanning")
+	wsDiscoveryFlag  = flag.Bool("ws-discovery", false, "Find ONVIF cameras on the local network via WS-Discovery multicast and add them as targets")
+	sadpFlag         = flag.Bool("sadp", false, "Find Hikvision devices on the local network via SADP multicast and add them as targets")
+	mdnsFlag         = flag.Bool("mdns", false, "Find cameras advertising Bonjour services (_http, _rtsp, _axis-video) via mDNS and add them as targets")
+	discoverFlag     = flag.Bool("discover", false, "Run an ICMP/ARP liveness sweep and only port scan responsive hosts (requires root)")
+	timeoutFlag      = flag.String("timeout", "30m", "Overall scan timeout (e.g., '30m', '1h')")
+	hostTimeoutFlag  = flag.String("host-timeout", "5m", "Per-host time budget; on expiry the host is marked partial (0 = no limit)")
+	telnetFlag       = flag.Bool("telnet", false, "Grab pre-login banners from open telnet ports (23, 2323)")
+	snmpFlag         = flag.String("snmp-community", "public", "SNMP community for the sysDescr/sysName probe on UDP 161 (empty = off)")
+	verifyRTPFlag    = flag.Bool("verify-rtp", false, "SETUP/PLAY open RTSP streams and confirm RTP packets arrive")
+	isapiBypassFlag  = flag.Bool("isapi-bypass", false, "Check Hikvision ISAPI devices for the CVE-2017-7921 auth bypass (fetches a live snapshot)")
+	checkCVEsFlag    = flag.Bool("check-cves", false, "Verify Hikvision CVE-2017-7921 and CVE-2021-36260 and Dahua CVE-2021-33044 with safe checks (logs in and fetches a snapshot on vulnerable devices)")
+	screenshotsFlag  = flag.Bool("screenshots", false, "Render each login page with headless Chrome/Chromium and save a PNG under <output>/screenshots")
+	nucleiFlag       = flag.Bool("nuclei", false, "Run nuclei templates against every web service and merge matches into brands and CVEs (needs nuclei on PATH)")
+	nucleiTplFlag    = flag.String("nuclei-templates", "", "Comma-separated nuclei template files or directories (empty = camera/IoT tagged templates)")
+	bodySizeFlag     = flag.Int("body-size", 32*1024, "Bytes of each HTTP response body kept per port for fingerprinting")
+	probeScaleFlag   = flag.Float64("probe-scale", 1, "Multiply every probe timeout, e.g. 3 for satellite or cellular links")
+	probeRetryFlag   = flag.Int("probe-retries", 0, "Extra connect attempts per probe after a timeout")
+	probeTimeoutFlag = flag.String("probe-timeouts", "", "Per-protocol probe timeouts, e.g. 'rtsp=6s,http=3s/8s' (dial/io; http, rtsp, rtp, onvif, snmp, sip, ssh, ftp, telnet)")
+	pluginsFlag      = flag.String("probe-plugins", "", "Comma-separated Go plugins (-buildmode=plugin) that each export a probe.Probe variable named Probe")
+	signaturesFlag   = flag.String("signatures", "", "Comma-separated JSON brand signature files merged over the built-in set (see internal/fingerprint/signatures.json)")
+	skipDetectFlag   = flag.String("skip-detectors", "", "Comma-separated brand detectors to turn off (header, title, body, redirect, cert, sdp, tls, http-stack, snmp, mac, onvif, isapi, nuclei; there is no favicon detector yet)")
+	brandCacheFlag   = flag.Int("brand-cache", 4096, "Brand detection results kept for reuse across hosts serving the same page")
+	vulnersFlag      = flag.Bool("vulners", false, "Ask the Vulners API for advisories of each detected firmware version, cached for a week (needs -vulners-key)")
+	vulnersKeyFlag   = flag.String("vulners-key", "", "Vulners API key (empty = $VULNERS_API_KEY)")
+	cveMaxAgeFlag    = flag.String("cve-max-age", "", "Refuse to scan when the CVE data is older than this, e.g. '720h' for 30 days (empty = warn only)")
+	cveDataFlag      = flag.String("cve-data", "", "Comma-separated JSON or CSV files of CVEs (cve, brand, models, firmware_before, cvss, note) added to the built-in database")
+	eolFlag          = flag.String("eol-data", "", "Comma-separated JSON end-of-life files tried before the built-in set (see internal/eol/eol.json)")
+	cacheFlag        = flag.String("cache", "", "Database file that keeps probe results between runs (empty = off)")
+	cacheTTLFlag     = flag.String("cache-ttl", "24h", "How long cached probe results are reused")
+	honeypotsFlag    = flag.String("honeypots", "flag", "Hosts that look like honeypots: flag (report the signs) or drop (leave them out of the results)")
+	rdnsFlag         = flag.Bool("rdns", false, "Look up the PTR name of every host and show it in the results")
+	bruteRateFlag    = flag.Float64("brute-rate", 0, "Max login attempts per second on each host (0 = unlimited)")
+	bruteDelayFlag   = flag.String("brute-delay", "0", "Least time between two login attempts on each host, e.g. '2s'")
+	credsFlag        = flag.String("creds", "/etc/cctvscan/credentials.txt", "Credentials file for brute force, or 'bundle' for those of the installed fingerprint bundle")
+	dumpKBFlag       = flag.Bool("dump-fingerprints", false, "Print the fingerprint knowledge base in use (signatures, ports, credentials) as JSON and exit")
+	outputFlag       = flag.String("output", ".", "Output directory for results")
+	sortLatencyFlag  = flag.Bool("sort-latency", false, "Order the console output and report.json from the most to the least responsive host")
+	sortEPSSFlag     = flag.Bool("sort-epss", false, "Order the console output and report.json by the highest EPSS score of each host's CVEs")
+	minSeverityFlag  = flag.String("min-severity", "", "Leave out CVEs rated below low, medium, high or critical (KEV counts as critical, unscored CVEs are left out) and exit with status 2 if any finding remains")
+	minEPSSFlag      = flag.Float64("min-epss", 0, "Leave out CVEs whose EPSS exploit probability is below this (0 to 1, 0 = keep all)")
+	progressFlag     = flag.Bool("progress", true, "Show a live progress line during port scanning")
+	debugFlag        = flag.Bool("debug", false, "Enable debug mode with verbose output")
+	helpFlag         = flag.Bool("help", false, "Show help message")
 )
 
+// exitFindings is the exit status of a scan with -min-severity that left
+// findings; errors exit with 1
+const exitFindings = 2
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == updateCommand {
+		if err := runUpdate(os.Args[2:]); err != nil {
+			log.Fatalf("Error updating fingerprints: %v", err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == updateCVEsCommand {
+		if err := runUpdateCVEs(os.Args[2:]); err != nil {
+			log.Fatalf("Error updating CVEs: %v", err)
+		}
+		return
+	}
 	flag.Parse()
 
-	if *helpFlag || len(flag.Args()) == 0 {
+	if *helpFlag || (len(flag.Args()) == 0 && !*wsDiscoveryFlag && !*sadpFlag && !*mdnsFlag && !*dumpKBFlag) {
 		printHelp()
 		os.Exit(0)
 	}
@@ -40,17 +125,172 @@ func main() {
 	if err != nil {
 		log.Fatalf("Invalid timeout format: %v", err)
 	}
+	hostTimeout, err := time.ParseDuration(*hostTimeoutFlag)
+	if err != nil {
+		log.Fatalf("Invalid host timeout format: %v", err)
+	}
+	bruteDelay, err := time.ParseDuration(*bruteDelayFlag)
+	if err != nil || bruteDelay < 0 || *bruteRateFlag < 0 {
+		log.Fatalf("Invalid brute force pace: -brute-rate %g, -brute-delay %s", *bruteRateFlag, *bruteDelayFlag)
+	}
+	var cveMaxAge time.Duration
+	if *cveMaxAgeFlag != "" {
+		if cveMaxAge, err = time.ParseDuration(*cveMaxAgeFlag); err != nil || cveMaxAge <= 0 {
+			log.Fatalf("Invalid -cve-max-age: %q (must be a positive duration such as 720h)", *cveMaxAgeFlag)
+		}
+	}
+	if *bodySizeFlag <= 0 {
+		log.Fatalf("Invalid -body-size: %d (must be positive)", *bodySizeFlag)
+	}
+	if *honeypotsFlag != "flag" && *honeypotsFlag != "drop" {
+		log.Fatalf("Invalid -honeypots: %q (must be flag or drop)", *honeypotsFlag)
+	}
+	if *minSeverityFlag != "" && cvedb.SeverityRank(*minSeverityFlag) == 0 {
+		log.Fatalf("Invalid -min-severity: %q (must be low, medium, high or critical)", *minSeverityFlag)
+	}
+	if *minEPSSFlag < 0 || *minEPSSFlag > 1 {
+		log.Fatalf("Invalid -min-epss: %v (must be between 0 and 1)", *minEPSSFlag)
+	}
+	if *probeScaleFlag <= 0 || *probeRetryFlag < 0 {
+		log.Fatalf("Invalid -probe-scale %v or -probe-retries %d", *probeScaleFlag, *probeRetryFlag)
+	}
+	probeConfig := probe.DefaultProbeConfig().Scale(*probeScaleFlag).AddRetries(*probeRetryFlag)
+	if err := probeConfig.ParseTimeouts(*probeTimeoutFlag); err != nil {
+		log.Fatalf("Invalid -probe-timeouts: %v", err)
+	}
+	probeConfig.MaxBodySize = *bodySizeFlag
+	probeConfig.SNMPCommunity = *snmpFlag
+	probeConfig.EnableTelnet = *telnetFlag
+	probeConfig.VerifyRTP = *verifyRTPFlag
+	probeConfig.CheckISAPIBypass = *isapiBypassFlag
+	probeConfig.CheckCVEs = *checkCVEsFlag
+	for _, path := range strings.Split(*pluginsFlag, ",") {
+		if path = strings.TrimSpace(path); path == "" {
+			continue
+		}
+		name, err := probe.LoadPlugin(path)
+		if err != nil {
+			log.Fatalf("Error loading probe plugin: %v", err)
+		}
+		if *debugFlag {
+			log.Printf("DEBUG: Registered probe %s from %s", name, path)
+		}
+	}
+
+	// The installed fingerprint bundle is newer than the built-in set, -signatures
+	// files override both
+	if path := update.Installed(update.SignaturesFile); path != "" {
+		if err := fingerprint.LoadSignatures(path); err != nil {
+			log.Fatalf("Error loading fingerprint bundle (run %s again): %v", updateCommand, err)
+		}
+		if *debugFlag {
+			log.Printf("DEBUG: Loaded brand signatures from %s", path)
+		}
+	}
+	for _, path := range strings.Split(*signaturesFlag, ",") {
+		if path = strings.TrimSpace(path); path == "" {
+			continue
+		}
+		if err := fingerprint.LoadSignatures(path); err != nil {
+			log.Fatalf("Error loading signatures: %v", err)
+		}
+		if *debugFlag {
+			log.Printf("DEBUG: Loaded brand signatures from %s", path)
+		}
+	}
+
+	if path := update.Installed(update.CVEStoreFile); path != "" {
+		store, err := cvedb.OpenStoreReadOnly(path)
+		if err != nil {
+			log.Fatalf("Error opening CVE store (run %s again): %v", updateCVEsCommand, err)
+		}
+		defer store.Close()
+		cvedb.Use(store)
+		if *debugFlag {
+			log.Printf("DEBUG: Using CVEs from %s", path)
+		}
+	}
 
-	// Parse targets
-	targetList, err := targets.Expand(flag.Args())
+	for _, path := range strings.Split(*cveDataFlag, ",") {
+		if path = strings.TrimSpace(path); path == "" {
+			continue
+		}
+		if err := cvedb.LoadLocal(path); err != nil {
+			log.Fatalf("Error loading CVE data: %v", err)
+		}
+		if *debugFlag {
+			log.Printf("DEBUG: Loaded CVEs from %s", path)
+		}
+	}
+
+	fingerprint.SetCacheSize(*brandCacheFlag)
+
+	for _, path := range strings.Split(*eolFlag, ",") {
+		if path = strings.TrimSpace(path); path == "" {
+			continue
+		}
+		if err := eol.Load(path); err != nil {
+			log.Fatalf("Error loading EoL data: %v", err)
+		}
+		if *debugFlag {
+			log.Printf("DEBUG: Loaded end-of-life data from %s", path)
+		}
+	}
+
+	// Installing signatures must not start login attempts on its own, so the
+	// bundle's credentials are only used when asked for
+	credsFile := *credsFlag
+	if credsFile == "bundle" {
+		if credsFile = update.Installed(update.CredentialsFile); credsFile == "" {
+			log.Fatalf("-creds bundle: no fingerprint bundle with credentials is installed, run update-fingerprints first")
+		}
+	}
+	if *dumpKBFlag {
+		if err := dumpKnowledgeBase(os.Stdout, credsFile); err != nil {
+			log.Fatalf("Error dumping fingerprints: %v", err)
+		}
+		return
+	}
+
+	// Air-gapped laptops go months between updates
+	checkCVEAge(cveMaxAge)
+
+	// Parse targets, dropping non-routable space swept up by public CIDRs
+	bogonMode, err := targets.ParseBogonMode(*bogonsFlag)
+	if err != nil {
+		log.Fatalf("Invalid -bogons value: %v", err)
+	}
+	targetList, dropped, err := targets.ExpandFiltered(flag.Args(), bogonMode)
 	if err != nil {
 		log.Fatalf("Error parsing targets: %v", err)
 	}
+	if dropped > 0 {
+		fmt.Printf("Excluded %d private/reserved address(es) from targets (-bogons=%s)\n", dropped, bogonMode)
+	}
+
+	// LAN sweep for ONVIF cameras that aren't in the target list at all
+	if *wsDiscoveryFlag {
+		targetList = addWSDiscoveryTargets(targetList, *debugFlag)
+	}
+	var sadpDevices []probe.SADPDevice
+	if *sadpFlag {
+		targetList, sadpDevices = addSADPTargets(targetList, *debugFlag)
+	}
+	var mdnsDevices []probe.MDNSDevice
+	if *mdnsFlag {
+		targetList, mdnsDevices = addMDNSTargets(targetList, *debugFlag)
+	}
 
 	if len(targetList) == 0 {
 		log.Fatal("No valid targets found")
 	}
 
+	// Resolve source port strategy once so every phase uses the same port
+	sourcePort, err := portscan.ResolveSourcePort(*srcPortFlag)
+	if err != nil {
+		log.Fatalf("Invalid source port: %v", err)
+	}
+
 	if *debugFlag {
 		log.Printf("DEBUG: Scanning %d target(s): %v", len(targetList), targetList)
 		log.Printf("DEBUG: Configuration - ports: %s, rate: %d, retry: %d, wait: %d, timeout: %v",
@@ -69,47 +309,334 @@ func main() {
 		}
 	}
 
+	gate := control.NewGate()
 	cfg := portscan.HybridConfig{
-		Ports:     portsToScan,
-		Rate:      *rateFlag,
-		Retry:     *retryFlag,
-		Wait:      *waitFlag,
-		Adapter:   *adapterFlag,
-		AdapterIP: *adapterIPFlag,
-		ExtraArgs: []string{"--open-only"},
-		Debug:     *debugFlag,
+		Ports:        portsToScan,
+		Rate:         *rateFlag,
+		Retry:        *retryFlag,
+		Wait:         *waitFlag,
+		MasscanWait:  *masscanWaitFlag,
+		NaabuWait:    *naabuWaitFlag,
+		Adapter:      *adapterFlag,
+		AdapterIP:    *adapterIPFlag,
+		SourcePort:   sourcePort,
+		SubnetRate:   *subnetRateFlag,
+		SubnetPrefix: *subnetPrefixFlag,
+		HostTimeout:  hostTimeout,
+		SCTPPorts:    *sctpPortsFlag,
+		Gate:         gate,
+		ExtraArgs:    []string{"--open-only"},
+		Debug:        *debugFlag,
+	}
+	if *progressFlag {
+		cfg.OnProgress = printProgress
 	}
 
 	if *debugFlag {
 		log.Printf("DEBUG: Scanner config: %+v", cfg)
 	}
 
-	scanner := portscan.NewHybridScanner(cfg)
+	// Passive mode replaces the active scanner; probing still targets the reported ports
+	scannerName := *scannerFlag
+	if *passiveFlag {
+		scannerName = "internetdb"
+		fmt.Println("Passive mode: reading open ports from Shodan InternetDB, no port scan packets will be sent")
+	}
+
+	scanner, err := portscan.New(scannerName, cfg)
+	if err != nil {
+		log.Fatalf("Invalid scanner: %v", err)
+	}
+	if *debugFlag {
+		log.Printf("DEBUG: Using %s scanner", scanner.Name())
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
+	// SIGUSR1 pauses new masscan runs and probe workers, SIGUSR2 resumes them
+	control.WatchSignals(ctx, gate)
+
+	// Optional liveness sweep so dead addresses in large ranges are skipped
+	if *discoverFlag && *passiveFlag {
+		log.Printf("WARNING: -discover sends probes and is ignored in passive mode")
+	} else if *discoverFlag {
+		liveTargets, err := portscan.DiscoverHosts(ctx, cfg, targetList)
+		if err != nil {
+			log.Printf("WARNING: Host discovery failed, scanning all targets: %v", err)
+		} else {
+			fmt.Printf("Host discovery: %d of %d target(s) responded\n", len(liveTargets), len(targetList))
+			targetList = liveTargets
+		}
+	}
+
 	// Scan targets
-	results, err := scanner.Scan(ctx, targetList)
+	scanResults, err := portscan.ScanWithStates(ctx, scanner, targetList)
+	if *progressFlag {
+		fmt.Fprintln(os.Stderr)
+	}
 	if err != nil {
 		log.Fatalf("Scan failed: %v", err)
 	}
+	results := scanResults.Open()
+
+	// Optional SCTP INIT pass for NVR backends that don't speak TCP
+	var sctpResults map[string][]int
+	if *sctpPortsFlag != "" && !*passiveFlag {
+		sctpResults, err = portscan.ScanSCTP(ctx, cfg, targetList)
+		if err != nil {
+			log.Printf("WARNING: SCTP scan failed: %v", err)
+		} else {
+			fmt.Printf("SCTP scan: %d host(s) answered INIT\n", len(sctpResults))
+		}
+	}
+
+	// Summarize the port-scan phase for rate tuning and engagement notes
+	if reporter, ok := scanner.(portscan.StatsReporter); ok {
+		reporter.Stats().Print(os.Stdout)
+	}
 
 	fmt.Printf("Found %d hosts with open ports\n", len(results))
 
 	// Use optimized processor for concurrent processing
-	processor := processor.NewOptimizedProcessor(*debugFlag, *credsFlag, *outputFlag)
-	hostResults := processor.ProcessHosts(ctx, results)
+	proc := processor.NewOptimizedProcessor(*debugFlag, credsFile, *outputFlag)
+	proc.SetHostTimeout(hostTimeout)
+	proc.SetGate(gate)
+	proc.SetProbeConfig(probeConfig)
+	proc.SetBruteForceLimits(credbrute.Limits{Rate: *bruteRateFlag, Delay: bruteDelay})
+	proc.SetReverseDNS(*rdnsFlag)
+	var skipped []string
+	for _, name := range strings.Split(*skipDetectFlag, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			skipped = append(skipped, name)
+		}
+	}
+	if err := proc.SetSkippedDetectors(skipped); err != nil {
+		log.Fatalf("Invalid -skip-detectors: %v", err)
+	}
+	var cache *probe.DiskCache
+	if *cacheFlag != "" {
+		ttl, err := time.ParseDuration(*cacheTTLFlag)
+		if err != nil {
+			log.Fatalf("Invalid cache TTL format: %v", err)
+		}
+		if cache, err = probe.OpenDiskCache(*cacheFlag, ttl); err != nil {
+			log.Fatalf("Error opening probe cache: %v", err)
+		}
+		if *debugFlag {
+			log.Printf("DEBUG: Loaded %d cached host(s) from %s", cache.Len(), *cacheFlag)
+		}
+		defer cache.Close()
+		proc.SetProbeCache(cache)
+	}
+	var vulners *cvedb.Vulners
+	if *vulnersFlag {
+		key := *vulnersKeyFlag
+		if key == "" {
+			key = os.Getenv("VULNERS_API_KEY")
+		}
+		if key == "" {
+			log.Fatalf("-vulners needs an API key: pass -vulners-key or set VULNERS_API_KEY")
+		}
+		// Without a data directory answers are only kept for this run
+		path := ""
+		if dir, err := update.DataDir(); err == nil && os.MkdirAll(dir, 0o755) == nil {
+			path = filepath.Join(dir, update.VulnersFile)
+		}
+		if vulners, err = cvedb.OpenVulners(key, path, cvedb.DefaultVulnersTTL); err != nil {
+			log.Fatalf("Error opening Vulners cache: %v", err)
+		}
+		proc.SetVulners(vulners)
+	}
+	if *screenshotsFlag {
+		if browser, err := streams.FindBrowser(); err != nil {
+			log.Printf("WARNING: Login page screenshots disabled: %v", err)
+		} else {
+			if *debugFlag {
+				log.Printf("DEBUG: Rendering login page screenshots with %s", browser)
+			}
+			proc.SetScreenshotBrowser(browser)
+		}
+	}
+	if *nucleiFlag {
+		if binary, err := nuclei.Find(); err != nil {
+			log.Printf("WARNING: Nuclei templates disabled: %v", err)
+		} else {
+			runner := nuclei.Runner{Binary: binary}
+			for _, t := range strings.Split(*nucleiTplFlag, ",") {
+				if t = strings.TrimSpace(t); t != "" {
+					runner.Templates = append(runner.Templates, t)
+				}
+			}
+			if *debugFlag {
+				log.Printf("DEBUG: Running nuclei templates with %s", binary)
+			}
+			proc.SetNuclei(runner)
+		}
+	}
+	hostResults := proc.ProcessHosts(ctx, results)
+	if vulners != nil {
+		if err := vulners.Save(); err != nil {
+			log.Printf("WARNING: %v", err)
+		}
+	}
+	hostResults = processor.AttachPortStates(hostResults,
+		scanResults.WithState(portscan.PortClosed), scanResults.WithState(portscan.PortFiltered))
+	hostResults = processor.AttachSCTPPorts(hostResults, sctpResults)
+	hostResults = processor.AttachSADP(hostResults, sadpDevices)
+	hostResults = processor.AttachMDNS(hostResults, mdnsDevices)
+	processor.FlagHoneypots(hostResults)
+	if *honeypotsFlag == "drop" {
+		kept := slices.DeleteFunc(hostResults, func(r processor.HostResult) bool { return len(r.Honeypot) > 0 })
+		if dropped := len(hostResults) - len(kept); dropped > 0 {
+			fmt.Printf("Left out %d likely honeypot(s)\n", dropped)
+		}
+		hostResults = kept
+	}
+
+	if *minSeverityFlag != "" {
+		processor.FilterSeverity(hostResults, *minSeverityFlag)
+	}
+	if *minEPSSFlag > 0 {
+		processor.FilterEPSS(hostResults, *minEPSSFlag)
+	}
+	if *sortLatencyFlag {
+		processor.SortByLatency(hostResults)
+	}
+	if *sortEPSSFlag {
+		processor.SortByEPSS(hostResults)
+	}
 
 	// Print results
-	processor.PrintResults(hostResults)
+	proc.PrintResults(hostResults)
+
+	if err := proc.WriteReports(hostResults); err != nil {
+		log.Printf("WARNING: %v", err)
+	} else if *debugFlag {
+		log.Printf("DEBUG: Reports written to %s", *outputFlag)
+	}
 
 	if *debugFlag {
+		cache := fingerprint.GetCacheStats()
+		log.Printf("DEBUG: Brand cache: %d/%d entries, %d hits, %d misses, %d evictions",
+			cache.Entries, cache.Capacity, cache.Hits, cache.Misses, cache.Evictions)
 		log.Printf("DEBUG: Scan completed successfully")
 	}
+	// Monitoring pages on the exit status alone
+	if *minSeverityFlag != "" && processor.HasFindings(hostResults) {
+		os.Exit(exitFindings)
+	}
+}
+
+// addWSDiscoveryTargets multicasts a WS-Discovery probe and appends every ONVIF
+// device that answers to the target list
+func addWSDiscoveryTargets(targetList []string, debug bool) []string {
+	ctx, cancel := context.WithTimeout(context.Background(), wsDiscoveryWait)
+	defer cancel()
+
+	matches, err := probe.DiscoverONVIF(ctx, wsDiscoveryWait)
+	if err != nil {
+		log.Printf("WARNING: WS-Discovery failed: %v", err)
+		return targetList
+	}
+
+	fmt.Printf("WS-Discovery: %d ONVIF device(s) answered\n", len(matches))
+	for _, m := range matches {
+		if debug {
+			log.Printf("DEBUG: WS-Discovery match %s: endpoint=%s xaddrs=%v scopes=%v", m.Address, m.Endpoint, m.XAddrs, m.Scopes)
+		}
+		fmt.Printf("  %s %v\n", m.Address, m.XAddrs)
+		targetList = append(targetList, m.Address)
+	}
+	return util.Uniq(targetList)
+}
+
+// addSADPTargets multicasts a SADP inquiry and appends every Hikvision device that
+// answers to the target list. The answers are returned for the host results.
+func addSADPTargets(targetList []string, debug bool) ([]string, []probe.SADPDevice) {
+	ctx, cancel := context.WithTimeout(context.Background(), sadpWait)
+	defer cancel()
+
+	devices, err := probe.DiscoverSADP(ctx, sadpWait)
+	if err != nil {
+		log.Printf("WARNING: SADP discovery failed: %v", err)
+		return targetList, nil
+	}
+
+	fmt.Printf("SADP: %d Hikvision device(s) answered\n", len(devices))
+	for _, d := range devices {
+		if debug {
+			log.Printf("DEBUG: SADP device %s: %+v", d.Address, d)
+		}
+		fmt.Printf("  %s %s %s\n", d.Address, d.Model, d.FirmwareVersion)
+		targetList = append(targetList, d.Address)
+	}
+	return util.Uniq(targetList), devices
+}
+
+// addMDNSTargets queries the camera Bonjour services over mDNS and appends every
+// address that answers to the target list. The answers are returned for the host results.
+func addMDNSTargets(targetList []string, debug bool) ([]string, []probe.MDNSDevice) {
+	ctx, cancel := context.WithTimeout(context.Background(), mdnsWait)
+	defer cancel()
+
+	devices, err := probe.DiscoverMDNS(ctx, mdnsWait)
+	if err != nil {
+		log.Printf("WARNING: mDNS discovery failed: %v", err)
+		return targetList, nil
+	}
+
+	fmt.Printf("mDNS: %d device(s) advertise camera services\n", len(devices))
+	for _, d := range devices {
+		if debug {
+			log.Printf("DEBUG: mDNS device %s: %+v", d.Address, d.Services)
+		}
+		for _, svc := range d.Services {
+			fmt.Printf("  %s %s (%s:%d)\n", d.Address, svc.Instance, svc.Service, svc.Port)
+		}
+		targetList = append(targetList, d.Address)
+	}
+	return util.Uniq(targetList), devices
+}
+
+// printProgress redraws a single scan status line on stderr
+func printProgress(p portscan.Progress) {
+	fmt.Fprintf(os.Stderr, "\r[%s] %5.1f%% | %d/%d targets | %d ports found | elapsed %s | ETA %s   ",
+		p.Scanner, p.Percent, p.TargetsDone, p.TargetsTotal, p.PortsFound,
+		p.Elapsed.Round(time.Second), p.ETA.Round(time.Second))
+}
+
+// knowledgeBase is the output of -dump-fingerprints
+type knowledgeBase struct {
+	fingerprint.KnowledgeBase
+	Ports           []int    `json:"ports"`                      // Scanned unless -ports is given
+	CredentialsFile string   `json:"credentials_file,omitempty"` // Tried by the brute force
+	Credentials     []string `json:"credentials,omitempty"`
+}
+
+// dumpKnowledgeBase writes the signatures, ports and credentials a scan with the
+// current flags would use to w as JSON
+func dumpKnowledgeBase(w io.Writer, credsFile string) error {
+	kb := knowledgeBase{
+		KnowledgeBase: fingerprint.Export(),
+		Ports:         slices.Compact(slices.Sorted(slices.Values(probe.CameraPorts))),
+	}
+	if creds, err := credbrute.Credentials(credsFile); err != nil {
+		log.Printf("WARNING: Credentials left out: %v", err)
+	} else {
+		kb.CredentialsFile, kb.Credentials = credsFile, creds
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(kb)
 }
 
 func printHelp() {
 	fmt.Printf("Usage: %s [OPTIONS] <target> [target2 ...]\n", os.Args[0])
+	fmt.Printf("       %s %s [-url URL] [-key KEY] [-dir DIR]\n", os.Args[0], updateCommand)
+	fmt.Printf("       %s %s [-api-key KEY] [-dir DIR]\n", os.Args[0], updateCVEsCommand)
+	fmt.Printf("       %s %s -export FILE | -import FILE\n", os.Args[0], updateCVEsCommand)
+	fmt.Printf("       %s -dump-fingerprints [-signatures FILE] [-creds FILE]\n", os.Args[0])
 	fmt.Println("\nTargets can be: IP addresses, CIDR ranges, or files containing targets")
 	fmt.Println("\nOptions:")
 	flag.VisitAll(func(f *flag.Flag) {
@@ -119,6 +646,11 @@ func printHelp() {
 	fmt.Printf("  %s 192.168.1.100\n", os.Args[0])
 	fmt.Printf("  %s -rate 5000 -ports 80,443,8080 192.168.1.0/24\n", os.Args[0])
 	fmt.Printf("  %s -debug -creds mycreds.txt targets.txt\n", os.Args[0])
+	fmt.Println("\nRuntime control (the -timeout clock keeps running while paused):")
+	fmt.Println("  kill -USR1 <pid>   pause new masscan runs and probe workers")
+	fmt.Println("  kill -USR2 <pid>   resume")
+	fmt.Println("\nExit status: 0 when done, 1 on errors, 2 when -min-severity is given and a host has")
+	fmt.Println("a CVE at or above it or default credentials (which count as critical)")
 	fmt.Println("\nCredentials file format (user:pass per line):")
 	fmt.Println("  admin:admin")
 	fmt.Println("  admin:12345")
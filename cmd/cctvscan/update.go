@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/postfix/cctvscan/internal/update"
+)
+
+// updateCommand is the subcommand that installs the latest fingerprint bundle
+const updateCommand = "update-fingerprints"
+
+// runUpdate downloads, verifies and installs a fingerprint bundle
+func runUpdate(args []string) error {
+	fs := flag.NewFlagSet(updateCommand, flag.ExitOnError)
+	urlFlag := fs.String("url", update.DefaultURL, "Bundle URL; the signature is fetched from the same URL with .sig appended")
+	keyFlag := fs.String("key", update.DefaultKey, "Base64 ed25519 public key the bundle must be signed with")
+	dirFlag := fs.String("dir", "", "Directory to install the bundle to (empty = the user data directory)")
+	timeoutFlag := fs.Duration("timeout", time.Minute, "Download timeout")
+	fs.Parse(args)
+
+	if *keyFlag == "" {
+		return errors.New("this build has no bundle key, pass -key")
+	}
+	dir := *dirFlag
+	if dir == "" {
+		var err error
+		if dir, err = update.DataDir(); err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeoutFlag)
+	defer cancel()
+	bundle, data, err := update.Fetch(ctx, http.DefaultClient, *urlFlag, *keyFlag)
+	if err != nil {
+		return err
+	}
+	if err := update.Install(dir, bundle, data); err != nil {
+		return err
+	}
+	fmt.Printf("Installed fingerprint bundle %s (%s, %d credentials) to %s\n",
+		bundle.Version, bundle.Created.Format(time.DateOnly), len(bundle.Credentials), dir)
+	return nil
+}
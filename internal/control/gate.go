@@ -0,0 +1,110 @@
+// Package control provides runtime control of an in-flight scan.
+// A Gate lets operators pause and resume scanning without losing state.
+package control
+
+import (
+	"context"
+	"sync"
+)
+
+// Gate blocks workers while a scan is paused. A nil *Gate is never paused.
+type Gate struct {
+	mu      sync.Mutex
+	paused  bool
+	resumed chan struct{} // Closed when the gate is resumed
+	hooks   map[int]func(paused bool)
+	nextID  int
+}
+
+// NewGate creates a gate in the running state
+func NewGate() *Gate {
+	return &Gate{hooks: make(map[int]func(paused bool))}
+}
+
+// Pause stops new work from starting. It reports whether the state changed.
+func (g *Gate) Pause() bool {
+	return g.set(true)
+}
+
+// Resume lets blocked workers continue. It reports whether the state changed.
+func (g *Gate) Resume() bool {
+	return g.set(false)
+}
+
+// Paused reports whether the gate is currently paused
+func (g *Gate) Paused() bool {
+	if g == nil {
+		return false
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.paused
+}
+
+// Wait blocks while the gate is paused. It returns ctx.Err() if ctx ends first.
+func (g *Gate) Wait(ctx context.Context) error {
+	if g == nil {
+		return nil
+	}
+	g.mu.Lock()
+	if !g.paused {
+		g.mu.Unlock()
+		return nil
+	}
+	resumed := g.resumed
+	g.mu.Unlock()
+
+	select {
+	case <-resumed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// OnChange registers fn to run on every pause and resume, e.g. to suspend an external
+// process. The returned function unregisters it.
+func (g *Gate) OnChange(fn func(paused bool)) (remove func()) {
+	if g == nil {
+		return func() {}
+	}
+	g.mu.Lock()
+	id := g.nextID
+	g.nextID++
+	g.hooks[id] = fn
+	g.mu.Unlock()
+
+	return func() {
+		g.mu.Lock()
+		delete(g.hooks, id)
+		g.mu.Unlock()
+	}
+}
+
+// set switches the gate state and runs the change hooks
+func (g *Gate) set(paused bool) bool {
+	if g == nil {
+		return false
+	}
+	g.mu.Lock()
+	if g.paused == paused {
+		g.mu.Unlock()
+		return false
+	}
+	g.paused = paused
+	if paused {
+		g.resumed = make(chan struct{})
+	} else {
+		close(g.resumed)
+	}
+	hooks := make([]func(bool), 0, len(g.hooks))
+	for _, fn := range g.hooks {
+		hooks = append(hooks, fn)
+	}
+	g.mu.Unlock()
+
+	for _, fn := range hooks {
+		fn(paused)
+	}
+	return true
+}
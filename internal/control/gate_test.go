@@ -0,0 +1,69 @@
+package control
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestGate(t *testing.T) {
+	g := NewGate()
+	var changes []bool
+	remove := g.OnChange(func(paused bool) { changes = append(changes, paused) })
+
+	if err := g.Wait(context.Background()); err != nil {
+		t.Fatalf("Wait() on a running gate = %v", err)
+	}
+
+	if !g.Pause() || g.Pause() {
+		t.Error("Pause() should report a change only once")
+	}
+	if !g.Paused() {
+		t.Error("Paused() = false after Pause()")
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- g.Wait(context.Background()) }()
+	select {
+	case <-done:
+		t.Fatal("Wait() returned while paused")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	g.Resume()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Wait() after Resume() = %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Wait() still blocked after Resume()")
+	}
+
+	if len(changes) != 2 || !changes[0] || changes[1] {
+		t.Errorf("OnChange saw %v, expected [true false]", changes)
+	}
+
+	remove()
+	g.Pause()
+	if len(changes) != 2 {
+		t.Error("removed hook still called")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := g.Wait(ctx); err == nil {
+		t.Error("Wait() on a paused gate should return the context error")
+	}
+}
+
+func TestNilGate(t *testing.T) {
+	var g *Gate
+	if g.Pause() || g.Paused() {
+		t.Error("nil gate should never pause")
+	}
+	if err := g.Wait(context.Background()); err != nil {
+		t.Errorf("Wait() on nil gate = %v", err)
+	}
+	g.OnChange(func(bool) {})()
+}
@@ -0,0 +1,14 @@
+//go:build !unix
+
+package control
+
+import (
+	"context"
+	"os"
+)
+
+// WatchSignals is a no-op on platforms without SIGUSR1/SIGUSR2
+func WatchSignals(ctx context.Context, g *Gate) {}
+
+// SuspendProcess is a no-op on platforms without SIGSTOP/SIGCONT
+func SuspendProcess(p *os.Process, paused bool) error { return nil }
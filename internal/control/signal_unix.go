@@ -0,0 +1,41 @@
+//go:build unix
+
+package control
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// WatchSignals pauses the gate on SIGUSR1 and resumes it on SIGUSR2 until ctx is done
+func WatchSignals(ctx context.Context, g *Gate) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1, syscall.SIGUSR2)
+
+	go func() {
+		defer signal.Stop(signals)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case sig := <-signals:
+				if sig == syscall.SIGUSR1 && g.Pause() {
+					log.Printf("Scan paused (send SIGUSR2 to pid %d to resume)", os.Getpid())
+				} else if sig == syscall.SIGUSR2 && g.Resume() {
+					log.Printf("Scan resumed")
+				}
+			}
+		}
+	}()
+}
+
+// SuspendProcess stops or continues an external process such as masscan
+func SuspendProcess(p *os.Process, paused bool) error {
+	if paused {
+		return p.Signal(syscall.SIGSTOP)
+	}
+	return p.Signal(syscall.SIGCONT)
+}
@@ -4,7 +4,7 @@ import (
 	"bufio"
 	"context"
 	"crypto/tls"
-	"encoding/base64"
+	"errors"
 	"net"
 	"net/http"
 	"os"
@@ -12,7 +12,7 @@ import (
 	"time"
 )
 
-// Try default Basic creds against discovered login pages. Returns "user:pass" on first success.
+// Try default creds against discovered login pages with Basic or Digest auth, as the page asks. Returns "user:pass" on first success.
 func TryDefaultBasic(ctx context.Context, host string, loginURLs []string, credFile string, timeout time.Duration) string {
 	f, err := os.Open(credFile)
 	if err != nil { return "" }
@@ -37,26 +37,20 @@ func TryDefaultBasic(ctx context.Context, host string, loginURLs []string, credF
 
 	for _, u := range loginURLs {
 		// preflight: ensure auth is actually requested
-		req0, _ := http.NewRequestWithContext(ctx, "GET", u, nil)
-		resp0, err := client.Do(req0)
-		if err != nil { continue }
-		auth := resp0.Header.Get("WWW-Authenticate")
-		resp0.Body.Close()
-		if auth=="" && resp0.StatusCode!=401 && resp0.StatusCode!=403 {
+		challenge, protected := requiresAuth(ctx, client, u)
+		var fresh nonces
+		if !protected || acceptsAnything(ctx, client, u, challenge, &fresh) {
 			continue // skip non-protected path
 		}
 
 		for _, c := range creds {
-			up := strings.SplitN(c, ":", 2)
-			if len(up)!=2 { continue }
-			req, _ := http.NewRequestWithContext(ctx, "GET", u, nil)
-			req.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(c)))
-			resp, err := client.Do(req)
-			if err != nil { continue }
-			resp.Body.Close()
-			if resp.StatusCode==200 {
+			ok, err := testCredential(ctx, client, u, c, challenge, &fresh)
+			if ok {
 				return c // found
 			}
+			if errors.Is(err, ErrLockout) {
+				return "" // the host stopped taking logins
+			}
 		}
 	}
 	return ""
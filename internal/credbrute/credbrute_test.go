@@ -0,0 +1,327 @@
+package credbrute
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/postfix/cctvscan/internal/probe"
+)
+
+// digestServer accepts admin:12345 in answer to Digest challenges of algorithm,
+// handing out a new nonce with each one
+func digestServer(algorithm string, newHash func() hash.Hash) *httptest.Server {
+	h := func(s string) string {
+		d := newHash()
+		d.Write([]byte(s))
+		return hex.EncodeToString(d.Sum(nil))
+	}
+	var nonces atomic.Int32
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Digest ") {
+			c := probe.ParseAuthChallenges([]string{auth})[0]
+			params := make(map[string]string)
+			for _, p := range strings.Split(strings.TrimPrefix(auth, "Digest "), ", ") {
+				k, v, _ := strings.Cut(p, "=")
+				params[k] = strings.Trim(v, `"`)
+			}
+			ha1 := h("admin:" + c.Realm + ":12345")
+			ha2 := h(r.Method + ":" + params["uri"])
+			expected := h(ha1 + ":" + c.Nonce + ":" + params["nc"] + ":" + params["cnonce"] + ":auth:" + ha2)
+			if params["response"] == expected && params["qop"] == "auth" {
+				fmt.Fprint(w, "ok")
+				return
+			}
+		}
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Digest realm="IP Camera", qop="auth", nonce="n%d", algorithm=%s`, nonces.Add(1), algorithm))
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+}
+
+func TestDigest(t *testing.T) {
+	credFile := filepath.Join(t.TempDir(), "creds.txt")
+	os.WriteFile(credFile, []byte("admin:admin\nadmin:12345\nroot:root\n"), 0o600)
+	for algorithm, newHash := range map[string]func() hash.Hash{"MD5": md5.New, "SHA-256": sha256.New} {
+		srv := digestServer(algorithm, newHash)
+		defer srv.Close()
+		urls := []string{srv.URL + "/doc/page/login.asp?_=1"}
+		if got := TryDefaultBasic(context.Background(), "", urls, credFile, time.Second); got != "admin:12345" {
+			t.Errorf("TryDefaultBasic() = %q with %s Digest, expected admin:12345", got, algorithm)
+		}
+		if got := OptimizedBruteForce(context.Background(), "", urls, credFile, time.Second); got != "admin:12345" {
+			t.Errorf("OptimizedBruteForce() = %q with %s Digest, expected admin:12345", got, algorithm)
+		}
+	}
+}
+
+func TestAcceptsAnything(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, _, ok := r.BasicAuth(); !ok {
+			w.Header().Set("WWW-Authenticate", `Basic realm="IP Camera"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, "ok")
+	}))
+	defer srv.Close()
+	if got, _ := BruteForce(context.Background(), "", []string{srv.URL + "/"}, []string{"admin:admin"}, time.Second); len(got) > 0 {
+		t.Errorf("BruteForce() = %+v against a server taking any credential", got)
+	}
+}
+
+func TestBruteForceAll(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, _ := r.BasicAuth(); user+":"+pass == "admin:12345" || (r.URL.Path == "/b" && user+":"+pass == "root:pass") {
+			fmt.Fprint(w, "ok")
+			return
+		}
+		w.Header().Set("WWW-Authenticate", `Basic realm="IP Camera"`)
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+	got, err := BruteForce(context.Background(), "", []string{srv.URL + "/a", srv.URL + "/b"}, []string{"root:pass", "admin:admin", "admin:12345"}, time.Second)
+	expected := []Finding{
+		{URL: srv.URL + "/a", Credential: "admin:12345", Auth: "Basic"},
+		{URL: srv.URL + "/b", Credential: "root:pass", Auth: "Basic"},
+		{URL: srv.URL + "/b", Credential: "admin:12345", Auth: "Basic"},
+	}
+	if !slices.Equal(got, expected) || err != nil {
+		t.Errorf("BruteForce() = %+v, %v, expected %+v", got, err, expected)
+	}
+}
+
+func TestLockout(t *testing.T) {
+	var attempts atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="IP Camera"`)
+		if _, _, ok := r.BasicAuth(); ok && attempts.Add(1) > 2 {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `<userCheck><statusValue>403</statusValue><lockStatus>lock</lockStatus><unlockTime>1800</unlockTime></userCheck>`)
+			return
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+	creds := make([]string, 50)
+	for i := range creds {
+		creds[i] = fmt.Sprintf("admin:%d", i)
+	}
+	got, err := BruteForce(context.Background(), "", []string{srv.URL + "/"}, creds, time.Second)
+	if len(got) > 0 || !errors.Is(err, ErrLockout) {
+		t.Errorf("BruteForce() = %+v, %v, expected ErrLockout", got, err)
+	}
+	if n := attempts.Load(); n >= int32(len(creds)) {
+		t.Errorf("BruteForce() made %d attempts after the lockout", n)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	var mu sync.Mutex
+	var times []time.Time
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, _, ok := r.BasicAuth(); ok {
+			mu.Lock()
+			times = append(times, time.Now())
+			mu.Unlock()
+		}
+		w.Header().Set("WWW-Authenticate", `Basic realm="IP Camera"`)
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+	ctx := WithLimits(context.Background(), Limits{Rate: 20, Delay: 10 * time.Millisecond})
+	BruteForce(ctx, "", []string{srv.URL + "/"}, []string{"admin:1", "admin:2", "admin:3", "admin:4"}, time.Second)
+	if len(times) != 5 {
+		t.Fatalf("BruteForce() made %d attempts, expected 5", len(times))
+	}
+	// Four gaps of 50ms, less some slack for when the first request was scheduled
+	slices.SortFunc(times, time.Time.Compare)
+	if span := times[4].Sub(times[0]); span < 150*time.Millisecond {
+		t.Errorf("BruteForce() made 5 attempts in %v at 20 per second", span)
+	}
+}
+
+func TestDigestLimits(t *testing.T) {
+	var mu sync.Mutex
+	var times []time.Time
+	inner := digestServer("MD5", md5.New)
+	defer inner.Close()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		times = append(times, time.Now())
+		mu.Unlock()
+		inner.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	ctx := WithLimits(context.Background(), Limits{Rate: 20})
+	creds := []string{"admin:1", "admin:2", "admin:3", "admin:12345"}
+	if got, _ := BruteForce(ctx, "", []string{srv.URL + "/"}, creds, time.Second); len(got) != 1 {
+		t.Fatalf("BruteForce() = %+v, expected admin:12345", got)
+	}
+	// Every request after the first check of the URL is paced, the ones asking
+	// for a nonce included, and most attempts answer the nonce of a refusal
+	times = times[1:]
+	if len(times) < 6 || len(times) > 9 {
+		t.Fatalf("BruteForce() made %d Digest requests for 5 attempts", len(times))
+	}
+	slices.SortFunc(times, time.Time.Compare)
+	if span := times[len(times)-1].Sub(times[0]); span < time.Duration(len(times)-2)*50*time.Millisecond {
+		t.Errorf("BruteForce() made %d requests in %v at 20 per second", len(times), span)
+	}
+}
+
+func TestWithDefaults(t *testing.T) {
+	got := WithDefaults([]string{"admin:admin", "admin:12345", "root:root"}, []string{"admin:12345"})
+	if expected := []string{"admin:12345", "admin:admin", "root:root"}; !slices.Equal(got, expected) {
+		t.Errorf("WithDefaults() = %q, expected %q", got, expected)
+	}
+}
+
+func TestTryDahuaRPC2(t *testing.T) {
+	md5Hex := func(s string) string {
+		h := md5.Sum([]byte(s))
+		return strings.ToUpper(hex.EncodeToString(h[:]))
+	}
+	var logins, logouts atomic.Int32
+	var locked atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Method string `json:"method"`
+			Params struct {
+				UserName string `json:"userName"`
+				Password string `json:"password"`
+			} `json:"params"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		switch {
+		case req.Method == "global.logout":
+			logouts.Add(1)
+			fmt.Fprint(w, `{"result": true, "session": 1234}`)
+		case req.Params.UserName == "down":
+			http.Error(w, "", http.StatusServiceUnavailable)
+		case locked.Load():
+			fmt.Fprint(w, `{"result": false, "error": {"code": 268632081, "message": "User is locked"}, "session": 0}`)
+		case req.Params.Password == "":
+			fmt.Fprint(w, `{"result": false, "params": {"encryption": "Default", "random": "1714", "realm": "Login to 4L0123PAZ"}, "session": 1234}`)
+		case req.Params.UserName == "admin" && req.Params.Password == md5Hex("admin:1714:"+md5Hex("admin:Login to 4L0123PAZ:admin123")):
+			logins.Add(1)
+			fmt.Fprint(w, `{"result": true, "session": 1234}`)
+		default:
+			fmt.Fprint(w, `{"result": false, "error": {"code": 268632085, "message": "User or password not valid"}, "session": 1234}`)
+		}
+	}))
+	defer srv.Close()
+
+	expected := []Finding{{URL: srv.URL + "/RPC2_Login", Credential: "admin:admin123", Auth: "RPC2"}}
+	if got, err := TryDahuaRPC2(context.Background(), srv.URL, []string{"admin:admin", "admin:admin123"}, time.Second); !slices.Equal(got, expected) || err != nil {
+		t.Errorf("TryDahuaRPC2() = %+v, %v, expected %+v", got, err, expected)
+	}
+	if logins.Load() != 1 || logouts.Load() != 1 {
+		t.Errorf("TryDahuaRPC2() logged in %d times and out %d times, expected once each", logins.Load(), logouts.Load())
+	}
+	if got, err := TryDahuaRPC2(context.Background(), srv.URL, []string{"down:down", "admin:admin123"}, time.Second); len(got) > 0 || err != nil {
+		t.Errorf("TryDahuaRPC2() = %+v, %v failing the first login, expected no RPC2 server", got, err)
+	}
+	if got, err := TryDahuaRPC2(context.Background(), srv.URL, []string{"admin:admin", "down:down"}, time.Second); len(got) > 0 || err == nil || errors.Is(err, ErrLockout) {
+		t.Errorf("TryDahuaRPC2() = %+v, %v failing a later login, expected an error", got, err)
+	}
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if got, err := TryDahuaRPC2(cancelled, srv.URL, []string{"admin:admin123"}, time.Second); len(got) > 0 || !errors.Is(err, context.Canceled) {
+		t.Errorf("TryDahuaRPC2() = %+v, %v with a cancelled context, expected context.Canceled", got, err)
+	}
+	locked.Store(true)
+	if got, err := TryDahuaRPC2(context.Background(), srv.URL, []string{"admin:admin123"}, time.Second); len(got) > 0 || !errors.Is(err, ErrLockout) {
+		t.Errorf("TryDahuaRPC2() = %+v, %v on a locked account, expected ErrLockout", got, err)
+	}
+}
+
+func TestRPC2Locked(t *testing.T) {
+	for message, expected := range map[string]bool{
+		"User is locked":             true,
+		"User unlocked":              false,
+		"Account is not locked":      false,
+		"User or password not valid": false,
+	} {
+		var a rpc2Answer
+		a.Error.Message = message
+		if got := rpc2Locked(a); got != expected {
+			t.Errorf("rpc2Locked(%q) = %v, expected %v", message, got, expected)
+		}
+	}
+}
+
+func TestTryDahuaDVRIP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	var locked atomic.Bool
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			req := make([]byte, 32)
+			if _, err := io.ReadFull(conn, req); err == nil && req[0] == 0xa0 {
+				answer := make([]byte, 32)
+				answer[0] = 0xb0
+				switch {
+				case string(bytes.TrimRight(req[8:16], "\x00")) == "down":
+					conn.Close()
+					continue
+				case locked.Load():
+					answer[8], answer[9] = 1, 5
+				case string(bytes.TrimRight(req[8:16], "\x00")) != "888888" || string(bytes.TrimRight(req[16:24], "\x00")) != "888888":
+					answer[8], answer[9] = 1, 1
+				}
+				conn.Write(answer)
+			}
+			conn.Close()
+		}
+	}()
+	host, portText, _ := net.SplitHostPort(ln.Addr().String())
+	port, _ := strconv.Atoi(portText)
+
+	creds := []string{"admin:admin", "admin:administrator", "888888:888888"}
+	expected := []Finding{{URL: "tcp://" + ln.Addr().String(), Credential: "888888:888888", Auth: "DVRIP"}}
+	if got, err := TryDahuaDVRIP(context.Background(), host, port, creds, time.Second); !slices.Equal(got, expected) || err != nil {
+		t.Errorf("TryDahuaDVRIP() = %+v, %v, expected %+v", got, err, expected)
+	}
+	if got, err := TryDahuaDVRIP(context.Background(), host, port, []string{"admin:admin", "down:down"}, time.Second); len(got) > 0 || err == nil || errors.Is(err, ErrLockout) {
+		t.Errorf("TryDahuaDVRIP() = %+v, %v failing a later login, expected an error", got, err)
+	}
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if got, err := TryDahuaDVRIP(cancelled, host, port, creds, time.Second); len(got) > 0 || !errors.Is(err, context.Canceled) {
+		t.Errorf("TryDahuaDVRIP() = %+v, %v with a cancelled context, expected context.Canceled", got, err)
+	}
+	locked.Store(true)
+	if got, err := TryDahuaDVRIP(context.Background(), host, port, creds, time.Second); len(got) > 0 || !errors.Is(err, ErrLockout) {
+		t.Errorf("TryDahuaDVRIP() = %+v, %v on a locked account, expected ErrLockout", got, err)
+	}
+	ln.Close()
+	if got, err := TryDahuaDVRIP(context.Background(), host, port, creds, time.Second); len(got) > 0 || err != nil {
+		t.Errorf("TryDahuaDVRIP() = %+v, %v on a closed port, expected nothing", got, err)
+	}
+}
@@ -0,0 +1,116 @@
+package credbrute
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/postfix/cctvscan/internal/util"
+)
+
+// DVRIPPort is the TCP port of the binary Dahua SDK protocol (DVRIP)
+const DVRIPPort = 37777
+
+// dvripField is the size of the user and password fields of the classic login
+const dvripField = 8
+
+// Result codes of a refused DVRIP login that mean the device takes no more
+// logins: the account is locked, or the address is blacklisted
+const (
+	dvripLocked      = 5
+	dvripBlacklisted = 6
+)
+
+// TryDahuaDVRIP tries creds, user:pass each, against the binary login of the
+// Dahua SDK port of host, which recorders and cameras serve even with the web UI
+// off. Each attempt opens its own connection, and closing it ends a session it
+// opened. Credentials longer than the eight bytes the classic login holds are
+// skipped. Attempts stop with an error wrapping ErrLockout once the device
+// reports the account locked or the address blacklisted. A port that fails the
+// first login is no DVRIP server and gets no error; a failure after that, or a
+// cancelled ctx, is returned with the logins found so far.
+func TryDahuaDVRIP(ctx context.Context, host string, port int, creds []string, timeout time.Duration) ([]Finding, error) {
+	addr := net.JoinHostPort(host, util.Itoa(port))
+	var found []Finding
+	answered := false
+	for _, c := range creds {
+		user, pass, ok := strings.Cut(c, ":")
+		if !ok || len(user) > dvripField || len(pass) > dvripField {
+			continue
+		}
+		if err := Wait(ctx); err != nil {
+			return found, err
+		}
+		loggedIn, err := dvripLogin(ctx, addr, user, pass, timeout)
+		if errors.Is(err, ErrLockout) {
+			return found, err
+		}
+		if err != nil {
+			if !answered {
+				return found, nil // Not a DVRIP server
+			}
+			return found, fmt.Errorf("DVRIP login at tcp://%s: %w", addr, err)
+		}
+		answered = true
+		if loggedIn {
+			found = append(found, Finding{URL: "tcp://" + addr, Credential: c, Auth: "DVRIP"})
+		}
+	}
+	return found, nil
+}
+
+// dvripLogin sends the 32 byte login request: command 0xa0, the user and the
+// password in fixed fields and the client type. The answer, command 0xb0, has
+// the result at byte 8 (0 logged in) and the reason of a refusal at byte 9.
+func dvripLogin(ctx context.Context, addr, user, pass string, timeout time.Duration) (bool, error) {
+	dialer := net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	if _, err := conn.Write(dvripRequest(user, pass)); err != nil {
+		return false, err
+	}
+	answer := make([]byte, 32)
+	if _, err := io.ReadFull(conn, answer); err != nil {
+		return false, fmt.Errorf("no DVRIP answer from %s: %w", addr, err)
+	}
+	if answer[0] != 0xb0 {
+		return false, fmt.Errorf("not a DVRIP answer from %s", addr)
+	}
+	if answer[8] == 0 {
+		return true, nil
+	}
+	switch answer[9] {
+	case dvripLocked:
+		return false, fmt.Errorf("%w at tcp://%s: account locked", ErrLockout, addr)
+	case dvripBlacklisted:
+		return false, fmt.Errorf("%w at tcp://%s: address blacklisted", ErrLockout, addr)
+	}
+	return false, nil
+}
+
+// dvripRequest builds the classic login request for user and pass
+func dvripRequest(user, pass string) []byte {
+	var req bytes.Buffer
+	req.Write([]byte{0xa0, 0x00, 0x00, 0x60, 0x00, 0x00, 0x00, 0x00})
+	req.Write(dvripPad(user))
+	req.Write(dvripPad(pass))
+	req.Write([]byte{0x04, 0x01, 0x00, 0x00, 0x00, 0x00, 0xa1, 0xaa})
+	return req.Bytes()
+}
+
+// dvripPad fills a login field with zero bytes
+func dvripPad(s string) []byte {
+	field := make([]byte, dvripField)
+	copy(field, s)
+	return field
+}
@@ -0,0 +1,62 @@
+package credbrute
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Limits paces the logins tried on one host, as devices lock accounts or ban
+// the address after a burst of failures
+type Limits struct {
+	Rate  float64       // Attempts per second (0 = unlimited)
+	Delay time.Duration // Least time between the starts of two attempts
+}
+
+// pacer spaces out the attempts on one host, whichever of BruteForce,
+// TryDahuaRPC2, TryDahuaDVRIP and the callers of Wait makes them
+type pacer struct {
+	interval time.Duration
+	mu       sync.Mutex
+	next     time.Time
+}
+
+type pacerKey struct{}
+
+// WithLimits returns a context that paces the attempts made with it. Derive
+// one per host: every attempt made with the context shares the limits.
+func WithLimits(ctx context.Context, l Limits) context.Context {
+	interval := l.Delay
+	if l.Rate > 0 {
+		interval = max(interval, time.Duration(float64(time.Second)/l.Rate))
+	}
+	if interval <= 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, pacerKey{}, &pacer{interval: interval})
+}
+
+// Wait blocks until the next attempt on the host may start, or ctx is done.
+// Logins made outside the package, such as ONVIF, call it to share the pacing.
+func Wait(ctx context.Context) error {
+	p, ok := ctx.Value(pacerKey{}).(*pacer)
+	if !ok {
+		return ctx.Err()
+	}
+	p.mu.Lock()
+	start := time.Now()
+	if p.next.After(start) {
+		start = p.next
+	}
+	p.next = start.Add(p.interval)
+	p.mu.Unlock()
+
+	timer := time.NewTimer(time.Until(start))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
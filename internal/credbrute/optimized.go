@@ -3,21 +3,60 @@ package credbrute
 import (
 	"bufio"
 	"context"
+	"crypto/rand"
 	"crypto/tls"
-	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"os"
+	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
+
+	"github.com/postfix/cctvscan/internal/probe"
 )
 
+// ErrLockout means the device stopped taking logins after the failed ones, so
+// the host is not tried further
+var ErrLockout = errors.New("lockout triggered")
+
+// maxResets is how many connection resets in a row are taken for a lockout, as
+// some devices drop the connections of an address that failed too often
+const maxResets = 3
+
+// Finding is a credential that logged in, and where
+type Finding struct {
+	URL        string
+	Credential string // user:pass
+	Auth       string // Basic, Digest, RPC2 or DVRIP
+	Proof      string // What the credential read beyond the login page, e.g. model and firmware
+}
+
 // OptimizedBruteForce performs concurrent credential testing
 func OptimizedBruteForce(ctx context.Context, host string, loginURLs []string, credFile string, timeout time.Duration) string {
 	creds, err := loadCredentials(credFile)
-	if err != nil || len(creds) == 0 {
+	if err != nil {
 		return ""
 	}
+	if found, _ := BruteForce(ctx, host, loginURLs, creds, timeout); len(found) > 0 {
+		return found[0].Credential
+	}
+	return ""
+}
+
+// BruteForce tests creds, user:pass each, concurrently against the login URLs
+// and returns every one that works, in the order of the URLs and then of creds.
+// When the device locks the account out, every attempt on the host stops and
+// an error wrapping ErrLockout says where, beside what worked before.
+func BruteForce(ctx context.Context, host string, loginURLs []string, creds []string, timeout time.Duration) ([]Finding, error) {
+	if len(creds) == 0 {
+		return nil, nil
+	}
 
 	// Create optimized HTTP client with connection pooling
 	client := &http.Client{
@@ -31,70 +70,79 @@ func OptimizedBruteForce(ctx context.Context, host string, loginURLs []string, c
 		},
 	}
 
+	// Stop the remaining attempts once the host locks out
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var resets atomic.Int32
+	var lockout error
+	var lockOnce sync.Once
+	stop := func(err error) {
+		lockOnce.Do(func() {
+			lockout = err
+			cancel()
+		})
+	}
+
+	// Findings by URL and credential index, so the order is kept
+	found := make([]Finding, len(loginURLs)*len(creds))
+
 	// Test each URL concurrently
 	var wg sync.WaitGroup
-	resultChan := make(chan string, 1)
-
-	for _, url := range loginURLs {
+	for u, url := range loginURLs {
 		wg.Add(1)
-		go func(loginURL string) {
+		go func(u int, loginURL string) {
 			defer wg.Done()
 
 			// Quick auth check first
-			if !requiresAuth(ctx, client, loginURL) {
+			challenge, protected := requiresAuth(ctx, client, loginURL)
+			var fresh nonces
+			if !protected || acceptsAnything(ctx, client, loginURL, challenge, &fresh) {
 				return
 			}
 
 			// Test credentials concurrently
-			credChan := make(chan string, 1)
 			var credWg sync.WaitGroup
 
 			// Limit concurrent credential tests per URL
 			semaphore := make(chan struct{}, 5)
 
-			for _, cred := range creds {
+			for c, cred := range creds {
 				credWg.Add(1)
-				go func(credential string) {
+				go func(c int, credential string) {
 					defer credWg.Done()
 					semaphore <- struct{}{}
 					defer func() { <-semaphore }()
 
-					if testCredential(ctx, client, loginURL, credential) {
-						select {
-						case credChan <- credential:
-						default:
+					ok, err := testCredential(ctx, client, loginURL, credential, challenge, &fresh)
+					switch {
+					case ok:
+						found[u*len(creds)+c] = Finding{URL: loginURL, Credential: credential, Auth: authName(challenge)}
+						resets.Store(0)
+					case errors.Is(err, ErrLockout):
+						stop(err)
+					case errors.Is(err, syscall.ECONNRESET):
+						if resets.Add(1) >= maxResets {
+							stop(fmt.Errorf("%w at %s: %d connection resets in a row", ErrLockout, loginURL, maxResets))
 						}
+					case err == nil:
+						resets.Store(0)
 					}
-				}(cred)
+				}(c, cred)
 			}
-
-			// Wait for first successful credential
-			go func() {
-				credWg.Wait()
-				close(credChan)
-			}()
-
-			if foundCred := <-credChan; foundCred != "" {
-				select {
-				case resultChan <- foundCred:
-				default:
-				}
-			}
-		}(url)
+			credWg.Wait()
+		}(u, url)
 	}
+	wg.Wait()
 
-	// Wait for first result or completion
-	go func() {
-		wg.Wait()
-		close(resultChan)
-	}()
+	return slices.DeleteFunc(found, func(f Finding) bool { return f.Credential == "" }), lockout
+}
 
-	select {
-	case result := <-resultChan:
-		return result
-	default:
-		return ""
+// authName names the scheme a finding answered
+func authName(challenge probe.AuthChallenge) string {
+	if challenge.IsDigest() {
+		return "Digest"
 	}
+	return "Basic"
 }
 
 // loadCredentials loads credentials from file with caching
@@ -138,44 +186,138 @@ func loadCredentials(credFile string) ([]string, error) {
 	return creds, scanner.Err()
 }
 
-// requiresAuth checks if URL requires authentication
-func requiresAuth(ctx context.Context, client *http.Client, url string) bool {
+// Credentials returns the credentials of credFile in the order they are tried
+func Credentials(credFile string) ([]string, error) {
+	return loadCredentials(credFile)
+}
+
+// WithDefaults puts the brand's default credentials in front of creds, leaving
+// out the duplicates, so they are tried first
+func WithDefaults(creds, defaults []string) []string {
+	out := slices.Clone(defaults)
+	for _, c := range creds {
+		if !slices.Contains(out, c) {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// requiresAuth checks if URL requires authentication and returns the challenge
+// to answer: Basic when offered, else the first one, and Basic when none is named
+func requiresAuth(ctx context.Context, client *http.Client, url string) (probe.AuthChallenge, bool) {
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
-		return false
+		return probe.AuthChallenge{}, false
 	}
 
 	resp, err := client.Do(req)
 	if err != nil {
-		return false
+		return probe.AuthChallenge{}, false
 	}
 	defer resp.Body.Close()
 
 	// Check for auth requirements
-	auth := resp.Header.Get("WWW-Authenticate")
-	return auth != "" || resp.StatusCode == 401 || resp.StatusCode == 403
+	challenge, ok := probe.PreferredChallenge(probe.ParseAuthChallenges(resp.Header.Values("WWW-Authenticate")))
+	if !ok {
+		challenge = probe.AuthChallenge{Scheme: "Basic"}
+	}
+	return challenge, ok || resp.StatusCode == 401 || resp.StatusCode == 403
+}
+
+// acceptsAnything reports whether url takes a made-up credential, as devices do
+// that answer 200 once any Authorization header is sent
+func acceptsAnything(ctx context.Context, client *http.Client, url string, challenge probe.AuthChallenge, fresh *nonces) bool {
+	b := make([]byte, 8)
+	rand.Read(b)
+	ok, _ := testCredential(ctx, client, url, "cctvscan-"+hex.EncodeToString(b[:4])+":"+hex.EncodeToString(b[4:]), challenge, fresh)
+	return ok
+}
+
+// maxNonces is how many Digest challenges of refused logins are kept per URL
+const maxNonces = 5
+
+// nonces holds the Digest challenges that refused logins of one URL answered
+// with, unused so far, for the next attempts to answer instead of asking for one
+type nonces struct {
+	mu         sync.Mutex
+	challenges []probe.AuthChallenge
+}
+
+// take returns the newest challenge kept, which is then used up
+func (n *nonces) take() (probe.AuthChallenge, bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if len(n.challenges) == 0 {
+		return probe.AuthChallenge{}, false
+	}
+	c := n.challenges[len(n.challenges)-1]
+	n.challenges = n.challenges[:len(n.challenges)-1]
+	return c, true
 }
 
-// testCredential tests a single credential
-func testCredential(ctx context.Context, client *http.Client, url, credential string) bool {
-	parts := strings.SplitN(credential, ":", 2)
-	if len(parts) != 2 {
-		return false
+// put keeps the Digest challenge of a refusal, dropping the oldest beyond maxNonces
+func (n *nonces) put(resp *http.Response) {
+	c, ok := probe.PreferredChallenge(probe.ParseAuthChallenges(resp.Header.Values("WWW-Authenticate")))
+	if !ok || !c.IsDigest() {
+		return
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.challenges = append(n.challenges, c)
+	if len(n.challenges) > maxNonces {
+		n.challenges = n.challenges[1:]
+	}
+}
+
+// testCredential tests a single credential against the challenge of url. Digest
+// (RFC 7616, MD5 or SHA-256) answers a fresh challenge each time, since devices
+// may refuse a nonce reused with the same nonce count: one a refused attempt was
+// answered with, kept in fresh, or else one asked for. A refusal saying the
+// account is locked is an error wrapping ErrLockout. Every request, the one
+// asking for a nonce included, is paced by the Limits of ctx.
+func testCredential(ctx context.Context, client *http.Client, url, credential string, challenge probe.AuthChallenge, fresh *nonces) (bool, error) {
+	user, pass, ok := strings.Cut(credential, ":")
+	if !ok {
+		return false, nil
 	}
 
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
-		return false
+		return false, err
 	}
 
-	auth := base64.StdEncoding.EncodeToString([]byte(credential))
-	req.Header.Set("Authorization", "Basic "+auth)
+	if challenge.IsDigest() {
+		next, ok := fresh.take()
+		if !ok {
+			if err := Wait(ctx); err != nil {
+				return false, err
+			}
+			next, _ = requiresAuth(ctx, client, url)
+		}
+		if next.IsDigest() {
+			challenge = next
+		}
+		req.Header.Set("Authorization", challenge.DigestAuthorization(req.Method, req.URL.RequestURI(), user, pass))
+	} else {
+		req.SetBasicAuth(user, pass)
+	}
+	if err := Wait(ctx); err != nil {
+		return false, err
+	}
 
 	resp, err := client.Do(req)
 	if err != nil {
-		return false
+		return false, err
 	}
 	defer resp.Body.Close()
 
-	return resp.StatusCode == 200
+	if resp.StatusCode == 401 || resp.StatusCode == 403 {
+		fresh.put(resp)
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		if m, ok := probe.LockoutMarker(body); ok {
+			return false, fmt.Errorf("%w at %s: %d %q", ErrLockout, url, resp.StatusCode, m)
+		}
+	}
+	return resp.StatusCode == 200, nil
 }
@@ -0,0 +1,157 @@
+package credbrute
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/postfix/cctvscan/internal/probe"
+)
+
+// rpc2Answer is the part of a Dahua RPC2 answer the login needs
+type rpc2Answer struct {
+	Result  bool            `json:"result"`
+	Session json.RawMessage `json:"session"`
+	Params  struct {
+		Encryption string `json:"encryption"`
+		Random     string `json:"random"`
+		Realm      string `json:"realm"`
+	} `json:"params"`
+	Error struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// TryDahuaRPC2 tries creds, user:pass each, against the JSON RPC2 login of the
+// Dahua web UI at base, e.g. http://192.0.2.1:80, which never takes Basic auth.
+// Logins are tried one at a time, since the devices lock an account after a few
+// failures, and stop once the device says so with an error wrapping ErrLockout.
+// It returns every one that logs in. A base that fails the first login is no
+// RPC2 server and gets no error; a failure after that, or a cancelled ctx, is
+// returned with the logins found so far.
+func TryDahuaRPC2(ctx context.Context, base string, creds []string, timeout time.Duration) ([]Finding, error) {
+	client := &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+	}
+	var found []Finding
+	answered := false
+	for _, c := range creds {
+		user, pass, ok := strings.Cut(c, ":")
+		if !ok {
+			continue
+		}
+		if err := Wait(ctx); err != nil {
+			return found, err
+		}
+		loggedIn, err := rpc2Login(ctx, client, base, user, pass)
+		if errors.Is(err, ErrLockout) {
+			return found, err
+		}
+		if err != nil {
+			if !answered {
+				return found, nil // Not an RPC2 server
+			}
+			return found, fmt.Errorf("RPC2 login at %s: %w", base, err)
+		}
+		answered = true
+		if loggedIn {
+			found = append(found, Finding{URL: base + "/RPC2_Login", Credential: c, Auth: "RPC2"})
+		}
+	}
+	return found, nil
+}
+
+// rpc2Login runs the two steps of global.login: the first names the user and is
+// answered with a realm and random challenge, the second sends the password
+// hashed with them. A session it opens is logged out at once.
+func rpc2Login(ctx context.Context, client *http.Client, base, user, pass string) (bool, error) {
+	first := map[string]any{"method": "global.login", "params": map[string]any{"userName": user, "password": "", "clientType": "Web3.0"}, "id": 1, "session": 0}
+	challenge, err := rpc2Call(ctx, client, base+"/RPC2_Login", first)
+	if err != nil {
+		return false, err
+	}
+	if challenge.Params.Random == "" {
+		if rpc2Locked(challenge) {
+			return false, fmt.Errorf("%w at %s/RPC2_Login: %s", ErrLockout, base, challenge.Error.Message)
+		}
+		return false, fmt.Errorf("no login challenge from %s", base)
+	}
+	if len(challenge.Session) == 0 {
+		challenge.Session = json.RawMessage("0")
+	}
+	if e := challenge.Params.Encryption; e != "Default" && e != "" {
+		return false, fmt.Errorf("unsupported RPC2 encryption %q", e)
+	}
+	second := map[string]any{"method": "global.login", "params": map[string]any{
+		"userName": user, "password": rpc2Password(user, pass, challenge.Params.Realm, challenge.Params.Random), "clientType": "Web3.0",
+		"loginType": "Direct", "authorityType": "Default", "passwordType": "Default",
+	}, "id": 2, "session": challenge.Session}
+	answer, err := rpc2Call(ctx, client, base+"/RPC2_Login", second)
+	if err != nil {
+		return false, err
+	}
+	if !answer.Result {
+		if rpc2Locked(answer) {
+			return false, fmt.Errorf("%w at %s/RPC2_Login: %s", ErrLockout, base, answer.Error.Message)
+		}
+		return false, nil
+	}
+	if len(answer.Session) > 0 {
+		logout := map[string]any{"method": "global.logout", "params": nil, "id": 3, "session": answer.Session}
+		rpc2Call(ctx, client, base+"/RPC2", logout)
+	}
+	return true, nil
+}
+
+// rpc2Password hashes the password as the web UI does for the Default
+// encryption: MD5 over the user, the random and the MD5 of user, realm and
+// password, both in upper case hex
+func rpc2Password(user, pass, realm, random string) string {
+	md5Hex := func(s string) string {
+		h := md5.Sum([]byte(s))
+		return strings.ToUpper(hex.EncodeToString(h[:]))
+	}
+	return md5Hex(user + ":" + random + ":" + md5Hex(user+":"+realm+":"+pass))
+}
+
+// rpc2Locked reports whether a refused login says the account is locked
+func rpc2Locked(a rpc2Answer) bool {
+	_, ok := probe.LockoutMarker([]byte(a.Error.Message))
+	return ok
+}
+
+// rpc2Call posts one RPC2 request and decodes the answer
+func rpc2Call(ctx context.Context, client *http.Client, url string, request map[string]any) (rpc2Answer, error) {
+	body, _ := json.Marshal(request)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return rpc2Answer{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return rpc2Answer{}, err
+	}
+	defer resp.Body.Close()
+	var answer rpc2Answer
+	if resp.StatusCode != http.StatusOK {
+		return rpc2Answer{}, fmt.Errorf("%s from %s", resp.Status, url)
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&answer); err != nil {
+		return rpc2Answer{}, fmt.Errorf("not an RPC2 answer from %s: %w", url, err)
+	}
+	return answer, nil
+}
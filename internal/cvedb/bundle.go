@@ -0,0 +1,107 @@
+package cvedb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Bundle is an offline snapshot of the CVE store update-cves keeps, exported
+// on a host with internet access and imported on an air-gapped one
+type Bundle struct {
+	Schema int             `json:"schema"` // FeedSchema of the writer
+	Feed   Feed            `json:"feed"`
+	KEV    json.RawMessage `json:"kev,omitempty"`  // CISA catalog as fetched
+	EPSS   map[string]EPSS `json:"epss,omitempty"` // Scores by CVE ID
+}
+
+// Version returns the date the NVD feed of the bundle was fetched, e.g.
+// 2026-10-01, which names the snapshot
+func (b Bundle) Version() string {
+	return b.Feed.Updated.Format(time.DateOnly)
+}
+
+// NewBundle reads the CVE data of the store s into a bundle; the KEV catalog and
+// EPSS scores are left out when the store has none
+func NewBundle(s *Store) (Bundle, error) {
+	b := Bundle{Schema: FeedSchema}
+	var err error
+	if b.Feed, err = s.Feed(); err != nil {
+		return Bundle{}, err
+	}
+	if b.Feed.Updated.IsZero() {
+		return Bundle{}, errors.New("CVE store has no NVD data")
+	}
+	if b.KEV, err = s.KEVCatalog(); err != nil {
+		return Bundle{}, err
+	}
+	if b.EPSS, err = s.EPSS(); err != nil {
+		return Bundle{}, err
+	}
+	return b, nil
+}
+
+// SaveBundle writes b to path
+func SaveBundle(path string, b Bundle) error {
+	data, err := json.Marshal(b)
+	if err != nil {
+		return fmt.Errorf("failed to encode CVE bundle: %w", err)
+	}
+	return writeFile(path, data)
+}
+
+// ReadBundle reads the bundle at path, refusing one of a newer format or with
+// a KEV catalog that doesn't parse
+func ReadBundle(path string) (Bundle, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Bundle{}, fmt.Errorf("failed to read CVE bundle: %w", err)
+	}
+	var b Bundle
+	if err := json.Unmarshal(data, &b); err != nil {
+		return Bundle{}, fmt.Errorf("failed to parse CVE bundle %s: %w", path, err)
+	}
+	if b.Schema > FeedSchema || b.Feed.Schema > FeedSchema {
+		return Bundle{}, fmt.Errorf("CVE bundle %s has schema %d, this build reads up to %d: update cctvscan", path, max(b.Schema, b.Feed.Schema), FeedSchema)
+	}
+	if b.Feed.Updated.IsZero() {
+		return Bundle{}, fmt.Errorf("CVE bundle %s has no feed", path)
+	}
+	if len(b.KEV) > 0 {
+		if _, err := parseKEV(b.KEV); err != nil {
+			return Bundle{}, fmt.Errorf("CVE bundle %s: %w", path, err)
+		}
+	}
+	return b, nil
+}
+
+// Install stores the data of the bundle in s in place of its NVD data; the KEV
+// catalog and EPSS scores are merged, and kept as they are when the bundle
+// lacks them
+func (b Bundle) Install(s *Store) error {
+	if _, err := s.Replace(b.Feed); err != nil {
+		return err
+	}
+	if len(b.KEV) > 0 {
+		if _, err := s.PutKEV(b.KEV); err != nil {
+			return err
+		}
+	}
+	if b.EPSS != nil {
+		if err := s.PutEPSS(b.EPSS); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Updated returns when the NVD data of the store in use was fetched, or the
+// zero time when only the built-in list is in use
+func Updated() time.Time {
+	if s := currentStore(); s != nil {
+		return s.Updated()
+	}
+	return time.Time{}
+}
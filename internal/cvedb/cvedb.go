@@ -1,5 +1,9 @@
+// Package cvedb lists the CVEs of camera brands: a built-in list of the
+// well-known ones, extended by the NVD data update-cves keeps in a local store.
 package cvedb
 
+import "slices"
+
 var db = map[string][]string{
 	"hikvision": {
 		"CVE-2021-36260", "CVE-2017-7921", "CVE-2021-31955", "CVE-2021-31956",
@@ -44,8 +48,17 @@ var db = map[string][]string{
 	},
 }
 
+// ForBrand returns the CVEs of brand, in lowercase: the built-in list followed by
+// those of the store in use, newest first
 func ForBrand(brand string) []string {
-	if v, ok := db[brand]; ok { return append([]string(nil), v...) }
-	return nil
+	cves := append([]string(nil), db[brand]...)
+	if s := currentStore(); s != nil {
+		for _, id := range s.brandCVEs(brand) {
+			if !slices.Contains(cves, id) {
+				cves = append(cves, id)
+			}
+		}
+	}
+	return cves
 }
 
@@ -0,0 +1,101 @@
+package cvedb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// DefaultEPSSURL is the API of FIRST's Exploit Prediction Scoring System
+const DefaultEPSSURL = "https://api.first.org/data/v1/epss"
+
+// epssBatch is how many CVEs are asked for per request, keeping the URL short
+const epssBatch = 100
+
+// EPSS is the probability that a CVE is exploited in the next 30 days
+type EPSS struct {
+	Score      float64 `json:"epss"`       // 0 to 1
+	Percentile float64 `json:"percentile"` // Share of all CVEs scored lower
+	Date       string  `json:"date"`       // YYYY-MM-DD the model scored it
+}
+
+// EPSSFor returns the EPSS score of the CVE id in the store in use
+func EPSSFor(id string) (EPSS, bool) {
+	if s := currentStore(); s != nil {
+		return getJSON[EPSS](s, epssBucket, id)
+	}
+	return EPSS{}, false
+}
+
+// IDs returns every CVE of the built-in list and the store in use
+func IDs() []string {
+	set := make(map[string]bool)
+	for _, cves := range db {
+		for _, id := range cves {
+			set[id] = true
+		}
+	}
+	if s := currentStore(); s != nil {
+		for _, id := range s.ids() {
+			set[id] = true
+		}
+	}
+	return slices.Sorted(maps.Keys(set))
+}
+
+// FetchEPSS asks the EPSS API at url for the scores of cves
+func FetchEPSS(ctx context.Context, client *http.Client, url string, cves []string) (map[string]EPSS, error) {
+	scores := make(map[string]EPSS, len(cves))
+	for batch := range slices.Chunk(cves, epssBatch) {
+		if err := fetchEPSSBatch(ctx, client, url, batch, scores); err != nil {
+			return nil, err
+		}
+	}
+	return scores, nil
+}
+
+// fetchEPSSBatch adds the scores of one request to scores
+func fetchEPSSBatch(ctx context.Context, client *http.Client, api string, cves []string, scores map[string]EPSS) error {
+	q := url.Values{}
+	q.Set("cve", strings.Join(cves, ","))
+	q.Set("limit", strconv.Itoa(len(cves)))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, api+"?"+q.Encode(), nil)
+	if err != nil {
+		return fmt.Errorf("failed to query EPSS: %w", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to query EPSS: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to query EPSS: %s", resp.Status)
+	}
+	// The API sends the numbers as strings
+	var page struct {
+		Data []struct {
+			CVE        string `json:"cve"`
+			EPSS       string `json:"epss"`
+			Percentile string `json:"percentile"`
+			Date       string `json:"date"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+		return fmt.Errorf("failed to parse EPSS answer: %w", err)
+	}
+	for _, d := range page.Data {
+		score, err := strconv.ParseFloat(d.EPSS, 64)
+		if err != nil {
+			return fmt.Errorf("invalid EPSS score %q of %s", d.EPSS, d.CVE)
+		}
+		percentile, _ := strconv.ParseFloat(d.Percentile, 64)
+		scores[d.CVE] = EPSS{Score: score, Percentile: percentile, Date: d.Date}
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package cvedb
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Exploits are public exploits of a CVE
+type Exploits struct {
+	Metasploit []string `json:"metasploit,omitempty"` // Module names, e.g. exploit/linux/http/axis_srv_parhand_rce
+	ExploitDB  []string `json:"exploitdb,omitempty"`  // Exploit-DB IDs
+}
+
+// builtinExploits are the Metasploit modules of built-in CVEs; feeds add those
+// their NVD references link to
+var builtinExploits = map[string]Exploits{
+	"CVE-2021-36260": {Metasploit: []string{"exploit/linux/http/hikvision_cve_2021_36260_blind"}},
+	"CVE-2018-10660": {Metasploit: []string{"exploit/linux/http/axis_srv_parhand_rce"}},
+}
+
+// Reference URLs naming an exploit
+var (
+	exploitDBRe  = regexp.MustCompile(`exploit-db\.com/exploits/(\d+)`)
+	msfSourceRe  = regexp.MustCompile(`metasploit-framework/(?:blob|tree)/[^/]+/modules/(exploits|auxiliary|post)/([\w/]+)\.rb`)
+	msfModulesRe = regexp.MustCompile(`rapid7\.com/db/modules/(exploit|auxiliary|post)/([\w/]+?)/?$`)
+)
+
+// ExploitsFor returns the public exploits of the CVE id known to the built-in
+// list and the loaded feed
+func ExploitsFor(id string) Exploits {
+	x := builtinExploits[id]
+	x = Exploits{Metasploit: slices.Clone(x.Metasploit), ExploitDB: slices.Clone(x.ExploitDB)}
+	if e, ok := Lookup(id); ok {
+		x.add(e.Exploits)
+	}
+	return x
+}
+
+// Empty reports whether no exploit is known
+func (x Exploits) Empty() bool {
+	return len(x.Metasploit) == 0 && len(x.ExploitDB) == 0
+}
+
+// add appends the exploits of o not in x yet
+func (x *Exploits) add(o Exploits) {
+	for _, m := range o.Metasploit {
+		if !slices.Contains(x.Metasploit, m) {
+			x.Metasploit = append(x.Metasploit, m)
+		}
+	}
+	for _, id := range o.ExploitDB {
+		if !slices.Contains(x.ExploitDB, id) {
+			x.ExploitDB = append(x.ExploitDB, id)
+		}
+	}
+}
+
+// exploitRefs picks the Exploit-DB entries and Metasploit modules out of the
+// reference URLs of a CVE
+func exploitRefs(urls []string) Exploits {
+	var x Exploits
+	for _, u := range urls {
+		if m := exploitDBRe.FindStringSubmatch(u); m != nil {
+			x.add(Exploits{ExploitDB: []string{m[1]}})
+		}
+		if m := msfSourceRe.FindStringSubmatch(u); m != nil {
+			// The source tree says exploits where module names say exploit
+			x.add(Exploits{Metasploit: []string{strings.TrimSuffix(m[1], "s") + "/" + m[2]}})
+		}
+		if m := msfModulesRe.FindStringSubmatch(u); m != nil {
+			x.add(Exploits{Metasploit: []string{m[1] + "/" + m[2]}})
+		}
+	}
+	return x
+}
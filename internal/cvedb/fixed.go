@@ -0,0 +1,38 @@
+package cvedb
+
+import "strings"
+
+// FixedIn returns the first firmware fixing the CVE id on a device of brand and
+// model: the firmware_before of a local entry covering the model, or else the
+// version the NVD ends the affected range of the product at. It returns "" when
+// neither knows one for the model.
+func FixedIn(id, brand, model string) string {
+	feedMu.RLock()
+	entries := local
+	feedMu.RUnlock()
+	for _, e := range entries {
+		if e.CVE == id && strings.EqualFold(e.Brand, brand) && e.FirmwareBefore != "" && e.hasModel(model) {
+			return e.FirmwareBefore
+		}
+	}
+	// The longest product the model starts with, e.g. ds-2cd2032-i over ds-2cd2032
+	entry, _ := feedEntry(id)
+	model = bareModel(brand, model)
+	product := ""
+	for p := range entry.Fixed {
+		if model != "" && strings.HasPrefix(model, p) && len(p) > len(product) {
+			product = p
+		}
+	}
+	if product == "" {
+		return ""
+	}
+	return entry.Fixed[product]
+}
+
+// FirmwareBefore reports whether the version in firmware, e.g. "V5.4.0 build
+// 160530", is older than fixed; false when either has no version
+func FirmwareBefore(firmware, fixed string) bool {
+	a, b := versionRe.FindString(firmware), versionRe.FindString(fixed)
+	return a != "" && b != "" && compareVersions(a, b) < 0
+}
@@ -0,0 +1,102 @@
+package cvedb
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// DefaultKEVURL is the JSON feed of the CISA Known Exploited Vulnerabilities
+// catalog
+const DefaultKEVURL = "https://www.cisa.gov/sites/default/files/feeds/known_exploited_vulnerabilities.json"
+
+// maxKEVSize bounds the download, the catalog is some 1.5 MB
+const maxKEVSize = 32 << 20
+
+// defaultKEV holds the camera CVEs of the catalog; update-cves stores the whole
+// of it
+//
+//go:embed kev.json
+var defaultKEV []byte
+
+// KEVEntry is a CVE of the KEV catalog, exploited in the wild
+type KEVEntry struct {
+	CVEID         string `json:"cveID"`
+	VendorProject string `json:"vendorProject"`
+	Product       string `json:"product"`
+	Name          string `json:"vulnerabilityName"`
+	DateAdded     string `json:"dateAdded"`                            // YYYY-MM-DD
+	Ransomware    string `json:"knownRansomwareCampaignUse,omitempty"` // Known or Unknown
+}
+
+// kevCatalog is the format of the KEV feed
+type kevCatalog struct {
+	Version         string     `json:"catalogVersion,omitempty"`
+	Vulnerabilities []KEVEntry `json:"vulnerabilities"`
+}
+
+// kev holds the built-in entries by CVE ID
+var kev map[string]KEVEntry
+
+func init() {
+	catalog, err := parseKEV(defaultKEV)
+	if err != nil {
+		panic("cvedb: built-in KEV catalog: " + err.Error())
+	}
+	kev = catalog
+}
+
+// KEV returns the catalog entry of the CVE id when it is known to be exploited,
+// from the store in use or else the built-in entries
+func KEV(id string) (KEVEntry, bool) {
+	if s := currentStore(); s != nil {
+		if e, ok := getJSON[KEVEntry](s, kevBucket, id); ok {
+			return e, true
+		}
+	}
+	e, ok := kev[id]
+	return e, ok
+}
+
+// FetchKEV downloads the KEV feed at url and returns it once it parses
+func FetchKEV(ctx context.Context, client *http.Client, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download KEV catalog: %w", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download KEV catalog: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download KEV catalog: %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxKEVSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to download KEV catalog: %w", err)
+	}
+	if _, err := parseKEV(data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// parseKEV decodes a KEV feed into its entries by CVE ID
+func parseKEV(data []byte) (map[string]KEVEntry, error) {
+	var c kevCatalog
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("failed to parse KEV catalog: %w", err)
+	}
+	if len(c.Vulnerabilities) == 0 {
+		return nil, fmt.Errorf("KEV catalog %s lists no vulnerabilities", c.Version)
+	}
+	entries := make(map[string]KEVEntry, len(c.Vulnerabilities))
+	for _, e := range c.Vulnerabilities {
+		entries[e.CVEID] = e
+	}
+	return entries, nil
+}
@@ -0,0 +1,237 @@
+package cvedb
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/postfix/cctvscan/internal/util"
+)
+
+// LocalEntry is a CVE of a local feed, such as a vendor advisory a security team
+// tracks before the NVD has it. An entry with models covers devices whose model
+// starts with one of them, and one with firmware_before firmware older than that
+// version; a device whose model or firmware is unknown is not ruled out.
+type LocalEntry struct {
+	CVE            string   `json:"cve"`                       // e.g. CVE-2024-12345, or an advisory ID
+	Brand          string   `json:"brand"`                     // Brand as named by the signatures, e.g. Hikvision
+	Models         []string `json:"models,omitempty"`          // Model prefixes, e.g. ds-76
+	FirmwareBefore string   `json:"firmware_before,omitempty"` // First fixed firmware version, e.g. 4.62.210
+	CVSS           float64  `json:"cvss,omitempty"`            // CVSS v3 base score
+	Note           string   `json:"note,omitempty"`            // What is affected, e.g. the advisory
+}
+
+// LocalFeed is the format of local CVE files in JSON
+type LocalFeed struct {
+	Entries []LocalEntry `json:"entries"`
+}
+
+// localColumns are the columns of local CVE files in CSV, named in the header
+// line; models are separated by semicolons
+var localColumns = []string{"cve", "brand", "models", "firmware_before", "cvss", "note"}
+
+// local holds the entries of the loaded local feeds
+var local []LocalEntry
+
+// LoadLocal adds the entries of the local CVE file at path, CSV when it ends in
+// .csv and JSON otherwise
+func LoadLocal(path string) error {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read CVE file: %w", err)
+	}
+	var entries []LocalEntry
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		entries, err = parseLocalCSV(string(raw))
+	} else {
+		var f LocalFeed
+		if err = json.Unmarshal(raw, &f); err != nil {
+			err = fmt.Errorf("failed to parse CVE file: %w", err)
+		}
+		entries = f.Entries
+	}
+	if err != nil {
+		return fmt.Errorf("CVE file %s: %w", path, err)
+	}
+	for i := range entries {
+		if err := normalizeLocal(&entries[i]); err != nil {
+			return fmt.Errorf("CVE file %s: entry %d: %w", path, i, err)
+		}
+	}
+	feedMu.Lock()
+	local = append(local, entries...)
+	feedMu.Unlock()
+	return nil
+}
+
+// parseLocalCSV decodes a local CVE file in CSV
+func parseLocalCSV(raw string) ([]LocalEntry, error) {
+	r := csv.NewReader(strings.NewReader(raw))
+	r.Comment = '#'
+	r.FieldsPerRecord = -1
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CVE file: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, errors.New("no header line")
+	}
+	index := make(map[string]int)
+	for i, name := range records[0] {
+		index[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range localColumns[:2] {
+		if _, ok := index[name]; !ok {
+			return nil, fmt.Errorf("no %s column, expected a header line naming %s", name, strings.Join(localColumns, ","))
+		}
+	}
+	field := func(record []string, name string) string {
+		if i, ok := index[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	var entries []LocalEntry
+	for n, record := range records[1:] {
+		e := LocalEntry{
+			CVE:            field(record, "cve"),
+			Brand:          field(record, "brand"),
+			FirmwareBefore: field(record, "firmware_before"),
+			Note:           field(record, "note"),
+		}
+		for _, m := range strings.Split(field(record, "models"), ";") {
+			if m = strings.TrimSpace(m); m != "" {
+				e.Models = append(e.Models, m)
+			}
+		}
+		if s := field(record, "cvss"); s != "" {
+			if e.CVSS, err = strconv.ParseFloat(s, 64); err != nil {
+				return nil, fmt.Errorf("line %d: cvss %q is not a number", n+2, s)
+			}
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// normalizeLocal checks an entry, lowercasing model prefixes
+func normalizeLocal(e *LocalEntry) error {
+	if e.CVE = strings.ToUpper(strings.TrimSpace(e.CVE)); e.CVE == "" {
+		return errors.New("no cve")
+	}
+	if e.Brand = strings.TrimSpace(e.Brand); e.Brand == "" {
+		return fmt.Errorf("%s has no brand", e.CVE)
+	}
+	if e.FirmwareBefore != "" && versionRe.FindString(e.FirmwareBefore) == "" {
+		return fmt.Errorf("%s: firmware_before %q is not a version", e.CVE, e.FirmwareBefore)
+	}
+	if e.CVSS < 0 || e.CVSS > 10 {
+		return fmt.Errorf("%s: cvss %v is not between 0 and 10", e.CVE, e.CVSS)
+	}
+	models := e.Models[:0]
+	for _, m := range e.Models {
+		if m = strings.ToLower(strings.TrimSpace(m)); m != "" {
+			models = append(models, m)
+		}
+	}
+	e.Models = models
+	return nil
+}
+
+// ForDevice returns the CVEs of the local feeds covering a device of brand with
+// the given model and firmware
+func ForDevice(brand, model, firmware string) []string {
+	feedMu.RLock()
+	entries := local
+	feedMu.RUnlock()
+	var cves []string
+	for _, e := range entries {
+		if strings.EqualFold(e.Brand, brand) && e.covers(model, firmware) {
+			cves = append(cves, e.CVE)
+		}
+	}
+	return cves
+}
+
+// LocalNote returns the note of the first local entry of the CVE id
+func LocalNote(id string) string {
+	if e, ok := localEntry(id); ok {
+		return e.Note
+	}
+	return ""
+}
+
+// localEntry returns the first local entry of the CVE id
+func localEntry(id string) (LocalEntry, bool) {
+	feedMu.RLock()
+	defer feedMu.RUnlock()
+	for _, e := range local {
+		if e.CVE == id {
+			return e, true
+		}
+	}
+	return LocalEntry{}, false
+}
+
+// covers reports whether the entry may cover a device with the given model and
+// firmware; an unknown model or firmware rules nothing out
+func (e LocalEntry) covers(model, firmware string) bool {
+	if !e.hasModel(model) {
+		return false
+	}
+	if version := versionRe.FindString(firmware); version != "" && e.FirmwareBefore != "" {
+		return compareVersions(version, versionRe.FindString(e.FirmwareBefore)) < 0
+	}
+	return true
+}
+
+// hasModel reports whether the entry may cover model; an unknown model or an
+// entry for any model rules nothing out
+func (e LocalEntry) hasModel(model string) bool {
+	model = bareModel(e.Brand, model)
+	return model == "" || len(e.Models) == 0 || slices.ContainsFunc(e.Models, func(p string) bool { return strings.HasPrefix(model, p) })
+}
+
+// bareModel lowercases model and cuts the brand some devices put in front of
+// it, e.g. AXIS P1448-LE
+func bareModel(brand, model string) string {
+	model = strings.ToLower(strings.TrimSpace(model))
+	if rest, ok := strings.CutPrefix(model, strings.ToLower(brand)); ok {
+		model = strings.TrimLeft(rest, " -_")
+	}
+	return model
+}
+
+// versionRe pulls the dotted version out of firmware strings such as
+// "V5.4.5 build 170124"
+var versionRe = regexp.MustCompile(`\d+(?:\.\d+)+`)
+
+// compareVersions compares dotted numeric versions, e.g. 5.2.9 < 5.3.0; missing
+// components count as 0
+func compareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < max(len(as), len(bs)); i++ {
+		var x, y int
+		if i < len(as) {
+			x = util.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y = util.Atoi(bs[i])
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,317 @@
+package cvedb
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultNVDURL is the CVE endpoint of the NVD 2.0 API
+const DefaultNVDURL = "https://services.nvd.nist.gov/rest/json/cves/2.0"
+
+// nvdPageSize is the most CVEs the API returns per request
+const nvdPageSize = 2000
+
+// The NVD allows 5 requests in 30 seconds, or 50 with an API key
+const (
+	nvdDelay    = 6 * time.Second
+	nvdKeyDelay = 600 * time.Millisecond
+)
+
+// MaxModifiedRange is the longest range of modification dates the NVD answers
+// for; a store updated longer ago needs a full sync
+const MaxModifiedRange = 120 * 24 * time.Hour
+
+// nvdTime is the date format of the NVD API parameters
+const nvdTime = "2006-01-02T15:04:05.000-07:00"
+
+// FeedSchema is the version of the feed format this build reads and writes. It
+// goes up whenever a field changes meaning, so an older build refuses a feed it
+// would misread instead of reporting wrong CVEs.
+const FeedSchema = 1
+
+// Feed is the CVE data of an NVD sync, as update-cves stores it and offline
+// bundles carry it
+type Feed struct {
+	Schema  int                `json:"schema"` // FeedSchema of the writer; 0 for files before it was added
+	Updated time.Time          `json:"updated"`
+	Source  string             `json:"source"`
+	Brands  map[string][]Entry `json:"brands"` // By brand in lowercase, newest first
+}
+
+// Entry is one CVE of a feed
+type Entry struct {
+	ID        string  `json:"id"`
+	Published string  `json:"published,omitempty"`   // YYYY-MM-DD
+	CVSS      float64 `json:"cvss,omitempty"`        // CVSS v3 base score
+	Vector    string  `json:"cvss_vector,omitempty"` // e.g. CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H
+	Severity  string  `json:"severity,omitempty"`    // CRITICAL, HIGH, MEDIUM, LOW or NONE
+	Summary   string  `json:"summary,omitempty"`     // First sentence of the English description
+
+	Products []string          `json:"products,omitempty"` // Vulnerable products, see Products
+	Fixed    map[string]string `json:"fixed,omitempty"`    // First fixed firmware by product, see FixedIn
+
+	Exploits // Linked from the NVD references
+}
+
+// feedMu guards the store in use and the local feeds
+var feedMu sync.RWMutex
+
+// Lookup returns what the store in use knows about the CVE id, such as its score,
+// or else the score a local feed gives it
+func Lookup(id string) (Entry, bool) {
+	if e, ok := feedEntry(id); ok {
+		return e, true
+	}
+	if l, ok := localEntry(id); ok && l.CVSS > 0 {
+		return Entry{ID: id, CVSS: l.CVSS, Severity: Severity(l.CVSS)}, true
+	}
+	return Entry{}, false
+}
+
+// Severity returns the CVSS v3 rating of score: LOW below 4, MEDIUM below 7,
+// HIGH below 9 and CRITICAL above; "" for 0, which entries use for not scored
+func Severity(score float64) string {
+	switch {
+	case score <= 0:
+		return ""
+	case score < 4:
+		return "LOW"
+	case score < 7:
+		return "MEDIUM"
+	case score < 9:
+		return "HIGH"
+	}
+	return "CRITICAL"
+}
+
+// severities are the ratings Severity returns, from the lowest
+var severities = []string{"LOW", "MEDIUM", "HIGH", "CRITICAL"}
+
+// SeverityRank orders ratings: 1 for LOW up to 4 for CRITICAL, in any case, and
+// 0 for anything else such as "" or NONE
+func SeverityRank(severity string) int {
+	return slices.Index(severities, strings.ToUpper(severity)) + 1
+}
+
+// writeFile replaces the file at path whole with data
+func writeFile(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// NVD pages through the NVD 2.0 CVE API within its rate limit
+type NVD struct {
+	Client *http.Client
+	URL    string        // DefaultNVDURL, or a mirror
+	APIKey string        // Sent as the apiKey header when set
+	Delay  time.Duration // Pause between requests
+	Since  time.Time     // Only fetch CVEs modified since, within MaxModifiedRange
+
+	requests int
+	now      time.Time // End of the modification range of the current sync
+}
+
+// NewNVD returns a client for the public API, pausing as its rate limit for
+// apiKey requires
+func NewNVD(apiKey string) *NVD {
+	n := &NVD{Client: http.DefaultClient, URL: DefaultNVDURL, APIKey: apiKey, Delay: nvdDelay}
+	if apiKey != "" {
+		n.Delay = nvdKeyDelay
+	}
+	return n
+}
+
+// Sync fetches the CVEs of every brand in vendors, which maps brands in
+// lowercase to their vendor in CPE names, e.g. cp plus to cpplus. With Since set
+// only the CVEs modified since are fetched, to be merged into a store.
+func (n *NVD) Sync(ctx context.Context, vendors map[string]string) (Feed, error) {
+	n.now = time.Now().UTC()
+	f := Feed{Schema: FeedSchema, Updated: n.now, Source: n.URL, Brands: make(map[string][]Entry)}
+	byVendor := make(map[string][]Entry)
+	for _, brand := range slices.Sorted(maps.Keys(vendors)) {
+		vendor := vendors[brand]
+		entries, ok := byVendor[vendor]
+		if !ok {
+			var err error
+			if entries, err = n.Vendor(ctx, vendor); err != nil {
+				return Feed{}, err
+			}
+			byVendor[vendor] = entries
+		}
+		if len(entries) > 0 {
+			f.Brands[brand] = entries
+		}
+	}
+	return f, nil
+}
+
+// nvdPage is the part of an NVD 2.0 API answer update-cves keeps
+type nvdPage struct {
+	TotalResults    int `json:"totalResults"`
+	Vulnerabilities []struct {
+		CVE struct {
+			ID           string `json:"id"`
+			Published    string `json:"published"`
+			Descriptions []struct {
+				Lang  string `json:"lang"`
+				Value string `json:"value"`
+			} `json:"descriptions"`
+			Metrics struct {
+				V31 []nvdMetric `json:"cvssMetricV31"`
+				V30 []nvdMetric `json:"cvssMetricV30"`
+			} `json:"metrics"`
+			References []struct {
+				URL string `json:"url"`
+			} `json:"references"`
+			Configurations []struct {
+				Nodes []struct {
+					CPEMatch []cpeMatch `json:"cpeMatch"`
+				} `json:"nodes"`
+			} `json:"configurations"`
+		} `json:"cve"`
+	} `json:"vulnerabilities"`
+}
+
+// cpeMatch is a CPE match criterion of a CVE; an affected version range ending
+// before a version names the first fixed one
+type cpeMatch struct {
+	Vulnerable          bool   `json:"vulnerable"`
+	Criteria            string `json:"criteria"`
+	VersionEndExcluding string `json:"versionEndExcluding"`
+}
+
+// nvdMetric is a CVSS v3 score of the NVD or a CNA
+type nvdMetric struct {
+	Type     string `json:"type"` // Primary for the NVD's own, Secondary for a CNA's
+	CVSSData struct {
+		VectorString string  `json:"vectorString"`
+		BaseScore    float64 `json:"baseScore"`
+		BaseSeverity string  `json:"baseSeverity"`
+	} `json:"cvssData"`
+}
+
+// cvss picks the NVD's own v3.1 score, then a CNA's, then a v3.0 one
+func cvss(v31, v30 []nvdMetric) (nvdMetric, bool) {
+	for _, metrics := range [][]nvdMetric{v31, v30} {
+		for _, primary := range []bool{true, false} {
+			for _, m := range metrics {
+				if (m.Type == "Primary") == primary {
+					return m, true
+				}
+			}
+		}
+	}
+	return nvdMetric{}, false
+}
+
+// Vendor fetches the CVEs of any product of vendor, newest first
+func (n *NVD) Vendor(ctx context.Context, vendor string) ([]Entry, error) {
+	var entries []Entry
+	for start := 0; ; start += nvdPageSize {
+		page, err := n.page(ctx, vendor, start)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range page.Vulnerabilities {
+			published, _, _ := strings.Cut(v.CVE.Published, "T")
+			e := Entry{ID: v.CVE.ID, Published: published}
+			for _, d := range v.CVE.Descriptions {
+				if d.Lang == "en" {
+					e.Summary = summarize(d.Value)
+					break
+				}
+			}
+			var urls []string
+			for _, r := range v.CVE.References {
+				urls = append(urls, r.URL)
+			}
+			e.Exploits = exploitRefs(urls)
+			var criteria []string
+			var matches []cpeMatch
+			for _, c := range v.CVE.Configurations {
+				for _, node := range c.Nodes {
+					for _, m := range node.CPEMatch {
+						if m.Vulnerable {
+							criteria = append(criteria, m.Criteria)
+							matches = append(matches, m)
+						}
+					}
+				}
+			}
+			e.Products, e.Fixed = cpeProducts(vendor, criteria), cpeFixed(vendor, matches)
+			if m, ok := cvss(v.CVE.Metrics.V31, v.CVE.Metrics.V30); ok {
+				e.CVSS, e.Vector, e.Severity = m.CVSSData.BaseScore, m.CVSSData.VectorString, m.CVSSData.BaseSeverity
+			}
+			entries = append(entries, e)
+		}
+		if len(page.Vulnerabilities) == 0 || start+nvdPageSize >= page.TotalResults {
+			break
+		}
+	}
+	slices.SortFunc(entries, func(a, b Entry) int {
+		return cmp.Or(cmp.Compare(b.Published, a.Published), cmp.Compare(b.ID, a.ID))
+	})
+	return slices.CompactFunc(entries, func(a, b Entry) bool { return a.ID == b.ID }), nil
+}
+
+// page fetches the CVEs of vendor from index start on
+func (n *NVD) page(ctx context.Context, vendor string, start int) (nvdPage, error) {
+	if n.requests > 0 && n.Delay > 0 {
+		select {
+		case <-ctx.Done():
+			return nvdPage{}, ctx.Err()
+		case <-time.After(n.Delay):
+		}
+	}
+	n.requests++
+
+	q := url.Values{}
+	q.Set("virtualMatchString", "cpe:2.3:*:"+vendor)
+	q.Set("resultsPerPage", strconv.Itoa(nvdPageSize))
+	q.Set("startIndex", strconv.Itoa(start))
+	if !n.Since.IsZero() {
+		end := n.now
+		if end.IsZero() {
+			end = time.Now().UTC()
+		}
+		q.Set("lastModStartDate", n.Since.UTC().Format(nvdTime))
+		q.Set("lastModEndDate", end.Format(nvdTime))
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, n.URL+"?"+q.Encode(), nil)
+	if err != nil {
+		return nvdPage{}, fmt.Errorf("failed to query NVD for %s: %w", vendor, err)
+	}
+	if n.APIKey != "" {
+		req.Header.Set("apiKey", n.APIKey)
+	}
+	resp, err := n.Client.Do(req)
+	if err != nil {
+		return nvdPage{}, fmt.Errorf("failed to query NVD for %s: %w", vendor, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nvdPage{}, fmt.Errorf("failed to query NVD for %s: %s", vendor, resp.Status)
+	}
+	var page nvdPage
+	if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+		return nvdPage{}, fmt.Errorf("failed to parse NVD answer for %s: %w", vendor, err)
+	}
+	return page, nil
+}
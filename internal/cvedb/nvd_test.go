@@ -0,0 +1,508 @@
+package cvedb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestSync(t *testing.T) {
+	// Hikvision has a second page, Acme no CVEs
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("apiKey") != "secret" {
+			http.Error(w, "no key", http.StatusForbidden)
+			return
+		}
+		cve := func(id, published string) string {
+			return fmt.Sprintf(`{"cve": {"id": %q, "published": %q}}`, id, published)
+		}
+		// The NVD's own v3.1 score wins over the CNA's
+		scored := `{"cve": {"id": "CVE-2099-0001", "published": "2099-01-02T00:00:00.000",
+			"descriptions": [{"lang": "es", "value": "Inyección de comandos."}, {"lang": "en", "value": "A command injection in the\n web server. Attackers can run commands."}],
+			"metrics": {"cvssMetricV31": [
+			{"type": "Secondary", "cvssData": {"vectorString": "CVSS:3.1/AV:N/AC:H/PR:N/UI:N/S:U/C:L/I:N/A:N", "baseScore": 3.7, "baseSeverity": "LOW"}},
+			{"type": "Primary", "cvssData": {"vectorString": "CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H", "baseScore": 9.8, "baseSeverity": "CRITICAL"}}]},
+			"references": [{"url": "https://www.exploit-db.com/exploits/99999", "tags": ["Exploit"]}],
+			"configurations": [{"nodes": [
+				{"cpeMatch": [{"vulnerable": true, "criteria": "cpe:2.3:o:hikvision:ds-7608ni-k2_firmware:*:*:*:*:*:*:*:*", "versionEndExcluding": "4.62.210"},
+					{"vulnerable": true, "criteria": "cpe:2.3:o:hikvision:ds-7616ni-k2_firmware:*:*:*:*:*:*:*:*"}]},
+				{"cpeMatch": [{"vulnerable": false, "criteria": "cpe:2.3:h:hikvision:ds-7608ni-k2:-:*:*:*:*:*:*:*"}]}]}]}}`
+		switch r.URL.Query().Get("virtualMatchString") + "@" + r.URL.Query().Get("startIndex") {
+		case "cpe:2.3:*:hikvision@0":
+			fmt.Fprintf(w, `{"totalResults": 2001, "vulnerabilities": [%s, %s]}`,
+				cve("CVE-2017-7921", "2017-05-06T02:29:00.197"), scored)
+		case "cpe:2.3:*:hikvision@2000":
+			fmt.Fprintf(w, `{"totalResults": 2001, "vulnerabilities": [%s]}`, cve("CVE-2099-0002", "2099-03-04T00:00:00.000"))
+		default:
+			fmt.Fprint(w, `{"totalResults": 0, "vulnerabilities": []}`)
+		}
+	}))
+	defer srv.Close()
+
+	nvd := &NVD{Client: srv.Client(), URL: srv.URL, APIKey: "secret"}
+	f, err := nvd.Sync(context.Background(), map[string]string{"hikvision": "hikvision", "annke": "hikvision", "acme": "acme"})
+	if err != nil {
+		t.Fatalf("Sync() = %v", err)
+	}
+	if nvd.requests != 3 {
+		t.Errorf("Sync() made %d requests, expected 3 (brands sharing a vendor are fetched once)", nvd.requests)
+	}
+	expected := []Entry{
+		{ID: "CVE-2099-0002", Published: "2099-03-04"},
+		{ID: "CVE-2099-0001", Published: "2099-01-02", CVSS: 9.8, Vector: "CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H", Severity: "CRITICAL", Summary: "A command injection in the web server.",
+			Products: []string{"ds-7608ni-k2", "ds-7616ni-k2"}, Fixed: map[string]string{"ds-7608ni-k2": "4.62.210"}, Exploits: Exploits{ExploitDB: []string{"99999"}}},
+		{ID: "CVE-2017-7921", Published: "2017-05-06"},
+	}
+	if !reflect.DeepEqual(f.Brands["hikvision"], expected) || !reflect.DeepEqual(f.Brands["annke"], expected) || f.Brands["acme"] != nil {
+		t.Fatalf("Sync() = %+v, expected %+v for hikvision and annke", f.Brands, expected)
+	}
+
+	s := testStore(t)
+	if n, err := s.Replace(f); err != nil || n != 3 {
+		t.Fatalf("Replace() = %d, %v, expected 3 entries", n, err)
+	}
+	cves := ForBrand("hikvision")
+	if cves[0] != db["hikvision"][0] || cves[len(cves)-2] != "CVE-2099-0002" || slices.Index(cves, "CVE-2017-7921") != 1 {
+		t.Errorf("ForBrand() = %v, expected the built-in list followed by the new CVEs", cves)
+	}
+	if e, ok := Lookup("CVE-2099-0001"); !ok || e.CVSS != 9.8 || e.Severity != "CRITICAL" {
+		t.Errorf("Lookup() = %+v, %v, expected CRITICAL 9.8", e, ok)
+	}
+	if x := ExploitsFor("CVE-2099-0001"); !slices.Equal(x.ExploitDB, []string{"99999"}) {
+		t.Errorf("ExploitsFor() = %+v, expected the Exploit-DB entry of the feed", x)
+	}
+	if p := Products("CVE-2099-0001"); len(p) != 2 || Products("CVE-2099-0002") != nil {
+		t.Errorf("Products() = %v, expected the vulnerable firmware of the feed", p)
+	}
+	if f.Schema != FeedSchema {
+		t.Errorf("Sync() schema = %d, expected %d", f.Schema, FeedSchema)
+	}
+	if cves := ForBrand("acme"); cves != nil {
+		t.Errorf("ForBrand(acme) = %v, expected none", cves)
+	}
+
+	nvd.APIKey = ""
+	if _, err := nvd.Sync(context.Background(), map[string]string{"hikvision": "hikvision"}); err == nil {
+		t.Error("Sync() succeeded without the key the server wants")
+	}
+}
+
+func TestSyncSince(t *testing.T) {
+	var query url.Values
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		fmt.Fprint(w, `{"totalResults": 0, "vulnerabilities": []}`)
+	}))
+	defer srv.Close()
+
+	since := time.Date(2099, 1, 2, 3, 4, 5, 0, time.UTC)
+	nvd := &NVD{Client: srv.Client(), URL: srv.URL, Since: since}
+	f, err := nvd.Sync(context.Background(), map[string]string{"acme": "acme"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query.Get("lastModStartDate") != "2099-01-02T03:04:05.000+00:00" || query.Get("lastModEndDate") != f.Updated.Format(nvdTime) {
+		t.Errorf("Sync() asked for %v, expected the CVEs modified since the last update", query)
+	}
+}
+
+func TestSeverity(t *testing.T) {
+	tests := []struct {
+		score    float64
+		expected string
+	}{
+		{0, ""},
+		{0.1, "LOW"},
+		{3.9, "LOW"},
+		{4, "MEDIUM"},
+		{7, "HIGH"},
+		{8.9, "HIGH"},
+		{9, "CRITICAL"},
+		{10, "CRITICAL"},
+	}
+	for _, test := range tests {
+		if s := Severity(test.score); s != test.expected {
+			t.Errorf("Severity(%v) = %q, expected %q", test.score, s, test.expected)
+		}
+	}
+}
+
+func TestKEV(t *testing.T) {
+	if e, ok := KEV("CVE-2021-36260"); !ok || e.DateAdded != "2022-01-10" {
+		t.Fatalf("KEV(CVE-2021-36260) = %+v, %v, expected the built-in entry", e, ok)
+	}
+
+	catalog := `{"catalogVersion": "2099.01.01", "vulnerabilities": [{"cveID": "CVE-2099-0001", "vendorProject": "Acme", "dateAdded": "2099-01-01"}]}`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, catalog)
+	}))
+	defer srv.Close()
+	data, err := FetchKEV(context.Background(), srv.Client(), srv.URL)
+	if err != nil {
+		t.Fatalf("FetchKEV() = %v", err)
+	}
+	if n, err := testStore(t).PutKEV(data); err != nil || n != 1 {
+		t.Fatalf("PutKEV() = %d, %v", n, err)
+	}
+	if _, ok := KEV("CVE-2099-0001"); !ok {
+		t.Error("KEV() misses the loaded entry")
+	}
+	if _, ok := KEV("CVE-2021-33044"); !ok {
+		t.Error("KEV() lost the built-in entries")
+	}
+	if _, ok := KEV("CVE-2017-9999"); ok {
+		t.Error("KEV() knows a CVE outside the catalog")
+	}
+}
+
+func TestEPSS(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		var data []string
+		for _, id := range strings.Split(r.URL.Query().Get("cve"), ",") {
+			if id == "CVE-2021-36260" {
+				data = append(data, `{"cve": "CVE-2021-36260", "epss": "0.944430000", "percentile": "0.999", "date": "2099-01-01"}`)
+			}
+		}
+		fmt.Fprintf(w, `{"status": "OK", "data": [%s]}`, strings.Join(data, ","))
+	}))
+	defer srv.Close()
+
+	cves := []string{"CVE-2021-36260"}
+	for i := range 150 {
+		cves = append(cves, fmt.Sprintf("CVE-2099-%04d", i))
+	}
+	scores, err := FetchEPSS(context.Background(), srv.Client(), srv.URL, cves)
+	if err != nil || requests != 2 || len(scores) != 1 || scores["CVE-2021-36260"].Score != 0.94443 {
+		t.Fatalf("FetchEPSS() = %v, %v in %d requests, expected CVE-2021-36260 in 2", scores, err, requests)
+	}
+
+	if err := testStore(t).PutEPSS(scores); err != nil {
+		t.Fatalf("PutEPSS() = %v", err)
+	}
+	if e, ok := EPSSFor("CVE-2021-36260"); !ok || e.Percentile != 0.999 || e.Date != "2099-01-01" {
+		t.Errorf("EPSSFor() = %+v, %v", e, ok)
+	}
+	if !slices.Contains(IDs(), "CVE-2017-7921") {
+		t.Error("IDs() misses the built-in CVEs")
+	}
+}
+
+func TestExploitRefs(t *testing.T) {
+	x := exploitRefs([]string{
+		"https://www.exploit-db.com/exploits/50441",
+		"http://www.exploit-db.com/exploits/50441/",
+		"https://github.com/rapid7/metasploit-framework/blob/master/modules/exploits/linux/http/acme_rce.rb",
+		"https://www.rapid7.com/db/modules/auxiliary/scanner/http/acme_bypass/",
+		"https://www.rapid7.com/db/modules/exploit/linux/http/acme_rce",
+		"https://nvd.nist.gov/vuln/detail/CVE-2099-0001",
+	})
+	if !slices.Equal(x.ExploitDB, []string{"50441"}) || !slices.Equal(x.Metasploit, []string{"exploit/linux/http/acme_rce", "auxiliary/scanner/http/acme_bypass"}) {
+		t.Errorf("exploitRefs() = %+v", x)
+	}
+	if x := ExploitsFor("CVE-2021-36260"); len(x.Metasploit) == 0 {
+		t.Error("ExploitsFor() misses the built-in module")
+	}
+	if x := ExploitsFor("CVE-2099-9999"); !x.Empty() {
+		t.Errorf("ExploitsFor() = %+v for an unknown CVE", x)
+	}
+}
+
+func TestLoadLocal(t *testing.T) {
+	dir := t.TempDir()
+	csvPath := filepath.Join(dir, "advisories.csv")
+	jsonPath := filepath.Join(dir, "advisories.json")
+	os.WriteFile(csvPath, []byte("# Vendor advisories\ncve,brand,models,firmware_before,cvss,note\n"+
+		"HSRC-2099-01,Hikvision,DS-76;DS-77,4.62.210,8.8,\"NVR web UI, fixed in 4.62.210\"\n"+
+		"CVE-2099-1000,Dahua,,,,\n"), 0o600)
+	os.WriteFile(jsonPath, []byte(`{"entries": [{"cve": "cve-2099-2000", "brand": "Hikvision", "models": ["ds-2cd"]}]}`), 0o600)
+	t.Cleanup(func() { local = nil })
+	for _, path := range []string{csvPath, jsonPath} {
+		if err := LoadLocal(path); err != nil {
+			t.Fatalf("LoadLocal(%s) = %v", path, err)
+		}
+	}
+
+	tests := []struct {
+		brand, model, firmware string
+		expected               []string
+	}{
+		{"Hikvision", "DS-7608NI-K2", "V4.61.005 build 210621", []string{"HSRC-2099-01"}},
+		{"Hikvision", "DS-7608NI-K2", "V4.62.210", nil},                            // Fixed
+		{"Hikvision", "DS-2CD2042WD-I", "", []string{"CVE-2099-2000"}},             // Camera only
+		{"Hikvision", "", "", []string{"HSRC-2099-01", "CVE-2099-2000"}},           // Unknown model
+		{"hikvision", "HIKVISION DS-7716NI", "", []string{"HSRC-2099-01"}},         // Brand in front
+		{"Dahua", "IPC-HFW1230S", "2.800.0000000.16.R", []string{"CVE-2099-1000"}}, // Brand-wide
+		{"Axis", "P1448-LE", "", nil},
+	}
+	for _, test := range tests {
+		if cves := ForDevice(test.brand, test.model, test.firmware); !slices.Equal(cves, test.expected) {
+			t.Errorf("ForDevice(%q, %q, %q) = %v, expected %v", test.brand, test.model, test.firmware, cves, test.expected)
+		}
+	}
+	if e, ok := Lookup("HSRC-2099-01"); !ok || e.Severity != "HIGH" || LocalNote("HSRC-2099-01") != "NVR web UI, fixed in 4.62.210" {
+		t.Errorf("Lookup() = %+v, %v, note %q", e, ok, LocalNote("HSRC-2099-01"))
+	}
+
+	for _, bad := range []string{"brand,note\nHikvision,x\n", "cve,brand,cvss\nCVE-1,Acme,high\n", "cve,brand,firmware_before\nCVE-1,Acme,latest\n", "cve,brand\nCVE-1,\n"} {
+		os.WriteFile(csvPath, []byte(bad), 0o600)
+		if err := LoadLocal(csvPath); err == nil {
+			t.Errorf("LoadLocal(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestCPEProducts(t *testing.T) {
+	tests := []struct {
+		criteria []string
+		expected []string
+	}{
+		{[]string{"cpe:2.3:o:hikvision:ds-2cd2032-i_firmware:*:*:*:*:*:*:*:*", "cpe:2.3:h:hikvision:ds-2cd2032-i:-:*:*:*:*:*:*:*"}, []string{"ds-2cd2032-i"}},
+		{[]string{"cpe:2.3:o:hikvision:ds-2cd2032-i_firmware:*:*:*:*:*:*:*:*", "cpe:2.3:a:openssl:openssl:*:*:*:*:*:*:*:*"}, []string{"ds-2cd2032-i"}},
+		{[]string{"cpe:2.3:o:hikvision:ds-2cd2032-i_firmware:*:*:*:*:*:*:*:*", "cpe:2.3:o:hikvision:*:*:*:*:*:*:*:*:*"}, nil},
+		{nil, nil},
+	}
+	for _, tt := range tests {
+		if got := cpeProducts("hikvision", tt.criteria); !slices.Equal(got, tt.expected) {
+			t.Errorf("cpeProducts(%q) = %q, expected %q", tt.criteria, got, tt.expected)
+		}
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	long := strings.Repeat("word ", 50)
+	tests := []struct {
+		description, expected string
+	}{
+		{"Improper authentication. It may allow escalation.", "Improper authentication."},
+		{"A command injection\n\tin the web server", "A command injection in the web server"},
+		{long, strings.Repeat("word ", 39) + "word…"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := summarize(tt.description); got != tt.expected {
+			t.Errorf("summarize(%q) = %q, expected %q", tt.description, got, tt.expected)
+		}
+	}
+	if Summary("CVE-2021-36260") == "" || Summary("CVE-2099-9999") != "" {
+		t.Errorf("Summary() = %q, %q, expected the built-in summary only", Summary("CVE-2021-36260"), Summary("CVE-2099-9999"))
+	}
+}
+
+func TestFixedIn(t *testing.T) {
+	t.Cleanup(func() { local = nil })
+	f := Feed{Brands: map[string][]Entry{"hikvision": {{ID: "CVE-2099-0001", Fixed: map[string]string{"ds-76": "4.0", "ds-7608ni": "4.62.210"}}}}}
+	if _, err := testStore(t).Replace(f); err != nil {
+		t.Fatal(err)
+	}
+	local = []LocalEntry{{CVE: "HSRC-2099-01", Brand: "Hikvision", Models: []string{"ds-2cd"}, FirmwareBefore: "5.7.3"}}
+	tests := []struct {
+		id, model, expected string
+	}{
+		{"CVE-2099-0001", "DS-7608NI-K2", "4.62.210"},
+		{"CVE-2099-0001", "DS-7616NI-K2", "4.0"},
+		{"CVE-2099-0001", "DS-2CD2032-I", ""},
+		{"CVE-2099-0001", "", ""},
+		{"HSRC-2099-01", "DS-2CD2032-I", "5.7.3"},
+		{"HSRC-2099-01", "", "5.7.3"},
+		{"HSRC-2099-01", "DS-7608NI-K2", ""},
+	}
+	for _, tt := range tests {
+		if got := FixedIn(tt.id, "Hikvision", tt.model); got != tt.expected {
+			t.Errorf("FixedIn(%q, %q) = %q, expected %q", tt.id, tt.model, got, tt.expected)
+		}
+	}
+	if !FirmwareBefore("V5.4.0 build 160530", "5.4.5") || FirmwareBefore("V5.4.5", "5.4.5") || FirmwareBefore("", "5.4.5") {
+		t.Error("FirmwareBefore() misorders versions")
+	}
+}
+
+func TestBundle(t *testing.T) {
+	online, err := OpenStore(filepath.Join(t.TempDir(), "cves.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer online.Close()
+	if _, err := NewBundle(online); err == nil {
+		t.Error("NewBundle() succeeded without a feed")
+	}
+	updated := time.Date(2099, 1, 2, 3, 4, 5, 0, time.UTC)
+	f := Feed{Schema: FeedSchema, Updated: updated, Brands: map[string][]Entry{"acme": {{ID: "CVE-2099-0001"}}}}
+	if _, err := online.Replace(f); err != nil {
+		t.Fatal(err)
+	}
+	if err := online.PutEPSS(map[string]EPSS{"CVE-2099-0001": {Score: 0.5}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// No KEV catalog was fetched, so the bundle leaves it out
+	b, err := NewBundle(online)
+	if err != nil || len(b.KEV) != 0 || b.Version() != "2099-01-02" {
+		t.Fatalf("NewBundle() = %+v, %v", b, err)
+	}
+	path := filepath.Join(t.TempDir(), "cves-bundle.json")
+	if err := SaveBundle(path, b); err != nil {
+		t.Fatal(err)
+	}
+	if b, err = ReadBundle(path); err != nil {
+		t.Fatalf("ReadBundle() = %v", err)
+	}
+	offline := testStore(t)
+	if err := b.Install(offline); err != nil {
+		t.Fatalf("Install() = %v", err)
+	}
+	if kev, err := offline.KEVCatalog(); err != nil || kev != nil {
+		t.Errorf("KEVCatalog() = %s, %v after installing a bundle without one", kev, err)
+	}
+	if !Updated().Equal(updated) || !slices.Contains(ForBrand("acme"), "CVE-2099-0001") {
+		t.Errorf("Updated() = %v, ForBrand() = %v after the import", Updated(), ForBrand("acme"))
+	}
+	if e, ok := EPSSFor("CVE-2099-0001"); !ok || e.Score != 0.5 {
+		t.Errorf("EPSSFor() = %+v, %v after the import", e, ok)
+	}
+
+	b.Schema = FeedSchema + 1
+	if err := SaveBundle(path, b); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadBundle(path); err == nil {
+		t.Error("ReadBundle() accepted a bundle of a newer schema")
+	}
+}
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cves.db")
+	s, err := OpenStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	full := Feed{Updated: time.Date(2099, 1, 1, 0, 0, 0, 0, time.UTC), Brands: map[string][]Entry{"acme": {
+		{ID: "CVE-2099-0002", Published: "2099-02-01", CVSS: 5.3},
+		{ID: "CVE-2099-0001", Published: "2099-01-01"},
+	}}}
+	if _, err := s.Replace(full); err != nil {
+		t.Fatal(err)
+	}
+
+	// An incremental update adds new CVEs and changes modified ones only
+	modified := Feed{Updated: time.Date(2099, 3, 1, 0, 0, 0, 0, time.UTC), Brands: map[string][]Entry{"acme": {
+		{ID: "CVE-2099-0003", Published: "2099-03-01"},
+		{ID: "CVE-2099-0002", Published: "2099-02-01", CVSS: 9.8},
+		{ID: "CVE-2099-0001", Published: "2099-01-01"},
+	}}}
+	if n, err := s.Merge(modified); err != nil || n != 2 {
+		t.Fatalf("Merge() = %d, %v, expected 2 new or changed entries", n, err)
+	}
+	if ids := s.brandCVEs("acme"); !slices.Equal(ids, []string{"CVE-2099-0003", "CVE-2099-0002", "CVE-2099-0001"}) {
+		t.Errorf("brandCVEs() = %v, expected newest first", ids)
+	}
+	if e, ok := s.entry("CVE-2099-0002"); !ok || e.Severity != "CRITICAL" {
+		t.Errorf("entry() = %+v, %v, expected the changed score", e, ok)
+	}
+	if !s.Updated().Equal(modified.Updated) {
+		t.Errorf("Updated() = %v, expected %v", s.Updated(), modified.Updated)
+	}
+	s.Close()
+
+	// Scans read it alongside each other; a store of a newer schema is refused
+	r, err := OpenStoreReadOnly(path)
+	if err != nil {
+		t.Fatalf("OpenStoreReadOnly() = %v", err)
+	}
+	if len(r.ids()) != 3 {
+		t.Errorf("ids() = %v", r.ids())
+	}
+	r.Close()
+	db, err := bolt.Open(path, 0o644, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(metaBucket).Put([]byte("schema"), []byte("99"))
+	})
+	db.Close()
+	if _, err := OpenStore(path); err == nil || !strings.Contains(err.Error(), "schema") {
+		t.Errorf("OpenStore() = %v, expected a newer schema refused", err)
+	}
+	if _, err := OpenStoreReadOnly(path); err == nil {
+		t.Error("OpenStoreReadOnly() accepted a newer schema")
+	}
+}
+
+// testStore returns a new store the lookups of the package consult until the
+// test ends
+func testStore(t *testing.T) *Store {
+	t.Helper()
+	s, err := OpenStore(filepath.Join(t.TempDir(), "cves.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	Use(s)
+	t.Cleanup(func() { Use(nil); s.Close() })
+	return s
+}
+
+func TestVulners(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		var q map[string]string
+		json.NewDecoder(r.Body).Decode(&q)
+		if q["software"] != "cpe:/o:acme:cam-1_firmware:1.2" || q["apiKey"] != "key" {
+			fmt.Fprint(w, `{"result": "warning", "data": {"error": "Nothing found for Burpsuite search request"}}`)
+			return
+		}
+		fmt.Fprint(w, `{"result": "OK", "data": {"search": [
+			{"_source": {"id": "CVE-2099-0001", "title": "Acme CAM-1 auth bypass", "type": "cve", "cvelist": [], "cvss": {"score": 9.8}}},
+			{"_source": {"id": "ACME-SA-2099-01", "title": "Acme advisory", "type": "acme", "cvelist": ["CVE-2099-0002"]}}]}}`)
+	}))
+	defer srv.Close()
+	path := filepath.Join(t.TempDir(), "vulners.json")
+	v, err := OpenVulners("key", path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.Client, v.URL = srv.Client(), srv.URL
+
+	cpe := `cpe:2.3:o:acme:cam-1_firmware:1.2:*:*:*:*:*:*:*`
+	for range 2 {
+		advisories, err := v.Advisories(context.Background(), cpe)
+		if err != nil || len(advisories) != 2 || advisories[0].CVSS != 9.8 || !slices.Equal(advisories[1].CVEs, []string{"CVE-2099-0002"}) {
+			t.Fatalf("Advisories() = %+v, %v", advisories, err)
+		}
+	}
+	if requests != 1 {
+		t.Errorf("Advisories() asked %d times, expected the second answer from the cache", requests)
+	}
+	if advisories, err := v.Advisories(context.Background(), `cpe:2.3:o:acme:cam-2_firmware:1.0:*:*:*:*:*:*:*`); err != nil || len(advisories) != 0 {
+		t.Errorf("Advisories() = %+v, %v, expected nothing found to be no advisories", advisories, err)
+	}
+	if _, err := v.Advisories(context.Background(), `cpe:2.3:o:acme:cam-1_firmware:*:*:*:*:*:*:*:*`); err == nil {
+		t.Error("Advisories() asked about a CPE without a version")
+	}
+
+	// The cache outlives the run
+	if err := v.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if v, err = OpenVulners("key", path, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	v.Client, v.URL = srv.Client(), srv.URL
+	if advisories, err := v.Advisories(context.Background(), cpe); err != nil || len(advisories) != 2 || requests != 2 {
+		t.Errorf("Advisories() = %+v, %v after %d requests, expected the saved answer", advisories, err, requests)
+	}
+}
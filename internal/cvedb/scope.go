@@ -0,0 +1,70 @@
+package cvedb
+
+import (
+	"slices"
+	"strings"
+)
+
+// builtinFamilies are the device families, as fingerprint names the classes, of
+// built-in CVEs known to affect one kind of device only. Feed CVEs are scoped by
+// the products the NVD names instead.
+var builtinFamilies = map[string][]string{
+	"CVE-2017-7921":  {"camera"}, // ICSA-17-124-01: IP cameras
+	"CVE-2021-36260": {"camera"}, // HSRC-202109-01: IP cameras and PTZ
+}
+
+// Families returns the device families the built-in list knows the CVE id to
+// affect, or nil when it may affect any
+func Families(id string) []string {
+	return builtinFamilies[id]
+}
+
+// Products returns the products the store in use names the CVE id for, as in
+// CPE names with any _firmware suffix cut, e.g. ds-2cd2032-i; nil when it names
+// none or the vendor as a whole
+func Products(id string) []string {
+	e, _ := feedEntry(id)
+	return e.Products
+}
+
+// cpeProducts returns the vulnerable products of vendor in the CPE match
+// criteria of a CVE, or nil when one of them covers every product
+func cpeProducts(vendor string, criteria []string) []string {
+	var products []string
+	for _, c := range criteria {
+		// cpe:2.3:part:vendor:product:version:...
+		parts := strings.Split(c, ":")
+		if len(parts) < 5 || parts[3] != vendor {
+			continue
+		}
+		product := strings.TrimSuffix(strings.ReplaceAll(parts[4], `\`, ""), "_firmware")
+		if product == "*" || product == "-" || product == "" {
+			return nil
+		}
+		if !slices.Contains(products, product) {
+			products = append(products, product)
+		}
+	}
+	return products
+}
+
+// cpeFixed returns the first fixed version of each vulnerable product of vendor
+// the CPE matches give one for, or nil when none does
+func cpeFixed(vendor string, matches []cpeMatch) map[string]string {
+	var fixed map[string]string
+	for _, m := range matches {
+		parts := strings.Split(m.Criteria, ":")
+		if len(parts) < 5 || parts[3] != vendor || versionRe.FindString(m.VersionEndExcluding) == "" {
+			continue
+		}
+		product := strings.TrimSuffix(strings.ReplaceAll(parts[4], `\`, ""), "_firmware")
+		if product == "*" || product == "-" || product == "" {
+			continue
+		}
+		if fixed == nil {
+			fixed = make(map[string]string)
+		}
+		fixed[product] = m.VersionEndExcluding
+	}
+	return fixed
+}
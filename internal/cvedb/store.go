@@ -0,0 +1,389 @@
+package cvedb
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// StoreSchema is the version of the store layout this build reads and writes. It
+// goes up whenever a bucket or value changes meaning; an older store is emptied
+// when update-cves opens it, so the next update fetches everything anew.
+const StoreSchema = 1
+
+// Buckets of the store; values are JSON
+var (
+	metaBucket  = []byte("meta")   // schema, updated and source of the NVD data
+	cveBucket   = []byte("cves")   // Entry by CVE ID
+	brandBucket = []byte("brands") // CVE IDs of a brand in lowercase, newest first
+	kevBucket   = []byte("kev")    // KEVEntry by CVE ID
+	epssBucket  = []byte("epss")   // EPSS by CVE ID
+)
+
+// dataBuckets are the buckets emptied when the schema changes
+var dataBuckets = [][]byte{cveBucket, brandBucket, kevBucket, epssBucket}
+
+// Store is the CVE data update-cves keeps in a bbolt database: the NVD entries,
+// the KEV catalog and the EPSS scores, each looked up by CVE ID without loading
+// the rest. Updates merge into it entry by entry.
+type Store struct {
+	db *bolt.DB
+}
+
+// OpenStore opens the store at path for updating, creating it if missing
+func OpenStore(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0o644, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open CVE store %s: %w", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		meta, err := tx.CreateBucketIfNotExists(metaBucket)
+		if err != nil {
+			return err
+		}
+		schema := storeSchema(meta)
+		if schema > StoreSchema {
+			return fmt.Errorf("schema %d, this build reads up to %d: update cctvscan", schema, StoreSchema)
+		}
+		if schema < StoreSchema {
+			for _, name := range dataBuckets {
+				if err := tx.DeleteBucket(name); err != nil && !errors.Is(err, bolt.ErrBucketNotFound) {
+					return err
+				}
+			}
+			meta.Delete([]byte("updated"))
+			meta.Delete([]byte("source"))
+			if err := meta.Put([]byte("schema"), []byte(strconv.Itoa(StoreSchema))); err != nil {
+				return err
+			}
+		}
+		for _, name := range dataBuckets {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("CVE store %s: %w", path, err)
+	}
+	return &Store{db: db}, nil
+}
+
+// OpenStoreReadOnly opens the store at path for lookups; scans share it with
+// each other but not with a running update-cves
+func OpenStoreReadOnly(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0o644, &bolt.Options{Timeout: time.Second, ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open CVE store %s: %w", path, err)
+	}
+	err = db.View(func(tx *bolt.Tx) error {
+		meta := tx.Bucket(metaBucket)
+		if meta == nil {
+			return errors.New("not a CVE store")
+		}
+		if schema := storeSchema(meta); schema != StoreSchema {
+			return fmt.Errorf("schema %d, this build reads %d", schema, StoreSchema)
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("CVE store %s: %w", path, err)
+	}
+	return &Store{db: db}, nil
+}
+
+// storeSchema returns the schema a store was written with, 0 for a new one
+func storeSchema(meta *bolt.Bucket) int {
+	schema, _ := strconv.Atoi(string(meta.Get([]byte("schema"))))
+	return schema
+}
+
+// Close releases the store file
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Updated returns when the NVD data of the store was fetched, or the zero time
+// when it has none
+func (s *Store) Updated() time.Time {
+	var updated time.Time
+	s.db.View(func(tx *bolt.Tx) error {
+		updated, _ = time.Parse(time.RFC3339, string(tx.Bucket(metaBucket).Get([]byte("updated"))))
+		return nil
+	})
+	return updated
+}
+
+// Merge adds the entries of f, such as the CVEs the NVD modified since the last
+// update, to those stored, and returns how many were new or changed
+func (s *Store) Merge(f Feed) (int, error) {
+	return s.putFeed(f, false)
+}
+
+// Replace stores f in place of the NVD data stored, and returns how many entries
+// it holds
+func (s *Store) Replace(f Feed) (int, error) {
+	return s.putFeed(f, true)
+}
+
+func (s *Store) putFeed(f Feed, replace bool) (int, error) {
+	changed := 0
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		if replace {
+			for _, name := range [][]byte{cveBucket, brandBucket} {
+				if err := tx.DeleteBucket(name); err != nil {
+					return err
+				}
+				if _, err := tx.CreateBucket(name); err != nil {
+					return err
+				}
+			}
+		}
+		cves, brands := tx.Bucket(cveBucket), tx.Bucket(brandBucket)
+		for brand, entries := range f.Brands {
+			var ids []string
+			if v := brands.Get([]byte(brand)); v != nil {
+				if err := json.Unmarshal(v, &ids); err != nil {
+					return fmt.Errorf("brand %s: %w", brand, err)
+				}
+			}
+			for _, e := range entries {
+				if e.Severity == "" {
+					e.Severity = Severity(e.CVSS)
+				}
+				data, err := json.Marshal(e)
+				if err != nil {
+					return err
+				}
+				if old := cves.Get([]byte(e.ID)); string(old) != string(data) {
+					if err := cves.Put([]byte(e.ID), data); err != nil {
+						return err
+					}
+					changed++
+				}
+				if !slices.Contains(ids, e.ID) {
+					ids = append(ids, e.ID)
+				}
+			}
+			sortNewestFirst(cves, ids)
+			if err := putJSON(brands, brand, ids); err != nil {
+				return err
+			}
+		}
+		meta := tx.Bucket(metaBucket)
+		if err := meta.Put([]byte("updated"), []byte(f.Updated.UTC().Format(time.RFC3339))); err != nil {
+			return err
+		}
+		return meta.Put([]byte("source"), []byte(f.Source))
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to store CVE feed: %w", err)
+	}
+	return changed, nil
+}
+
+// sortNewestFirst orders the CVE ids by the publication date of their entries
+func sortNewestFirst(cves *bolt.Bucket, ids []string) {
+	published := make(map[string]string, len(ids))
+	for _, id := range ids {
+		var e Entry
+		if json.Unmarshal(cves.Get([]byte(id)), &e) == nil {
+			published[id] = e.Published
+		}
+	}
+	slices.SortFunc(ids, func(a, b string) int {
+		return cmp.Or(cmp.Compare(published[b], published[a]), cmp.Compare(b, a))
+	})
+}
+
+// PutKEV adds the entries of a KEV feed FetchKEV returned and returns how many
+// it holds
+func (s *Store) PutKEV(data []byte) (int, error) {
+	catalog, err := parseKEV(data)
+	if err != nil {
+		return 0, err
+	}
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(kevBucket)
+		for id, e := range catalog {
+			if err := putJSON(b, id, e); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to store KEV catalog: %w", err)
+	}
+	return len(catalog), nil
+}
+
+// PutEPSS stores scores FetchEPSS returned, replacing those of the same CVEs
+func (s *Store) PutEPSS(scores map[string]EPSS) error {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(epssBucket)
+		for id, e := range scores {
+			if err := putJSON(b, id, e); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to store EPSS scores: %w", err)
+	}
+	return nil
+}
+
+// Feed returns the NVD data of the store as a feed, for an offline bundle
+func (s *Store) Feed() (Feed, error) {
+	f := Feed{Schema: FeedSchema, Updated: s.Updated(), Brands: make(map[string][]Entry)}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		f.Source = string(tx.Bucket(metaBucket).Get([]byte("source")))
+		cves := tx.Bucket(cveBucket)
+		return tx.Bucket(brandBucket).ForEach(func(k, v []byte) error {
+			var ids []string
+			if err := json.Unmarshal(v, &ids); err != nil {
+				return fmt.Errorf("brand %s: %w", k, err)
+			}
+			for _, id := range ids {
+				var e Entry
+				if err := json.Unmarshal(cves.Get([]byte(id)), &e); err != nil {
+					return fmt.Errorf("%s: %w", id, err)
+				}
+				f.Brands[string(k)] = append(f.Brands[string(k)], e)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return Feed{}, fmt.Errorf("failed to read CVE store: %w", err)
+	}
+	return f, nil
+}
+
+// KEVCatalog returns the KEV entries of the store as a KEV feed, or nil when it
+// has none
+func (s *Store) KEVCatalog() ([]byte, error) {
+	var c kevCatalog
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(kevBucket).ForEach(func(k, v []byte) error {
+			var e KEVEntry
+			if err := json.Unmarshal(v, &e); err != nil {
+				return fmt.Errorf("%s: %w", k, err)
+			}
+			c.Vulnerabilities = append(c.Vulnerabilities, e)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read KEV catalog: %w", err)
+	}
+	if len(c.Vulnerabilities) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(c)
+}
+
+// EPSS returns the scores of the store, or nil when it has none
+func (s *Store) EPSS() (map[string]EPSS, error) {
+	var scores map[string]EPSS
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(epssBucket).ForEach(func(k, v []byte) error {
+			var e EPSS
+			if err := json.Unmarshal(v, &e); err != nil {
+				return fmt.Errorf("%s: %w", k, err)
+			}
+			if scores == nil {
+				scores = make(map[string]EPSS)
+			}
+			scores[string(k)] = e
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read EPSS scores: %w", err)
+	}
+	return scores, nil
+}
+
+// entry returns the NVD entry of the CVE id
+func (s *Store) entry(id string) (Entry, bool) {
+	return getJSON[Entry](s, cveBucket, id)
+}
+
+// brandCVEs returns the CVE IDs of brand, newest first
+func (s *Store) brandCVEs(brand string) []string {
+	ids, _ := getJSON[[]string](s, brandBucket, brand)
+	return ids
+}
+
+// ids returns the ID of every NVD entry
+func (s *Store) ids() []string {
+	var ids []string
+	s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(cveBucket).ForEach(func(k, _ []byte) error {
+			ids = append(ids, string(k))
+			return nil
+		})
+	})
+	return ids
+}
+
+// getJSON decodes the value of key in bucket; false when it is missing or
+// doesn't decode
+func getJSON[T any](s *Store, bucket []byte, key string) (T, bool) {
+	var v T
+	found := false
+	s.db.View(func(tx *bolt.Tx) error {
+		if data := tx.Bucket(bucket).Get([]byte(key)); data != nil {
+			found = json.Unmarshal(data, &v) == nil
+		}
+		return nil
+	})
+	return v, found
+}
+
+// putJSON stores v as the value of key in b
+func putJSON(b *bolt.Bucket, key string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(key), data)
+}
+
+// store is the CVE store lookups consult, nil when only the built-in list is in
+// use
+var store *Store
+
+// Use makes the lookups of the package consult s; nil drops the store
+func Use(s *Store) {
+	feedMu.Lock()
+	store = s
+	feedMu.Unlock()
+}
+
+// currentStore returns the store set with Use
+func currentStore() *Store {
+	feedMu.RLock()
+	defer feedMu.RUnlock()
+	return store
+}
+
+// feedEntry returns the NVD entry of the CVE id in the store in use
+func feedEntry(id string) (Entry, bool) {
+	if s := currentStore(); s != nil {
+		return s.entry(id)
+	}
+	return Entry{}, false
+}
@@ -0,0 +1,43 @@
+package cvedb
+
+import "strings"
+
+// maxSummary is the length summaries are cut to, at a word
+const maxSummary = 200
+
+// builtinSummaries are the NVD descriptions of well-known built-in CVEs, cut to
+// their first sentence, for hosts scanned without update-cves
+var builtinSummaries = map[string]string{
+	"CVE-2017-7921":  "Improper authentication in Hikvision IP cameras lets a remote attacker escalate privileges and access sensitive information.",
+	"CVE-2021-36260": "A command injection vulnerability in the web server of some Hikvision products.",
+	"CVE-2021-33044": "Identity authentication bypass in some Dahua products during the login process.",
+	"CVE-2021-33045": "Identity authentication bypass in some Dahua products during the login process.",
+	"CVE-2022-30563": "A login through ONVIF to some Dahua products can be replayed by a man in the middle who sniffed it.",
+	"CVE-2018-10660": "A shell command injection vulnerability in Axis network cameras.",
+}
+
+// Summary returns a one-line description of the CVE id: the first sentence of
+// its NVD description in the loaded feed, or else of the built-in list
+func Summary(id string) string {
+	if e, ok := Lookup(id); ok && e.Summary != "" {
+		return e.Summary
+	}
+	return builtinSummaries[id]
+}
+
+// summarize cuts an NVD description to its first sentence on one line, and that
+// to maxSummary characters
+func summarize(description string) string {
+	s := strings.Join(strings.Fields(description), " ")
+	if i := strings.Index(s, ". "); i >= 0 {
+		s = s[:i+1]
+	}
+	if len(s) <= maxSummary {
+		return s
+	}
+	s = s[:maxSummary]
+	if i := strings.LastIndexByte(s, ' '); i > 0 {
+		s = s[:i]
+	}
+	return strings.TrimRight(s, ",;:") + "…"
+}
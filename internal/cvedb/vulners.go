@@ -0,0 +1,192 @@
+package cvedb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultVulnersURL is the software audit endpoint of the Vulners API
+const DefaultVulnersURL = "https://vulners.com/api/v3/burp/software/"
+
+// DefaultVulnersTTL is how long the advisories of a CPE are reused before
+// Vulners is asked again
+const DefaultVulnersTTL = 7 * 24 * time.Hour
+
+// Advisory is a bulletin Vulners lists for a product version: a CVE, or a
+// vendor or exploit bulletin naming the CVEs it covers
+type Advisory struct {
+	ID    string   `json:"id"`
+	Title string   `json:"title,omitempty"`
+	Type  string   `json:"type,omitempty"` // Vulners collection, e.g. cve or hikvision
+	CVSS  float64  `json:"cvss,omitempty"`
+	CVEs  []string `json:"cves,omitempty"`
+}
+
+// Vulners asks the Vulners API for the advisories of device CPEs, keeping the
+// answers in a JSON file between runs
+type Vulners struct {
+	Client *http.Client
+	URL    string // DefaultVulnersURL, or a proxy
+	APIKey string
+
+	path    string
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[string]vulnersEntry
+	dirty   bool
+}
+
+type vulnersEntry struct {
+	Fetched    time.Time  `json:"fetched"`
+	Advisories []Advisory `json:"advisories"`
+}
+
+// OpenVulners returns a client with the cache at path, dropping answers older
+// than ttl. A missing file is an empty cache, and "" keeps none.
+func OpenVulners(apiKey, path string, ttl time.Duration) (*Vulners, error) {
+	v := &Vulners{Client: http.DefaultClient, URL: DefaultVulnersURL, APIKey: apiKey, path: path, ttl: ttl, entries: make(map[string]vulnersEntry)}
+	if path == "" {
+		return v, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return v, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Vulners cache: %w", err)
+	}
+	if err := json.Unmarshal(data, &v.entries); err != nil {
+		return nil, fmt.Errorf("failed to parse Vulners cache %s: %w", path, err)
+	}
+	for cpe, e := range v.entries {
+		if v.expired(e) {
+			delete(v.entries, cpe)
+			v.dirty = true
+		}
+	}
+	return v, nil
+}
+
+// Advisories returns what Vulners lists for cpe, a cpe:2.3 name with a version,
+// from the cache while it is fresh
+func (v *Vulners) Advisories(ctx context.Context, cpe string) ([]Advisory, error) {
+	v.mu.Lock()
+	e, ok := v.entries[cpe]
+	v.mu.Unlock()
+	if ok && !v.expired(e) {
+		return e.Advisories, nil
+	}
+	advisories, err := v.query(ctx, cpe)
+	if err != nil {
+		return nil, err
+	}
+	v.mu.Lock()
+	v.entries[cpe] = vulnersEntry{Fetched: time.Now(), Advisories: advisories}
+	v.dirty = true
+	v.mu.Unlock()
+	return advisories, nil
+}
+
+// Save writes the cache back if it changed
+func (v *Vulners) Save() error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if !v.dirty || v.path == "" {
+		return nil
+	}
+	data, err := json.Marshal(v.entries)
+	if err != nil {
+		return fmt.Errorf("failed to encode Vulners cache: %w", err)
+	}
+	if err := writeFile(v.path, data); err != nil {
+		return err
+	}
+	v.dirty = false
+	return nil
+}
+
+func (v *Vulners) expired(e vulnersEntry) bool {
+	return v.ttl > 0 && time.Since(e.Fetched) > v.ttl
+}
+
+// vulnersAnswer is the part of a software audit answer kept
+type vulnersAnswer struct {
+	Result string `json:"result"`
+	Data   struct {
+		Error  string `json:"error"`
+		Search []struct {
+			Source struct {
+				ID      string   `json:"id"`
+				Title   string   `json:"title"`
+				Type    string   `json:"type"`
+				CVEList []string `json:"cvelist"`
+				CVSS    struct {
+					Score float64 `json:"score"`
+				} `json:"cvss"`
+			} `json:"_source"`
+		} `json:"search"`
+	} `json:"data"`
+}
+
+// query asks the API about cpe, which it wants as a CPE 2.2 URI with the
+// version beside it
+func (v *Vulners) query(ctx context.Context, cpe string) ([]Advisory, error) {
+	uri, version, ok := cpeURI(cpe)
+	if !ok {
+		return nil, fmt.Errorf("no version in %s", cpe)
+	}
+	body, _ := json.Marshal(map[string]string{"software": uri, "version": version, "type": "cpe", "apiKey": v.APIKey})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query Vulners: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := v.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query Vulners: %w", err)
+	}
+	defer resp.Body.Close()
+	var answer vulnersAnswer
+	if err := json.NewDecoder(resp.Body).Decode(&answer); err != nil {
+		return nil, fmt.Errorf("failed to parse Vulners answer for %s: %w (%s)", uri, err, resp.Status)
+	}
+	if answer.Result != "OK" {
+		// No match is an error to the API, but an answer to us
+		if strings.Contains(strings.ToLower(answer.Data.Error), "nothing found") {
+			return []Advisory{}, nil
+		}
+		return nil, fmt.Errorf("failed to query Vulners for %s: %s", uri, answer.Data.Error)
+	}
+	advisories := []Advisory{}
+	for _, s := range answer.Data.Search {
+		a := Advisory{ID: s.Source.ID, Title: s.Source.Title, Type: s.Source.Type, CVSS: s.Source.CVSS.Score, CVEs: s.Source.CVEList}
+		if a.ID != "" {
+			advisories = append(advisories, a)
+		}
+	}
+	return advisories, nil
+}
+
+// cpeURI converts a formatted cpe:2.3 name to the CPE 2.2 URI of its part,
+// vendor, product and version, e.g. cpe:/o:hikvision:ds-2cd2042wd-i_firmware:5.4.5
+func cpeURI(cpe string) (uri, version string, ok bool) {
+	parts := strings.Split(cpe, ":")
+	if len(parts) < 6 || parts[0] != "cpe" || parts[1] != "2.3" {
+		return "", "", false
+	}
+	version = strings.ReplaceAll(parts[5], `\`, "")
+	if version == "*" || version == "-" || version == "" {
+		return "", "", false
+	}
+	product := strings.ReplaceAll(parts[4], `\`, "")
+	return "cpe:/" + parts[2] + ":" + parts[3] + ":" + product + ":" + version, version, true
+}
@@ -0,0 +1,191 @@
+// Package eol tells whether a camera's model or firmware line is past its
+// vendor's end of life or end of support. Such a device gets no more security
+// fixes whatever CVEs are known for it today, so it is reported on its own.
+package eol
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/postfix/cctvscan/internal/util"
+)
+
+// defaultData is the built-in dataset, loaded before any file
+//
+//go:embed eol.json
+var defaultData []byte
+
+// Status values of an entry
+const (
+	EndOfLife    = "end-of-life"    // The model is discontinued
+	EndOfSupport = "end-of-support" // The vendor no longer ships firmware for it
+)
+
+// Entry marks a model series or firmware line of a brand as unsupported. An
+// entry with models matches devices whose model starts with one of them; one
+// with firmware_before matches firmware older than that version; one with both
+// needs both, and one with neither covers every device of the brand.
+type Entry struct {
+	Brand          string   `json:"brand"`                     // Brand as named by the signatures, e.g. Hikvision
+	Models         []string `json:"models,omitempty"`          // Model prefixes, e.g. ds-2cd2032
+	FirmwareBefore string   `json:"firmware_before,omitempty"` // First supported firmware version, e.g. 5.3.0
+	Status         string   `json:"status"`                    // EndOfLife or EndOfSupport
+	Since          string   `json:"since,omitempty"`           // Year or date the status took effect
+	Note           string   `json:"note,omitempty"`            // What is affected and why
+}
+
+func (e Entry) String() string {
+	s := e.Status
+	if e.Since != "" {
+		s += " since " + e.Since
+	}
+	if e.Note != "" {
+		s += ": " + e.Note
+	}
+	return s
+}
+
+// Dataset is the format of EoL files
+type Dataset struct {
+	Entries []Entry `json:"entries"`
+}
+
+var (
+	dataMu sync.RWMutex
+	data   Dataset
+)
+
+func init() {
+	set, err := parse(defaultData)
+	if err != nil {
+		panic("eol: built-in dataset: " + err.Error())
+	}
+	data = set
+}
+
+// Load adds the entries of the EoL file at path; they are tried before the
+// entries already loaded
+func Load(path string) error {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read EoL data: %w", err)
+	}
+	set, err := parse(raw)
+	if err != nil {
+		return fmt.Errorf("EoL data %s: %w", path, err)
+	}
+	dataMu.Lock()
+	data = Dataset{Entries: append(set.Entries, data.Entries...)}
+	dataMu.Unlock()
+	return nil
+}
+
+// parse decodes an EoL file, lowercasing model prefixes
+func parse(raw []byte) (Dataset, error) {
+	var set Dataset
+	if err := json.Unmarshal(raw, &set); err != nil {
+		return Dataset{}, fmt.Errorf("failed to parse EoL data: %w", err)
+	}
+	for i := range set.Entries {
+		e := &set.Entries[i]
+		if e.Brand = strings.TrimSpace(e.Brand); e.Brand == "" {
+			return Dataset{}, fmt.Errorf("entry %d has no brand", i)
+		}
+		if e.Status != EndOfLife && e.Status != EndOfSupport {
+			return Dataset{}, fmt.Errorf("entry %d (%s): status %q is neither %s nor %s", i, e.Brand, e.Status, EndOfLife, EndOfSupport)
+		}
+		if e.FirmwareBefore != "" && versionRe.FindString(e.FirmwareBefore) == "" {
+			return Dataset{}, fmt.Errorf("entry %d (%s): firmware_before %q is not a version", i, e.Brand, e.FirmwareBefore)
+		}
+		models := e.Models[:0]
+		for _, m := range e.Models {
+			if m = strings.ToLower(strings.TrimSpace(m)); m != "" {
+				models = append(models, m)
+			}
+		}
+		e.Models = models
+	}
+	return set, nil
+}
+
+// versionRe pulls the dotted version out of firmware strings such as
+// "V5.4.5 build 170124"
+var versionRe = regexp.MustCompile(`\d+(?:\.\d+)+`)
+
+// Lookup returns the first entry covering a device of brand with the given model
+// and firmware. Entries with model prefixes need a model and entries with a
+// firmware bound need a readable firmware version, so a device known only by its
+// brand matches nothing but brand-wide entries.
+func Lookup(brand, model, firmware string) (Entry, bool) {
+	if brand == "" {
+		return Entry{}, false
+	}
+	model = normalizeModel(brand, model)
+	version := versionRe.FindString(firmware)
+
+	dataMu.RLock()
+	entries := data.Entries
+	dataMu.RUnlock()
+	for _, e := range entries {
+		if !strings.EqualFold(e.Brand, brand) {
+			continue
+		}
+		if len(e.Models) > 0 && !hasAnyPrefix(model, e.Models) {
+			continue
+		}
+		if e.FirmwareBefore != "" && (version == "" || compareVersions(version, versionRe.FindString(e.FirmwareBefore)) >= 0) {
+			continue
+		}
+		return e, true
+	}
+	return Entry{}, false
+}
+
+// normalizeModel lowercases model and drops the brand some devices put in front,
+// e.g. "AXIS 211" becomes "211"
+func normalizeModel(brand, model string) string {
+	model = strings.ToLower(strings.TrimSpace(model))
+	if rest, ok := strings.CutPrefix(model, strings.ToLower(brand)); ok {
+		model = strings.TrimLeft(rest, " -_")
+	}
+	return model
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	if s == "" {
+		return false
+	}
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// compareVersions compares dotted numeric versions, e.g. 5.2.9 < 5.3.0; missing
+// components count as 0
+func compareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < max(len(as), len(bs)); i++ {
+		var x, y int
+		if i < len(as) {
+			x = util.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y = util.Atoi(bs[i])
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
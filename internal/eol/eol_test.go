@@ -0,0 +1,55 @@
+package eol
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLookup(t *testing.T) {
+	tests := []struct {
+		brand, model, firmware string
+		expected               string // Status, "" for no entry
+	}{
+		{"Hikvision", "DS-2CD2032-I", "V5.3.0 build 150513", EndOfLife},
+		{"Hikvision", "DS-2CD2042WD-I", "V5.4.5 build 170124", ""},
+		{"Axis", "AXIS 211", "4.47", EndOfLife},
+		{"Axis", "M3045-V", "6.15.7", EndOfSupport},
+		{"Axis", "M3045-V", "9.80.3", ""},
+		{"Axis", "M3045-V", "", ""},
+		{"Dahua", "IPC-HFW1320S", "2.420.0000.0.R, build: 2016-03-07", EndOfSupport},
+		{"Dahua", "IPC-HFW2431S", "2.800.0000000.16.R", ""},
+		{"Sony", "", "", EndOfSupport},
+		{"Foscam", "FI8918W", "", EndOfLife},
+		{"Unknown", "FI8918W", "", ""},
+	}
+	for _, tt := range tests {
+		e, ok := Lookup(tt.brand, tt.model, tt.firmware)
+		if ok != (tt.expected != "") || e.Status != tt.expected {
+			t.Errorf("Lookup(%q, %q, %q) = %q, expected %q", tt.brand, tt.model, tt.firmware, e.Status, tt.expected)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "eol.json")
+	if err := os.WriteFile(path, []byte(`{"entries":[{"brand":"Dahua","models":["IPC-HFW2431"],"status":"end-of-life","since":"2024"}]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	saved := data
+	t.Cleanup(func() { data = saved })
+
+	if err := Load(path); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if e, ok := Lookup("Dahua", "IPC-HFW2431S", "2.800.0000000.16.R"); !ok || e.Since != "2024" {
+		t.Errorf("Lookup after Load = %+v, %v, expected the loaded entry", e, ok)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"entries":[{"brand":"Dahua","status":"retired"}]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Load(path); err == nil {
+		t.Error("Load accepted an unknown status")
+	}
+}
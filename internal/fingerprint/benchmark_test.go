@@ -0,0 +1,50 @@
+package fingerprint
+
+import (
+	"strings"
+	"testing"
+)
+
+// benchmarkPage is a 32 KB login page, the default -body-size, of a camera no
+// signature knows, so every keyword is looked for in all of it
+var benchmarkPage = strings.Repeat(`<div class="login-box"><input type="text" id="username" placeholder="User Name">`+
+	`<input type="password" id="password"><script src="js/jquery-1.12.4.min.js"></script>`+
+	`<span class="tip">Please use a browser with plugin support for live view.</span></div>`+"\n", 160)[:32*1024]
+
+// BenchmarkKeywordScan compares looking for every keyword of the built-in set with
+// strings.Contains, as detection did before, with one pass of the keyword index
+func BenchmarkKeywordScan(b *testing.B) {
+	sigs := currentSignatures()
+	body := strings.ToLower(benchmarkPage)
+	b.Run("contains", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, sig := range sigs.Brands {
+				containsAny(body, sig.Keywords)
+				containsAny(body, sig.RTSP)
+			}
+			containsAny(body, sigs.Generic)
+		}
+	})
+	b.Run("index", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			hits := sigs.scan(body)
+			for _, sig := range sigs.Brands {
+				hits.any(sig.Keywords)
+				hits.any(sig.RTSP)
+			}
+			hits.any(sigs.Generic)
+		}
+	})
+}
+
+func BenchmarkDetectCandidates(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		DetectCandidates("webserver", benchmarkPage, "")
+	}
+}
+
+func BenchmarkDetectBrand(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		detectBrand("webserver", benchmarkPage, "")
+	}
+}
@@ -3,63 +3,24 @@ package fingerprint
 import (
 	"regexp"
 	"strings"
-
-	"github.com/postfix/cctvscan/internal/cvedb"
 )
 
-// Brand keyword lists
-var brandKeysHikvision = []string{"hikvision", "dvr", "nvr", "hik-connect", "ivms", "web service"}
-var brandKeysDahua = []string{"dahua", "dvr", "nvr", "dss", "smartpss", "dmss"}
-var brandKeysAxis = []string{"axis", "axis communications", "axis camera", "axis mjpg"}
-var brandKeysSony = []string{"sony", "ipela", "snc", "sony network camera"}
-var brandKeysBosch = []string{"bosch", "security systems", "flexidome", "dinion", "autodome"}
-var brandKeysSamsung = []string{"samsung", "samsung techwin", "samsung sds", "hanwha", "wisenet"}
-var brandKeysPanasonic = []string{"panasonic", "network camera", "wv", "bb", "blc"}
-var brandKeysVivotek = []string{"vivotek", "network camera", "ip camera", "fd", "sd"}
-var brandKeysGeneric = []string{"camera", "webcam", "surveillance", "ip camera", "network camera", "dvr", "nvr", "recorder"}
-
-// Version detection patterns for different brands
-var versionPatterns = map[string]*regexp.Regexp{
-	"Hikvision": regexp.MustCompile(`(?i)(?:hikvision|hik-connect|ivms).*?v?(\d+\.\d+\.\d+(?:\.\d+)?)`),
-	"Dahua":     regexp.MustCompile(`(?i)(?:dahua|dss|smartpss).*?v?(\d+\.\d+\.\d+(?:\.\d+)?)`),
-	"Axis":      regexp.MustCompile(`(?i)(?:axis|axis communications).*?v?(\d+\.\d+\.\d+(?:\.\d+)?)`),
-	"Sony":      regexp.MustCompile(`(?i)(?:sony|ipela).*?v?(\d+\.\d+\.\d+(?:\.\d+)?)`),
-	"Bosch":     regexp.MustCompile(`(?i)(?:bosch|flexidome|dinion).*?v?(\d+\.\d+\.\d+(?:\.\d+)?)`),
-	"Samsung":   regexp.MustCompile(`(?i)(?:samsung|hanwha|wisenet).*?v?(\d+\.\d+\.\d+(?:\.\d+)?)`),
-	"Panasonic": regexp.MustCompile(`(?i)(?:panasonic|wv|bb|blc).*?v?(\d+\.\d+\.\d+(?:\.\d+)?)`),
-	"Vivotek":   regexp.MustCompile(`(?i)(?:vivotek|fd|sd).*?v?(\d+\.\d+\.\d+(?:\.\d+)?)`),
-}
-
-// Web page content patterns for brand detection
-var webContentPatterns = map[string]*regexp.Regexp{
-	"Hikvision": regexp.MustCompile(`(?i)(?:hikvision|hik-connect|ivms|web service|login\.jsp|main\.jsp)`),
-	"Dahua":     regexp.MustCompile(`(?i)(?:dahua|dss|smartpss|dmss|login\.html|main\.html)`),
-	"Axis":      regexp.MustCompile(`(?i)(?:axis|axis communications|axis camera|axis mjpg|axis-cgi)`),
-	"Sony":      regexp.MustCompile(`(?i)(?:sony|ipela|snc|sony network camera)`),
-	"Bosch":     regexp.MustCompile(`(?i)(?:bosch|flexidome|dinion|autodome|security systems)`),
-	"Samsung":   regexp.MustCompile(`(?i)(?:samsung|hanwha|wisenet|samsung techwin)`),
-	"Panasonic": regexp.MustCompile(`(?i)(?:panasonic|wv|bb|blc|network camera)`),
-	"Vivotek":   regexp.MustCompile(`(?i)(?:vivotek|fd|sd|ip camera|network camera)`),
-	"CP Plus":   regexp.MustCompile(`(?i)(?:cp plus|cpplus|cp-plus|cp_plus)`),
-}
-
-// Title patterns for brand detection
-var titlePatterns = map[string]*regexp.Regexp{
-	"Hikvision": regexp.MustCompile(`(?i)<title>.*?(?:hikvision|hik-connect|ivms).*?</title>`),
-	"Dahua":     regexp.MustCompile(`(?i)<title>.*?(?:dahua|dss|smartpss).*?</title>`),
-	"Axis":      regexp.MustCompile(`(?i)<title>.*?(?:axis|axis communications).*?</title>`),
-	"Sony":      regexp.MustCompile(`(?i)<title>.*?(?:sony|ipela).*?</title>`),
-	"Bosch":     regexp.MustCompile(`(?i)<title>.*?(?:bosch|flexidome).*?</title>`),
-	"Samsung":   regexp.MustCompile(`(?i)<title>.*?(?:samsung|hanwha|wisenet).*?</title>`),
-	"Panasonic": regexp.MustCompile(`(?i)<title>.*?(?:panasonic|wv|bb).*?</title>`),
-	"Vivotek":   regexp.MustCompile(`(?i)<title>.*?(?:vivotek|fd|sd).*?</title>`),
-}
-
 // DetectResult contains brand detection results with version information
 type DetectResult struct {
 	Brand   string
 	Note    string
 	Version string
+	Model   string  // Model number named by the page or RTSP server, e.g. DS-2CD2042WD-I
+	Why     []Match // What named the brand, to audit a signature that misfires
+}
+
+// Match is one pattern that named a brand: a keyword or regexp of its signature,
+// or for protocols that name the vendor the source alone, with the text it matched
+type Match struct {
+	Method  string `json:"method"`            // Where it matched, e.g. header, title, body, rtsp
+	Pattern string `json:"pattern,omitempty"` // Keyword or regexp of the signature
+	Text    string `json:"text"`              // Matched text with some context
+	Port    int    `json:"port,omitempty"`    // HTTP port of the page
 }
 
 // Detect performs enhanced brand detection with version enumeration
@@ -68,91 +29,66 @@ func Detect(serverHdr, body, rtspServer string) (brand, note string) {
 	return result.Brand, result.Note
 }
 
-// DetectWithVersion performs brand detection and returns version information
+// DetectWithVersion performs brand detection and returns version information.
+// The brand is the best scored candidate, see DetectCandidates; the note says
+// where its strongest evidence was found.
 func DetectWithVersion(serverHdr, body, rtspServer string) DetectResult {
 	lh := strings.ToLower(serverHdr)
 	lb := strings.ToLower(body)
 	lr := strings.ToLower(rtspServer)
-
-	// Enhanced brand detection with multiple methods
-	brands := []string{"Hikvision", "Dahua", "Axis", "Sony", "Bosch", "Samsung", "Panasonic", "Vivotek", "CP Plus"}
-
-	for _, brand := range brands {
-		// Method 1: Header matching
-		if headerContainsAny(lh, getBrandKeys(brand)) {
-			version := extractVersion(body, brand)
-			note := ""
-			if version != "" {
-				note = "Version: " + version
-			}
-			return DetectResult{Brand: brand, Note: note, Version: version}
-		}
-
-		// Method 2: Web content pattern matching
-		if webContentPatterns[brand] != nil && webContentPatterns[brand].MatchString(body) {
-			version := extractVersion(body, brand)
-			note := "Web content match"
-			if version != "" {
-				note += " | Version: " + version
-			}
-			return DetectResult{Brand: brand, Note: note, Version: version}
+	sigs := currentSignatures()
+
+	if cands := sigs.candidates(serverHdr, body, rtspServer, sigs.scan(lh), sigs.scan(lb), sigs.scan(lr)); len(cands) > 0 {
+		top := cands[0]
+		text, note := body, ""
+		switch top.Why[0].Method {
+		case "content":
+			note = "Web content match"
+		case "title":
+			note = "Title match"
+		case "rtsp":
+			text, note = rtspServer, "RTSP server: "+rtspServer
 		}
-
-		// Method 3: Title pattern matching
-		if titlePatterns[brand] != nil && titlePatterns[brand].MatchString(body) {
-			version := extractVersion(body, brand)
-			note := "Title match"
-			if version != "" {
-				note += " | Version: " + version
-			}
-			return DetectResult{Brand: brand, Note: note, Version: version}
-		}
-
-		// Method 4: Body keyword matching
-		if headerContainsAny(lb, getBrandKeys(brand)) {
-			version := extractVersion(body, brand)
-			note := ""
-			if version != "" {
-				note = "Version: " + version
+		version := ExtractVersion(top.Brand, text)
+		if version != "" {
+			if note != "" {
+				note += " | "
 			}
-			return DetectResult{Brand: brand, Note: note, Version: version}
-		}
-
-		// Method 5: RTSP server matching
-		if strings.Contains(lr, strings.ToLower(brand)) {
-			version := extractVersion(rtspServer, brand)
-			note := "RTSP server: " + rtspServer
-			if version != "" {
-				note += " | Version: " + version
-			}
-			return DetectResult{Brand: brand, Note: note, Version: version}
+			note += "Version: " + version
 		}
+		return DetectResult{Brand: top.Brand, Note: note, Version: version, Model: ExtractModel(top.Brand, text), Why: top.Why}
 	}
 
 	// RTSP server brand detection (fallback)
 	if rtspServer != "" {
 		if norm := normalizeRtspBrandFromServer(rtspServer); norm != "RTSP" && norm != "" {
-			version := extractVersion(rtspServer, norm)
+			version := ExtractVersion(norm, rtspServer)
 			note := "RTSP server: " + rtspServer
 			if version != "" {
 				note += " | Version: " + version
 			}
-			return DetectResult{Brand: norm, Note: note, Version: version}
+			return DetectResult{Brand: norm, Note: note, Version: version, Why: []Match{{Method: "rtsp", Text: rtspServer}}}
 		}
 	}
 
 	// Generic camera hints
-	if headerContainsAny(lh, brandKeysGeneric) || headerContainsAny(lb, brandKeysGeneric) || headerContainsAny(lr, brandKeysGeneric) {
-		return DetectResult{Brand: "Unknown cam", Note: "", Version: ""}
+	generic := sigs.Generic
+	for _, text := range []struct{ method, text, lower string }{{"header", serverHdr, lh}, {"body", body, lb}, {"rtsp", rtspServer, lr}} {
+		if kw, ok := firstContained(text.lower, generic); ok {
+			return DetectResult{Brand: "Unknown cam", Why: []Match{{Method: text.method, Pattern: kw, Text: snippet(text.text, kw)}}}
+		}
 	}
 
 	return DetectResult{Brand: "", Note: "", Version: ""}
 }
 
-// extractVersion extracts version information from content for a specific brand
-func extractVersion(content, brand string) string {
-	if pattern, exists := versionPatterns[brand]; exists {
-		matches := pattern.FindStringSubmatch(content)
+// ExtractVersion returns the first firmware version of brand in text using the
+// version pattern of the brand's signature; "" when the brand has none or text
+// names no version. Page text is full of other version numbers, so the brand's
+// device information endpoint is preferred where there is one.
+func ExtractVersion(brand, text string) string {
+	if sig, exists := signatureFor(brand); exists && sig.version != nil {
+		matches := sig.version.FindStringSubmatch(text)
 		if len(matches) > 1 {
 			return matches[1]
 		}
@@ -160,40 +96,14 @@ func extractVersion(content, brand string) string {
 	return ""
 }
 
-// getBrandKeys returns the keyword list for a specific brand
-func getBrandKeys(brand string) []string {
-	switch brand {
-	case "Hikvision":
-		return brandKeysHikvision
-	case "Dahua":
-		return brandKeysDahua
-	case "Axis":
-		return brandKeysAxis
-	case "Sony":
-		return brandKeysSony
-	case "Bosch":
-		return brandKeysBosch
-	case "Samsung":
-		return brandKeysSamsung
-	case "Panasonic":
-		return brandKeysPanasonic
-	case "Vivotek":
-		return brandKeysVivotek
-	case "CP Plus":
-		return []string{"cp plus", "cpplus", "cp-plus", "cp_plus"}
-	default:
-		return []string{}
-	}
-}
-
-func headerContainsAny(hdr string, keys []string) bool {
-	h := strings.ToLower(hdr)
-	for _, kw := range keys {
-		if strings.Contains(h, kw) {
-			return true
+// firstContained returns the first of keys occurring in text
+func firstContained(text string, keys []string) (string, bool) {
+	for _, k := range keys {
+		if strings.Contains(text, k) {
+			return k, true
 		}
 	}
-	return false
+	return "", false
 }
 
 func normalizeRtspBrandFromServer(srvRaw string) string {
@@ -255,7 +165,7 @@ func AnalyzeWebContent(body string) DetectResult {
 			if version != "" {
 				note += " | Version: " + version
 			}
-			return DetectResult{Brand: brand, Note: note, Version: version}
+			return DetectResult{Brand: brand, Note: note, Version: version, Model: ExtractModel(brand, body)}
 		}
 	}
 
@@ -289,28 +199,32 @@ func ExtractSoftwareInfo(body string) map[string]string {
 
 // DetectLoginSystem detects the login system used by the camera
 func DetectLoginSystem(body string) string {
-	loginPatterns := map[string]*regexp.Regexp{
-		"Hikvision": regexp.MustCompile(`(?i)(?:hikvision|hik-connect|ivms|login\.jsp)`),
-		"Dahua":     regexp.MustCompile(`(?i)(?:dahua|dss|smartpss|dmss|login\.html)`),
-		"Axis":      regexp.MustCompile(`(?i)(?:axis|axis-cgi|axis communications)`),
-		"Sony":      regexp.MustCompile(`(?i)(?:sony|ipela|snc)`),
-		"Bosch":     regexp.MustCompile(`(?i)(?:bosch|flexidome|dinion)`),
-		"Samsung":   regexp.MustCompile(`(?i)(?:samsung|hanwha|wisenet)`),
-		"Panasonic": regexp.MustCompile(`(?i)(?:panasonic|wv|bb|blc)`),
-		"Vivotek":   regexp.MustCompile(`(?i)(?:vivotek|fd|sd)`),
-		"Generic":   regexp.MustCompile(`(?i)(?:login|admin|webadmin|viewer)`),
-	}
-
-	for system, pattern := range loginPatterns {
-		if pattern.MatchString(body) {
-			return system
+	// Ordered so brand-specific patterns win over the generic fallback
+	loginPatterns := []struct {
+		system  string
+		pattern *regexp.Regexp
+	}{
+		{"Hikvision", regexp.MustCompile(`(?i)(?:hikvision|hik-connect|ivms|login\.jsp)`)},
+		{"Dahua", regexp.MustCompile(`(?i)(?:dahua|dss|smartpss|dmss|login\.html)`)},
+		{"Axis", regexp.MustCompile(`(?i)(?:axis|axis-cgi|axis communications)`)},
+		{"Sony", regexp.MustCompile(`(?i)(?:sony|ipela|snc)`)},
+		{"Bosch", regexp.MustCompile(`(?i)(?:bosch|flexidome|dinion)`)},
+		{"Samsung", regexp.MustCompile(`(?i)(?:samsung|hanwha|wisenet)`)},
+		{"Panasonic", regexp.MustCompile(`(?i)(?:panasonic|wv|bb|blc)`)},
+		{"Vivotek", regexp.MustCompile(`(?i)(?:vivotek|fd|sd)`)},
+		{"Generic", regexp.MustCompile(`(?i)(?:login|admin|webadmin|viewer)`)},
+	}
+
+	for _, lp := range loginPatterns {
+		if lp.pattern.MatchString(body) {
+			return lp.system
 		}
 	}
 
 	return "Unknown"
 }
 
-func CVEsForBrand(brand string) []string { return cvedb.ForBrand(strings.ToLower(brand)) }
+func CVEsForBrand(brand string) []string { return brandCVEs(brand) }
 func CVELinks(cves []string) []string {
 	out := make([]string, 0, len(cves))
 	for _, c := range cves {
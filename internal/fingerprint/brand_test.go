@@ -1,6 +1,13 @@
 package fingerprint
 
-import "testing"
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
 
 func TestDetect(t *testing.T) {
 	b, _ := Detect("Server: HiKVISION-xxx", "", "")
@@ -12,6 +19,110 @@ func TestDetect(t *testing.T) {
 	}
 }
 
+func TestDetectBrands(t *testing.T) {
+	tests := []struct {
+		server   string
+		body     string
+		rtsp     string
+		expected string
+	}{
+		{"", "<title>Uniview</title>", "", "Uniview"},
+		{"", `<title>Reolink</title><script src="js/reolink.js">`, "", "Reolink"},
+		{"", "<title>IPCam Client</title>", "", "Foscam"},
+		{"", "<title>Amcrest</title> Web Service", "", "Amcrest"}, // Not Dahua or Hikvision
+		{"", "<title>Tapo C200</title>", "", "TP-Link"},
+		{"GeoHttpServer", "", "", "Geovision"},
+		{"", "Avigilon Control Center", "", "Avigilon"},
+		{"", "<title>Honeywell equIP Series</title>", "", "Honeywell"},
+		{"", "<title>Sarix Professional</title>", "", "Pelco"},
+		{"uc-httpd 1.0.0", "<title>NETSurveillance WEB</title>", "", "Xiongmai"},
+		{"", "", "Pelco RTSP server", "Pelco"},
+		{"", "", "HIK/1.0", "Hikvision"},
+		{"", "<title>Dahua NVR</title><p>Web Service</p>", "", "Dahua"}, // Hikvision is tried first
+		{"Dahua Rtsp Server", "<title>DVR</title>", "", "Dahua"},
+	}
+
+	for _, test := range tests {
+		if brand, _ := OptimizedDetect(test.server, test.body, test.rtsp); brand != test.expected {
+			t.Errorf("OptimizedDetect(%q, %q, %q) = %q, expected %q", test.server, test.body, test.rtsp, brand, test.expected)
+		}
+		if result := DetectWithVersion(test.server, test.body, test.rtsp); result.Brand != test.expected {
+			t.Errorf("DetectWithVersion(%q, %q, %q) = %q, expected %q", test.server, test.body, test.rtsp, result.Brand, test.expected)
+		}
+	}
+}
+
+func TestDetectCandidates(t *testing.T) {
+	tests := []struct {
+		server   string
+		body     string
+		expected string
+		min, max float64
+		weak     bool
+	}{
+		{"Hikvision-Webs", "<title>Hikvision</title>", "Hikvision", 0.9, 1, false},
+		{"", "<p>WV-S1131</p><p>BB-HCM735</p>", "Panasonic", 0.01, 0.5, true}, // Two short keywords
+		{"DahuaHttp", "powered by hikvision", "Dahua", 0.7, 1, false},         // Header beats body
+		{"", "<title>Vivotek</title> network camera", "Vivotek", 0.75, 1, false},
+	}
+
+	for _, test := range tests {
+		cands := DetectCandidates(test.server, test.body, "")
+		if len(cands) == 0 {
+			t.Errorf("DetectCandidates(%q, %q) found nothing, expected %s", test.server, test.body, test.expected)
+			continue
+		}
+		top := cands[0]
+		weak := strings.Contains(strings.Join(top.Evidence, " "), "(weak)")
+		if top.Brand != test.expected || top.Confidence < test.min || top.Confidence > test.max || weak != test.weak {
+			t.Errorf("DetectCandidates(%q, %q)[0] = %s, expected %s in [%.2f, %.2f]", test.server, test.body, top, test.expected, test.min, test.max)
+		}
+	}
+
+	pages := []Page{{Port: 8080, Body: "<title>Hikvision</title>"}, {Port: 80, Server: "lighttpd"}}
+	cands := CandidatesFromPages(pages, "Hikvision RTSP server")
+	if len(cands) == 0 || cands[0].Brand != "Hikvision" || !strings.HasPrefix(cands[0].Evidence[0], "port 8080 title") {
+		t.Errorf("CandidatesFromPages() = %v, expected Hikvision from port 8080", cands)
+	}
+	if why := cands[0].Why; len(why) != len(cands[0].Evidence) || why[0].Method != "title" || why[0].Port != 8080 || why[0].Text != "<title>Hikvision</title>" {
+		t.Errorf("CandidatesFromPages()[0].Why = %+v, expected the title on port 8080", why)
+	}
+}
+
+func TestWeakKeywords(t *testing.T) {
+	tests := []struct {
+		server   string
+		body     string
+		expected string // Brand of OptimizedDetect
+	}{
+		{"", `<script src="/js/sdk.js"></script>`, ""},
+		{"", "Insert an SD card to record", ""},
+		{"", "<title>FD8169A</title>", ""}, // One short keyword
+		{"", "<title>DVR Login</title>", "Unknown cam"},
+		{"", "NVR network camera", "Unknown cam"},
+		{"", "Email address", ""},
+		{"", "<title>FD8169A</title> SD9364-EHL", "Vivotek"}, // fd and sd
+	}
+
+	for _, test := range tests {
+		if brand, _ := OptimizedDetect(test.server, test.body, ""); brand != test.expected {
+			t.Errorf("OptimizedDetect(%q, %q) = %q, expected %q", test.server, test.body, brand, test.expected)
+		}
+		result := DetectWithVersion(test.server, test.body, "")
+		if result.Brand != test.expected {
+			t.Errorf("DetectWithVersion(%q, %q) = %q, expected %q", test.server, test.body, result.Brand, test.expected)
+		}
+		cands := DetectCandidates(test.server, test.body, "")
+		if test.expected == "" || test.expected == "Unknown cam" {
+			if len(cands) > 0 {
+				t.Errorf("DetectCandidates(%q, %q) = %v, expected none", test.server, test.body, cands)
+			}
+		} else if len(cands) == 0 || cands[0].Brand != test.expected {
+			t.Errorf("DetectCandidates(%q, %q) = %v, expected %s", test.server, test.body, cands, test.expected)
+		}
+	}
+}
+
 func TestDetectWithVersion(t *testing.T) {
 	// Test Hikvision with version
 	result := DetectWithVersion("Server: HiKVISION-WebService/1.0", "Hikvision Web Service v4.1.2", "")
@@ -21,6 +132,16 @@ func TestDetectWithVersion(t *testing.T) {
 	if result.Version != "4.1.2" {
 		t.Fatalf("want version 4.1.2, got %s", result.Version)
 	}
+	expected := Match{Method: "header", Pattern: "hikvision", Text: "Server: HiKVISION-WebService/1.0"}
+	if len(result.Why) != 2 || result.Why[0] != expected || result.Why[1].Method != "body" {
+		t.Errorf("DetectWithVersion().Why = %+v, expected %+v", result.Why, expected)
+	}
+
+	result = DetectWithVersion("", "<p>Login</p><p>NVR network camera</p>", "")
+	expected = Match{Method: "body", Pattern: "camera", Text: "<p>Login</p><p>NVR network camera</p>"}
+	if len(result.Why) != 1 || result.Why[0] != expected {
+		t.Errorf("DetectWithVersion().Why = %+v, expected %+v", result.Why, expected)
+	}
 }
 
 func TestWebContentAnalysis(t *testing.T) {
@@ -34,7 +155,7 @@ func TestWebContentAnalysis(t *testing.T) {
 
 func TestVersionExtraction(t *testing.T) {
 	// Test version extraction
-	version := extractVersion("Hikvision Web Service v4.1.2", "Hikvision")
+	version := ExtractVersion("Hikvision", "Hikvision Web Service v4.1.2")
 	if version != "4.1.2" {
 		t.Fatalf("want version 4.1.2, got %s", version)
 	}
@@ -70,3 +191,641 @@ func TestTitlePatternMatching(t *testing.T) {
 		t.Fatalf("want Dahua from title, got %s", result.Brand)
 	}
 }
+
+func TestDetectFromONVIF(t *testing.T) {
+	tests := []struct {
+		manufacturer string
+		expected     string
+	}{
+		{"HIKVISION", "Hikvision"},
+		{"Dahua", "Dahua"},
+		{"Uniview", "Uniview"},
+		{"  ", ""},
+	}
+
+	for _, test := range tests {
+		if result := DetectFromONVIF(test.manufacturer); result != test.expected {
+			t.Errorf("DetectFromONVIF(%q) = %q, expected %q", test.manufacturer, result, test.expected)
+		}
+	}
+}
+
+func TestDetectFromONVIFScopes(t *testing.T) {
+	tests := []struct {
+		name     string
+		hardware string
+		expected string
+	}{
+		{"HIKVISION", "DS-2CD2042WD-I", "Hikvision"},
+		{"IPCAM", "DS-2CD2042WD-I", "Hikvision"},
+		{"Lobby", "IPC-HFW1230S", "Dahua"},
+		{"AXIS", "M3045-V", "Axis"},
+		{"Lobby", "IPC-1080P", ""},
+		{"Reolink", "RLC-410", "Reolink"},
+	}
+
+	for _, test := range tests {
+		if result := DetectFromONVIFScopes(test.name, test.hardware); result != test.expected {
+			t.Errorf("DetectFromONVIFScopes(%q, %q) = %q, expected %q", test.name, test.hardware, result, test.expected)
+		}
+	}
+}
+
+func TestDetectFromPages(t *testing.T) {
+	router := Page{Port: 80, Server: "lighttpd", Body: "<html><title>Router login</title></html>"}
+	hik := Page{Port: 8080, Body: `<script src="/doc/script/hikvision/login.js"></script>`}
+	dahua := Page{Port: 8000, Server: "DahuaHttp"}
+	dahuaTLS := Page{Port: 8443, Server: "DahuaHttp"}
+
+	tests := []struct {
+		pages    []Page
+		expected string
+		port     string
+	}{
+		{[]Page{router, hik}, "Hikvision", "HTTP port 8080"},
+		{[]Page{hik, dahua, dahuaTLS}, "Dahua", "HTTP port 8000"},
+		{[]Page{hik, dahua}, "Dahua", "HTTP port 8000"}, // Tie goes to the lowest port
+		{[]Page{router}, "", ""},
+	}
+
+	for _, test := range tests {
+		brand, note := DetectFromPages(test.pages)
+		if brand != test.expected || !strings.HasPrefix(note, test.port) {
+			t.Errorf("DetectFromPages(%v) = %q (%q), expected %q from %q", test.pages, brand, note, test.expected, test.port)
+		}
+	}
+}
+
+func TestDetectFromSNMP(t *testing.T) {
+	tests := []struct {
+		sysObjectID string
+		sysDescr    string
+		expected    string
+	}{
+		{"1.3.6.1.4.1.39165.1.1", "Linux 3.0.8", "Hikvision"},
+		{"1.3.6.1.4.1.368.4", "", "Axis"},
+		{"1.3.6.1.4.1.8072.3.2.10", "Dahua NVR4208-8P V4.001", "Dahua"},
+		{"1.3.6.1.4.1.8072.3.2.10", "Linux router 4.14.0", ""},
+		{"", "", ""},
+	}
+
+	for _, test := range tests {
+		if result := DetectFromSNMP(test.sysObjectID, test.sysDescr); result != test.expected {
+			t.Errorf("DetectFromSNMP(%q, %q) = %q, expected %q", test.sysObjectID, test.sysDescr, result, test.expected)
+		}
+	}
+}
+
+func TestDetectFromMAC(t *testing.T) {
+	tests := []struct {
+		mac      string
+		expected string
+	}{
+		{"28:57:be:12:34:56", "Hikvision"},
+		{"E0-50-8B-12-34-56", "Dahua"},
+		{"00:40:8c:aa:bb:cc", "Axis"},
+		{"f0:9f:c2:aa:bb:cc", ""},
+		{"", ""},
+	}
+
+	for _, test := range tests {
+		if result := DetectFromMAC(test.mac); result != test.expected {
+			t.Errorf("DetectFromMAC(%q) = %q, expected %q", test.mac, result, test.expected)
+		}
+	}
+}
+
+func TestCPEs(t *testing.T) {
+	tests := []struct {
+		brand, model, firmware string
+		expected               []string
+	}{
+		{"Hikvision", "DS-2CD2042WD-I", "V5.4.5build 170124", []string{
+			"cpe:2.3:o:hikvision:ds-2cd2042wd-i_firmware:5.4.5:*:*:*:*:*:*:*",
+			"cpe:2.3:h:hikvision:ds-2cd2042wd-i:-:*:*:*:*:*:*:*",
+		}},
+		{"Dahua", "IPC-HFW1230S", "2.800.0000000.16.R, Build Date 2020-09-24", []string{
+			"cpe:2.3:o:dahuasecurity:ipc-hfw1230s_firmware:2.800.0000000.16.r:*:*:*:*:*:*:*",
+			"cpe:2.3:h:dahuasecurity:ipc-hfw1230s:-:*:*:*:*:*:*:*",
+		}},
+		{"Axis", "AXIS M3045-V (1/2)", "", []string{
+			"cpe:2.3:o:axis:axis_m3045-v_\\(1\\/2\\)_firmware:*:*:*:*:*:*:*:*",
+			"cpe:2.3:h:axis:axis_m3045-v_\\(1\\/2\\):-:*:*:*:*:*:*:*",
+		}},
+		{"Hikvision", "", "V5.4.5", nil},
+		{"Unknown cam", "IPC", "1.0.0", nil},
+	}
+
+	for _, test := range tests {
+		if result := CPEs(test.brand, test.model, test.firmware); !slices.Equal(result, test.expected) {
+			t.Errorf("CPEs(%q, %q, %q) = %v, expected %v", test.brand, test.model, test.firmware, result, test.expected)
+		}
+	}
+}
+
+func TestExtractSerial(t *testing.T) {
+	tests := []struct {
+		text   string
+		serial string
+	}{
+		{`var serialNumber = "DS-2CD2042WD-I20170101AAWR123456789";`, "DS-2CD2042WD-I20170101AAWR123456789"},
+		{`{"deviceSN":"6J0A1B2PAZ12345","model":"IPC-HFW2431S"}`, "6J0A1B2PAZ12345"},
+		{`g_sn='ABC123'`, ""}, // Part of another name
+		{`<input id="sn" value="">`, ""},
+		{`var sn = "";`, ""},
+	}
+	for _, test := range tests {
+		if serial := ExtractSerial(test.text); serial != test.serial {
+			t.Errorf("ExtractSerial(%q) = %q, expected %q", test.text, serial, test.serial)
+		}
+	}
+}
+
+func TestExtractModel(t *testing.T) {
+	tests := []struct {
+		brand, text string
+		model, line string
+	}{
+		{"Hikvision", `<title>DS-7608NI-K2 Web Service</title>`, "DS-7608NI-K2", "DS-76xx NVR"},
+		{"Hikvision", `Model: DS-2CD2042WD-I, Version: V5.4.5`, "DS-2CD2042WD-I", "DS-2CD IP camera"},
+		{"Dahua", `<deviceType>DH-IPC-HFW2431S-S-S2</deviceType>`, "DH-IPC-HFW2431S-S-S2", "IPC IP camera"},
+		{"Dahua", `WEB SERVICE NVR4104HS-4KS2`, "NVR4104HS-4KS2", "NVR"},
+		{"Axis", `<title>AXIS M3045-V Network Camera</title>`, "M3045-V", ""},
+		{"Axis", `<title>Axis camera</title>`, "", ""},
+		{"Unknown cam", `DS-2CD2042WD-I`, "", ""},
+	}
+
+	for _, test := range tests {
+		model := ExtractModel(test.brand, test.text)
+		if model != test.model {
+			t.Errorf("ExtractModel(%q, %q) = %q, expected %q", test.brand, test.text, model, test.model)
+		}
+		if line := LineOf(test.brand, model); line != test.line {
+			t.Errorf("LineOf(%q, %q) = %q, expected %q", test.brand, model, line, test.line)
+		}
+	}
+
+	if r := DetectWithVersion("", `<title>DS-2CD2142FWD-IS</title> hikvision`, ""); r.Model != "DS-2CD2142FWD-IS" {
+		t.Errorf("DetectWithVersion() model = %q, expected DS-2CD2142FWD-IS", r.Model)
+	}
+}
+
+func TestPlatform(t *testing.T) {
+	tests := []struct {
+		brand, platform string
+	}{
+		{"Annke", "Hikvision"},
+		{"LTS", "Hikvision"},
+		{"Lorex", "Dahua"},
+		{"CP Plus", "Dahua"},
+		{"Amcrest", "Dahua"},
+		{"Hikvision", "Hikvision"},
+		{"Unknown cam", "Unknown cam"},
+	}
+	for _, test := range tests {
+		if result := Platform(test.brand); result != test.platform {
+			t.Errorf("Platform(%q) = %q, expected %q", test.brand, result, test.platform)
+		}
+	}
+
+	if brand, _ := Detect("", `<title>LOREX NVR</title>`, ""); brand != "Lorex" {
+		t.Errorf("Detect(Lorex NVR page) = %q, expected the label before the platform keywords", brand)
+	}
+	if cves := CVEsForBrand("Annke"); !slices.Contains(cves, "CVE-2021-36260") {
+		t.Errorf("CVEsForBrand(Annke) = %v, expected the Hikvision CVEs", cves)
+	}
+	cves := CVEsForBrand("CP Plus")
+	if len(cves) < 4 || cves[0] != "CVE-2023-3704" || !slices.Contains(cves, "CVE-2021-33044") {
+		t.Errorf("CVEsForBrand(CP Plus) = %v, expected its own CVEs followed by Dahua's", cves)
+	}
+}
+
+func TestDefaultCredentials(t *testing.T) {
+	tests := []struct {
+		brand    string
+		expected []string
+	}{
+		{"Hikvision", []string{"admin:12345"}},
+		{"Annke", []string{"admin:12345"}},
+		{"Amcrest", []string{"admin:admin", "888888:888888", "666666:666666"}},
+		{"Vivotek", []string{"root:"}},
+		{"Unknown", nil},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		if got := DefaultCredentials(tt.brand); !slices.Equal(got, tt.expected) {
+			t.Errorf("DefaultCredentials(%q) = %q, expected %q", tt.brand, got, tt.expected)
+		}
+	}
+}
+
+func TestCVEAffects(t *testing.T) {
+	tests := []struct {
+		brand, id, class string
+		expected         bool
+	}{
+		{"Hikvision", "CVE-2021-36260", ClassCamera, true},
+		{"Hikvision", "CVE-2021-36260", ClassRecorder, false},
+		{"Annke", "CVE-2017-7921", ClassRecorder, false},
+		{"Hikvision", "CVE-2017-7921", "", true},
+		{"Dahua", "CVE-2021-33044", ClassRecorder, true},
+	}
+	for _, test := range tests {
+		if result := CVEAffects(test.brand, test.id, test.class); result != test.expected {
+			t.Errorf("CVEAffects(%q, %q, %q) = %v, expected %v", test.brand, test.id, test.class, result, test.expected)
+		}
+	}
+
+	classes := map[string]string{
+		"ds-2cd2032-i": ClassCamera,
+		"ds-7608ni-k2": ClassRecorder,
+		"nvr4208-8p":   ClassRecorder,
+		"ds-k1t671m":   "",
+	}
+	for product, expected := range classes {
+		if result := productClass("Annke", product); result != expected {
+			t.Errorf("productClass(Annke, %q) = %q, expected %q", product, result, expected)
+		}
+	}
+}
+
+func TestDetectFromCert(t *testing.T) {
+	saved := currentSignatures()
+	t.Cleanup(func() {
+		signaturesMu.Lock()
+		signatures = saved
+		signaturesMu.Unlock()
+	})
+	signaturesMu.Lock()
+	signatures.Brands = append(slices.Clone(signatures.Brands), Signature{Brand: "Acme", CertSHA256: []string{"0a1b2c"}})
+	signaturesMu.Unlock()
+
+	tests := []struct {
+		names  []string
+		sha256 string
+		brand  string
+	}{
+		{[]string{"Hikvision", "IPC"}, "", "Hikvision"},
+		{[]string{"Zhejiang Dahua Technology Co.,Ltd"}, "", "Dahua"},
+		{[]string{"Hanwha Vision"}, "", "Samsung"},
+		{[]string{"Acme Co"}, "0A:1B:2C", "Acme"},
+		{[]string{"Let's Encrypt"}, "ffff", ""},
+		{nil, "", ""},
+	}
+	for _, test := range tests {
+		if brand, _ := DetectFromCert(test.names, test.sha256); brand != test.brand {
+			t.Errorf("DetectFromCert(%q, %q) = %q, expected %q", test.names, test.sha256, brand, test.brand)
+		}
+	}
+}
+
+func TestDetectFromRedirect(t *testing.T) {
+	tests := []struct {
+		target   string
+		expected string
+	}{
+		{"http://10.0.0.5/doc/page/login.asp?_1700000000", "Hikvision"},
+		{"https://10.0.0.5:443/doc/index.html", "Hikvision"},
+		{"/view/viewer_index.shtml?id=1", "Axis"},
+		{"http://10.0.0.5/WMF/index.html", "Samsung"},
+		{"http://10.0.0.5/ssi.cgi/Login.htm", "Geovision"},
+		{"http://10.0.0.5/login.html", ""},
+	}
+
+	for _, test := range tests {
+		if result := DetectFromRedirect(test.target); result != test.expected {
+			t.Errorf("DetectFromRedirect(%q) = %q, expected %q", test.target, result, test.expected)
+		}
+	}
+}
+
+func TestDetectFromNuclei(t *testing.T) {
+	tests := []struct {
+		templateID string
+		tags       []string
+		expected   string
+	}{
+		{"hikvision-detect", []string{"tech", "iot"}, "Hikvision"},
+		{"CVE-2021-33044", []string{"cve", "dahua", "auth-bypass"}, "Dahua"},
+		{"cpplus-panel", nil, "CP Plus"},
+		{"generic-login-panel", []string{"panel", "login"}, ""},
+	}
+
+	for _, test := range tests {
+		if result := DetectFromNuclei(test.templateID, test.tags); result != test.expected {
+			t.Errorf("DetectFromNuclei(%q, %v) = %q, expected %q", test.templateID, test.tags, result, test.expected)
+		}
+	}
+}
+
+func TestLoadSignatures(t *testing.T) {
+	saved := currentSignatures()
+	t.Cleanup(func() {
+		signaturesMu.Lock()
+		signatures = saved
+		signaturesMu.Unlock()
+		ClearCache()
+	})
+
+	path := filepath.Join(t.TempDir(), "local.json")
+	data := `{"brands": [
+		{"brand": "Acme", "keywords": ["AcmeCam"], "version": "(?i)acmecam/(\\d+\\.\\d+)"},
+		{"brand": "Axis", "keywords": ["axis-only-keyword"]}
+	], "generic": ["doorbell"]}`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadSignatures(path); err != nil {
+		t.Fatalf("LoadSignatures: %v", err)
+	}
+
+	tests := []struct {
+		server   string
+		body     string
+		expected string
+	}{
+		{"AcmeCam/2.1", "", "Acme"},
+		{"", "Hikvision login", "Hikvision"},  // Built-in signatures stay
+		{"", "AXIS M3045-V", ""},              // Replaced by the file
+		{"", "Smart doorbell", "Unknown cam"}, // Generic keyword added
+	}
+	for _, test := range tests {
+		if brand, _ := OptimizedDetect(test.server, test.body, ""); brand != test.expected {
+			t.Errorf("OptimizedDetect(%q, %q) = %q, expected %q", test.server, test.body, brand, test.expected)
+		}
+	}
+	if result := DetectWithVersion("", "acmecam/2.1", ""); result.Brand != "Acme" || result.Version != "2.1" {
+		t.Errorf("DetectWithVersion = %+v, expected Acme 2.1", result)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"brands": [{"brand": "Bad", "content": "("}]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadSignatures(path); err == nil {
+		t.Error("LoadSignatures accepted an invalid pattern")
+	}
+}
+
+func TestDetectionCache(t *testing.T) {
+	saved := brandCache
+	brandCache = newBrandDetectionCache(2)
+	t.Cleanup(func() { brandCache = saved })
+
+	pages := []string{"<title>Hikvision</title>", "<title>Dahua</title>", "<title>AXIS</title>"}
+	for _, body := range pages {
+		OptimizedDetect("", body, "")
+	}
+	if brand, _ := OptimizedDetect("", "<TITLE>AXIS</TITLE>", ""); brand != "Axis" {
+		t.Errorf("OptimizedDetect() = %q from the cache, expected Axis", brand)
+	}
+	stats := GetCacheStats()
+	if stats.Entries != 2 || stats.Capacity != 2 || stats.Evictions != 1 || stats.Hits != 1 || stats.Misses != 3 {
+		t.Errorf("GetCacheStats() = %+v, expected 2 of 2 entries, 1 eviction, 1 hit and 3 misses", stats)
+	}
+	if _, ok := brandCache.get(detectionKey("", pages[0], "")); ok {
+		t.Error("the least recently used result was not evicted")
+	}
+
+	SetCacheSize(1)
+	if stats := GetCacheStats(); stats.Entries != 1 {
+		t.Errorf("GetCacheStats() after SetCacheSize(1) = %+v", stats)
+	}
+}
+
+func TestDetectFromSDP(t *testing.T) {
+	tests := []struct {
+		lines []string
+		brand string
+	}{
+		{[]string{"s=Media Presentation", "e=NONE", "a=control:/Streaming/Channels/101/trackID=1"}, "Hikvision"},
+		{[]string{"s=Media Server", "a=control:trackID=0"}, "Dahua"},
+		{[]string{"s=Session streamed by \"testOnDemandRTSPServer\""}, ""},
+		{nil, ""},
+	}
+	for _, test := range tests {
+		if brand, _ := DetectFromSDP(test.lines); brand != test.brand {
+			t.Errorf("DetectFromSDP(%q) = %q, expected %q", test.lines, brand, test.brand)
+		}
+	}
+}
+
+func TestDetectFromTLS(t *testing.T) {
+	saved := currentSignatures()
+	t.Cleanup(func() {
+		signaturesMu.Lock()
+		signatures = saved
+		signaturesMu.Unlock()
+	})
+	signaturesMu.Lock()
+	signatures.Brands = append(slices.Clone(signatures.Brands), Signature{Brand: "Acme", TLS: []string{"t120400_c030_4e8089b08790", "0123456789abcdef0123456789abcdef"}})
+	signaturesMu.Unlock()
+
+	tests := []struct {
+		ja3s, ja4s string
+		brand      string
+	}{
+		{"", "t120400_c030_4e8089b08790", "Acme"},
+		{"0123456789ABCDEF0123456789ABCDEF", "t130200_1301_234ea6891581", "Acme"},
+		{"ffffffffffffffffffffffffffffffff", "t130200_1301_234ea6891581", ""},
+		{"", "", ""},
+	}
+	for _, test := range tests {
+		if brand, _ := DetectFromTLS(test.ja3s, test.ja4s); brand != test.brand {
+			t.Errorf("DetectFromTLS(%q, %q) = %q, expected %q", test.ja3s, test.ja4s, brand, test.brand)
+		}
+	}
+}
+
+func TestDetectFromHTTPStack(t *testing.T) {
+	saved := currentSignatures()
+	t.Cleanup(func() {
+		signaturesMu.Lock()
+		signatures = saved
+		signaturesMu.Unlock()
+	})
+	set, err := parseSignatures([]byte(`{"brands": [{"brand": "Acme", "headers": ["Content-type, Server, Cache-Control"], "error_page": ["Acme-Webs: Page Not Found"]}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	signaturesMu.Lock()
+	signatures.Brands = append(slices.Clone(signatures.Brands), set.Brands...)
+	signaturesMu.Unlock()
+
+	headers := []struct {
+		names []string
+		brand string
+	}{
+		{[]string{"Set-Cookie", "Content-type", "Server", "Cache-Control", "Content-Length"}, "Acme"},
+		{[]string{"Content-Type", "Server", "Cache-Control"}, ""},
+		{[]string{"Content-type", "Server"}, ""},
+	}
+	for _, test := range headers {
+		if brand, _ := DetectFromHeaderOrder(test.names); brand != test.brand {
+			t.Errorf("DetectFromHeaderOrder(%q) = %q, expected %q", test.names, brand, test.brand)
+		}
+	}
+
+	pages := []struct {
+		body  string
+		brand string
+	}{
+		{"<h1>ACME-WEBS: page not found</h1>", "Acme"},
+		{"<html><body>404 - Dahua web service</body></html>", "Dahua"},
+		{"<html><body>Not Found</body></html>", ""},
+	}
+	for _, test := range pages {
+		if brand, _ := DetectFromErrorPage(test.body); brand != test.brand {
+			t.Errorf("DetectFromErrorPage(%q) = %q, expected %q", test.body, brand, test.brand)
+		}
+	}
+}
+
+func TestKeywordIndex(t *testing.T) {
+	set := SignatureSet{Brands: []Signature{{Brand: "Acme", Keywords: []string{"he", "she", "his", "hers"}}}}
+	set.keys = newKeywordIndex(set)
+	for _, text := range []string{"ushers", "this", "h", "shhe", ""} {
+		hits := set.scan(text)
+		for _, kw := range append(set.Brands[0].Keywords, "acme", "rs") {
+			if got := hits.contains(kw); got != strings.Contains(text, kw) && text != "" {
+				t.Errorf("scan(%q).contains(%q) = %v, expected %v", text, kw, got, !got)
+			}
+		}
+	}
+
+	// The literal filters never turn away a page their pattern matches
+	pages := []string{
+		"<title>Hikvision DS-2CD2042WD</title>",
+		"<TITLE>NETSurveillance WEB</TITLE>",
+		`<script src="/script/unv.js"></script>`,
+		`<a href="/cgi-bin/api.cgi?cmd=Login">`,
+		"<title>VIGI NVR1008H</title> vigi nvr",
+		"<title>GV-IPCam</title> ssi.cgi/Login.htm",
+		"<title>Network Camera</title> WV-S1131",
+	}
+	sigs := currentSignatures()
+	for _, page := range pages {
+		hits := sigs.scan(strings.ToLower(page))
+		for _, sig := range sigs.Brands {
+			if sig.title != nil && sig.title.MatchString(page) && !sig.titleFilter.admits(hits) {
+				t.Errorf("%s title filter %v turned away %q", sig.Brand, sig.titleFilter, page)
+			}
+			if sig.content != nil && sig.content.MatchString(page) && !sig.contentFilter.admits(hits) {
+				t.Errorf("%s content filter %v turned away %q", sig.Brand, sig.contentFilter, page)
+			}
+		}
+	}
+	if f := newLiteralFilter(`(?i)<title>.*?(?:reolink).*?</title>`); len(f) != 3 || f[1][0] != "reolink" {
+		t.Errorf("newLiteralFilter(title) = %v, expected <title>, reolink and </title>", f)
+	}
+	if f := newLiteralFilter(`(?i)(?:dahua|dss|login\.html)`); len(f) != 1 || !slices.Equal(f[0], []string{"dahua", "dss", "login.html"}) {
+		t.Errorf("newLiteralFilter(content) = %v, expected the alternatives whole", f)
+	}
+}
+
+func TestDetectLocale(t *testing.T) {
+	chinese := strings.Repeat("用户名密码登录", 3)
+	tests := []struct {
+		language, contentType, body string
+		locale                      string
+	}{
+		{"", "", `<html lang="zh_cn"><title>Login</title>`, "zh-CN"},
+		{"pt-br, en", "", `<html lang="en">`, "pt-BR"},
+		{"", "text/html; charset=GB2312", `<html lang="en">`, "zh-CN"},
+		{"", "text/html", `<meta http-equiv="Content-Type" content="text/html; charset=windows-1251">`, "ru"},
+		{"", "text/html; charset=utf-8", `<html lang="en"><body>` + chinese + `</body>`, "zh"},
+		{"", "", `<select><option>English</option><option>中文</option><option>Русский</option></select>`, ""},
+		{"", "", `<HTML xml:lang="zh-hans-cn">`, "zh-Hans-CN"},
+		{"", "", `<html lang="en-US">`, "en-US"},
+	}
+	for _, test := range tests {
+		if locale, _ := DetectLocale(test.language, test.contentType, test.body); locale != test.locale {
+			t.Errorf("DetectLocale(%q, %q, %q) = %q, expected %q", test.language, test.contentType, test.body, locale, test.locale)
+		}
+	}
+}
+
+func TestDetectSoC(t *testing.T) {
+	tests := []struct {
+		text string
+		soc  string
+	}{
+		{"Welcome to HiLinux.\r\n(none) login: ", ""},
+		{"Linux version 3.4.35 (hisilicon@ubuntu) #1 hi3518e", "HiSilicon"},
+		{"cp /mnt/mtd/Config/Account1 /tmp", "HiSilicon"},
+		{"Ingenic T31N ISVP", "Ingenic"},
+		{"Linux Ambarella 3.10.73", "Ambarella"},
+		{"SSC335 SigmaStar", "SigmaStar"},
+		{"<td>t31 = 5</td>", ""},
+	}
+	for _, test := range tests {
+		if soc, _ := DetectSoC(test.text); soc != test.soc {
+			t.Errorf("DetectSoC(%q) = %q, expected %q", test.text, soc, test.soc)
+		}
+	}
+	if soc, port := DetectSoCFromPorts([]int{80, 9530, 554}); soc != "HiSilicon" || port != 9530 {
+		t.Errorf("DetectSoCFromPorts() = %q, %d, expected the HiSilicon debug daemon", soc, port)
+	}
+	if SoCRisk("HiSilicon") == "" || SoCRisk("Ingenic") != "" {
+		t.Error("SoCRisk() should only describe the HiSilicon debug daemon")
+	}
+}
+
+func TestClassFromText(t *testing.T) {
+	tests := []struct {
+		text  string
+		class string
+	}{
+		{"IPCamera", ClassCamera},
+		{"DS-76xx NVR", ClassRecorder},
+		{"NVR4108HS-4KS2", ClassRecorder},
+		{"HCVR DVR", ClassRecorder},
+		{"DS-6704HUHI encoder", ClassEncoder},
+		{"video server", ClassEncoder},
+		{"Milestone XProtect Web Client", ClassVMS},
+		{"Agent DVR", ClassVMS}, // Not a recorder
+		{"Blue Iris Login", ClassVMS},
+		{"WEB SERVICE", ""},
+		{"Advertisement", ""},
+	}
+	for _, test := range tests {
+		if class, _ := ClassFromText(test.text); class != test.class {
+			t.Errorf("ClassFromText(%q) = %q, expected %q", test.text, class, test.class)
+		}
+	}
+	if class := ClassFromONVIFTypes([]string{"dn:NetworkVideoTransmitter", "tds:Device", "dn:NetworkVideoStorage"}); class != ClassRecorder {
+		t.Errorf("ClassFromONVIFTypes() = %q, expected recorder", class)
+	}
+	if class, port := ClassFromPorts([]int{80, 22609}); class != ClassVMS || port != 22609 {
+		t.Errorf("ClassFromPorts() = %q, %d, expected the exacqVision server", class, port)
+	}
+}
+
+func TestExport(t *testing.T) {
+	kb := Export()
+	if len(kb.Brands) != len(currentSignatures().Brands) || len(kb.Classes) != len(classPatterns) || kb.ClassPorts[7563] != ClassVMS || kb.SoCPorts[9530] != "HiSilicon" {
+		t.Fatalf("Export() = %d brands, %d classes, class ports %v, SoC ports %v", len(kb.Brands), len(kb.Classes), kb.ClassPorts, kb.SoCPorts)
+	}
+
+	// The dump loads again as a signature file and detects the same brands
+	data, err := json.Marshal(kb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	set, err := parseSignatures(data)
+	if err != nil {
+		t.Fatalf("parseSignatures(Export()) = %v", err)
+	}
+	set.keys = newKeywordIndex(set)
+	top := func(sigs SignatureSet, body string) string {
+		none := sigs.scan("")
+		if cands := sigs.candidates("", body, "", none, sigs.scan(strings.ToLower(body)), none); len(cands) > 0 {
+			return cands[0].Brand
+		}
+		return ""
+	}
+	for _, body := range []string{"Hikvision login", "<title>Dahua NVR</title>", "AXIS M3045-V", "FD8169A SD9364"} {
+		if brand, expected := top(set, body), top(currentSignatures(), body); brand != expected || brand == "" {
+			t.Errorf("candidates(%q) = %q after export, expected %q", body, brand, expected)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package fingerprint
+
+import (
+	"container/list"
+	"hash/maphash"
+	"strings"
+	"sync"
+)
+
+// defaultCacheSize bounds the detection results kept. A /16 sweep yields far more
+// distinct pages than that, but the pages worth caching, the stock login page of
+// a firmware release, repeat across hosts.
+const defaultCacheSize = 4096
+
+// BrandDetectionCache is a least recently used cache of detection results keyed on
+// a hash of the inputs, plus the CVE lists of the brands looked up
+type BrandDetectionCache struct {
+	mutex    sync.Mutex
+	capacity int
+	entries  map[uint64]*list.Element
+	order    *list.List          // Of *cacheEntry, most recently used first
+	cves     map[string][]string // Per lowercase brand
+
+	hits, misses, evictions uint64
+}
+
+type BrandResult struct {
+	Brand string
+	Note  string
+}
+
+type cacheEntry struct {
+	key    uint64
+	result BrandResult
+}
+
+// CacheStats describes the detection cache
+type CacheStats struct {
+	Entries    int // Detection results held
+	Capacity   int // Most detection results held
+	CVEEntries int // Brands whose CVE list is held
+	Hits       uint64
+	Misses     uint64
+	Evictions  uint64 // Results dropped to make room
+}
+
+var brandCache = newBrandDetectionCache(defaultCacheSize)
+
+func newBrandDetectionCache(capacity int) *BrandDetectionCache {
+	return &BrandDetectionCache{
+		capacity: max(capacity, 1),
+		entries:  make(map[uint64]*list.Element),
+		order:    list.New(),
+		cves:     make(map[string][]string),
+	}
+}
+
+// cacheSeed makes cache keys unpredictable, so crafted pages can't collide on purpose
+var cacheSeed = maphash.MakeSeed()
+
+// detectionKey hashes the inputs of a detection. Brand matching ignores the case
+// of the header and body, so they are lowercased; the RTSP Server header is kept
+// as is because unknown servers are reported verbatim.
+func detectionKey(serverHdr, body, rtspServer string) uint64 {
+	var h maphash.Hash
+	h.SetSeed(cacheSeed)
+	h.WriteString(strings.ToLower(serverHdr))
+	h.WriteByte(0)
+	h.WriteString(strings.ToLower(body))
+	h.WriteByte(0)
+	h.WriteString(rtspServer)
+	return h.Sum64()
+}
+
+// get returns the result cached under key, marking it recently used
+func (c *BrandDetectionCache) get(key uint64) (BrandResult, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if e, ok := c.entries[key]; ok {
+		c.order.MoveToFront(e)
+		c.hits++
+		return e.Value.(*cacheEntry).result, true
+	}
+	c.misses++
+	return BrandResult{}, false
+}
+
+// put caches result under key, dropping the least recently used result when full
+func (c *BrandDetectionCache) put(key uint64, result BrandResult) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if e, ok := c.entries[key]; ok {
+		e.Value.(*cacheEntry).result = result
+		c.order.MoveToFront(e)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&cacheEntry{key: key, result: result})
+	c.evict()
+}
+
+// evict drops the least recently used results beyond the capacity; the caller
+// holds the mutex
+func (c *BrandDetectionCache) evict() {
+	for c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+		c.evictions++
+	}
+}
+
+// SetCacheSize bounds the number of detection results cached, dropping the least
+// recently used ones beyond n
+func SetCacheSize(n int) {
+	brandCache.mutex.Lock()
+	defer brandCache.mutex.Unlock()
+	brandCache.capacity = max(n, 1)
+	brandCache.evict()
+}
+
+// ClearCache clears the brand detection cache
+func ClearCache() {
+	brandCache.mutex.Lock()
+	defer brandCache.mutex.Unlock()
+	brandCache.entries = make(map[uint64]*list.Element)
+	brandCache.order.Init()
+	brandCache.cves = make(map[string][]string)
+}
+
+// GetCacheStats returns cache statistics
+func GetCacheStats() CacheStats {
+	brandCache.mutex.Lock()
+	defer brandCache.mutex.Unlock()
+	return CacheStats{
+		Entries:    brandCache.order.Len(),
+		Capacity:   brandCache.capacity,
+		CVEEntries: len(brandCache.cves),
+		Hits:       brandCache.hits,
+		Misses:     brandCache.misses,
+		Evictions:  brandCache.evictions,
+	}
+}
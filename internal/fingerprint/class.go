@@ -0,0 +1,79 @@
+package fingerprint
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// An exposed camera leaks its own stream; an exposed recorder holds the footage
+// and often the credentials of every camera behind it, and a VMS server those of
+// a whole site. Hosts are classified so the report can tell them apart.
+
+// Device classes
+const (
+	ClassCamera   = "camera"
+	ClassRecorder = "recorder" // NVR, DVR or hybrid recorder
+	ClassEncoder  = "encoder"  // Video server streaming analog cameras over IP
+	ClassVMS      = "vms"      // Video management software on a server
+)
+
+// classPatterns name the class in device types, model lines, titles and banners,
+// tried in order: VMS products such as Agent DVR name recorders too
+var classPatterns = []struct {
+	class   string
+	pattern *regexp.Regexp
+}{
+	{ClassVMS, regexp.MustCompile(`(?i)xprotect|milestone systems|genetec|security center|blue ?iris|nx witness|network optix|exacqvision|digifort|hik-?central|ivms-5200|dss (?:pro|express)|zoneminder|shinobi|frigate|agent dvr|surveillance station|avigilon control center`)},
+	{ClassEncoder, regexp.MustCompile(`(?i)\b(?:video )?encoder\b|\bvideo ?server\b|\bds-6[0-9]{3}`)},
+	{ClassRecorder, regexp.MustCompile(`(?i)\b(?:nvr|dvr|xvr|hcvr|hvr|video recorder)s?\b|\b(?:nvr|xvr|hcvr)\d`)},
+	{ClassCamera, regexp.MustCompile(`(?i)\b(?:ip ?camera|network camera|ip(?:dome|zoom)|ipc|ptz|speed ?dome|webcam|camera)\b`)},
+}
+
+// classPorts are ports only VMS servers listen on
+var classPorts = map[int]string{
+	7563:  ClassVMS, // Milestone XProtect image server
+	22609: ClassVMS, // exacqVision server
+}
+
+// ClassFromText returns the device class text names, such as a device type, a
+// model line or a page title, with the matching text
+func ClassFromText(text string) (class, evidence string) {
+	for _, c := range classPatterns {
+		if m := c.pattern.FindString(text); m != "" {
+			return c.class, m
+		}
+	}
+	return "", ""
+}
+
+// ClassFromONVIFTypes returns the class the WS-Discovery types of a device
+// announce. Recorders often announce NetworkVideoTransmitter as well, and so
+// do encoders, so only NetworkVideoStorage is decisive.
+func ClassFromONVIFTypes(types []string) string {
+	names := make([]string, len(types))
+	for i, t := range types {
+		_, names[i], _ = strings.Cut(t, ":")
+		if names[i] == "" {
+			names[i] = t
+		}
+	}
+	switch {
+	case slices.Contains(names, "NetworkVideoStorage"):
+		return ClassRecorder
+	case slices.Contains(names, "NetworkVideoTransmitter"):
+		return ClassCamera
+	}
+	return ""
+}
+
+// ClassFromPorts returns the class whose servers alone listen on one of the open
+// ports, with that port
+func ClassFromPorts(ports []int) (class string, port int) {
+	for _, p := range slices.Sorted(slices.Values(ports)) {
+		if class, ok := classPorts[p]; ok {
+			return class, p
+		}
+	}
+	return "", 0
+}
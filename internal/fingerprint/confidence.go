@@ -0,0 +1,297 @@
+package fingerprint
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Candidate is a brand the evidence points to, with how sure that is
+type Candidate struct {
+	Brand      string
+	Confidence float64  // 0 to 1
+	Evidence   []string // e.g. `header "hikvision"`, `body "sd" (weak)`
+	Why        []Match  // The patterns behind Evidence, in the same order
+}
+
+func (c Candidate) String() string {
+	return c.Brand + " " + strconv.FormatFloat(c.Confidence, 'f', 2, 64) + " (" + strings.Join(c.Evidence, ", ") + ")"
+}
+
+// Weight of one piece of evidence by where it was found. Weak evidence, a keyword
+// of three letters or fewer or one shared with other brands, counts a quarter.
+const (
+	weightHeader  = 0.7
+	weightRTSP    = 0.7
+	weightTitle   = 0.6
+	weightBody    = 0.5
+	weightContent = 0.4
+	weakFactor    = 0.25
+)
+
+// DetectCandidates scores every brand of the signature set against the Server
+// header, page body and RTSP Server header and returns those with any evidence,
+// most likely first. Evidence from several places adds up (noisy-or), so a
+// brand named in the header and the title beats one whose short keyword appears
+// somewhere in the body. Given methods, e.g. "header" and "rtsp", only evidence
+// found that way counts.
+func DetectCandidates(serverHdr, body, rtspServer string, methods ...string) []Candidate {
+	sigs := currentSignatures()
+	lh := sigs.scan(strings.ToLower(serverHdr))
+	lb := sigs.scan(strings.ToLower(body))
+	lr := sigs.scan(strings.ToLower(rtspServer))
+	return sigs.candidates(serverHdr, body, rtspServer, lh, lb, lr, methods...)
+}
+
+// candidates scores every brand of sigs against the texts and their scans, on
+// the evidence of the given methods only if any are given
+func (sigs SignatureSet) candidates(serverHdr, body, rtspServer string, lh, lb, lr keywordHits, methods ...string) []Candidate {
+	counts := func(method string) bool { return len(methods) == 0 || slices.Contains(methods, method) }
+	var out []Candidate
+	for _, sig := range sigs.Brands {
+		c := Candidate{Brand: sig.Brand}
+		miss := 1.0
+		strong := false
+		add := func(source, match string, weight float64, weak bool, why Match) {
+			if !counts(why.Method) {
+				return
+			}
+			strong = strong || !weak
+			evidence := source + ` "` + truncate(strings.TrimSpace(match), 60) + `"`
+			if weak {
+				weight *= weakFactor
+				evidence += " (weak)"
+			}
+			miss *= 1 - weight
+			c.Evidence = append(c.Evidence, evidence)
+			c.Why = append(c.Why, why)
+		}
+
+		if kw, weak, ok := matchKeyword(lh, sig, sigs); ok {
+			add("header", kw, weightHeader, weak, Match{Method: "header", Pattern: kw, Text: snippet(serverHdr, kw)})
+		}
+		if sig.title != nil && sig.titleFilter.admits(lb) {
+			if m := sig.title.FindString(body); m != "" {
+				add("title", m, weightTitle, weakMatch(m, sig, sigs), Match{Method: "title", Pattern: sig.title.String(), Text: truncate(m, snippetContext*2)})
+			}
+		}
+		if kw, weak, ok := matchKeyword(lb, sig, sigs); ok {
+			add("body", kw, weightBody, weak, Match{Method: "body", Pattern: kw, Text: snippet(body, kw)})
+		}
+		if sig.content != nil && sig.contentFilter.admits(lb) {
+			// A keyword found by the pattern was counted as body evidence already
+			if m := sig.content.FindString(body); m != "" && !slices.Contains(sig.Keywords, strings.ToLower(m)) {
+				add("content", m, weightContent, weakMatch(m, sig, sigs), Match{Method: "content", Pattern: sig.content.String(), Text: snippet(body, m)})
+			}
+		}
+		rtspKeys := append([]string{strings.ToLower(sig.Brand)}, sig.RTSP...)
+		if kw, ok := lr.first(rtspKeys); ok && counts("rtsp") {
+			add("rtsp", kw, weightRTSP, len(kw) <= 3, Match{Method: "rtsp", Pattern: kw, Text: rtspServer})
+			strong = true // RTSP Server headers are terse, a short keyword of the brand's own names it
+		}
+
+		// Weak evidence alone, such as "sd" in a script name, is dropped
+		if len(c.Evidence) > 0 && (strong || namesBrand(sig, sigs, lh, lb)) {
+			c.Confidence = roundScore(1 - miss)
+			out = append(out, c)
+		}
+	}
+	sortCandidates(out)
+	return out
+}
+
+// CandidatesFromPages scores the page of every HTTP port together with the RTSP
+// Server header. A brand keeps the score of its best port; evidence names the port.
+// Given methods, only evidence found that way counts, see DetectCandidates.
+func CandidatesFromPages(pages []Page, rtspServer string, methods ...string) []Candidate {
+	pages = slices.Clone(pages)
+	slices.SortFunc(pages, func(a, b Page) int { return a.Port - b.Port })
+	best := make(map[string]int) // Index in out per brand
+	var out []Candidate
+	merge := func(cands []Candidate, prefix string, port int) {
+		for _, c := range cands {
+			for i := range c.Evidence {
+				c.Evidence[i] = prefix + c.Evidence[i]
+			}
+			for i := range c.Why {
+				c.Why[i].Port = port
+			}
+			i, seen := best[c.Brand]
+			switch {
+			case !seen:
+				best[c.Brand] = len(out)
+				out = append(out, c)
+			case c.Confidence > out[i].Confidence:
+				out[i] = c
+			}
+		}
+	}
+	for _, p := range pages {
+		merge(DetectCandidates(p.Server, p.Body, "", methods...), fmt.Sprintf("port %d ", p.Port), p.Port)
+	}
+	if rtspServer != "" {
+		merge(DetectCandidates("", "", rtspServer, methods...), "", 0)
+	}
+	sortCandidates(out)
+	return out
+}
+
+// sortCandidates orders by confidence, keeping signature or port order on ties
+func sortCandidates(cands []Candidate) {
+	slices.SortStableFunc(cands, func(a, b Candidate) int {
+		switch {
+		case a.Confidence > b.Confidence:
+			return -1
+		case a.Confidence < b.Confidence:
+			return 1
+		}
+		return 0
+	})
+}
+
+// CandidateFor returns the candidate of brand
+func CandidateFor(cands []Candidate, brand string) (Candidate, bool) {
+	i := slices.IndexFunc(cands, func(c Candidate) bool { return c.Brand == brand })
+	if i < 0 {
+		return Candidate{}, false
+	}
+	return cands[i], true
+}
+
+// matchKeyword returns the first keyword of sig in text, preferring one that isn't weak
+func matchKeyword(text keywordHits, sig Signature, sigs SignatureSet) (kw string, weak, ok bool) {
+	for _, k := range sig.Keywords {
+		if !keywordFound(text, k, sig) {
+			continue
+		}
+		if !weakKeyword(k, sig.Brand, sigs) {
+			return k, false, true
+		}
+		if !ok {
+			kw, weak, ok = k, true, true
+		}
+	}
+	return kw, weak, ok
+}
+
+// weakKeyword reports whether kw is too short or too common to name brand by itself
+func weakKeyword(kw, brand string, sigs SignatureSet) bool {
+	return len(kw) <= 3 || sharedKeyword(kw, brand, sigs)
+}
+
+// sharedKeyword reports whether kw is a generic hint or a keyword of another brand
+func sharedKeyword(kw, brand string, sigs SignatureSet) bool {
+	if slices.Contains(sigs.Generic, kw) {
+		return true
+	}
+	for _, s := range sigs.Brands {
+		if s.Brand != brand && slices.Contains(s.Keywords, kw) {
+			return true
+		}
+	}
+	return false
+}
+
+// minWeakKeywords short keywords of a brand's own name it without a stronger one
+const minWeakKeywords = 2
+
+// namesBrand reports whether the texts name the brand of sig by its keywords: one
+// that isn't weak, or minWeakKeywords short ones no other brand uses. Keywords
+// shared with other brands or the generic hints, such as dvr, never name a brand.
+func namesBrand(sig Signature, sigs SignatureSet, texts ...keywordHits) bool {
+	short := 0
+	for _, k := range sig.Keywords {
+		if !slices.ContainsFunc(texts, func(text keywordHits) bool { return keywordFound(text, k, sig) }) {
+			continue
+		}
+		if !weakKeyword(k, sig.Brand, sigs) {
+			return true
+		}
+		if !sharedKeyword(k, sig.Brand, sigs) {
+			short++
+		}
+	}
+	return short >= minWeakKeywords
+}
+
+// keywordFound reports whether kw occurs in text other than inside the negative
+// patterns of sig, as sd does in sdk
+func keywordFound(text keywordHits, kw string, sig Signature) bool {
+	if !text.contains(kw) {
+		return false
+	}
+	n := 0
+	for _, neg := range sig.Not {
+		if strings.Contains(neg, kw) && text.contains(neg) {
+			if n == 0 {
+				n = strings.Count(text.text, kw)
+			}
+			n -= strings.Count(text.text, neg) * strings.Count(neg, kw)
+			if n <= 0 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// weakMatch reports whether a content or title match names the brand only through
+// weak keywords: it must contain the brand name or a strong keyword, or for
+// content matches such as "login.jsp" be longer than three letters
+func weakMatch(match string, sig Signature, sigs SignatureSet) bool {
+	m := strings.ToLower(match)
+	if strings.Contains(m, strings.ToLower(sig.Brand)) {
+		return false
+	}
+	for _, k := range sig.Keywords {
+		if strings.Contains(m, k) && !weakKeyword(k, sig.Brand, sigs) {
+			return false
+		}
+	}
+	if strings.HasPrefix(m, "<title>") {
+		return true
+	}
+	return len(m) <= 3
+}
+
+func roundScore(f float64) float64 {
+	return float64(int(f*100+0.5)) / 100
+}
+
+// snippetContext is the text kept on either side of a match in Match.Text
+const snippetContext = 30
+
+// keywordMatches lists the keywords of sig found in text, scanned as hits, with
+// their context
+func keywordMatches(method, text string, hits keywordHits, sig Signature) []Match {
+	var out []Match
+	for _, k := range sig.Keywords {
+		if keywordFound(hits, k, sig) {
+			out = append(out, Match{Method: method, Pattern: k, Text: snippet(text, k)})
+		}
+	}
+	return out
+}
+
+// snippet returns the first occurrence of match in text, case ignored, with
+// snippetContext bytes on either side and the white space collapsed
+func snippet(text, match string) string {
+	lower := strings.ToLower(text)
+	if len(lower) != len(text) {
+		text = lower // Offsets of the lowercase text don't fit the original
+	}
+	i := strings.Index(lower, strings.ToLower(match))
+	if i < 0 {
+		return truncate(match, snippetContext*2)
+	}
+	start, end := max(i-snippetContext, 0), min(i+len(match)+snippetContext, len(text))
+	return strings.Join(strings.Fields(strings.ToValidUTF8(text[start:end], "")), " ")
+}
+
+func truncate(s string, n int) string {
+	if r := []rune(s); len(r) > n {
+		return string(r[:n]) + "…"
+	}
+	return s
+}
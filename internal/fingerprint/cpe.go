@@ -0,0 +1,75 @@
+package fingerprint
+
+import (
+	"regexp"
+	"strings"
+)
+
+// cpeVersionRe pulls the dotted version out of firmware strings such as
+// "V5.4.5 build 170124" or "2.800.0000000.16.R, Build Date 2020-09-24"
+var cpeVersionRe = regexp.MustCompile(`\d+(?:\.\d+)+(?:\.[0-9A-Za-z]+)?`)
+
+// CPEs returns the cpe:2.3 names of a device following the NVD convention for
+// embedded devices: the firmware as an operating system named <model>_firmware
+// and the model as hardware, e.g.
+//
+//	cpe:2.3:o:hikvision:ds-2cd2042wd-i_firmware:5.4.5:*:*:*:*:*:*:*
+//	cpe:2.3:h:hikvision:ds-2cd2042wd-i:-:*:*:*:*:*:*:*
+//
+// Brands outside the signature set and devices without a model give nil, since
+// a vendor alone matches every product in vulnerability feeds. An unknown
+// firmware version is written as * (any).
+func CPEs(brand, model, firmware string) []string {
+	sig, ok := signatureFor(brand)
+	model = strings.TrimSpace(model)
+	if !ok || model == "" {
+		return nil
+	}
+	vendor := cpeVendor(sig)
+	version := "*"
+	if v := cpeVersionRe.FindString(firmware); v != "" {
+		version = cpeEscape(v)
+	}
+	product := cpeEscape(model)
+	return []string{
+		"cpe:2.3:o:" + cpeEscape(vendor) + ":" + product + "_firmware:" + version + ":*:*:*:*:*:*:*",
+		"cpe:2.3:h:" + cpeEscape(vendor) + ":" + product + ":-:*:*:*:*:*:*:*",
+	}
+}
+
+// cpeVendor returns the vendor of a brand in NVD CPE names
+func cpeVendor(sig Signature) string {
+	if sig.CPEVendor != "" {
+		return sig.CPEVendor
+	}
+	return strings.ToLower(strings.ReplaceAll(sig.Brand, " ", ""))
+}
+
+// CPEVendors maps every brand with a signature, in lowercase as the CVE database
+// files it, to its vendor in NVD CPE names
+func CPEVendors() map[string]string {
+	vendors := make(map[string]string)
+	for _, sig := range currentSignatures().Brands {
+		vendors[strings.ToLower(sig.Brand)] = cpeVendor(sig)
+	}
+	return vendors
+}
+
+// cpeEscape lowercases a component of a formatted CPE name, writes spaces as
+// underscores and quotes every other character that isn't a letter, digit, '_',
+// '-' or '.' with a backslash; non-ASCII characters are dropped
+func cpeEscape(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(strings.TrimSpace(s)) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_', r == '-', r == '.':
+			b.WriteRune(r)
+		case r == ' ':
+			b.WriteByte('_')
+		case r < 0x80:
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
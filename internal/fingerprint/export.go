@@ -0,0 +1,41 @@
+package fingerprint
+
+import "maps"
+
+// KnowledgeBase is what the detectors of a build match against, for external
+// tools and reviewers to diff. Brands and Generic are in the format of a
+// signature file, so a dump loads again with -signatures.
+type KnowledgeBase struct {
+	Brands     []Signature      `json:"brands"`
+	Generic    []string         `json:"generic,omitempty"`
+	Classes    []KnowledgeEntry `json:"classes"`     // Device class patterns, tried in order
+	ClassPorts map[int]string   `json:"class_ports"` // Ports only servers of a class listen on
+	SoCs       []KnowledgeEntry `json:"socs"`        // SoC family patterns, tried in order
+	SoCPorts   map[int]string   `json:"soc_ports"`   // Ports only an SDK's daemons listen on
+}
+
+// KnowledgeEntry is a pattern naming a device class or SoC family
+type KnowledgeEntry struct {
+	Name    string `json:"name"`
+	Pattern string `json:"pattern"`
+	Risk    string `json:"risk,omitempty"`
+}
+
+// Export returns the knowledge base in use: the built-in signatures with every
+// bundle and -signatures file merged in, keywords lowercased as they are matched
+func Export() KnowledgeBase {
+	sigs := currentSignatures()
+	kb := KnowledgeBase{
+		Brands:     sigs.Brands,
+		Generic:    sigs.Generic,
+		ClassPorts: maps.Clone(classPorts),
+		SoCPorts:   maps.Clone(socPorts),
+	}
+	for _, c := range classPatterns {
+		kb.Classes = append(kb.Classes, KnowledgeEntry{Name: c.class, Pattern: c.pattern.String()})
+	}
+	for _, s := range socSignatures {
+		kb.SoCs = append(kb.SoCs, KnowledgeEntry{Name: s.soc, Pattern: s.pattern.String(), Risk: s.risk})
+	}
+	return kb
+}
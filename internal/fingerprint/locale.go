@@ -0,0 +1,123 @@
+package fingerprint
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Firmware families are built for one market, so the language of the web UI, a
+// Chinese-only page behind an unknown brand or a Russian OEM label, narrows down
+// who made the device and how it was sold.
+
+var (
+	// langRe matches the lang attribute of the html element and the
+	// Content-Language meta tag
+	langRe = regexp.MustCompile(`(?i)<html[^>]*\s(?:xml:)?lang\s*=\s*["']?([a-z]{2,3}(?:[_-][a-z0-9]{2,8})*)|<meta[^>]+http-equiv\s*=\s*["']?content-language["']?[^>]+content\s*=\s*["']?([a-z]{2,3}(?:[_-][a-z0-9]{2,8})*)`)
+	// charsetRe matches the charset of a Content-Type header or meta tag
+	charsetRe = regexp.MustCompile(`(?i)charset\s*=\s*["']?([a-z0-9_-]+)`)
+)
+
+// charsetLocales are the legacy charsets used by pages of one language only
+var charsetLocales = map[string]string{
+	"gb2312":       "zh-CN",
+	"gbk":          "zh-CN",
+	"gb18030":      "zh-CN",
+	"big5":         "zh-TW",
+	"shift_jis":    "ja",
+	"euc-jp":       "ja",
+	"euc-kr":       "ko",
+	"windows-1251": "ru",
+	"koi8-r":       "ru",
+	"windows-874":  "th",
+	"tis-620":      "th",
+}
+
+// scriptLocales are the writing systems page text is recognised by, in the order
+// they are tried: Japanese pages also use Han characters
+var scriptLocales = []struct {
+	tables []*unicode.RangeTable
+	locale string
+}{
+	{[]*unicode.RangeTable{unicode.Hiragana, unicode.Katakana}, "ja"},
+	{[]*unicode.RangeTable{unicode.Hangul}, "ko"},
+	{[]*unicode.RangeTable{unicode.Han}, "zh"},
+	{[]*unicode.RangeTable{unicode.Cyrillic}, "ru"},
+	{[]*unicode.RangeTable{unicode.Arabic}, "ar"},
+	{[]*unicode.RangeTable{unicode.Thai}, "th"},
+}
+
+// minScriptLetters of a script make it the language of the page; fewer are often
+// a language menu listing every language in its own script
+const minScriptLetters = 20
+
+// DetectLocale returns the language of a web page as a BCP 47 tag, e.g. zh-CN or
+// pt-BR, with the evidence. The Content-Language header and the lang attribute
+// are taken as declared, except English, which page templates declare whatever
+// the language of the text; then come single-language charsets and the script of
+// the text.
+func DetectLocale(contentLanguage, contentType, body string) (locale, evidence string) {
+	declared, declaredEvidence := "", ""
+	if tag := normalizeLocale(strings.Split(contentLanguage, ",")[0]); tag != "" {
+		declared, declaredEvidence = tag, "Content-Language "+tag
+	} else if m := langRe.FindStringSubmatch(body); m != nil {
+		declared = normalizeLocale(m[1] + m[2])
+		declaredEvidence = "lang " + declared
+	}
+	if declared != "" && !strings.HasPrefix(declared, "en") {
+		return declared, declaredEvidence
+	}
+
+	for _, text := range []string{contentType, body} {
+		if m := charsetRe.FindStringSubmatch(text); m != nil {
+			if tag, ok := charsetLocales[strings.ToLower(m[1])]; ok {
+				return tag, "charset " + strings.ToLower(m[1])
+			}
+		}
+	}
+	counts := make([]int, len(scriptLocales))
+	for _, r := range body {
+		if r < 0x80 {
+			continue
+		}
+		for i, s := range scriptLocales {
+			if unicode.In(r, s.tables...) {
+				counts[i]++
+				break
+			}
+		}
+	}
+	for i, s := range scriptLocales {
+		if counts[i] >= minScriptLetters {
+			return s.locale, "page text"
+		}
+	}
+	return declared, declaredEvidence
+}
+
+// normalizeLocale writes a language tag the BCP 47 way: zh_cn becomes zh-CN and
+// zh-hans zh-Hans. Anything but a tag gives "".
+func normalizeLocale(tag string) string {
+	parts := strings.FieldsFunc(strings.TrimSpace(tag), func(r rune) bool { return r == '-' || r == '_' })
+	if len(parts) == 0 || len(parts[0]) < 2 || len(parts[0]) > 3 {
+		return ""
+	}
+	for i, p := range parts {
+		for _, r := range p {
+			if r > unicode.MaxASCII || !(unicode.IsLetter(r) || unicode.IsDigit(r)) {
+				return ""
+			}
+		}
+		switch {
+		case i == 0:
+			parts[i] = strings.ToLower(p)
+		case len(p) == 2:
+			parts[i] = strings.ToUpper(p) // Region
+		case len(p) == 4:
+			parts[i] = strings.ToUpper(p[:1]) + strings.ToLower(p[1:]) // Script
+		default:
+			parts[i] = strings.ToLower(p)
+		}
+	}
+	return strings.Join(parts, "-")
+}
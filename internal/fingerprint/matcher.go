@@ -0,0 +1,337 @@
+package fingerprint
+
+import (
+	"regexp/syntax"
+	"slices"
+	"strings"
+)
+
+// matcher finds every one of a fixed set of patterns in a text in a single pass
+// (Aho-Corasick). The automaton is a full transition table over the bytes the
+// patterns use, so scanning costs one table lookup per byte of text however many
+// patterns there are.
+type matcher struct {
+	classes [256]int // Byte to column of next; bytes in no pattern are column 0
+	width   int      // Columns per state
+	next    []int32  // Next state per state and column
+	out     [][]int  // Patterns ending at each state, suffixes included
+}
+
+// newMatcher builds the automaton of patterns; empty patterns never match
+func newMatcher(patterns []string) *matcher {
+	m := &matcher{width: 1}
+	for _, p := range patterns {
+		for i := 0; i < len(p); i++ {
+			if m.classes[p[i]] == 0 {
+				m.classes[p[i]] = m.width
+				m.width++
+			}
+		}
+	}
+
+	// Trie of the patterns, -1 where there is no edge yet
+	addState := func() int32 {
+		for range m.width {
+			m.next = append(m.next, -1)
+		}
+		m.out = append(m.out, nil)
+		return int32(len(m.out) - 1)
+	}
+	addState()
+	for id, p := range patterns {
+		if p == "" {
+			continue
+		}
+		s := int32(0)
+		for i := 0; i < len(p); i++ {
+			edge := int(s)*m.width + m.classes[p[i]]
+			if m.next[edge] < 0 {
+				t := addState() // May move next, so it is indexed again
+				m.next[edge] = t
+			}
+			s = m.next[edge]
+		}
+		m.out[s] = append(m.out[s], id)
+	}
+
+	// Breadth first, missing edges follow the failure link, which is always a
+	// shallower state and so already complete
+	fail := make([]int32, len(m.out))
+	var queue []int32
+	for c := range m.width {
+		if t := m.next[c]; t < 0 {
+			m.next[c] = 0
+		} else {
+			queue = append(queue, t)
+		}
+	}
+	for len(queue) > 0 {
+		s := queue[0]
+		queue = queue[1:]
+		m.out[s] = append(m.out[s], m.out[fail[s]]...)
+		for c := range m.width {
+			i := int(s)*m.width + c
+			if t := m.next[i]; t < 0 {
+				m.next[i] = m.next[int(fail[s])*m.width+c]
+			} else {
+				fail[t] = m.next[int(fail[s])*m.width+c]
+				queue = append(queue, t)
+			}
+		}
+	}
+	return m
+}
+
+// match marks found[id] for every pattern id occurring in text
+func (m *matcher) match(text string, found []bool) {
+	s := int32(0)
+	for i := 0; i < len(text); i++ {
+		s = m.next[int(s)*m.width+m.classes[text[i]]]
+		for _, id := range m.out[s] {
+			found[id] = true
+		}
+	}
+}
+
+// keywordIndex matches the lowercase keywords, RTSP keywords, brand names and
+// pattern literals of a signature set, which detection tries on the same Server
+// header, page and RTSP header one after another
+type keywordIndex struct {
+	ids map[string]int
+	m   *matcher
+}
+
+// newKeywordIndex indexes the keywords of set
+func newKeywordIndex(set SignatureSet) *keywordIndex {
+	ix := &keywordIndex{ids: make(map[string]int)}
+	var patterns []string
+	add := func(keys ...string) {
+		for _, k := range keys {
+			if _, ok := ix.ids[k]; !ok && k != "" {
+				ix.ids[k] = len(patterns)
+				patterns = append(patterns, k)
+			}
+		}
+	}
+	for _, s := range set.Brands {
+		add(s.Keywords...)
+		add(s.RTSP...)
+		add(s.Not...)
+		add(strings.ToLower(s.Brand))
+		for _, f := range []literalFilter{s.contentFilter, s.titleFilter} {
+			for _, group := range f {
+				add(group...)
+			}
+		}
+	}
+	add(set.Generic...)
+	ix.m = newMatcher(patterns)
+	return ix
+}
+
+// keywordHits are the indexed keywords found in one lowercase text
+type keywordHits struct {
+	text  string
+	ix    *keywordIndex
+	found []bool
+}
+
+// scan finds the keywords of the set in text, which must be lowercase
+func (set SignatureSet) scan(text string) keywordHits {
+	h := keywordHits{text: text, ix: set.keys}
+	if h.ix != nil && text != "" {
+		h.found = make([]bool, len(h.ix.ids))
+		h.ix.m.match(text, h.found)
+	}
+	return h
+}
+
+// contains reports whether kw occurs in the text. Keywords the index doesn't know,
+// as in sets assembled by hand, are searched for directly.
+func (h keywordHits) contains(kw string) bool {
+	if h.text == "" {
+		return false
+	}
+	if id, ok := h.ix.lookup(kw); ok {
+		return h.found[id]
+	}
+	return strings.Contains(h.text, kw)
+}
+
+func (ix *keywordIndex) lookup(kw string) (int, bool) {
+	if ix == nil {
+		return 0, false
+	}
+	id, ok := ix.ids[kw]
+	return id, ok
+}
+
+// any reports whether one of keys occurs in the text
+func (h keywordHits) any(keys []string) bool {
+	for _, k := range keys {
+		if h.contains(k) {
+			return true
+		}
+	}
+	return false
+}
+
+// first returns the first of keys occurring in the text
+func (h keywordHits) first(keys []string) (string, bool) {
+	for _, k := range keys {
+		if h.contains(k) {
+			return k, true
+		}
+	}
+	return "", false
+}
+
+// literalFilter is a condition text must meet for a regexp to match it: one
+// literal of every group occurs in the lowercase text. Pages mostly match no
+// brand's title or content pattern, and checking the literals in the keyword
+// index spares running the patterns over the whole page.
+type literalFilter [][]string
+
+// newLiteralFilter derives the literals a match of expr must contain; an
+// empty filter admits every text
+func newLiteralFilter(expr string) literalFilter {
+	re, err := syntax.Parse(expr, syntax.Perl)
+	if err != nil {
+		return nil
+	}
+	return requiredLiterals(re.Simplify())
+}
+
+// requiredLiterals returns the groups of literals, one of each occurring in every
+// match of re
+func requiredLiterals(re *syntax.Regexp) literalFilter {
+	if s, ok := exactStrings(re); ok {
+		if slices.Contains(s, "") {
+			return nil
+		}
+		return literalFilter{s}
+	}
+	switch re.Op {
+	case syntax.OpCapture, syntax.OpPlus:
+		return requiredLiterals(re.Sub[0])
+	case syntax.OpRepeat:
+		if re.Min > 0 {
+			return requiredLiterals(re.Sub[0])
+		}
+	case syntax.OpConcat:
+		// Runs of fixed strings are joined back, the parser splits "dahua|dss" into
+		// d(?:ahua|ss)
+		var f literalFilter
+		var run []string
+		flush := func() {
+			if len(run) > 0 && !slices.Contains(run, "") {
+				f = append(f, run)
+			}
+			run = nil
+		}
+		for _, sub := range re.Sub {
+			s, ok := exactStrings(sub)
+			if ok && len(run)*len(s) <= maxExactStrings {
+				run = product(run, s)
+				continue
+			}
+			flush()
+			if ok {
+				run = s
+			} else {
+				f = append(f, requiredLiterals(sub)...)
+			}
+		}
+		flush()
+		return f
+	case syntax.OpAlternate:
+		// Any branch may match, so only one literal of each is certain
+		var group []string
+		for _, sub := range re.Sub {
+			f := requiredLiterals(sub)
+			if len(f) == 0 {
+				return nil
+			}
+			best := f[0]
+			for _, g := range f[1:] {
+				if shortest(g) > shortest(best) {
+					best = g
+				}
+			}
+			group = append(group, best...)
+		}
+		return literalFilter{group}
+	}
+	return nil
+}
+
+// maxExactStrings bounds the strings exactStrings expands a pattern into
+const maxExactStrings = 64
+
+// exactStrings returns, lowercased, every string re matches when they are few
+func exactStrings(re *syntax.Regexp) ([]string, bool) {
+	switch re.Op {
+	case syntax.OpLiteral:
+		return []string{strings.ToLower(string(re.Rune))}, true
+	case syntax.OpEmptyMatch:
+		return []string{""}, true
+	case syntax.OpCapture:
+		return exactStrings(re.Sub[0])
+	case syntax.OpAlternate:
+		var out []string
+		for _, sub := range re.Sub {
+			s, ok := exactStrings(sub)
+			if !ok || len(out)+len(s) > maxExactStrings {
+				return nil, false
+			}
+			out = append(out, s...)
+		}
+		return out, true
+	case syntax.OpConcat:
+		out := []string{""}
+		for _, sub := range re.Sub {
+			s, ok := exactStrings(sub)
+			if !ok || len(out)*len(s) > maxExactStrings {
+				return nil, false
+			}
+			out = product(out, s)
+		}
+		return out, true
+	}
+	return nil, false
+}
+
+// product appends every string of b to every string of a; an empty a is taken
+// as the empty string
+func product(a, b []string) []string {
+	if len(a) == 0 {
+		return b
+	}
+	out := make([]string, 0, len(a)*len(b))
+	for _, x := range a {
+		for _, y := range b {
+			out = append(out, x+y)
+		}
+	}
+	return out
+}
+
+func shortest(keys []string) int {
+	n := -1
+	for _, k := range keys {
+		if n < 0 || len(k) < n {
+			n = len(k)
+		}
+	}
+	return n
+}
+
+// admits reports whether the text may match
+func (f literalFilter) admits(h keywordHits) bool {
+	for _, group := range f {
+		if !h.any(group) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,62 @@
+package fingerprint
+
+import (
+	"regexp"
+	"strings"
+)
+
+// ExtractModel returns the first model number of brand in text, such as a page
+// title or body, using the model pattern of the brand's signature; "" when the
+// brand has none or text names no model
+func ExtractModel(brand, text string) string {
+	sig, ok := signatureFor(brand)
+	if !ok || sig.model == nil {
+		return ""
+	}
+	if m := sig.model.FindStringSubmatch(text); len(m) > 1 {
+		return strings.TrimRight(m[1], "-")
+	}
+	return ""
+}
+
+// serialRe matches a serial number or device ID assigned in page JavaScript or
+// JSON, e.g. var serialNumber = "DS-2CD2042WD-I20170101AAWR123456789" or
+// "deviceSN":"6J0A1B2PAZ12345"
+var serialRe = regexp.MustCompile(`(?i)["']?\b(?:serial_?(?:number|no)?|device_?(?:sn|serial|id)|sn)["']?\s*[:=]\s*["']([a-z0-9][a-z0-9_.-]{5,63})["']`)
+
+// ExtractSerial returns the first serial number or device ID that text, such as a
+// login page, assigns in its scripts; "" when there is none
+func ExtractSerial(text string) string {
+	if m := serialRe.FindStringSubmatch(text); len(m) > 1 {
+		return m[1]
+	}
+	return ""
+}
+
+// LineOf returns the product line of a model of brand, e.g. "DS-76xx NVR" for
+// DS-7608NI-K2; the longest matching prefix wins. A short vendor tag in front of
+// the model, as in DH-IPC-HFW2431S, is skipped when the model itself matches nothing.
+func LineOf(brand, model string) string {
+	sig, ok := signatureFor(brand)
+	model = strings.ToLower(strings.TrimSpace(model))
+	if !ok || model == "" {
+		return ""
+	}
+	if line := longestLine(sig.Lines, model); line != "" {
+		return line
+	}
+	if tag, rest, found := strings.Cut(model, "-"); found && len(tag) <= 3 && strings.Trim(tag, "abcdefghijklmnopqrstuvwxyz") == "" {
+		return longestLine(sig.Lines, rest)
+	}
+	return ""
+}
+
+func longestLine(lines []ModelLine, model string) string {
+	best := ModelLine{}
+	for _, l := range lines {
+		if strings.HasPrefix(model, l.Prefix) && len(l.Prefix) > len(best.Prefix) {
+			best = l
+		}
+	}
+	return best.Name
+}
@@ -0,0 +1,89 @@
+package fingerprint
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/postfix/cctvscan/internal/cvedb"
+)
+
+// Platform returns the manufacturer whose firmware brand runs: the platform of a
+// white-label brand such as Lorex (Dahua) or Annke (Hikvision), otherwise brand
+// itself. Device endpoints, CVEs and default credentials follow the platform.
+func Platform(brand string) string {
+	if sig, ok := signatureFor(brand); ok && sig.Platform != "" {
+		return sig.Platform
+	}
+	return brand
+}
+
+// IsOEM reports whether brand relabels another manufacturer's devices
+func IsOEM(brand string) bool {
+	return brand != "" && Platform(brand) != brand
+}
+
+// DefaultCredentials returns the factory default credentials of brand followed
+// by those of its platform, as user:password
+func DefaultCredentials(brand string) []string {
+	var creds []string
+	for _, b := range []string{brand, Platform(brand)} {
+		if sig, ok := signatureFor(b); ok {
+			for _, c := range sig.Creds {
+				if !slices.Contains(creds, c) {
+					creds = append(creds, c)
+				}
+			}
+		}
+	}
+	return creds
+}
+
+// brandCVEs returns the CVEs filed under brand followed by those of its platform
+func brandCVEs(brand string) []string {
+	cves := cvedb.ForBrand(strings.ToLower(brand))
+	if platform := Platform(brand); platform != brand {
+		for _, c := range cvedb.ForBrand(strings.ToLower(platform)) {
+			if !slices.Contains(cves, c) {
+				cves = append(cves, c)
+			}
+		}
+	}
+	return cves
+}
+
+// CVEAffects reports whether the CVE id may affect a device of brand in class,
+// e.g. not a camera-only CVE on a recorder. Feed CVEs take the classes of the
+// products they are filed for, classed by their model line; an unknown class,
+// or a product of none, rules nothing out.
+func CVEAffects(brand, id, class string) bool {
+	if class == "" {
+		return true
+	}
+	families := cvedb.Families(id)
+	if families == nil {
+		for _, product := range cvedb.Products(id) {
+			c := productClass(brand, product)
+			if c == "" {
+				return true
+			}
+			if !slices.Contains(families, c) {
+				families = append(families, c)
+			}
+		}
+	}
+	return len(families) == 0 || slices.Contains(families, class)
+}
+
+// productClass returns the device class of a product in CPE names, named by its
+// model line under brand or its platform, or else by the name itself
+func productClass(brand, product string) string {
+	line := LineOf(brand, product)
+	if line == "" {
+		line = LineOf(Platform(brand), product)
+	}
+	if line == "" {
+		line = product
+	}
+	class, _ := ClassFromText(line)
+	return class
+}
@@ -1,121 +1,36 @@
 package fingerprint
 
 import (
+	"fmt"
+	"net/url"
+	"slices"
 	"strings"
-	"sync"
-
-	"github.com/postfix/cctvscan/internal/cvedb"
 )
 
-// BrandDetectionCache caches brand detection results
-type BrandDetectionCache struct {
-	cache map[string]BrandResult
-	mutex sync.RWMutex
-}
-
-type BrandResult struct {
-	Brand string
-	Note  string
-	CVEs  []string
-}
-
-var brandCache = &BrandDetectionCache{
-	cache: make(map[string]BrandResult),
-}
-
-// OptimizedDetect performs brand detection with caching and optimized string operations
+// OptimizedDetect performs brand detection, caching the result for identical
+// inputs such as the stock login page served by many hosts
 func OptimizedDetect(serverHdr, body, rtspServer string) (brand, note string) {
-	// Create cache key
-	cacheKey := strings.ToLower(serverHdr + "|" + body + "|" + rtspServer)
-
-	// Check cache first
-	brandCache.mutex.RLock()
-	if cached, exists := brandCache.cache[cacheKey]; exists {
-		brandCache.mutex.RUnlock()
+	key := detectionKey(serverHdr, body, rtspServer)
+	if cached, ok := brandCache.get(key); ok {
 		return cached.Brand, cached.Note
 	}
-	brandCache.mutex.RUnlock()
-
-	// Perform detection
 	brand, note = detectBrand(serverHdr, body, rtspServer)
-
-	// Cache result
-	brandCache.mutex.Lock()
-	brandCache.cache[cacheKey] = BrandResult{
-		Brand: brand,
-		Note:  note,
-		CVEs:  cvedb.ForBrand(strings.ToLower(brand)),
-	}
-	brandCache.mutex.Unlock()
-
+	brandCache.put(key, BrandResult{Brand: brand, Note: note})
 	return brand, note
 }
 
 // detectBrand performs the actual brand detection with optimized string operations
 func detectBrand(serverHdr, body, rtspServer string) (brand, note string) {
-	// Pre-compute lowercase versions once
-	lh := strings.ToLower(serverHdr)
-	lb := strings.ToLower(body)
-	lr := strings.ToLower(rtspServer)
-
-	// Use optimized string matching
-	brandMatchers := []struct {
-		name    string
-		matcher func() bool
-	}{
-		{"Hikvision", func() bool {
-			return containsAny(lh, brandKeysHikvision) ||
-				containsAny(lb, brandKeysHikvision) ||
-				strings.Contains(lr, "hik")
-		}},
-		{"Dahua", func() bool {
-			return containsAny(lh, brandKeysDahua) ||
-				containsAny(lb, brandKeysDahua) ||
-				strings.Contains(lr, "dahua")
-		}},
-		{"Axis", func() bool {
-			return containsAny(lh, brandKeysAxis) ||
-				containsAny(lb, brandKeysAxis) ||
-				strings.Contains(lr, "axis")
-		}},
-		{"Sony", func() bool {
-			return containsAny(lh, brandKeysSony) ||
-				containsAny(lb, brandKeysSony) ||
-				strings.Contains(lr, "sony")
-		}},
-		{"Bosch", func() bool {
-			return containsAny(lh, brandKeysBosch) ||
-				containsAny(lb, brandKeysBosch) ||
-				strings.Contains(lr, "bosch")
-		}},
-		{"Samsung", func() bool {
-			return containsAny(lh, brandKeysSamsung) ||
-				containsAny(lb, brandKeysSamsung) ||
-				strings.Contains(lr, "samsung")
-		}},
-		{"Panasonic", func() bool {
-			return containsAny(lh, brandKeysPanasonic) ||
-				containsAny(lb, brandKeysPanasonic) ||
-				strings.Contains(lr, "panasonic")
-		}},
-		{"Vivotek", func() bool {
-			return containsAny(lh, brandKeysVivotek) ||
-				containsAny(lb, brandKeysVivotek) ||
-				strings.Contains(lr, "vivotek")
-		}},
-		{"CP Plus", func() bool {
-			return strings.Contains(lb, "cp plus") ||
-				strings.Contains(lb, "cpplus") ||
-				strings.Contains(lb, "cp-plus") ||
-				strings.Contains(lb, "cp_plus")
-		}},
-	}
-
-	// Check each brand matcher
-	for _, matcher := range brandMatchers {
-		if matcher.matcher() {
-			return matcher.name, ""
-		}
+	// Every keyword is looked for in one pass over each text
+	sigs := currentSignatures()
+	lh := sigs.scan(strings.ToLower(serverHdr))
+	lb := sigs.scan(strings.ToLower(body))
+	lr := sigs.scan(strings.ToLower(rtspServer))
+
+	// Every brand is scored on all of its evidence, so "dvr" on a Dahua page
+	// can't make it Hikvision by coming first; signature order only breaks ties
+	if cands := sigs.candidates(serverHdr, body, rtspServer, lh, lb, lr); len(cands) > 0 {
+		return cands[0].Brand, ""
 	}
 
 	// RTSP server brand detection
@@ -126,13 +41,281 @@ func detectBrand(serverHdr, body, rtspServer string) (brand, note string) {
 	}
 
 	// Generic camera hints
-	if containsAny(lh, brandKeysGeneric) || containsAny(lb, brandKeysGeneric) || containsAny(lr, brandKeysGeneric) {
+	if lh.any(sigs.Generic) || lb.any(sigs.Generic) || lr.any(sigs.Generic) {
 		return "Unknown cam", ""
 	}
 
 	return "", ""
 }
 
+// DetectFromONVIF maps the manufacturer reported by ONVIF GetDeviceInformation to a
+// known brand. Manufacturers without keywords are returned as reported.
+func DetectFromONVIF(manufacturer string) string {
+	manufacturer = strings.TrimSpace(manufacturer)
+	if manufacturer == "" {
+		return ""
+	}
+	if brand, _ := detectBrand("", manufacturer, ""); brand != "" && brand != "Unknown cam" {
+		return brand
+	}
+	return manufacturer
+}
+
+// Page is what one HTTP port served
+type Page struct {
+	Port   int
+	Server string
+	Body   string
+}
+
+// DetectFromPages fingerprints the page of every port and returns the specific
+// brand most ports agree on, ties going to the lowest port; note names the port
+// and the brand keyword. Without a specific brand the generic result of the first
+// page that had one is returned.
+func DetectFromPages(pages []Page) (brand, note string) {
+	pages = slices.Clone(pages)
+	slices.SortFunc(pages, func(a, b Page) int { return a.Port - b.Port })
+	votes := make(map[string]int)
+	notes := make(map[string]string) // Note of the lowest port per brand
+	var order []string               // Specific brands by lowest port
+	var generic, genericNote string
+	for _, p := range pages {
+		b, n := OptimizedDetect(p.Server, p.Body, "")
+		switch b {
+		case "":
+		case "Unknown cam":
+			if generic == "" {
+				generic, genericNote = b, n
+			}
+		default:
+			if votes[b] == 0 {
+				notes[b] = strings.TrimSpace(fmt.Sprintf("HTTP port %d %s", p.Port, n))
+				order = append(order, b)
+			}
+			votes[b]++
+		}
+	}
+	for _, b := range order {
+		if votes[b] > votes[brand] {
+			brand = b
+		}
+	}
+	if brand == "" {
+		return generic, genericNote
+	}
+	return brand, notes[brand]
+}
+
+// onvifModelPrefixes map model number prefixes seen in ONVIF hardware scopes to brands
+var onvifModelPrefixes = []struct {
+	prefix string
+	brand  string
+}{
+	{"ds-2c", "Hikvision"}, {"ds-2d", "Hikvision"}, {"ds-7", "Hikvision"}, {"ds-9", "Hikvision"},
+	{"dh-", "Dahua"}, {"ipc-hdw", "Dahua"}, {"ipc-hfw", "Dahua"}, {"ipc-hdbw", "Dahua"},
+}
+
+// DetectFromONVIFScopes maps the name and hardware scopes of a WS-Discovery
+// ProbeMatch to a brand: brand names first, then model number prefixes. Unlike
+// DetectFromONVIF, unknown values give "", since installers set arbitrary names;
+// only brand names are matched because the loose page keywords of detectBrand
+// would turn names like "Lobby" into Panasonic.
+func DetectFromONVIFScopes(name, hardware string) string {
+	text := strings.ToLower(name + " " + hardware)
+	for _, sig := range currentSignatures().Brands {
+		if strings.Contains(text, strings.ToLower(sig.Brand)) {
+			return sig.Brand
+		}
+	}
+	model := strings.ToLower(strings.TrimSpace(hardware))
+	for _, m := range onvifModelPrefixes {
+		if strings.HasPrefix(model, m.prefix) {
+			return m.brand
+		}
+	}
+	return ""
+}
+
+// snmpEnterprises maps IANA private enterprise numbers to brands
+var snmpEnterprises = map[string]string{
+	"122":     "Sony",
+	"368":     "Axis",
+	"396":     "Panasonic",
+	"3967":    "Bosch",
+	"36849":   "Samsung",
+	"39165":   "Hikvision",
+	"1004849": "Dahua",
+}
+
+// DetectFromSNMP maps an SNMP sysObjectID enterprise arc (1.3.6.1.4.1.<n>) to a brand,
+// falling back to brand names and then brand keywords in sysDescr
+func DetectFromSNMP(sysObjectID, sysDescr string) string {
+	if rest, ok := strings.CutPrefix(sysObjectID, "1.3.6.1.4.1."); ok {
+		enterprise, _, _ := strings.Cut(rest, ".")
+		if brand, found := snmpEnterprises[enterprise]; found {
+			return brand
+		}
+	}
+	// Brand names first: the generic keywords ("nvr", "dvr") are shared across vendors
+	lower := strings.ToLower(sysDescr)
+	for _, brand := range snmpEnterprises {
+		if strings.Contains(lower, strings.ToLower(brand)) {
+			return brand
+		}
+	}
+	if brand, _ := detectBrand("", sysDescr, ""); brand != "Unknown cam" {
+		return brand
+	}
+	return ""
+}
+
+// DetectFromRedirect maps the path of a redirect target to a brand through the
+// login paths of the signature set. The query string and case are ignored.
+func DetectFromRedirect(target string) string {
+	path := target
+	if u, err := url.Parse(target); err == nil {
+		path = u.Path
+	}
+	path = strings.ToLower(path)
+	for _, sig := range currentSignatures().Brands {
+		for _, prefix := range sig.Paths {
+			if strings.HasPrefix(path, prefix) {
+				return sig.Brand
+			}
+		}
+	}
+	return ""
+}
+
+// DetectFromSDP maps the signature lines of an RTSP session description (see
+// probe.SDPInfo.Signature) to a brand through the sdp lists of the signature set;
+// evidence is the line that matched. Several vendors name their sessions in
+// their own way, which identifies streams whose web UI is firewalled.
+func DetectFromSDP(lines []string) (brand, evidence string) {
+	sigs := currentSignatures()
+	for _, line := range lines {
+		lower := strings.ToLower(line)
+		for _, sig := range sigs.Brands {
+			if containsAny(lower, sig.SDP) {
+				return sig.Brand, line
+			}
+		}
+	}
+	return "", ""
+}
+
+// DetectFromNuclei maps a matched nuclei template to a brand of the signature set:
+// community templates carry the vendor as a tag and usually as the first word of
+// the template id, e.g. "hikvision-detect". Unknown vendors give "".
+func DetectFromNuclei(templateID string, tags []string) string {
+	tokens := slices.Clone(tags)
+	if first, _, _ := strings.Cut(strings.ToLower(templateID), "-"); first != "" {
+		tokens = append(tokens, first)
+	}
+	for _, sig := range currentSignatures().Brands {
+		name := strings.ToLower(strings.ReplaceAll(sig.Brand, " ", ""))
+		if slices.ContainsFunc(tokens, func(t string) bool { return strings.EqualFold(t, name) }) {
+			return sig.Brand
+		}
+	}
+	return ""
+}
+
+// DetectFromMAC maps the OUI of a MAC address such as 28:57:be:12:34:56 to a brand
+// through the vendor prefixes of the signature set
+func DetectFromMAC(mac string) string {
+	mac = strings.ToLower(strings.ReplaceAll(mac, "-", ":"))
+	if len(mac) < 8 {
+		return ""
+	}
+	for _, sig := range currentSignatures().Brands {
+		if slices.Contains(sig.OUI, mac[:8]) {
+			return sig.Brand
+		}
+	}
+	return ""
+}
+
+// DetectFromCert maps a TLS certificate to a brand: a fingerprint the signature
+// set lists as shipped with the firmware, otherwise a brand name or cert keyword
+// in the vendor names of the certificate (organisation, and the common name of
+// self-signed ones). Brand names shorter than four letters only count as listed
+// keywords. evidence says what matched.
+func DetectFromCert(vendorNames []string, sha256 string) (brand, evidence string) {
+	sha256 = strings.ToLower(strings.ReplaceAll(sha256, ":", ""))
+	sigs := currentSignatures()
+	if sha256 != "" {
+		for _, sig := range sigs.Brands {
+			if slices.Contains(sig.CertSHA256, sha256) {
+				return sig.Brand, "default certificate " + sha256
+			}
+		}
+	}
+	for _, name := range vendorNames {
+		lower := strings.ToLower(name)
+		for _, sig := range sigs.Brands {
+			keys := sig.Cert
+			if len(sig.Brand) >= 4 {
+				keys = append(slices.Clone(keys), strings.ToLower(sig.Brand))
+			}
+			if containsAny(lower, keys) {
+				return sig.Brand, "certificate names " + name
+			}
+		}
+	}
+	return "", ""
+}
+
+// DetectFromTLS maps the JA3S or JA4S fingerprint of a ServerHello to a brand
+// through the tls lists of the signature set. Both depend on the ClientHello
+// sent, so only fingerprints taken by cctvscan itself match.
+func DetectFromTLS(ja3s, ja4s string) (brand, evidence string) {
+	for _, sig := range currentSignatures().Brands {
+		for _, fp := range []struct{ kind, value string }{{"JA4S", ja4s}, {"JA3S", ja3s}} {
+			if fp.value != "" && slices.Contains(sig.TLS, strings.ToLower(fp.value)) {
+				return sig.Brand, fp.kind + " " + fp.value
+			}
+		}
+	}
+	return "", ""
+}
+
+// DetectFromHeaderOrder maps the response header names of a web server, in the
+// order and case sent, to a brand through the headers lists of the signature set.
+// An entry matches a run of consecutive names, so headers some responses add,
+// such as Set-Cookie, don't get in the way.
+func DetectFromHeaderOrder(names []string) (brand, evidence string) {
+	order := "," + strings.Join(names, ",") + ","
+	for _, sig := range currentSignatures().Brands {
+		for _, h := range sig.Headers {
+			if h != "" && strings.Contains(order, ","+h+",") {
+				return sig.Brand, "header order " + h
+			}
+		}
+	}
+	return "", ""
+}
+
+// DetectFromErrorPage maps a 404 or 401 page to a brand: an error_page string of
+// a signature, or else a brand name of four letters or more
+func DetectFromErrorPage(body string) (brand, evidence string) {
+	lower := strings.ToLower(body)
+	sigs := currentSignatures()
+	for _, sig := range sigs.Brands {
+		for _, s := range sig.ErrorPage {
+			if strings.Contains(lower, s) {
+				return sig.Brand, "error page " + s
+			}
+		}
+	}
+	for _, sig := range sigs.Brands {
+		if len(sig.Brand) >= 4 && strings.Contains(lower, strings.ToLower(sig.Brand)) {
+			return sig.Brand, "error page names " + sig.Brand
+		}
+	}
+	return "", ""
+}
+
 // containsAny optimized string matching
 func containsAny(text string, keywords []string) bool {
 	for _, keyword := range keywords {
@@ -147,30 +330,14 @@ func containsAny(text string, keywords []string) bool {
 func OptimizedCVEsForBrand(brand string) []string {
 	lowerBrand := strings.ToLower(brand)
 
-	// Check cache first
-	brandCache.mutex.RLock()
-	for _, result := range brandCache.cache {
-		if strings.ToLower(result.Brand) == lowerBrand {
-			cves := make([]string, len(result.CVEs))
-			copy(cves, result.CVEs)
-			brandCache.mutex.RUnlock()
-			return cves
-		}
-	}
-	brandCache.mutex.RUnlock()
-
-	// Get CVEs and cache them
-	cves := cvedb.ForBrand(lowerBrand)
-
-	// Cache the result
 	brandCache.mutex.Lock()
-	brandCache.cache["cve_"+lowerBrand] = BrandResult{
-		Brand: brand,
-		CVEs:  cves,
+	defer brandCache.mutex.Unlock()
+	cves, ok := brandCache.cves[lowerBrand]
+	if !ok {
+		cves = brandCVEs(brand)
+		brandCache.cves[lowerBrand] = cves
 	}
-	brandCache.mutex.Unlock()
-
-	return cves
+	return slices.Clone(cves)
 }
 
 // OptimizedCVELinks returns CVE links with pre-allocated slice
@@ -185,27 +352,3 @@ func OptimizedCVELinks(cves []string) []string {
 	}
 	return links
 }
-
-// ClearCache clears the brand detection cache
-func ClearCache() {
-	brandCache.mutex.Lock()
-	brandCache.cache = make(map[string]BrandResult)
-	brandCache.mutex.Unlock()
-}
-
-// GetCacheStats returns cache statistics
-func GetCacheStats() (int, int) {
-	brandCache.mutex.RLock()
-	defer brandCache.mutex.RUnlock()
-
-	totalEntries := len(brandCache.cache)
-	cveEntries := 0
-
-	for key := range brandCache.cache {
-		if strings.HasPrefix(key, "cve_") {
-			cveEntries++
-		}
-	}
-
-	return totalEntries, cveEntries
-}
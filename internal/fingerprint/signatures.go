@@ -0,0 +1,222 @@
+package fingerprint
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// defaultSignatures is the built-in signature set, loaded before any file
+//
+//go:embed signatures.json
+var defaultSignatures []byte
+
+// Signature identifies one brand in HTTP and RTSP answers. Brands are tried in
+// file order and the first match wins, so specific brands go before OEMs that
+// share their keywords.
+type Signature struct {
+	Brand      string      `json:"brand"`
+	Platform   string      `json:"platform,omitempty"`    // Manufacturer whose firmware a white-label brand sells, e.g. Hikvision for Annke
+	Keywords   []string    `json:"keywords"`              // Substrings of the Server header or page body
+	Not        []string    `json:"not,omitempty"`         // Substrings a short keyword occurs in without naming the brand, e.g. sdk for sd
+	RTSP       []string    `json:"rtsp,omitempty"`        // Substrings of the RTSP Server header
+	Paths      []string    `json:"paths,omitempty"`       // Prefixes of login paths the root page redirects to
+	SDP        []string    `json:"sdp,omitempty"`         // Substrings of SDP session lines or track controls, e.g. s=media presentation
+	OUI        []string    `json:"oui,omitempty"`         // MAC address prefixes assigned to the vendor, e.g. 28:57:be
+	CPEVendor  string      `json:"cpe_vendor,omitempty"`  // Vendor in NVD CPE names when it isn't the brand in lowercase
+	Cert       []string    `json:"cert,omitempty"`        // Substrings of the certificate organisation besides the brand name
+	CertSHA256 []string    `json:"cert_sha256,omitempty"` // Fingerprints of certificates the firmware ships with
+	TLS        []string    `json:"tls,omitempty"`         // JA3S or JA4S of the firmware's TLS stack, as cctvscan reports them
+	Headers    []string    `json:"headers,omitempty"`     // Runs of response header names in order and case, e.g. Content-type,Server
+	ErrorPage  []string    `json:"error_page,omitempty"`  // Substrings of the 404 and 401 pages
+	Content    string      `json:"content,omitempty"`     // Regexp matched against the page body
+	Title      string      `json:"title,omitempty"`       // Regexp matched against the page <title>
+	Version    string      `json:"version,omitempty"`     // Regexp whose first group is the firmware version
+	Model      string      `json:"model,omitempty"`       // Regexp whose first group is the model, e.g. DS-2CD2042WD-I
+	Lines      []ModelLine `json:"lines,omitempty"`       // Product lines by model prefix
+	Creds      []string    `json:"credentials,omitempty"` // Factory default user:password pairs, tried first on the brand's devices
+
+	content, title, version, model *regexp.Regexp
+	contentFilter, titleFilter     literalFilter
+}
+
+// ModelLine names the product line of models starting with Prefix, e.g. ds-76
+// for the DS-76xx NVRs; CVEs and default credentials often differ per line
+type ModelLine struct {
+	Prefix string `json:"prefix"`
+	Name   string `json:"name"`
+}
+
+// SignatureSet is the format of signature files
+type SignatureSet struct {
+	Brands  []Signature `json:"brands"`
+	Generic []string    `json:"generic,omitempty"` // Keywords of cameras without a known brand
+
+	keys *keywordIndex
+}
+
+var (
+	signaturesMu sync.RWMutex
+	signatures   SignatureSet
+)
+
+func init() {
+	set, err := parseSignatures(defaultSignatures)
+	if err != nil {
+		panic("fingerprint: built-in signatures: " + err.Error())
+	}
+	set.keys = newKeywordIndex(set)
+	signatures = set
+}
+
+// LoadSignatures merges the signature file at path over the current set: a brand
+// already known is replaced, a new one is tried after the known brands, and
+// generic keywords are added. Cached detection results are dropped.
+func LoadSignatures(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read signatures: %w", err)
+	}
+	set, err := parseSignatures(data)
+	if err != nil {
+		return fmt.Errorf("signatures %s: %w", path, err)
+	}
+
+	signaturesMu.Lock()
+	merged := SignatureSet{Brands: slices.Clone(signatures.Brands), Generic: slices.Clone(signatures.Generic)}
+	for _, s := range set.Brands {
+		i := slices.IndexFunc(merged.Brands, func(m Signature) bool { return strings.EqualFold(m.Brand, s.Brand) })
+		if i >= 0 {
+			merged.Brands[i] = s
+		} else {
+			merged.Brands = append(merged.Brands, s)
+		}
+	}
+	for _, kw := range set.Generic {
+		if !slices.Contains(merged.Generic, kw) {
+			merged.Generic = append(merged.Generic, kw)
+		}
+	}
+	merged.keys = newKeywordIndex(merged)
+	signatures = merged
+	signaturesMu.Unlock()
+
+	ClearCache()
+	return nil
+}
+
+// ValidateSignatures reports why data is not a signature file LoadSignatures
+// accepts, or nil
+func ValidateSignatures(data []byte) error {
+	_, err := parseSignatures(data)
+	return err
+}
+
+// parseSignatures decodes a signature file, lowercasing keywords and compiling
+// the regexps
+func parseSignatures(data []byte) (SignatureSet, error) {
+	var set SignatureSet
+	if err := json.Unmarshal(data, &set); err != nil {
+		return SignatureSet{}, fmt.Errorf("failed to parse signatures: %w", err)
+	}
+	for i := range set.Brands {
+		s := &set.Brands[i]
+		if s.Brand = strings.TrimSpace(s.Brand); s.Brand == "" {
+			return SignatureSet{}, fmt.Errorf("signature %d has no brand", i)
+		}
+		if len(s.Keywords) == 0 && len(s.RTSP) == 0 && len(s.Paths) == 0 && len(s.SDP) == 0 && len(s.OUI) == 0 && len(s.Cert) == 0 && len(s.CertSHA256) == 0 && len(s.TLS) == 0 && len(s.Headers) == 0 && len(s.ErrorPage) == 0 && s.Content == "" && s.Title == "" {
+			return SignatureSet{}, fmt.Errorf("signature %s matches nothing", s.Brand)
+		}
+		s.Keywords = lowerAll(s.Keywords)
+		s.Not = lowerAll(s.Not)
+		s.RTSP = lowerAll(s.RTSP)
+		s.Paths = lowerAll(s.Paths)
+		s.SDP = lowerAll(s.SDP)
+		s.OUI = lowerAll(s.OUI)
+		s.Cert = lowerAll(s.Cert)
+		s.CertSHA256 = lowerAll(s.CertSHA256)
+		s.TLS = lowerAll(s.TLS)
+		s.ErrorPage = lowerAll(s.ErrorPage)
+		for j, h := range s.Headers {
+			names := strings.Split(h, ",")
+			for k := range names {
+				names[k] = strings.TrimSpace(names[k])
+			}
+			s.Headers[j] = strings.Join(names, ",") // Case is kept, it is part of the fingerprint
+		}
+		for j, fp := range s.CertSHA256 {
+			s.CertSHA256[j] = strings.ReplaceAll(fp, ":", "")
+		}
+		for j, oui := range s.OUI {
+			s.OUI[j] = strings.ReplaceAll(oui, "-", ":")
+		}
+		for j := range s.Lines {
+			s.Lines[j].Prefix = strings.ToLower(strings.TrimSpace(s.Lines[j].Prefix))
+		}
+		for _, c := range s.Creds {
+			if !strings.Contains(c, ":") {
+				return SignatureSet{}, fmt.Errorf("signature %s: credential %q is not user:password", s.Brand, c)
+			}
+		}
+		var err error
+		for _, re := range []struct {
+			field string
+			expr  string
+			dst   **regexp.Regexp
+		}{
+			{"content", s.Content, &s.content},
+			{"title", s.Title, &s.title},
+			{"version", s.Version, &s.version},
+			{"model", s.Model, &s.model},
+		} {
+			if re.expr == "" {
+				continue
+			}
+			if *re.dst, err = regexp.Compile(re.expr); err != nil {
+				return SignatureSet{}, fmt.Errorf("signature %s: invalid %s pattern: %w", s.Brand, re.field, err)
+			}
+		}
+		s.contentFilter, s.titleFilter = newLiteralFilter(s.Content), newLiteralFilter(s.Title)
+	}
+	set.Generic = lowerAll(set.Generic)
+	return set, nil
+}
+
+func lowerAll(keys []string) []string {
+	out := make([]string, 0, len(keys))
+	for _, k := range keys {
+		if k = strings.ToLower(strings.TrimSpace(k)); k != "" {
+			out = append(out, k)
+		}
+	}
+	return out
+}
+
+// currentSignatures returns the signature set in use. Loaded sets are never
+// modified, so the result can be read without holding the lock.
+func currentSignatures() SignatureSet {
+	signaturesMu.RLock()
+	defer signaturesMu.RUnlock()
+	return signatures
+}
+
+// signatureFor returns the signature of brand
+func signatureFor(brand string) (Signature, bool) {
+	for _, s := range currentSignatures().Brands {
+		if s.Brand == brand {
+			return s, true
+		}
+	}
+	return Signature{}, false
+}
+
+// IsKnownBrand reports whether brand, as the detectors name it, has a signature
+func IsKnownBrand(brand string) bool {
+	_, ok := signatureFor(brand)
+	return ok
+}
@@ -0,0 +1,65 @@
+package fingerprint
+
+import (
+	"regexp"
+	"slices"
+)
+
+// Brands buy their chips from a handful of SoC vendors and build the firmware on
+// the vendor's SDK, so weaknesses of the SDK, such as the HiSilicon debug daemon,
+// show up under every brand using it. socSignatures name the SoC families by the
+// chip names, SDK paths and kernel strings banners and pages leak.
+var socSignatures = []struct {
+	soc     string
+	pattern *regexp.Regexp
+	risk    string // Weakness of firmware built on the SDK
+}{
+	{"HiSilicon", regexp.MustCompile(`(?i)hisilicon|\bhi35(?:1[5-9]|2[01]|3[1-6])[a-z0-9]*\b|\bhi3798[a-z0-9]*\b|\bhimpp\b|/mnt/mtd/`),
+		"DVR and NVR firmware on the HiSilicon SDK often runs a debug daemon on TCP 9530 that opens a root telnet shell on request"},
+	{"Goke", regexp.MustCompile(`(?i)\bgoke\b|\bgk7[12]\d\d[a-z0-9]*\b`), ""},
+	{"Ambarella", regexp.MustCompile(`(?i)ambarella|\bamba(?:_|link)|\bs2lm?\b`), ""},
+	{"Ingenic", regexp.MustCompile(`(?i)ingenic|\bisvp-t\d\d|\bt(?:21|23|31|40|41)[nlxzaq]\b|\bjz47\d\d\b`), ""},
+	{"Novatek", regexp.MustCompile(`(?i)novatek|\bnt98\d{3}\b`), ""},
+	{"SigmaStar", regexp.MustCompile(`(?i)sigmastar|\bmstar\b|\bss[cd]3\d\d[a-z]?\b`), ""},
+	{"Fullhan", regexp.MustCompile(`(?i)fullhan|\bfh8[56]\d\d[a-z]?\b`), ""},
+	{"Grain Media", regexp.MustCompile(`(?i)grain media|\bgm81\d\d\b`), ""},
+	{"Anyka", regexp.MustCompile(`(?i)anyka|\bak39\d\d[a-z]?\b`), ""},
+}
+
+// socPorts are ports only a vendor SDK's own daemons listen on
+var socPorts = map[int]string{
+	9530: "HiSilicon", // Debug daemon that enables telnet, see socSignatures
+}
+
+// DetectSoC returns the SoC family text, such as a telnet banner or a Server
+// header, names, with the matching text
+func DetectSoC(text string) (soc, evidence string) {
+	for _, s := range socSignatures {
+		if m := s.pattern.FindString(text); m != "" {
+			return s.soc, m
+		}
+	}
+	return "", ""
+}
+
+// DetectSoCFromPorts returns the SoC family whose SDK daemon listens on one of the
+// open ports, with that port
+func DetectSoCFromPorts(ports []int) (soc string, port int) {
+	for _, p := range slices.Sorted(slices.Values(ports)) {
+		if soc, ok := socPorts[p]; ok {
+			return soc, p
+		}
+	}
+	return "", 0
+}
+
+// SoCRisk describes the weakness firmware on soc shares whatever its brand; "" when
+// none is known
+func SoCRisk(soc string) string {
+	for _, s := range socSignatures {
+		if s.soc == soc {
+			return s.risk
+		}
+	}
+	return ""
+}
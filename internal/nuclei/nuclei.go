@@ -0,0 +1,156 @@
+package nuclei
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/exec"
+	"slices"
+	"strings"
+)
+
+// DefaultTags select the curated camera, DVR and IoT templates run when no
+// templates are given
+var DefaultTags = []string{"camera", "cctv", "dvr", "nvr", "iot", "ipcam", "hikvision", "dahua", "axis", "avtech", "tvt", "xiongmai"}
+
+// Runner runs nuclei against the web services of a host
+type Runner struct {
+	Binary    string   // Path of the nuclei executable, see Find
+	Templates []string // Template files or directories; empty runs the templates tagged DefaultTags
+}
+
+// Find returns the path of nuclei on PATH. A missing binary is reported as an
+// error wrapping exec.ErrNotFound.
+func Find() (string, error) {
+	path, err := exec.LookPath("nuclei")
+	if err != nil {
+		return "", fmt.Errorf("nuclei not found on PATH: %w", err)
+	}
+	return path, nil
+}
+
+// Match is one template that matched, as reported in nuclei's JSONL output
+type Match struct {
+	TemplateID string
+	Name       string
+	Severity   string   // info, low, medium, high or critical
+	Tags       []string // Lowercase
+	CVEs       []string // From the template classification, upper case
+	URL        string   // Where it matched
+	Extracted  []string // Values pulled out by extractors, e.g. a firmware version
+}
+
+func (m Match) String() string {
+	s := m.Severity + " " + m.TemplateID + ": " + m.URL
+	if len(m.Extracted) > 0 {
+		s += " [" + strings.Join(m.Extracted, ", ") + "]"
+	}
+	return s
+}
+
+// Run scans urls in one nuclei process and returns the matches in output order.
+// Nuclei's own rate limits apply; ctx bounds the whole run.
+func (r Runner) Run(ctx context.Context, urls []string) ([]Match, error) {
+	if len(urls) == 0 {
+		return nil, nil
+	}
+	args := []string{"-jsonl", "-silent", "-no-color", "-disable-update-check"}
+	for _, u := range urls {
+		args = append(args, "-u", u)
+	}
+	if len(r.Templates) > 0 {
+		for _, t := range r.Templates {
+			args = append(args, "-t", t)
+		}
+	} else {
+		args = append(args, "-tags", strings.Join(DefaultTags, ","))
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, r.Binary, args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("nuclei failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return ParseJSONL(bytes.NewReader(out))
+}
+
+// jsonResult is the subset of a nuclei JSONL line that is kept
+type jsonResult struct {
+	TemplateID string `json:"template-id"`
+	Info       struct {
+		Name           string     `json:"name"`
+		Severity       string     `json:"severity"`
+		Tags           stringList `json:"tags"`
+		Classification struct {
+			CVEID stringList `json:"cve-id"`
+		} `json:"classification"`
+	} `json:"info"`
+	MatchedAt string     `json:"matched-at"`
+	Extracted stringList `json:"extracted-results"`
+}
+
+// stringList accepts both a JSON array and the comma-separated string that older
+// nuclei releases wrote for tags and CVE ids
+type stringList []string
+
+func (l *stringList) UnmarshalJSON(data []byte) error {
+	var list []string
+	if err := json.Unmarshal(data, &list); err == nil {
+		*l = list
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	*l = nil
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*l = append(*l, v)
+		}
+	}
+	return nil
+}
+
+// ParseJSONL decodes nuclei -jsonl output. Lines that aren't results, such as
+// progress messages, are skipped.
+func ParseJSONL(r io.Reader) ([]Match, error) {
+	var matches []Match
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024) // Results embed whole responses
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 || line[0] != '{' {
+			continue
+		}
+		var res jsonResult
+		if err := json.Unmarshal(line, &res); err != nil || res.TemplateID == "" {
+			continue
+		}
+		m := Match{
+			TemplateID: res.TemplateID,
+			Name:       res.Info.Name,
+			Severity:   strings.ToLower(res.Info.Severity),
+			URL:        res.MatchedAt,
+			Extracted:  res.Extracted,
+		}
+		for _, t := range res.Info.Tags {
+			m.Tags = append(m.Tags, strings.ToLower(t))
+		}
+		for _, c := range res.Info.Classification.CVEID {
+			if c = strings.ToUpper(c); !slices.Contains(m.CVEs, c) {
+				m.CVEs = append(m.CVEs, c)
+			}
+		}
+		matches = append(matches, m)
+	}
+	if err := scanner.Err(); err != nil {
+		return matches, fmt.Errorf("failed to read nuclei output: %w", err)
+	}
+	return matches, nil
+}
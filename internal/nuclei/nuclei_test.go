@@ -0,0 +1,42 @@
+package nuclei
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseJSONL(t *testing.T) {
+	output := `[INF] Using Nuclei Engine 3.3.0
+{"template-id":"hikvision-detect","info":{"name":"Hikvision Detect","severity":"info","tags":["tech","hikvision","iot"]},"matched-at":"http://10.0.0.5/doc/page/login.asp","extracted-results":["V5.4.5"]}
+{"template-id":"CVE-2017-7921","info":{"name":"Hikvision - Authentication Bypass","severity":"CRITICAL","tags":"cve,cve2017,hikvision,auth-bypass","classification":{"cve-id":["cve-2017-7921"]}},"matched-at":"http://10.0.0.5/Security/users?auth=YWRtaW46MTEK"}
+{"broken json
+`
+	matches, err := ParseJSONL(strings.NewReader(output))
+	if err != nil {
+		t.Fatalf("ParseJSONL: %v", err)
+	}
+	if len(matches) != 2 {
+		t.Fatalf("ParseJSONL returned %d matches, expected 2: %+v", len(matches), matches)
+	}
+
+	detect := matches[0]
+	if detect.TemplateID != "hikvision-detect" || !slices.Contains(detect.Tags, "hikvision") || !slices.Equal(detect.Extracted, []string{"V5.4.5"}) {
+		t.Errorf("detect match = %+v", detect)
+	}
+	bypass := matches[1]
+	if bypass.Severity != "critical" || !slices.Equal(bypass.CVEs, []string{"CVE-2017-7921"}) || !slices.Contains(bypass.Tags, "auth-bypass") {
+		t.Errorf("CVE match = %+v, expected critical CVE-2017-7921 with tags from a string", bypass)
+	}
+}
+
+func TestRunMissingBinary(t *testing.T) {
+	r := Runner{Binary: "cctvscan-no-such-nuclei"}
+	_, err := r.Run(context.Background(), []string{"http://127.0.0.1/"})
+	if !errors.Is(err, exec.ErrNotFound) {
+		t.Errorf("Run with a missing binary = %v, expected exec.ErrNotFound", err)
+	}
+}
@@ -0,0 +1,172 @@
+package portscan
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+
+	"github.com/projectdiscovery/goflags"
+	"github.com/projectdiscovery/naabu/v2/pkg/result"
+	"github.com/projectdiscovery/naabu/v2/pkg/runner"
+)
+
+// DiscoverHosts runs a liveness sweep before port scanning and returns the responsive
+// targets. Targets on a directly attached subnet are probed with ARP, routed targets with
+// ICMP echo. Host discovery needs raw sockets, so it requires root privileges.
+func DiscoverHosts(ctx context.Context, cfg HybridConfig, targets []string) ([]string, error) {
+	if len(targets) == 0 {
+		return nil, nil
+	}
+
+	local, routed := splitLocalTargets(targets, localNetworks())
+	if cfg.Debug {
+		log.Printf("DEBUG: Host discovery: %d local (ARP), %d routed (ICMP) targets", len(local), len(routed))
+	}
+
+	scanner := NewNaabuScanner(cfg.naabuConfig())
+	alive := make(map[string]bool)
+
+	if len(local) > 0 {
+		hosts, err := scanner.discover(ctx, local, true)
+		if err != nil {
+			return nil, fmt.Errorf("ARP discovery failed: %w", err)
+		}
+		for _, host := range hosts {
+			alive[host] = true
+		}
+	}
+
+	if len(routed) > 0 {
+		hosts, err := scanner.discover(ctx, routed, false)
+		if err != nil {
+			return nil, fmt.Errorf("ICMP discovery failed: %w", err)
+		}
+		for _, host := range hosts {
+			alive[host] = true
+		}
+	}
+
+	return liveTargets(ctx, targets, alive), nil
+}
+
+// liveTargets returns the targets with at least one responding address, in their
+// original order. naabu reports IPs, so hostnames are resolved and IP spellings are
+// normalized before they are matched against the responding hosts.
+func liveTargets(ctx context.Context, targets []string, alive map[string]bool) []string {
+	var live []string
+	for _, target := range targets {
+		for _, addr := range targetAddrs(ctx, target) {
+			if alive[addr] {
+				live = append(live, target)
+				break
+			}
+		}
+	}
+	return live
+}
+
+// targetAddrs returns the normalized IP addresses a target stands for
+func targetAddrs(ctx context.Context, target string) []string {
+	host := normalizeHost(target)
+	if net.ParseIP(host) != nil {
+		return []string{host}
+	}
+	addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		return nil
+	}
+	for i, addr := range addrs {
+		addrs[i] = normalizeHost(addr)
+	}
+	return addrs
+}
+
+// discover runs a naabu host-discovery-only pass using ARP or ICMP echo probes
+func (s *NaabuScanner) discover(ctx context.Context, targets []string, arp bool) ([]string, error) {
+	options := &runner.Options{
+		Host:                 goflags.StringSlice(targets),
+		Rate:                 s.cfg.Rate,
+		Retries:              s.cfg.Retry,
+		ScanType:             runner.SynScan,
+		SourceIP:             s.cfg.AdapterIP,
+		Interface:            s.cfg.Adapter,
+		OnlyHostDiscovery:    true,
+		WithHostDiscovery:    true,
+		ArpPing:              arp,
+		IcmpEchoRequestProbe: !arp,
+		IPVersion:            goflags.StringSlice(ipVersionsFor(targets)),
+		Silent:               !s.cfg.Debug,
+		Verbose:              s.cfg.Debug,
+		Debug:                s.cfg.Debug,
+	}
+
+	var hosts []string
+	var mu sync.Mutex
+	options.OnResult = func(hostResult *result.HostResult) {
+		if hostResult.IP != "" {
+			mu.Lock()
+			hosts = append(hosts, normalizeHost(hostResult.IP))
+			mu.Unlock()
+		}
+	}
+
+	naabuRunner, err := runner.NewRunner(options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create naabu runner: %w", err)
+	}
+	defer naabuRunner.Close()
+
+	if err := naabuRunner.RunEnumeration(ctx); err != nil {
+		return nil, err
+	}
+	return hosts, nil
+}
+
+// splitLocalTargets separates targets reachable on an attached subnet from routed ones
+func splitLocalTargets(targets []string, localNets []*net.IPNet) (local, routed []string) {
+	for _, target := range targets {
+		ip := net.ParseIP(target)
+		isLocal := false
+		if ip != nil && !ip.IsLoopback() {
+			for _, ipNet := range localNets {
+				if ipNet.Contains(ip) {
+					isLocal = true
+					break
+				}
+			}
+		}
+		if isLocal {
+			local = append(local, target)
+		} else {
+			routed = append(routed, target)
+		}
+	}
+	return local, routed
+}
+
+// localNetworks returns the subnets of all up, non-loopback interfaces
+func localNetworks() []*net.IPNet {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+
+	var nets []*net.IPNet
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok {
+				nets = append(nets, ipNet)
+			}
+		}
+	}
+	return nets
+}
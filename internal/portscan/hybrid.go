@@ -4,8 +4,13 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"os/exec"
 	"strings"
 	"sync"
+	"time"
+
+	"github.com/postfix/cctvscan/internal/control"
+	"github.com/postfix/cctvscan/internal/util"
 )
 
 // Shared localhost detection to avoid duplicate work
@@ -16,80 +21,159 @@ var (
 
 // HybridConfig holds configuration for the hybrid scanner
 type HybridConfig struct {
-	Ports     string
-	Rate      int
-	Retry     int
-	Wait      int
-	Adapter   string
-	AdapterIP string
-	ExtraArgs []string
-	Debug     bool
+	Ports        string
+	Rate         int
+	Retry        int
+	Wait         int // Seconds to wait for late replies after the last probe is sent
+	MasscanWait  int // Overrides Wait for masscan when > 0
+	NaabuWait    int // Overrides Wait for naabu when > 0
+	Adapter      string
+	AdapterIP    string
+	SourcePort   string
+	SubnetRate   int           // Max packets per second per destination subnet (0 = unlimited)
+	SubnetPrefix int           // IPv4 prefix length used to group targets for SubnetRate
+	HostTimeout  time.Duration // Per-host budget for follow-up checks (0 = no limit)
+	SCTPPorts    string        // Ports to probe with SCTP INIT via ScanSCTP (optional)
+	Discovery    string        // Registered scanner used for discovery (default "masscan")
+	Verification string        // Registered scanner used for verification (default "naabu")
+	ExtraArgs    []string
+	OnProgress   ProgressFunc  // Receives live progress updates (optional)
+	Gate         *control.Gate // Pauses and resumes scanning at runtime (optional)
+	Debug        bool
+}
+
+// masscanConfig derives the masscan backend configuration
+func (c HybridConfig) masscanConfig() MasscanConfig {
+	return MasscanConfig{
+		Ports:        c.Ports,
+		Rate:         c.Rate,
+		Wait:         waitOverride(c.MasscanWait, c.Wait),
+		Adapter:      c.Adapter,
+		AdapterIP:    c.AdapterIP,
+		SourcePort:   c.SourcePort,
+		SubnetRate:   c.SubnetRate,
+		SubnetPrefix: c.SubnetPrefix,
+		OnProgress:   c.OnProgress,
+		Gate:         c.Gate,
+		Debug:        c.Debug,
+	}
 }
 
-// HybridScanner combines masscan for discovery and naabu for verification
+// naabuConfig derives the naabu backend configuration
+func (c HybridConfig) naabuConfig() NaabuConfig {
+	return NaabuConfig{
+		Ports:        c.Ports,
+		Rate:         c.Rate,
+		Retry:        c.Retry,
+		Wait:         waitOverride(c.NaabuWait, c.Wait),
+		Adapter:      c.Adapter,
+		AdapterIP:    c.AdapterIP,
+		SourcePort:   c.SourcePort,
+		SubnetRate:   c.SubnetRate,
+		SubnetPrefix: c.SubnetPrefix,
+		ExtraArgs:    c.ExtraArgs,
+		OnProgress:   c.OnProgress,
+		Gate:         c.Gate,
+		Debug:        c.Debug,
+	}
+}
+
+// waitOverride returns the backend-specific wait window if set, otherwise the shared one
+func waitOverride(backend, shared int) int {
+	if backend > 0 {
+		return backend
+	}
+	return shared
+}
+
+// HybridScanner combines a fast discovery backend (masscan) with a verification backend (naabu)
 type HybridScanner struct {
-	cfg HybridConfig
+	cfg   HybridConfig
+	stats Stats // Statistics of the most recent scan
 }
 
 // NewHybridScanner creates a new hybrid scanner instance
 func NewHybridScanner(cfg HybridConfig) *HybridScanner {
+	if cfg.Discovery == "" {
+		cfg.Discovery = "masscan"
+	}
+	if cfg.Verification == "" {
+		cfg.Verification = "naabu"
+	}
 	return &HybridScanner{cfg: cfg}
 }
 
-// Scan performs hybrid scanning: masscan discovery + naabu verification
-func (s *HybridScanner) Scan(ctx context.Context, targets []string) (map[string][]int, error) {
-	if len(targets) == 0 {
-		return map[string][]int{}, nil
+// Name returns the registry name of the scanner
+func (s *HybridScanner) Name() string { return "hybrid" }
+
+// Validate checks that both the discovery and verification backends are usable
+func (s *HybridScanner) Validate() error {
+	for _, name := range []string{s.cfg.Discovery, s.cfg.Verification} {
+		backend, err := s.backend(name, s.cfg)
+		if err != nil {
+			return err
+		}
+		if err := backend.Validate(); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
 	}
+	return nil
+}
+
+// Stats returns per-phase statistics for the most recent scan
+func (s *HybridScanner) Stats() Stats { return s.stats }
 
-	// Check if we have localhost targets
-	hasLocalhost := s.hasLocalhostTargets(targets)
+// Scan performs hybrid scanning and returns the open ports per host
+func (s *HybridScanner) Scan(ctx context.Context, targets []string) (map[string][]int, error) {
+	results, err := s.ScanResults(ctx, targets)
+	if err != nil {
+		return nil, err
+	}
+	return results.Open(), nil
+}
 
-	var discoveredPorts map[string][]int
-	var err error
+// ScanResults performs hybrid scanning: discovery followed by verification.
+// Ports found during discovery but not confirmed by verification are classified
+// as closed or filtered.
+func (s *HybridScanner) ScanResults(ctx context.Context, targets []string) (Results, error) {
+	s.stats = Stats{}
+	if len(targets) == 0 {
+		return Results{}, nil
+	}
 
-	if hasLocalhost {
-		// For localhost targets, use naabu only
+	// Localhost targets can't be SYN scanned by masscan, so use naabu for discovery
+	discoveryName := s.cfg.Discovery
+	if s.hasLocalhostTargets(targets) {
+		discoveryName = "naabu"
 		if s.cfg.Debug {
 			log.Printf("DEBUG: Detected localhost targets, using naabu for discovery")
 		}
+	} else if s.cfg.Debug {
+		log.Printf("DEBUG: Using %s for external target discovery", discoveryName)
+	}
 
-		naabuCfg := NaabuConfig{
-			Ports:     s.cfg.Ports,
-			Rate:      s.cfg.Rate,
-			Retry:     s.cfg.Retry,
-			Wait:      s.cfg.Wait,
-			Adapter:   s.cfg.Adapter,
-			AdapterIP: s.cfg.AdapterIP,
-			ExtraArgs: s.cfg.ExtraArgs,
-			Debug:     s.cfg.Debug,
-		}
-
-		naabuScanner := NewNaabuScanner(naabuCfg)
-		discoveredPorts, err = naabuScanner.Scan(ctx, targets)
-		if err != nil {
-			return nil, fmt.Errorf("naabu discovery failed: %w", err)
-		}
-	} else {
-		// For external targets, use masscan for discovery
-		if s.cfg.Debug {
-			log.Printf("DEBUG: Using masscan for external target discovery")
-		}
+	discovery, err := s.backend(discoveryName, s.cfg)
+	if err != nil {
+		return nil, err
+	}
 
-		masscanCfg := MasscanConfig{
-			Ports:     s.cfg.Ports,
-			Rate:      s.cfg.Rate,
-			Adapter:   s.cfg.Adapter,
-			AdapterIP: s.cfg.AdapterIP,
-			Debug:     s.cfg.Debug,
+	// Fall back to naabu when masscan isn't installed; the full health check is
+	// left to Validate, as running it on every scan would be slow and noisy
+	if discovery.Name() == "masscan" {
+		if _, err := exec.LookPath("masscan"); err != nil {
+			log.Printf("WARNING: masscan is not installed, falling back to naabu for discovery")
+			if discovery, err = s.backend("naabu", s.cfg); err != nil {
+				return nil, err
+			}
 		}
+	}
 
-		masscanScanner := NewMasscanScanner(masscanCfg)
-		discoveredPorts, err = masscanScanner.Scan(ctx, targets)
-		if err != nil {
-			return nil, fmt.Errorf("masscan discovery failed: %w", err)
-		}
+	discoveredPorts, err := discovery.Scan(ctx, targets)
+	if err != nil {
+		return nil, fmt.Errorf("%s discovery failed: %w", discovery.Name(), err)
 	}
+	s.recordPhase("discovery", discovery)
+	s.stats.PortsDiscovered = countFound(discoveredPorts)
 
 	if s.cfg.Debug {
 		log.Printf("DEBUG: Discovery phase found %d hosts with ports", len(discoveredPorts))
@@ -97,36 +181,78 @@ func (s *HybridScanner) Scan(ctx context.Context, targets []string) (map[string]
 
 	// If no ports discovered, return empty results
 	if len(discoveredPorts) == 0 {
-		return discoveredPorts, nil
+		return Results{}, nil
 	}
 
-	// Step 2: Use naabu for verification of discovered ports
-	naabuCfg := NaabuConfig{
-		Ports:     s.cfg.Ports,
-		Rate:      s.cfg.Rate / 2, // Slower rate for verification
-		Retry:     s.cfg.Retry,
-		Wait:      s.cfg.Wait,
-		Adapter:   s.cfg.Adapter,
-		AdapterIP: s.cfg.AdapterIP,
-		ExtraArgs: s.cfg.ExtraArgs,
-		Debug:     s.cfg.Debug,
+	// Step 2: Verify discovered ports with the verification backend
+	verifyCfg := s.cfg
+	verifyCfg.Rate = s.cfg.Rate / 2 // Slower rate for verification
+	verification, err := s.backend(s.cfg.Verification, verifyCfg)
+	if err != nil {
+		return nil, err
 	}
 
-	naabuScanner := NewNaabuScanner(naabuCfg)
-	verifiedPorts, err := naabuScanner.VerifyPorts(ctx, discoveredPorts)
+	verifier, ok := verification.(Verifier)
+	if !ok {
+		if s.cfg.Debug {
+			log.Printf("DEBUG: Scanner %s cannot verify ports, using discovery results", verification.Name())
+		}
+		return openResults(discoveredPorts), nil
+	}
+
+	verifiedPorts, err := verifier.VerifyPorts(ctx, discoveredPorts)
+	s.recordPhase("verification", verification)
 	if err != nil {
 		if s.cfg.Debug {
-			log.Printf("DEBUG: Naabu verification failed, using discovery results: %v", err)
+			log.Printf("DEBUG: %s verification failed, using discovery results: %v", verification.Name(), err)
 		}
-		// Fallback to discovery results if naabu verification fails
-		return discoveredPorts, nil
+		// Fallback to discovery results if verification fails
+		return openResults(discoveredPorts), nil
 	}
 
 	if s.cfg.Debug {
 		log.Printf("DEBUG: Verification phase confirmed %d hosts with ports", len(verifiedPorts))
 	}
+	// Ports verification found that discovery missed are open as well, but only
+	// the ones discovery reported count towards the drop rate
+	for host, ports := range verifiedPorts {
+		for _, p := range ports {
+			if util.PortIn(discoveredPorts[host], p) {
+				s.stats.PortsConfirmed++
+			} else {
+				discoveredPorts[host] = append(discoveredPorts[host], p)
+			}
+		}
+	}
+
+	// Step 3: Tell closed from filtered for ports verification dropped
+	start := time.Now()
+	results, connects := classifyUnverified(ctx, discoveredPorts, verifiedPorts, s.cfg.HostTimeout)
+	if s.stats.dropped() > 0 {
+		s.stats.Phases = append(s.stats.Phases, classifyStats(start, results, verifiedPorts, connects))
+	}
 
-	return verifiedPorts, nil
+	return results, nil
+}
+
+// recordPhase appends a backend's statistics, if it collects any, under the given phase name
+func (s *HybridScanner) recordPhase(phase string, backend Scanner) {
+	reporter, ok := backend.(StatsReporter)
+	if !ok {
+		return
+	}
+	for _, p := range reporter.Stats().Phases {
+		p.Phase = phase
+		s.stats.Phases = append(s.stats.Phases, p)
+	}
+}
+
+// backend builds a registered scanner for one of the hybrid phases
+func (s *HybridScanner) backend(name string, cfg HybridConfig) (Scanner, error) {
+	if strings.EqualFold(name, s.Name()) {
+		return nil, fmt.Errorf("hybrid scanner cannot use itself as a backend")
+	}
+	return New(name, cfg)
 }
 
 // hasLocalhostTargets checks if any targets are localhost addresses with caching
@@ -144,7 +270,7 @@ func (s *HybridScanner) hasLocalhostTargets(targets []string) bool {
 		localhostMutex.RUnlock()
 
 		// Check if localhost and cache result
-		isLocalhost := target == "127.0.0.1" || target == "localhost" || strings.HasPrefix(target, "127.")
+		isLocalhost := isLocalhostTarget(target)
 
 		localhostMutex.Lock()
 		localhostCache[target] = isLocalhost
@@ -0,0 +1,131 @@
+package portscan
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// internetDBURL is Shodan's free, keyless per-IP lookup endpoint
+const internetDBURL = "https://internetdb.shodan.io"
+
+// internetDBConcurrency bounds parallel lookups to stay within InternetDB's rate limits
+const internetDBConcurrency = 5
+
+// internetDBHost is the subset of an InternetDB response that we use
+type internetDBHost struct {
+	IP    string `json:"ip"`
+	Ports []int  `json:"ports"`
+}
+
+// InternetDBScanner is a passive scanner that reads open ports from Shodan InternetDB
+// instead of sending any packets to the targets
+type InternetDBScanner struct {
+	baseURL     string
+	client      *http.Client
+	hostTimeout time.Duration
+	debug       bool
+}
+
+// NewInternetDBScanner creates a new passive InternetDB scanner instance.
+// hostTimeout bounds each per-IP lookup (0 = no limit).
+func NewInternetDBScanner(hostTimeout time.Duration, debug bool) *InternetDBScanner {
+	return &InternetDBScanner{
+		baseURL:     internetDBURL,
+		client:      &http.Client{Timeout: 10 * time.Second},
+		hostTimeout: hostTimeout,
+		debug:       debug,
+	}
+}
+
+// Name returns the registry name of the scanner
+func (s *InternetDBScanner) Name() string { return "internetdb" }
+
+// Validate always succeeds; InternetDB needs no key or local binaries
+func (s *InternetDBScanner) Validate() error { return nil }
+
+// Scan looks up every target in InternetDB and returns the ports Shodan has seen open.
+// Targets without data are omitted; lookup failures are logged and skipped.
+func (s *InternetDBScanner) Scan(ctx context.Context, targets []string) (map[string][]int, error) {
+	results := make(map[string][]int)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, internetDBConcurrency)
+
+	for _, target := range targets {
+		wg.Add(1)
+		go func(ip string) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			lookupCtx, cancel := s.lookupContext(ctx)
+			defer cancel()
+
+			ports, err := s.lookup(lookupCtx, ip)
+			if err != nil {
+				log.Printf("WARNING: InternetDB lookup for %s failed: %v", ip, err)
+				return
+			}
+			if len(ports) == 0 {
+				return
+			}
+			mu.Lock()
+			results[ip] = ports
+			mu.Unlock()
+		}(target)
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return results, err
+	}
+	if s.debug {
+		log.Printf("DEBUG: InternetDB reported ports for %d of %d targets", len(results), len(targets))
+	}
+	return results, nil
+}
+
+// lookupContext applies the per-host budget to a single lookup
+func (s *InternetDBScanner) lookupContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.hostTimeout > 0 {
+		return context.WithTimeout(ctx, s.hostTimeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// lookup fetches the ports InternetDB knows for a single IP; unknown IPs return nil
+func (s *InternetDBScanner) lookup(ctx context.Context, ip string) ([]int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.baseURL+"/"+ip, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		// "No information available" for this IP
+		return nil, nil
+	default:
+		io.Copy(io.Discard, resp.Body)
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	var host internetDBHost
+	if err := json.NewDecoder(resp.Body).Decode(&host); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	sort.Ints(host.Ports)
+	return host.Ports, nil
+}
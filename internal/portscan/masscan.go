@@ -6,22 +6,32 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"net"
 	"os"
 	"os/exec"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/postfix/cctvscan/internal/control"
 	"github.com/postfix/cctvscan/internal/probe"
 )
 
 // MasscanConfig holds configuration for masscan scanning
 type MasscanConfig struct {
-	Ports     string
-	Rate      int
-	Adapter   string
-	AdapterIP string
-	Debug     bool
+	Ports        string
+	Rate         int
+	Wait         int // Seconds to wait for late replies (masscan --wait)
+	Adapter      string
+	AdapterIP    string
+	SourcePort   string
+	SubnetRate   int           // Max packets per second per destination subnet (0 = unlimited)
+	SubnetPrefix int           // IPv4 prefix length used to group targets for SubnetRate
+	Protocol     string        // Transport to probe: ProtoTCP (default) or ProtoSCTP
+	OnProgress   ProgressFunc  // Receives live progress updates (optional)
+	Gate         *control.Gate // Pauses masscan with SIGSTOP/SIGCONT (optional)
+	Debug        bool
 }
 
 // MasscanScanner uses masscan for high-speed SYN scanning
@@ -29,6 +39,7 @@ type MasscanScanner struct {
 	cfg        MasscanConfig
 	portCache  map[string]string // Cache for port strings to avoid repeated generation
 	cacheMutex sync.RWMutex
+	stats      PhaseStats // Statistics of the most recent scan
 }
 
 // NewMasscanScanner creates a new masscan scanner instance
@@ -39,8 +50,20 @@ func NewMasscanScanner(cfg MasscanConfig) *MasscanScanner {
 	}
 }
 
+// Name returns the registry name of the scanner
+func (s *MasscanScanner) Name() string { return "masscan" }
+
+// Validate checks that the masscan binary is installed and usable
+func (s *MasscanScanner) Validate() error { return ValidateMasscanInstallation() }
+
+// Stats returns statistics for the most recent scan
+func (s *MasscanScanner) Stats() Stats {
+	return Stats{Phases: []PhaseStats{s.stats}}
+}
+
 // Scan performs masscan discovery for the given targets
 func (s *MasscanScanner) Scan(ctx context.Context, targets []string) (map[string][]int, error) {
+	s.stats = PhaseStats{}
 	if len(targets) == 0 {
 		return map[string][]int{}, nil
 	}
@@ -62,11 +85,22 @@ func (s *MasscanScanner) Scan(ctx context.Context, targets []string) (map[string
 		log.Printf("DEBUG: Using ports: %s", portsToScan)
 	}
 
+	// Cap the global rate so no single subnet is hammered
+	rate := SubnetRate(targets, s.cfg.Rate, s.cfg.SubnetRate, s.cfg.SubnetPrefix)
+	if s.cfg.Debug && rate != s.cfg.Rate {
+		log.Printf("DEBUG: Per-subnet limit of %d pps reduces masscan rate to %d", s.cfg.SubnetRate, rate)
+	}
+
 	// Build masscan command
 	args := []string{
-		"--rate", strconv.Itoa(s.cfg.Rate),
+		"--rate", strconv.Itoa(rate),
 		"--open-only",
-		"-p", portsToScan,
+		"-p", masscanPortArg(portsToScan, s.protocol()),
+	}
+
+	// Late-reply window after the last packet is sent
+	if s.cfg.Wait >= 0 {
+		args = append(args, "--wait", strconv.Itoa(s.cfg.Wait))
 	}
 
 	// Add interface if specified
@@ -79,6 +113,11 @@ func (s *MasscanScanner) Scan(ctx context.Context, targets []string) (map[string
 		args = append(args, "--source-ip", s.cfg.AdapterIP)
 	}
 
+	// Add source port (single port or power-of-two range) if specified
+	if s.cfg.SourcePort != "" {
+		args = append(args, "--source-port", s.cfg.SourcePort)
+	}
+
 	// Add targets
 	args = append(args, targets...)
 
@@ -88,19 +127,55 @@ func (s *MasscanScanner) Scan(ctx context.Context, targets []string) (map[string
 
 	// Execute masscan
 	cmd := exec.CommandContext(ctx, "masscan", args...)
-	cmd.Stderr = os.Stderr
 
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
 		return nil, fmt.Errorf("failed to create stdout pipe: %w", err)
 	}
 
+	// Masscan reports its status on stderr; parse it when progress is requested
+	var stderr io.ReadCloser
+	if s.cfg.OnProgress != nil {
+		if stderr, err = cmd.StderrPipe(); err != nil {
+			return nil, fmt.Errorf("failed to create stderr pipe: %w", err)
+		}
+	} else {
+		cmd.Stderr = os.Stderr
+	}
+
+	// Don't launch a new masscan run while the scan is paused
+	if err := s.cfg.Gate.Wait(ctx); err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
 	if err := cmd.Start(); err != nil {
 		return nil, fmt.Errorf("failed to start masscan: %w", err)
 	}
 
+	// Suspend the running process in place so its scan state survives a pause
+	suspend := func(paused bool) {
+		if err := control.SuspendProcess(cmd.Process, paused); err != nil && s.cfg.Debug {
+			log.Printf("DEBUG: Failed to signal masscan: %v", err)
+		}
+	}
+	defer s.cfg.Gate.OnChange(suspend)()
+	if s.cfg.Gate.Paused() {
+		suspend(true) // Paused between Wait and OnChange
+	}
+
+	var statusWg sync.WaitGroup
+	if stderr != nil {
+		statusWg.Add(1)
+		go func() {
+			defer statusWg.Done()
+			readMasscanStatus(stderr, os.Stderr, len(targets), start, s.cfg.OnProgress)
+		}()
+	}
+
 	// Parse masscan output with optimized parsing
 	results := s.parseMasscanOutput(stdout)
+	statusWg.Wait()
 
 	if err := cmd.Wait(); err != nil {
 		return nil, fmt.Errorf("masscan execution failed: %w", err)
@@ -110,11 +185,25 @@ func (s *MasscanScanner) Scan(ctx context.Context, targets []string) (map[string
 		log.Printf("DEBUG: Masscan discovered %d hosts with ports", len(results))
 	}
 
+	// Masscan sends a single probe per target port unless --retries is given
+	s.stats = newPhaseStats(s.Name(), start, len(targets), countPorts(portsToScan), 1, results)
+
 	return results, nil
 }
 
+// protocol returns the transport being scanned, defaulting to TCP
+func (s *MasscanScanner) protocol() string {
+	if s.cfg.Protocol == "" {
+		return ProtoTCP
+	}
+	return s.cfg.Protocol
+}
+
 // getPortsToScan returns the ports to scan with caching
 func (s *MasscanScanner) getPortsToScan() string {
+	if s.protocol() != ProtoTCP {
+		return s.cfg.Ports
+	}
 	if s.cfg.Ports == "0-65535" || s.cfg.Ports == "" {
 		s.cacheMutex.RLock()
 		if cached, exists := s.portCache["cctv"]; exists {
@@ -192,7 +281,8 @@ func (s *MasscanScanner) parseMasscanOutput(stdout io.ReadCloser) map[string][]i
 	return results
 }
 
-// parseDiscoveredPort parses "Discovered open port 80/tcp on 192.168.1.1" format
+// parseDiscoveredPort parses "Discovered open port 80/tcp on 192.168.1.1" format,
+// matching the transport being scanned ("2905/sctp" for SCTP)
 func (s *MasscanScanner) parseDiscoveredPort(line string) (int, string) {
 	// Find the port part (after "Discovered open port ")
 	start := len("Discovered open port ")
@@ -201,7 +291,7 @@ func (s *MasscanScanner) parseDiscoveredPort(line string) (int, string) {
 	}
 
 	// Find the port number before "/tcp"
-	slashPos := strings.Index(line[start:], "/tcp")
+	slashPos := strings.Index(line[start:], "/"+s.protocol())
 	if slashPos == -1 {
 		return 0, ""
 	}
@@ -218,14 +308,14 @@ func (s *MasscanScanner) parseDiscoveredPort(line string) (int, string) {
 		return 0, ""
 	}
 
-	host := line[onPos+4:]
+	host := normalizeHost(line[onPos+4:])
 	return port, host
 }
 
 // parseOldFormat parses "open tcp 80 192.168.1.1 1234567890" format
 func (s *MasscanScanner) parseOldFormat(line string) (int, string) {
 	parts := strings.Fields(line)
-	if len(parts) < 4 || parts[0] != "open" || parts[1] != "tcp" {
+	if len(parts) < 4 || parts[0] != "open" || parts[1] != s.protocol() {
 		return 0, ""
 	}
 
@@ -234,26 +324,60 @@ func (s *MasscanScanner) parseOldFormat(line string) (int, string) {
 		return 0, ""
 	}
 
-	return port, parts[3]
+	return port, normalizeHost(parts[3])
 }
 
 // hasLocalhostTargets checks if any targets are localhost addresses
 func (s *MasscanScanner) hasLocalhostTargets(targets []string) bool {
 	for _, target := range targets {
-		if target == "127.0.0.1" || target == "localhost" || strings.HasPrefix(target, "127.") {
+		if isLocalhostTarget(target) {
 			return true
 		}
 	}
 	return false
 }
 
+// isLocalhostTarget reports whether a target is an IPv4 or IPv6 loopback address
+func isLocalhostTarget(target string) bool {
+	if target == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(strings.Trim(target, "[]"))
+	return ip != nil && ip.IsLoopback()
+}
+
+// hasIPv6Targets checks if any targets are IPv6 addresses or ranges
+func hasIPv6Targets(targets []string) bool {
+	for _, target := range targets {
+		if strings.Contains(target, ":") {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeHost returns the canonical form of an IP address reported by a scanner,
+// so IPv6 results from different backends and formats share the same map key
+func normalizeHost(host string) string {
+	host = strings.Trim(strings.TrimSpace(host), "[]")
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.String()
+	}
+	return host
+}
+
 // GetCCTVPorts returns the specialized CCTV camera ports for masscan
 func GetCCTVPorts() string {
 	return probe.CameraPortsString()
 }
 
-// ValidateMasscanInstallation checks if masscan is installed and accessible
+// ValidateMasscanInstallation checks if masscan is installed and accessible.
+// A missing binary is reported as an error wrapping exec.ErrNotFound.
 func ValidateMasscanInstallation() error {
+	if _, err := exec.LookPath("masscan"); err != nil {
+		return fmt.Errorf("masscan not found: %w", err)
+	}
+
 	cmd := exec.Command("masscan", "--version")
 	output, err := cmd.Output()
 	if err != nil {
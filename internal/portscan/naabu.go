@@ -13,23 +13,31 @@ import (
 	"github.com/projectdiscovery/goflags"
 	"github.com/projectdiscovery/naabu/v2/pkg/result"
 	"github.com/projectdiscovery/naabu/v2/pkg/runner"
+
+	"github.com/postfix/cctvscan/internal/control"
 )
 
 // NaabuConfig holds configuration for naabu scanning
 type NaabuConfig struct {
-	Ports     string
-	Rate      int
-	Retry     int
-	Wait      int
-	Adapter   string
-	AdapterIP string
-	ExtraArgs []string
-	Debug     bool
+	Ports        string
+	Rate         int
+	Retry        int
+	Wait         int // Seconds to wait for late replies after each scan phase
+	Adapter      string
+	AdapterIP    string
+	SourcePort   string
+	SubnetRate   int // Max packets per second per destination subnet (0 = unlimited)
+	SubnetPrefix int // IPv4 prefix length used to group targets for SubnetRate
+	ExtraArgs    []string
+	OnProgress   ProgressFunc  // Receives live progress updates (optional)
+	Gate         *control.Gate // Holds back new naabu runs while paused (optional)
+	Debug        bool
 }
 
 // NaabuScanner uses naabu for port verification and localhost scanning
 type NaabuScanner struct {
-	cfg NaabuConfig
+	cfg   NaabuConfig
+	stats PhaseStats // Statistics of the most recent scan
 }
 
 // NewNaabuScanner creates a new naabu scanner instance
@@ -37,8 +45,20 @@ func NewNaabuScanner(cfg NaabuConfig) *NaabuScanner {
 	return &NaabuScanner{cfg: cfg}
 }
 
+// Name returns the registry name of the scanner
+func (s *NaabuScanner) Name() string { return "naabu" }
+
+// Validate checks that naabu can be initialized on this system
+func (s *NaabuScanner) Validate() error { return ValidateNaabuInstallation() }
+
+// Stats returns statistics for the most recent scan
+func (s *NaabuScanner) Stats() Stats {
+	return Stats{Phases: []PhaseStats{s.stats}}
+}
+
 // Scan performs naabu scanning for the given targets
 func (s *NaabuScanner) Scan(ctx context.Context, targets []string) (map[string][]int, error) {
+	s.stats = PhaseStats{}
 	if len(targets) == 0 {
 		return map[string][]int{}, nil
 	}
@@ -53,18 +73,27 @@ func (s *NaabuScanner) Scan(ctx context.Context, targets []string) (map[string][
 		log.Printf("DEBUG: Using naabu scan type: %s (running as root: %v)", scanType, os.Geteuid() == 0)
 	}
 
+	// Cap the global rate so no single subnet is hammered
+	rate := SubnetRate(targets, s.cfg.Rate, s.cfg.SubnetRate, s.cfg.SubnetPrefix)
+	if s.cfg.Debug && rate != s.cfg.Rate {
+		log.Printf("DEBUG: Per-subnet limit of %d pps reduces naabu rate to %d", s.cfg.SubnetRate, rate)
+	}
+
 	options := &runner.Options{
-		Host:      goflags.StringSlice(targets),
-		Ports:     s.cfg.Ports,
-		Rate:      s.cfg.Rate,
-		Retries:   s.cfg.Retry,
-		ScanType:  scanType,
-		SourceIP:  s.cfg.AdapterIP,
-		Interface: s.cfg.Adapter,
-		Silent:    !s.cfg.Debug,
-		Verbose:   s.cfg.Debug,
-		Debug:     s.cfg.Debug,
-		Timeout:   5 * time.Second, // Add timeout to prevent hanging
+		Host:       goflags.StringSlice(targets),
+		Ports:      s.cfg.Ports,
+		Rate:       rate,
+		Retries:    s.cfg.Retry,
+		ScanType:   scanType,
+		SourceIP:   s.cfg.AdapterIP,
+		SourcePort: naabuSourcePort(s.cfg.SourcePort),
+		Interface:  s.cfg.Adapter,
+		Silent:     !s.cfg.Debug,
+		Verbose:    s.cfg.Debug,
+		Debug:      s.cfg.Debug,
+		Timeout:    5 * time.Second, // Add timeout to prevent hanging
+		WarmUpTime: s.cfg.Wait,      // Read window for late replies
+		IPVersion:  goflags.StringSlice(ipVersionsFor(targets)),
 	}
 
 	if s.cfg.Debug {
@@ -79,8 +108,9 @@ func (s *NaabuScanner) Scan(ctx context.Context, targets []string) (map[string][
 	options.OnResult = func(hostResult *result.HostResult) {
 		if hostResult.IP != "" && len(hostResult.Ports) > 0 {
 			mu.Lock()
+			host := normalizeHost(hostResult.IP)
 			for _, port := range hostResult.Ports {
-				results[hostResult.IP] = append(results[hostResult.IP], port.Port)
+				results[host] = append(results[host], port.Port)
 			}
 			mu.Unlock()
 		}
@@ -94,7 +124,20 @@ func (s *NaabuScanner) Scan(ctx context.Context, targets []string) (map[string][
 
 	defer naabuRunner.Close()
 
+	// naabu runs in-process and can't be suspended midway, so only new runs wait
+	if err := s.cfg.Gate.Wait(ctx); err != nil {
+		return nil, err
+	}
+
+	// Naabu has no status feed, so estimate progress from the configured rate
+	if s.cfg.OnProgress != nil {
+		progressCtx, stopProgress := context.WithCancel(ctx)
+		defer stopProgress()
+		go estimateProgress(progressCtx, s.Name(), len(targets), countPorts(s.cfg.Ports), rate, s.cfg.OnProgress)
+	}
+
 	// Execute the scan
+	start := time.Now()
 	if err := naabuRunner.RunEnumeration(ctx); err != nil {
 		return nil, fmt.Errorf("naabu scan failed: %w", err)
 	}
@@ -103,6 +146,8 @@ func (s *NaabuScanner) Scan(ctx context.Context, targets []string) (map[string][
 		log.Printf("DEBUG: Naabu discovered %d hosts with ports", len(results))
 	}
 
+	s.stats = newPhaseStats(s.Name(), start, len(targets), countPorts(s.cfg.Ports), s.cfg.Retry, results)
+
 	return results, nil
 }
 
@@ -142,6 +187,7 @@ func (s *NaabuScanner) VerifyPorts(ctx context.Context, discoveredPorts map[stri
 
 	// Run naabu verification
 	verifiedPorts, err := naabuScanner.Scan(ctx, targets)
+	s.stats = naabuScanner.stats
 	if err != nil {
 		return nil, err
 	}
@@ -149,6 +195,14 @@ func (s *NaabuScanner) VerifyPorts(ctx context.Context, discoveredPorts map[stri
 	return verifiedPorts, nil
 }
 
+// ipVersionsFor returns the naabu IP versions needed to cover dual-stack targets
+func ipVersionsFor(targets []string) []string {
+	if hasIPv6Targets(targets) {
+		return []string{"4", "6"}
+	}
+	return []string{"4"}
+}
+
 // buildPortString converts a slice of ports to naabu-compatible string
 func buildPortString(ports []int) string {
 	if len(ports) == 0 {
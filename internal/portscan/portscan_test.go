@@ -1,7 +1,15 @@
 package portscan
 
 import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestGetCCTVPorts(t *testing.T) {
@@ -78,3 +86,369 @@ func containsInMiddle(s, substr string) bool {
 	}
 	return false
 }
+
+func TestResolveSourcePort(t *testing.T) {
+	tests := []struct {
+		spec     string
+		expected string
+		wantErr  bool
+	}{
+		{"", "", false},
+		{"53", "53", false},
+		{" 443 ", "443", false},
+		{"40000-40015", "40000-40015", false},
+		{"40000-40010", "", true},
+		{"0", "", true},
+		{"70000", "", true},
+		{"50-40", "", true},
+		{"abc", "", true},
+	}
+
+	for _, test := range tests {
+		result, err := ResolveSourcePort(test.spec)
+		if (err != nil) != test.wantErr {
+			t.Errorf("ResolveSourcePort(%q) error = %v, wantErr %v", test.spec, err, test.wantErr)
+			continue
+		}
+		if result != test.expected {
+			t.Errorf("ResolveSourcePort(%q) = %s, expected %s", test.spec, result, test.expected)
+		}
+	}
+
+	random, err := ResolveSourcePort("random")
+	if err != nil {
+		t.Fatalf("ResolveSourcePort(random) failed: %v", err)
+	}
+	if port, _ := parseSourcePort(random); port < ephemeralPortMin || port > ephemeralPortMax {
+		t.Errorf("random source port %s outside ephemeral range", random)
+	}
+}
+
+func TestNaabuSourcePort(t *testing.T) {
+	if got := naabuSourcePort("40000-40015"); got != "40000" {
+		t.Errorf("naabuSourcePort(range) = %s, expected 40000", got)
+	}
+	if got := naabuSourcePort("53"); got != "53" {
+		t.Errorf("naabuSourcePort(53) = %s, expected 53", got)
+	}
+}
+
+func TestSubnetRate(t *testing.T) {
+	spread := []string{"10.0.1.1", "10.0.2.1", "10.0.3.1", "10.0.4.1"}
+	packed := []string{"10.0.1.1", "10.0.1.2", "10.0.1.3", "10.0.2.1"}
+
+	tests := []struct {
+		name      string
+		targets   []string
+		rate      int
+		perSubnet int
+		prefix    int
+		expected  int
+	}{
+		{"disabled", spread, 1000, 0, 24, 1000},
+		{"spread under limit", spread, 1000, 500, 24, 1000},
+		{"spread over limit", spread, 1000, 100, 24, 400},
+		{"packed subnet dominates", packed, 1000, 300, 24, 400},
+		{"wider prefix groups all", packed, 1000, 300, 16, 300},
+		{"one pps per subnet", packed, 1000, 1, 16, 1},
+	}
+
+	for _, test := range tests {
+		result := SubnetRate(test.targets, test.rate, test.perSubnet, test.prefix)
+		if result != test.expected {
+			t.Errorf("%s: SubnetRate() = %d, expected %d", test.name, result, test.expected)
+		}
+	}
+}
+
+func TestScannerRegistry(t *testing.T) {
+	for _, name := range []string{"hybrid", "masscan", "naabu", "internetdb", "HYBRID"} {
+		scanner, err := New(name, HybridConfig{})
+		if err != nil {
+			t.Fatalf("New(%q) failed: %v", name, err)
+		}
+		if !strings.EqualFold(scanner.Name(), name) {
+			t.Errorf("New(%q).Name() = %s", name, scanner.Name())
+		}
+	}
+
+	if _, err := New("nmap", HybridConfig{}); err == nil {
+		t.Error("New(nmap) should fail for an unregistered scanner")
+	}
+
+	if _, ok := interface{}(NewNaabuScanner(NaabuConfig{})).(Verifier); !ok {
+		t.Error("NaabuScanner should implement Verifier")
+	}
+
+	hybrid := NewHybridScanner(HybridConfig{Discovery: "hybrid"})
+	if _, err := hybrid.backend(hybrid.cfg.Discovery, hybrid.cfg); err == nil {
+		t.Error("hybrid scanner should refuse itself as a backend")
+	}
+}
+
+func TestSplitLocalTargets(t *testing.T) {
+	_, lan, _ := net.ParseCIDR("192.168.1.0/24")
+	targets := []string{"192.168.1.10", "8.8.8.8", "192.168.2.1", "127.0.0.1", "192.168.1.254"}
+
+	local, routed := splitLocalTargets(targets, []*net.IPNet{lan})
+	if len(local) != 2 || local[0] != "192.168.1.10" || local[1] != "192.168.1.254" {
+		t.Errorf("local targets = %v, expected [192.168.1.10 192.168.1.254]", local)
+	}
+	if len(routed) != 3 {
+		t.Errorf("routed targets = %v, expected 3 entries", routed)
+	}
+}
+
+func TestLiveTargetsNormalizesAddresses(t *testing.T) {
+	alive := map[string]bool{"2001:db8::1": true, "127.0.0.1": true}
+	targets := []string{"2001:DB8:0::1", "192.0.2.1", "localhost"}
+
+	live := liveTargets(context.Background(), targets, alive)
+	if len(live) != 2 || live[0] != "2001:DB8:0::1" || live[1] != "localhost" {
+		t.Errorf("live targets = %v, expected [2001:DB8:0::1 localhost]", live)
+	}
+}
+
+func TestWaitOverride(t *testing.T) {
+	cfg := HybridConfig{Wait: 3, MasscanWait: 10}
+	if got := cfg.masscanConfig().Wait; got != 10 {
+		t.Errorf("masscan wait = %d, expected 10", got)
+	}
+	if got := cfg.naabuConfig().Wait; got != 3 {
+		t.Errorf("naabu wait = %d, expected shared wait 3", got)
+	}
+}
+
+// fakeScanner is a registry backend with canned results for orchestration tests
+type fakeScanner struct {
+	name    string
+	results map[string][]int
+	invalid error
+}
+
+func (f *fakeScanner) Name() string    { return f.name }
+func (f *fakeScanner) Validate() error { return f.invalid }
+func (f *fakeScanner) Scan(ctx context.Context, targets []string) (map[string][]int, error) {
+	return f.results, nil
+}
+
+func TestHybridFallsBackWhenDiscoveryMissing(t *testing.T) {
+	registryMutex.RLock()
+	originalNaabu := registry["naabu"]
+	registryMutex.RUnlock()
+	defer Register("naabu", originalNaabu)
+
+	naabuResults := map[string][]int{"192.0.2.1": {80}}
+	Register("naabu", func(cfg HybridConfig) Scanner {
+		return &fakeScanner{name: "naabu", results: naabuResults}
+	})
+	Register("missing", func(cfg HybridConfig) Scanner {
+		return &fakeScanner{name: "missing", invalid: fmt.Errorf("missing not found: %w", exec.ErrNotFound)}
+	})
+
+	scanner := NewHybridScanner(HybridConfig{Discovery: "missing", Verification: "naabu"})
+	results, err := scanner.Scan(context.Background(), []string{"192.0.2.1"})
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+	if len(results["192.0.2.1"]) != 1 {
+		t.Errorf("expected naabu fallback results, got %v", results)
+	}
+}
+
+func TestIPv6Parsing(t *testing.T) {
+	scanner := &MasscanScanner{}
+
+	port, host := scanner.parseDiscoveredPort("Discovered open port 554/tcp on 2001:DB8::0:1 ")
+	if port != 554 || host != "2001:db8::1" {
+		t.Errorf("parseDiscoveredPort(IPv6) = %d, %s", port, host)
+	}
+
+	port, host = scanner.parseOldFormat("open tcp 80 2001:db8::2 1234567890")
+	if port != 80 || host != "2001:db8::2" {
+		t.Errorf("parseOldFormat(IPv6) = %d, %s", port, host)
+	}
+
+	if !isLocalhostTarget("::1") || !isLocalhostTarget("[::1]") || isLocalhostTarget("2001:db8::1") {
+		t.Error("isLocalhostTarget mishandles IPv6 addresses")
+	}
+
+	if versions := ipVersionsFor([]string{"192.0.2.1", "2001:db8::1"}); len(versions) != 2 {
+		t.Errorf("ipVersionsFor(dual-stack) = %v, expected [4 6]", versions)
+	}
+}
+
+func TestClassifyUnverified(t *testing.T) {
+	open, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("cannot listen: %v", err)
+	}
+	defer open.Close()
+
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("cannot listen: %v", err)
+	}
+	closedPort := closed.Addr().(*net.TCPAddr).Port
+	closed.Close()
+
+	openPort := open.Addr().(*net.TCPAddr).Port
+	discovered := map[string][]int{"127.0.0.1": {closedPort, openPort, 9}}
+	verified := map[string][]int{"127.0.0.1": {9}}
+
+	results, connects := classifyUnverified(context.Background(), discovered, verified, 0)
+	if connects != 2 {
+		t.Errorf("classifyUnverified() made %d connects, expected 2", connects)
+	}
+	states := make(map[int]PortState)
+	for _, p := range results["127.0.0.1"] {
+		states[p.Port] = p.State
+	}
+
+	if states[9] != PortOpen || states[openPort] != PortOpen {
+		t.Errorf("verified and listening ports should be open: %v", states)
+	}
+	if states[closedPort] != PortClosed {
+		t.Errorf("refused port state = %s, expected closed", states[closedPort])
+	}
+
+	if open := results.Open(); len(open["127.0.0.1"]) != 2 {
+		t.Errorf("Results.Open() = %v, expected 2 open ports", open)
+	}
+	if closedPorts := results.WithState(PortClosed); len(closedPorts["127.0.0.1"]) != 1 {
+		t.Errorf("Results.WithState(closed) = %v", closedPorts)
+	}
+
+	// An exhausted host budget leaves unverified ports filtered
+	stats := classifyStats(time.Now(), results, verified, connects)
+	if stats.PacketsSent != 2 || stats.Targets != 1 || stats.HostsResponsive != 1 || stats.PortsFound != 1 {
+		t.Errorf("classifyStats() = %+v, expected 2 connects, 1 host responsive and 1 port found", stats)
+	}
+
+	results, connects = classifyUnverified(context.Background(), discovered, verified, time.Nanosecond)
+	if connects != 0 {
+		t.Errorf("classifyUnverified() made %d connects after the host timeout", connects)
+	}
+	if filtered := results.WithState(PortFiltered); len(filtered["127.0.0.1"]) != 2 {
+		t.Errorf("Results.WithState(filtered) after host timeout = %v, expected 2 ports", filtered)
+	}
+}
+
+func TestParseMasscanStatus(t *testing.T) {
+	p, ok := parseMasscanStatus("rate:  1.50-kpps, 42.25% done,   0:01:05 remaining, found=7       ")
+	if !ok {
+		t.Fatal("status line not recognized")
+	}
+	if p.Percent != 42.25 || p.Rate != 1500 || p.PortsFound != 7 || p.ETA != 65*time.Second {
+		t.Errorf("parseMasscanStatus() = %+v", p)
+	}
+
+	if _, ok := parseMasscanStatus("Starting masscan 1.3.2"); ok {
+		t.Error("non-status line should not parse")
+	}
+}
+
+func TestCountPorts(t *testing.T) {
+	tests := []struct {
+		spec     string
+		expected int
+	}{
+		{"80,443,8080", 3},
+		{"8000-8010", 11},
+		{"80, 554,1-10", 12},
+		{"", 0},
+	}
+
+	for _, test := range tests {
+		if result := countPorts(test.spec); result != test.expected {
+			t.Errorf("countPorts(%q) = %d, expected %d", test.spec, result, test.expected)
+		}
+	}
+}
+
+func TestScanStats(t *testing.T) {
+	stats := Stats{
+		Phases: []PhaseStats{
+			{Phase: "discovery", Duration: 2 * time.Second, PacketsSent: 2000},
+			{Phase: "verification", Duration: time.Second, PacketsSent: 40},
+		},
+		PortsDiscovered: 8,
+		PortsConfirmed:  6,
+	}
+
+	if rate := stats.Phases[0].Rate(); rate != 1000 {
+		t.Errorf("Rate() = %v, expected 1000", rate)
+	}
+	if d := stats.Duration(); d != 3*time.Second {
+		t.Errorf("Duration() = %v, expected 3s", d)
+	}
+	if drop := stats.DropRate(); drop != 0.25 {
+		t.Errorf("DropRate() = %v, expected 0.25", drop)
+	}
+
+	// Verification may confirm ports discovery missed
+	stats.PortsConfirmed = 10
+	if drop := stats.DropRate(); drop != 0 {
+		t.Errorf("DropRate() with extra confirmed ports = %v, expected 0", drop)
+	}
+
+	var out strings.Builder
+	stats.Print(&out)
+	if !strings.Contains(out.String(), "Total port-scan duration: 3s") {
+		t.Errorf("Print() missing total duration:\n%s", out.String())
+	}
+}
+
+func TestInternetDBScanner(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/198.51.100.7":
+			fmt.Fprint(w, `{"cpes":[],"hostnames":[],"ip":"198.51.100.7","ports":[8000,80,554],"tags":[],"vulns":[]}`)
+		case "/198.51.100.8":
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"detail":"No information available"}`)
+		}
+	}))
+	defer server.Close()
+
+	scanner := NewInternetDBScanner(0, false)
+	scanner.baseURL = server.URL
+
+	results, err := scanner.Scan(context.Background(), []string{"198.51.100.7", "198.51.100.8", "198.51.100.9"})
+	if err != nil {
+		t.Fatalf("Scan() failed: %v", err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("Scan() = %v, expected a single host", results)
+	}
+	if ports := fmt.Sprint(results["198.51.100.7"]); ports != "[80 554 8000]" {
+		t.Errorf("ports = %s, expected [80 554 8000]", ports)
+	}
+}
+
+func TestMasscanSCTP(t *testing.T) {
+	if arg := masscanPortArg("2905, 3868,38412-38413", ProtoSCTP); arg != "S:2905,S:3868,S:38412-38413" {
+		t.Errorf("masscanPortArg(sctp) = %s", arg)
+	}
+	if arg := masscanPortArg("80,443", ProtoTCP); arg != "80,443" {
+		t.Errorf("masscanPortArg(tcp) = %s", arg)
+	}
+
+	sctp := NewMasscanScanner(MasscanConfig{Ports: "2905", Protocol: ProtoSCTP})
+	if port, host := sctp.parseDiscoveredPort("Discovered open port 2905/sctp on 192.0.2.5"); port != 2905 || host != "192.0.2.5" {
+		t.Errorf("parseDiscoveredPort(sctp) = %d, %s", port, host)
+	}
+	if port, _ := sctp.parseDiscoveredPort("Discovered open port 80/tcp on 192.0.2.5"); port != 0 {
+		t.Errorf("SCTP scanner should ignore TCP lines, got port %d", port)
+	}
+	if ports := sctp.getPortsToScan(); ports != "2905" {
+		t.Errorf("getPortsToScan(sctp) = %s, expected 2905", ports)
+	}
+
+	tcp := NewMasscanScanner(MasscanConfig{})
+	if port, _ := tcp.parseDiscoveredPort("Discovered open port 2905/sctp on 192.0.2.5"); port != 0 {
+		t.Errorf("TCP scanner should ignore SCTP lines, got port %d", port)
+	}
+}
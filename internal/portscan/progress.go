@@ -0,0 +1,156 @@
+package portscan
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// progressInterval is how often estimated progress is reported for backends without native status
+const progressInterval = 2 * time.Second
+
+// Progress is a snapshot of a running port scan
+type Progress struct {
+	Scanner      string
+	Percent      float64 // 0-100
+	TargetsDone  int
+	TargetsTotal int
+	PortsFound   int
+	Rate         float64 // Achieved packets per second, 0 if unknown
+	Elapsed      time.Duration
+	ETA          time.Duration
+}
+
+// ProgressFunc receives progress updates while a scan runs
+type ProgressFunc func(Progress)
+
+// Masscan status line, e.g. "rate:  1.00-kpps,  4.52% done,   0:00:29 remaining, found=3"
+var (
+	masscanRateRe      = regexp.MustCompile(`rate:\s*([\d.]+)-kpps`)
+	masscanPercentRe   = regexp.MustCompile(`([\d.]+)% done`)
+	masscanRemainingRe = regexp.MustCompile(`(\d+):(\d{2}):(\d{2}) remaining`)
+	masscanFoundRe     = regexp.MustCompile(`found=(\d+)`)
+)
+
+// parseMasscanStatus parses a masscan status line; ok is false for other output
+func parseMasscanStatus(line string) (p Progress, ok bool) {
+	m := masscanPercentRe.FindStringSubmatch(line)
+	if m == nil {
+		return p, false
+	}
+	p.Scanner = "masscan"
+	p.Percent, _ = strconv.ParseFloat(m[1], 64)
+
+	if m := masscanRateRe.FindStringSubmatch(line); m != nil {
+		kpps, _ := strconv.ParseFloat(m[1], 64)
+		p.Rate = kpps * 1000
+	}
+	if m := masscanRemainingRe.FindStringSubmatch(line); m != nil {
+		h, _ := strconv.Atoi(m[1])
+		mins, _ := strconv.Atoi(m[2])
+		sec, _ := strconv.Atoi(m[3])
+		p.ETA = time.Duration(h)*time.Hour + time.Duration(mins)*time.Minute + time.Duration(sec)*time.Second
+	}
+	if m := masscanFoundRe.FindStringSubmatch(line); m != nil {
+		p.PortsFound, _ = strconv.Atoi(m[1])
+	}
+	return p, true
+}
+
+// readMasscanStatus reads masscan's stderr, reporting status lines as progress and
+// forwarding everything else to out
+func readMasscanStatus(stderr io.Reader, out io.Writer, targets int, start time.Time, onProgress ProgressFunc) {
+	scanner := bufio.NewScanner(stderr)
+	scanner.Split(scanStatusLines)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if p, ok := parseMasscanStatus(line); ok {
+			p.TargetsTotal = targets
+			p.TargetsDone = int(p.Percent * float64(targets) / 100)
+			p.Elapsed = time.Since(start)
+			onProgress(p)
+			continue
+		}
+		if strings.TrimSpace(line) != "" {
+			io.WriteString(out, line+"\n")
+		}
+	}
+}
+
+// scanStatusLines splits on either '\r' or '\n', since status lines are redrawn with '\r'
+func scanStatusLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// estimateProgress reports time-based progress for backends without a native status
+// feed, assuming probes go out at the configured rate. It stops when ctx is done.
+func estimateProgress(ctx context.Context, name string, targets, portsPerTarget, rate int, onProgress ProgressFunc) {
+	if rate <= 0 || targets == 0 {
+		return
+	}
+	expected := time.Duration(float64(targets*portsPerTarget) / float64(rate) * float64(time.Second))
+	start := time.Now()
+
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			elapsed := time.Since(start)
+			percent := 99.0
+			if expected > 0 && elapsed < expected {
+				percent = float64(elapsed) / float64(expected) * 100
+			}
+			eta := expected - elapsed
+			if eta < 0 {
+				eta = 0
+			}
+			onProgress(Progress{
+				Scanner:      name,
+				Percent:      percent,
+				TargetsDone:  int(percent * float64(targets) / 100),
+				TargetsTotal: targets,
+				Rate:         float64(rate),
+				Elapsed:      elapsed,
+				ETA:          eta,
+			})
+		}
+	}
+}
+
+// countPorts returns the number of ports in a naabu/masscan port spec such as "80,443,8000-8010"
+func countPorts(spec string) int {
+	count := 0
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if lo, hi, isRange := strings.Cut(part, "-"); isRange {
+			first, err1 := strconv.Atoi(lo)
+			last, err2 := strconv.Atoi(hi)
+			if err1 == nil && err2 == nil && last >= first {
+				count += last - first + 1
+			}
+			continue
+		}
+		count++
+	}
+	return count
+}
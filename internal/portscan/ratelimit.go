@@ -0,0 +1,60 @@
+package portscan
+
+import (
+	"net"
+)
+
+// ipv6SubnetPrefix is the subnet size used to group IPv6 targets (one customer LAN)
+const ipv6SubnetPrefix = 64
+
+// SubnetRate caps the global rate so that no destination subnet receives more than
+// perSubnet packets per second. Both masscan and naabu randomize probe order across
+// the whole target set, so a subnet holding k of n targets sees roughly rate*k/n pps;
+// the busiest subnet therefore determines the highest safe global rate.
+// A perSubnet of zero or less disables the limit.
+func SubnetRate(targets []string, rate, perSubnet, prefixLen int) int {
+	if perSubnet <= 0 || rate <= 0 || len(targets) == 0 {
+		return rate
+	}
+
+	busiest := 0
+	for _, count := range countBySubnet(targets, prefixLen) {
+		if count > busiest {
+			busiest = count
+		}
+	}
+
+	limited := perSubnet * len(targets) / busiest
+	if limited < 1 {
+		limited = 1
+	}
+	if limited < rate {
+		return limited
+	}
+	return rate
+}
+
+// countBySubnet groups targets by their containing subnet and counts them
+func countBySubnet(targets []string, prefixLen int) map[string]int {
+	counts := make(map[string]int)
+	for _, target := range targets {
+		counts[subnetKey(target, prefixLen)]++
+	}
+	return counts
+}
+
+// subnetKey returns the network address of the target's subnet; unparseable
+// targets (hostnames) are treated as their own subnet
+func subnetKey(target string, prefixLen int) string {
+	ip := net.ParseIP(target)
+	if ip == nil {
+		return target
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		if prefixLen <= 0 || prefixLen > 32 {
+			prefixLen = 24
+		}
+		return ip4.Mask(net.CIDRMask(prefixLen, 32)).String()
+	}
+	return ip.Mask(net.CIDRMask(ipv6SubnetPrefix, 128)).String()
+}
@@ -0,0 +1,71 @@
+package portscan
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Scanner is implemented by every port scanning backend
+type Scanner interface {
+	// Name returns the registry name of the backend
+	Name() string
+	// Scan returns the open ports found for each target
+	Scan(ctx context.Context, targets []string) (map[string][]int, error)
+	// Validate checks that the backend can run on this system
+	Validate() error
+}
+
+// Verifier is implemented by backends that can re-check ports found by another scanner
+type Verifier interface {
+	VerifyPorts(ctx context.Context, discoveredPorts map[string][]int) (map[string][]int, error)
+}
+
+// Factory builds a scanner from the top-level scan configuration
+type Factory func(cfg HybridConfig) Scanner
+
+var (
+	registry      = make(map[string]Factory)
+	registryMutex sync.RWMutex
+)
+
+func init() {
+	Register("masscan", func(cfg HybridConfig) Scanner { return NewMasscanScanner(cfg.masscanConfig()) })
+	Register("naabu", func(cfg HybridConfig) Scanner { return NewNaabuScanner(cfg.naabuConfig()) })
+	Register("hybrid", func(cfg HybridConfig) Scanner { return NewHybridScanner(cfg) })
+	Register("internetdb", func(cfg HybridConfig) Scanner { return NewInternetDBScanner(cfg.HostTimeout, cfg.Debug) })
+}
+
+// Register makes a scanner backend available under the given name.
+// Registering an existing name replaces the previous factory.
+func Register(name string, factory Factory) {
+	registryMutex.Lock()
+	registry[strings.ToLower(name)] = factory
+	registryMutex.Unlock()
+}
+
+// New creates the scanner registered under name
+func New(name string, cfg HybridConfig) (Scanner, error) {
+	registryMutex.RLock()
+	factory, exists := registry[strings.ToLower(name)]
+	registryMutex.RUnlock()
+	if !exists {
+		return nil, fmt.Errorf("unknown scanner %q (available: %s)", name, strings.Join(Names(), ", "))
+	}
+	return factory(cfg), nil
+}
+
+// Names returns the sorted names of all registered scanners
+func Names() []string {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,45 @@
+package portscan
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Transports understood by the masscan backend
+const (
+	ProtoTCP  = "tcp"
+	ProtoSCTP = "sctp"
+)
+
+// ScanSCTP sends SCTP INIT probes to cfg.SCTPPorts with masscan and returns the ports
+// that answered with INIT-ACK. Some NVR clusters and telecom-grade DVR backends only
+// expose SCTP, which neither TCP pass sees. naabu has no SCTP support, so masscan is required.
+func ScanSCTP(ctx context.Context, cfg HybridConfig, targets []string) (map[string][]int, error) {
+	if cfg.SCTPPorts == "" || len(targets) == 0 {
+		return map[string][]int{}, nil
+	}
+
+	masscanCfg := cfg.masscanConfig()
+	masscanCfg.Ports = cfg.SCTPPorts
+	masscanCfg.Protocol = ProtoSCTP
+
+	scanner := NewMasscanScanner(masscanCfg)
+	if err := scanner.Validate(); err != nil {
+		return nil, fmt.Errorf("SCTP scanning requires masscan: %w", err)
+	}
+	return scanner.Scan(ctx, targets)
+}
+
+// masscanPortArg prefixes every port or range with masscan's transport marker
+// ("S:2905" for SCTP). TCP ports need no prefix.
+func masscanPortArg(spec, protocol string) string {
+	if protocol != ProtoSCTP {
+		return spec
+	}
+	parts := strings.Split(spec, ",")
+	for i, part := range parts {
+		parts[i] = "S:" + strings.TrimSpace(part)
+	}
+	return strings.Join(parts, ",")
+}
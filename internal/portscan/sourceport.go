@@ -0,0 +1,64 @@
+package portscan
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+)
+
+// Ephemeral port range used when a random source port is requested (IANA dynamic ports)
+const (
+	ephemeralPortMin = 49152
+	ephemeralPortMax = 65535
+)
+
+// ResolveSourcePort validates a source-port spec and returns the value handed to the backends.
+// An empty spec leaves the choice to the scanner, "random" picks one ephemeral port for the
+// whole run, and a single port or a "lo-hi" range is passed through unchanged.
+// Ranges are only honored by masscan and must span a power-of-two number of ports.
+func ResolveSourcePort(spec string) (string, error) {
+	spec = strings.TrimSpace(spec)
+	switch spec {
+	case "":
+		return "", nil
+	case "random":
+		return strconv.Itoa(ephemeralPortMin + rand.IntN(ephemeralPortMax-ephemeralPortMin+1)), nil
+	}
+
+	lo, hi, isRange := strings.Cut(spec, "-")
+	first, err := parseSourcePort(lo)
+	if err != nil {
+		return "", err
+	}
+	if !isRange {
+		return strconv.Itoa(first), nil
+	}
+
+	last, err := parseSourcePort(hi)
+	if err != nil {
+		return "", err
+	}
+	if last < first {
+		return "", fmt.Errorf("invalid source port range %q", spec)
+	}
+	if size := last - first + 1; size&(size-1) != 0 {
+		return "", fmt.Errorf("source port range %q must span a power of two ports", spec)
+	}
+	return strconv.Itoa(first) + "-" + strconv.Itoa(last), nil
+}
+
+// naabuSourcePort reduces a resolved spec to the single port naabu supports
+func naabuSourcePort(spec string) string {
+	first, _, _ := strings.Cut(spec, "-")
+	return first
+}
+
+// parseSourcePort parses a single port number in the 1-65535 range
+func parseSourcePort(s string) (int, error) {
+	port, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || port < 1 || port > 65535 {
+		return 0, fmt.Errorf("invalid source port %q", s)
+	}
+	return port, nil
+}
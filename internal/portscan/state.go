@@ -0,0 +1,172 @@
+package portscan
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/postfix/cctvscan/internal/util"
+	"github.com/postfix/cctvscan/internal/verify"
+)
+
+// PortState describes how a discovered port answered during verification
+type PortState string
+
+const (
+	PortOpen     PortState = verify.StateOpen
+	PortClosed   PortState = verify.StateClosed   // RST: host is up, service is gone
+	PortFiltered PortState = verify.StateFiltered // silence: firewalled or host offline
+)
+
+// PortResult is a single scanned port with its verified state
+type PortResult struct {
+	Port  int
+	State PortState
+}
+
+// Results maps each host to its scanned ports and their states
+type Results map[string][]PortResult
+
+// StateScanner is implemented by scanners that report per-port states
+type StateScanner interface {
+	ScanResults(ctx context.Context, targets []string) (Results, error)
+}
+
+// ScanWithStates runs the scanner and returns per-port states. Scanners that only
+// report open ports have all their results marked open.
+func ScanWithStates(ctx context.Context, scanner Scanner, targets []string) (Results, error) {
+	if stateScanner, ok := scanner.(StateScanner); ok {
+		return stateScanner.ScanResults(ctx, targets)
+	}
+	openPorts, err := scanner.Scan(ctx, targets)
+	if err != nil {
+		return nil, err
+	}
+	return openResults(openPorts), nil
+}
+
+// Open returns the open ports per host, omitting hosts without any
+func (r Results) Open() map[string][]int {
+	return r.WithState(PortOpen)
+}
+
+// WithState returns the ports in the given state per host, omitting hosts without any
+func (r Results) WithState(state PortState) map[string][]int {
+	out := make(map[string][]int)
+	for host, ports := range r {
+		for _, p := range ports {
+			if p.State == state {
+				out[host] = append(out[host], p.Port)
+			}
+		}
+	}
+	return out
+}
+
+// openResults marks every port in a plain scan result as open
+func openResults(ports map[string][]int) Results {
+	results := make(Results, len(ports))
+	for host, list := range ports {
+		for _, p := range list {
+			results[host] = append(results[host], PortResult{Port: p, State: PortOpen})
+		}
+	}
+	return results
+}
+
+// classifyUnverified marks ports confirmed by verification as open and probes the
+// rest with a TCP connect to tell closed (RST) from filtered (no answer). Each host
+// gets at most hostTimeout; ports left unprobed when it expires count as filtered.
+// It also returns how many connects were made.
+func classifyUnverified(ctx context.Context, discovered, verified map[string][]int, hostTimeout time.Duration) (Results, int) {
+	results := make(Results, len(discovered))
+	verifier := verify.NewTCPVerifier(1500*time.Millisecond, 1)
+	connects := 0
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, 20)
+
+	var cancels []context.CancelFunc
+	defer func() {
+		for _, cancel := range cancels {
+			cancel()
+		}
+	}()
+
+	for host, ports := range discovered {
+		hostCtx := ctx
+		if hostTimeout > 0 {
+			var cancel context.CancelFunc
+			hostCtx, cancel = context.WithTimeout(ctx, hostTimeout)
+			cancels = append(cancels, cancel)
+		}
+
+		confirmed := make(map[int]bool, len(verified[host]))
+		for _, p := range verified[host] {
+			confirmed[p] = true
+		}
+
+		for _, port := range ports {
+			if confirmed[port] {
+				mu.Lock()
+				results[host] = append(results[host], PortResult{Port: port, State: PortOpen})
+				mu.Unlock()
+				continue
+			}
+
+			wg.Add(1)
+			go func(h string, p int) {
+				defer wg.Done()
+				semaphore <- struct{}{}
+				defer func() { <-semaphore }()
+
+				state, probed := PortFiltered, hostCtx.Err() == nil
+				if probed {
+					state = PortState(verifier.State(hostCtx, h, p))
+				}
+				mu.Lock()
+				results[h] = append(results[h], PortResult{Port: p, State: state})
+				if probed {
+					connects++
+				}
+				mu.Unlock()
+			}(host, port)
+		}
+	}
+	wg.Wait()
+
+	for _, ports := range results {
+		sort.Slice(ports, func(i, j int) bool { return ports[i].Port < ports[j].Port })
+	}
+	return results, connects
+}
+
+// classifyStats summarizes the connect checks of classifyUnverified: the hosts
+// where a checked port answered and the checked ports that turned out open
+func classifyStats(start time.Time, results Results, verified map[string][]int, connects int) PhaseStats {
+	stats := PhaseStats{Phase: "classify", Scanner: "connect", Duration: time.Since(start), PacketsSent: connects}
+	for host, ports := range results {
+		checked, responsive := false, false
+		for _, p := range ports {
+			if util.PortIn(verified[host], p.Port) {
+				continue
+			}
+			checked = true
+			if p.State != PortFiltered {
+				responsive = true
+			}
+			if p.State == PortOpen {
+				stats.PortsFound++
+			}
+		}
+		if checked {
+			stats.Targets++
+		}
+		if responsive {
+			stats.HostsResponsive++
+		}
+	}
+	return stats
+}
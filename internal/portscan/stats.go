@@ -0,0 +1,103 @@
+package portscan
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// PhaseStats describes one phase (discovery or verification) of a port scan
+type PhaseStats struct {
+	Phase           string
+	Scanner         string
+	Duration        time.Duration
+	Targets         int
+	PacketsSent     int // SYNs sent: estimated as targets x ports x attempts for scans, counted for connects
+	HostsResponsive int
+	PortsFound      int
+}
+
+// Rate returns the achieved packets per second for the phase
+func (p PhaseStats) Rate() float64 {
+	if p.Duration <= 0 {
+		return 0
+	}
+	return float64(p.PacketsSent) / p.Duration.Seconds()
+}
+
+// Stats summarizes a completed port scan
+type Stats struct {
+	Phases          []PhaseStats
+	PortsDiscovered int // Ports reported by discovery
+	PortsConfirmed  int // Discovered ports confirmed open by verification
+}
+
+// StatsReporter is implemented by scanners that collect statistics for their most recent scan
+type StatsReporter interface {
+	Stats() Stats
+}
+
+// Duration returns the total time spent across all phases
+func (s Stats) Duration() time.Duration {
+	var total time.Duration
+	for _, p := range s.Phases {
+		total += p.Duration
+	}
+	return total
+}
+
+// DropRate returns the fraction of discovered ports that verification did not confirm
+func (s Stats) DropRate() float64 {
+	if s.PortsDiscovered == 0 {
+		return 0
+	}
+	return float64(s.dropped()) / float64(s.PortsDiscovered)
+}
+
+// dropped returns the number of discovered ports that verification did not confirm
+func (s Stats) dropped() int {
+	if s.PortsConfirmed > s.PortsDiscovered {
+		return 0
+	}
+	return s.PortsDiscovered - s.PortsConfirmed
+}
+
+// Print writes a human-readable statistics summary
+func (s Stats) Print(w io.Writer) {
+	fmt.Fprintln(w, "Scan statistics:")
+	for _, p := range s.Phases {
+		fmt.Fprintf(w, "  %-12s %-8s %8s | ~%d SYNs at %.0f pps | %d targets, %d hosts responsive, %d ports\n",
+			p.Phase, p.Scanner, p.Duration.Round(time.Millisecond), p.PacketsSent, p.Rate(),
+			p.Targets, p.HostsResponsive, p.PortsFound)
+	}
+	if len(s.Phases) > 1 && s.PortsDiscovered > 0 {
+		fmt.Fprintf(w, "  Verification drop rate: %.1f%% (%d of %d discovered ports unconfirmed)\n",
+			s.DropRate()*100, s.dropped(), s.PortsDiscovered)
+	}
+	fmt.Fprintf(w, "  Total port-scan duration: %s\n", s.Duration().Round(time.Millisecond))
+}
+
+// newPhaseStats builds statistics for a finished backend run
+func newPhaseStats(scanner string, start time.Time, targets, ports, attempts int, results map[string][]int) PhaseStats {
+	if attempts < 1 {
+		attempts = 1
+	}
+	return PhaseStats{
+		Phase:           "scan",
+		Scanner:         scanner,
+		Duration:        time.Since(start),
+		Targets:         targets,
+		PacketsSent:     targets * ports * attempts,
+		HostsResponsive: len(results),
+		PortsFound:      countFound(results),
+	}
+}
+
+// countFound returns the total number of ports across all hosts
+func countFound(results map[string][]int) int {
+	found := 0
+	for _, list := range results {
+		found += len(list)
+	}
+	return found
+}
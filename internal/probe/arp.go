@@ -0,0 +1,80 @@
+package probe
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+// procARP is the Linux neighbour table
+const procARP = "/proc/net/arp"
+
+// LookupMAC returns the MAC address of host from the operating system's ARP cache,
+// e.g. "28:57:be:12:34:56", or "" when host isn't on a directly attached subnet.
+// The probes have talked to the host by the time this is called, so the kernel
+// already resolved it; no ARP request of our own is needed.
+func LookupMAC(ctx context.Context, host string) string {
+	ip := net.ParseIP(host)
+	if ip == nil || ip.To4() == nil {
+		return "" // ARP is IPv4 only
+	}
+	if f, err := os.Open(procARP); err == nil {
+		defer f.Close()
+		return parseProcARP(f, ip.String())
+	}
+	// BSD and macOS: arp -n prints "? (192.168.1.64) at 28:57:be:12:34:56 on en0 ..."
+	out, err := exec.CommandContext(ctx, "arp", "-n", ip.String()).Output()
+	if err != nil {
+		return ""
+	}
+	return parseARPOutput(string(out))
+}
+
+// parseProcARP finds ip in /proc/net/arp, skipping incomplete entries
+func parseProcARP(r io.Reader, ip string) string {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		// IP address  HW type  Flags  HW address  Mask  Device
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 || fields[0] != ip || fields[2] == "0x0" {
+			continue
+		}
+		return NormalizeMAC(fields[3])
+	}
+	return ""
+}
+
+var arpMACRe = regexp.MustCompile(`(?i)\b([0-9a-f]{1,2}(?:[:-][0-9a-f]{1,2}){5})\b`)
+
+// parseARPOutput returns the first MAC address printed by arp(8)
+func parseARPOutput(out string) string {
+	if m := arpMACRe.FindStringSubmatch(out); m != nil {
+		return NormalizeMAC(m[1])
+	}
+	return ""
+}
+
+// NormalizeMAC writes a MAC address as lowercase colon separated octets, padding
+// the single digit octets BSD arp prints; "" for the all-zero address of
+// unresolved entries and for anything that isn't a MAC
+func NormalizeMAC(mac string) string {
+	octets := strings.FieldsFunc(strings.ToLower(strings.TrimSpace(mac)), func(r rune) bool { return r == ':' || r == '-' })
+	if len(octets) != 6 {
+		return ""
+	}
+	for i, o := range octets {
+		if len(o) == 1 {
+			octets[i] = "0" + o
+		}
+	}
+	hw, err := net.ParseMAC(strings.Join(octets, ":"))
+	if err != nil || hw.String() == "00:00:00:00:00:00" {
+		return ""
+	}
+	return hw.String()
+}
@@ -0,0 +1,210 @@
+package probe
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// AuthChallenge is one challenge from a WWW-Authenticate (HTTP or RTSP) header
+type AuthChallenge struct {
+	Scheme    string // "Basic", "Digest", ...
+	Realm     string // Often names the vendor, e.g. "Hikvision" or "IPCamera"
+	Nonce     string
+	Algorithm string
+	QOP       string
+	Opaque    string
+}
+
+// lockoutMarkers matches lower case texts of refused logins saying the account
+// or address is locked, e.g. <lockStatus>lock</lockStatus> of Hikvision ISAPI.
+// Locked is a whole word, and the first group catches it negated.
+var lockoutMarkers = regexp.MustCompile(`(\b(?:not|never)\s+(?:been\s+)?)?\blocked\b|<lockstatus>\s*lock\s*</lockstatus>|too many|try again later`)
+
+// LockoutMarker returns the lockout marker in the body of a refused login
+func LockoutMarker(body []byte) (string, bool) {
+	for _, m := range lockoutMarkers.FindAllStringSubmatch(strings.ToLower(string(body)), -1) {
+		if m[1] == "" {
+			return m[0], true
+		}
+	}
+	return "", false
+}
+
+// IsDigest reports whether the challenge asks for Digest authentication
+func (c AuthChallenge) IsDigest() bool { return strings.EqualFold(c.Scheme, "Digest") }
+
+// IsBasic reports whether the challenge asks for Basic authentication
+func (c AuthChallenge) IsBasic() bool { return strings.EqualFold(c.Scheme, "Basic") }
+
+// String formats the challenge as `Digest realm="..."` for output
+func (c AuthChallenge) String() string {
+	if c.Realm == "" {
+		return c.Scheme
+	}
+	return c.Scheme + ` realm="` + c.Realm + `"`
+}
+
+// DigestAuthorization answers a Digest challenge (RFC 7616) for method and uri and
+// returns the Authorization header value. MD5, SHA-256 and their -sess variants are
+// supported; qop=auth is used whenever the challenge offers it.
+func (c AuthChallenge) DigestAuthorization(method, uri, username, password string) string {
+	newHash := md5.New
+	algorithm := strings.ToUpper(c.Algorithm)
+	if strings.HasPrefix(algorithm, "SHA-256") {
+		newHash = sha256.New
+	}
+	h := func(s string) string { return hashHex(newHash, s) }
+
+	cnonce := make([]byte, 8)
+	rand.Read(cnonce)
+	cn := hex.EncodeToString(cnonce)
+	const nc = "00000001"
+
+	ha1 := h(username + ":" + c.Realm + ":" + password)
+	if strings.HasSuffix(algorithm, "-SESS") {
+		ha1 = h(ha1 + ":" + c.Nonce + ":" + cn)
+	}
+	ha2 := h(method + ":" + uri)
+
+	qop := ""
+	for _, q := range strings.Split(c.QOP, ",") {
+		if strings.TrimSpace(q) == "auth" {
+			qop = "auth"
+		}
+	}
+	var response string
+	if qop != "" {
+		response = h(ha1 + ":" + c.Nonce + ":" + nc + ":" + cn + ":" + qop + ":" + ha2)
+	} else {
+		response = h(ha1 + ":" + c.Nonce + ":" + ha2)
+	}
+
+	v := fmt.Sprintf(`Digest username="%s", realm="%s", nonce="%s", uri="%s", response="%s"`,
+		username, c.Realm, c.Nonce, uri, response)
+	if c.Algorithm != "" {
+		v += ", algorithm=" + c.Algorithm
+	}
+	if c.Opaque != "" {
+		v += fmt.Sprintf(`, opaque="%s"`, c.Opaque)
+	}
+	if qop != "" {
+		v += fmt.Sprintf(`, qop=%s, nc=%s, cnonce="%s"`, qop, nc, cn)
+	}
+	return v
+}
+
+func hashHex(newHash func() hash.Hash, s string) string {
+	h := newHash()
+	h.Write([]byte(s))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// ParseAuthChallenges parses WWW-Authenticate header values. A single value may carry
+// several challenges (`Digest realm="x", nonce="y", Basic realm="x"`), and devices
+// often send one header per scheme.
+func ParseAuthChallenges(values []string) []AuthChallenge {
+	var out []AuthChallenge
+	for _, v := range values {
+		var cur *AuthChallenge
+		for _, tok := range splitAuthParams(v) {
+			// A new challenge starts with a bare scheme token, optionally followed by
+			// its first parameter: `Digest realm="x"`
+			if name, rest, ok := strings.Cut(tok, " "); ok && !strings.Contains(name, "=") &&
+				!strings.HasPrefix(strings.TrimSpace(rest), "=") {
+				out = append(out, AuthChallenge{Scheme: canonicalScheme(name)})
+				cur = &out[len(out)-1]
+				tok = strings.TrimSpace(rest)
+			} else if !strings.Contains(tok, "=") {
+				out = append(out, AuthChallenge{Scheme: canonicalScheme(tok)})
+				cur = &out[len(out)-1]
+				continue
+			}
+			if cur == nil {
+				continue
+			}
+			key, val, _ := strings.Cut(tok, "=")
+			val = strings.Trim(strings.TrimSpace(val), `"`)
+			switch strings.ToLower(strings.TrimSpace(key)) {
+			case "realm":
+				cur.Realm = val
+			case "nonce":
+				cur.Nonce = val
+			case "algorithm":
+				cur.Algorithm = val
+			case "qop":
+				cur.QOP = val
+			case "opaque":
+				cur.Opaque = val
+			}
+		}
+	}
+	return out
+}
+
+// PreferredChallenge picks the challenge a brute-force attempt should answer: Basic
+// when offered, since it is cheapest, otherwise the first one
+func PreferredChallenge(challenges []AuthChallenge) (AuthChallenge, bool) {
+	for _, c := range challenges {
+		if c.IsBasic() {
+			return c, true
+		}
+	}
+	if len(challenges) == 0 {
+		return AuthChallenge{}, false
+	}
+	return challenges[0], true
+}
+
+// responseChallenge returns the preferred challenge of an HTTP response, if any
+func responseChallenge(resp *http.Response) (AuthChallenge, bool) {
+	return PreferredChallenge(ParseAuthChallenges(resp.Header.Values("WWW-Authenticate")))
+}
+
+// splitAuthParams splits a header value on commas outside quoted strings
+func splitAuthParams(s string) []string {
+	var parts []string
+	var b strings.Builder
+	quoted := false
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\' && quoted && i+1 < len(s):
+			b.WriteByte(s[i+1])
+			i++
+		case c == '"':
+			quoted = !quoted
+			b.WriteByte(c)
+		case c == ',' && !quoted:
+			parts = append(parts, b.String())
+			b.Reset()
+		default:
+			b.WriteByte(c)
+		}
+	}
+	parts = append(parts, b.String())
+
+	out := parts[:0]
+	for _, p := range parts {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// canonicalScheme normalizes the case of well-known schemes
+func canonicalScheme(s string) string {
+	switch strings.ToLower(s) {
+	case "basic":
+		return "Basic"
+	case "digest":
+		return "Digest"
+	}
+	return s
+}
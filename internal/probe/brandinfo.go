@@ -0,0 +1,263 @@
+package probe
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/postfix/cctvscan/internal/util"
+)
+
+// ErrDeviceUnauthorized is returned when a brand endpoint exists but wants credentials
+var ErrDeviceUnauthorized = errors.New("device endpoint requires authentication")
+
+// maxDeviceInfoSize bounds the answers of the brand endpoints
+const maxDeviceInfoSize = 64 * 1024
+
+// DeviceDetails is the exact model and firmware read from a brand specific endpoint
+type DeviceDetails struct {
+	Model         string
+	Firmware      string
+	Serial        string
+	MAC           string
+	DeviceType    string // e.g. IPCamera, DVR, "Network Camera"
+	URL           string // Endpoint that answered
+	Authenticated bool   // The endpoint needed credentials
+}
+
+// Found reports whether the endpoint revealed anything
+func (d DeviceDetails) Found() bool {
+	return d.Model != "" || d.Firmware != "" || d.Serial != ""
+}
+
+// brandProbe reads device details from the web server at base
+type brandProbe func(ctx context.Context, client *http.Client, base, username, password string) (DeviceDetails, error)
+
+// brandProbes maps lower case brands to their device information endpoints
+var brandProbes = map[string]brandProbe{
+	"hikvision": probeHikvisionDetails,
+	"axis":      probeAxisDetails,
+	"dahua":     probeDahuaDetails,
+}
+
+// HasBrandProbe reports whether ProbeBrandDetails knows an endpoint for brand
+func HasBrandProbe(brand string) bool {
+	_, ok := brandProbes[strings.ToLower(brand)]
+	return ok
+}
+
+// ProbeBrandDetails queries the device information endpoint of brand on each HTTP
+// port until one answers: Hikvision ISAPI deviceInfo, Axis VAPIX param.cgi, or Dahua
+// RPC2_Login and magicBox.cgi. Without a username the requests are unauthenticated.
+// ErrDeviceUnauthorized is returned if an endpoint exists but refused the request,
+// alongside whatever was readable without credentials.
+func ProbeBrandDetails(ctx context.Context, host string, ports []int, brand, username, password string) (DeviceDetails, error) {
+	fn, ok := brandProbes[strings.ToLower(brand)]
+	if !ok {
+		return DeviceDetails{}, errors.New("no device information endpoint for " + brand)
+	}
+	client := ConfigFrom(ctx).HTTP.Client()
+	unauthorized := false
+	for _, p := range ports {
+		if ctx.Err() != nil {
+			break
+		}
+		base := DetectScheme(ctx, host, p) + "://" + net.JoinHostPort(host, util.Itoa(p))
+		details, err := fn(ctx, client, base, username, password)
+		if details.Found() {
+			return details, err
+		}
+		if errors.Is(err, ErrDeviceUnauthorized) {
+			unauthorized = true
+		}
+	}
+	if unauthorized {
+		return DeviceDetails{}, ErrDeviceUnauthorized
+	}
+	return DeviceDetails{}, errors.New("no device information from " + host)
+}
+
+type hikvisionDeviceInfo struct {
+	Model           string `xml:"model"`
+	SerialNumber    string `xml:"serialNumber"`
+	MACAddress      string `xml:"macAddress"`
+	FirmwareVersion string `xml:"firmwareVersion"`
+	FirmwareDate    string `xml:"firmwareReleasedDate"`
+	DeviceType      string `xml:"deviceType"`
+}
+
+// probeHikvisionDetails reads ISAPI /System/deviceInfo, or the PSIA original on old
+// firmware
+func probeHikvisionDetails(ctx context.Context, client *http.Client, base, username, password string) (DeviceDetails, error) {
+	var err error
+	for _, path := range []string{"/ISAPI/System/deviceInfo", "/PSIA/System/deviceInfo"} {
+		body, authenticated, e := getDeviceInfo(ctx, client, "GET", base+path, "", username, password)
+		if e != nil {
+			if err == nil || errors.Is(e, ErrDeviceUnauthorized) {
+				err = e
+			}
+			continue
+		}
+		var info hikvisionDeviceInfo
+		if xml.Unmarshal(body, &info) != nil || (info.Model == "" && info.SerialNumber == "") {
+			continue
+		}
+		return DeviceDetails{
+			Model:         strings.TrimSpace(info.Model),
+			Firmware:      strings.TrimSpace(info.FirmwareVersion + " " + info.FirmwareDate),
+			Serial:        strings.TrimSpace(info.SerialNumber),
+			MAC:           strings.TrimSpace(info.MACAddress),
+			DeviceType:    strings.TrimSpace(info.DeviceType),
+			URL:           base + path,
+			Authenticated: authenticated,
+		}, nil
+	}
+	return DeviceDetails{}, err
+}
+
+// probeAxisDetails reads the Brand group, firmware version and serial number through
+// VAPIX param.cgi
+func probeAxisDetails(ctx context.Context, client *http.Client, base, username, password string) (DeviceDetails, error) {
+	url := base + "/axis-cgi/param.cgi?action=list&group=root.Brand,root.Properties.Firmware.Version,root.Properties.System.SerialNumber"
+	body, authenticated, err := getDeviceInfo(ctx, client, "GET", url, "", username, password)
+	if err != nil {
+		return DeviceDetails{}, err
+	}
+	params := parseKeyValues(body)
+	model := params["root.Brand.ProdNbr"]
+	if model == "" {
+		model = params["root.Brand.ProdShortName"]
+	}
+	return DeviceDetails{
+		Model:         model,
+		Firmware:      params["root.Properties.Firmware.Version"],
+		Serial:        params["root.Properties.System.SerialNumber"],
+		DeviceType:    params["root.Brand.ProdType"],
+		URL:           url,
+		Authenticated: authenticated,
+	}, nil
+}
+
+// probeDahuaDetails reads the serial number from the realm of the first RPC2_Login
+// step, which needs no password, then model and firmware from magicBox.cgi
+func probeDahuaDetails(ctx context.Context, client *http.Client, base, username, password string) (DeviceDetails, error) {
+	var details DeviceDetails
+	login := `{"method":"global.login","params":{"userName":"admin","password":"","clientType":"Web3.0","loginType":"Direct"},"id":1,"session":0}`
+	if body, _, err := getDeviceInfo(ctx, client, "POST", base+"/RPC2_Login", login, "", ""); err == nil {
+		var challenge struct {
+			Params struct {
+				Realm string `json:"realm"`
+				MAC   string `json:"mac"`
+			} `json:"params"`
+		}
+		if json.Unmarshal(body, &challenge) == nil {
+			if serial, ok := strings.CutPrefix(challenge.Params.Realm, "Login to "); ok {
+				details.Serial = strings.TrimSpace(serial)
+				details.URL = base + "/RPC2_Login"
+			}
+			details.MAC = challenge.Params.MAC
+		}
+	}
+
+	var err error
+	for _, action := range []string{"getDeviceType", "getSoftwareVersion", "getSerialNo"} {
+		url := base + "/cgi-bin/magicBox.cgi?action=" + action
+		body, authenticated, e := getDeviceInfo(ctx, client, "GET", url, "", username, password)
+		if e != nil {
+			err = e
+			if errors.Is(e, ErrDeviceUnauthorized) {
+				break // The other actions want the same credentials
+			}
+			continue
+		}
+		values := parseKeyValues(body)
+		switch action {
+		case "getDeviceType":
+			details.Model = values["type"]
+		case "getSoftwareVersion":
+			details.Firmware = values["version"]
+		case "getSerialNo":
+			if values["sn"] != "" {
+				details.Serial = values["sn"]
+			}
+		}
+		details.URL = base + "/cgi-bin/magicBox.cgi"
+		details.Authenticated = authenticated
+	}
+	return details, err
+}
+
+// getDeviceInfo sends a request without credentials and, on a 401, repeats it with
+// username and password using the scheme the device asked for. It returns the body
+// of a 200 answer and whether credentials were needed.
+func getDeviceInfo(ctx context.Context, client *http.Client, method, url, body, username, password string) ([]byte, bool, error) {
+	resp, err := deviceRequest(ctx, client, method, url, body, "")
+	if err != nil {
+		return nil, false, err
+	}
+	authenticated := false
+	if resp.StatusCode == http.StatusUnauthorized {
+		c, ok := PreferredChallenge(ParseAuthChallenges(resp.Header.Values("WWW-Authenticate")))
+		resp.Body.Close()
+		if username == "" || !ok {
+			return nil, false, ErrDeviceUnauthorized
+		}
+		authorization := ""
+		if c.IsDigest() {
+			authorization = c.DigestAuthorization(method, resp.Request.URL.RequestURI(), username, password)
+		} else {
+			req, _ := http.NewRequest(method, url, nil)
+			req.SetBasicAuth(username, password)
+			authorization = req.Header.Get("Authorization")
+		}
+		if resp, err = deviceRequest(ctx, client, method, url, body, authorization); err != nil {
+			return nil, false, err
+		}
+		if resp.StatusCode == http.StatusUnauthorized {
+			resp.Body.Close()
+			return nil, false, ErrDeviceUnauthorized
+		}
+		authenticated = true
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, maxDeviceInfoSize))
+	// Dahua answers the RPC2_Login challenge with 200; everything else must succeed
+	if resp.StatusCode != http.StatusOK {
+		return nil, authenticated, errors.New(resp.Status + " from " + url)
+	}
+	return data, authenticated, nil
+}
+
+func deviceRequest(ctx context.Context, client *http.Client, method, url, body, authorization string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "CCTVTool/1.0")
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	return client.Do(req)
+}
+
+// parseKeyValues parses the key=value lines of VAPIX and Dahua CGI answers
+func parseKeyValues(body []byte) map[string]string {
+	values := make(map[string]string)
+	sc := bufio.NewScanner(strings.NewReader(string(body)))
+	for sc.Scan() {
+		key, value, ok := strings.Cut(sc.Text(), "=")
+		if ok && !strings.HasPrefix(key, "#") {
+			values[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+	return values
+}
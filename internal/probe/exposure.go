@@ -0,0 +1,220 @@
+package probe
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/postfix/cctvscan/internal/util"
+)
+
+// Exposure finding kinds
+const (
+	ExposureUnauthenticatedAdmin = "unauthenticated-admin" // Admin page served without credentials
+	ExposureDirectoryListing     = "directory-listing"
+	ExposureConfigBackup         = "config-backup" // Configuration file downloadable without credentials
+	ExposurePermissiveCORS       = "permissive-cors"
+	ExposureFramable             = "framable" // Neither X-Frame-Options nor CSP frame-ancestors
+)
+
+// ExposureFinding is one security relevant observation about a web UI
+type ExposureFinding struct {
+	Kind     string // One of the Exposure* constants
+	Severity string // high, medium or low
+	URL      string
+	Detail   string
+}
+
+func (f ExposureFinding) String() string {
+	return f.Severity + " " + f.Kind + ": " + f.URL + " (" + f.Detail + ")"
+}
+
+// exposureAdminPaths are administration pages that must never answer 200 without
+// credentials
+var exposureAdminPaths = []string{
+	"/admin/", "/admin.html", "/setup.html", "/config.html", "/cgi-bin/admin/", "/webadmin/",
+	"/system.html", "/maintenance.html",
+}
+
+// exposureBackupPaths are configuration exports and backups left on the web root.
+// /System/configurationFile is the Hikvision export that CVE-2017-7921 leaks.
+var exposureBackupPaths = []string{
+	"/config", "/system.ini", "/config.bin", "/config.dat", "/backup.cfg", "/config.tar.gz",
+	"/System/configurationFile", "/cgi-bin/config.bin",
+}
+
+// exposureListingPaths are directories that some firmwares serve as listings
+var exposureListingPaths = []string{"/doc/", "/log/", "/tmp/", "/snapshot/", "/record/"}
+
+// exposureProbeOrigin is sent as Origin to see whether it is reflected
+const exposureProbeOrigin = "https://cctvscan.invalid"
+
+// soft404Path doesn't exist on any device; a 200 for it means the web server
+// answers every path with its SPA or login page
+const soft404Path = "/cctvscan-does-not-exist.html"
+
+var (
+	listingRe  = regexp.MustCompile(`(?i)<title>\s*(index of|directory listing for)\s|\[to parent directory\]`)
+	passwordRe = regexp.MustCompile(`(?i)type\s*=\s*["']?password`)
+)
+
+// AuditHTTPExposure checks the web UI on each port for admin pages served without
+// credentials, directory listings, downloadable configuration backups, permissive
+// CORS and missing framing protection. Findings are in port order.
+func AuditHTTPExposure(ctx context.Context, host string, ports []int) []ExposureFinding {
+	found := make(map[int][]ExposureFinding)
+	var mu sync.Mutex
+
+	client := ConfigFrom(ctx).HTTP.Client()
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse // A redirect to the login page isn't exposure
+	}
+
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, 5) // Limit concurrent ports
+
+	for _, port := range ports {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			base := DetectScheme(ctx, host, p) + "://" + net.JoinHostPort(host, util.Itoa(p))
+			findings := auditPort(ctx, client, base)
+			mu.Lock()
+			found[p] = findings
+			mu.Unlock()
+		}(port)
+	}
+	wg.Wait()
+
+	var out []ExposureFinding
+	for _, p := range ports {
+		out = append(out, found[p]...)
+	}
+	return out
+}
+
+// auditPort runs every exposure check against the web server at base
+func auditPort(ctx context.Context, client *http.Client, base string) []ExposureFinding {
+	var findings []ExposureFinding
+
+	// Header checks on the root page
+	status, header, body, err := exposureGet(ctx, client, base+"/")
+	if err != nil {
+		return nil
+	}
+	if status == http.StatusOK {
+		if listingRe.MatchString(body) {
+			findings = append(findings, ExposureFinding{Kind: ExposureDirectoryListing, Severity: "medium",
+				URL: base + "/", Detail: "directory index served"})
+		}
+		if f, ok := corsFinding(base+"/", header); ok {
+			findings = append(findings, f)
+		}
+		if f, ok := framingFinding(base+"/", header); ok {
+			findings = append(findings, f)
+		}
+	}
+
+	// Servers that answer 200 for anything can't be judged by status code
+	soft404, _, _, _ := exposureGet(ctx, client, base+soft404Path)
+	catchAll := soft404 == http.StatusOK
+
+	for _, path := range exposureListingPaths {
+		if ctx.Err() != nil {
+			return findings
+		}
+		status, _, body, err := exposureGet(ctx, client, base+path)
+		if err == nil && status == http.StatusOK && listingRe.MatchString(body) {
+			findings = append(findings, ExposureFinding{Kind: ExposureDirectoryListing, Severity: "medium",
+				URL: base + path, Detail: "directory index served"})
+		}
+	}
+	if catchAll {
+		return findings
+	}
+
+	for _, path := range exposureAdminPaths {
+		if ctx.Err() != nil {
+			return findings
+		}
+		status, _, body, err := exposureGet(ctx, client, base+path)
+		if err == nil && status == http.StatusOK && strings.TrimSpace(body) != "" && !passwordRe.MatchString(body) {
+			findings = append(findings, ExposureFinding{Kind: ExposureUnauthenticatedAdmin, Severity: "high",
+				URL: base + path, Detail: "200 without credentials and no login form"})
+		}
+	}
+	for _, path := range exposureBackupPaths {
+		if ctx.Err() != nil {
+			return findings
+		}
+		status, header, body, err := exposureGet(ctx, client, base+path)
+		if err != nil || status != http.StatusOK || body == "" {
+			continue
+		}
+		// Login and error pages come back as HTML; exports don't
+		if strings.Contains(strings.ToLower(header.Get("Content-Type")), "html") || strings.HasPrefix(strings.TrimSpace(body), "<") {
+			continue
+		}
+		findings = append(findings, ExposureFinding{Kind: ExposureConfigBackup, Severity: "high",
+			URL: base + path, Detail: "downloadable as " + contentTypeOrUnknown(header)})
+	}
+	return findings
+}
+
+// corsFinding flags a wildcard or reflected Access-Control-Allow-Origin; with
+// credentials allowed any web page can drive the UI with the viewer's session
+func corsFinding(url string, header http.Header) (ExposureFinding, bool) {
+	origin := header.Get("Access-Control-Allow-Origin")
+	if origin != "*" && origin != exposureProbeOrigin {
+		return ExposureFinding{}, false
+	}
+	f := ExposureFinding{Kind: ExposurePermissiveCORS, Severity: "low", URL: url, Detail: "Access-Control-Allow-Origin: " + origin}
+	if origin == exposureProbeOrigin {
+		f.Detail = "Origin reflected in Access-Control-Allow-Origin"
+		if strings.EqualFold(header.Get("Access-Control-Allow-Credentials"), "true") {
+			f.Severity = "medium"
+			f.Detail += " with credentials allowed"
+		}
+	}
+	return f, true
+}
+
+// framingFinding flags pages that any site may embed, enabling clickjacking
+func framingFinding(url string, header http.Header) (ExposureFinding, bool) {
+	if header.Get("X-Frame-Options") != "" || strings.Contains(strings.ToLower(header.Get("Content-Security-Policy")), "frame-ancestors") {
+		return ExposureFinding{}, false
+	}
+	return ExposureFinding{Kind: ExposureFramable, Severity: "low", URL: url,
+		Detail: "no X-Frame-Options or CSP frame-ancestors"}, true
+}
+
+// exposureGet fetches url with the probe Origin and returns up to 8 KiB of the body
+func exposureGet(ctx context.Context, client *http.Client, url string) (int, http.Header, string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return 0, nil, "", err
+	}
+	req.Header.Set("User-Agent", "CCTVTool/1.0")
+	req.Header.Set("Origin", exposureProbeOrigin)
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, nil, "", err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 8192))
+	return resp.StatusCode, resp.Header, string(body), nil
+}
+
+func contentTypeOrUnknown(header http.Header) string {
+	if ct := header.Get("Content-Type"); ct != "" {
+		return ct
+	}
+	return "unknown content type"
+}
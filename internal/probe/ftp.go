@@ -0,0 +1,106 @@
+package probe
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/postfix/cctvscan/internal/util"
+)
+
+// FTPPorts are the ports checked for an FTP server
+var FTPPorts = []int{21}
+
+// FTPInfo is the FTP greeting and whether anonymous login is accepted
+type FTPInfo struct {
+	Port      int
+	Banner    string // 220 greeting, e.g. "220 Hikvision FTP server ready"
+	Anonymous bool   // USER anonymous was logged in
+}
+
+// Found reports whether an FTP server greeted us
+func (f FTPInfo) Found() bool { return f.Banner != "" }
+
+// FilterFTP returns the FTP ports among ports
+func FilterFTP(ports []int) []int {
+	var out []int
+	for _, p := range ports {
+		if util.PortIn(FTPPorts, p) {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// ProbeFTP reads the greeting of the first FTP port that answers and tries an
+// anonymous login. Cameras use FTP for footage export, so an anonymous login usually
+// means recordings are readable by anyone.
+func ProbeFTP(ctx context.Context, host string, ports []int) FTPInfo {
+	for _, p := range ports {
+		if ctx.Err() != nil {
+			break // host budget spent
+		}
+		if info := checkFTP(ctx, net.JoinHostPort(host, util.Itoa(p))); info.Found() {
+			info.Port = p
+			return info
+		}
+	}
+	return FTPInfo{}
+}
+
+// checkFTP greets addr and attempts USER anonymous / PASS anonymous@
+func checkFTP(ctx context.Context, addr string) FTPInfo {
+	var info FTPInfo
+	t := ConfigFrom(ctx).FTP
+	conn, err := t.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return info
+	}
+	defer conn.Close()
+	conn.SetDeadline(t.Deadline())
+
+	br := bufio.NewReader(conn)
+	code, text, err := readFTPReply(br)
+	if err != nil || code != 220 {
+		return info
+	}
+	info.Banner = text
+
+	fmt.Fprintf(conn, "USER anonymous\r\n")
+	code, _, err = readFTPReply(br)
+	if err == nil && code == 331 {
+		fmt.Fprintf(conn, "PASS anonymous@\r\n")
+		code, _, err = readFTPReply(br)
+	}
+	info.Anonymous = err == nil && code == 230
+	fmt.Fprintf(conn, "QUIT\r\n")
+	return info
+}
+
+// readFTPReply reads a single or multi-line reply (RFC 959 4.2) and returns its code
+// and text, with the lines joined by " | "
+func readFTPReply(br *bufio.Reader) (int, string, error) {
+	var lines []string
+	for first := ""; len(lines) < 32; {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return 0, "", err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if len(line) < 3 {
+			lines = append(lines, line)
+			continue
+		}
+		if first == "" {
+			first = line[:3]
+		}
+		lines = append(lines, line)
+		// The last line repeats the code followed by a space
+		if line[:3] == first && (len(line) == 3 || line[3] == ' ') {
+			return util.Atoi(first), strings.Join(lines, " | "), nil
+		}
+	}
+	return 0, "", fmt.Errorf("FTP reply too long")
+}
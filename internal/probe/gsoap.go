@@ -0,0 +1,125 @@
+package probe
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/postfix/cctvscan/internal/util"
+)
+
+// DevilsIvyCVE is the gSOAP stack overflow in soap_get_* of gSOAP 2.7 to 2.8.47
+const DevilsIvyCVE = "CVE-2017-9765"
+
+// gsoapFixedVersion is the first gSOAP release without Devil's Ivy
+const gsoapFixedVersion = "2.8.48"
+
+// GSOAPInfo is a web service identified as gSOAP, usually the ONVIF device service
+type GSOAPInfo struct {
+	URL      string
+	Version  string // e.g. "2.8" from the Server header; often without the patch level
+	Evidence string // Server header or fault string that gave gSOAP away
+}
+
+// Found reports whether a gSOAP endpoint was identified
+func (g GSOAPInfo) Found() bool { return g.URL != "" }
+
+// DevilsIvy classifies the endpoint against CVE-2017-9765: "vulnerable" for a version
+// up to 2.8.47, "patched" from 2.8.48, "possible" when only gSOAP 2.7/2.8 without a
+// patch level is known, and "" when nothing was found.
+func (g GSOAPInfo) DevilsIvy() string {
+	switch {
+	case !g.Found():
+		return ""
+	case g.Version == "" || g.Version == "2.7" || g.Version == "2.8":
+		return "possible"
+	case compareVersions(g.Version, "2.7") < 0:
+		return "" // gSOAP 2.6 and older predate the vulnerable code
+	case compareVersions(g.Version, gsoapFixedVersion) < 0:
+		return "vulnerable"
+	default:
+		return "patched"
+	}
+}
+
+var gsoapVersionRe = regexp.MustCompile(`(?i)gsoap/(\d+(?:\.\d+)*)`)
+
+// gsoapNoMethod is how gSOAP rejects an operation it doesn't implement; other SOAP
+// stacks word it differently
+const gsoapNoMethod = "not implemented: method name or namespace not recognized"
+
+// ProbeGSOAP asks the ONVIF device service on each port for an operation that
+// doesn't exist and identifies gSOAP from the Server header or the wording of the
+// fault. Nothing oversized is sent: the check is safe on vulnerable devices.
+func ProbeGSOAP(ctx context.Context, host string, ports []int) GSOAPInfo {
+	client := ConfigFrom(ctx).ONVIF.Client()
+	for _, p := range onvifCandidatePorts(ports) {
+		if ctx.Err() != nil {
+			break
+		}
+		url := DetectScheme(ctx, host, p) + "://" + net.JoinHostPort(host, util.Itoa(p)) + onvifDeviceServicePath
+		if info, ok := gsoapFault(ctx, client, url); ok {
+			return info
+		}
+	}
+	return GSOAPInfo{}
+}
+
+// gsoapFault posts a call to an unknown operation and inspects the fault
+func gsoapFault(ctx context.Context, client *http.Client, url string) (GSOAPInfo, bool) {
+	envelope := `<?xml version="1.0" encoding="UTF-8"?>
+<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope" xmlns:tds="http://www.onvif.org/ver10/device/wsdl"><s:Body><tds:CctvscanNoSuchOperation/></s:Body></s:Envelope>`
+	req, err := http.NewRequestWithContext(ctx, "POST", url, strings.NewReader(envelope))
+	if err != nil {
+		return GSOAPInfo{}, false
+	}
+	req.Header.Set("Content-Type", `application/soap+xml; charset=utf-8`)
+	req.Header.Set("User-Agent", "CCTVTool/1.0")
+	resp, err := client.Do(req)
+	if err != nil {
+		return GSOAPInfo{}, false
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 16*1024))
+
+	info := GSOAPInfo{URL: url}
+	server := resp.Header.Get("Server")
+	if m := gsoapVersionRe.FindStringSubmatch(server); m != nil {
+		info.Version, info.Evidence = m[1], "Server: "+server
+		return info, true
+	}
+	if m := gsoapVersionRe.FindSubmatch(body); m != nil {
+		info.Version, info.Evidence = string(m[1]), "fault mentions "+string(m[0])
+		return info, true
+	}
+	if strings.Contains(strings.ToLower(string(body)), gsoapNoMethod) {
+		info.Evidence = "gSOAP \"method not recognized\" fault"
+		return info, true
+	}
+	return GSOAPInfo{}, false
+}
+
+// compareVersions compares dotted numeric versions, e.g. 2.8.4 < 2.8.47; missing
+// components count as 0
+func compareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < max(len(as), len(bs)); i++ {
+		var x, y int
+		if i < len(as) {
+			x = util.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y = util.Atoi(bs[i])
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,109 @@
+package probe
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/postfix/cctvscan/internal/util"
+)
+
+// HLSPaths contains common HLS playlist paths of cameras, NVRs and streaming gateways
+var HLSPaths = []string{
+	"/live.m3u8", "/hls/stream.m3u8", "/hls/live.m3u8", "/hls/index.m3u8", "/stream.m3u8",
+	"/index.m3u8", "/playlist.m3u8", "/live/index.m3u8", "/streaming/channels/101.m3u8",
+	"/Streaming/Channels/101.m3u8",
+}
+
+// maxPlaylistSize bounds the playlist read; only the first tags are needed
+const maxPlaylistSize = 8192
+
+// FindHLSStreams GETs every HLSPaths entry on each HTTP port and returns the URLs that
+// serve a valid playlist, in port and HLSPaths order
+func FindHLSStreams(ctx context.Context, host string, ports []int) []string {
+	type job struct{ port, idx int }
+	found := make(map[job]string)
+	var mu sync.Mutex
+
+	client := ConfigFrom(ctx).HTTP.Client()
+	// Gateways redirect to a session specific playlist; don't follow off-host
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 3 || req.URL.Hostname() != host {
+			return http.ErrUseLastResponse
+		}
+		return nil
+	}
+
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, 5) // Limit concurrent requests
+
+	for _, port := range ports {
+		scheme := DetectScheme(ctx, host, port)
+		baseURL := scheme + "://" + net.JoinHostPort(host, util.Itoa(port))
+		for i, path := range HLSPaths {
+			wg.Add(1)
+			go func(j job, url string) {
+				defer wg.Done()
+				semaphore <- struct{}{}
+				defer func() { <-semaphore }()
+				if ctx.Err() != nil {
+					return // host budget spent
+				}
+
+				req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+				if err != nil {
+					return
+				}
+				req.Header.Set("User-Agent", "CCTVTool/1.0")
+				resp, err := client.Do(req)
+				if err != nil {
+					return
+				}
+				defer resp.Body.Close()
+				if resp.StatusCode != 200 {
+					return
+				}
+				body, _ := io.ReadAll(io.LimitReader(resp.Body, maxPlaylistSize))
+				if IsHLSPlaylist(string(body)) {
+					mu.Lock()
+					found[j] = url
+					mu.Unlock()
+				}
+			}(job{port, i}, baseURL+path)
+		}
+	}
+	wg.Wait()
+
+	var out []string
+	for _, p := range ports {
+		for i := range HLSPaths {
+			if url, ok := found[job{p, i}]; ok {
+				out = append(out, url)
+			}
+		}
+	}
+	return out
+}
+
+// IsHLSPlaylist reports whether body is an M3U8 media or master playlist: #EXTM3U on
+// the first line (RFC 8216 4.3.1.1) followed by a segment or variant stream tag.
+// Plain M3U files and HTML error pages don't qualify.
+func IsHLSPlaylist(body string) bool {
+	sc := bufio.NewScanner(strings.NewReader(strings.TrimPrefix(body, "\ufeff")))
+	if !sc.Scan() || strings.TrimSpace(sc.Text()) != "#EXTM3U" {
+		return false
+	}
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		for _, tag := range []string{"#EXTINF:", "#EXT-X-STREAM-INF:", "#EXT-X-TARGETDURATION:"} {
+			if strings.HasPrefix(line, tag) {
+				return true
+			}
+		}
+	}
+	return false
+}
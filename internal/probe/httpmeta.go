@@ -2,11 +2,14 @@ package probe
 
 import (
 	"context"
-	"crypto/tls"
+	"html"
 	"io"
 	"net"
 	"net/http"
+	"net/http/httptrace"
+	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/postfix/cctvscan/internal/util"
@@ -15,6 +18,42 @@ import (
 type HTTPMeta struct {
 	Server      string
 	BodySnippet string
+	Titles      map[int]string   // HTML <title> per port
+	Ports       map[int]PortMeta // Everything captured per port
+}
+
+// PortMeta is what a single HTTP port answered on /
+type PortMeta struct {
+	StatusCode  int
+	Server      string
+	ContentType string
+	ETag        string        // Validator of the page, which depends on the firmware build
+	Language    string        // Content-Language header
+	Title       string
+	Body        string        // Up to ProbeConfig.MaxBodySize bytes, case preserved
+	Redirects   []string      // Redirect targets in order, e.g. /doc/page/login.asp
+	FinalURL    string        // URL that gave the answer above, when redirected
+	TTFB        time.Duration // From sending GET / to the first byte of the answer
+}
+
+// maxRedirects bounds the redirect chain followed from / on each port
+const maxRedirects = 5
+
+// bodySnippetSize is the size of the merged BodySnippet used by the brand heuristics
+const bodySnippetSize = 512
+
+// maxTitleScan is how much of each page is searched for a <title>
+const maxTitleScan = 8192
+
+var titleRe = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+
+// extractTitle returns the page title with entities decoded and whitespace collapsed
+func extractTitle(body []byte) string {
+	m := titleRe.FindSubmatch(body)
+	if m == nil { return "" }
+	title := strings.Join(strings.Fields(html.UnescapeString(string(m[1]))), " ")
+	if r := []rune(title); len(r) > 200 { title = string(r[:200]) }
+	return title
 }
 
 // CameraPorts contains all common camera-related ports
@@ -30,6 +69,12 @@ var CameraPorts = []int{
 	1935, 1936, 1937, 1938, 1939,
 	// ONVIF/discovery
 	3702,
+	// Remote management and footage export
+	21, 22, 23, 2323,
+	// SIP / GB28181
+	5060, 5061,
+	// P2P cloud (XMEye DVRIP/Sofia)
+	34567, 34599,
 	// Miscellaneous
 	37777, 5000,
 }
@@ -80,66 +125,151 @@ func FilterHTTPish(ports []int) []int {
 	return out
 }
 
+// ProbeHTTPMeta GETs / on every port concurrently and keeps what each one served:
+// a router page on 80 mustn't hide the camera app on 8080. Server and BodySnippet
+// come from the first port, in port order, that answered.
 func ProbeHTTPMeta(ctx context.Context, host string, ports []int) HTTPMeta {
 	meta := HTTPMeta{}
-	client := &http.Client{
-		Timeout: 2 * time.Second,
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{ InsecureSkipVerify: true },
-			DisableKeepAlives: true,
-			DialContext: (&net.Dialer{ Timeout: 1200 * time.Millisecond }).DialContext,
-		},
+	found := make(map[int]PortMeta)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, 5) // Limit concurrent ports
+	for _, port := range ports {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+			if ctx.Err() != nil { return } // host budget spent
+			if pm, ok := probePortMeta(ctx, host, p); ok {
+				mu.Lock()
+				found[p] = pm
+				mu.Unlock()
+			}
+		}(port)
 	}
+	wg.Wait()
+
 	for _, p := range ports {
-		scheme := "http"
-		if isHTTPS(p) { scheme="https" }
-		url := scheme + "://" + net.JoinHostPort(host, util.Itoa(p)) + "/"
-		req, _ := http.NewRequestWithContext(ctx, "GET", url, nil)
-		req.Header.Set("User-Agent", "CCTVTool/1.0")
-		resp, err := client.Do(req)
-		if err != nil { continue }
-		if meta.Server == "" {
-			meta.Server = resp.Header.Get("Server")
-		}
+		pm, ok := found[p]
+		if !ok { continue }
+		if meta.Server == "" { meta.Server = pm.Server }
 		if meta.BodySnippet == "" {
-			b, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
-			meta.BodySnippet = strings.ToLower(string(b))
+			meta.BodySnippet = strings.ToLower(pm.Body[:min(len(pm.Body), bodySnippetSize)])
+		}
+		if meta.Ports == nil { meta.Ports = make(map[int]PortMeta) }
+		meta.Ports[p] = pm
+		if pm.Title != "" {
+			if meta.Titles == nil { meta.Titles = make(map[int]string) }
+			meta.Titles[p] = pm.Title
 		}
-		resp.Body.Close()
-		if meta.Server!="" && meta.BodySnippet!="" { break }
 	}
 	return meta
 }
 
-func FindLoginPages(ctx context.Context, host string, ports []int) []string {
-	paths := []string{"/", "/login", "/admin", "/viewer", "/webadmin", "/index.html"}
-	client := &http.Client{
-		Timeout: 1500 * time.Millisecond,
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{ InsecureSkipVerify: true },
-			DisableKeepAlives: true,
-		},
+// probePortMeta GETs / on one port, following redirects on the host itself, e.g.
+// to the HTTPS port; off-host targets (cloud portals) are recorded but not fetched
+func probePortMeta(ctx context.Context, host string, p int) (PortMeta, bool) {
+	cfg := ConfigFrom(ctx)
+	client := cfg.HTTP.Client()
+	var chain []string
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		chain = append(chain, req.URL.String())
+		if len(via) >= maxRedirects || req.URL.Hostname() != host { return http.ErrUseLastResponse }
+		return nil
 	}
-	var out []string
+	scheme := DetectScheme(ctx, host, p)
+	url := scheme + "://" + net.JoinHostPort(host, util.Itoa(p)) + "/"
+	req, _ := http.NewRequestWithContext(ctx, "GET", url, nil)
+	req.Header.Set("User-Agent", "CCTVTool/1.0")
+	var ttfb time.Duration
+	start := time.Now()
+	req = req.WithContext(httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotFirstResponseByte: func() { if ttfb == 0 { ttfb = time.Since(start) } },
+	}))
+	resp, err := client.Do(req)
+	if err != nil { return PortMeta{}, false }
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, int64(max(cfg.MaxBodySize, maxTitleScan))))
+	resp.Body.Close()
+	pm := PortMeta{
+		StatusCode: resp.StatusCode,
+		Server: resp.Header.Get("Server"),
+		ContentType: resp.Header.Get("Content-Type"),
+		ETag: resp.Header.Get("ETag"),
+		Language: resp.Header.Get("Content-Language"),
+		Title: extractTitle(b[:min(len(b), maxTitleScan)]),
+		Body: string(b[:min(len(b), max(cfg.MaxBodySize, 0))]),
+		Redirects: chain,
+		TTFB: ttfb,
+	}
+	if len(chain) > 0 { pm.FinalURL = resp.Request.URL.String() }
+	return pm, true
+}
+
+func FindLoginPages(ctx context.Context, host string, ports []int) []string {
+	pages, _ := FindLoginPagesAuth(ctx, host, ports)
+	return pages
+}
+
+// LoginPage is the answer to HEAD on one candidate login path
+type LoginPage struct {
+	URL         string
+	Status      int
+	ContentType string
+	Auth        AuthChallenge // Preferred WWW-Authenticate challenge, if any
+}
+
+// Protected reports whether the page refused the request or asked for credentials
+func (l LoginPage) Protected() bool {
+	return l.Status == http.StatusUnauthorized || l.Status == http.StatusForbidden || l.Auth.Scheme != ""
+}
+
+// loginPaths are the paths FindLoginPages tries on every port
+var loginPaths = []string{"/", "/login", "/admin", "/viewer", "/webadmin", "/index.html"}
+
+// ProbeLoginPages sends HEAD to the usual login paths on each port and returns the
+// pages that answered 200 or asked for credentials, with status code, content type
+// and challenge, in port and path order
+func ProbeLoginPages(ctx context.Context, host string, ports []int) []LoginPage {
+	client := ConfigFrom(ctx).HTTP.Client()
+	var out []LoginPage
 	for _, p := range ports {
-		scheme := "http"; if isHTTPS(p) { scheme="https" }
+		scheme := DetectScheme(ctx, host, p)
 		base := scheme + "://" + net.JoinHostPort(host, util.Itoa(p))
-		for _, path := range paths {
+		for _, path := range loginPaths {
 			req, _ := http.NewRequestWithContext(ctx, "HEAD", base+path, nil)
 			resp, err := client.Do(req)
 			if err != nil { continue }
 			resp.Body.Close()
-			if resp.StatusCode == 200 {
-				out = append(out, base+path)
-			}
-			if resp.StatusCode==401 || resp.StatusCode==403 || resp.Header.Get("WWW-Authenticate")!="" {
-				out = append(out, base+path)
+			page := LoginPage{URL: base + path, Status: resp.StatusCode, ContentType: resp.Header.Get("Content-Type")}
+			if c, ok := responseChallenge(resp); ok { page.Auth = c }
+			if page.Status == http.StatusOK || page.Protected() {
+				out = append(out, page)
 			}
 		}
 	}
-	return util.Uniq(out)
+	return out
+}
+
+// FindLoginPagesAuth is FindLoginPages that also returns the authentication challenge
+// per protected URL
+func FindLoginPagesAuth(ctx context.Context, host string, ports []int) ([]string, map[string]AuthChallenge) {
+	return LoginPageAuth(ProbeLoginPages(ctx, host, ports))
+}
+
+// LoginPageAuth splits ProbeLoginPages results into URLs and challenges
+func LoginPageAuth(pages []LoginPage) ([]string, map[string]AuthChallenge) {
+	var out []string
+	auth := make(map[string]AuthChallenge)
+	for _, page := range pages {
+		out = append(out, page.URL)
+		if page.Auth.Scheme != "" { auth[page.URL] = page.Auth }
+	}
+	return util.Uniq(out), auth
 }
 
+// isHTTPS reports whether p is a well-known TLS port; DetectScheme falls back to it
+// when a port can't be sniffed.
 func isHTTPS(p int) bool { switch p{ case 443, 8443: return true }; return false }
 
 func isHTTPLikePort(p int) bool {
@@ -151,6 +281,12 @@ func isHTTPLikePort(p int) bool {
 		return false
 	case 3702, 37777: // ONVIF discovery + proprietary DVR
 		return false
+	case 34567, 34599: // XMEye DVRIP/Sofia
+		return false
+	case 21, 22, 23, 2323: // FTP + SSH + telnet
+		return false
+	case 5060, 5061: // SIP / GB28181
+		return false
 	}
 	// all others (web/http-like) → keep
 	return true
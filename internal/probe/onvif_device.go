@@ -0,0 +1,220 @@
+package probe
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/postfix/cctvscan/internal/util"
+)
+
+// ONVIFDeviceInfo is the answer to an ONVIF GetDeviceInformation call
+type ONVIFDeviceInfo struct {
+	Manufacturer    string
+	Model           string
+	FirmwareVersion string
+	SerialNumber    string
+	HardwareID      string
+	URL             string // Device service that answered
+	Authenticated   bool   // The call needed credentials
+}
+
+// Found reports whether any device information was retrieved
+func (d ONVIFDeviceInfo) Found() bool {
+	return d.Manufacturer != "" || d.Model != ""
+}
+
+// ErrONVIFUnauthorized means a device service answered but rejected the request
+var ErrONVIFUnauthorized = errors.New("ONVIF device service requires authentication")
+
+// ErrONVIFLockout means a device service refused a login saying the account or
+// address is locked
+var ErrONVIFLockout = errors.New("ONVIF lockout triggered")
+
+// ONVIFDevicePorts are the usual ONVIF device service ports, tried before other HTTP ports
+var ONVIFDevicePorts = []int{80, 8080, 2020, 8000, 8899}
+
+// onvifDeviceServicePath is the device service endpoint mandated by the ONVIF core spec
+const onvifDeviceServicePath = "/onvif/device_service"
+
+const (
+	getDeviceInformationAction = "http://www.onvif.org/ver10/device/wsdl/GetDeviceInformation"
+	getSystemDateAndTimeAction = "http://www.onvif.org/ver10/device/wsdl/GetSystemDateAndTime"
+)
+
+// ONVIFService is a device service that answered GetSystemDateAndTime, which the core
+// spec requires to work without credentials
+type ONVIFService struct {
+	URL        string
+	DeviceTime time.Time     // Device clock in UTC; zero if not reported
+	TimeZone   string        // POSIX TZ string, e.g. CST-8
+	ClockSkew  time.Duration // DeviceTime minus our clock when the answer arrived
+}
+
+type getSystemDateAndTimeEnvelope struct {
+	Body struct {
+		Response *struct {
+			TimeZone string `xml:"SystemDateAndTime>TimeZone>TZ"`
+			UTC      *struct {
+				Hour   int `xml:"Time>Hour"`
+				Minute int `xml:"Time>Minute"`
+				Second int `xml:"Time>Second"`
+				Year   int `xml:"Date>Year"`
+				Month  int `xml:"Date>Month"`
+				Day    int `xml:"Date>Day"`
+			} `xml:"SystemDateAndTime>UTCDateTime"`
+		} `xml:"GetSystemDateAndTimeResponse"`
+	} `xml:"Body"`
+}
+
+// getDeviceInformationEnvelope matches responses regardless of namespace prefixes
+type getDeviceInformationEnvelope struct {
+	Body struct {
+		Response *struct {
+			Manufacturer    string `xml:"Manufacturer"`
+			Model           string `xml:"Model"`
+			FirmwareVersion string `xml:"FirmwareVersion"`
+			SerialNumber    string `xml:"SerialNumber"`
+			HardwareID      string `xml:"HardwareId"`
+		} `xml:"GetDeviceInformationResponse"`
+	} `xml:"Body"`
+}
+
+// ProbeONVIFDeviceInfo calls GetDeviceInformation on the ONVIF device service of each
+// candidate port until one answers. Without a username the call is unauthenticated;
+// otherwise a WS-Security UsernameToken is sent. ErrONVIFUnauthorized is returned if a
+// device service exists but refused the request.
+func ProbeONVIFDeviceInfo(ctx context.Context, host string, ports []int, username, password string) (ONVIFDeviceInfo, error) {
+	client := ConfigFrom(ctx).ONVIF.Client()
+
+	unauthorized := false
+	for _, p := range onvifCandidatePorts(ports) {
+		if ctx.Err() != nil {
+			break
+		}
+		url := DetectScheme(ctx, host, p) + "://" + net.JoinHostPort(host, util.Itoa(p)) + onvifDeviceServicePath
+		info, err := getDeviceInformation(ctx, client, url, username, password)
+		if errors.Is(err, ErrONVIFUnauthorized) {
+			unauthorized = true
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		return info, nil
+	}
+
+	if unauthorized {
+		return ONVIFDeviceInfo{}, ErrONVIFUnauthorized
+	}
+	return ONVIFDeviceInfo{}, fmt.Errorf("no ONVIF device service found on %s", host)
+}
+
+// ProbeONVIFServices POSTs GetSystemDateAndTime to the device service path of every
+// HTTP port. Many cameras block WS-Discovery but answer ONVIF on plain 80 or 8080.
+func ProbeONVIFServices(ctx context.Context, host string, ports []int) []ONVIFService {
+	client := ConfigFrom(ctx).ONVIF.Client()
+	var out []ONVIFService
+	for _, p := range onvifCandidatePorts(ports) {
+		if ctx.Err() != nil {
+			break
+		}
+		url := DetectScheme(ctx, host, p) + "://" + net.JoinHostPort(host, util.Itoa(p)) + onvifDeviceServicePath
+		if svc, err := getSystemDateAndTime(ctx, client, url); err == nil {
+			out = append(out, svc)
+		}
+	}
+	return out
+}
+
+// getSystemDateAndTime performs a single unauthenticated GetSystemDateAndTime call
+func getSystemDateAndTime(ctx context.Context, client *http.Client, url string) (ONVIFService, error) {
+	var envelope getSystemDateAndTimeEnvelope
+	if err := onvifCall(ctx, client, url, getSystemDateAndTimeAction, `<tds:GetSystemDateAndTime/>`, "", "", &envelope); err != nil {
+		return ONVIFService{}, err
+	}
+	r := envelope.Body.Response
+	if r == nil {
+		return ONVIFService{}, fmt.Errorf("no GetSystemDateAndTimeResponse from %s", url)
+	}
+	svc := ONVIFService{URL: url, TimeZone: strings.TrimSpace(r.TimeZone)}
+	if u := r.UTC; u != nil && u.Year > 0 {
+		svc.DeviceTime = time.Date(u.Year, time.Month(u.Month), u.Day, u.Hour, u.Minute, u.Second, 0, time.UTC)
+		svc.ClockSkew = svc.DeviceTime.Sub(time.Now()).Round(time.Second)
+	}
+	return svc, nil
+}
+
+// onvifCandidatePorts orders the open ports so the usual ONVIF ports come first
+func onvifCandidatePorts(ports []int) []int {
+	var out []int
+	for _, p := range ONVIFDevicePorts {
+		if util.PortIn(ports, p) {
+			out = append(out, p)
+		}
+	}
+	for _, p := range ports {
+		if !util.PortIn(out, p) && isHTTPLikePort(p) {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// getDeviceInformation performs a single GetDeviceInformation SOAP call
+func getDeviceInformation(ctx context.Context, client *http.Client, url, username, password string) (ONVIFDeviceInfo, error) {
+	var envelope getDeviceInformationEnvelope
+	if err := onvifCall(ctx, client, url, getDeviceInformationAction, `<tds:GetDeviceInformation/>`, username, password, &envelope); err != nil {
+		return ONVIFDeviceInfo{}, err
+	}
+	r := envelope.Body.Response
+	if r == nil {
+		return ONVIFDeviceInfo{}, fmt.Errorf("no GetDeviceInformationResponse from %s", url)
+	}
+
+	return ONVIFDeviceInfo{
+		Manufacturer:    strings.TrimSpace(r.Manufacturer),
+		Model:           strings.TrimSpace(r.Model),
+		FirmwareVersion: strings.TrimSpace(r.FirmwareVersion),
+		SerialNumber:    strings.TrimSpace(r.SerialNumber),
+		HardwareID:      strings.TrimSpace(r.HardwareID),
+		URL:             url,
+		Authenticated:   username != "",
+	}, nil
+}
+
+// usernameTokenHeader builds a WS-Security UsernameToken header with a password digest:
+// Base64(SHA1(nonce + created + password))
+func usernameTokenHeader(username, password string) string {
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+	created := time.Now().UTC().Format(time.RFC3339)
+
+	h := sha1.New()
+	h.Write(nonce)
+	h.Write([]byte(created))
+	h.Write([]byte(password))
+	digest := base64.StdEncoding.EncodeToString(h.Sum(nil))
+
+	var b bytes.Buffer
+	b.WriteString(`<s:Header><wsse:Security s:mustUnderstand="1" xmlns:wsse="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-secext-1.0.xsd" xmlns:wsu="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-utility-1.0.xsd">`)
+	b.WriteString(`<wsse:UsernameToken><wsse:Username>`)
+	xml.EscapeText(&b, []byte(username))
+	b.WriteString(`</wsse:Username><wsse:Password Type="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-username-token-profile-1.0#PasswordDigest">`)
+	b.WriteString(digest)
+	b.WriteString(`</wsse:Password><wsse:Nonce EncodingType="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-soap-message-security-1.0#Base64Binary">`)
+	b.WriteString(base64.StdEncoding.EncodeToString(nonce))
+	b.WriteString(`</wsse:Nonce><wsu:Created>`)
+	b.WriteString(created)
+	b.WriteString(`</wsu:Created></wsse:UsernameToken></wsse:Security></s:Header>`)
+	return b.String()
+}
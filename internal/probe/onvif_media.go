@@ -0,0 +1,181 @@
+package probe
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	getCapabilitiesAction = "http://www.onvif.org/ver10/device/wsdl/GetCapabilities"
+	getProfilesAction     = "http://www.onvif.org/ver10/media/wsdl/GetProfiles"
+	getSnapshotURIAction  = "http://www.onvif.org/ver10/media/wsdl/GetSnapshotUri"
+)
+
+// ONVIFSnapshotURI is the snapshot address of one media profile
+type ONVIFSnapshotURI struct {
+	Profile string // Profile token, e.g. Profile_1 or MainStream
+	URI     string
+}
+
+type getCapabilitiesEnvelope struct {
+	Body struct {
+		Response *struct {
+			MediaXAddr string `xml:"Capabilities>Media>XAddr"`
+		} `xml:"GetCapabilitiesResponse"`
+	} `xml:"Body"`
+}
+
+type getProfilesEnvelope struct {
+	Body struct {
+		Response *struct {
+			Profiles []struct {
+				Token string `xml:"token,attr"`
+			} `xml:"Profiles"`
+		} `xml:"GetProfilesResponse"`
+	} `xml:"Body"`
+}
+
+type getSnapshotURIEnvelope struct {
+	Body struct {
+		Response *struct {
+			URI string `xml:"MediaUri>Uri"`
+		} `xml:"GetSnapshotUriResponse"`
+	} `xml:"Body"`
+}
+
+// ProbeONVIFSnapshotURIs enumerates the media profiles behind the device service at
+// deviceURL and asks each for its snapshot URI. Without a username the calls are
+// unauthenticated. Addresses the device reports for itself are rebased onto
+// deviceURL, since cameras behind NAT advertise their internal IP.
+func ProbeONVIFSnapshotURIs(ctx context.Context, deviceURL, username, password string) ([]ONVIFSnapshotURI, error) {
+	client := ConfigFrom(ctx).ONVIF.Client()
+
+	// Most devices serve the media service on the device service endpoint as well,
+	// so a failed GetCapabilities isn't fatal
+	mediaURL := deviceURL
+	var caps getCapabilitiesEnvelope
+	if err := onvifCall(ctx, client, deviceURL, getCapabilitiesAction,
+		`<tds:GetCapabilities><tds:Category>Media</tds:Category></tds:GetCapabilities>`,
+		username, password, &caps); err == nil && caps.Body.Response != nil && caps.Body.Response.MediaXAddr != "" {
+		mediaURL = rebaseURL(strings.TrimSpace(caps.Body.Response.MediaXAddr), deviceURL)
+	} else if errors.Is(err, ErrONVIFUnauthorized) {
+		return nil, err
+	}
+
+	var profiles getProfilesEnvelope
+	if err := onvifCall(ctx, client, mediaURL, getProfilesAction, `<trt:GetProfiles/>`, username, password, &profiles); err != nil {
+		return nil, err
+	}
+	if profiles.Body.Response == nil {
+		return nil, fmt.Errorf("no GetProfilesResponse from %s", mediaURL)
+	}
+
+	var out []ONVIFSnapshotURI
+	seen := make(map[string]bool)
+	for _, p := range profiles.Body.Response.Profiles {
+		if ctx.Err() != nil {
+			break
+		}
+		var snap getSnapshotURIEnvelope
+		req := `<trt:GetSnapshotUri><trt:ProfileToken>` + xmlEscape(p.Token) + `</trt:ProfileToken></trt:GetSnapshotUri>`
+		if err := onvifCall(ctx, client, mediaURL, getSnapshotURIAction, req, username, password, &snap); err != nil {
+			continue // Profiles without a video encoder have no snapshot
+		}
+		if snap.Body.Response == nil || strings.TrimSpace(snap.Body.Response.URI) == "" {
+			continue
+		}
+		uri := rebaseURL(strings.TrimSpace(snap.Body.Response.URI), deviceURL)
+		if !seen[uri] {
+			seen[uri] = true
+			out = append(out, ONVIFSnapshotURI{Profile: p.Token, URI: uri})
+		}
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("no snapshot URI from %s", mediaURL)
+	}
+	return out, nil
+}
+
+// onvifCall posts a SOAP request with the device and media namespaces declared and
+// decodes the answer into v. 401s and authorization faults become ErrONVIFUnauthorized.
+func onvifCall(ctx context.Context, client *http.Client, url, action, body, username, password string, v any) error {
+	header := ""
+	if username != "" {
+		header = usernameTokenHeader(username, password)
+	}
+	envelope := `<?xml version="1.0" encoding="UTF-8"?>
+<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope" xmlns:tds="http://www.onvif.org/ver10/device/wsdl" xmlns:trt="http://www.onvif.org/ver10/media/wsdl">` +
+		header + `<s:Body>` + body + `</s:Body></s:Envelope>`
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, strings.NewReader(envelope))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", `application/soap+xml; charset=utf-8; action="`+action+`"`)
+	req.Header.Set("User-Agent", "CCTVTool/1.0")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		if m, ok := LockoutMarker(data); ok && username != "" {
+			return fmt.Errorf("%w at %s: %d %q", ErrONVIFLockout, url, resp.StatusCode, m)
+		}
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		return ErrONVIFUnauthorized
+	}
+
+	var fault struct {
+		Body struct {
+			Fault *struct {
+				Text string `xml:",innerxml"`
+			} `xml:"Fault"`
+		} `xml:"Body"`
+	}
+	if err := xml.Unmarshal(data, &fault); err != nil {
+		return fmt.Errorf("not an ONVIF response: %w", err)
+	}
+	if f := fault.Body.Fault; f != nil {
+		text := strings.ToLower(f.Text)
+		if m, ok := LockoutMarker([]byte(text)); ok && username != "" {
+			return fmt.Errorf("%w at %s: fault %q", ErrONVIFLockout, url, m)
+		}
+		if strings.Contains(text, "notauthorized") || strings.Contains(text, "not authorized") ||
+			strings.Contains(text, "failedauthentication") {
+			return ErrONVIFUnauthorized
+		}
+		return fmt.Errorf("ONVIF fault from %s", url)
+	}
+	return xml.Unmarshal(data, v)
+}
+
+// rebaseURL moves raw onto the scheme and host of base, keeping its path and query
+func rebaseURL(raw, base string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+	b, err := url.Parse(base)
+	if err != nil {
+		return raw
+	}
+	u.Scheme, u.Host = b.Scheme, b.Host
+	return u.String()
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
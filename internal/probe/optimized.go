@@ -2,78 +2,219 @@ package probe
 
 import (
 	"context"
-	"crypto/tls"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
 	"strings"
 	"sync"
-	"time"
 
 	"github.com/postfix/cctvscan/internal/util"
 )
 
 // OptimizedProbeResult holds all probe results for a host
 type OptimizedProbeResult struct {
-	HTTPMeta    HTTPMeta
-	LoginPages  []string
-	RTSPInfo    RTSPInfo
-	ONVIFResult string
-	MJPEGPaths  []string
+	HTTPMeta      HTTPMeta
+	TLSCerts      map[int]TLSCert         // Certificate per HTTPS port
+	ServerHellos  map[int]ServerHello     // TLS stack fingerprint per HTTPS port
+	HTTPStacks    map[int]HTTPFingerprint // Header order and 404 page per HTTP port
+	LoginPages    []string
+	LoginAuth     map[string]AuthChallenge // Challenge per protected login URL
+	LoginStatus   []LoginPage              // Status code, content type and challenge per login URL
+	RTSPInfo      RTSPInfo
+	RTSPStreams   []RTSPStream          // Streams that play without credentials
+	RTSPAuth      map[int]AuthChallenge // Challenge per RTSP port that answered 401
+	ONVIFInfo     ONVIFInfo             // Unicast WS-Discovery ProbeMatch
+	ONVIFDevice   ONVIFDeviceInfo
+	ONVIFAuth     bool           // The ONVIF device service wants credentials
+	ONVIFServices []ONVIFService // Device services answering over HTTP
+	GSOAP         GSOAPInfo      // ONVIF device service identified as gSOAP
+	ISAPI         ISAPIInfo      // Hikvision ISAPI resources answering without credentials
+	SNMP          SNMPInfo
+	Telnet        map[int]string // Pre-login banner per telnet port
+	SSH           SSHInfo
+	FTP           FTPInfo
+	SIP           SIPInfo
+	MJPEGPaths    []string
+	HLSStreams    []string // Playlist URLs
+	Latency       map[int]PortLatency
+	Exposure      []ExposureFinding // HTTP exposure audit of every web UI
+	Findings      []Finding         // From registered probes without a field of their own
 }
 
-// OptimizedProbe performs all probes concurrently for better performance
+// OptimizedProbe runs every registered Probe concurrently, bounded with the
+// ProbeConfig carried by ctx (see WithConfig)
 func OptimizedProbe(ctx context.Context, host string, ports []int) OptimizedProbeResult {
-	result := OptimizedProbeResult{}
-
-	// Filter ports once
-	httpPorts := FilterHTTPish(ports)
-	rtspPorts := FilterRTSP(ports)
+	probes := Probes()
+	findings := make([]Findings, len(probes))
 
 	// Use WaitGroup for concurrent processing
 	var wg sync.WaitGroup
+	for i, p := range probes {
+		selected := p.Ports(ports)
+		if len(selected) == 0 {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, p Probe) {
+			defer wg.Done()
+			findings[i] = p.Run(ctx, host, selected)
+		}(i, p)
+	}
+	wg.Wait()
+
+	// Recorded in registration order, so the result doesn't depend on timing
+	result := OptimizedProbeResult{}
+	for _, f := range findings {
+		if f != nil {
+			f.Record(&result)
+		}
+	}
+	return result
+}
 
+// The built-in probes, in the order their results are recorded
+func init() {
 	// HTTP metadata probe
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		result.HTTPMeta = ProbeHTTPMeta(ctx, host, httpPorts)
-	}()
+	Register(NewProbe("http-meta", FilterHTTPish, func(ctx context.Context, host string, ports []int) Findings {
+		meta := ProbeHTTPMeta(ctx, host, ports)
+		return RecordFunc(func(r *OptimizedProbeResult) { r.HTTPMeta = meta })
+	}))
+
+	// Certificates of the HTTPS ports
+	Register(NewProbe("tls-cert", FilterHTTPish, func(ctx context.Context, host string, ports []int) Findings {
+		certs := ProbeTLSCerts(ctx, host, ports)
+		return RecordFunc(func(r *OptimizedProbeResult) { r.TLSCerts = certs })
+	}))
+
+	// JA3S/JA4S fingerprints of the HTTPS ports
+	Register(NewProbe("tls-hello", FilterHTTPish, func(ctx context.Context, host string, ports []int) Findings {
+		hellos := ProbeServerHellos(ctx, host, ports)
+		return RecordFunc(func(r *OptimizedProbeResult) { r.ServerHellos = hellos })
+	}))
+
+	// Header order and 404 page of the web servers
+	Register(NewProbe("http-fingerprint", FilterHTTPish, func(ctx context.Context, host string, ports []int) Findings {
+		stacks := ProbeHTTPFingerprints(ctx, host, ports)
+		return RecordFunc(func(r *OptimizedProbeResult) { r.HTTPStacks = stacks })
+	}))
 
 	// Login pages probe
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		result.LoginPages = FindLoginPages(ctx, host, httpPorts)
-	}()
+	Register(NewProbe("login-pages", FilterHTTPish, func(ctx context.Context, host string, ports []int) Findings {
+		status := ProbeLoginPages(ctx, host, ports)
+		return RecordFunc(func(r *OptimizedProbeResult) {
+			r.LoginStatus = status
+			r.LoginPages, r.LoginAuth = LoginPageAuth(status)
+		})
+	}))
 
 	// RTSP probe
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		if len(rtspPorts) > 0 {
-			result.RTSPInfo = ProbeRTSP(ctx, host, rtspPorts)
+	Register(NewProbe("rtsp", FilterRTSP, func(ctx context.Context, host string, ports []int) Findings {
+		info := ProbeRTSP(ctx, host, ports)
+		return RecordFunc(func(r *OptimizedProbeResult) { r.RTSPInfo = info })
+	}))
+
+	// RTSP stream path enumeration
+	Register(NewProbe("rtsp-paths", FilterRTSP, func(ctx context.Context, host string, ports []int) Findings {
+		streams, auth := EnumerateRTSPPaths(ctx, host, ports)
+		if ConfigFrom(ctx).VerifyRTP {
+			VerifyRTSPStreams(ctx, streams)
 		}
-	}()
-
-	// ONVIF probe
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		result.ONVIFResult = ProbeONVIF(ctx, host)
-	}()
-
-	// MJPEG paths probe
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		if len(httpPorts) > 0 {
-			result.MJPEGPaths = FindMJPEGPaths(ctx, host, httpPorts)
+		return RecordFunc(func(r *OptimizedProbeResult) { r.RTSPStreams, r.RTSPAuth = streams, auth })
+	}))
+
+	// ONVIF WS-Discovery over UDP 3702, which the TCP port scan never sees
+	Register(NewProbe("onvif-discovery", nil, func(ctx context.Context, host string, ports []int) Findings {
+		info := ProbeONVIF(ctx, host)
+		return RecordFunc(func(r *OptimizedProbeResult) { r.ONVIFInfo = info })
+	}))
+
+	// ONVIF GetDeviceInformation over the HTTP ports
+	Register(NewProbe("onvif-device", FilterHTTPish, func(ctx context.Context, host string, ports []int) Findings {
+		device, err := ProbeONVIFDeviceInfo(ctx, host, ports, "", "")
+		return RecordFunc(func(r *OptimizedProbeResult) {
+			r.ONVIFDevice = device
+			r.ONVIFAuth = errors.Is(err, ErrONVIFUnauthorized)
+		})
+	}))
+
+	// ONVIF GetSystemDateAndTime on every HTTP port, for devices that ignore WS-Discovery
+	Register(NewProbe("onvif-services", FilterHTTPish, func(ctx context.Context, host string, ports []int) Findings {
+		services := ProbeONVIFServices(ctx, host, ports)
+		return RecordFunc(func(r *OptimizedProbeResult) { r.ONVIFServices = services })
+	}))
+
+	// gSOAP behind the ONVIF device service, for Devil's Ivy (CVE-2017-9765)
+	Register(NewProbe("gsoap", FilterHTTPish, func(ctx context.Context, host string, ports []int) Findings {
+		info := ProbeGSOAP(ctx, host, ports)
+		return RecordFunc(func(r *OptimizedProbeResult) { r.GSOAP = info })
+	}))
+
+	// Hikvision ISAPI resources and, when enabled, the CVE-2017-7921 bypass
+	Register(NewProbe("isapi", FilterHTTPish, func(ctx context.Context, host string, ports []int) Findings {
+		info := ProbeISAPI(ctx, host, ports)
+		return RecordFunc(func(r *OptimizedProbeResult) { r.ISAPI = info })
+	}))
+
+	// SNMP system group over UDP 161
+	Register(NewProbe("snmp", nil, func(ctx context.Context, host string, ports []int) Findings {
+		if ConfigFrom(ctx).SNMPCommunity == "" {
+			return nil
+		}
+		info, _ := ProbeSNMP(ctx, host)
+		return RecordFunc(func(r *OptimizedProbeResult) { r.SNMP = info })
+	}))
+
+	// Telnet banners, only when asked for
+	Register(NewProbe("telnet", FilterTelnet, func(ctx context.Context, host string, ports []int) Findings {
+		if !ConfigFrom(ctx).EnableTelnet {
+			return nil
 		}
-	}()
+		banners := ProbeTelnet(ctx, host, ports)
+		return RecordFunc(func(r *OptimizedProbeResult) { r.Telnet = banners })
+	}))
+
+	// SSH version string and host key
+	Register(NewProbe("ssh", FilterSSH, func(ctx context.Context, host string, ports []int) Findings {
+		info := ProbeSSH(ctx, host, ports)
+		return RecordFunc(func(r *OptimizedProbeResult) { r.SSH = info })
+	}))
+
+	// FTP greeting and anonymous login
+	Register(NewProbe("ftp", FilterFTP, func(ctx context.Context, host string, ports []int) Findings {
+		info := ProbeFTP(ctx, host, ports)
+		return RecordFunc(func(r *OptimizedProbeResult) { r.FTP = info })
+	}))
+
+	// SIP / GB28181; UDP 5060 is tried when the TCP scan found no SIP port
+	Register(NewProbe("sip", nil, func(ctx context.Context, host string, ports []int) Findings {
+		info := ProbeSIP(ctx, host, FilterSIP(ports))
+		return RecordFunc(func(r *OptimizedProbeResult) { r.SIP = info })
+	}))
 
-	wg.Wait()
-	return result
+	// MJPEG paths probe
+	Register(NewProbe("mjpeg", FilterHTTPish, func(ctx context.Context, host string, ports []int) Findings {
+		paths := FindMJPEGPaths(ctx, host, ports)
+		return RecordFunc(func(r *OptimizedProbeResult) { r.MJPEGPaths = paths })
+	}))
+
+	// Connect latency and availability of every port
+	Register(NewProbe("latency", nil, func(ctx context.Context, host string, ports []int) Findings {
+		latency := MeasureLatency(ctx, host, ports)
+		return RecordFunc(func(r *OptimizedProbeResult) { r.Latency = latency })
+	}))
+
+	// Admin pages, listings, backups and headers of every web UI
+	Register(NewProbe("http-exposure", FilterHTTPish, func(ctx context.Context, host string, ports []int) Findings {
+		exposure := AuditHTTPExposure(ctx, host, ports)
+		return RecordFunc(func(r *OptimizedProbeResult) { r.Exposure = exposure })
+	}))
+
+	// HLS playlists
+	Register(NewProbe("hls", FilterHTTPish, func(ctx context.Context, host string, ports []int) Findings {
+		streams := FindHLSStreams(ctx, host, ports)
+		return RecordFunc(func(r *OptimizedProbeResult) { r.HLSStreams = streams })
+	}))
 }
 
 // FindMJPEGPaths efficiently finds MJPEG stream paths
@@ -81,16 +222,7 @@ func FindMJPEGPaths(ctx context.Context, host string, ports []int) []string {
 	var foundPaths []string
 	var mu sync.Mutex
 
-	// Create optimized HTTP client
-	client := &http.Client{
-		Timeout: 2 * time.Second,
-		Transport: &http.Transport{
-			TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
-			DisableKeepAlives: true,
-			MaxIdleConns:      10,
-			IdleConnTimeout:   30 * time.Second,
-		},
-	}
+	client := ConfigFrom(ctx).HTTP.Client()
 
 	// Process ports concurrently
 	var wg sync.WaitGroup
@@ -103,10 +235,7 @@ func FindMJPEGPaths(ctx context.Context, host string, ports []int) []string {
 			semaphore <- struct{}{}        // Acquire semaphore
 			defer func() { <-semaphore }() // Release semaphore
 
-			scheme := "http"
-			if isHTTPS(p) {
-				scheme = "https"
-			}
+			scheme := DetectScheme(ctx, host, p)
 			baseURL := scheme + "://" + net.JoinHostPort(host, util.Itoa(p))
 
 			// Test MJPEG paths concurrently
@@ -200,15 +329,8 @@ func OptimizedLoginPageFinder(ctx context.Context, host string, ports []int) []s
 	var mu sync.Mutex
 
 	// Optimized HTTP client
-	client := &http.Client{
-		Timeout: 1 * time.Second, // Shorter timeout for faster scanning
-		Transport: &http.Transport{
-			TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
-			DisableKeepAlives: true,
-			MaxIdleConns:      20,
-			IdleConnTimeout:   10 * time.Second,
-		},
-	}
+	client := ConfigFrom(ctx).HTTP.Client()
+	client.Timeout /= 2 // Shorter timeout for faster scanning
 
 	// Use semaphore to limit concurrent requests
 	semaphore := make(chan struct{}, 10)
@@ -221,10 +343,7 @@ func OptimizedLoginPageFinder(ctx context.Context, host string, ports []int) []s
 			semaphore <- struct{}{}
 			defer func() { <-semaphore }()
 
-			scheme := "http"
-			if isHTTPS(p) {
-				scheme = "https"
-			}
+			scheme := DetectScheme(ctx, host, p)
 			baseURL := scheme + "://" + net.JoinHostPort(host, util.Itoa(p))
 
 			// Test login paths concurrently
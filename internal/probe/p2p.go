@@ -0,0 +1,142 @@
+package probe
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"maps"
+	"net"
+	"slices"
+	"strings"
+
+	"github.com/postfix/cctvscan/internal/util"
+)
+
+// P2PIndicator is evidence that a device is enrolled in a vendor P2P cloud. Such
+// devices are reachable through the vendor relay whatever the firewall allows inbound.
+type P2PIndicator struct {
+	Service  string // Hik-Connect, Dahua P2P or XMEye
+	Evidence string // e.g. "port 34567 open", "EZVIZ enabled, registered"
+	Enabled  bool   // Confirmed by the device configuration, not just inferred
+}
+
+func (p P2PIndicator) String() string {
+	s := p.Service + ": " + p.Evidence
+	if p.Enabled {
+		s += " (enabled)"
+	}
+	return s
+}
+
+// p2pPorts are ports only P2P-enrolled device families listen on
+var p2pPorts = map[int]string{
+	34567: "XMEye", // Xiongmai DVRIP/Sofia, paired with the XMEye cloud
+	34599: "XMEye",
+}
+
+// p2pKeywords are web UI markers of the P2P clients, matched case-insensitively
+var p2pKeywords = []struct {
+	keyword string
+	service string
+}{
+	{"hik-connect", "Hik-Connect"},
+	{"ezviz", "Hik-Connect"},
+	{"easy4ip", "Dahua P2P"},
+	{"imou", "Dahua P2P"},
+	{"xmeye", "XMEye"},
+	{"netsurveillance", "XMEye"},
+	{"cloudlinks", "XMEye"},
+}
+
+// P2PIndicatorsFromScan looks for P2P ports among the open ports and P2P client
+// markers in the captured HTTP pages
+func P2PIndicatorsFromScan(ports []int, meta HTTPMeta) []P2PIndicator {
+	var out []P2PIndicator
+	for _, p := range slices.Sorted(slices.Values(ports)) {
+		if service, ok := p2pPorts[p]; ok {
+			out = appendP2P(out, P2PIndicator{Service: service, Evidence: "port " + util.Itoa(p) + " open"})
+		}
+	}
+	for _, p := range slices.Sorted(maps.Keys(meta.Ports)) {
+		body := strings.ToLower(meta.Ports[p].Body)
+		for _, k := range p2pKeywords {
+			if strings.Contains(body, k.keyword) {
+				out = appendP2P(out, P2PIndicator{Service: k.service, Evidence: "web UI on port " + util.Itoa(p) + " mentions " + k.keyword})
+			}
+		}
+	}
+	return out
+}
+
+// appendP2P keeps the first piece of evidence per service
+func appendP2P(out []P2PIndicator, p P2PIndicator) []P2PIndicator {
+	if slices.ContainsFunc(out, func(o P2PIndicator) bool { return o.Service == p.Service }) {
+		return out
+	}
+	return append(out, p)
+}
+
+type hikvisionEZVIZ struct {
+	XMLName        xml.Name
+	Enabled        bool   `xml:"enabled"`
+	RegisterStatus bool   `xml:"registerStatus"`
+	HostName       string `xml:"serverAddress>hostName"`
+}
+
+// ProbeP2PStatus reads the P2P settings of brand on each HTTP port: Hikvision ISAPI
+// EZVIZ (Hik-Connect) or the Dahua T2UServer config. Both usually want credentials;
+// ErrDeviceUnauthorized is returned when they were refused.
+func ProbeP2PStatus(ctx context.Context, host string, ports []int, brand, username, password string) (P2PIndicator, error) {
+	var path string
+	switch strings.ToLower(brand) {
+	case "hikvision":
+		path = "/ISAPI/System/Network/EZVIZ"
+	case "dahua":
+		path = "/cgi-bin/configManager.cgi?action=getConfig&name=T2UServer"
+	default:
+		return P2PIndicator{}, errors.New("no P2P status endpoint for " + brand)
+	}
+	client := ConfigFrom(ctx).HTTP.Client()
+	err := errors.New("no P2P status from " + host)
+	for _, p := range ports {
+		if ctx.Err() != nil {
+			break
+		}
+		url := DetectScheme(ctx, host, p) + "://" + net.JoinHostPort(host, util.Itoa(p)) + path
+		body, _, e := getDeviceInfo(ctx, client, "GET", url, "", username, password)
+		if e != nil {
+			if errors.Is(e, ErrDeviceUnauthorized) {
+				err = e
+			}
+			continue
+		}
+		if strings.ToLower(brand) == "hikvision" {
+			var ezviz hikvisionEZVIZ
+			if xml.Unmarshal(body, &ezviz) != nil || ezviz.XMLName.Local != "EZVIZ" {
+				continue
+			}
+			evidence := "EZVIZ disabled"
+			if ezviz.Enabled {
+				evidence = "EZVIZ enabled"
+				if ezviz.RegisterStatus {
+					evidence += ", registered"
+				}
+				if ezviz.HostName != "" {
+					evidence += " with " + ezviz.HostName
+				}
+			}
+			return P2PIndicator{Service: "Hik-Connect", Evidence: evidence, Enabled: ezviz.Enabled}, nil
+		}
+		values := parseKeyValues(body)
+		enable, ok := values["table.T2UServer.Enable"]
+		if !ok {
+			continue
+		}
+		evidence := "T2UServer disabled"
+		if enable == "true" {
+			evidence = "T2UServer enabled"
+		}
+		return P2PIndicator{Service: "Dahua P2P", Evidence: evidence, Enabled: enable == "true"}, nil
+	}
+	return P2PIndicator{}, err
+}
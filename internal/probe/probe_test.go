@@ -1,7 +1,28 @@
 package probe
 
 import (
+	"bufio"
 	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -33,11 +54,9 @@ func TestProbeONVIF_InvalidHost(t *testing.T) {
 	// Test with invalid host that should timeout or fail quickly
 	result := ProbeONVIF(ctx, "invalid-host-that-will-not-resolve")
 	
-	// Should return empty string or error message for invalid hosts
-	if result == "" {
-		t.Log("ProbeONVIF returned empty string for invalid host (expected)")
-	} else {
-		t.Logf("ProbeONVIF returned: %s", result)
+	// Should return nothing for invalid hosts
+	if result.Answered {
+		t.Errorf("ProbeONVIF returned %+v for an invalid host", result)
 	}
 }
 
@@ -52,4 +71,1707 @@ func TestRTSPInfo_Empty(t *testing.T) {
 	if info.Public != "" {
 		t.Error("Empty RTSPInfo should have empty Public")
 	}
-}
\ No newline at end of file
+}
+
+// clearSchemeCache forgets sniffed schemes; test servers reuse each other's ports
+func clearSchemeCache() {
+	schemeMutex.Lock()
+	clear(schemeCache)
+	schemeMutex.Unlock()
+}
+
+func TestDetectScheme(t *testing.T) {
+	clearSchemeCache()
+	t.Cleanup(clearSchemeCache) // The TLS server's port must not stay "https"
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	tlsServer := httptest.NewTLSServer(handler)
+	defer tlsServer.Close()
+	plainServer := httptest.NewServer(handler)
+	defer plainServer.Close()
+
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedPort := closed.Addr().(*net.TCPAddr).Port
+	closed.Close()
+
+	tests := []struct {
+		port     int
+		expected string
+	}{
+		{tlsServer.Listener.Addr().(*net.TCPAddr).Port, "https"},
+		{plainServer.Listener.Addr().(*net.TCPAddr).Port, "http"},
+		{closedPort, "http"}, // unreachable, falls back to the port hint
+	}
+
+	for _, test := range tests {
+		if result := DetectScheme(context.Background(), "127.0.0.1", test.port); result != test.expected {
+			t.Errorf("DetectScheme(%d) = %s, expected %s", test.port, result, test.expected)
+		}
+	}
+}
+
+func TestProbeTLSCerts(t *testing.T) {
+	clearSchemeCache()
+	t.Cleanup(clearSchemeCache)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	tlsServer := httptest.NewTLSServer(handler)
+	defer tlsServer.Close()
+	plainServer := httptest.NewServer(handler)
+	defer plainServer.Close()
+	tlsPort := tlsServer.Listener.Addr().(*net.TCPAddr).Port
+
+	certs := ProbeTLSCerts(context.Background(), "127.0.0.1", []int{tlsPort, plainServer.Listener.Addr().(*net.TCPAddr).Port})
+	if len(certs) != 1 {
+		t.Fatalf("ProbeTLSCerts() = %+v, expected the certificate of the TLS port only", certs)
+	}
+	c := certs[tlsPort]
+	sum := sha256.Sum256(tlsServer.Certificate().Raw)
+	if c.Port != tlsPort || c.SHA256 != hex.EncodeToString(sum[:]) || !c.SelfSigned {
+		t.Errorf("ProbeTLSCerts() = %+v, expected the self-signed test certificate", c)
+	}
+	if names := c.VendorNames(); len(names) == 0 || names[0] != "Acme Co" {
+		t.Errorf("VendorNames() = %v, expected the subject organisation", names)
+	}
+}
+
+func TestParseServerHello(t *testing.T) {
+	msg := []byte{2, 0, 0, 0, 0x03, 0x03}
+	msg = append(msg, make([]byte, 32)...)
+	msg = append(msg, 0, 0xc0, 0x30, 0) // No session ID, cipher, null compression
+	msg = append(msg, 0, 17, 0, 5, 0, 0, 0, 0x17, 0, 0, 0xff, 0x01, 0, 1, 0, 0, 0, 0, 0)
+	msg[3] = byte(len(msg) - 4)
+
+	sh, err := parseServerHello(msg)
+	if err != nil {
+		t.Fatalf("parseServerHello() error: %v", err)
+	}
+	if sh.JA3SRaw != "771,49200,5-23-65281-0" || sh.JA4S != "t120400_c030_4e8089b08790" {
+		t.Errorf("parseServerHello() = %q %q, expected the JA3S string and JA4S of TLS 1.2 with 4 extensions", sh.JA3SRaw, sh.JA4S)
+	}
+	sum := md5.Sum([]byte(sh.JA3SRaw))
+	if sh.JA3S != hex.EncodeToString(sum[:]) {
+		t.Errorf("JA3S = %q, expected the MD5 of %q", sh.JA3S, sh.JA3SRaw)
+	}
+	if _, err := parseServerHello(msg[:20]); err == nil {
+		t.Error("parseServerHello() accepted a truncated message")
+	}
+}
+
+func TestProbeServerHellos(t *testing.T) {
+	clearSchemeCache()
+	t.Cleanup(clearSchemeCache)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	// The probe hangs up after the ServerHello, which the servers would log
+	quiet := log.New(io.Discard, "", 0)
+	tls13 := httptest.NewUnstartedServer(handler)
+	tls13.Config.ErrorLog = quiet
+	tls13.StartTLS()
+	defer tls13.Close()
+	tls12 := httptest.NewUnstartedServer(handler)
+	tls12.Config.ErrorLog = quiet
+	tls12.TLS = &tls.Config{MaxVersion: tls.VersionTLS12}
+	tls12.StartTLS()
+	defer tls12.Close()
+	port13, port12 := tls13.Listener.Addr().(*net.TCPAddr).Port, tls12.Listener.Addr().(*net.TCPAddr).Port
+
+	hellos := ProbeServerHellos(context.Background(), "127.0.0.1", []int{port13, port12})
+	if h := hellos[port13]; h.Port != port13 || h.Version != tls.VersionTLS13 || !strings.HasPrefix(h.JA4S, "t13") || !slices.Contains(h.Extensions, extKeyShare) {
+		t.Errorf("ProbeServerHellos() TLS 1.3 = %+v", h)
+	}
+	if h := hellos[port12]; h.Version != tls.VersionTLS12 || h.ALPN != "http/1.1" || !strings.HasPrefix(h.JA4S, "t12") || !strings.Contains(h.JA4S, "h1_") {
+		t.Errorf("ProbeServerHellos() TLS 1.2 = %+v", h)
+	}
+}
+
+func TestProbeHTTPFingerprints(t *testing.T) {
+	clearSchemeCache()
+	t.Cleanup(clearSchemeCache)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			br := bufio.NewReader(conn)
+			for line, err := br.ReadString('\n'); err == nil && line != "\r\n"; line, err = br.ReadString('\n') {
+			}
+			io.WriteString(conn, "HTTP/1.1 404 Not Found\r\nContent-type: text/html\r\nserver: \r\nTransfer-Encoding: chunked\r\n\r\n"+
+				"1d\r\n<title>Document Error</title>\r\n0\r\n\r\n")
+			conn.Close()
+		}
+	}()
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	fp := ProbeHTTPFingerprints(context.Background(), "127.0.0.1", []int{port})[port]
+	if fp.Port != port || fp.Status != 404 || fp.Order() != "Content-type,server,Transfer-Encoding" {
+		t.Errorf("ProbeHTTPFingerprints() = %d %d %q, expected 404 with the header names as sent", fp.Port, fp.Status, fp.Order())
+	}
+	if fp.Title != "Document Error" || fp.Body != "<title>Document Error</title>" {
+		t.Errorf("ProbeHTTPFingerprints() page = %q (%q), expected the dechunked error page", fp.Body, fp.Title)
+	}
+}
+
+func TestProbeONVIFDeviceInfo(t *testing.T) {
+	const response = `<?xml version="1.0" encoding="UTF-8"?>
+<SOAP-ENV:Envelope xmlns:SOAP-ENV="http://www.w3.org/2003/05/soap-envelope" xmlns:tds="http://www.onvif.org/ver10/device/wsdl">
+<SOAP-ENV:Body><tds:GetDeviceInformationResponse>
+<tds:Manufacturer>HIKVISION</tds:Manufacturer><tds:Model>DS-2CD2042WD-I</tds:Model>
+<tds:FirmwareVersion>V5.4.5 build 170124</tds:FirmwareVersion><tds:SerialNumber>DS-2CD2042WD-I20170301AAWR123456789</tds:SerialNumber>
+<tds:HardwareId>88</tds:HardwareId>
+</tds:GetDeviceInformationResponse></SOAP-ENV:Body></SOAP-ENV:Envelope>`
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.URL.Path != "/onvif/device_service" || !strings.Contains(string(body), "GetDeviceInformation") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if !strings.Contains(string(body), "PasswordDigest") {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		io.WriteString(w, response)
+	}))
+	defer server.Close()
+	port := server.Listener.Addr().(*net.TCPAddr).Port
+
+	if _, err := ProbeONVIFDeviceInfo(context.Background(), "127.0.0.1", []int{port}, "", ""); !errors.Is(err, ErrONVIFUnauthorized) {
+		t.Fatalf("unauthenticated call error = %v, expected ErrONVIFUnauthorized", err)
+	}
+
+	info, err := ProbeONVIFDeviceInfo(context.Background(), "127.0.0.1", []int{port}, "admin", "12345")
+	if err != nil {
+		t.Fatalf("authenticated call failed: %v", err)
+	}
+	if info.Manufacturer != "HIKVISION" || info.Model != "DS-2CD2042WD-I" || info.FirmwareVersion != "V5.4.5 build 170124" || !info.Authenticated {
+		t.Errorf("ProbeONVIFDeviceInfo() = %+v", info)
+	}
+}
+
+func TestTryONVIFCredentials(t *testing.T) {
+	const envelope = `<?xml version="1.0" encoding="UTF-8"?><env:Envelope xmlns:env="http://www.w3.org/2003/05/soap-envelope" ` +
+		`xmlns:tds="http://www.onvif.org/ver10/device/wsdl"><env:Body>%s</env:Body></env:Envelope>`
+	// The device service takes admin:12345 and answers GetUsers, not GetSystemLog
+	digest := regexp.MustCompile(`<wsse:Username>(.*?)</wsse:Username><wsse:Password [^>]*>(.*?)</wsse:Password><wsse:Nonce [^>]*>(.*?)</wsse:Nonce><wsu:Created>(.*?)</wsu:Created>`)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		m := digest.FindStringSubmatch(string(body))
+		if m == nil || m[1] != "admin" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		nonce, _ := base64.StdEncoding.DecodeString(m[3])
+		h := sha1.New()
+		h.Write(nonce)
+		h.Write([]byte(m[4] + "12345"))
+		if base64.StdEncoding.EncodeToString(h.Sum(nil)) != m[2] {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch {
+		case strings.Contains(string(body), "GetDeviceInformation"):
+			fmt.Fprintf(w, envelope, `<tds:GetDeviceInformationResponse><tds:Manufacturer>HIKVISION</tds:Manufacturer><tds:Model>DS-2CD2042WD-I</tds:Model></tds:GetDeviceInformationResponse>`)
+		case strings.Contains(string(body), "GetUsers"):
+			fmt.Fprintf(w, envelope, `<tds:GetUsersResponse><tds:User><tt:Username xmlns:tt="http://www.onvif.org/ver10/schema">admin</tt:Username></tds:User></tds:GetUsersResponse>`)
+		default:
+			fmt.Fprintf(w, envelope, `<env:Fault><env:Reason><env:Text>Action not supported</env:Text></env:Reason></env:Fault>`)
+		}
+	}))
+	defer server.Close()
+	port := server.Listener.Addr().(*net.TCPAddr).Port
+
+	var waits int
+	wait := func(context.Context) error { waits++; return nil }
+	cred, ok, err := TryONVIFCredentials(context.Background(), "127.0.0.1", []int{port}, []string{"admin:admin", "root:12345", "admin:12345"}, wait)
+	if !ok || err != nil || cred.Username != "admin" || cred.Password != "12345" || cred.Device.Model != "DS-2CD2042WD-I" {
+		t.Fatalf("TryONVIFCredentials() = %+v, %v, %v, expected admin:12345", cred, ok, err)
+	}
+	if !slices.Equal(cred.Operations, []string{"GetDeviceInformation", "GetUsers"}) {
+		t.Errorf("TryONVIFCredentials() operations = %v, expected GetDeviceInformation and GetUsers", cred.Operations)
+	}
+	if waits != 3 {
+		t.Errorf("TryONVIFCredentials() waited %d times for 3 attempts", waits)
+	}
+	if _, ok, _ := TryONVIFCredentials(context.Background(), "127.0.0.1", []int{port}, []string{"admin:admin"}, nil); ok {
+		t.Error("TryONVIFCredentials() accepted a wrong password")
+	}
+}
+
+func TestTryONVIFCredentialsLockout(t *testing.T) {
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusUnauthorized)
+		if strings.Contains(string(body), "UsernameToken") {
+			attempts.Add(1)
+			fmt.Fprint(w, "User locked, too many failed logins")
+		}
+	}))
+	defer server.Close()
+	port := server.Listener.Addr().(*net.TCPAddr).Port
+
+	_, ok, err := TryONVIFCredentials(context.Background(), "127.0.0.1", []int{port}, []string{"admin:admin", "admin:12345"}, nil)
+	if ok || !errors.Is(err, ErrONVIFLockout) {
+		t.Errorf("TryONVIFCredentials() = %v, %v on a locked account, expected ErrONVIFLockout", ok, err)
+	}
+	if attempts.Load() != 1 {
+		t.Errorf("TryONVIFCredentials() made %d attempts after the lockout, expected to stop after 1", attempts.Load())
+	}
+}
+
+func TestProbeONVIFSnapshotURIs(t *testing.T) {
+	const envelope = `<?xml version="1.0" encoding="UTF-8"?><env:Envelope xmlns:env="http://www.w3.org/2003/05/soap-envelope" ` +
+		`xmlns:tds="http://www.onvif.org/ver10/device/wsdl" xmlns:trt="http://www.onvif.org/ver10/media/wsdl" ` +
+		`xmlns:tt="http://www.onvif.org/ver10/schema"><env:Body>%s</env:Body></env:Envelope>`
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		req := string(body)
+		switch {
+		case r.URL.Path == "/onvif/device_service" && strings.Contains(req, "GetCapabilities"):
+			// Behind NAT the camera advertises its LAN address
+			fmt.Fprintf(w, envelope, `<tds:GetCapabilitiesResponse><tds:Capabilities><tt:Media>`+
+				`<tt:XAddr>http://192.168.1.64/onvif/Media</tt:XAddr></tt:Media></tds:Capabilities></tds:GetCapabilitiesResponse>`)
+		case r.URL.Path == "/onvif/Media" && strings.Contains(req, "GetProfiles"):
+			fmt.Fprintf(w, envelope, `<trt:GetProfilesResponse><trt:Profiles token="Profile_1" fixed="true"><tt:Name>mainStream</tt:Name></trt:Profiles>`+
+				`<trt:Profiles token="Profile_2"><tt:Name>subStream</tt:Name></trt:Profiles></trt:GetProfilesResponse>`)
+		case r.URL.Path == "/onvif/Media" && strings.Contains(req, "<trt:ProfileToken>Profile_1<"):
+			fmt.Fprintf(w, envelope, `<trt:GetSnapshotUriResponse><trt:MediaUri>`+
+				`<tt:Uri>http://192.168.1.64/onvif-http/snapshot?Profile_1</tt:Uri></trt:MediaUri></trt:GetSnapshotUriResponse>`)
+		default:
+			fmt.Fprintf(w, envelope, `<env:Fault><env:Code><env:Value>env:Receiver</env:Value></env:Code></env:Fault>`)
+		}
+	}))
+	defer server.Close()
+
+	uris, err := ProbeONVIFSnapshotURIs(context.Background(), server.URL+"/onvif/device_service", "", "")
+	if err != nil {
+		t.Fatalf("ProbeONVIFSnapshotURIs() error = %v", err)
+	}
+	expected := server.URL + "/onvif-http/snapshot?Profile_1"
+	if len(uris) != 1 || uris[0].Profile != "Profile_1" || uris[0].URI != expected {
+		t.Errorf("ProbeONVIFSnapshotURIs() = %+v, expected Profile_1 at %s", uris, expected)
+	}
+}
+
+func TestDigestAuthorization(t *testing.T) {
+	// RFC 2617 section 3.5, with the client nonce read back from the header
+	c := AuthChallenge{Scheme: "Digest", Realm: "testrealm@host.com", Nonce: "dcd98b7102dd2f0e8b11d0f600bfb0c093",
+		QOP: "auth,auth-int", Opaque: "5ccc069c403ebaf9f0171e9517f40e41"}
+	header := c.DigestAuthorization("GET", "/dir/index.html", "Mufasa", "Circle Of Life")
+
+	params := make(map[string]string)
+	for _, p := range splitAuthParams(strings.TrimPrefix(header, "Digest ")) {
+		k, v, _ := strings.Cut(p, "=")
+		params[k] = strings.Trim(v, `"`)
+	}
+	md5hex := func(s string) string { sum := md5.Sum([]byte(s)); return hex.EncodeToString(sum[:]) }
+	ha1 := md5hex("Mufasa:testrealm@host.com:Circle Of Life")
+	ha2 := md5hex("GET:/dir/index.html")
+	expected := md5hex(ha1 + ":" + c.Nonce + ":00000001:" + params["cnonce"] + ":auth:" + ha2)
+
+	if params["qop"] != "auth" || params["nc"] != "00000001" || params["opaque"] != c.Opaque {
+		t.Errorf("DigestAuthorization() = %s, expected qop=auth, nc and opaque", header)
+	}
+	if params["response"] != expected {
+		t.Errorf("DigestAuthorization() response = %s, expected %s", params["response"], expected)
+	}
+}
+
+func TestParseProbeMatches(t *testing.T) {
+	const response = `<?xml version="1.0" encoding="UTF-8"?>
+<SOAP-ENV:Envelope xmlns:SOAP-ENV="http://www.w3.org/2003/05/soap-envelope" xmlns:wsa="http://schemas.xmlsoap.org/ws/2004/08/addressing" xmlns:d="http://schemas.xmlsoap.org/ws/2005/04/discovery" xmlns:dn="http://www.onvif.org/ver10/network/wsdl">
+<SOAP-ENV:Body><d:ProbeMatches><d:ProbeMatch>
+<wsa:EndpointReference><wsa:Address>urn:uuid:4c4c4c4c-0000-1111-2222-bcbaa08c5a8b</wsa:Address></wsa:EndpointReference>
+<d:Types>dn:NetworkVideoTransmitter tds:Device</d:Types>
+<d:Scopes>onvif://www.onvif.org/type/video_encoder onvif://www.onvif.org/hardware/DS-2CD2042WD-I onvif://www.onvif.org/name/HIKVISION onvif://www.onvif.org/location/city/hang%20zhou onvif://www.onvif.org/location/country/china</d:Scopes>
+<d:XAddrs>http://192.168.1.64/onvif/device_service http://[fe80::1]/onvif/device_service</d:XAddrs>
+<d:MetadataVersion>10</d:MetadataVersion>
+</d:ProbeMatch></d:ProbeMatches></SOAP-ENV:Body></SOAP-ENV:Envelope>`
+
+	matches := ParseProbeMatches([]byte(response))
+	if len(matches) != 1 {
+		t.Fatalf("ParseProbeMatches() returned %d matches, expected 1", len(matches))
+	}
+	m := matches[0]
+	if m.Endpoint != "urn:uuid:4c4c4c4c-0000-1111-2222-bcbaa08c5a8b" || len(m.Types) != 2 || len(m.Scopes) != 5 || len(m.XAddrs) != 2 {
+		t.Errorf("ParseProbeMatches() = %+v", m)
+	}
+	info := NewONVIFInfo(m)
+	if info.Hardware != "DS-2CD2042WD-I" || info.Name != "HIKVISION" || info.Location != "city/hang zhou, country/china" || !info.Found() {
+		t.Errorf("NewONVIFInfo() = %+v", info)
+	}
+	if s := info.String(); !strings.Contains(s, "hardware DS-2CD2042WD-I") || !strings.Contains(s, "XAddrs http://192.168.1.64/onvif/device_service") {
+		t.Errorf("ONVIFInfo.String() = %q", s)
+	}
+
+	if matches := ParseProbeMatches([]byte("not xml")); len(matches) != 0 {
+		t.Errorf("ParseProbeMatches(garbage) = %v", matches)
+	}
+
+	if id := newMessageID(); !strings.HasPrefix(id, "urn:uuid:") || len(id) != len("urn:uuid:")+36 {
+		t.Errorf("newMessageID() = %s", id)
+	}
+}
+
+func TestExtractTitle(t *testing.T) {
+	tests := []struct {
+		body     string
+		expected string
+	}{
+		{"<html><head><title>NETSurveillance WEB</title></head>", "NETSurveillance WEB"},
+		{"<TITLE lang=\"en\">\n  WEB   SERVICE\n</TITLE>", "WEB SERVICE"},
+		{"<title>Axis &amp; Co</title>", "Axis & Co"},
+		{"<html><body>no title</body></html>", ""},
+	}
+
+	for _, test := range tests {
+		if result := extractTitle([]byte(test.body)); result != test.expected {
+			t.Errorf("extractTitle(%q) = %q, expected %q", test.body, result, test.expected)
+		}
+	}
+}
+
+func TestProbeHTTPMetaTitles(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "Boa/0.94.14rc21")
+		io.WriteString(w, "<html><head><title>DVR Login</title></head></html>")
+	}))
+	defer server.Close()
+	port := server.Listener.Addr().(*net.TCPAddr).Port
+
+	meta := ProbeHTTPMeta(context.Background(), "127.0.0.1", []int{port})
+	if meta.Server != "Boa/0.94.14rc21" || meta.Titles[port] != "DVR Login" {
+		t.Errorf("ProbeHTTPMeta() = %+v", meta)
+	}
+}
+
+func TestProbeHTTPMetaPorts(t *testing.T) {
+	marker := "var productName = 'DS-7608NI';"
+	login := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "App-webs/")
+		io.WriteString(w, "<html>"+strings.Repeat(" ", 2048)+"<script>"+marker+"</script></html>")
+	}))
+	defer login.Close()
+	redirect := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "lighttpd")
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer redirect.Close()
+	loginPort := login.Listener.Addr().(*net.TCPAddr).Port
+	redirectPort := redirect.Listener.Addr().(*net.TCPAddr).Port
+
+	meta := ProbeHTTPMeta(context.Background(), "127.0.0.1", []int{loginPort, redirectPort})
+	if len(meta.BodySnippet) != bodySnippetSize || strings.Contains(meta.BodySnippet, "productname") {
+		t.Errorf("BodySnippet has %d bytes, expected the first %d", len(meta.BodySnippet), bodySnippetSize)
+	}
+	if !strings.Contains(meta.Ports[loginPort].Body, marker) {
+		t.Errorf("Ports[%d].Body is missing the login page marker", loginPort)
+	}
+	if pm := meta.Ports[redirectPort]; pm.StatusCode != http.StatusForbidden || pm.Server != "lighttpd" {
+		t.Errorf("Ports[%d] = %+v, expected 403 from lighttpd", redirectPort, pm)
+	}
+
+	// Bodies are cut at MaxBodySize
+	cfg := DefaultProbeConfig()
+	cfg.MaxBodySize = 1024
+	meta = ProbeHTTPMeta(WithConfig(context.Background(), cfg), "127.0.0.1", []int{loginPort})
+	if n := len(meta.Ports[loginPort].Body); n != 1024 {
+		t.Errorf("Ports[%d].Body has %d bytes with MaxBodySize 1024", loginPort, n)
+	}
+}
+
+func TestParseAuthChallenges(t *testing.T) {
+	tests := []struct {
+		values   []string
+		expected []AuthChallenge
+	}{
+		{[]string{`Basic realm="IPCamera"`}, []AuthChallenge{{Scheme: "Basic", Realm: "IPCamera"}}},
+		{[]string{`Digest realm="Hikvision", qop="auth", nonce="4e6a", algorithm=MD5`},
+			[]AuthChallenge{{Scheme: "Digest", Realm: "Hikvision", QOP: "auth", Nonce: "4e6a", Algorithm: "MD5"}}},
+		{[]string{`digest realm="Login to 4L0123", nonce="a,b", Basic realm="Login to 4L0123"`},
+			[]AuthChallenge{{Scheme: "Digest", Realm: "Login to 4L0123", Nonce: "a,b"}, {Scheme: "Basic", Realm: "Login to 4L0123"}}},
+		{[]string{`Digest realm="x"`, `Basic realm="x"`}, []AuthChallenge{{Scheme: "Digest", Realm: "x"}, {Scheme: "Basic", Realm: "x"}}},
+		{[]string{"Negotiate"}, []AuthChallenge{{Scheme: "Negotiate"}}},
+		{nil, nil},
+	}
+
+	for _, test := range tests {
+		result := ParseAuthChallenges(test.values)
+		if len(result) != len(test.expected) {
+			t.Errorf("ParseAuthChallenges(%q) = %+v, expected %+v", test.values, result, test.expected)
+			continue
+		}
+		for i := range result {
+			if result[i] != test.expected[i] {
+				t.Errorf("ParseAuthChallenges(%q)[%d] = %+v, expected %+v", test.values, i, result[i], test.expected[i])
+			}
+		}
+	}
+
+	if c, _ := PreferredChallenge(ParseAuthChallenges(tests[3].values)); !c.IsBasic() {
+		t.Errorf("PreferredChallenge() = %v, expected Basic when offered", c)
+	}
+}
+
+func TestLockoutMarker(t *testing.T) {
+	for body, expected := range map[string]bool{
+		"User locked, too many failed logins":                               true,
+		"Account is LOCKED for 30 minutes":                                  true,
+		"<lockStatus>lock</lockStatus><unlockTime>1800</unlockTime>":        true,
+		"Please try again later":                                            true,
+		"<lockStatus>unlock</lockStatus><retryLoginTime>4</retryLoginTime>": false,
+		"Account unlocked":                                                  false,
+		"The account is not locked":                                         false,
+		"Request blocked by policy":                                         false,
+		"Invalid user name or password":                                     false,
+	} {
+		if m, ok := LockoutMarker([]byte(body)); ok != expected {
+			t.Errorf("LockoutMarker(%q) = %q, %v, expected %v", body, m, ok, expected)
+		}
+	}
+}
+
+func TestFindLoginPagesAuth(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("WWW-Authenticate", `Digest realm="DS-2CD2042WD", nonce="abc", qop="auth"`)
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+	port := server.Listener.Addr().(*net.TCPAddr).Port
+
+	pages, auth := FindLoginPagesAuth(context.Background(), "127.0.0.1", []int{port})
+	if len(pages) != 1 {
+		t.Fatalf("FindLoginPagesAuth() pages = %v, expected only /", pages)
+	}
+	if c := auth[pages[0]]; !c.IsDigest() || c.Realm != "DS-2CD2042WD" {
+		t.Errorf("FindLoginPagesAuth() auth = %+v, expected Digest realm DS-2CD2042WD", c)
+	}
+}
+
+func TestProbeLoginPages(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+	})
+	mux.HandleFunc("/admin", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="admin"`)
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+	mux.HandleFunc("/webadmin", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	port := server.Listener.Addr().(*net.TCPAddr).Port
+	base := "http://127.0.0.1:" + strconv.Itoa(port)
+
+	pages := ProbeLoginPages(context.Background(), "127.0.0.1", []int{port})
+	expected := []struct {
+		url         string
+		status      int
+		contentType string
+		scheme      string
+	}{
+		{base + "/", 200, "text/html", ""},
+		{base + "/admin", 401, "", "Basic"},
+		{base + "/webadmin", 403, "", ""},
+	}
+	if len(pages) != len(expected) {
+		t.Fatalf("ProbeLoginPages() = %+v, expected %d pages", pages, len(expected))
+	}
+	for i, e := range expected {
+		p := pages[i]
+		if p.URL != e.url || p.Status != e.status || p.ContentType != e.contentType || p.Auth.Scheme != e.scheme {
+			t.Errorf("ProbeLoginPages()[%d] = %+v, expected %+v", i, p, e)
+		}
+	}
+	if pages[0].Protected() || !pages[1].Protected() || !pages[2].Protected() {
+		t.Errorf("Protected() = %v %v %v, expected false true true", pages[0].Protected(), pages[1].Protected(), pages[2].Protected())
+	}
+}
+
+func TestIsHLSPlaylist(t *testing.T) {
+	tests := []struct {
+		body     string
+		expected bool
+	}{
+		{"#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:2\n#EXTINF:2.000,\nsegment0.ts\n", true},
+		{"\ufeff#EXTM3U\r\n#EXT-X-STREAM-INF:BANDWIDTH=2048000,RESOLUTION=1920x1080\r\nmain.m3u8\r\n", true},
+		{"#EXTM3U\nhttp://radio.example/stream.mp3\n", false},
+		{"<html><body>#EXTM3U #EXTINF:</body></html>", false},
+		{"", false},
+	}
+
+	for _, test := range tests {
+		if result := IsHLSPlaylist(test.body); result != test.expected {
+			t.Errorf("IsHLSPlaylist(%q) = %v, expected %v", test.body, result, test.expected)
+		}
+	}
+}
+
+func TestFindHLSStreams(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/hls/stream.m3u8":
+			w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+			io.WriteString(w, "#EXTM3U\n#EXT-X-TARGETDURATION:4\n#EXTINF:4.0,\n/hls/seg1.ts\n")
+		case "/live.m3u8":
+			io.WriteString(w, "<html>login</html>") // Catch-all web UI
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	port := server.Listener.Addr().(*net.TCPAddr).Port
+
+	streams := FindHLSStreams(context.Background(), "127.0.0.1", []int{port})
+	expected := "http://127.0.0.1:" + strconv.Itoa(port) + "/hls/stream.m3u8"
+	if len(streams) != 1 || streams[0] != expected {
+		t.Errorf("FindHLSStreams() = %v, expected [%s]", streams, expected)
+	}
+}
+
+// serveRTSP answers DESCRIBE with respond(path) on a local listener and returns its port
+func serveRTSP(t *testing.T, respond func(path string) string) int {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(c net.Conn) {
+				defer c.Close()
+				br := bufio.NewReader(c)
+				line, _ := br.ReadString('\n')
+				for {
+					h, err := br.ReadString('\n')
+					if err != nil || h == "\r\n" {
+						break
+					}
+				}
+				fields := strings.Fields(line)
+				if len(fields) < 2 {
+					return
+				}
+				path := strings.TrimPrefix(fields[1], "rtsp://"+c.LocalAddr().String())
+				io.WriteString(c, respond(path))
+			}(c)
+		}
+	}()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+func TestEnumerateRTSPPaths(t *testing.T) {
+	sdp := "v=0\r\no=- 0 0 IN IP4 0.0.0.0\r\ns=Media Presentation\r\nm=video 0 RTP/AVP 96\r\n" +
+		"a=rtpmap:96 H264/90000\r\na=framesize:96 1280-720\r\n"
+	port := serveRTSP(t, func(path string) string {
+		if path != "/Streaming/Channels/101" {
+			return "RTSP/1.0 404 Not Found\r\nCSeq: 2\r\n\r\n"
+		}
+		return "RTSP/1.0 200 OK\r\nCSeq: 2\r\nContent-Type: application/sdp\r\nContent-Length: " +
+			strconv.Itoa(len(sdp)) + "\r\n\r\n" + sdp
+	})
+
+	streams, auth := EnumerateRTSPPaths(context.Background(), "127.0.0.1", []int{port})
+	expected := "rtsp://127.0.0.1:" + strconv.Itoa(port) + "/Streaming/Channels/101"
+	if len(streams) != 1 || streams[0].URL != expected {
+		t.Errorf("EnumerateRTSPPaths() = %v, expected [%s]", streams, expected)
+	} else if media := streams[0].Media.String(); media != "H264 1280x720" {
+		t.Errorf("EnumerateRTSPPaths() media = %q, expected H264 1280x720", media)
+	}
+	if len(auth) != 0 {
+		t.Errorf("EnumerateRTSPPaths() auth = %v, expected none", auth)
+	}
+}
+
+func TestEnumerateRTSPPathsAuth(t *testing.T) {
+	port := serveRTSP(t, func(path string) string {
+		return "RTSP/1.0 401 Unauthorized\r\nCSeq: 2\r\n" +
+			"WWW-Authenticate: Digest realm=\"IP Camera(C6214)\", nonce=\"7d1b0c2e\", stale=\"FALSE\"\r\n" +
+			"WWW-Authenticate: Basic realm=\"IP Camera(C6214)\"\r\n\r\n"
+	})
+
+	streams, auth := EnumerateRTSPPaths(context.Background(), "127.0.0.1", []int{port})
+	if len(streams) != 0 {
+		t.Errorf("EnumerateRTSPPaths() = %v, expected no open streams", streams)
+	}
+	if c := auth[port]; !c.IsBasic() || c.Realm != "IP Camera(C6214)" {
+		t.Errorf("EnumerateRTSPPaths() auth[%d] = %+v, expected Basic realm IP Camera(C6214)", port, c)
+	}
+
+	res, err := DescribeRTSP(context.Background(), "127.0.0.1", port, "/live")
+	if err != nil || res.Code != 401 || len(res.Auth) != 2 || res.Auth[0].Nonce != "7d1b0c2e" {
+		t.Errorf("DescribeRTSP() = %+v, %v, expected 401 with Digest and Basic challenges", res, err)
+	}
+}
+
+func TestParseSADPProbeMatch(t *testing.T) {
+	data := []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<ProbeMatch>
+<Uuid>9A3F2B10-6C1E-4D8B-A5F0-3E7C2D1B0A99</Uuid>
+<Types>inquiry</Types>
+<DeviceType>138153</DeviceType>
+<DeviceDescription>DS-2CD2042WD-I</DeviceDescription>
+<DeviceSN>DS-2CD2042WD-I20160815AAWR123456789</DeviceSN>
+<CommandPort>8000</CommandPort>
+<HttpPort>80</HttpPort>
+<MAC>44-19-b6-01-02-03</MAC>
+<IPv4Address>192.168.1.64</IPv4Address>
+<SoftwareVersion>V5.4.5build 170124</SoftwareVersion>
+<DSPVersion>V7.3 build 170112</DSPVersion>
+<Activated>false</Activated>
+</ProbeMatch>`)
+
+	device, ok := ParseSADPProbeMatch(data)
+	if !ok {
+		t.Fatal("ParseSADPProbeMatch() rejected a ProbeMatch")
+	}
+	if device.Model != "DS-2CD2042WD-I" || device.FirmwareVersion != "V5.4.5build 170124" ||
+		device.Address != "192.168.1.64" || device.CommandPort != 8000 || device.HTTPPort != 80 {
+		t.Errorf("ParseSADPProbeMatch() = %+v", device)
+	}
+	if !device.ActivationKnown || device.Activated {
+		t.Errorf("ParseSADPProbeMatch() activation = %v/%v, expected known and not activated", device.ActivationKnown, device.Activated)
+	}
+
+	// Our own inquiry looping back is not a device
+	if _, ok := ParseSADPProbeMatch([]byte(sadpInquiry("9A3F2B10"))); ok {
+		t.Error("ParseSADPProbeMatch() accepted an inquiry")
+	}
+}
+
+func TestParseMDNSResponse(t *testing.T) {
+	name := func(s string) []byte {
+		var b []byte
+		for _, label := range strings.Split(s, ".") {
+			b = append(b, byte(len(label)))
+			b = append(b, label...)
+		}
+		return append(b, 0)
+	}
+	rr := func(owner []byte, rtype uint16, rdata []byte) []byte {
+		b := append([]byte{}, owner...)
+		b = append(b, byte(rtype>>8), byte(rtype), 0x80, 0x01, 0, 0, 0x11, 0x94, byte(len(rdata)>>8), byte(len(rdata)))
+		return append(b, rdata...)
+	}
+
+	// Response flags, one answer and two additional records
+	msg := []byte{0, 0, 0x84, 0, 0, 0, 0, 1, 0, 0, 0, 2}
+	msg = append(msg, rr(name("_axis-video._tcp.local"), 12, name("AXIS M3045-V - ACCC8E123456._axis-video._tcp.local"))...)
+	// The SRV owner name compresses its suffix onto the answer's owner at offset 12
+	srvOwner := append(name("AXIS M3045-V - ACCC8E123456")[:28], 0xC0, 12)
+	srv := append([]byte{0, 0, 0, 0, 0, 80}, name("axis-accc8e123456.local")...)
+	msg = append(msg, rr(srvOwner, 33, srv)...)
+	msg = append(msg, rr(srvOwner, 16, []byte("\x0fmacaddress=ACCC\x00"))...)
+
+	services, err := ParseMDNSResponse(msg)
+	if err != nil || len(services) != 1 {
+		t.Fatalf("ParseMDNSResponse() = %+v, %v, expected one service", services, err)
+	}
+	svc := services[0]
+	if svc.Instance != "AXIS M3045-V - ACCC8E123456" || svc.Service != "_axis-video._tcp" ||
+		svc.Host != "axis-accc8e123456.local" || svc.Port != 80 {
+		t.Errorf("ParseMDNSResponse() = %+v", svc)
+	}
+	if len(svc.TXT) != 1 || svc.TXT[0] != "macaddress=ACCC" {
+		t.Errorf("ParseMDNSResponse() TXT = %q", svc.TXT)
+	}
+
+	// Our own query looping back is ignored
+	if services, _ := ParseMDNSResponse(mdnsQuery(MDNSServiceTypes)); len(services) != 0 {
+		t.Errorf("ParseMDNSResponse(query) = %+v, expected nothing", services)
+	}
+}
+
+func TestParseSNMPResponse(t *testing.T) {
+	req, err := snmpGetRequest("public", 4242, oidSysDescr, oidSysObjectID, oidSysName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msg snmpMessage
+	if _, err := asn1.Unmarshal(req, &msg); err != nil || msg.PDU.FullBytes[0] != snmpTagGetRequest {
+		t.Fatalf("snmpGetRequest() produced an invalid message: %v", err)
+	}
+
+	// Answer like an agent would, with sysName missing
+	oid, _ := asn1.Marshal(asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 39165, 1, 1})
+	pdu, _ := asn1.Marshal(snmpPDU{RequestID: 4242, VarBinds: []snmpVarBind{
+		{Name: oidSysDescr, Value: asn1.RawValue{Tag: asn1.TagOctetString, Bytes: []byte("DS-7608NI-K2 V4.22.005")}},
+		{Name: oidSysObjectID, Value: asn1.RawValue{FullBytes: oid}},
+		{Name: oidSysName, Value: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0}}, // noSuchObject
+	}})
+	pdu[0] = snmpTagGetResponse
+	resp, _ := asn1.Marshal(snmpMessage{Version: 1, Community: []byte("public"), PDU: asn1.RawValue{FullBytes: pdu}})
+
+	info, err := parseSNMPResponse(resp, 4242)
+	if err != nil {
+		t.Fatalf("parseSNMPResponse() error: %v", err)
+	}
+	if info.SysDescr != "DS-7608NI-K2 V4.22.005" || info.SysObjectID != "1.3.6.1.4.1.39165.1.1" || info.SysName != "" {
+		t.Errorf("parseSNMPResponse() = %+v", info)
+	}
+
+	if _, err := parseSNMPResponse(resp, 1); err == nil {
+		t.Error("parseSNMPResponse() accepted a response to another request")
+	}
+	if _, err := parseSNMPResponse(req, 4242); err == nil {
+		t.Error("parseSNMPResponse() accepted a GetRequest")
+	}
+}
+
+func TestProbeTelnet(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	refused := make(chan []byte, 1)
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		// DO ECHO, WILL SUPPRESS-GO-AHEAD, a subnegotiation, then the banner
+		c.Write([]byte{telnetIAC, telnetDO, 1, telnetIAC, telnetWILL, 3, telnetIAC, telnetSB, 24, 1, telnetIAC, telnetSE})
+		c.Write([]byte("\r\n\x1b[0mDVR Telnet Service\r\n\r\ndvrdvs login: "))
+		reply := make([]byte, 6)
+		io.ReadFull(c, reply)
+		refused <- reply
+		time.Sleep(200 * time.Millisecond)
+	}()
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	banners := ProbeTelnet(context.Background(), "127.0.0.1", []int{port})
+	if expected := "DVR Telnet Service\ndvrdvs login:"; banners[port] != expected {
+		t.Errorf("ProbeTelnet() = %q, expected %q", banners[port], expected)
+	}
+	select {
+	case reply := <-refused:
+		if expected := []byte{telnetIAC, telnetWONT, 1, telnetIAC, telnetDONT, 3}; string(reply) != string(expected) {
+			t.Errorf("negotiation reply = %v, expected %v", reply, expected)
+		}
+	case <-time.After(time.Second):
+		t.Error("no negotiation reply")
+	}
+}
+
+func TestParseSIPResponse(t *testing.T) {
+	tests := []struct {
+		name    string
+		resp    string
+		server  string
+		ids     []string
+		gb28181 bool
+	}{
+		{
+			"GB28181 camera answering OPTIONS",
+			"SIP/2.0 200 OK\r\nVia: SIP/2.0/UDP 10.0.0.1:5060;rport=5060;branch=z9hG4bK1\r\n" +
+				"From: <sip:34020000002000000001@3402000000>;tag=1\r\nTo: <sip:34020000001320000003@3402000000>;tag=9\r\n" +
+				"Call-ID: 1@3402000000\r\nCSeq: 1 OPTIONS\r\nUser-Agent: IP Camera\r\nContent-Length: 0\r\n\r\n",
+			"IP Camera", []string{"34020000001320000003"}, true,
+		},
+		{
+			"Platform challenging REGISTER, compact headers",
+			"SIP/2.0 401 Unauthorized\r\nf: <sip:34020000002000000001@3402000000>;tag=1\r\nt: <sip:34020000002000000001@3402000000>\r\n" +
+				"WWW-Authenticate: Digest realm=\"4401000000\",nonce=\"6a8f\"\r\nServer: WVP-GB28181\r\n\r\n",
+			"WVP-GB28181", nil, true,
+		},
+		{
+			"Plain SIP phone",
+			"SIP/2.0 200 OK\r\nServer: Asterisk PBX 18.0\r\nAllow: INVITE, ACK, OPTIONS\r\n\r\n",
+			"Asterisk PBX 18.0", nil, false,
+		},
+	}
+
+	for _, test := range tests {
+		info := ParseSIPResponse([]byte(test.resp))
+		if !info.Found() || info.Server != test.server || info.GB28181 != test.gb28181 || strings.Join(info.DeviceIDs, ",") != strings.Join(test.ids, ",") {
+			t.Errorf("ParseSIPResponse(%s) = %+v, expected server %q, ids %v, GB28181 %v", test.name, info, test.server, test.ids, test.gb28181)
+		}
+	}
+	if kind := GB28181DeviceType("34020000001320000003"); kind != "IP camera" {
+		t.Errorf("GB28181DeviceType() = %q, expected IP camera", kind)
+	}
+}
+
+func TestProbeSIP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(c net.Conn) {
+				defer c.Close()
+				br := bufio.NewReader(c)
+				line, _ := br.ReadString('\n')
+				for {
+					h, err := br.ReadString('\n')
+					if err != nil || h == "\r\n" {
+						break
+					}
+				}
+				if strings.HasPrefix(line, "REGISTER ") {
+					io.WriteString(c, "SIP/2.0 401 Unauthorized\r\nWWW-Authenticate: Digest realm=\"3402000000\", nonce=\"1\"\r\n"+
+						"Contact: <sip:34020000001180000001@10.0.0.9:5060>\r\nContent-Length: 0\r\n\r\n")
+					return
+				}
+				io.WriteString(c, "SIP/2.0 200 OK\r\nServer: DH-NVR\r\nContent-Length: 0\r\n\r\n")
+			}(c)
+		}
+	}()
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	info := ProbeSIP(context.Background(), "127.0.0.1", []int{port})
+	if info.Transport != "tcp" || info.Status != "SIP/2.0 200 OK" || info.Server != "DH-NVR" {
+		t.Fatalf("ProbeSIP() = %+v, expected a tcp answer from DH-NVR", info)
+	}
+	if !info.GB28181 || info.Realm != "3402000000" || len(info.DeviceIDs) != 1 || info.DeviceIDs[0] != "34020000001180000001" {
+		t.Errorf("ProbeSIP() = %+v, expected the GB28181 identity from REGISTER", info)
+	}
+}
+
+func TestProbeSSH(t *testing.T) {
+	hostKey := sshAppendString(sshAppendString(nil, []byte("ssh-ed25519")), make([]byte, 32))
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		br := bufio.NewReader(c)
+		io.WriteString(c, "SSH-2.0-dropbear_2012.55\r\n")
+		br.ReadString('\n')
+
+		kexinit := append([]byte{sshMsgKexInit}, make([]byte, 16)...)
+		kexinit = sshAppendString(kexinit, []byte("diffie-hellman-group1-sha1,curve25519-sha256"))
+		writeSSHPacket(c, kexinit)
+		readSSHPacket(br) // KEXINIT
+		if init, err := readSSHPacket(br); err != nil || init[0] != sshMsgKexDHInit {
+			return
+		}
+		writeSSHPacket(c, sshAppendString([]byte{sshMsgKexReply}, hostKey))
+	}()
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	info := ProbeSSH(context.Background(), "127.0.0.1", []int{port})
+	sum := sha256.Sum256(hostKey)
+	expected := "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+	if info.Banner != "SSH-2.0-dropbear_2012.55" || info.HostKeyType != "ssh-ed25519" || info.Fingerprint != expected {
+		t.Errorf("ProbeSSH() = %+v, expected dropbear with ed25519 key %s", info, expected)
+	}
+}
+
+func TestProbeFTP(t *testing.T) {
+	tests := []struct {
+		pass      string // Reply to PASS
+		anonymous bool
+	}{
+		{"230 Login successful.", true},
+		{"530 Login incorrect.", false},
+	}
+
+	for _, test := range tests {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		go func(pass string) {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer c.Close()
+			br := bufio.NewReader(c)
+			io.WriteString(c, "220-Welcome\r\n220 DVR FTP server ready\r\n")
+			br.ReadString('\n') // USER
+			io.WriteString(c, "331 Please specify the password.\r\n")
+			br.ReadString('\n') // PASS
+			io.WriteString(c, pass+"\r\n")
+			br.ReadString('\n') // QUIT
+		}(test.pass)
+		port := ln.Addr().(*net.TCPAddr).Port
+
+		info := ProbeFTP(context.Background(), "127.0.0.1", []int{port})
+		ln.Close()
+		if info.Banner != "220-Welcome | 220 DVR FTP server ready" || info.Anonymous != test.anonymous {
+			t.Errorf("ProbeFTP() with PASS reply %q = %+v, expected anonymous %v", test.pass, info, test.anonymous)
+		}
+	}
+}
+
+func TestVerifyRTSPStream(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	sdp := "v=0\r\nm=video 0 RTP/AVP 96\r\na=rtpmap:96 H264/90000\r\na=control:trackID=1\r\n"
+	setups := make(chan string, 1)
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		br := bufio.NewReader(c)
+		for {
+			line, err := br.ReadString('\n')
+			if err != nil {
+				return
+			}
+			var cseq string
+			for {
+				h, err := br.ReadString('\n')
+				if err != nil || h == "\r\n" {
+					break
+				}
+				if strings.HasPrefix(h, "CSeq:") {
+					cseq = strings.TrimSpace(h[5:])
+				}
+			}
+			fields := strings.Fields(line)
+			switch fields[0] {
+			case "DESCRIBE":
+				fmt.Fprintf(c, "RTSP/1.0 200 OK\r\nCSeq: %s\r\nContent-Base: %s/\r\nContent-Type: application/sdp\r\nContent-Length: %d\r\n\r\n%s",
+					cseq, fields[1], len(sdp), sdp)
+			case "SETUP":
+				setups <- fields[1]
+				fmt.Fprintf(c, "RTSP/1.0 200 OK\r\nCSeq: %s\r\nSession: 12345678;timeout=60\r\n"+
+					"Transport: RTP/AVP/TCP;unicast;interleaved=0-1\r\n\r\n", cseq)
+			case "PLAY":
+				fmt.Fprintf(c, "RTSP/1.0 200 OK\r\nCSeq: %s\r\nSession: 12345678\r\n\r\n", cseq)
+				rtcp := []byte{'$', 1, 0, 8, 0x80, 0xC8, 0, 6, 0, 0, 0, 1}
+				rtp := []byte{'$', 0, 0, 12, 0x80, 0x60, 0, 1, 0, 0, 0, 0, 0xDE, 0xAD, 0xBE, 0xEF}
+				c.Write(append(rtcp, rtp...))
+			}
+		}
+	}()
+
+	url := "rtsp://" + ln.Addr().String() + "/Streaming/Channels/101"
+	if err := VerifyRTSPStream(context.Background(), url); err != nil {
+		t.Fatalf("VerifyRTSPStream() = %v, expected RTP to arrive", err)
+	}
+	if setup := <-setups; setup != url+"/trackID=1" {
+		t.Errorf("SETUP %s, expected %s/trackID=1", setup, url)
+	}
+}
+
+func TestIsRTPPacket(t *testing.T) {
+	tests := []struct {
+		packet   []byte
+		expected bool
+	}{
+		{[]byte{0x80, 0x60, 0, 1, 0, 0, 0, 0, 0xDE, 0xAD, 0xBE, 0xEF}, true},  // H.264, PT 96
+		{[]byte{0x80, 0xE0, 0, 2, 0, 0, 0, 0, 0xDE, 0xAD, 0xBE, 0xEF}, true},  // PT 96 with marker
+		{[]byte{0x80, 0xC8, 0, 6, 0, 0, 0, 1, 0, 0, 0, 0}, false},             // RTCP sender report
+		{[]byte{0x40, 0x60, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0}, false},             // Version 1
+		{[]byte{0x80, 0x60, 0, 1}, false},                                     // Truncated
+	}
+
+	for _, test := range tests {
+		if result := IsRTPPacket(test.packet); result != test.expected {
+			t.Errorf("IsRTPPacket(% x) = %v, expected %v", test.packet, result, test.expected)
+		}
+	}
+}
+
+func TestParseSDP(t *testing.T) {
+	tests := []struct {
+		name     string
+		sdp      string
+		expected string
+		audio    bool
+	}{
+		{
+			"H.264 SPS with cropping",
+			"v=0\r\ns=BigBuckBunny\r\nm=audio 0 RTP/AVP 96\r\na=rtpmap:96 mpeg4-generic/12000/2\r\na=control:trackID=1\r\n" +
+				"m=video 0 RTP/AVP 97\r\na=rtpmap:97 H264/90000\r\n" +
+				"a=fmtp:97 packetization-mode=1;profile-level-id=42C01E;sprop-parameter-sets=Z0LAHtkDxWhAAAADAEAAAAwDxYuS,aMuMsg==\r\n" +
+				"a=cliprect:0,0,160,240\r\na=framesize:97 240-160\r\na=control:trackID=2\r\n",
+			"MPEG4-GENERIC audio, H264 240x160",
+			true,
+		},
+		{
+			"H.265 SPS with conformance window",
+			"v=0\r\nm=video 0 RTP/AVP 96\r\na=rtpmap:96 H265/90000\r\n" +
+				"a=fmtp:96 sprop-vps=QAEMAf//AWAAAAMAkAAAAwAAAwB4mZgJ; sprop-sps=QgEBAWAAAAMAkAAAAwAAAwB4oAPAgBEHy+A=\r\n" +
+				"m=audio 0 RTP/AVP 8\r\n",
+			"H265 1920x1080, PCMA audio",
+			true,
+		},
+		{
+			"Resolution from attributes only",
+			"v=0\r\nm=video 0 RTP/AVP 26\r\na=x-dimensions:704,576\r\nm=application 0 RTP/AVP 107\r\na=rtpmap:107 vnd.onvif.metadata/90000\r\n",
+			"JPEG 704x576, VND.ONVIF.METADATA application",
+			false,
+		},
+	}
+
+	for _, test := range tests {
+		info := ParseSDP(test.sdp)
+		if result := info.String(); result != test.expected {
+			t.Errorf("ParseSDP(%s) = %q, expected %q", test.name, result, test.expected)
+		}
+		if info.HasAudio() != test.audio {
+			t.Errorf("ParseSDP(%s).HasAudio() = %v, expected %v", test.name, info.HasAudio(), test.audio)
+		}
+	}
+}
+
+func TestSDPSignature(t *testing.T) {
+	info := ParseSDP("v=0\r\no=- 1700000000 1 IN IP4 192.168.1.64\r\ns=Media Presentation\r\ne=NONE\r\nc=IN IP4 0.0.0.0\r\nt=0 0\r\n" +
+		"a=control:rtsp://192.168.1.64:554/Streaming/Channels/101/\r\nm=video 0 RTP/AVP 96\r\na=rtpmap:96 H264/90000\r\n" +
+		"a=control:rtsp://192.168.1.64:554/Streaming/Channels/101/trackID=1\r\n")
+	expected := []string{"s=Media Presentation", "e=NONE", "a=control:/Streaming/Channels/101/", "a=control:/Streaming/Channels/101/trackID=1"}
+	if result := info.Signature(); !slices.Equal(result, expected) {
+		t.Errorf("Signature() = %q, expected %q", result, expected)
+	}
+}
+
+func TestProbeConfigParseTimeouts(t *testing.T) {
+	cfg := DefaultProbeConfig().Scale(2).AddRetries(1)
+	if cfg.RTSP.Dial != 2400*time.Millisecond || cfg.RTSP.IO != 4*time.Second || cfg.RTSP.Retries != 1 {
+		t.Errorf("Scale(2).AddRetries(1) RTSP = %+v, expected 2.4s/4s with 1 retry", cfg.RTSP)
+	}
+	if cfg.SNMP.Retries != 2 {
+		t.Errorf("AddRetries(1) SNMP.Retries = %d, expected 2", cfg.SNMP.Retries)
+	}
+	if d := DefaultProbeConfig().RTSP.IO; d != 2*time.Second {
+		t.Errorf("Scale changed the defaults: RTSP.IO = %v", d)
+	}
+
+	if err := cfg.ParseTimeouts("rtsp=6s, HTTP=3s/8s"); err != nil {
+		t.Fatalf("ParseTimeouts: %v", err)
+	}
+	if cfg.RTSP.IO != 6*time.Second || cfg.RTSP.Dial != 2400*time.Millisecond {
+		t.Errorf("RTSP = %+v, expected dial 2.4s and I/O 6s", cfg.RTSP)
+	}
+	if cfg.HTTP.Dial != 3*time.Second || cfg.HTTP.IO != 8*time.Second {
+		t.Errorf("HTTP = %+v, expected dial 3s and I/O 8s", cfg.HTTP)
+	}
+
+	for _, spec := range []string{"rtsp", "gopher=1s", "rtsp=fast", "rtsp=-1s", "rtsp=x/1s"} {
+		if err := cfg.ParseTimeouts(spec); err == nil {
+			t.Errorf("ParseTimeouts(%q) = nil, expected an error", spec)
+		}
+	}
+}
+
+func TestConfigFrom(t *testing.T) {
+	if cfg := ConfigFrom(context.Background()); cfg.HTTP != DefaultProbeConfig().HTTP {
+		t.Errorf("ConfigFrom(Background) HTTP = %+v, expected the defaults", cfg.HTTP)
+	}
+	want := DefaultProbeConfig()
+	want.SSH.IO = time.Minute
+	if cfg := ConfigFrom(WithConfig(context.Background(), want)); cfg.SSH.IO != time.Minute {
+		t.Errorf("ConfigFrom(WithConfig) SSH.IO = %v, expected 1m", cfg.SSH.IO)
+	}
+}
+
+func TestDiskCache(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache", "probe.db")
+	cache, err := OpenDiskCache(path, time.Hour)
+	if err != nil {
+		t.Fatalf("OpenDiskCache on a missing file: %v", err)
+	}
+	result := OptimizedProbeResult{
+		HTTPMeta:   HTTPMeta{Server: "App-webs/", Ports: map[int]PortMeta{80: {StatusCode: 200, Title: "Login"}}},
+		RTSPAuth:   map[int]AuthChallenge{554: {Scheme: "Digest", Realm: "IP Camera"}},
+		HLSStreams: []string{"http://10.0.0.5/live.m3u8"},
+	}
+	if err := cache.Put("10.0.0.5", []int{554, 80}, result); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	// Put writes through, so the entry survives a run that never closes the cache
+	// cleanly; closing here only releases the file lock for the reopen below
+	if err := cache.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	reopened, err := OpenDiskCache(path, time.Hour)
+	if err != nil {
+		t.Fatalf("OpenDiskCache: %v", err)
+	}
+	got, ok := reopened.Get("10.0.0.5", []int{80, 554})
+	if !ok {
+		t.Fatal("Get after reopening missed the cached host")
+	}
+	if got.HTTPMeta.Ports[80].Title != "Login" || got.RTSPAuth[554].Realm != "IP Camera" || len(got.HLSStreams) != 1 {
+		t.Errorf("Get = %+v, expected the stored result", got)
+	}
+	if _, ok := reopened.Get("10.0.0.5", []int{80}); ok {
+		t.Error("Get with a different port set hit the cache")
+	}
+	reopened.Close()
+
+	// Expired entries are dropped on open
+	expired, err := OpenDiskCache(path, time.Nanosecond)
+	if err != nil {
+		t.Fatalf("OpenDiskCache: %v", err)
+	}
+	defer expired.Close()
+	if n := expired.Len(); n != 0 {
+		t.Errorf("OpenDiskCache kept %d expired entries", n)
+	}
+}
+
+func TestProbeHTTPMetaRedirects(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			http.Redirect(w, r, "/index.asp", http.StatusFound)
+		case "/index.asp":
+			http.Redirect(w, r, "/doc/page/login.asp?_1700000000", http.StatusFound)
+		default:
+			io.WriteString(w, "<html><title>Login</title></html>")
+		}
+	}))
+	defer server.Close()
+	cloud := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://cloud.example.com/portal", http.StatusMovedPermanently)
+	}))
+	defer cloud.Close()
+	port := server.Listener.Addr().(*net.TCPAddr).Port
+	cloudPort := cloud.Listener.Addr().(*net.TCPAddr).Port
+
+	meta := ProbeHTTPMeta(context.Background(), "127.0.0.1", []int{port, cloudPort})
+	pm := meta.Ports[port]
+	base := "http://127.0.0.1:" + strconv.Itoa(port)
+	expected := []string{base + "/index.asp", base + "/doc/page/login.asp?_1700000000"}
+	if fmt.Sprint(pm.Redirects) != fmt.Sprint(expected) || pm.FinalURL != expected[1] || pm.Title != "Login" || pm.TTFB <= 0 {
+		t.Errorf("Ports[%d] = %+v, expected redirects %v ending at the login page", port, pm, expected)
+	}
+
+	// Off-host targets are recorded but not followed
+	pm = meta.Ports[cloudPort]
+	if len(pm.Redirects) != 1 || pm.Redirects[0] != "http://cloud.example.com/portal" || pm.StatusCode != http.StatusMovedPermanently {
+		t.Errorf("Ports[%d] = %+v, expected the unfollowed cloud redirect", cloudPort, pm)
+	}
+	if !strings.HasSuffix(pm.FinalURL, ":"+strconv.Itoa(cloudPort)+"/") {
+		t.Errorf("Ports[%d].FinalURL = %q, expected the probed URL", cloudPort, pm.FinalURL)
+	}
+}
+
+func TestProbeBrandDetails(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ISAPI/System/deviceInfo", func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "admin" || pass != "12345" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="DS-2CD2042WD-I"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		io.WriteString(w, `<?xml version="1.0" encoding="UTF-8"?>
+<DeviceInfo version="2.0" xmlns="http://www.hikvision.com/ver20/XMLSchema">
+<deviceName>IP CAMERA</deviceName><model>DS-2CD2042WD-I</model>
+<serialNumber>DS-2CD2042WD-I20170101AAWR123456789</serialNumber><macAddress>c0:56:e3:00:00:01</macAddress>
+<firmwareVersion>V5.4.5</firmwareVersion><firmwareReleasedDate>build 170124</firmwareReleasedDate><deviceType>IPCamera</deviceType>
+</DeviceInfo>`)
+	})
+	mux.HandleFunc("/axis-cgi/param.cgi", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "root.Brand.Brand=AXIS\nroot.Brand.ProdNbr=M3045-V\nroot.Brand.ProdType=Network Camera\n"+
+			"root.Properties.Firmware.Version=9.80.1\nroot.Properties.System.SerialNumber=ACCC8E000001\n")
+	})
+	mux.HandleFunc("/RPC2_Login", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"error":{"code":268632079,"message":"Component error: login challenge!"},"id":1,`+
+			`"params":{"encryption":"Default","mac":"3CEF8C000001","random":"1234","realm":"Login to 4K0ABCDPAZ12345"},"result":false,"session":"x"}`)
+	})
+	mux.HandleFunc("/cgi-bin/magicBox.cgi", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("WWW-Authenticate", `Digest realm="Login to 4K0ABCDPAZ12345", nonce="abc", qop="auth"`)
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	port := server.Listener.Addr().(*net.TCPAddr).Port
+	ctx := context.Background()
+
+	if _, err := ProbeBrandDetails(ctx, "127.0.0.1", []int{port}, "Hikvision", "", ""); !errors.Is(err, ErrDeviceUnauthorized) {
+		t.Errorf("Hikvision without credentials: err = %v, expected ErrDeviceUnauthorized", err)
+	}
+	d, err := ProbeBrandDetails(ctx, "127.0.0.1", []int{port}, "Hikvision", "admin", "12345")
+	if err != nil || d.Model != "DS-2CD2042WD-I" || d.Firmware != "V5.4.5 build 170124" || d.MAC != "c0:56:e3:00:00:01" || !d.Authenticated {
+		t.Errorf("Hikvision = %+v, %v", d, err)
+	}
+
+	d, err = ProbeBrandDetails(ctx, "127.0.0.1", []int{port}, "Axis", "", "")
+	if err != nil || d.Model != "M3045-V" || d.Firmware != "9.80.1" || d.Serial != "ACCC8E000001" || d.DeviceType != "Network Camera" {
+		t.Errorf("Axis = %+v, %v", d, err)
+	}
+
+	// The serial leaks through the login challenge even when magicBox wants a password
+	d, err = ProbeBrandDetails(ctx, "127.0.0.1", []int{port}, "Dahua", "", "")
+	if !errors.Is(err, ErrDeviceUnauthorized) || d.Serial != "4K0ABCDPAZ12345" || d.MAC != "3CEF8C000001" || d.Model != "" {
+		t.Errorf("Dahua = %+v, %v", d, err)
+	}
+
+	if HasBrandProbe("Sony") {
+		t.Error("HasBrandProbe(Sony) = true")
+	}
+}
+
+func TestProbeONVIFServices(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.URL.Path != onvifDeviceServicePath || !strings.Contains(string(body), "GetSystemDateAndTime") {
+			http.NotFound(w, r)
+			return
+		}
+		io.WriteString(w, `<?xml version="1.0" encoding="UTF-8"?>
+<SOAP-ENV:Envelope xmlns:SOAP-ENV="http://www.w3.org/2003/05/soap-envelope" xmlns:tds="http://www.onvif.org/ver10/device/wsdl" xmlns:tt="http://www.onvif.org/ver10/schema">
+<SOAP-ENV:Body><tds:GetSystemDateAndTimeResponse><tds:SystemDateAndTime>
+<tt:DateTimeType>NTP</tt:DateTimeType><tt:DaylightSavings>false</tt:DaylightSavings>
+<tt:TimeZone><tt:TZ>CST-8:00:00</tt:TZ></tt:TimeZone>
+<tt:UTCDateTime><tt:Time><tt:Hour>3</tt:Hour><tt:Minute>4</tt:Minute><tt:Second>5</tt:Second></tt:Time>
+<tt:Date><tt:Year>2021</tt:Year><tt:Month>6</tt:Month><tt:Day>7</tt:Day></tt:Date></tt:UTCDateTime>
+</tds:SystemDateAndTime></tds:GetSystemDateAndTimeResponse></SOAP-ENV:Body></SOAP-ENV:Envelope>`)
+	}))
+	defer server.Close()
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "<html>not onvif</html>")
+	}))
+	defer plain.Close()
+	port := server.Listener.Addr().(*net.TCPAddr).Port
+	plainPort := plain.Listener.Addr().(*net.TCPAddr).Port
+
+	services := ProbeONVIFServices(context.Background(), "127.0.0.1", []int{plainPort, port})
+	if len(services) != 1 {
+		t.Fatalf("ProbeONVIFServices() = %+v, expected one service", services)
+	}
+	s := services[0]
+	expected := time.Date(2021, 6, 7, 3, 4, 5, 0, time.UTC)
+	if !strings.HasSuffix(s.URL, ":"+strconv.Itoa(port)+onvifDeviceServicePath) || !s.DeviceTime.Equal(expected) || s.TimeZone != "CST-8:00:00" {
+		t.Errorf("service = %+v, expected %s at %s", s, onvifDeviceServicePath, expected)
+	}
+	if s.ClockSkew >= 0 {
+		t.Errorf("ClockSkew = %s, expected the 2021 clock to be behind", s.ClockSkew)
+	}
+}
+
+func TestP2PIndicatorsFromScan(t *testing.T) {
+	meta := HTTPMeta{Ports: map[int]PortMeta{
+		80:   {Body: `<script src="/js/NetSurveillance.js"></script>`},
+		8080: {Body: `<a href="#">Hik-Connect</a>`},
+	}}
+	got := fmt.Sprint(P2PIndicatorsFromScan([]int{8080, 34567, 80}, meta))
+	expected := "[XMEye: port 34567 open Hik-Connect: web UI on port 8080 mentions hik-connect]"
+	if got != expected {
+		t.Errorf("P2PIndicatorsFromScan() = %s, expected %s", got, expected)
+	}
+	if got := P2PIndicatorsFromScan([]int{80}, HTTPMeta{}); len(got) != 0 {
+		t.Errorf("P2PIndicatorsFromScan() = %v without evidence", got)
+	}
+}
+
+func TestProbeP2PStatus(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ISAPI/System/Network/EZVIZ", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `<?xml version="1.0" encoding="UTF-8"?>
+<EZVIZ version="2.0" xmlns="http://www.hikvision.com/ver20/XMLSchema"><enabled>true</enabled><registerStatus>true</registerStatus>
+<serverAddress><addressingFormatType>hostname</addressingFormatType><hostName>dev.ezvizlife.com</hostName></serverAddress></EZVIZ>`)
+	})
+	mux.HandleFunc("/cgi-bin/configManager.cgi", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("name") != "T2UServer" {
+			http.NotFound(w, r)
+			return
+		}
+		io.WriteString(w, "table.T2UServer.Enable=false\r\n")
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	port := server.Listener.Addr().(*net.TCPAddr).Port
+
+	tests := []struct {
+		brand    string
+		expected string
+	}{
+		{"Hikvision", "Hik-Connect: EZVIZ enabled, registered with dev.ezvizlife.com (enabled)"},
+		{"Dahua", "Dahua P2P: T2UServer disabled"},
+	}
+	for _, test := range tests {
+		status, err := ProbeP2PStatus(context.Background(), "127.0.0.1", []int{port}, test.brand, "", "")
+		if err != nil || status.String() != test.expected {
+			t.Errorf("ProbeP2PStatus(%s) = %q, %v, expected %q", test.brand, status, err, test.expected)
+		}
+	}
+}
+
+func TestMeasureLatency(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedPort := closed.Addr().(*net.TCPAddr).Port
+	closed.Close()
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	latency := MeasureLatency(context.Background(), "127.0.0.1", []int{port, closedPort})
+	if l := latency[port]; !l.Up() || l.Flaky() || l.Attempts != latencySamples || l.Connect <= 0 {
+		t.Errorf("MeasureLatency()[%d] = %+v, expected %d clean connects", port, l, latencySamples)
+	}
+	if l := latency[closedPort]; l.Up() || l.Failures != latencySamples {
+		t.Errorf("MeasureLatency()[%d] = %+v, expected every connect refused", closedPort, l)
+	}
+	if l := (PortLatency{Attempts: 3, Failures: 1}); !l.Flaky() {
+		t.Errorf("%+v.Flaky() = false, expected true", l)
+	}
+}
+
+func TestAuditHTTPExposure(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Access-Control-Allow-Origin", r.Header.Get("Origin"))
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+		io.WriteString(w, `<html><form><input type="password" name="pw"></form></html>`)
+	})
+	mux.HandleFunc("/setup.html", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "<html><h1>Network settings</h1></html>")
+	})
+	mux.HandleFunc("/admin/", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `<html><input type=password></html>`) // Login form, not exposure
+	})
+	mux.HandleFunc("/system.ini", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write([]byte{0x00, 0x01, 0x02, 0x03})
+	})
+	mux.HandleFunc("/config", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/", http.StatusFound) // Redirect to login, not exposure
+	})
+	mux.HandleFunc("/log/", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "<html><title>Index of /log/</title></html>")
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	// Answers every path with its login page
+	catchAll := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Frame-Options", "SAMEORIGIN")
+		io.WriteString(w, "<html>app</html>")
+	}))
+	defer catchAll.Close()
+	port := server.Listener.Addr().(*net.TCPAddr).Port
+	catchAllPort := catchAll.Listener.Addr().(*net.TCPAddr).Port
+
+	findings := AuditHTTPExposure(context.Background(), "127.0.0.1", []int{port, catchAllPort})
+	got := make(map[string]ExposureFinding)
+	for _, f := range findings {
+		got[f.Kind+" "+strings.TrimPrefix(f.URL, "http://127.0.0.1:"+strconv.Itoa(port))] = f
+		if strings.Contains(f.URL, ":"+strconv.Itoa(catchAllPort)) {
+			t.Errorf("AuditHTTPExposure() reported %v on the catch-all server", f)
+		}
+	}
+	expected := map[string]string{
+		ExposurePermissiveCORS + " /":                 "medium",
+		ExposureFramable + " /":                       "low",
+		ExposureUnauthenticatedAdmin + " /setup.html": "high",
+		ExposureConfigBackup + " /system.ini":         "high",
+		ExposureDirectoryListing + " /log/":           "medium",
+	}
+	for key, severity := range expected {
+		if f, ok := got[key]; !ok || f.Severity != severity {
+			t.Errorf("AuditHTTPExposure() finding %q = %+v, expected severity %s", key, f, severity)
+		}
+	}
+	if len(findings) != len(expected) {
+		t.Errorf("AuditHTTPExposure() = %v, expected %d findings", findings, len(expected))
+	}
+}
+
+func TestRegisterProbe(t *testing.T) {
+	builtin := Probes()
+	t.Cleanup(func() {
+		registryMu.Lock()
+		registry = builtin
+		registryMu.Unlock()
+	})
+
+	var gotPorts []int
+	Register(NewProbe("test-echo", FilterRTSP, func(ctx context.Context, host string, ports []int) Findings {
+		gotPorts = ports
+		return FindingList{{Probe: "test-echo", Port: ports[0], Detail: "echo from " + host}}
+	}))
+	if err := register(NewProbe("test-echo", nil, nil)); err == nil {
+		t.Error("register() accepted a duplicate probe name")
+	}
+	if probes := Probes(); len(probes) != len(builtin)+1 || probes[len(probes)-1].Name() != "test-echo" {
+		t.Errorf("Probes() = %d probes, expected test-echo appended to %d", len(probes), len(builtin))
+	}
+
+	// Keep the built-in probes short: nothing listens on the closed port
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedPort := closed.Addr().(*net.TCPAddr).Port
+	closed.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	result := OptimizedProbe(ctx, "127.0.0.1", []int{closedPort, 554})
+	if fmt.Sprint(gotPorts) != "[554]" {
+		t.Errorf("test-echo ran on %v, expected the RTSP port only", gotPorts)
+	}
+	if len(result.Findings) != 1 || result.Findings[0].String() != "test-echo (554): echo from 127.0.0.1" {
+		t.Errorf("OptimizedProbe() findings = %v", result.Findings)
+	}
+}
+
+func TestProbeGSOAP(t *testing.T) {
+	header := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "gSOAP/2.8")
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer header.Close()
+	fault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `<SOAP-ENV:Envelope><SOAP-ENV:Body><SOAP-ENV:Fault><SOAP-ENV:Reason><SOAP-ENV:Text>Method 'tds:CctvscanNoSuchOperation' not implemented: method name or namespace not recognized</SOAP-ENV:Text></SOAP-ENV:Reason></SOAP-ENV:Fault></SOAP-ENV:Body></SOAP-ENV:Envelope>`)
+	}))
+	defer fault.Close()
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `<s:Envelope><s:Body><s:Fault><s:Reason><s:Text>ActionNotSupported</s:Text></s:Reason></s:Fault></s:Body></s:Envelope>`)
+	}))
+	defer other.Close()
+	port := func(s *httptest.Server) int { return s.Listener.Addr().(*net.TCPAddr).Port }
+
+	if info := ProbeGSOAP(context.Background(), "127.0.0.1", []int{port(other), port(header)}); info.Version != "2.8" || !strings.Contains(info.URL, strconv.Itoa(port(header))) {
+		t.Errorf("ProbeGSOAP() = %+v, expected version 2.8 from the Server header", info)
+	}
+	if info := ProbeGSOAP(context.Background(), "127.0.0.1", []int{port(fault)}); !info.Found() || info.Version != "" || info.DevilsIvy() != "possible" {
+		t.Errorf("ProbeGSOAP() = %+v, expected gSOAP from the fault wording", info)
+	}
+	if info := ProbeGSOAP(context.Background(), "127.0.0.1", []int{port(other)}); info.Found() {
+		t.Errorf("ProbeGSOAP() = %+v for another SOAP stack, expected nothing", info)
+	}
+
+	tests := []struct {
+		version  string
+		expected string
+	}{
+		{"2.8.47", "vulnerable"},
+		{"2.7.17", "vulnerable"},
+		{"2.8.48", "patched"},
+		{"2.8.105", "patched"},
+		{"2.8", "possible"},
+		{"2.6.2", ""},
+	}
+	for _, test := range tests {
+		g := GSOAPInfo{URL: "http://192.0.2.1/onvif/device_service", Version: test.version}
+		if result := g.DevilsIvy(); result != test.expected {
+			t.Errorf("GSOAPInfo{Version: %q}.DevilsIvy() = %q, expected %q", test.version, result, test.expected)
+		}
+	}
+}
+
+func TestProbeISAPI(t *testing.T) {
+	jpeg := []byte{0xff, 0xd8, 0xff, 0xe0, 0x00, 0x10}
+	const responseStatus = `<?xml version="1.0" encoding="UTF-8"?><userCheck version="2.0" xmlns="http://www.hikvision.com/ver20/XMLSchema"><statusValue>401</statusValue></userCheck>`
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("WWW-Authenticate", `Digest realm="DS-2CD2042WD", nonce="abc", qop="auth"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		io.WriteString(w, responseStatus)
+	})
+	mux.HandleFunc("/SDK/webLanguage", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `<Language><type>en</type></Language>`)
+	})
+	mux.HandleFunc("/onvif-http/snapshot", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("auth") != "YWRtaW46MTEK" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write(jpeg)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	plain := httptest.NewServer(http.NotFoundHandler())
+	defer plain.Close()
+	port := server.Listener.Addr().(*net.TCPAddr).Port
+	plainPort := plain.Listener.Addr().(*net.TCPAddr).Port
+
+	info := ProbeISAPI(context.Background(), "127.0.0.1", []int{plainPort, port})
+	if !strings.HasSuffix(info.Base, ":"+strconv.Itoa(port)) || len(info.Endpoints) != len(isapiEndpoints) {
+		t.Fatalf("ProbeISAPI() = %+v, expected every endpoint on port %d", info, port)
+	}
+	if e := info.Endpoints[0]; e.Status != http.StatusUnauthorized || e.Auth != "Digest" {
+		t.Errorf("ProbeISAPI() deviceInfo = %+v, expected a Digest 401", e)
+	}
+	if open := info.OpenEndpoints(); fmt.Sprint(open) != "[/SDK/webLanguage]" {
+		t.Errorf("OpenEndpoints() = %v, expected [/SDK/webLanguage]", open)
+	}
+	if info.Bypass != "" {
+		t.Errorf("ProbeISAPI() checked the bypass without opt-in: %q", info.Bypass)
+	}
+
+	cfg := DefaultProbeConfig()
+	cfg.CheckISAPIBypass = true
+	info = ProbeISAPI(WithConfig(context.Background(), cfg), "127.0.0.1", []int{port})
+	if !strings.HasSuffix(info.Bypass, isapiBypassPath) {
+		t.Errorf("ProbeISAPI() bypass = %q, expected the snapshot URL", info.Bypass)
+	}
+
+	if info := ProbeISAPI(context.Background(), "127.0.0.1", []int{plainPort}); info.Found() {
+		t.Errorf("ProbeISAPI() = %+v for a plain web server", info)
+	}
+}
+
+func TestInferWebLanguage(t *testing.T) {
+	for firmware, expected := range map[string]string{
+		"V5.4.5 build 170124":   CVEInferred,
+		"V5.5.800 build 210628": CVENotConfirmed,
+		"V5.7.3build 220112":    CVENotConfirmed,
+	} {
+		if c, ok := InferWebLanguage(firmware); !ok || c.CVE != WebLanguageCVE || c.Status != expected {
+			t.Errorf("InferWebLanguage(%q) = %+v, %v, expected %s", firmware, c, ok, expected)
+		}
+	}
+	if c, ok := InferWebLanguage("V5.4.5"); ok {
+		t.Errorf("InferWebLanguage() = %+v without a build date", c)
+	}
+}
+
+func TestCheckCVEs(t *testing.T) {
+	// A vulnerable Hikvision camera serves the forged-token snapshot
+	hik := http.NewServeMux()
+	hik.HandleFunc("/onvif-http/snapshot", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("auth") != "YWRtaW46MTEK" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte{0xff, 0xd8, 0xff, 0xe0})
+	})
+	hik.HandleFunc("/SDK/webLanguage", func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("CheckCVEs() sent %s /SDK/webLanguage", r.Method)
+	})
+	hikServer := httptest.NewServer(hik)
+	defer hikServer.Close()
+	plain := httptest.NewServer(http.NotFoundHandler())
+	defer plain.Close()
+	hikPort := hikServer.Listener.Addr().(*net.TCPAddr).Port
+	plainPort := plain.Listener.Addr().(*net.TCPAddr).Port
+
+	checks := CheckCVEs(context.Background(), "127.0.0.1", []int{plainPort, hikPort}, "Hikvision")
+	if len(checks) != 1 || checks[0].CVE != ISAPIBypassCVE || checks[0].Status != CVEConfirmed {
+		t.Errorf("CheckCVEs(Hikvision) = %+v, expected CVE-2017-7921 confirmed", checks)
+	}
+	if checks := CheckCVEs(context.Background(), "127.0.0.1", []int{plainPort}, "Hikvision"); len(checks) != 0 {
+		t.Errorf("CheckCVEs() = %+v for a plain web server", checks)
+	}
+
+	// A patched Dahua refuses the NetKeyboard login, a vulnerable one lets it in
+	// and is logged out again
+	var vulnerable bool
+	var logouts int
+	dahua := http.NewServeMux()
+	dahua.HandleFunc("/RPC2_Login", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !strings.Contains(string(body), `"clientType":"NetKeyboard"`) {
+			t.Errorf("RPC2_Login body = %s", body)
+		}
+		if vulnerable {
+			io.WriteString(w, `{"id":1,"params":null,"result":true,"session":"a1b2c3"}`)
+			return
+		}
+		io.WriteString(w, `{"error":{"code":268632085,"message":"Component error: User or password not valid!"},"id":1,"result":false,"session":0}`)
+	})
+	dahua.HandleFunc("/RPC2", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if strings.Contains(string(body), `"global.logout"`) && strings.Contains(string(body), `"a1b2c3"`) {
+			logouts++
+		}
+		io.WriteString(w, `{"id":2,"result":true}`)
+	})
+	dahuaServer := httptest.NewServer(dahua)
+	defer dahuaServer.Close()
+	dahuaPort := dahuaServer.Listener.Addr().(*net.TCPAddr).Port
+
+	if checks := CheckCVEs(context.Background(), "127.0.0.1", []int{dahuaPort}, "Dahua"); len(checks) != 1 || checks[0].Status != CVENotConfirmed {
+		t.Errorf("CheckCVEs(patched Dahua) = %+v, expected CVE-2021-33044 not confirmed", checks)
+	}
+	vulnerable = true
+	if checks := CheckCVEs(context.Background(), "127.0.0.1", []int{dahuaPort}, "Dahua"); len(checks) != 1 || checks[0].Status != CVEConfirmed || logouts != 1 {
+		t.Errorf("CheckCVEs(vulnerable Dahua) = %+v with %d logouts, expected CVE-2021-33044 confirmed and one logout", checks, logouts)
+	}
+	if HasCVEChecks("Axis") {
+		t.Error("HasCVEChecks(Axis) = true")
+	}
+}
+
+func TestParseARP(t *testing.T) {
+	proc := `IP address       HW type     Flags       HW address            Mask     Device
+192.168.1.1      0x1         0x2         f0:9f:c2:aa:bb:cc     *        eth0
+192.168.1.64     0x1         0x2         28:57:BE:12:34:56     *        eth0
+192.168.1.99     0x1         0x0         00:00:00:00:00:00     *        eth0
+`
+	tests := []struct {
+		ip       string
+		expected string
+	}{
+		{"192.168.1.64", "28:57:be:12:34:56"},
+		{"192.168.1.99", ""}, // Incomplete
+		{"192.168.1.6", ""},
+	}
+	for _, test := range tests {
+		if result := parseProcARP(strings.NewReader(proc), test.ip); result != test.expected {
+			t.Errorf("parseProcARP(%q) = %q, expected %q", test.ip, result, test.expected)
+		}
+	}
+
+	if result := parseARPOutput("? (192.168.1.64) at 28:57:be:2:3:4 on en0 ifscope [ethernet]\n"); result != "28:57:be:02:03:04" {
+		t.Errorf("parseARPOutput() = %q, expected the padded MAC", result)
+	}
+	if result := parseARPOutput("192.168.1.6 (192.168.1.6) -- no entry\n"); result != "" {
+		t.Errorf("parseARPOutput() = %q for a missing entry", result)
+	}
+	if result := NormalizeMAC("28-57-BE-12-34-56"); result != "28:57:be:12:34:56" {
+		t.Errorf("NormalizeMAC() = %q for the SADP format", result)
+	}
+}
@@ -0,0 +1,135 @@
+package probe
+
+import (
+	"context"
+	"fmt"
+	"plugin"
+	"slices"
+	"sync"
+)
+
+// Probe is one protocol check run by OptimizedProbe. Built-in probes fill the
+// fields of OptimizedProbeResult; others report Findings. Register a Probe from
+// an init function of a subpackage, or build it as a Go plugin (see LoadPlugin).
+type Probe interface {
+	// Name identifies the probe in findings and debug output, e.g. "rtsp"
+	Name() string
+	// Ports selects the ports the probe wants among the open ones. The probe is
+	// skipped when none are selected; UDP probes return open unchanged.
+	Ports(open []int) []int
+	// Run probes host within ctx, which carries the ProbeConfig
+	Run(ctx context.Context, host string, ports []int) Findings
+}
+
+// Findings is what one probe learned. Record is called once every probe has
+// finished, one probe at a time, so it needs no locking.
+type Findings interface {
+	Record(result *OptimizedProbeResult)
+}
+
+// Finding is an observation of a probe without a dedicated result field
+type Finding struct {
+	Probe  string
+	Port   int // 0 when not tied to a port
+	Detail string
+}
+
+func (f Finding) String() string {
+	if f.Port == 0 {
+		return f.Probe + ": " + f.Detail
+	}
+	return fmt.Sprintf("%s (%d): %s", f.Probe, f.Port, f.Detail)
+}
+
+// FindingList is the Findings of a probe that only reports Finding values
+type FindingList []Finding
+
+// Record appends the findings to result.Findings
+func (l FindingList) Record(result *OptimizedProbeResult) {
+	result.Findings = append(result.Findings, l...)
+}
+
+// RecordFunc adapts a function that stores results in their field to Findings
+type RecordFunc func(result *OptimizedProbeResult)
+
+// Record calls f
+func (f RecordFunc) Record(result *OptimizedProbeResult) {
+	if f != nil {
+		f(result)
+	}
+}
+
+// funcProbe is a Probe built from functions, see NewProbe
+type funcProbe struct {
+	name  string
+	ports func(open []int) []int
+	run   func(ctx context.Context, host string, ports []int) Findings
+}
+
+func (p funcProbe) Name() string { return p.name }
+
+func (p funcProbe) Ports(open []int) []int { return p.ports(open) }
+
+func (p funcProbe) Run(ctx context.Context, host string, ports []int) Findings {
+	return p.run(ctx, host, ports)
+}
+
+// NewProbe returns a Probe from a port filter such as FilterRTSP and a run function.
+// A nil filter selects every open port.
+func NewProbe(name string, ports func(open []int) []int, run func(ctx context.Context, host string, ports []int) Findings) Probe {
+	if ports == nil {
+		ports = func(open []int) []int { return open }
+	}
+	return funcProbe{name: name, ports: ports, run: run}
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   []Probe
+)
+
+// Register adds p to the probes run by OptimizedProbe. Like database/sql.Register
+// it panics if the name is taken, since that is a programming error.
+func Register(p Probe) {
+	if err := register(p); err != nil {
+		panic(err)
+	}
+}
+
+func register(p Probe) error {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if slices.ContainsFunc(registry, func(r Probe) bool { return r.Name() == p.Name() }) {
+		return fmt.Errorf("probe: %s is already registered", p.Name())
+	}
+	registry = append(registry, p)
+	return nil
+}
+
+// Probes returns the registered probes in registration order
+func Probes() []Probe {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	return slices.Clone(registry)
+}
+
+// LoadPlugin opens a Go plugin built with -buildmode=plugin and registers the
+// Probe it exports as the variable "Probe"
+func LoadPlugin(path string) (string, error) {
+	plug, err := plugin.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open probe plugin: %w", err)
+	}
+	sym, err := plug.Lookup("Probe")
+	if err != nil {
+		return "", fmt.Errorf("probe plugin %s: %w", path, err)
+	}
+	p, ok := sym.(*Probe)
+	if !ok || *p == nil {
+		return "", fmt.Errorf("probe plugin %s: Probe is a %T, expected a probe.Probe variable", path, sym)
+	}
+	if err := register(*p); err != nil {
+		return "", fmt.Errorf("probe plugin %s: %w", path, err)
+	}
+	return (*p).Name(), nil
+}
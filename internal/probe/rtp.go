@@ -0,0 +1,231 @@
+package probe
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/postfix/cctvscan/internal/util"
+)
+
+// maxRTPVerify bounds the streams played per host; DVRs often answer every path
+// with the same channel
+const maxRTPVerify = 4
+
+// VerifyRTSPStream plays streamURL without credentials over TCP-interleaved transport
+// and returns nil once an RTP packet arrives within the RTP I/O timeout. The first video track is set up, or the
+// first track if there is no video.
+func VerifyRTSPStream(ctx context.Context, streamURL string) error {
+	u, err := url.Parse(streamURL)
+	if err != nil {
+		return err
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "554")
+	}
+	t := ConfigFrom(ctx).RTP
+	conn, err := t.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(t.Deadline())
+	rc := &rtspConn{conn: conn, br: bufio.NewReader(conn)}
+
+	code, header, body, err := rc.do("DESCRIBE", streamURL, "Accept: application/sdp\r\n")
+	if err != nil {
+		return err
+	}
+	if code != 200 {
+		return fmt.Errorf("DESCRIBE %s: RTSP %d", streamURL, code)
+	}
+	base := streamURL
+	if cb := header.Get("Content-Base"); cb != "" {
+		base = cb
+	}
+	track, ok := playableTrack(ParseSDP(string(body)))
+	if !ok {
+		return errors.New("SDP has no tracks")
+	}
+
+	setupURL := rtspControlURL(base, track.Control)
+	code, header, _, err = rc.do("SETUP", setupURL, "Transport: RTP/AVP/TCP;unicast;interleaved=0-1\r\n")
+	if err != nil {
+		return err
+	}
+	if code != 200 {
+		return fmt.Errorf("SETUP %s: RTSP %d", setupURL, code)
+	}
+	session, _, _ := strings.Cut(header.Get("Session"), ";")
+	if session == "" {
+		return errors.New("SETUP answer without a session")
+	}
+
+	code, _, _, err = rc.do("PLAY", base, "Session: "+session+"\r\nRange: npt=0.000-\r\n")
+	if err != nil {
+		return err
+	}
+	if code != 200 {
+		return fmt.Errorf("PLAY %s: RTSP %d", base, code)
+	}
+
+	conn.SetDeadline(t.Deadline())
+	err = rc.awaitRTP()
+	// Be polite; the device may cap concurrent viewers
+	conn.SetDeadline(time.Now().Add(500 * time.Millisecond))
+	rc.send("TEARDOWN", base, "Session: "+session+"\r\n")
+	return err
+}
+
+// VerifyRTSPStreams plays up to maxRTPVerify of streams and records whether RTP
+// arrived
+func VerifyRTSPStreams(ctx context.Context, streams []RTSPStream) {
+	for i := range streams {
+		if i >= maxRTPVerify || ctx.Err() != nil {
+			break
+		}
+		streams[i].Checked = true
+		streams[i].Viewable = VerifyRTSPStream(ctx, streams[i].URL) == nil
+	}
+}
+
+// playableTrack picks the first video track, falling back to the first track
+func playableTrack(info SDPInfo) (SDPTrack, bool) {
+	for _, t := range info.Tracks {
+		if t.Media == "video" {
+			return t, true
+		}
+	}
+	if len(info.Tracks) == 0 {
+		return SDPTrack{}, false
+	}
+	return info.Tracks[0], true
+}
+
+// rtspControlURL resolves a track's a=control against the session base (RFC 2326 C.1.1)
+func rtspControlURL(base, control string) string {
+	switch {
+	case control == "" || control == "*":
+		return base
+	case strings.HasPrefix(strings.ToLower(control), "rtsp://"):
+		return control
+	}
+	if !strings.HasSuffix(base, "/") {
+		base += "/"
+	}
+	return base + strings.TrimPrefix(control, "/")
+}
+
+// rtspConn issues sequential RTSP requests on one connection
+type rtspConn struct {
+	conn net.Conn
+	br   *bufio.Reader
+	cseq int
+}
+
+func (c *rtspConn) send(method, url, headers string) error {
+	c.cseq++
+	_, err := fmt.Fprintf(c.conn, "%s %s RTSP/1.0\r\nCSeq: %d\r\nUser-Agent: CCTVScan/1.0\r\n%s\r\n", method, url, c.cseq, headers)
+	return err
+}
+
+// do sends a request and reads the answer, skipping interleaved frames that arrive
+// ahead of it
+func (c *rtspConn) do(method, url, headers string) (int, textproto.MIMEHeader, []byte, error) {
+	if err := c.send(method, url, headers); err != nil {
+		return 0, nil, nil, err
+	}
+	for {
+		b, err := c.br.Peek(1)
+		if err != nil {
+			return 0, nil, nil, err
+		}
+		if b[0] != '$' {
+			break
+		}
+		if _, _, err := c.readFrame(); err != nil {
+			return 0, nil, nil, err
+		}
+	}
+
+	tp := textproto.NewReader(c.br)
+	status, err := tp.ReadLine()
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	fields := strings.Fields(status)
+	if len(fields) < 2 || !strings.HasPrefix(fields[0], "RTSP/") {
+		return 0, nil, nil, fmt.Errorf("bad RTSP status line %q", status)
+	}
+	header, err := tp.ReadMIMEHeader()
+	if err != nil && len(header) == 0 {
+		return 0, nil, nil, err
+	}
+	var body []byte
+	if n := util.Atoi(header.Get("Content-Length")); n > 0 {
+		body = make([]byte, min(n, maxSDPSize))
+		if _, err := io.ReadFull(c.br, body); err != nil {
+			return 0, nil, nil, err
+		}
+		if n > len(body) {
+			c.br.Discard(n - len(body))
+		}
+	}
+	return util.Atoi(fields[1]), header, body, nil
+}
+
+// readFrame reads one interleaved frame: '$', channel, 16 bit length, payload
+func (c *rtspConn) readFrame() (byte, []byte, error) {
+	var hdr [4]byte
+	if _, err := io.ReadFull(c.br, hdr[:]); err != nil {
+		return 0, nil, err
+	}
+	payload := make([]byte, binary.BigEndian.Uint16(hdr[2:]))
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		return 0, nil, err
+	}
+	return hdr[1], payload, nil
+}
+
+// awaitRTP reads until an RTP packet arrives on the media channel
+func (c *rtspConn) awaitRTP() error {
+	for {
+		b, err := c.br.Peek(1)
+		if err != nil {
+			return fmt.Errorf("no RTP after PLAY: %w", err)
+		}
+		if b[0] != '$' {
+			// An RTSP message from the server, e.g. a keepalive answer
+			if _, err := c.br.ReadString('\n'); err != nil {
+				return err
+			}
+			continue
+		}
+		channel, payload, err := c.readFrame()
+		if err != nil {
+			return err
+		}
+		if channel == 0 && IsRTPPacket(payload) {
+			return nil
+		}
+	}
+}
+
+// IsRTPPacket reports whether b has a valid RTP version 2 fixed header (RFC 3550 5.1)
+func IsRTPPacket(b []byte) bool {
+	if len(b) < 12 || b[0]>>6 != 2 {
+		return false
+	}
+	pt := b[1] & 0x7F
+	// 72-76 are RTCP packet types seen through the marker bit
+	return pt < 72 || pt > 76
+}
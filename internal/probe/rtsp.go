@@ -7,7 +7,7 @@ import (
 	"io"
 	"net"
 	"strings"
-	"time"
+	"sync"
 
 	"github.com/postfix/cctvscan/internal/util"
 )
@@ -31,11 +31,13 @@ func FilterRTSP(ports []int) []int {
 
 func ProbeRTSP(ctx context.Context, host string, ports []int) RTSPInfo {
 	var info RTSPInfo
+	t := ConfigFrom(ctx).RTSP
 	for _, p := range ports {
+		if ctx.Err() != nil { break } // host budget spent
 		addr := net.JoinHostPort(host, util.Itoa(p))
-		c, err := net.DialTimeout("tcp", addr, 1200*time.Millisecond)
+		c, err := t.DialContext(ctx, "tcp", addr)
 		if err != nil { continue }
-		_ = c.SetDeadline(time.Now().Add(1500*time.Millisecond))
+		_ = c.SetDeadline(t.Deadline())
 		fmt.Fprintf(c, "OPTIONS rtsp://%s RTSP/1.0\r\nCSeq: 1\r\n\r\n", addr)
 		br := bufio.NewReader(c)
 		status, _ := br.ReadString('\n')
@@ -68,21 +70,100 @@ var RTSPPaths = []string{
 	"/axis-media/media.amp", "/cam/realmonitor?channel=1&subtype=0",
 }
 
+// rtspDescribeConcurrency bounds parallel DESCRIBEs per host; DVRs drop connections
+// when flooded
+const rtspDescribeConcurrency = 4
+
+// RTSPStream is a stream URL that plays without credentials and its SDP media
+type RTSPStream struct {
+	URL      string
+	Media    SDPInfo
+	Checked  bool // SETUP/PLAY was attempted (VerifyRTP)
+	Viewable bool // RTP packets arrived after PLAY
+}
+
+// EnumerateRTSPPaths DESCRIBEs every RTSPPaths entry on each RTSP port without
+// credentials. open lists the streams that answered 200 with a valid SDP, in port
+// and RTSPPaths order; these play for anyone. auth holds the challenge of each
+// port that answered 401.
+func EnumerateRTSPPaths(ctx context.Context, host string, ports []int) (open []RTSPStream, auth map[int]AuthChallenge) {
+	type job struct{ port, idx int }
+	found := make(map[job]SDPInfo)
+	auth = make(map[int]AuthChallenge)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, rtspDescribeConcurrency)
+
+	for _, p := range ports {
+		for i, path := range RTSPPaths {
+			wg.Add(1)
+			go func(j job, path string) {
+				defer wg.Done()
+				semaphore <- struct{}{}
+				defer func() { <-semaphore }()
+				if ctx.Err() != nil { return } // host budget spent
+
+				res, err := DescribeRTSP(ctx, host, j.port, path)
+				if err != nil { return }
+				mu.Lock()
+				defer mu.Unlock()
+				if res.Code == 200 && res.SDP {
+					found[j] = res.Media
+				}
+				if c, ok := PreferredChallenge(res.Auth); ok && res.Code == 401 {
+					if _, seen := auth[j.port]; !seen { auth[j.port] = c }
+				}
+			}(job{p, i}, path)
+		}
+	}
+	wg.Wait()
+
+	for _, p := range ports {
+		for i, path := range RTSPPaths {
+			if media, ok := found[job{p, i}]; ok {
+				open = append(open, RTSPStream{URL: "rtsp://" + net.JoinHostPort(host, util.Itoa(p)) + path, Media: media})
+			}
+		}
+	}
+	return open, auth
+}
+
 // RTSPCommands contains RTSP commands for capability detection
 var RTSPCommands = []string{
 	"OPTIONS", "DESCRIBE", "PLAY", "PAUSE", "SETUP", "TEARDOWN", "SET_PARAMETER", "GET_PARAMETER",
 }
 
+// RTSPDescribeResult is the outcome of a single DESCRIBE
+type RTSPDescribeResult struct {
+	Code  int             // RTSP status code, -1 if the status line was unreadable
+	SDP   bool            // 200 with an SDP body describing a video stream
+	Media SDPInfo         // Tracks of the SDP body, set when SDP is true
+	Auth  []AuthChallenge // WWW-Authenticate challenges, set on 401
+}
+
+// maxSDPSize bounds the DESCRIBE body read; sprop parameter sets of several tracks
+// can exceed a couple of KB
+const maxSDPSize = 8192
+
 // ProbeRTSPDescribe performs DESCRIBE request to validate RTSP streams
 func ProbeRTSPDescribe(ctx context.Context, host string, port int, path string) (int, bool, error) {
+	res, err := DescribeRTSP(ctx, host, port, path)
+	return res.Code, res.SDP, err
+}
+
+// DescribeRTSP sends an unauthenticated DESCRIBE for path and parses the status,
+// authentication challenges and SDP body
+func DescribeRTSP(ctx context.Context, host string, port int, path string) (RTSPDescribeResult, error) {
+	res := RTSPDescribeResult{Code: -1}
 	addr := net.JoinHostPort(host, util.Itoa(port))
-	c, err := net.DialTimeout("tcp", addr, 1000*time.Millisecond)
+	t := ConfigFrom(ctx).RTSP
+	c, err := t.DialContext(ctx, "tcp", addr)
 	if err != nil {
-		return -1, false, err
+		return res, err
 	}
 	defer c.Close()
 	
-	_ = c.SetDeadline(time.Now().Add(2000*time.Millisecond))
+	_ = c.SetDeadline(t.Deadline())
 	
 	url := "rtsp://" + addr + path
 	fmt.Fprintf(c, "DESCRIBE %s RTSP/1.0\r\nCSeq: 2\r\nUser-Agent: CCTVScan/1.0\r\nAccept: application/sdp\r\n\r\n", url)
@@ -90,20 +171,20 @@ func ProbeRTSPDescribe(ctx context.Context, host string, port int, path string)
 	br := bufio.NewReader(c)
 	status, err := br.ReadString('\n')
 	if err != nil {
-		return -1, false, err
+		return res, err
 	}
 	
-	var codeOut int = -1
 	if strings.HasPrefix(status, "RTSP/1.0 ") {
 		parts := strings.Split(status, " ")
 		if len(parts) >= 2 {
-			codeOut = util.Atoi(parts[1])
+			res.Code = util.Atoi(parts[1])
 		}
 	}
 	
 	// Read headers
 	var contentType string
 	var contentLength int = -1
+	var challenges []string
 	for {
 		line, err := br.ReadString('\n')
 		if err != nil || line == "\r\n" || line == "\n" {
@@ -117,25 +198,33 @@ func ProbeRTSPDescribe(ctx context.Context, host string, port int, path string)
 		if strings.HasPrefix(low, "content-length:") {
 			contentLength = util.Atoi(strings.TrimSpace(line[15:]))
 		}
+		if strings.HasPrefix(low, "www-authenticate:") {
+			challenges = append(challenges, strings.TrimSpace(line[17:]))
+		}
+	}
+	res.Auth = ParseAuthChallenges(challenges)
+	if res.Code != 200 {
+		return res, nil // no SDP to validate
 	}
 	
 	// Read partial body to validate SDP
 	var body []byte
 	if contentLength > 0 {
-		body = make([]byte, min(contentLength, 2048))
+		body = make([]byte, min(contentLength, maxSDPSize))
 		_, err = io.ReadFull(br, body)
 	} else {
 		// Read what we can get in reasonable time
-		body, _ = io.ReadAll(io.LimitReader(br, 2048))
+		body, _ = io.ReadAll(io.LimitReader(br, maxSDPSize))
 	}
 	
 	// Validate SDP content
 	bodyStr := string(body)
 	headerSdp := strings.Contains(strings.ToLower(contentType), "application/sdp") || strings.Contains(contentType, "/sdp")
 	looksSdp := strings.Contains(bodyStr, "v=0") && strings.Contains(bodyStr, "m=video")
+	res.SDP = headerSdp && looksSdp
+	if res.SDP {
+		res.Media = ParseSDP(bodyStr)
+	}
 	
-	return codeOut, (headerSdp && looksSdp), nil
+	return res, nil
 }
-
-
-
@@ -0,0 +1,135 @@
+package probe
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sadpGroup is the multicast group and port Hikvision's SADP (Search Active Devices
+// Protocol) uses; devices answer to the group rather than to the sender
+const sadpGroup = "239.255.255.250:37020"
+
+// SADPDevice is one Hikvision device that answered a SADP inquiry
+type SADPDevice struct {
+	Address         string // Source IP of the answer
+	DeviceType      string
+	Model           string // DeviceDescription, e.g. DS-2CD2042WD-I
+	SerialNumber    string
+	MAC             string
+	FirmwareVersion string // SoftwareVersion, e.g. V5.4.5build 170124
+	DSPVersion      string
+	HTTPPort        int
+	CommandPort     int // SDK port, usually 8000
+	Activated       bool
+	ActivationKnown bool // Older firmware doesn't report activation
+}
+
+// Found reports whether the device identified itself
+func (d SADPDevice) Found() bool {
+	return d.Model != "" || d.SerialNumber != ""
+}
+
+// sadpProbeMatch is the XML a device answers an inquiry with
+type sadpProbeMatch struct {
+	XMLName           xml.Name `xml:"ProbeMatch"`
+	DeviceType        string   `xml:"DeviceType"`
+	DeviceDescription string   `xml:"DeviceDescription"`
+	DeviceSN          string   `xml:"DeviceSN"`
+	MAC               string   `xml:"MAC"`
+	IPv4Address       string   `xml:"IPv4Address"`
+	SoftwareVersion   string   `xml:"SoftwareVersion"`
+	DSPVersion        string   `xml:"DSPVersion"`
+	HTTPPort          string   `xml:"HttpPort"`
+	CommandPort       string   `xml:"CommandPort"`
+	Activated         string   `xml:"Activated"`
+}
+
+// DiscoverSADP multicasts a SADP inquiry on the local network and collects answers
+// until wait elapses or ctx is done. SADP reports the exact model, firmware and
+// activation status of Hikvision devices. One device is returned per address.
+func DiscoverSADP(ctx context.Context, wait time.Duration) ([]SADPDevice, error) {
+	group, err := net.ResolveUDPAddr("udp4", sadpGroup)
+	if err != nil {
+		return nil, err
+	}
+	// Answers go to the group, so the socket has to join it on the SADP port
+	conn, err := net.ListenMulticastUDP("udp4", nil, group)
+	if err != nil {
+		return nil, fmt.Errorf("failed to join SADP multicast group: %w", err)
+	}
+	defer conn.Close()
+
+	msg := []byte(sadpInquiry(strings.ToUpper(strings.TrimPrefix(newMessageID(), "urn:uuid:"))))
+	for i := 0; i < 2; i++ {
+		if _, err := conn.WriteToUDP(msg, group); err != nil {
+			return nil, fmt.Errorf("failed to send SADP inquiry: %w", err)
+		}
+	}
+
+	deadline := time.Now().Add(wait)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetReadDeadline(deadline)
+
+	var devices []SADPDevice
+	seen := make(map[string]bool)
+	buf := make([]byte, 64*1024)
+	for ctx.Err() == nil {
+		n, addr, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			break // Read deadline reached
+		}
+		if seen[addr.IP.String()] {
+			continue
+		}
+		// Our own inquiry loops back and is skipped by the parser
+		device, ok := ParseSADPProbeMatch(buf[:n])
+		if !ok {
+			continue
+		}
+		device.Address = addr.IP.String()
+		seen[device.Address] = true
+		devices = append(devices, device)
+	}
+	return devices, nil
+}
+
+// ParseSADPProbeMatch decodes a SADP ProbeMatch; ok is false for anything else,
+// including inquiries from other SADP clients
+func ParseSADPProbeMatch(data []byte) (SADPDevice, bool) {
+	var m sadpProbeMatch
+	if err := xml.Unmarshal(data, &m); err != nil {
+		return SADPDevice{}, false
+	}
+	if m.DeviceDescription == "" && m.DeviceSN == "" {
+		return SADPDevice{}, false
+	}
+
+	device := SADPDevice{
+		Address:         strings.TrimSpace(m.IPv4Address),
+		DeviceType:      strings.TrimSpace(m.DeviceType),
+		Model:           strings.TrimSpace(m.DeviceDescription),
+		SerialNumber:    strings.TrimSpace(m.DeviceSN),
+		MAC:             strings.TrimSpace(m.MAC),
+		FirmwareVersion: strings.TrimSpace(m.SoftwareVersion),
+		DSPVersion:      strings.TrimSpace(m.DSPVersion),
+	}
+	device.HTTPPort, _ = strconv.Atoi(strings.TrimSpace(m.HTTPPort))
+	device.CommandPort, _ = strconv.Atoi(strings.TrimSpace(m.CommandPort))
+	if activated := strings.TrimSpace(m.Activated); activated != "" {
+		device.ActivationKnown = true
+		device.Activated = strings.EqualFold(activated, "true")
+	}
+	return device, true
+}
+
+// sadpInquiry builds the inquiry every SADP client sends
+func sadpInquiry(uuid string) string {
+	return `<?xml version="1.0" encoding="utf-8"?><Probe><Uuid>` + uuid + `</Uuid><Types>inquiry</Types></Probe>`
+}
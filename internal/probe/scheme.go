@@ -0,0 +1,96 @@
+package probe
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"sync"
+
+	"github.com/postfix/cctvscan/internal/util"
+)
+
+// TLS record types a server answers a ClientHello with: handshake or alert
+const (
+	tlsRecordAlert     = 0x15
+	tlsRecordHandshake = 0x16
+)
+
+// Sniffed scheme per host:port so every HTTP probe agrees on the same answer
+var (
+	schemeCache = make(map[string]string)
+	schemeMutex sync.RWMutex
+)
+
+// DetectScheme returns "https" if host:port speaks TLS and "http" otherwise.
+// Cameras often serve TLS on nonstandard ports (8000, 8081, 9000...), so the port
+// number alone isn't trusted; a ClientHello is sent and the first reply byte is
+// checked for a TLS record. If the port can't be reached, the well-known TLS ports
+// are used as a hint.
+func DetectScheme(ctx context.Context, host string, port int) string {
+	addr := net.JoinHostPort(host, util.Itoa(port))
+
+	schemeMutex.RLock()
+	if scheme, exists := schemeCache[addr]; exists {
+		schemeMutex.RUnlock()
+		return scheme
+	}
+	schemeMutex.RUnlock()
+
+	scheme, ok := sniffScheme(ctx, addr)
+	if !ok {
+		// Inconclusive, don't cache so a later probe can retry
+		if isHTTPS(port) {
+			return "https"
+		}
+		return "http"
+	}
+
+	schemeMutex.Lock()
+	schemeCache[addr] = scheme
+	schemeMutex.Unlock()
+	return scheme
+}
+
+// sniffScheme starts a TLS handshake and inspects the first byte of the reply.
+// ok is false when the port couldn't be reached or never answered.
+func sniffScheme(ctx context.Context, addr string) (scheme string, ok bool) {
+	t := ConfigFrom(ctx).HTTP
+	conn, err := t.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return "", false
+	}
+	defer conn.Close()
+	conn.SetDeadline(t.Deadline())
+
+	recorder := &firstByteConn{Conn: conn}
+	tlsConn := tls.Client(recorder, &tls.Config{
+		InsecureSkipVerify: true,
+		MinVersion:         tls.VersionTLS10, // Old firmware still answers with TLS 1.0
+	})
+	// A failed handshake is fine: an alert still proves the server speaks TLS
+	tlsConn.HandshakeContext(ctx)
+
+	if !recorder.seen {
+		return "", false
+	}
+	if recorder.first == tlsRecordHandshake || recorder.first == tlsRecordAlert {
+		return "https", true
+	}
+	return "http", true
+}
+
+// firstByteConn records the first byte the server sends
+type firstByteConn struct {
+	net.Conn
+	first byte
+	seen  bool
+}
+
+func (c *firstByteConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 && !c.seen {
+		c.first = b[0]
+		c.seen = true
+	}
+	return n, err
+}
@@ -0,0 +1,436 @@
+package probe
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+
+	"github.com/postfix/cctvscan/internal/util"
+)
+
+// SDPTrack is one media description (m= section) of an SDP body
+type SDPTrack struct {
+	Media     string // video, audio or application
+	Codec     string // rtpmap encoding name, e.g. H264, H265, PCMA
+	ClockRate int
+	Width     int // From the SPS in fmtp, else framesize/x-dimensions/cliprect
+	Height    int
+	Control   string // a=control, e.g. trackID=1
+}
+
+// SDPInfo is the media of a DESCRIBE answer
+type SDPInfo struct {
+	Tracks  []SDPTrack
+	Session []string // Session level lines that don't vary per host, e.g. s=Media Presentation
+}
+
+// Signature returns the lines of the description that tell servers apart: the
+// session level lines and the track controls
+func (s SDPInfo) Signature() []string {
+	lines := append([]string(nil), s.Session...)
+	for _, t := range s.Tracks {
+		if t.Control != "" {
+			lines = append(lines, "a=control:"+controlPath(t.Control))
+		}
+	}
+	return lines
+}
+
+// controlPath cuts an absolute control URL down to its path, which unlike the
+// address is the same on every device of a vendor
+func controlPath(control string) string {
+	if len(control) < 7 || !strings.EqualFold(control[:7], "rtsp://") {
+		return control
+	}
+	if i := strings.IndexByte(control[7:], '/'); i >= 0 {
+		return control[7+i:]
+	}
+	return "/"
+}
+
+// HasAudio reports whether the stream carries an audio track
+func (s SDPInfo) HasAudio() bool {
+	for _, t := range s.Tracks {
+		if t.Media == "audio" {
+			return true
+		}
+	}
+	return false
+}
+
+// String summarizes the tracks, e.g. "H264 1920x1080, PCMA audio"
+func (s SDPInfo) String() string {
+	var parts []string
+	for _, t := range s.Tracks {
+		codec := t.Codec
+		if codec == "" {
+			codec = "unknown"
+		}
+		switch {
+		case t.Media == "video" && t.Width > 0:
+			parts = append(parts, codec+" "+util.Itoa(t.Width)+"x"+util.Itoa(t.Height))
+		case t.Media == "video":
+			parts = append(parts, codec)
+		default:
+			parts = append(parts, codec+" "+t.Media)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// rtpStaticPayloads names the static RTP payload types (RFC 3551) cameras use
+// without an rtpmap line
+var rtpStaticPayloads = map[string]struct {
+	codec string
+	rate  int
+}{
+	"0": {"PCMU", 8000}, "8": {"PCMA", 8000}, "14": {"MPA", 90000},
+	"26": {"JPEG", 90000}, "32": {"MPV", 90000}, "33": {"MP2T", 90000},
+}
+
+// ParseSDP parses the media descriptions of an SDP body. Only the first payload type
+// of each m= line is described, which is the one cameras actually send.
+func ParseSDP(body string) SDPInfo {
+	var info SDPInfo
+	var cur *SDPTrack
+	var pt string                // Payload type of the current track
+	var fallbackW, fallbackH int // Resolution from attributes, used when no SPS decodes
+
+	finish := func() {
+		if cur != nil {
+			if cur.Width == 0 && fallbackW > 0 {
+				cur.Width, cur.Height = fallbackW, fallbackH
+			}
+			info.Tracks = append(info.Tracks, *cur)
+		}
+		fallbackW, fallbackH = 0, 0
+	}
+
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "m=") {
+			finish()
+			fields := strings.Fields(line[2:])
+			cur = &SDPTrack{}
+			pt = ""
+			if len(fields) > 0 {
+				cur.Media = strings.ToLower(fields[0])
+			}
+			if len(fields) > 3 {
+				pt = fields[3]
+				if s, ok := rtpStaticPayloads[pt]; ok {
+					cur.Codec, cur.ClockRate = s.codec, s.rate
+				}
+			}
+			continue
+		}
+		if cur == nil {
+			// v= is always 0; o=, c= and t= carry addresses, session ids and times
+			if len(line) > 2 && line[1] == '=' && !strings.ContainsRune("voct", rune(line[0])) {
+				if control, ok := strings.CutPrefix(line, "a=control:"); ok {
+					line = "a=control:" + controlPath(control)
+				}
+				info.Session = append(info.Session, line)
+			}
+			continue
+		}
+		if !strings.HasPrefix(line, "a=") {
+			continue
+		}
+		name, value, _ := strings.Cut(line[2:], ":")
+		switch strings.ToLower(name) {
+		case "control":
+			cur.Control = value
+		case "rtpmap":
+			if fpt, enc, ok := strings.Cut(value, " "); ok && fpt == pt {
+				parts := strings.Split(enc, "/")
+				cur.Codec = strings.ToUpper(parts[0])
+				if len(parts) > 1 {
+					cur.ClockRate = util.Atoi(parts[1])
+				}
+			}
+		case "fmtp":
+			if fpt, params, ok := strings.Cut(value, " "); ok && fpt == pt {
+				if w, h, ok := fmtpResolution(params); ok {
+					cur.Width, cur.Height = w, h
+				}
+			}
+		case "framesize": // a=framesize:96 1920-1080
+			if _, size, ok := strings.Cut(value, " "); ok {
+				fallbackW, fallbackH = parseDimensions(size, "-")
+			}
+		case "x-dimensions": // a=x-dimensions:1920,1080
+			fallbackW, fallbackH = parseDimensions(value, ",")
+		case "cliprect": // a=cliprect:0,0,1080,1920 (top, left, bottom, right)
+			if f := strings.Split(value, ","); len(f) == 4 && fallbackW == 0 {
+				fallbackW, fallbackH = util.Atoi(f[3])-util.Atoi(f[1]), util.Atoi(f[2])-util.Atoi(f[0])
+			}
+		}
+	}
+	finish()
+	return info
+}
+
+// parseDimensions splits "WxH" style sizes on sep
+func parseDimensions(s, sep string) (int, int) {
+	w, h, ok := strings.Cut(strings.TrimSpace(s), sep)
+	if !ok {
+		return 0, 0
+	}
+	return util.Atoi(strings.TrimSpace(w)), util.Atoi(strings.TrimSpace(h))
+}
+
+// fmtpResolution decodes the picture size from the SPS carried in H.264
+// sprop-parameter-sets (RFC 6184) or H.265 sprop-sps (RFC 7798)
+func fmtpResolution(params string) (int, int, bool) {
+	for _, p := range strings.Split(params, ";") {
+		key, value, _ := strings.Cut(strings.TrimSpace(p), "=")
+		var sps []byte
+		var parse func([]byte) (int, int, error)
+		switch strings.ToLower(key) {
+		case "sprop-parameter-sets":
+			first, _, _ := strings.Cut(value, ",")
+			sps, parse = decodeSprop(first), parseH264SPS
+		case "sprop-sps":
+			sps, parse = decodeSprop(value), parseH265SPS
+		default:
+			continue
+		}
+		if len(sps) == 0 {
+			continue
+		}
+		if w, h, err := parse(sps); err == nil && w > 0 && h > 0 {
+			return w, h, true
+		}
+	}
+	return 0, 0, false
+}
+
+// decodeSprop decodes a base64 parameter set; some encoders drop the padding
+func decodeSprop(s string) []byte {
+	s = strings.TrimSpace(s)
+	if b, err := base64.StdEncoding.DecodeString(s); err == nil {
+		return b
+	}
+	b, _ := base64.RawStdEncoding.DecodeString(strings.TrimRight(s, "="))
+	return b
+}
+
+// parseH264SPS returns the cropped picture size of an H.264 sequence parameter set
+// NAL unit (ITU-T H.264 7.3.2.1.1)
+func parseH264SPS(nal []byte) (int, int, error) {
+	if len(nal) < 4 || nal[0]&0x1F != 7 {
+		return 0, 0, errors.New("not an H.264 SPS")
+	}
+	r := &bitReader{data: unescapeRBSP(nal[1:])}
+	profile := r.u(8)
+	r.u(16) // constraint flags, level_idc
+	r.ue()  // seq_parameter_set_id
+
+	chroma := uint(1) // 4:2:0 unless signalled
+	switch profile {
+	case 100, 110, 122, 244, 44, 83, 86, 118, 128, 138, 139, 134, 135:
+		if chroma = r.ue(); chroma == 3 {
+			r.u(1) // separate_colour_plane_flag
+		}
+		r.ue()           // bit_depth_luma_minus8
+		r.ue()           // bit_depth_chroma_minus8
+		r.u(1)           // qpprime_y_zero_transform_bypass_flag
+		if r.u(1) == 1 { // seq_scaling_matrix_present_flag
+			lists := 8
+			if chroma == 3 {
+				lists = 12
+			}
+			for i := 0; i < lists; i++ {
+				if r.u(1) == 1 {
+					size := 16
+					if i >= 6 {
+						size = 64
+					}
+					skipScalingList(r, size)
+				}
+			}
+		}
+	}
+
+	r.ue()          // log2_max_frame_num_minus4
+	switch r.ue() { // pic_order_cnt_type
+	case 0:
+		r.ue() // log2_max_pic_order_cnt_lsb_minus4
+	case 1:
+		r.u(1) // delta_pic_order_always_zero_flag
+		r.se() // offset_for_non_ref_pic
+		r.se() // offset_for_top_to_bottom_field
+		n := r.ue()
+		for i := uint(0); i < n && r.err == nil; i++ {
+			r.se()
+		}
+	}
+	r.ue() // max_num_ref_frames
+	r.u(1) // gaps_in_frame_num_value_allowed_flag
+	widthMBs := r.ue() + 1
+	heightMapUnits := r.ue() + 1
+	frameMBsOnly := r.u(1)
+	if frameMBsOnly == 0 {
+		r.u(1) // mb_adaptive_frame_field_flag
+	}
+	r.u(1) // direct_8x8_inference_flag
+
+	width := int(widthMBs) * 16
+	height := int(2-frameMBsOnly) * int(heightMapUnits) * 16
+	if r.u(1) == 1 { // frame_cropping_flag
+		left, right, top, bottom := r.ue(), r.ue(), r.ue(), r.ue()
+		cropX, cropY := 1, int(2-frameMBsOnly)
+		switch chroma {
+		case 1: // 4:2:0
+			cropX, cropY = 2, 2*cropY
+		case 2: // 4:2:2
+			cropX = 2
+		}
+		width -= int(left+right) * cropX
+		height -= int(top+bottom) * cropY
+	}
+	if r.err != nil {
+		return 0, 0, r.err
+	}
+	return width, height, nil
+}
+
+// parseH265SPS returns the conformance window size of an H.265 sequence parameter
+// set NAL unit (ITU-T H.265 7.3.2.2)
+func parseH265SPS(nal []byte) (int, int, error) {
+	if len(nal) < 4 || (nal[0]>>1)&0x3F != 33 {
+		return 0, 0, errors.New("not an H.265 SPS")
+	}
+	r := &bitReader{data: unescapeRBSP(nal[2:])}
+	r.u(4) // sps_video_parameter_set_id
+	subLayers := int(r.u(3))
+	r.u(1) // sps_temporal_id_nesting_flag
+
+	// profile_tier_level: general profile (88 bits) and level (8 bits)
+	r.skip(96)
+	profilePresent := make([]uint, subLayers)
+	levelPresent := make([]uint, subLayers)
+	for i := 0; i < subLayers; i++ {
+		profilePresent[i], levelPresent[i] = r.u(1), r.u(1)
+	}
+	if subLayers > 0 {
+		r.skip(2 * (8 - subLayers)) // reserved_zero_2bits
+	}
+	for i := 0; i < subLayers; i++ {
+		if profilePresent[i] == 1 {
+			r.skip(88)
+		}
+		if levelPresent[i] == 1 {
+			r.skip(8)
+		}
+	}
+
+	r.ue() // sps_seq_parameter_set_id
+	chroma := r.ue()
+	if chroma == 3 {
+		r.u(1) // separate_colour_plane_flag
+	}
+	width := int(r.ue())
+	height := int(r.ue())
+	if r.u(1) == 1 { // conformance_window_flag
+		left, right, top, bottom := r.ue(), r.ue(), r.ue(), r.ue()
+		cropX, cropY := 1, 1
+		switch chroma {
+		case 1:
+			cropX, cropY = 2, 2
+		case 2:
+			cropX = 2
+		}
+		width -= int(left+right) * cropX
+		height -= int(top+bottom) * cropY
+	}
+	if r.err != nil {
+		return 0, 0, r.err
+	}
+	return width, height, nil
+}
+
+// skipScalingList reads past a scaling_list() of size entries
+func skipScalingList(r *bitReader, size int) {
+	last, next := 8, 8
+	for j := 0; j < size && r.err == nil; j++ {
+		if next != 0 {
+			next = (last + r.se() + 256) % 256
+		}
+		if next != 0 {
+			last = next
+		}
+	}
+}
+
+// unescapeRBSP removes emulation prevention bytes (00 00 03 -> 00 00)
+func unescapeRBSP(b []byte) []byte {
+	out := make([]byte, 0, len(b))
+	zeros := 0
+	for _, c := range b {
+		if zeros >= 2 && c == 3 {
+			zeros = 0
+			continue
+		}
+		if c == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+var errBitsExhausted = errors.New("parameter set truncated")
+
+// bitReader reads the MSB-first bit fields and Exp-Golomb codes of NAL units. A
+// read past the end sets err and returns zeros.
+type bitReader struct {
+	data []byte
+	pos  int // In bits
+	err  error
+}
+
+func (r *bitReader) u(n int) uint {
+	var v uint
+	for i := 0; i < n; i++ {
+		if r.pos >= len(r.data)*8 {
+			r.err = errBitsExhausted
+			return 0
+		}
+		bit := (r.data[r.pos/8] >> (7 - r.pos%8)) & 1
+		v = v<<1 | uint(bit)
+		r.pos++
+	}
+	return v
+}
+
+func (r *bitReader) skip(n int) {
+	if r.pos += n; r.pos > len(r.data)*8 {
+		r.err = errBitsExhausted
+	}
+}
+
+// ue reads an unsigned Exp-Golomb code
+func (r *bitReader) ue() uint {
+	zeros := 0
+	for r.u(1) == 0 {
+		if r.err != nil || zeros > 31 {
+			r.err = errBitsExhausted
+			return 0
+		}
+		zeros++
+	}
+	return 1<<zeros - 1 + r.u(zeros)
+}
+
+// se reads a signed Exp-Golomb code
+func (r *bitReader) se() int {
+	k := r.ue()
+	if k%2 == 1 {
+		return int(k+1) / 2
+	}
+	return -int(k / 2)
+}
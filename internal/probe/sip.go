@@ -0,0 +1,259 @@
+package probe
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/textproto"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/postfix/cctvscan/internal/util"
+)
+
+// SIPPorts are the SIP ports GB28181 devices and platforms listen on; 5061 is SIP
+// over TLS
+var SIPPorts = []int{5060, 5061}
+
+// sipPort is probed over UDP when no SIP port showed up in the TCP scan, since
+// GB28181 signalling is UDP by default
+const sipPort = 5060
+
+// sipClientID is the GB28181 code we present: centre 34020000 (the spec's example
+// domain), industry 00, type 200 (SIP server), serial 0000001
+const sipClientID = "34020000002000000001"
+
+// SIPInfo is what a SIP endpoint reveals to OPTIONS and REGISTER
+type SIPInfo struct {
+	Transport string // udp, tcp or tls
+	Port      int
+	Status    string // Status line of the first answer, e.g. "SIP/2.0 200 OK"
+	Server    string // Server or User-Agent header
+	Allow     string
+	Realm     string   // Digest realm of a REGISTER challenge; GB28181 uses the 10 digit domain
+	DeviceIDs []string // 20 digit GB28181 codes the endpoint used for itself
+	GB28181   bool
+}
+
+// Found reports whether a SIP endpoint answered
+func (s SIPInfo) Found() bool { return s.Status != "" }
+
+// gbDeviceIDRe matches a GB/T 28181 device code: 8 digit centre, 2 digit industry,
+// 3 digit type, 1 digit network and 6 digit serial
+var gbDeviceIDRe = regexp.MustCompile(`\b\d{20}\b`)
+
+// gbDeviceTypes names the type digits (positions 11-13) of a GB28181 device code
+var gbDeviceTypes = map[string]string{
+	"111": "DVR", "112": "video server", "113": "encoder", "114": "decoder", "118": "NVR",
+	"131": "camera", "132": "IP camera", "200": "SIP server", "215": "business group", "216": "virtual organization",
+}
+
+// GB28181DeviceType names the device type encoded in a 20 digit GB28181 code
+func GB28181DeviceType(id string) string {
+	if len(id) != 20 {
+		return ""
+	}
+	return gbDeviceTypes[id[10:13]]
+}
+
+// FilterSIP returns the SIP ports among ports
+func FilterSIP(ports []int) []int {
+	var out []int
+	for _, p := range ports {
+		if util.PortIn(SIPPorts, p) {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// ProbeSIP sends OPTIONS to the SIP ports of host, or to UDP 5060 when none was found
+// open over TCP, and follows up with a REGISTER (Expires: 0, so no binding is made)
+// when OPTIONS didn't reveal a GB28181 identity.
+func ProbeSIP(ctx context.Context, host string, ports []int) SIPInfo {
+	type target struct {
+		transport string
+		port      int
+	}
+	var targets []target
+	for _, p := range ports {
+		if p == 5061 {
+			targets = append(targets, target{"tls", p})
+		} else {
+			targets = append(targets, target{"tcp", p})
+		}
+	}
+	if len(targets) == 0 {
+		targets = append(targets, target{"udp", sipPort})
+	}
+
+	for _, t := range targets {
+		if ctx.Err() != nil {
+			break // host budget spent
+		}
+		resp, err := sipExchange(ctx, t.transport, host, t.port, "OPTIONS")
+		if err != nil {
+			continue
+		}
+		info := ParseSIPResponse(resp)
+		if !info.Found() {
+			continue
+		}
+		info.Transport, info.Port = t.transport, t.port
+		if !info.GB28181 {
+			if resp, err := sipExchange(ctx, t.transport, host, t.port, "REGISTER"); err == nil {
+				info.merge(ParseSIPResponse(resp))
+			}
+		}
+		return info
+	}
+	return SIPInfo{}
+}
+
+// merge adds what a second answer revealed
+func (s *SIPInfo) merge(o SIPInfo) {
+	if s.Server == "" {
+		s.Server = o.Server
+	}
+	if s.Realm == "" {
+		s.Realm = o.Realm
+	}
+	for _, id := range o.DeviceIDs {
+		if !slices.Contains(s.DeviceIDs, id) {
+			s.DeviceIDs = append(s.DeviceIDs, id)
+		}
+	}
+	s.GB28181 = s.GB28181 || o.GB28181
+}
+
+// sipExchange sends one request and returns the raw answer
+func sipExchange(ctx context.Context, transport, host string, port int, method string) ([]byte, error) {
+	addr := net.JoinHostPort(host, util.Itoa(port))
+	t := ConfigFrom(ctx).SIP
+	var conn net.Conn
+	var err error
+	switch transport {
+	case "tls":
+		conn, err = t.DialTLS(ctx, addr)
+	default:
+		conn, err = t.DialContext(ctx, transport, addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(t.Deadline())
+
+	if _, err := conn.Write(sipRequest(method, transport, host, port, conn.LocalAddr().String())); err != nil {
+		return nil, err
+	}
+	if transport == "udp" {
+		buf := make([]byte, 8192)
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	}
+
+	// Stream transports: read up to the end of the headers, which is all we parse
+	br := bufio.NewReader(conn)
+	var msg bytes.Buffer
+	for msg.Len() < 8192 {
+		line, err := br.ReadString('\n')
+		msg.WriteString(line)
+		if err != nil || line == "\r\n" || line == "\n" {
+			break
+		}
+	}
+	if msg.Len() == 0 {
+		return nil, fmt.Errorf("no SIP answer from %s", addr)
+	}
+	return msg.Bytes(), nil
+}
+
+// sipRequest builds an OPTIONS or REGISTER request from our GB28181 identity
+func sipRequest(method, transport, host string, port int, local string) []byte {
+	tag := make([]byte, 8)
+	rand.Read(tag)
+	id := hex.EncodeToString(tag)
+	target := net.JoinHostPort(host, util.Itoa(port))
+	domain := sipClientID[:10]
+
+	var b strings.Builder
+	if method == "REGISTER" {
+		fmt.Fprintf(&b, "REGISTER sip:%s@%s SIP/2.0\r\n", sipClientID, target)
+	} else {
+		fmt.Fprintf(&b, "%s sip:%s SIP/2.0\r\n", method, target)
+	}
+	fmt.Fprintf(&b, "Via: SIP/2.0/%s %s;rport;branch=z9hG4bK%s\r\n", strings.ToUpper(transport), local, id)
+	b.WriteString("Max-Forwards: 70\r\n")
+	fmt.Fprintf(&b, "From: <sip:%s@%s>;tag=%s\r\n", sipClientID, domain, id[:8])
+	if method == "REGISTER" {
+		fmt.Fprintf(&b, "To: <sip:%s@%s>\r\n", sipClientID, domain)
+		b.WriteString("Expires: 0\r\n")
+	} else {
+		fmt.Fprintf(&b, "To: <sip:%s>\r\n", target)
+		b.WriteString("Accept: application/sdp\r\n")
+	}
+	fmt.Fprintf(&b, "Call-ID: %s@%s\r\n", id, domain)
+	fmt.Fprintf(&b, "CSeq: 1 %s\r\n", method)
+	fmt.Fprintf(&b, "Contact: <sip:%s@%s>\r\n", sipClientID, local)
+	b.WriteString("User-Agent: CCTVTool/1.0\r\nContent-Length: 0\r\n\r\n")
+	return []byte(b.String())
+}
+
+// sipCompactHeaders expands the single letter header forms (RFC 3261 7.3.3)
+var sipCompactHeaders = map[string]string{
+	"F": "From", "T": "To", "M": "Contact", "V": "Via", "I": "Call-Id", "C": "Content-Type", "L": "Content-Length",
+}
+
+// ParseSIPResponse parses the status line and headers of a SIP answer and looks for a
+// GB28181 identity: a 20 digit device code or a 10 digit realm. Our own code, echoed
+// back in From, is ignored.
+func ParseSIPResponse(data []byte) SIPInfo {
+	var info SIPInfo
+	head, _, _ := bytes.Cut(data, []byte("\r\n\r\n"))
+	tp := textproto.NewReader(bufio.NewReader(bytes.NewReader(append(bytes.Clone(head), "\r\n\r\n"...))))
+	status, err := tp.ReadLine()
+	if err != nil || !strings.HasPrefix(status, "SIP/2.0 ") {
+		return info
+	}
+	info.Status = strings.TrimSpace(status)
+	header, _ := tp.ReadMIMEHeader()
+	for short, long := range sipCompactHeaders {
+		if v, ok := header[short]; ok {
+			header[long] = append(header[long], v...)
+		}
+	}
+
+	info.Server = header.Get("Server")
+	if info.Server == "" {
+		info.Server = header.Get("User-Agent")
+	}
+	info.Allow = header.Get("Allow")
+	if c, ok := PreferredChallenge(ParseAuthChallenges(header.Values("Www-Authenticate"))); ok {
+		info.Realm = c.Realm
+	}
+
+	for _, name := range []string{"To", "Contact", "Www-Authenticate", "Subject"} {
+		for _, v := range header.Values(name) {
+			for _, id := range gbDeviceIDRe.FindAllString(v, -1) {
+				if id != sipClientID && !slices.Contains(info.DeviceIDs, id) {
+					info.DeviceIDs = append(info.DeviceIDs, id)
+				}
+			}
+		}
+	}
+
+	server := strings.ToUpper(info.Server)
+	info.GB28181 = len(info.DeviceIDs) > 0 ||
+		(len(info.Realm) == 10 && strings.Trim(info.Realm, "0123456789") == "") ||
+		strings.Contains(server, "GB28181") || strings.Contains(server, "GB/T28181") || strings.Contains(server, "GB/T 28181")
+	return info
+}
@@ -0,0 +1,168 @@
+package probe
+
+import (
+	"context"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+
+	"github.com/postfix/cctvscan/internal/util"
+)
+
+// snmpPort is the SNMP agent port
+const snmpPort = 161
+
+// MIB-II system group objects
+var (
+	oidSysDescr    = asn1.ObjectIdentifier{1, 3, 6, 1, 2, 1, 1, 1, 0}
+	oidSysObjectID = asn1.ObjectIdentifier{1, 3, 6, 1, 2, 1, 1, 2, 0}
+	oidSysName     = asn1.ObjectIdentifier{1, 3, 6, 1, 2, 1, 1, 5, 0}
+)
+
+// SNMP PDU tags (context-specific, constructed)
+const (
+	snmpTagGetRequest  = 0xA0
+	snmpTagGetResponse = 0xA2
+)
+
+// SNMPInfo is the MIB-II system group of a device that answered SNMP
+type SNMPInfo struct {
+	Community   string
+	SysDescr    string // e.g. "Linux DS-7608NI-K2 3.0.8 #1 ..."
+	SysObjectID string // Dotted OID; the enterprise arc names the vendor
+	SysName     string
+}
+
+// Found reports whether the agent answered with any system information
+func (s SNMPInfo) Found() bool {
+	return s.SysDescr != "" || s.SysObjectID != "" || s.SysName != ""
+}
+
+// snmpMessage is an SNMPv1/v2c message with the PDU kept raw, since encoding/asn1
+// can't express its implicit context tag
+type snmpMessage struct {
+	Version   int
+	Community []byte
+	PDU       asn1.RawValue
+}
+
+type snmpPDU struct {
+	RequestID   int32
+	ErrorStatus int
+	ErrorIndex  int
+	VarBinds    []snmpVarBind
+}
+
+type snmpVarBind struct {
+	Name  asn1.ObjectIdentifier
+	Value asn1.RawValue
+}
+
+// ProbeSNMP sends an SNMPv2c GetRequest for sysDescr, sysObjectID and sysName with
+// the configured community and returns the answer. Agents with another community stay silent,
+// so a timeout is the usual "no" and is reported as an error.
+func ProbeSNMP(ctx context.Context, host string) (SNMPInfo, error) {
+	cfg := ConfigFrom(ctx)
+	if cfg.SNMPCommunity == "" {
+		return SNMPInfo{}, errors.New("SNMP probe disabled")
+	}
+	conn, err := cfg.SNMP.DialContext(ctx, "udp", net.JoinHostPort(host, util.Itoa(snmpPort)))
+	if err != nil {
+		return SNMPInfo{}, err
+	}
+	defer conn.Close()
+
+	requestID := rand.Int31()
+	req, err := snmpGetRequest(cfg.SNMPCommunity, requestID, oidSysDescr, oidSysObjectID, oidSysName)
+	if err != nil {
+		return SNMPInfo{}, err
+	}
+
+	buf := make([]byte, 4096)
+	// UDP is lossy; resend before giving up
+	for attempt := 0; attempt <= cfg.SNMP.Retries && ctx.Err() == nil; attempt++ {
+		if _, err := conn.Write(req); err != nil {
+			return SNMPInfo{}, err
+		}
+		deadline := cfg.SNMP.Deadline()
+		if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+			deadline = d
+		}
+		conn.SetReadDeadline(deadline)
+		n, err := conn.Read(buf)
+		if err != nil {
+			continue
+		}
+		info, err := parseSNMPResponse(buf[:n], requestID)
+		if err != nil {
+			return SNMPInfo{}, err
+		}
+		info.Community = cfg.SNMPCommunity
+		return info, nil
+	}
+	return SNMPInfo{}, fmt.Errorf("no SNMP answer from %s", host)
+}
+
+// snmpGetRequest encodes a v2c GetRequest for oids
+func snmpGetRequest(community string, requestID int32, oids ...asn1.ObjectIdentifier) ([]byte, error) {
+	pdu := snmpPDU{RequestID: requestID}
+	for _, oid := range oids {
+		pdu.VarBinds = append(pdu.VarBinds, snmpVarBind{Name: oid, Value: asn1.NullRawValue})
+	}
+	pduBytes, err := asn1.Marshal(pdu)
+	if err != nil {
+		return nil, err
+	}
+	pduBytes[0] = snmpTagGetRequest // SEQUENCE -> [0] GetRequest
+
+	return asn1.Marshal(snmpMessage{
+		Version:   1, // v2c
+		Community: []byte(community),
+		PDU:       asn1.RawValue{FullBytes: pduBytes},
+	})
+}
+
+// parseSNMPResponse decodes a GetResponse to the request with requestID
+func parseSNMPResponse(data []byte, requestID int32) (SNMPInfo, error) {
+	var msg snmpMessage
+	if _, err := asn1.Unmarshal(data, &msg); err != nil {
+		return SNMPInfo{}, fmt.Errorf("not an SNMP message: %w", err)
+	}
+	raw := msg.PDU.FullBytes
+	if len(raw) == 0 || raw[0] != snmpTagGetResponse {
+		return SNMPInfo{}, errors.New("not an SNMP GetResponse")
+	}
+	pduBytes := append([]byte{0x30}, raw[1:]...) // [2] GetResponse -> SEQUENCE
+	var pdu snmpPDU
+	if _, err := asn1.Unmarshal(pduBytes, &pdu); err != nil {
+		return SNMPInfo{}, fmt.Errorf("bad SNMP PDU: %w", err)
+	}
+	if pdu.RequestID != requestID {
+		return SNMPInfo{}, errors.New("SNMP response to another request")
+	}
+	if pdu.ErrorStatus != 0 {
+		return SNMPInfo{}, fmt.Errorf("SNMP error status %d", pdu.ErrorStatus)
+	}
+
+	var info SNMPInfo
+	for _, vb := range pdu.VarBinds {
+		// noSuchObject and friends come back as context-specific values
+		if vb.Value.Class != asn1.ClassUniversal {
+			continue
+		}
+		switch {
+		case vb.Name.Equal(oidSysDescr) && vb.Value.Tag == asn1.TagOctetString:
+			info.SysDescr = string(vb.Value.Bytes)
+		case vb.Name.Equal(oidSysName) && vb.Value.Tag == asn1.TagOctetString:
+			info.SysName = string(vb.Value.Bytes)
+		case vb.Name.Equal(oidSysObjectID) && vb.Value.Tag == asn1.TagOID:
+			var oid asn1.ObjectIdentifier
+			if _, err := asn1.Unmarshal(vb.Value.FullBytes, &oid); err == nil {
+				info.SysObjectID = oid.String()
+			}
+		}
+	}
+	return info, nil
+}
@@ -0,0 +1,305 @@
+package probe
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"strings"
+
+	"github.com/postfix/cctvscan/internal/util"
+)
+
+// SSHPorts are the ports checked for an SSH server
+var SSHPorts = []int{22}
+
+// SSHInfo is what an SSH server reveals before authentication
+type SSHInfo struct {
+	Port        int
+	Banner      string // Version string, e.g. SSH-2.0-dropbear_2012.55
+	HostKeyType string // e.g. ssh-rsa, ssh-ed25519
+	Fingerprint string // OpenSSH style SHA256:<base64> of the host key
+}
+
+// Found reports whether an SSH server answered
+func (s SSHInfo) Found() bool { return s.Banner != "" }
+
+// SSH transport message numbers (RFC 4253, 5656)
+const (
+	sshMsgKexInit   = 20
+	sshMsgKexDHInit = 30
+	sshMsgKexReply  = 31 // KEXDH_REPLY and KEX_ECDH_REPLY share the number
+)
+
+// Algorithms offered in our KEXINIT. Old dropbear builds only know the DH groups, so
+// they stay on the list; the cipher and MAC lists only have to overlap with the server.
+var (
+	sshKexAlgos = []string{
+		"curve25519-sha256", "curve25519-sha256@libssh.org", "ecdh-sha2-nistp256",
+		"diffie-hellman-group14-sha256", "diffie-hellman-group14-sha1", "diffie-hellman-group1-sha1",
+	}
+	sshHostKeyAlgos = []string{
+		"ssh-ed25519", "ecdsa-sha2-nistp256", "ecdsa-sha2-nistp384", "ecdsa-sha2-nistp521",
+		"rsa-sha2-512", "rsa-sha2-256", "ssh-rsa", "ssh-dss",
+	}
+	sshCiphers     = []string{"aes128-ctr", "aes256-ctr", "aes128-cbc", "aes256-cbc", "3des-cbc"}
+	sshMACs        = []string{"hmac-sha2-256", "hmac-sha1", "hmac-md5"}
+	sshCompression = []string{"none"}
+)
+
+// FilterSSH returns the SSH ports among ports
+func FilterSSH(ports []int) []int {
+	var out []int
+	for _, p := range ports {
+		if util.PortIn(SSHPorts, p) {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// ProbeSSH reads the version string and host key of the first SSH port that answers.
+// The key exchange is started only far enough for the server to send its host key;
+// no credentials are ever offered.
+func ProbeSSH(ctx context.Context, host string, ports []int) SSHInfo {
+	for _, p := range ports {
+		if ctx.Err() != nil {
+			break // host budget spent
+		}
+		// A banner without a host key is still worth reporting
+		if info, _ := grabSSH(ctx, net.JoinHostPort(host, util.Itoa(p))); info.Found() {
+			info.Port = p
+			return info
+		}
+	}
+	return SSHInfo{}
+}
+
+// grabSSH performs the version exchange and enough of the key exchange to learn the
+// host key. A banner without a host key is still returned alongside the error.
+func grabSSH(ctx context.Context, addr string) (SSHInfo, error) {
+	var info SSHInfo
+	t := ConfigFrom(ctx).SSH
+	conn, err := t.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return info, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(t.Deadline())
+
+	br := bufio.NewReader(conn)
+	if _, err := io.WriteString(conn, "SSH-2.0-OpenSSH_8.9\r\n"); err != nil {
+		return info, err
+	}
+	// Servers may print other lines before the version string (RFC 4253 4.2)
+	for i := 0; i < 16; i++ {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return info, err
+		}
+		if line = strings.TrimRight(line, "\r\n"); strings.HasPrefix(line, "SSH-") {
+			info.Banner = line
+			break
+		}
+	}
+	if info.Banner == "" {
+		return info, errors.New("no SSH version string")
+	}
+
+	clientInit := sshKexInitPayload()
+	if err := writeSSHPacket(conn, clientInit); err != nil {
+		return info, err
+	}
+	serverInit, err := readSSHPacket(br)
+	if err != nil {
+		return info, err
+	}
+	if len(serverInit) < 17 || serverInit[0] != sshMsgKexInit {
+		return info, errors.New("expected KEXINIT")
+	}
+	serverKex, err := sshNameList(serverInit[17:]) // byte type + 16 byte cookie
+	if err != nil {
+		return info, err
+	}
+	kex := sshNegotiate(sshKexAlgos, serverKex)
+	if kex == "" {
+		return info, fmt.Errorf("no common key exchange with %v", serverKex)
+	}
+
+	pub, err := sshKexPublic(kex)
+	if err != nil {
+		return info, err
+	}
+	if err := writeSSHPacket(conn, append([]byte{sshMsgKexDHInit}, pub...)); err != nil {
+		return info, err
+	}
+
+	for {
+		msg, err := readSSHPacket(br)
+		if err != nil {
+			return info, err
+		}
+		if len(msg) == 0 || msg[0] != sshMsgKexReply {
+			continue // e.g. SSH_MSG_IGNORE or DEBUG
+		}
+		hostKey, _, err := sshString(msg[1:])
+		if err != nil {
+			return info, err
+		}
+		keyType, _, err := sshString(hostKey)
+		if err != nil {
+			return info, err
+		}
+		sum := sha256.Sum256(hostKey)
+		info.HostKeyType = string(keyType)
+		info.Fingerprint = "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+		return info, nil
+	}
+}
+
+// sshKexPublic returns the encoded client public value (Q_C or e) for kex
+func sshKexPublic(kex string) ([]byte, error) {
+	switch {
+	case strings.HasPrefix(kex, "curve25519"):
+		key, err := ecdh.X25519().GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		return sshAppendString(nil, key.PublicKey().Bytes()), nil
+	case kex == "ecdh-sha2-nistp256":
+		key, err := ecdh.P256().GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		return sshAppendString(nil, key.PublicKey().Bytes()), nil
+	default:
+		p := sshGroup14
+		if kex == "diffie-hellman-group1-sha1" {
+			p = sshGroup1
+		}
+		x, err := rand.Int(rand.Reader, new(big.Int).Sub(p, big.NewInt(2)))
+		if err != nil {
+			return nil, err
+		}
+		e := new(big.Int).Exp(big.NewInt(2), x.Add(x, big.NewInt(1)), p)
+		return sshAppendMPInt(nil, e), nil
+	}
+}
+
+// sshKexInitPayload builds our SSH_MSG_KEXINIT
+func sshKexInitPayload() []byte {
+	b := []byte{sshMsgKexInit}
+	cookie := make([]byte, 16)
+	rand.Read(cookie)
+	b = append(b, cookie...)
+	for _, list := range [][]string{
+		sshKexAlgos, sshHostKeyAlgos,
+		sshCiphers, sshCiphers, sshMACs, sshMACs, sshCompression, sshCompression,
+		nil, nil, // languages
+	} {
+		b = sshAppendString(b, []byte(strings.Join(list, ",")))
+	}
+	return append(b, 0, 0, 0, 0, 0) // first_kex_packet_follows, reserved
+}
+
+// sshNegotiate picks the first client algorithm the server also supports
+func sshNegotiate(client, server []string) string {
+	for _, c := range client {
+		for _, s := range server {
+			if c == s {
+				return c
+			}
+		}
+	}
+	return ""
+}
+
+// writeSSHPacket frames payload as an unencrypted binary packet
+func writeSSHPacket(w io.Writer, payload []byte) error {
+	padding := 8 - (5+len(payload))%8
+	if padding < 4 {
+		padding += 8
+	}
+	packet := binary.BigEndian.AppendUint32(nil, uint32(1+len(payload)+padding))
+	packet = append(packet, byte(padding))
+	packet = append(packet, payload...)
+	packet = append(packet, make([]byte, padding)...)
+	_, err := w.Write(packet)
+	return err
+}
+
+// readSSHPacket reads one unencrypted binary packet and returns its payload
+func readSSHPacket(r io.Reader) ([]byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	length := binary.BigEndian.Uint32(header[:4])
+	padding := uint32(header[4])
+	if length < padding+1 || length > 256*1024 {
+		return nil, fmt.Errorf("bad SSH packet length %d", length)
+	}
+	body := make([]byte, length-1)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	return body[:len(body)-int(padding)], nil
+}
+
+// sshString reads a length-prefixed string and returns it with the remaining bytes
+func sshString(b []byte) ([]byte, []byte, error) {
+	if len(b) < 4 {
+		return nil, nil, errors.New("short SSH string")
+	}
+	n := binary.BigEndian.Uint32(b)
+	if uint32(len(b)-4) < n {
+		return nil, nil, errors.New("short SSH string")
+	}
+	return b[4 : 4+n], b[4+n:], nil
+}
+
+// sshNameList reads a comma separated name-list
+func sshNameList(b []byte) ([]string, error) {
+	s, _, err := sshString(b)
+	if err != nil {
+		return nil, err
+	}
+	return strings.Split(string(s), ","), nil
+}
+
+func sshAppendString(b, s []byte) []byte {
+	b = binary.BigEndian.AppendUint32(b, uint32(len(s)))
+	return append(b, s...)
+}
+
+// sshAppendMPInt appends a positive mpint
+func sshAppendMPInt(b []byte, n *big.Int) []byte {
+	bytes := n.Bytes()
+	if len(bytes) > 0 && bytes[0]&0x80 != 0 {
+		bytes = append([]byte{0}, bytes...)
+	}
+	return sshAppendString(b, bytes)
+}
+
+// Oakley groups 2 and 14 (RFC 2409, 3526) for the diffie-hellman-group* exchanges
+var (
+	sshGroup1, _ = new(big.Int).SetString(
+		"FFFFFFFFFFFFFFFFC90FDAA22168C234C4C6628B80DC1CD129024E088A67CC74020BBEA63B139B22514A08798E3404DD"+
+			"EF9519B3CD3A431B302B0A6DF25F14374FE1356D6D51C245E485B576625E7EC6F44C42E9A637ED6B0BFF5CB6F406B7ED"+
+			"EE386BFB5A899FA5AE9F24117C4B1FE649286651ECE65381FFFFFFFFFFFFFFFF", 16)
+	sshGroup14, _ = new(big.Int).SetString(
+		"FFFFFFFFFFFFFFFFC90FDAA22168C234C4C6628B80DC1CD129024E088A67CC74020BBEA63B139B22514A08798E3404DD"+
+			"EF9519B3CD3A431B302B0A6DF25F14374FE1356D6D51C245E485B576625E7EC6F44C42E9A637ED6B0BFF5CB6F406B7ED"+
+			"EE386BFB5A899FA5AE9F24117C4B1FE649286651ECE45B3DC2007CB8A163BF0598DA48361C55D39A69163FA8FD24CF5F"+
+			"83655D23DCA3AD961C62F356208552BB9ED529077096966D670C354E4ABC9804F1746C08CA18217C32905E462E36CE3B"+
+			"E39E772C180E86039B2783A2EC07A28FB5C55DF06F4C52C9DE2BCBF6955817183995497CEA956AE515D2261898FA0510"+
+			"15728E5A8AACAA68FFFFFFFFFFFFFFFF", 16)
+)
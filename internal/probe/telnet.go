@@ -0,0 +1,150 @@
+package probe
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"regexp"
+	"strings"
+
+	"github.com/postfix/cctvscan/internal/util"
+)
+
+// TelnetPorts are the usual telnet ports on DVRs and cameras
+var TelnetPorts = []int{23, 2323}
+
+// maxTelnetBanner bounds how much of the pre-login output is kept
+const maxTelnetBanner = 1024
+
+// Telnet protocol bytes (RFC 854)
+const (
+	telnetIAC  = 255
+	telnetDONT = 254
+	telnetDO   = 253
+	telnetWONT = 252
+	telnetWILL = 251
+	telnetSB   = 250
+	telnetSE   = 240
+)
+
+// FilterTelnet returns the telnet ports among ports
+func FilterTelnet(ports []int) []int {
+	var out []int
+	for _, p := range ports {
+		if util.PortIn(TelnetPorts, p) {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// ProbeTelnet reads the banner each telnet port prints before the login prompt.
+// Option negotiation is refused so the device falls back to plain text. Ports that
+// print nothing are omitted.
+func ProbeTelnet(ctx context.Context, host string, ports []int) map[int]string {
+	banners := make(map[int]string)
+	for _, p := range ports {
+		if ctx.Err() != nil {
+			break // host budget spent
+		}
+		if banner := grabTelnetBanner(ctx, net.JoinHostPort(host, util.Itoa(p))); banner != "" {
+			banners[p] = banner
+		}
+	}
+	return banners
+}
+
+// grabTelnetBanner connects to addr and collects text until a login or password
+// prompt, maxTelnetBanner bytes, or the read deadline
+func grabTelnetBanner(ctx context.Context, addr string) string {
+	t := ConfigFrom(ctx).Telnet
+	conn, err := t.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return ""
+	}
+	defer conn.Close()
+	conn.SetDeadline(t.Deadline())
+
+	br := bufio.NewReader(conn)
+	var text strings.Builder
+	for text.Len() < maxTelnetBanner {
+		b, err := br.ReadByte()
+		if err != nil {
+			break // EOF or deadline: keep what arrived
+		}
+		if b != telnetIAC {
+			text.WriteByte(b)
+			if isLoginPrompt(text.String()) {
+				break
+			}
+			continue
+		}
+
+		cmd, err := br.ReadByte()
+		if err != nil {
+			break
+		}
+		switch cmd {
+		case telnetIAC:
+			text.WriteByte(telnetIAC) // Escaped 0xFF
+		case telnetDO, telnetDONT, telnetWILL, telnetWONT:
+			opt, err := br.ReadByte()
+			if err != nil {
+				break
+			}
+			// Refuse everything so the device sends plain text
+			if cmd == telnetDO {
+				conn.Write([]byte{telnetIAC, telnetWONT, opt})
+			} else if cmd == telnetWILL {
+				conn.Write([]byte{telnetIAC, telnetDONT, opt})
+			}
+		case telnetSB:
+			skipTelnetSubnegotiation(br)
+		}
+	}
+	return cleanBanner(text.String())
+}
+
+// skipTelnetSubnegotiation discards bytes up to and including IAC SE
+func skipTelnetSubnegotiation(br *bufio.Reader) {
+	prev := byte(0)
+	for {
+		b, err := br.ReadByte()
+		if err != nil || (prev == telnetIAC && b == telnetSE) {
+			return
+		}
+		prev = b
+	}
+}
+
+// isLoginPrompt reports whether text ends with a login or password prompt
+func isLoginPrompt(text string) bool {
+	t := strings.ToLower(strings.TrimRight(text, " \t"))
+	for _, prompt := range []string{"login:", "username:", "user name:", "password:"} {
+		if strings.HasSuffix(t, prompt) {
+			return true
+		}
+	}
+	return false
+}
+
+// ansiEscapeRe matches terminal color and cursor sequences
+var ansiEscapeRe = regexp.MustCompile(`\x1b\[[0-9;?]*[A-Za-z]`)
+
+// cleanBanner drops terminal escapes, control characters and blank lines
+func cleanBanner(s string) string {
+	s = ansiEscapeRe.ReplaceAllString(s, "")
+	var lines []string
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.Map(func(r rune) rune {
+			if r == '\t' || (r >= 0x20 && r != 0x7f) {
+				return r
+			}
+			return -1
+		}, line)
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,104 @@
+package probe
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/postfix/cctvscan/internal/util"
+)
+
+// TLSCert is the leaf certificate an HTTPS port presented
+type TLSCert struct {
+	Port         int
+	Subject      string // e.g. CN=192.168.1.64,OU=IPC,O=Hikvision,C=CN
+	Issuer       string
+	SubjectCN    string
+	Organization []string // Subject O and OU
+	IssuerOrg    []string // Issuer O and OU
+	DNSNames     []string
+	SHA256       string // Hex digest of the DER certificate, lowercase without colons
+	NotAfter     time.Time
+	SelfSigned   bool
+}
+
+// VendorNames returns the certificate fields firmware fills with the vendor: the
+// subject and issuer organisation, and the common name of self-signed certificates.
+// The common name of a CA-signed certificate is a hostname the owner chose.
+func (c TLSCert) VendorNames() []string {
+	names := append(append([]string(nil), c.Organization...), c.IssuerOrg...)
+	if c.SelfSigned && c.SubjectCN != "" {
+		names = append(names, c.SubjectCN)
+	}
+	return names
+}
+
+// ProbeTLSCerts reads the certificate of every HTTP port that speaks TLS
+func ProbeTLSCerts(ctx context.Context, host string, ports []int) map[int]TLSCert {
+	var (
+		mu    sync.Mutex
+		wg    sync.WaitGroup
+		certs map[int]TLSCert
+	)
+	for _, port := range ports {
+		if DetectScheme(ctx, host, port) != "https" {
+			continue
+		}
+		wg.Add(1)
+		go func(port int) {
+			defer wg.Done()
+			cert, ok := fetchTLSCert(ctx, net.JoinHostPort(host, util.Itoa(port)))
+			if !ok {
+				return
+			}
+			cert.Port = port
+			mu.Lock()
+			if certs == nil {
+				certs = make(map[int]TLSCert)
+			}
+			certs[port] = cert
+			mu.Unlock()
+		}(port)
+	}
+	wg.Wait()
+	return certs
+}
+
+// fetchTLSCert completes a handshake with addr and describes the leaf certificate
+func fetchTLSCert(ctx context.Context, addr string) (TLSCert, bool) {
+	conn, err := ConfigFrom(ctx).HTTP.DialTLS(ctx, addr)
+	if err != nil {
+		return TLSCert{}, false
+	}
+	defer conn.Close()
+	tlsConn, ok := conn.(*tls.Conn)
+	if !ok {
+		return TLSCert{}, false
+	}
+	peers := tlsConn.ConnectionState().PeerCertificates
+	if len(peers) == 0 {
+		return TLSCert{}, false
+	}
+	return describeCert(peers[0]), true
+}
+
+// describeCert extracts the fields of c used for fingerprinting and reporting
+func describeCert(c *x509.Certificate) TLSCert {
+	sum := sha256.Sum256(c.Raw)
+	return TLSCert{
+		Subject:      c.Subject.String(),
+		Issuer:       c.Issuer.String(),
+		SubjectCN:    c.Subject.CommonName,
+		Organization: append(append([]string(nil), c.Subject.Organization...), c.Subject.OrganizationalUnit...),
+		IssuerOrg:    append(append([]string(nil), c.Issuer.Organization...), c.Issuer.OrganizationalUnit...),
+		DNSNames:     c.DNSNames,
+		SHA256:       hex.EncodeToString(sum[:]),
+		NotAfter:     c.NotAfter,
+		SelfSigned:   c.Subject.String() == c.Issuer.String() && c.CheckSignatureFrom(c) == nil,
+	}
+}
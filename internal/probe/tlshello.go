@@ -0,0 +1,295 @@
+package probe
+
+import (
+	"context"
+	"crypto/ecdh"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/postfix/cctvscan/internal/util"
+)
+
+// ServerHello is how an HTTPS port answered the fixed ClientHello of
+// helloClient. Embedded TLS stacks (mbed TLS, wolfSSL, vendor OpenSSL builds)
+// pick ciphers and order extensions in their own way, which fingerprints the
+// firmware even when the web UI shows nothing but a login form.
+type ServerHello struct {
+	Port       int
+	Version    uint16   // Negotiated version, from supported_versions when present
+	Cipher     uint16   // Chosen cipher suite
+	Extensions []uint16 // Extension types in the order sent
+	ALPN       string   // Chosen application protocol
+	JA3S       string   // MD5 of JA3SRaw
+	JA3SRaw    string   // e.g. 771,49199,65281-0-11-35-16
+	JA4S       string   // e.g. t120400_c02f_4e8089b08790
+}
+
+// ProbeServerHellos fingerprints the ServerHello of every HTTP port that speaks TLS
+func ProbeServerHellos(ctx context.Context, host string, ports []int) map[int]ServerHello {
+	var (
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		hellos map[int]ServerHello
+	)
+	for _, port := range ports {
+		if DetectScheme(ctx, host, port) != "https" {
+			continue
+		}
+		wg.Add(1)
+		go func(port int) {
+			defer wg.Done()
+			hello, err := fetchServerHello(ctx, host, port)
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			if hellos == nil {
+				hellos = make(map[int]ServerHello)
+			}
+			hellos[port] = hello
+			mu.Unlock()
+		}(port)
+	}
+	wg.Wait()
+	return hellos
+}
+
+// fetchServerHello sends the ClientHello of helloClient to host:port and parses
+// the ServerHello; the handshake goes no further
+func fetchServerHello(ctx context.Context, host string, port int) (ServerHello, error) {
+	t := ConfigFrom(ctx).HTTP
+	conn, err := t.DialContext(ctx, "tcp", net.JoinHostPort(host, util.Itoa(port)))
+	if err != nil {
+		return ServerHello{}, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(t.Deadline())
+
+	hello, err := helloClient(host)
+	if err != nil {
+		return ServerHello{}, err
+	}
+	if _, err := conn.Write(hello); err != nil {
+		return ServerHello{}, err
+	}
+	msg, err := readHandshake(conn)
+	if err != nil {
+		return ServerHello{}, err
+	}
+	sh, err := parseServerHello(msg)
+	if err != nil {
+		return ServerHello{}, err
+	}
+	sh.Port = port
+	return sh, nil
+}
+
+// TLS extension types the ClientHello sends or the fingerprints read
+const (
+	extServerName        = 0x0000
+	extSupportedGroups   = 0x000a
+	extECPointFormats    = 0x000b
+	extSignatureAlgs     = 0x000d
+	extALPN              = 0x0010
+	extExtendedMaster    = 0x0017
+	extSessionTicket     = 0x0023
+	extSupportedVersions = 0x002b
+	extPSKModes          = 0x002d
+	extKeyShare          = 0x0033
+	extRenegotiation     = 0xff01
+)
+
+// helloCiphers run from TLS 1.3 down to the RC4 and 3DES suites old firmware
+// still insists on, so every stack finds something to pick
+var helloCiphers = []uint16{
+	0x1301, 0x1302, 0x1303, // TLS 1.3
+	0xc02b, 0xc02f, 0xc02c, 0xc030, 0xcca9, 0xcca8, // ECDHE AEAD
+	0xc009, 0xc013, 0xc00a, 0xc014, // ECDHE CBC
+	0x009c, 0x009d, 0x002f, 0x0035, // RSA
+	0x000a, 0x0005, // 3DES, RC4
+}
+
+// helloClient builds the ClientHello record sent to every server. It stays the
+// same between runs, apart from the random values, because JA3S and JA4S
+// describe the answer to a given ClientHello.
+func helloClient(host string) ([]byte, error) {
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	var exts []byte
+	addExt := func(typ uint16, data []byte) {
+		exts = binary.BigEndian.AppendUint16(exts, typ)
+		exts = binary.BigEndian.AppendUint16(exts, uint16(len(data)))
+		exts = append(exts, data...)
+	}
+	if net.ParseIP(host) == nil {
+		name := binary.BigEndian.AppendUint16([]byte{0}, uint16(len(host)))
+		addExt(extServerName, prefix16(append(name, host...)))
+	}
+	addExt(extSupportedGroups, prefix16(uint16s(0x001d, 0x0017, 0x0018, 0x0019)))
+	addExt(extECPointFormats, []byte{1, 0})
+	addExt(extSignatureAlgs, prefix16(uint16s(0x0403, 0x0503, 0x0603, 0x0804, 0x0805, 0x0806, 0x0401, 0x0501, 0x0601, 0x0203, 0x0201)))
+	addExt(extALPN, prefix16(append([]byte{8}, "http/1.1"...)))
+	addExt(extExtendedMaster, nil)
+	addExt(extSessionTicket, nil)
+	addExt(extRenegotiation, []byte{0})
+	addExt(extSupportedVersions, append([]byte{8}, uint16s(0x0304, 0x0303, 0x0302, 0x0301)...))
+	addExt(extPSKModes, []byte{1, 1})
+	share := append(uint16s(0x001d, 32), key.PublicKey().Bytes()...)
+	addExt(extKeyShare, prefix16(share))
+
+	random := make([]byte, 64) // Random and session ID
+	if _, err := rand.Read(random); err != nil {
+		return nil, err
+	}
+	body := []byte{0x03, 0x03}
+	body = append(body, random[:32]...)
+	body = append(body, 32)
+	body = append(body, random[32:]...)
+	body = append(body, prefix16(uint16s(helloCiphers...))...)
+	body = append(body, 1, 0) // Null compression only
+	body = append(body, prefix16(exts)...)
+
+	msg := append([]byte{1, byte(len(body) >> 16), byte(len(body) >> 8), byte(len(body))}, body...)
+	record := []byte{tlsRecordHandshake, 0x03, 0x01}
+	return append(binary.BigEndian.AppendUint16(record, uint16(len(msg))), msg...), nil
+}
+
+func uint16s(values ...uint16) []byte {
+	b := make([]byte, 0, 2*len(values))
+	for _, v := range values {
+		b = binary.BigEndian.AppendUint16(b, v)
+	}
+	return b
+}
+
+func prefix16(b []byte) []byte {
+	return append(binary.BigEndian.AppendUint16(nil, uint16(len(b))), b...)
+}
+
+// errNotServerHello is returned when the server answers with anything but a ServerHello
+var errNotServerHello = errors.New("no ServerHello")
+
+// readHandshake reads TLS records until the first handshake message is complete
+// and returns it, type and length included
+func readHandshake(r io.Reader) ([]byte, error) {
+	var msg []byte
+	header := make([]byte, 5)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			return nil, err
+		}
+		length := int(binary.BigEndian.Uint16(header[3:]))
+		fragment := make([]byte, length)
+		if _, err := io.ReadFull(r, fragment); err != nil {
+			return nil, err
+		}
+		switch header[0] {
+		case tlsRecordHandshake:
+		case tlsRecordAlert:
+			if length >= 2 {
+				return nil, fmt.Errorf("TLS alert %d", fragment[1])
+			}
+			return nil, errNotServerHello
+		default:
+			return nil, errNotServerHello
+		}
+		msg = append(msg, fragment...)
+		if len(msg) >= 4 {
+			if size := 4 + (int(msg[1])<<16 | int(msg[2])<<8 | int(msg[3])); len(msg) >= size {
+				return msg[:size], nil
+			}
+			if len(msg) > 1<<16 {
+				return nil, errNotServerHello
+			}
+		}
+	}
+}
+
+// parseServerHello decodes a ServerHello handshake message and computes its
+// fingerprints
+func parseServerHello(msg []byte) (ServerHello, error) {
+	if len(msg) < 4 || msg[0] != 2 {
+		return ServerHello{}, errNotServerHello
+	}
+	b := msg[4:]
+	// Version, random and session ID length
+	if len(b) < 35 || len(b) < 35+int(b[34])+3 {
+		return ServerHello{}, errNotServerHello
+	}
+	legacy := binary.BigEndian.Uint16(b)
+	b = b[35+int(b[34]):]
+	sh := ServerHello{Version: legacy, Cipher: binary.BigEndian.Uint16(b)}
+	b = b[3:] // Cipher and compression method
+
+	if len(b) >= 2 {
+		exts := b[2:]
+		if n := int(binary.BigEndian.Uint16(b)); n < len(exts) {
+			exts = exts[:n]
+		}
+		for len(exts) >= 4 {
+			typ, n := binary.BigEndian.Uint16(exts), int(binary.BigEndian.Uint16(exts[2:]))
+			if len(exts) < 4+n {
+				return ServerHello{}, errNotServerHello
+			}
+			data := exts[4 : 4+n]
+			sh.Extensions = append(sh.Extensions, typ)
+			switch {
+			case typ == extSupportedVersions && n == 2:
+				sh.Version = binary.BigEndian.Uint16(data)
+			case typ == extALPN && n >= 3 && int(data[2]) <= n-3:
+				sh.ALPN = string(data[3 : 3+int(data[2])])
+			}
+			exts = exts[4+n:]
+		}
+	}
+
+	exts := make([]string, len(sh.Extensions))
+	hexExts := make([]string, len(sh.Extensions))
+	for i, e := range sh.Extensions {
+		exts[i] = util.Itoa(int(e))
+		hexExts[i] = fmt.Sprintf("%04x", e)
+	}
+	sh.JA3SRaw = fmt.Sprintf("%d,%d,%s", legacy, sh.Cipher, strings.Join(exts, "-"))
+	sum := md5.Sum([]byte(sh.JA3SRaw))
+	sh.JA3S = hex.EncodeToString(sum[:])
+
+	alpn := "00"
+	if sh.ALPN != "" {
+		alpn = sh.ALPN[:1] + sh.ALPN[len(sh.ALPN)-1:]
+	}
+	extHash := "000000000000"
+	if len(hexExts) > 0 {
+		sum := sha256.Sum256([]byte(strings.Join(hexExts, ",")))
+		extHash = hex.EncodeToString(sum[:])[:12]
+	}
+	sh.JA4S = fmt.Sprintf("t%s%02d%s_%04x_%s", ja4Version(sh.Version), min(len(sh.Extensions), 99), alpn, sh.Cipher, extHash)
+	return sh, nil
+}
+
+// ja4Version is the two character version of JA4 fingerprints
+func ja4Version(v uint16) string {
+	switch v {
+	case 0x0304:
+		return "13"
+	case 0x0303:
+		return "12"
+	case 0x0302:
+		return "11"
+	case 0x0301:
+		return "10"
+	case 0x0300:
+		return "s3"
+	}
+	return "00"
+}
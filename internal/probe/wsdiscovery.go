@@ -0,0 +1,133 @@
+package probe
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/xml"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// wsDiscoveryGroup is the WS-Discovery IPv4 multicast group and port
+const wsDiscoveryGroup = "239.255.255.250:3702"
+
+// WSDiscoveryMatch is one device that answered a WS-Discovery Probe
+type WSDiscoveryMatch struct {
+	Address  string   // Source IP of the ProbeMatch
+	Endpoint string   // Endpoint reference, usually urn:uuid:...
+	Types    []string // e.g. dn:NetworkVideoTransmitter
+	Scopes   []string // onvif://www.onvif.org/hardware/..., name/..., location/...
+	XAddrs   []string // Device service URLs
+}
+
+// probeMatchEnvelope matches ProbeMatches regardless of namespace prefixes
+type probeMatchEnvelope struct {
+	Body struct {
+		ProbeMatches struct {
+			Matches []struct {
+				Endpoint string `xml:"EndpointReference>Address"`
+				Types    string `xml:"Types"`
+				Scopes   string `xml:"Scopes"`
+				XAddrs   string `xml:"XAddrs"`
+			} `xml:"ProbeMatch"`
+		} `xml:"ProbeMatches"`
+	} `xml:"Body"`
+}
+
+// DiscoverONVIF multicasts a WS-Discovery Probe for video transmitters on the local
+// network and collects ProbeMatches until wait elapses or ctx is done. It finds ONVIF
+// cameras that aren't in the target list at all. One match is returned per device address.
+func DiscoverONVIF(ctx context.Context, wait time.Duration) ([]WSDiscoveryMatch, error) {
+	group, err := net.ResolveUDPAddr("udp4", wsDiscoveryGroup)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenPacket("udp4", ":0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open UDP socket: %w", err)
+	}
+	defer conn.Close()
+
+	// UDP is lossy and WS-Discovery recommends repeating the Probe
+	msg := []byte(wsDiscoveryProbe(newMessageID()))
+	for i := 0; i < 2; i++ {
+		if _, err := conn.WriteTo(msg, group); err != nil {
+			return nil, fmt.Errorf("failed to send WS-Discovery probe: %w", err)
+		}
+	}
+
+	deadline := time.Now().Add(wait)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetReadDeadline(deadline)
+
+	var matches []WSDiscoveryMatch
+	seen := make(map[string]bool)
+	buf := make([]byte, 64*1024)
+	for ctx.Err() == nil {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			break // Read deadline reached
+		}
+		udpAddr, ok := addr.(*net.UDPAddr)
+		if !ok || seen[udpAddr.IP.String()] {
+			continue
+		}
+		found := ParseProbeMatches(buf[:n])
+		if len(found) == 0 {
+			continue
+		}
+		match := found[0]
+		match.Address = udpAddr.IP.String()
+		seen[match.Address] = true
+		matches = append(matches, match)
+	}
+	return matches, nil
+}
+
+// ParseProbeMatches extracts the matches from a WS-Discovery ProbeMatches message
+func ParseProbeMatches(data []byte) []WSDiscoveryMatch {
+	var envelope probeMatchEnvelope
+	if err := xml.Unmarshal(data, &envelope); err != nil {
+		return nil
+	}
+	var matches []WSDiscoveryMatch
+	for _, m := range envelope.Body.ProbeMatches.Matches {
+		matches = append(matches, WSDiscoveryMatch{
+			Endpoint: strings.TrimSpace(m.Endpoint),
+			Types:    strings.Fields(m.Types),
+			Scopes:   strings.Fields(m.Scopes),
+			XAddrs:   strings.Fields(m.XAddrs),
+		})
+	}
+	return matches
+}
+
+// wsDiscoveryProbe builds a Probe for ONVIF NetworkVideoTransmitter devices
+func wsDiscoveryProbe(messageID string) string {
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<e:Envelope xmlns:e="http://www.w3.org/2003/05/soap-envelope"
+ xmlns:w="http://schemas.xmlsoap.org/ws/2004/08/addressing"
+ xmlns:d="http://schemas.xmlsoap.org/ws/2005/04/discovery"
+ xmlns:dn="http://www.onvif.org/ver10/network/wsdl">
+ <e:Header>
+  <w:MessageID>` + messageID + `</w:MessageID>
+  <w:To>urn:schemas-xmlsoap-org:ws:2005:04:discovery</w:To>
+  <w:Action>http://schemas.xmlsoap.org/ws/2005/04/discovery/Probe</w:Action>
+ </e:Header>
+ <e:Body><d:Probe><d:Types>dn:NetworkVideoTransmitter</d:Types></d:Probe></e:Body>
+</e:Envelope>`
+}
+
+// newMessageID returns a random urn:uuid (version 4); devices ignore a MessageID they
+// have already answered, so every sweep needs a fresh one
+func newMessageID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("urn:uuid:%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
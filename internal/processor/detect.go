@@ -0,0 +1,381 @@
+package processor
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/postfix/cctvscan/internal/fingerprint"
+)
+
+// The page detectors (Server headers, titles, bodies) pick the brand each host
+// starts with and score it, see applyPageBrand. The other detectors then confirm
+// or replace it from what else the probes gathered: certificates, protocols, MAC
+// vendors. Each returns the brands its source names, scored by how much the source
+// can be trusted, and the engine keeps the brand of the strongest evidence.
+
+// Evidence is a brand named by one source of a host
+type Evidence struct {
+	Brand      string
+	Note       string  // Where the brand was found, kept as the brand note
+	Confidence float64 // e.g. confidenceCert
+}
+
+// Detector finds brand evidence in one kind of probe result. Register a Detector
+// with RegisterDetector; processors skip the ones named with SetSkippedDetectors.
+type Detector interface {
+	// Name identifies the detector in -skip-detectors, e.g. "cert"
+	Name() string
+	// Detect returns the evidence found in result, the strongest first. It must not
+	// modify result.
+	Detect(result *HostResult) []Evidence
+}
+
+// funcDetector is a Detector built from a function, see NewDetector
+type funcDetector struct {
+	name   string
+	detect func(result *HostResult) []Evidence
+}
+
+func (d funcDetector) Name() string { return d.name }
+
+func (d funcDetector) Detect(result *HostResult) []Evidence { return d.detect(result) }
+
+// NewDetector returns a Detector from a detect function
+func NewDetector(name string, detect func(result *HostResult) []Evidence) Detector {
+	return funcDetector{name: name, detect: detect}
+}
+
+// pageDetector scores the brand keywords of the web pages and the RTSP Server
+// header found by some methods of the signatures, e.g. "title"
+type pageDetector struct {
+	name    string
+	methods []string // fingerprint.Match methods whose evidence counts
+}
+
+func (d pageDetector) Name() string { return d.name }
+
+func (d pageDetector) Detect(result *HostResult) []Evidence {
+	var found []Evidence
+	for _, c := range fingerprint.CandidatesFromPages(resultPages(result), result.RTSPInfo.Server, d.methods...) {
+		found = append(found, Evidence{c.Brand, strings.Join(c.Evidence, ", "), c.Confidence})
+	}
+	return found
+}
+
+// resultPages returns the page each HTTP port served
+func resultPages(result *HostResult) []fingerprint.Page {
+	var pages []fingerprint.Page
+	for port, pm := range result.HTTPMeta.Ports {
+		pages = append(pages, fingerprint.Page{Port: port, Server: pm.Server, Body: pm.Body})
+	}
+	return pages
+}
+
+var (
+	detectorsMu sync.RWMutex
+	detectors   []Detector
+)
+
+// RegisterDetector adds d to the detectors run on every host, after those already
+// registered. Like probe.Register it panics if the name is taken.
+func RegisterDetector(d Detector) {
+	detectorsMu.Lock()
+	defer detectorsMu.Unlock()
+	if slices.ContainsFunc(detectors, func(r Detector) bool { return r.Name() == d.Name() }) {
+		panic(fmt.Sprintf("processor: detector %s is already registered", d.Name()))
+	}
+	detectors = append(detectors, d)
+}
+
+// Detectors returns the registered detectors in the order they run
+func Detectors() []Detector {
+	detectorsMu.RLock()
+	defer detectorsMu.RUnlock()
+	return slices.Clone(detectors)
+}
+
+// The page detectors. Their evidence is scored together by applyPageBrand, so a
+// brand named in the header and the title beats one named in either. There is
+// no favicon detector, as no probe fetches favicons.
+var (
+	headerDetector = pageDetector{"header", []string{"header", "rtsp"}}
+	titleDetector  = pageDetector{"title", []string{"title"}}
+	bodyDetector   = pageDetector{"body", []string{"body", "content"}}
+	pageDetectors  = []pageDetector{headerDetector, titleDetector, bodyDetector}
+)
+
+// The built-in detectors, in the order they run. Evidence only replaces a brand
+// that is less certain, so the order settles ties between sources of one confidence.
+var (
+	redirectDetector  = NewDetector("redirect", detectRedirect)
+	certDetector      = NewDetector("cert", detectCert)
+	sdpDetector       = NewDetector("sdp", detectSDP)
+	tlsDetector       = NewDetector("tls", detectTLS)
+	httpStackDetector = NewDetector("http-stack", detectHTTPStack)
+	snmpDetector      = NewDetector("snmp", detectSNMP)
+	macDetector       = NewDetector("mac", detectMAC)
+	onvifDetector     = NewDetector("onvif", detectONVIF)
+	isapiDetector     = NewDetector("isapi", detectISAPI)
+	nucleiDetector    = NewDetector("nuclei", detectNuclei)
+)
+
+func init() {
+	for _, d := range []Detector{
+		headerDetector, titleDetector, bodyDetector, redirectDetector, certDetector, sdpDetector, tlsDetector, httpStackDetector,
+		snmpDetector, macDetector, onvifDetector, isapiDetector, nucleiDetector,
+	} {
+		RegisterDetector(d)
+	}
+}
+
+// SetSkippedDetectors turns off the named detectors, e.g. "mac" for hosts behind
+// a router whose OUI would be taken for the camera's
+func (p *OptimizedProcessor) SetSkippedDetectors(names []string) error {
+	skip := make(map[string]bool)
+	for _, name := range names {
+		if !slices.ContainsFunc(Detectors(), func(d Detector) bool { return d.Name() == name }) {
+			return fmt.Errorf("unknown detector %q", name)
+		}
+		skip[name] = true
+	}
+	p.skipDetectors = skip
+	return nil
+}
+
+// applyPageBrand picks the brand a host starts with from the evidence of the
+// page detectors that aren't skipped. With all of them on, the brand most HTTP
+// ports agree on, or the generic camera hints, come first, see applyPortBrand.
+func (p *OptimizedProcessor) applyPageBrand(result *HostResult) {
+	var methods []string
+	all := true
+	for _, d := range pageDetectors {
+		if p.skipDetectors[d.name] {
+			all = false
+		} else {
+			methods = append(methods, d.methods...)
+		}
+	}
+	if len(methods) == 0 {
+		return
+	}
+	if all {
+		if !applyPortBrand(result) {
+			result.Brand, result.BrandNote = fingerprint.OptimizedDetect(result.HTTPMeta.Server, result.HTTPMeta.BodySnippet, "")
+		}
+	}
+	applyCandidates(result, methods...)
+}
+
+// runDetectors applies the registered detectors that aren't skipped, or only the
+// named ones, in order. It reports whether the brand changed. The page detectors
+// are left to applyPageBrand.
+func (p *OptimizedProcessor) runDetectors(result *HostResult, names ...string) bool {
+	changed := false
+	for _, d := range Detectors() {
+		if p.skipDetectors[d.Name()] || (len(names) > 0 && !slices.Contains(names, d.Name())) {
+			continue
+		}
+		if _, ok := d.(pageDetector); ok {
+			continue
+		}
+		if applyDetector(result, d) {
+			changed = true
+			if p.debug {
+				log.Printf("DEBUG: %s: detector %s set brand %s (%s)", result.Host, d.Name(), result.Brand, result.BrandNote)
+			}
+		}
+	}
+	return changed
+}
+
+// applyDetector applies the first evidence of d that beats the brand found so far.
+// It reports whether the brand changed.
+func applyDetector(result *HostResult, d Detector) bool {
+	for _, e := range d.Detect(result) {
+		if applyEvidence(result, e, fingerprint.Match{Method: d.Name(), Text: e.Note}) {
+			return true
+		}
+	}
+	return false
+}
+
+// applyEvidence records the brand of e, found as why says, unless the brand found
+// so far is at least as certain. Device information names the vendor outright, so
+// it replaces any brand below confidenceDevice, keeping the disagreement in the note.
+func applyEvidence(result *HostResult, e Evidence, why fingerprint.Match) bool {
+	if e.Confidence >= confidenceDevice {
+		if result.BrandScore >= confidenceDevice {
+			return false
+		}
+		return applyONVIFDevice(result, e.Brand, e.Note, why)
+	}
+	if brandSettled(result, e.Confidence) {
+		return false
+	}
+	setBrand(result, e.Brand, e.Note, e.Confidence, []fingerprint.Match{why})
+	return true
+}
+
+// detectRedirect finds the brand in the login paths the web ports redirect to
+func detectRedirect(result *HostResult) []Evidence {
+	var found []Evidence
+	for _, port := range sortedPorts(result.HTTPMeta.Ports) {
+		for _, target := range result.HTTPMeta.Ports[port].Redirects {
+			if brand := fingerprint.DetectFromRedirect(target); brand != "" {
+				found = append(found, Evidence{brand, fmt.Sprintf("HTTP port %d redirects to %s", port, target), confidenceRedirect})
+			}
+		}
+	}
+	return found
+}
+
+// detectCert finds the brand in the TLS certificates, which identifies HTTPS-only
+// devices whose login page is a bare script loader
+func detectCert(result *HostResult) []Evidence {
+	var found []Evidence
+	for _, port := range sortedPorts(result.TLSCerts) {
+		c := result.TLSCerts[port]
+		if brand, evidence := fingerprint.DetectFromCert(c.VendorNames(), c.SHA256); brand != "" {
+			found = append(found, Evidence{brand, fmt.Sprintf("HTTPS port %d %s", port, evidence), confidenceCert})
+		}
+	}
+	return found
+}
+
+// detectTLS finds the brand from the JA3S/JA4S fingerprints of the HTTPS ports
+func detectTLS(result *HostResult) []Evidence {
+	var found []Evidence
+	for _, port := range sortedPorts(result.ServerHellos) {
+		h := result.ServerHellos[port]
+		if brand, evidence := fingerprint.DetectFromTLS(h.JA3S, h.JA4S); brand != "" {
+			found = append(found, Evidence{brand, fmt.Sprintf("HTTPS port %d %s", port, evidence), confidenceTLS})
+		}
+	}
+	return found
+}
+
+// detectHTTPStack finds the brand from the web servers themselves: the order and
+// case of the response headers, and the 404 page or the 401 page served on /
+func detectHTTPStack(result *HostResult) []Evidence {
+	var found []Evidence
+	for _, port := range sortedPorts(result.HTTPStacks) {
+		s := result.HTTPStacks[port]
+		brand, evidence := fingerprint.DetectFromHeaderOrder(s.HeaderOrder)
+		if brand == "" && s.Status >= 400 {
+			brand, evidence = fingerprint.DetectFromErrorPage(s.Body)
+		}
+		if brand != "" {
+			found = append(found, Evidence{brand, fmt.Sprintf("HTTP port %d %s", port, evidence), confidenceStack})
+		}
+	}
+	for _, port := range sortedPorts(result.HTTPMeta.Ports) {
+		if pm := result.HTTPMeta.Ports[port]; pm.StatusCode == http.StatusUnauthorized {
+			if brand, evidence := fingerprint.DetectFromErrorPage(pm.Body); brand != "" {
+				found = append(found, Evidence{brand, fmt.Sprintf("HTTP port %d 401 %s", port, evidence), confidenceStack})
+			}
+		}
+	}
+	return found
+}
+
+// detectSDP finds the brand in the session descriptions of the open RTSP streams
+func detectSDP(result *HostResult) []Evidence {
+	var found []Evidence
+	for _, s := range result.RTSPStreams {
+		if brand, line := fingerprint.DetectFromSDP(s.Media.Signature()); brand != "" {
+			found = append(found, Evidence{brand, "RTSP SDP " + line, confidenceSDP})
+		}
+	}
+	return found
+}
+
+// detectSNMP finds the brand in the SNMP system group. sysDescr usually carries
+// the firmware, so it becomes the note.
+func detectSNMP(result *HostResult) []Evidence {
+	snmp := result.SNMP
+	if !snmp.Found() {
+		return nil
+	}
+	brand := fingerprint.DetectFromSNMP(snmp.SysObjectID, snmp.SysDescr)
+	if brand == "" {
+		return nil
+	}
+	return []Evidence{{brand, strings.TrimSpace("SNMP: " + snmp.SysDescr), confidenceProtocol}}
+}
+
+// detectMAC finds the brand from the vendor OUI of the MAC address
+func detectMAC(result *HostResult) []Evidence {
+	if result.MAC == "" {
+		return nil
+	}
+	brand := fingerprint.DetectFromMAC(result.MAC)
+	if brand == "" {
+		return nil
+	}
+	return []Evidence{{brand, "MAC OUI: " + result.MAC, confidenceMAC}}
+}
+
+// detectONVIF finds the brand in ONVIF device information, which names the vendor
+// outright, and in the WS-Discovery scopes
+func detectONVIF(result *HostResult) []Evidence {
+	var found []Evidence
+	if device := result.ONVIFDevice; device.Found() {
+		if brand := fingerprint.DetectFromONVIF(device.Manufacturer); brand != "" {
+			found = append(found, Evidence{brand, strings.TrimSpace("ONVIF: " + device.Model + " " + device.FirmwareVersion), confidenceDevice})
+		}
+	}
+	info := result.ONVIFInfo
+	if brand := fingerprint.DetectFromONVIFScopes(info.Name, info.Hardware); brand != "" {
+		found = append(found, Evidence{brand, strings.TrimSpace("ONVIF scopes: " + info.Hardware), confidenceScopes})
+	}
+	return found
+}
+
+// applyONVIFDevice reconciles the brand ONVIF reports with the one the heuristics
+// found, keeping the disagreement in the brand note: a web UI branded by an
+// integrator can front firmware of another vendor. Manufacturers without a
+// signature, often placeholders such as "General", only replace unknown brands.
+func applyONVIFDevice(result *HostResult, brand, note string, why fingerprint.Match) bool {
+	guessed, guessNote := result.Brand, result.BrandNote
+	switch {
+	case guessed == "" || guessed == "Unknown cam" || guessed == brand:
+	case !fingerprint.IsKnownBrand(brand):
+		if result.BrandNote != "" {
+			result.BrandNote += "; "
+		}
+		result.BrandNote += "ONVIF manufacturer " + brand
+		return false
+	case fingerprint.Platform(brand) == guessed:
+		note += " (" + guessed + " platform)"
+	case fingerprint.Platform(guessed) != brand:
+		note += "; HTTP suggested " + guessed
+		if guessNote != "" {
+			note += " (" + guessNote + ")"
+		}
+	}
+	setBrand(result, brand, note, confidenceDevice, []fingerprint.Match{why})
+	return true
+}
+
+// detectISAPI marks ISAPI web servers as Hikvision
+func detectISAPI(result *HostResult) []Evidence {
+	if !result.ISAPI.Found() {
+		return nil
+	}
+	return []Evidence{{"Hikvision", "ISAPI at " + result.ISAPI.Base, confidenceProtocol}}
+}
+
+// detectNuclei finds the vendors of the matched nuclei templates
+func detectNuclei(result *HostResult) []Evidence {
+	var found []Evidence
+	for _, m := range result.Nuclei {
+		if brand := fingerprint.DetectFromNuclei(m.TemplateID, m.Tags); brand != "" {
+			found = append(found, Evidence{brand, "nuclei: " + m.TemplateID, confidenceNuclei})
+		}
+	}
+	return found
+}
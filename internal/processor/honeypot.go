@@ -0,0 +1,151 @@
+package processor
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/postfix/cctvscan/internal/fingerprint"
+)
+
+// Honeypots answer like cameras to record attacks, and the fake devices pollute
+// datasets built from scans. No single sign below proves a honeypot, so flagged
+// hosts are reported with the signs found.
+
+// honeypotBanners are the SSH versions honeypots announce out of the box
+var honeypotBanners = []struct {
+	banner string
+	name   string
+}{
+	{"SSH-2.0-OpenSSH_6.0p1 Debian-4+deb7u2", "Cowrie"},
+	{"SSH-2.0-OpenSSH_5.1p1 Debian-5", "Kippo"},
+}
+
+// honeypotPorts are services that multi-protocol honeypots such as Dionaea open
+// and no camera runs: WINS, MS RPC, SMB, PPTP, MS SQL, MySQL, memcached, MongoDB
+var honeypotPorts = []int{42, 135, 445, 1433, 1723, 3306, 11211, 27017}
+
+// minHoneypotPorts of honeypotPorts open on a camera flag the host
+const minHoneypotPorts = 3
+
+// vendorPorts are proprietary SDK ports only one vendor's firmware listens on
+var vendorPorts = map[int]string{
+	37777: "Dahua",
+	34567: "Xiongmai",
+	34599: "Xiongmai",
+}
+
+// minPageBrands distinct brands among the web pages of one host flag it; two
+// are common behind a NAT forwarding ports to several devices
+const minPageBrands = 3
+
+// minCannedBody is the smallest page compared across hosts; shorter bodies such
+// as "Unauthorized" are the same everywhere
+const minCannedBody = 256
+
+// FlagHoneypots records on each host the signs that it is a honeypot posing as a
+// camera: default honeypot banners, services no camera runs, SDK ports or web pages
+// of several vendors, and an ETag or page identical to one served by a host of
+// another brand, which canned camera modules reuse across personalities.
+func FlagHoneypots(results []HostResult) {
+	type served struct {
+		brands map[string]bool // Platforms of the hosts serving it
+		hosts  []int           // Indexes into results
+	}
+	shared := make(map[string]*served)
+	for i := range results {
+		r := &results[i]
+		r.Honeypot = honeypotSigns(*r)
+		brand := fingerprint.Platform(r.Brand)
+		if brand == "" || brand == "Unknown cam" {
+			continue
+		}
+		for _, port := range sortedPorts(r.HTTPMeta.Ports) {
+			pm := r.HTTPMeta.Ports[port]
+			var keys []string
+			if pm.ETag != "" {
+				keys = append(keys, "ETag "+pm.ETag)
+			}
+			if len(pm.Body) >= minCannedBody {
+				sum := sha256.Sum256([]byte(pm.Body))
+				keys = append(keys, fmt.Sprintf("page %x", sum[:8]))
+			}
+			for _, key := range keys {
+				s := shared[key]
+				if s == nil {
+					s = &served{brands: make(map[string]bool)}
+					shared[key] = s
+				}
+				s.brands[brand] = true
+				if !slices.Contains(s.hosts, i) {
+					s.hosts = append(s.hosts, i)
+				}
+			}
+		}
+	}
+	for key, s := range shared {
+		if len(s.brands) < 2 {
+			continue
+		}
+		brands := make([]string, 0, len(s.brands))
+		for b := range s.brands {
+			brands = append(brands, b)
+		}
+		slices.Sort(brands)
+		sign := key + " served by hosts of " + strings.Join(brands, ", ")
+		for _, i := range s.hosts {
+			if !slices.Contains(results[i].Honeypot, sign) {
+				results[i].Honeypot = append(results[i].Honeypot, sign)
+			}
+		}
+	}
+	for i := range results {
+		slices.Sort(results[i].Honeypot)
+	}
+}
+
+// honeypotSigns returns the signs of a honeypot found on one host
+func honeypotSigns(r HostResult) []string {
+	var signs []string
+	for _, b := range honeypotBanners {
+		if r.SSH.Banner == b.banner {
+			signs = append(signs, fmt.Sprintf("SSH banner %q is the %s default", b.banner, b.name))
+		}
+	}
+
+	var services, sdk []int
+	vendors := make(map[string]bool)
+	for _, port := range r.Ports {
+		if slices.Contains(honeypotPorts, port) {
+			services = append(services, port)
+		}
+		if v, ok := vendorPorts[port]; ok {
+			sdk = append(sdk, port)
+			vendors[v] = true
+		}
+	}
+	if len(services) >= minHoneypotPorts {
+		signs = append(signs, fmt.Sprintf("ports %v are services no camera runs", services))
+	}
+	if len(vendors) > 1 {
+		var named []string
+		for _, port := range sdk {
+			named = append(named, fmt.Sprintf("%d (%s)", port, vendorPorts[port]))
+		}
+		signs = append(signs, "SDK ports of several vendors: "+strings.Join(named, ", "))
+	}
+
+	var brands []string
+	for _, port := range sortedPorts(r.HTTPMeta.Ports) {
+		pm := r.HTTPMeta.Ports[port]
+		brand, _ := fingerprint.OptimizedDetect(pm.Server, pm.Body, "")
+		if brand = fingerprint.Platform(brand); brand != "" && brand != "Unknown cam" && !slices.Contains(brands, brand) {
+			brands = append(brands, brand)
+		}
+	}
+	if len(brands) >= minPageBrands {
+		signs = append(signs, "web pages of "+strings.Join(brands, ", "))
+	}
+	return signs
+}
@@ -2,52 +2,222 @@ package processor
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"log"
+	"net"
 	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/postfix/cctvscan/internal/control"
 	"github.com/postfix/cctvscan/internal/credbrute"
+	"github.com/postfix/cctvscan/internal/cvedb"
+	"github.com/postfix/cctvscan/internal/eol"
 	"github.com/postfix/cctvscan/internal/fingerprint"
+	"github.com/postfix/cctvscan/internal/nuclei"
 	"github.com/postfix/cctvscan/internal/probe"
 	"github.com/postfix/cctvscan/internal/streams"
+	"github.com/postfix/cctvscan/internal/util"
 )
 
 // HostResult contains all results for a single host
 type HostResult struct {
-	Host        string
-	Ports       []int
-	HTTPPorts   []int
-	RTSPPorts   []int
-	HTTPMeta    probe.HTTPMeta
-	LoginPages  []string
-	RTSPInfo    probe.RTSPInfo
-	ONVIFResult string
-	MJPEGPaths  []string
-	Brand       string
-	BrandNote   string
-	CVEs        []string
-	Credentials string
-	Error       error
+	Host          string
+	Hostnames     []string // PTR names, when reverse DNS is enabled
+	MAC           string   // From the ARP cache; only for hosts on an attached subnet
+	Ports         []int
+	ClosedPorts   []int // Discovered but answered with RST during verification
+	FilteredPorts []int // Discovered but silent during verification
+	SCTPPorts     []int // Answered an SCTP INIT with INIT-ACK
+	HTTPPorts     []int
+	RTSPPorts     []int
+	HTTPMeta      probe.HTTPMeta
+	TLSCerts      map[int]probe.TLSCert         // Certificate per HTTPS port
+	ServerHellos  map[int]probe.ServerHello     // TLS stack fingerprint per HTTPS port
+	HTTPStacks    map[int]probe.HTTPFingerprint // Header order and 404 page per HTTP port
+	LoginPages    []string
+	LoginAuth     map[string]probe.AuthChallenge // Challenge per protected login URL
+	LoginStatus   []probe.LoginPage              // Status code and content type per login URL
+	Screenshots   map[string]string              // PNG per login URL, relative to the output directory
+	RTSPInfo      probe.RTSPInfo
+	RTSPStreams   []probe.RTSPStream          // Play without credentials
+	RTSPAuth      map[int]probe.AuthChallenge // Challenge per RTSP port that answered 401
+	ONVIFInfo     probe.ONVIFInfo             // Unicast WS-Discovery ProbeMatch
+	ONVIFDevice   probe.ONVIFDeviceInfo
+	ONVIFServices []probe.ONVIFService // Device services answering GetSystemDateAndTime over HTTP
+	GSOAP         probe.GSOAPInfo      // gSOAP behind the ONVIF device service
+	ISAPI         probe.ISAPIInfo      // Hikvision ISAPI resources answering without credentials
+	CVEChecks     []probe.CVECheck     // Outcome of each CVE check of the platform
+	Advisories    []cvedb.Advisory     // Vulners bulletins for the firmware CPE
+	Nuclei        []nuclei.Match       // Matched nuclei templates
+	ONVIFSnapshot string               // Snapshot fetched via GetSnapshotUri, relative to the output directory
+	SnapshotURIs  []probe.ONVIFSnapshotURI
+	DeviceDetails probe.DeviceDetails  // Model and firmware from the brand's own endpoint
+	P2P           []probe.P2PIndicator // Vendor P2P cloud enrolment
+	SNMP          probe.SNMPInfo
+	Telnet        map[int]string // Pre-login banner per telnet port
+	SSH           probe.SSHInfo
+	FTP           probe.FTPInfo
+	SIP           probe.SIPInfo
+	SADPDevice    probe.SADPDevice    // Hikvision SADP answer from the local segment
+	MDNSServices  []probe.MDNSService // Bonjour services advertised on the local segment
+	MJPEGPaths    []string
+	HLSStreams    []string                  // HLS playlist URLs
+	Latency       map[int]probe.PortLatency // Connect time, TTFB and failed connects per port
+	Notes         []probe.ExposureFinding   // HTTP exposure audit findings
+	ProbeFindings []probe.Finding           // From registered probes without a field of their own
+	Brand         string
+	BrandNote     string
+	BrandScore    float64                 // Confidence in Brand from 0 to 1; 0 when not scored
+	BrandWhy      []fingerprint.Match     // Patterns that named Brand
+	Candidates    []fingerprint.Candidate // Brands the HTTP and RTSP evidence points to, most likely first
+	Model         string                  // Most specific model number found, e.g. DS-2CD2042WD-I
+	ModelLine     string                  // Product line of Model, e.g. DS-2CD IP camera
+	ModelNote     string                  // Where Model came from
+	Firmware      string                  // Most reliable firmware version found
+	FirmwareNote  string                  // Where Firmware came from
+	Serial        string                  // Serial number or device ID, which stays with the device when its address changes
+	SerialNote    string                  // Where Serial came from
+	Locale        string                  // Language of the web UI, e.g. zh-CN
+	LocaleNote    string                  // What gave the language away
+	SoC           string                  // Chip family the firmware is built on, e.g. HiSilicon
+	SoCNote       string                  // Where SoC came from
+	Class         string                  // fingerprint.ClassCamera, ClassRecorder, ClassEncoder or ClassVMS
+	ClassNote     string                  // Where Class came from
+	CVEs          []string
+	Credentials   string                // First of Logins
+	Logins        []credbrute.Finding   // Every credential that logged in, and where
+	CredsProof    string                // Model and firmware the brand endpoint gave only with Credentials
+	CredsRefused  []string              // Credentials the login page took but the brand endpoint refused
+	Lockout       string                // Where credential testing stopped as the device locked out
+	ONVIFCred     probe.ONVIFCredential // Credential the ONVIF device service accepted
+	Honeypot      []string              // Signs the host is a honeypot posing as a camera
+	Partial       bool                  // Host timeout expired before every probe finished
+	Error         error
 }
 
 // OptimizedProcessor handles concurrent processing of multiple hosts
 type OptimizedProcessor struct {
-	debug     bool
-	credsFile string
-	outputDir string
+	debug         bool
+	credsFile     string
+	outputDir     string
+	hostTimeout   time.Duration
+	gate          *control.Gate
+	browser       string         // Headless browser for login page screenshots ("" = off)
+	nuclei        *nuclei.Runner // Nuclei templates run against the web services (nil = off)
+	probeConfig   probe.ProbeConfig
+	cache         *probe.DiskCache                                         // Probe results from earlier runs (optional)
+	lookupAddr    func(ctx context.Context, addr string) ([]string, error) // PTR resolver (nil = off)
+	skipDetectors map[string]bool                                          // Detectors turned off, see SetSkippedDetectors
+	vulners       *cvedb.Vulners                                           // Online advisory lookup by CPE (nil = off)
+	bruteLimits   credbrute.Limits                                         // Pace of the logins tried on each host
 }
 
+// rdnsTimeout bounds the PTR lookup of one host
+const rdnsTimeout = 2 * time.Second
+
 // NewOptimizedProcessor creates a new optimized processor
 func NewOptimizedProcessor(debug bool, credsFile, outputDir string) *OptimizedProcessor {
 	return &OptimizedProcessor{
-		debug:     debug,
-		credsFile: credsFile,
-		outputDir: outputDir,
+		debug:       debug,
+		credsFile:   credsFile,
+		outputDir:   outputDir,
+		probeConfig: probe.DefaultProbeConfig(),
+	}
+}
+
+// SetHostTimeout bounds the time spent probing any single host (0 = no limit)
+func (p *OptimizedProcessor) SetHostTimeout(timeout time.Duration) {
+	p.hostTimeout = timeout
+}
+
+// SetGate makes the processor hold back new hosts while the gate is paused
+func (p *OptimizedProcessor) SetGate(gate *control.Gate) {
+	p.gate = gate
+}
+
+// SetScreenshotBrowser enables login page screenshots rendered with the given
+// Chrome/Chromium binary (see streams.FindBrowser)
+func (p *OptimizedProcessor) SetScreenshotBrowser(browser string) {
+	p.browser = browser
+}
+
+// SetNuclei runs nuclei against the web services of every host and merges the
+// template matches into brand detection and the CVE list
+func (p *OptimizedProcessor) SetNuclei(r nuclei.Runner) {
+	p.nuclei = &r
+}
+
+// SetBruteForceLimits paces the credentials tried on each host
+func (p *OptimizedProcessor) SetBruteForceLimits(l credbrute.Limits) {
+	p.bruteLimits = l
+}
+
+// SetProbeConfig sets the per-protocol timeouts, retries and optional probes used
+// for every host
+func (p *OptimizedProcessor) SetProbeConfig(cfg probe.ProbeConfig) {
+	p.probeConfig = cfg
+}
+
+// SetProbeCache reuses probe results from earlier runs and stores new ones in cache
+func (p *OptimizedProcessor) SetProbeCache(cache *probe.DiskCache) {
+	p.cache = cache
+}
+
+// SetVulners asks Vulners for the advisories of the firmware of every device
+// whose model and firmware version are known
+func (p *OptimizedProcessor) SetVulners(v *cvedb.Vulners) {
+	p.vulners = v
+}
+
+// SetReverseDNS enables PTR lookups of every host through the system resolver
+func (p *OptimizedProcessor) SetReverseDNS(enabled bool) {
+	p.lookupAddr = nil
+	if enabled {
+		p.lookupAddr = net.DefaultResolver.LookupAddr
 	}
 }
 
+// reverseLookup returns the PTR names of host without the trailing dot. Hosts given
+// by name aren't looked up.
+func (p *OptimizedProcessor) reverseLookup(ctx context.Context, host string) []string {
+	if p.lookupAddr == nil || net.ParseIP(host) == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, rdnsTimeout)
+	defer cancel()
+	names, err := p.lookupAddr(ctx, host)
+	if err != nil {
+		if p.debug {
+			log.Printf("DEBUG: Reverse DNS lookup of %s failed: %v", host, err)
+		}
+		return nil
+	}
+	var hostnames []string
+	for _, name := range names {
+		if name = strings.TrimSuffix(name, "."); name != "" && !slices.Contains(hostnames, name) {
+			hostnames = append(hostnames, name)
+		}
+	}
+	return hostnames
+}
+
+// hostContext derives the per-host probing budget and login pace from the global
+// context
+func (p *OptimizedProcessor) hostContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx = credbrute.WithLimits(ctx, p.bruteLimits)
+	if p.hostTimeout > 0 {
+		return context.WithTimeout(probe.WithConfig(ctx, p.probeConfig), p.hostTimeout)
+	}
+	return context.WithCancel(probe.WithConfig(ctx, p.probeConfig))
+}
+
 // ProcessHosts processes multiple hosts concurrently
 func (p *OptimizedProcessor) ProcessHosts(ctx context.Context, results map[string][]int) []HostResult {
 	var hostResults []HostResult
@@ -64,6 +234,9 @@ func (p *OptimizedProcessor) ProcessHosts(ctx context.Context, results map[strin
 			semaphore <- struct{}{}
 			defer func() { <-semaphore }()
 
+			// Hosts already being probed finish; new ones wait out a pause
+			p.gate.Wait(ctx)
+
 			result := p.processHost(ctx, h, portList)
 
 			mu.Lock()
@@ -76,69 +249,872 @@ func (p *OptimizedProcessor) ProcessHosts(ctx context.Context, results map[strin
 	return hostResults
 }
 
-// processHost processes a single host with all optimizations
-func (p *OptimizedProcessor) processHost(ctx context.Context, host string, ports []int) HostResult {
+// AttachPortStates records closed and filtered ports on the host results. Hosts with no
+// open ports get a result of their own so firewalled devices still appear in the report.
+func AttachPortStates(results []HostResult, closed, filtered map[string][]int) []HostResult {
+	seen := make(map[string]bool, len(results))
+	for i := range results {
+		host := results[i].Host
+		seen[host] = true
+		results[i].ClosedPorts = closed[host]
+		results[i].FilteredPorts = filtered[host]
+	}
+
+	for _, states := range []map[string][]int{closed, filtered} {
+		for host := range states {
+			if seen[host] {
+				continue
+			}
+			seen[host] = true
+			results = append(results, HostResult{
+				Host:          host,
+				ClosedPorts:   closed[host],
+				FilteredPorts: filtered[host],
+			})
+		}
+	}
+	return results
+}
+
+// AttachSCTPPorts records open SCTP ports on the host results, adding hosts that
+// only expose SCTP. SCTP ports are reported but not probed.
+func AttachSCTPPorts(results []HostResult, sctp map[string][]int) []HostResult {
+	seen := make(map[string]bool, len(results))
+	for i := range results {
+		seen[results[i].Host] = true
+		results[i].SCTPPorts = sctp[results[i].Host]
+	}
+	for host, ports := range sctp {
+		if !seen[host] {
+			results = append(results, HostResult{Host: host, SCTPPorts: ports})
+		}
+	}
+	return results
+}
+
+// AttachSADP records Hikvision SADP answers on the host results, adding devices that
+// had no open ports. SADP reports the exact model and firmware, so it overrides the
+// HTTP brand heuristics.
+func AttachSADP(results []HostResult, devices []probe.SADPDevice) []HostResult {
+	byHost := make(map[string]probe.SADPDevice, len(devices))
+	for _, d := range devices {
+		byHost[d.Address] = d
+	}
+	seen := make(map[string]bool, len(results))
+	for i := range results {
+		seen[results[i].Host] = true
+		if d, ok := byHost[results[i].Host]; ok {
+			applySADP(&results[i], d)
+		}
+	}
+	for _, d := range devices {
+		if !seen[d.Address] {
+			seen[d.Address] = true
+			result := HostResult{Host: d.Address}
+			applySADP(&result, d)
+			results = append(results, result)
+		}
+	}
+	return results
+}
+
+// applySADP stores a SADP answer and takes the brand from it
+func applySADP(result *HostResult, device probe.SADPDevice) {
+	result.SADPDevice = device
+	if result.MAC == "" {
+		result.MAC = probe.NormalizeMAC(device.MAC)
+	}
+	note := strings.TrimSpace("SADP: " + device.Model + " " + device.FirmwareVersion)
+	setBrand(result, "Hikvision", note, confidenceDevice, []fingerprint.Match{{Method: "sadp", Text: note}})
+	result.CVEs = fingerprint.OptimizedCVEsForBrand(result.Brand)
+	applyModel(result)
+	applyFirmware(result)
+	applySerial(result)
+	applyClass(result)
+	applyDeviceCVEs(result)
+}
+
+// AttachMDNS records the Bonjour services each address advertised, adding devices
+// that had no open ports. An _axis-video service names the brand when the HTTP
+// heuristics found nothing specific.
+func AttachMDNS(results []HostResult, devices []probe.MDNSDevice) []HostResult {
+	byHost := make(map[string][]probe.MDNSService, len(devices))
+	for _, d := range devices {
+		byHost[d.Address] = d.Services
+	}
+	seen := make(map[string]bool, len(results))
+	for i := range results {
+		seen[results[i].Host] = true
+		if services, ok := byHost[results[i].Host]; ok {
+			applyMDNS(&results[i], services)
+		}
+	}
+	for _, d := range devices {
+		if !seen[d.Address] {
+			seen[d.Address] = true
+			result := HostResult{Host: d.Address}
+			applyMDNS(&result, d.Services)
+			results = append(results, result)
+		}
+	}
+	return results
+}
+
+// applyMDNS stores advertised services and takes the brand from an Axis service
+func applyMDNS(result *HostResult, services []probe.MDNSService) {
+	result.MDNSServices = services
+	if brandSettled(result, confidenceProtocol) {
+		return
+	}
+	for _, s := range services {
+		if s.Service == "_axis-video._tcp" {
+			setBrand(result, "Axis", "mDNS: "+s.Instance, confidenceProtocol,
+				[]fingerprint.Match{{Method: "mdns", Pattern: s.Service, Text: s.Instance}})
+			result.CVEs = fingerprint.OptimizedCVEsForBrand(result.Brand)
+			return
+		}
+	}
+}
+
+// processHost processes a single host with all optimizations. If the host timeout
+// expires, the probes that finished are kept and the result is marked partial.
+func (p *OptimizedProcessor) processHost(parent context.Context, host string, ports []int) HostResult {
 	result := HostResult{
 		Host:  host,
 		Ports: ports,
 	}
 
+	ctx, cancel := p.hostContext(parent)
+	defer cancel()
+
 	if p.debug {
 		log.Printf("DEBUG: Processing host %s with ports %v", host, ports)
 	}
 
+	result.Hostnames = p.reverseLookup(ctx, host)
+
 	// Filter ports
 	result.HTTPPorts = probe.FilterHTTPish(ports)
 	result.RTSPPorts = probe.FilterRTSP(ports)
 
 	// Use optimized probe for concurrent processing
-	probeResult := probe.OptimizedProbe(ctx, host, ports)
+	probeResult, cached := probe.OptimizedProbeResult{}, false
+	if p.cache != nil {
+		probeResult, cached = p.cache.Get(host, ports)
+	}
+	if cached {
+		if p.debug {
+			log.Printf("DEBUG: Using cached probe results for %s", host)
+		}
+	} else {
+		probeResult = probe.OptimizedProbe(ctx, host, ports)
+		// Results cut short by the host budget aren't worth keeping
+		if p.cache != nil && ctx.Err() == nil {
+			if err := p.cache.Put(host, ports, probeResult); err != nil {
+				log.Printf("WARNING: %s: %v", host, err)
+			}
+		}
+	}
 	result.HTTPMeta = probeResult.HTTPMeta
+	result.TLSCerts = probeResult.TLSCerts
+	result.ServerHellos = probeResult.ServerHellos
+	result.HTTPStacks = probeResult.HTTPStacks
 	result.LoginPages = probeResult.LoginPages
+	result.LoginAuth = probeResult.LoginAuth
+	result.LoginStatus = probeResult.LoginStatus
 	result.RTSPInfo = probeResult.RTSPInfo
-	result.ONVIFResult = probeResult.ONVIFResult
+	result.RTSPStreams = probeResult.RTSPStreams
+	result.RTSPAuth = probeResult.RTSPAuth
+	result.ONVIFInfo = probeResult.ONVIFInfo
+	result.ONVIFDevice = probeResult.ONVIFDevice
+	result.ONVIFServices = probeResult.ONVIFServices
+	result.GSOAP = probeResult.GSOAP
+	result.ISAPI = probeResult.ISAPI
+	result.SNMP = probeResult.SNMP
+	result.Telnet = probeResult.Telnet
+	result.SSH = probeResult.SSH
+	result.FTP = probeResult.FTP
+	result.SIP = probeResult.SIP
 	result.MJPEGPaths = probeResult.MJPEGPaths
+	result.HLSStreams = probeResult.HLSStreams
+	result.Latency = probeResult.Latency
+	result.Notes = probeResult.Exposure
+	result.ProbeFindings = probeResult.Findings
+	result.MAC = probe.LookupMAC(ctx, host)
+	for port, pm := range result.HTTPMeta.Ports {
+		if l, ok := result.Latency[port]; ok && pm.TTFB > 0 {
+			l.TTFB = pm.TTFB
+			result.Latency[port] = l
+		}
+	}
 
 	// Brand detection with caching
-	result.Brand, result.BrandNote = fingerprint.OptimizedDetect(
-		result.HTTPMeta.Server,
-		result.HTTPMeta.BodySnippet,
-		"",
-	)
+	p.applyPageBrand(&result)
+
+	// Nuclei templates know devices and vulnerabilities the built-in probes don't
+	if p.nuclei != nil && len(result.HTTPPorts) > 0 {
+		result.Nuclei = p.runNuclei(ctx, host, result.HTTPPorts)
+	}
+	p.runDetectors(&result)
 
 	// CVE lookup if brand detected
 	if result.Brand != "" {
 		result.CVEs = fingerprint.OptimizedCVEsForBrand(result.Brand)
 	}
 
-	// Credential brute force if login pages found
-	if len(result.LoginPages) > 0 {
-		if _, err := os.Stat(p.credsFile); !os.IsNotExist(err) {
-			result.Credentials = credbrute.OptimizedBruteForce(
-				ctx, host, result.LoginPages, p.credsFile, 5*time.Second,
-			)
+	// Brand specific endpoints give the exact model and firmware
+	detailsAuth := p.probeDeviceDetails(ctx, &result, "", "")
+
+	// Credential brute force if login pages found and the credentials file holds
+	// any, the brand's defaults first
+	creds := p.credentials(host, result.Brand)
+	var lockout error
+	if len(result.LoginPages) > 0 && len(creds) > 0 {
+		result.Logins, lockout = credbrute.BruteForce(ctx, host, result.LoginPages, creds, 5*time.Second)
+	}
+	// Dahua web UIs log in through JSON RPC2 rather than HTTP auth
+	if len(result.Logins) == 0 && lockout == nil && len(creds) > 0 && fingerprint.Platform(result.Brand) == "Dahua" {
+		var err error
+		for _, port := range result.HTTPPorts {
+			base := probe.DetectScheme(ctx, host, port) + "://" + net.JoinHostPort(host, util.Itoa(port))
+			if result.Logins, err = credbrute.TryDahuaRPC2(ctx, base, creds, 5*time.Second); len(result.Logins) > 0 || err != nil {
+				break
+			}
+		}
+		// The SDK port takes the same accounts, and is often open with the web UI off
+		if len(result.Logins) == 0 && err == nil && slices.Contains(result.Ports, credbrute.DVRIPPort) {
+			result.Logins, err = credbrute.TryDahuaDVRIP(ctx, host, credbrute.DVRIPPort, creds, 5*time.Second)
+		}
+		if errors.Is(err, credbrute.ErrLockout) {
+			lockout = err
+		} else if err != nil {
+			log.Printf("WARNING: %s: %v", host, err)
+		}
+	}
+	// Whichever way a credential logged in, the device information must take it too
+	p.verifyCredentials(ctx, &result)
+	if len(result.Logins) > 0 {
+		result.Credentials = result.Logins[0].Credential
+		result.CredsProof = result.Logins[0].Proof
+	}
+	// A locked out host gets no more logins, ONVIF included, as accounts are shared
+	if lockout != nil {
+		result.Lockout = lockout.Error()
+		log.Printf("WARNING: %s: %v, credential testing stopped", host, lockout)
+	}
+
+	// Retry ONVIF device information with the web credentials, which are often shared
+	if probeResult.ONVIFAuth && result.Credentials != "" {
+		user, pass, _ := strings.Cut(result.Credentials, ":")
+		if device, err := probe.ProbeONVIFDeviceInfo(ctx, host, result.HTTPPorts, user, pass); err == nil {
+			result.ONVIFDevice = device
+			if p.runDetectors(&result, onvifDetector.Name()) {
+				result.CVEs = fingerprint.OptimizedCVEsForBrand(result.Brand)
+			}
+		}
+	}
+
+	// The ONVIF account often keeps its default after the web password changed
+	if probeResult.ONVIFAuth && !result.ONVIFDevice.Found() && len(creds) > 0 && result.Lockout == "" {
+		cred, ok, err := probe.TryONVIFCredentials(ctx, host, result.HTTPPorts, creds, credbrute.Wait)
+		if ok {
+			result.ONVIFCred, result.ONVIFDevice = cred, cred.Device
+			if p.runDetectors(&result, onvifDetector.Name()) {
+				result.CVEs = fingerprint.OptimizedCVEsForBrand(result.Brand)
+			}
+		}
+		if errors.Is(err, probe.ErrONVIFLockout) {
+			result.Lockout = err.Error()
+			log.Printf("WARNING: %s: %v, credential testing stopped", host, err)
+		}
+	}
+
+	// Verify the CVEs of the platform that have a safe check
+	if platform := fingerprint.Platform(result.Brand); probe.ConfigFrom(ctx).CheckCVEs && probe.HasCVEChecks(platform) && len(result.HTTPPorts) > 0 {
+		result.CVEChecks = probe.CheckCVEs(ctx, host, result.HTTPPorts, platform)
+	}
+	applyProbeCVEs(&result)
+
+	// Retry the brand endpoint with the web credentials
+	if detailsAuth && result.Credentials != "" && result.CredsProof == "" {
+		user, pass, _ := strings.Cut(result.Credentials, ":")
+		p.probeDeviceDetails(ctx, &result, user, pass)
+	}
+
+	applyModel(&result)
+	applyFirmware(&result)
+	// The webLanguage injection can't be checked without a write, so it is told
+	// from the firmware build instead
+	if probe.ConfigFrom(ctx).CheckCVEs && fingerprint.Platform(result.Brand) == "Hikvision" {
+		if c, ok := probe.InferWebLanguage(result.Firmware); ok {
+			result.CVEChecks = append(result.CVEChecks, c)
+		}
+	}
+	applySerial(&result)
+	applyLocale(&result)
+	applySoC(&result)
+	applyClass(&result)
+	applyDeviceCVEs(&result)
+	if p.vulners != nil {
+		p.applyVulners(ctx, &result)
+	}
+
+	// Vendor P2P clouds expose the device whatever the firewall allows inbound
+	result.P2P = probe.P2PIndicatorsFromScan(ports, result.HTTPMeta)
+	if len(result.HTTPPorts) > 0 && result.Brand != "" {
+		user, pass, _ := strings.Cut(result.Credentials, ":")
+		status, err := probe.ProbeP2PStatus(ctx, host, result.HTTPPorts, fingerprint.Platform(result.Brand), user, pass)
+		if err == nil {
+			result.P2P = append(result.P2P, status)
+		} else if p.debug && errors.Is(err, probe.ErrDeviceUnauthorized) {
+			log.Printf("DEBUG: %s: P2P status needs credentials", host)
+		}
+	}
+
+	// Many cameras only offer snapshots through ONVIF
+	if result.ONVIFDevice.URL != "" {
+		p.fetchONVIFSnapshot(ctx, &result)
+	}
+
+	// A picture of the login screen is the fastest way to triage many hits
+	if p.browser != "" && len(result.LoginPages) > 0 {
+		shots, err := streams.CaptureLoginPages(ctx, p.browser, result.LoginPages, filepath.Join(p.outputDir, "screenshots"))
+		if err != nil {
+			log.Printf("WARNING: %s: login page screenshots failed: %v", host, err)
+		}
+		for page, name := range shots {
+			if result.Screenshots == nil {
+				result.Screenshots = make(map[string]string)
+			}
+			result.Screenshots[page] = filepath.ToSlash(filepath.Join("screenshots", name))
 		}
 	}
 
 	// MJPEG stream processing
 	if len(result.HTTPPorts) > 0 {
 		go func() {
+			// Runs after processHost returns, so it gets its own host budget
+			snapshotCtx, cancel := p.hostContext(parent)
+			defer cancel()
 			outputDir := p.outputDir + "/snapshots"
 			if p.debug {
 				log.Printf("DEBUG: Saving snapshots to: %s", outputDir)
 			}
-			streams.TryMJPEG(ctx, host, result.HTTPPorts, outputDir)
+			streams.TryMJPEG(snapshotCtx, host, result.HTTPPorts, outputDir)
 		}()
 	}
 
+	// A tar-pitting host used up its budget; keep what finished and move on
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) && parent.Err() == nil {
+		result.Partial = true
+		result.Error = fmt.Errorf("host timeout of %s exceeded", p.hostTimeout)
+		log.Printf("WARNING: %s: host timeout of %s exceeded, results are partial", host, p.hostTimeout)
+	}
+
 	return result
 }
 
+// runNuclei runs the nuclei templates against the root URL of each web port
+func (p *OptimizedProcessor) runNuclei(ctx context.Context, host string, ports []int) []nuclei.Match {
+	urls := make([]string, 0, len(ports))
+	for _, port := range ports {
+		urls = append(urls, probe.DetectScheme(ctx, host, port)+"://"+net.JoinHostPort(host, util.Itoa(port)))
+	}
+	matches, err := p.nuclei.Run(ctx, urls)
+	if err != nil {
+		log.Printf("WARNING: %s: %v", host, err)
+	}
+	if p.debug {
+		log.Printf("DEBUG: %s: %d nuclei template(s) matched", host, len(matches))
+	}
+	return matches
+}
+
+// probeDeviceDetails reads model and firmware from the device information endpoint of
+// the detected brand and makes them the brand note. It reports whether the endpoint
+// wanted credentials.
+func (p *OptimizedProcessor) probeDeviceDetails(ctx context.Context, result *HostResult, user, pass string) bool {
+	platform := fingerprint.Platform(result.Brand)
+	if !probe.HasBrandProbe(platform) || len(result.HTTPPorts) == 0 {
+		return false
+	}
+	details, err := probe.ProbeBrandDetails(ctx, result.Host, result.HTTPPorts, platform, user, pass)
+	if details.Found() {
+		result.DeviceDetails = details
+		if details.Model != "" || details.Firmware != "" {
+			result.BrandNote = strings.TrimSpace("Device info: " + details.Model + " " + details.Firmware)
+		}
+	}
+	if err != nil && p.debug {
+		log.Printf("DEBUG: %s: %s device information: %v", result.Host, result.Brand, err)
+	}
+	return errors.Is(err, probe.ErrDeviceUnauthorized)
+}
+
+// credentials returns the credentials tried on host: the brand's defaults and then
+// those of the credentials file, or none when the file is missing, unreadable or
+// holds no credential, as brute force only runs when a file asks for it
+func (p *OptimizedProcessor) credentials(host, brand string) []string {
+	creds, err := credbrute.Credentials(p.credsFile)
+	if err != nil {
+		if p.debug && !os.IsNotExist(err) {
+			log.Printf("DEBUG: %s: no credential testing: %v", host, err)
+		}
+		return nil
+	}
+	if len(creds) == 0 {
+		return nil
+	}
+	return credbrute.WithDefaults(creds, fingerprint.DefaultCredentials(brand))
+}
+
+// verifyCredentials reads the brand's device information endpoint with each
+// credential found by brute force, as some devices answer 200 to a login page
+// whatever is sent. Model and firmware read with one are kept as its proof; one
+// the endpoint refuses is dropped as a false positive.
+func (p *OptimizedProcessor) verifyCredentials(ctx context.Context, result *HostResult) {
+	platform := fingerprint.Platform(result.Brand)
+	if len(result.Logins) == 0 || !probe.HasBrandProbe(platform) || len(result.HTTPPorts) == 0 {
+		return
+	}
+	var creds []string
+	for _, l := range result.Logins {
+		if !slices.Contains(creds, l.Credential) {
+			creds = append(creds, l.Credential)
+		}
+	}
+	proofs := make(map[string]string) // By credential; refused ones are left out
+	for _, c := range creds {
+		user, pass, _ := strings.Cut(c, ":")
+		details, err := probe.ProbeBrandDetails(ctx, result.Host, result.HTTPPorts, platform, user, pass)
+		switch {
+		case details.Found() && details.Authenticated:
+			result.DeviceDetails = details
+			result.BrandNote = strings.TrimSpace("Device info: " + details.Model + " " + details.Firmware)
+			proofs[c] = strings.TrimSpace(details.Model+" "+details.Firmware) + " from " + details.URL
+		case errors.Is(err, probe.ErrDeviceUnauthorized):
+			if p.debug {
+				log.Printf("DEBUG: %s: %s device information refused %s, dropping it", result.Host, result.Brand, c)
+			}
+			result.CredsRefused = append(result.CredsRefused, c)
+		default:
+			proofs[c] = ""
+		}
+	}
+	result.Logins = slices.DeleteFunc(result.Logins, func(l credbrute.Finding) bool {
+		_, ok := proofs[l.Credential]
+		return !ok
+	})
+	for i, l := range result.Logins {
+		result.Logins[i].Proof = proofs[l.Credential]
+	}
+}
+
+// fetchONVIFSnapshot asks the media service for each profile's snapshot URI and saves
+// the first image that downloads beside the MJPEG snapshots. Both steps are tried
+// without credentials first, then with the credentials found by brute force.
+func (p *OptimizedProcessor) fetchONVIFSnapshot(ctx context.Context, result *HostResult) {
+	user, pass, _ := strings.Cut(result.Credentials, ":")
+	if c := result.ONVIFCred; c.Username != "" {
+		user, pass = c.Username, c.Password
+	}
+	uris, err := probe.ProbeONVIFSnapshotURIs(ctx, result.ONVIFDevice.URL, "", "")
+	if errors.Is(err, probe.ErrONVIFUnauthorized) && user != "" {
+		uris, err = probe.ProbeONVIFSnapshotURIs(ctx, result.ONVIFDevice.URL, user, pass)
+	}
+	if err != nil {
+		if p.debug {
+			log.Printf("DEBUG: %s: ONVIF snapshot URI lookup failed: %v", result.Host, err)
+		}
+		return
+	}
+	result.SnapshotURIs = uris
+
+	dir := filepath.Join(p.outputDir, "snapshots")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		log.Printf("WARNING: %s: %v", result.Host, err)
+		return
+	}
+	for _, s := range uris {
+		name := streams.SnapshotName(result.Host, s.Profile)
+		if _, err := streams.FetchSnapshot(ctx, s.URI, user, pass, filepath.Join(dir, name)); err != nil {
+			if p.debug {
+				log.Printf("DEBUG: %s: %v", result.Host, err)
+			}
+			continue
+		}
+		result.ONVIFSnapshot = filepath.ToSlash(filepath.Join("snapshots", name))
+		return
+	}
+}
+
+// Confidence of brands from sources that name the vendor outright rather than
+// hint at it; HTTP heuristics are scored by fingerprint.DetectCandidates
+const (
+	confidenceDevice   = 0.95 // ONVIF GetDeviceInformation, SADP
+	confidenceProtocol = 0.9  // SNMP, ISAPI namespaces, mDNS _axis-video
+	confidenceMAC      = 0.85 // Vendor OUI; OEM hardware carries the maker's OUI
+	confidenceRedirect = 0.8  // Brand specific login path
+	confidenceCert     = 0.8  // Vendor named by or default certificate of the firmware
+	confidenceNuclei   = 0.75
+	confidenceScopes   = 0.7 // ONVIF WS-Discovery scopes
+	confidenceSDP      = 0.7 // Vendor specific session description of an open stream
+	confidenceTLS      = 0.6 // TLS stack fingerprint; firmware built on one SDK shares it
+	confidenceStack    = 0.6 // Header order or error page of the firmware's web server
+)
+
+// lowConfidence marks brands the report flags as guesses
+const lowConfidence = 0.5
+
+// brandSettled reports whether the brand is specific and at least as certain as a
+// source of the given confidence. Unscored brands count as settled.
+func brandSettled(result *HostResult, confidence float64) bool {
+	if result.Brand == "" || result.Brand == "Unknown cam" {
+		return false
+	}
+	return result.BrandScore == 0 || result.BrandScore >= confidence
+}
+
+// setBrand records brand with the note and confidence of its source. Evidence of
+// the platform behind a white-label brand, such as SADP answering from an Annke
+// NVR, confirms the brand instead of replacing it.
+func setBrand(result *HostResult, brand, note string, confidence float64, why []fingerprint.Match) {
+	if brand != result.Brand && fingerprint.Platform(result.Brand) == brand {
+		if result.BrandNote != "" {
+			result.BrandNote += "; "
+		}
+		result.BrandNote += note + " (" + brand + " platform)"
+		result.BrandScore = max(result.BrandScore, confidence)
+		result.BrandWhy = append(result.BrandWhy, why...)
+		return
+	}
+	result.Brand, result.BrandNote, result.BrandScore, result.BrandWhy = brand, note, confidence, why
+}
+
+// applyCandidates scores the HTTP and RTSP evidence of every brand. The brand the
+// heuristics picked gets its score, or gives way to a candidate with stronger
+// evidence, so a keyword hit like "sd" in a script name can't pass for certainty.
+// Given methods, only evidence found that way counts.
+func applyCandidates(result *HostResult, methods ...string) {
+	result.Candidates = fingerprint.CandidatesFromPages(resultPages(result), result.RTSPInfo.Server, methods...)
+	if len(result.Candidates) == 0 {
+		return
+	}
+	top := result.Candidates[0]
+	current, ok := fingerprint.CandidateFor(result.Candidates, result.Brand)
+	switch {
+	case ok && current.Confidence >= top.Confidence:
+		result.BrandScore, result.BrandWhy = current.Confidence, current.Why
+	case result.Brand == "" || result.Brand == "Unknown cam" || ok:
+		setBrand(result, top.Brand, strings.Join(top.Evidence, ", "), top.Confidence, top.Why)
+	}
+}
+
+// applyPortBrand fingerprints the full page captured on every HTTP port and takes
+// the specific brand most ports agree on, unless a brand is already known. It
+// reports whether the brand changed.
+func applyPortBrand(result *HostResult) bool {
+	if result.Brand != "" && result.Brand != "Unknown cam" {
+		return false
+	}
+	brand, note := fingerprint.DetectFromPages(resultPages(result))
+	if brand == "" || brand == "Unknown cam" {
+		return false
+	}
+	result.Brand, result.BrandNote = brand, note
+	return true
+}
+
+// applyProbeCVEs adds the CVEs that probes confirmed or found likely, which the brand
+// CVE lists can't know: Devil's Ivy when the ONVIF service runs an affected (or
+// possibly affected) gSOAP release, the ISAPI auth bypass when it worked, those the
+// CVE checks confirmed or found possible, and those of matched nuclei templates
+func applyProbeCVEs(result *HostResult) {
+	for _, cve := range probeCVEs(result) {
+		if !slices.Contains(result.CVEs, cve) {
+			result.CVEs = append(result.CVEs, cve)
+		}
+	}
+}
+
+// probeCVEs returns the CVEs applyProbeCVEs adds
+func probeCVEs(result *HostResult) []string {
+	var found []string
+	switch result.GSOAP.DevilsIvy() {
+	case "vulnerable", "possible":
+		found = append(found, probe.DevilsIvyCVE)
+	}
+	if result.ISAPI.Bypass != "" {
+		found = append(found, probe.ISAPIBypassCVE)
+	}
+	for _, c := range result.CVEChecks {
+		if c.Status == probe.CVEConfirmed || c.Status == probe.CVEPossible {
+			found = append(found, c.CVE)
+		}
+	}
+	for _, m := range result.Nuclei {
+		found = append(found, m.CVEs...)
+	}
+	return found
+}
+
+// applyDeviceCVEs adds the CVEs of local feeds covering the device's brand, or its
+// platform, and its model and firmware, and drops the brand's CVEs of another
+// device class, such as camera-only ones on an NVR, unless a probe found them
+func applyDeviceCVEs(result *HostResult) {
+	if result.Brand == "" {
+		return
+	}
+	model, firmware := result.DeviceIdentity()
+	cves := cvedb.ForDevice(result.Brand, model, firmware)
+	if platform := fingerprint.Platform(result.Brand); platform != result.Brand {
+		cves = append(cves, cvedb.ForDevice(platform, model, firmware)...)
+	}
+	for _, cve := range cves {
+		if !slices.Contains(result.CVEs, cve) {
+			result.CVEs = append(result.CVEs, cve)
+		}
+	}
+	found := probeCVEs(result)
+	result.CVEs = slices.DeleteFunc(result.CVEs, func(cve string) bool {
+		return !slices.Contains(found, cve) && !fingerprint.CVEAffects(result.Brand, cve, result.Class)
+	})
+}
+
+// applyVulners adds the advisories Vulners lists for the firmware CPE of the
+// device, and the CVEs they name, which vendor bulletins know before the NVD
+func (p *OptimizedProcessor) applyVulners(ctx context.Context, result *HostResult) {
+	// A vendor's whole product line is no question for an audit
+	if _, firmware := result.DeviceIdentity(); firmware == "" {
+		return
+	}
+	cpes := hostCPEs(*result)
+	if len(cpes) == 0 {
+		return
+	}
+	advisories, err := p.vulners.Advisories(ctx, cpes[0])
+	if err != nil {
+		if p.debug {
+			log.Printf("DEBUG: %s: %v", result.Host, err)
+		}
+		return
+	}
+	result.Advisories = advisories
+	for _, a := range advisories {
+		ids := a.CVEs
+		if strings.HasPrefix(a.ID, "CVE-") {
+			ids = append([]string{a.ID}, ids...)
+		}
+		for _, cve := range ids {
+			if !slices.Contains(result.CVEs, cve) {
+				result.CVEs = append(result.CVEs, cve)
+			}
+		}
+	}
+}
+
+// applyModel picks the most specific model number: the brand's own endpoint
+// (ISAPI, VAPIX, CGI), ONVIF GetDeviceInformation, SADP, the WS-Discovery
+// hardware scope, and last the brand's model pattern in the page titles and
+// bodies. The product line follows from the model and brand.
+func applyModel(result *HostResult) {
+	type source struct{ model, note string }
+	sources := []source{
+		{result.DeviceDetails.Model, "device endpoint " + result.DeviceDetails.URL},
+		{result.ONVIFDevice.Model, "ONVIF GetDeviceInformation"},
+		{result.SADPDevice.Model, "SADP"},
+		{result.ONVIFInfo.Hardware, "WS-Discovery hardware scope"},
+	}
+	for _, port := range sortedPorts(result.HTTPMeta.Ports) {
+		pm := result.HTTPMeta.Ports[port]
+		sources = append(sources,
+			source{fingerprint.ExtractModel(result.Brand, pm.Title), fmt.Sprintf("HTTP port %d title", port)},
+			source{fingerprint.ExtractModel(result.Brand, pm.Body), fmt.Sprintf("HTTP port %d page", port)},
+		)
+	}
+	for _, s := range sources {
+		if model := strings.TrimSpace(s.model); model != "" {
+			result.Model, result.ModelNote = model, strings.TrimSpace(s.note)
+			result.ModelLine = fingerprint.LineOf(result.Brand, model)
+			return
+		}
+	}
+}
+
+// applyFirmware picks the firmware version the way applyModel picks the model: the
+// brand's own endpoint, ONVIF and SADP report it exactly, and only without them is
+// the brand's version pattern tried on the Server headers, titles and pages, in
+// that order, as page text also carries versions of scripts and plugins
+func applyFirmware(result *HostResult) {
+	type source struct{ version, note string }
+	sources := []source{
+		{result.DeviceDetails.Firmware, "device endpoint " + result.DeviceDetails.URL},
+		{result.ONVIFDevice.FirmwareVersion, "ONVIF GetDeviceInformation"},
+		{result.SADPDevice.FirmwareVersion, "SADP"},
+	}
+	ports := sortedPorts(result.HTTPMeta.Ports)
+	for _, field := range []string{"Server header", "title", "page"} {
+		for _, port := range ports {
+			pm := result.HTTPMeta.Ports[port]
+			text := map[string]string{"Server header": pm.Server, "title": pm.Title, "page": pm.Body}[field]
+			sources = append(sources, source{fingerprint.ExtractVersion(result.Brand, text), fmt.Sprintf("HTTP port %d %s", port, field)})
+		}
+	}
+	for _, s := range sources {
+		if version := strings.TrimSpace(s.version); version != "" {
+			result.Firmware, result.FirmwareNote = version, strings.TrimSpace(s.note)
+			return
+		}
+	}
+}
+
+// applySerial picks the serial number from the brand's own endpoint, ONVIF or
+// SADP, and else from a serial or device ID the web pages assign in their scripts
+func applySerial(result *HostResult) {
+	type source struct{ serial, note string }
+	sources := []source{
+		{result.DeviceDetails.Serial, "device endpoint " + result.DeviceDetails.URL},
+		{result.ONVIFDevice.SerialNumber, "ONVIF GetDeviceInformation"},
+		{result.SADPDevice.SerialNumber, "SADP"},
+	}
+	for _, port := range sortedPorts(result.HTTPMeta.Ports) {
+		sources = append(sources, source{fingerprint.ExtractSerial(result.HTTPMeta.Ports[port].Body), fmt.Sprintf("HTTP port %d page", port)})
+	}
+	for _, s := range sources {
+		if serial := strings.TrimSpace(s.serial); serial != "" {
+			result.Serial, result.SerialNote = serial, strings.TrimSpace(s.note)
+			return
+		}
+	}
+}
+
+// applyLocale records the language of the first web page that reveals one
+func applyLocale(result *HostResult) {
+	for _, port := range sortedPorts(result.HTTPMeta.Ports) {
+		pm := result.HTTPMeta.Ports[port]
+		if locale, evidence := fingerprint.DetectLocale(pm.Language, pm.ContentType, pm.Body); locale != "" {
+			result.Locale, result.LocaleNote = locale, fmt.Sprintf("HTTP port %d %s", port, evidence)
+			return
+		}
+	}
+}
+
+// applySoC records the SoC family named first by the service banners, the web
+// servers and pages, or else the port of an SDK daemon
+func applySoC(result *HostResult) {
+	type source struct{ text, note string }
+	var sources []source
+	for _, port := range sortedPorts(result.Telnet) {
+		sources = append(sources, source{result.Telnet[port], fmt.Sprintf("telnet port %d banner", port)})
+	}
+	sources = append(sources,
+		source{result.SSH.Banner, "SSH banner"},
+		source{result.FTP.Banner, "FTP banner"},
+		source{result.SNMP.SysDescr, "SNMP sysDescr"},
+		source{result.RTSPInfo.Server, "RTSP server"},
+		source{result.SIP.Server, "SIP server"},
+		source{result.ONVIFDevice.HardwareID, "ONVIF hardware ID"},
+	)
+	for _, port := range sortedPorts(result.HTTPMeta.Ports) {
+		pm := result.HTTPMeta.Ports[port]
+		sources = append(sources,
+			source{pm.Server, fmt.Sprintf("HTTP port %d Server header", port)},
+			source{pm.Body, fmt.Sprintf("HTTP port %d page", port)},
+		)
+	}
+	for _, s := range sources {
+		if soc, evidence := fingerprint.DetectSoC(s.text); soc != "" {
+			result.SoC, result.SoCNote = soc, fmt.Sprintf("%s %q", s.note, evidence)
+			return
+		}
+	}
+	if soc, port := fingerprint.DetectSoCFromPorts(result.Ports); soc != "" {
+		result.SoC, result.SoCNote = soc, fmt.Sprintf("port %d open", port)
+	}
+}
+
+// applyClass records the device class named first by what the device says it is
+// (device type, model line, GB28181 code, ONVIF), then by the page titles and
+// Server headers, VMS names in the pages and VMS ports. ONVIF transmitters are
+// taken for cameras last, since recorders and encoders announce that type too.
+func applyClass(result *HostResult) {
+	type source struct{ text, note string }
+	sources := []source{
+		{result.DeviceDetails.DeviceType, "device type"},
+		{result.ModelLine, "model line"},
+	}
+	for _, id := range result.SIP.DeviceIDs {
+		sources = append(sources, source{probe.GB28181DeviceType(id), "GB28181 code " + id})
+	}
+	if class := fingerprint.ClassFromONVIFTypes(result.ONVIFInfo.Types); class == fingerprint.ClassRecorder {
+		result.Class, result.ClassNote = class, "WS-Discovery type NetworkVideoStorage"
+		return
+	}
+	sources = append(sources,
+		source{result.ONVIFDevice.Model, "ONVIF model"},
+		source{result.ONVIFInfo.Hardware, "WS-Discovery hardware scope"},
+		source{result.Model, "model"},
+	)
+	for _, port := range sortedPorts(result.HTTPMeta.Ports) {
+		pm := result.HTTPMeta.Ports[port]
+		sources = append(sources,
+			source{pm.Title, fmt.Sprintf("HTTP port %d title", port)},
+			source{pm.Server, fmt.Sprintf("HTTP port %d Server header", port)},
+		)
+	}
+	for _, s := range sources {
+		if class, evidence := fingerprint.ClassFromText(s.text); class != "" {
+			result.Class, result.ClassNote = class, fmt.Sprintf("%s %q", s.note, evidence)
+			return
+		}
+	}
+	// Pages mention recorders and cameras in menus and help text; only VMS product
+	// names are specific enough
+	for _, port := range sortedPorts(result.HTTPMeta.Ports) {
+		if class, evidence := fingerprint.ClassFromText(result.HTTPMeta.Ports[port].Body); class == fingerprint.ClassVMS {
+			result.Class, result.ClassNote = class, fmt.Sprintf("HTTP port %d page %q", port, evidence)
+			return
+		}
+	}
+	if class, port := fingerprint.ClassFromPorts(result.Ports); class != "" {
+		result.Class, result.ClassNote = class, fmt.Sprintf("port %d open", port)
+		return
+	}
+	if fingerprint.ClassFromONVIFTypes(result.ONVIFInfo.Types) == fingerprint.ClassCamera {
+		result.Class, result.ClassNote = fingerprint.ClassCamera, "WS-Discovery type NetworkVideoTransmitter"
+	}
+}
+
 // PrintResults prints the results in a formatted way
 func (p *OptimizedProcessor) PrintResults(results []HostResult) {
 	for _, result := range results {
 		fmt.Printf("\n=== Processing %s ===\n", result.Host)
+		if len(result.Hostnames) > 0 {
+			fmt.Printf("Hostname: %s\n", strings.Join(result.Hostnames, ", "))
+		}
+		if result.MAC != "" {
+			fmt.Printf("MAC: %s", result.MAC)
+			if vendor := fingerprint.DetectFromMAC(result.MAC); vendor != "" {
+				fmt.Printf(" (%s)", vendor)
+			}
+			fmt.Println()
+		}
+		if result.Partial {
+			fmt.Printf("⚠ Partial results: %v\n", result.Error)
+		}
+		if len(result.Honeypot) > 0 {
+			fmt.Printf("⚠ Likely honeypot: %s\n", strings.Join(result.Honeypot, "; "))
+		}
 		fmt.Printf("Open ports: %v\n", result.Ports)
+		if len(result.FilteredPorts) > 0 {
+			fmt.Printf("Filtered ports: %v\n", result.FilteredPorts)
+		}
+		if len(result.ClosedPorts) > 0 {
+			fmt.Printf("Closed ports: %v\n", result.ClosedPorts)
+		}
+		if len(result.SCTPPorts) > 0 {
+			fmt.Printf("SCTP ports: %v\n", result.SCTPPorts)
+		}
 		fmt.Printf("HTTP ports: %v\n", result.HTTPPorts)
 		fmt.Printf("RTSP ports: %v\n", result.RTSPPorts)
 
@@ -150,9 +1126,67 @@ func (p *OptimizedProcessor) PrintResults(results []HostResult) {
 			}
 		}
 
+		// Page titles per port, and servers that differ from the first one
+		for _, port := range sortedPorts(result.HTTPMeta.Ports) {
+			pm := result.HTTPMeta.Ports[port]
+			if pm.Server != "" && pm.Server != result.HTTPMeta.Server {
+				fmt.Printf("HTTP Server (%d): %s\n", port, pm.Server)
+			}
+			if pm.Title != "" {
+				fmt.Printf("HTTP title (%d): %s\n", port, pm.Title)
+			}
+			if len(pm.Redirects) > 0 {
+				fmt.Printf("HTTP redirects (%d): / -> %s\n", port, strings.Join(pm.Redirects, " -> "))
+			}
+		}
+
+		for _, port := range sortedPorts(result.TLSCerts) {
+			c := result.TLSCerts[port]
+			fmt.Printf("TLS certificate (%d): %s", port, c.Subject)
+			if c.SelfSigned {
+				fmt.Print(" [self-signed]")
+			} else {
+				fmt.Printf(" [issuer %s]", c.Issuer)
+			}
+			fmt.Println()
+			if p.debug {
+				log.Printf("DEBUG: TLS %d SHA-256 %s, expires %s", port, c.SHA256, c.NotAfter.Format(time.DateOnly))
+			}
+		}
+		for _, port := range sortedPorts(result.HTTPStacks) {
+			s := result.HTTPStacks[port]
+			fmt.Printf("HTTP fingerprint (%d): %d [%s]", port, s.Status, s.Order())
+			if s.Title != "" {
+				fmt.Printf(" %s", s.Title)
+			}
+			fmt.Println()
+		}
+		for _, port := range sortedPorts(result.ServerHellos) {
+			h := result.ServerHellos[port]
+			fmt.Printf("TLS fingerprint (%d): JA4S %s, JA3S %s (%s, %s)\n", port, h.JA4S, h.JA3S, tls.VersionName(h.Version), tls.CipherSuiteName(h.Cipher))
+			if p.debug {
+				log.Printf("DEBUG: TLS %d JA3S string %s", port, h.JA3SRaw)
+			}
+		}
+
+		for _, f := range result.Notes {
+			fmt.Printf("HTTP exposure: %s\n", f)
+		}
+
 		// Login pages
 		if len(result.LoginPages) > 0 {
 			fmt.Printf("Login pages: %v\n", result.LoginPages)
+			for _, l := range result.LoginStatus {
+				fmt.Printf("  %s: %d %s\n", l.URL, l.Status, l.ContentType)
+			}
+			for _, u := range result.LoginPages {
+				if c, ok := result.LoginAuth[u]; ok {
+					fmt.Printf("  %s requires %s\n", u, c)
+				}
+				if shot, ok := result.Screenshots[u]; ok {
+					fmt.Printf("  %s screenshot: %s\n", u, shot)
+				}
+			}
 		}
 
 		// RTSP info
@@ -160,6 +1194,32 @@ func (p *OptimizedProcessor) PrintResults(results []HostResult) {
 			fmt.Printf("RTSP Server: %s\n", result.RTSPInfo.Server)
 			fmt.Printf("RTSP Public: %s\n", result.RTSPInfo.Public)
 		}
+		if len(result.RTSPStreams) > 0 {
+			fmt.Println("‼ OPEN RTSP streams (no authentication required):")
+			for _, s := range result.RTSPStreams {
+				fmt.Printf("  %s", s.URL)
+				if media := s.Media.String(); media != "" {
+					fmt.Printf(" (%s)", media)
+				}
+				if s.Viewable {
+					fmt.Print(" [viewable: RTP received]")
+				} else if s.Checked {
+					fmt.Print(" [advertised only: no RTP after PLAY]")
+				}
+				fmt.Println()
+			}
+		}
+		for _, port := range sortedPorts(result.RTSPAuth) {
+			c := result.RTSPAuth[port]
+			fmt.Printf("RTSP auth (%d): %s\n", port, c)
+			if p.debug && c.Nonce != "" {
+				log.Printf("DEBUG: RTSP %d nonce=%q algorithm=%q", port, c.Nonce, c.Algorithm)
+			}
+		}
+
+		if result.Class != "" {
+			fmt.Printf("Class: %s (%s)\n", result.Class, result.ClassNote)
+		}
 
 		// Brand detection
 		if result.Brand != "" {
@@ -167,19 +1227,91 @@ func (p *OptimizedProcessor) PrintResults(results []HostResult) {
 			if result.BrandNote != "" {
 				fmt.Printf(" (%s)", result.BrandNote)
 			}
+			if result.BrandScore > 0 {
+				fmt.Printf(" [confidence %.2f]", result.BrandScore)
+			}
+			if fingerprint.IsOEM(result.Brand) {
+				fmt.Printf(" [%s platform]", fingerprint.Platform(result.Brand))
+			}
 			fmt.Println()
+			if result.Model != "" {
+				fmt.Printf("Model: %s", result.Model)
+				if result.ModelLine != "" {
+					fmt.Printf(", %s", result.ModelLine)
+				}
+				fmt.Printf(" (%s)\n", result.ModelNote)
+			}
+			if result.Firmware != "" {
+				fmt.Printf("Firmware: %s (%s)\n", result.Firmware, result.FirmwareNote)
+			}
+			if result.Serial != "" {
+				fmt.Printf("Serial: %s (%s)\n", result.Serial, result.SerialNote)
+			}
+			if result.Locale != "" {
+				fmt.Printf("Web UI language: %s (%s)\n", result.Locale, result.LocaleNote)
+			}
+			if result.SoC != "" {
+				fmt.Printf("SoC: %s (%s)\n", result.SoC, result.SoCNote)
+				if risk := fingerprint.SoCRisk(result.SoC); risk != "" {
+					fmt.Printf("⚠ %s\n", risk)
+				}
+			}
+			if len(result.Candidates) > 1 {
+				fmt.Println("Brand candidates:")
+				for _, c := range result.Candidates {
+					fmt.Printf("  %s\n", c)
+				}
+			}
 
 			// CVEs
 			if len(result.CVEs) > 0 {
-				fmt.Printf("Known CVEs: %v\n", result.CVEs)
+				fmt.Printf("Known CVEs: %v\n", cveLabels(result.CVEs))
 				fmt.Printf("CVE Links: %v\n", fingerprint.OptimizedCVELinks(result.CVEs))
+				for _, cve := range result.CVEs {
+					if k, ok := cvedb.KEV(cve); ok {
+						fmt.Printf("‼ Known exploited: %s %s (CISA KEV since %s)\n", cve, k.Name, k.DateAdded)
+					}
+					if x := cvedb.ExploitsFor(cve); !x.Empty() {
+						refs := slices.Clone(x.Metasploit)
+						for _, id := range x.ExploitDB {
+							refs = append(refs, "EDB-"+id)
+						}
+						fmt.Printf("Public exploit for %s: %s\n", cve, strings.Join(refs, ", "))
+					}
+				}
+			}
+			for _, c := range result.CVEChecks {
+				mark := "✓"
+				if c.Status == probe.CVEConfirmed {
+					mark = "‼"
+				}
+				where := ""
+				if c.URL != "" {
+					where = " (" + c.URL + ")"
+				}
+				fmt.Printf("%s CVE check %s: %s, %s%s\n", mark, c.CVE, c.Status, c.Evidence, where)
+			}
+			if e, ok := result.EndOfLife(); ok {
+				fmt.Printf("‼ Unsupported device: %s %s\n", result.Brand, e)
 			}
 		}
 
 		// Credentials
-		if result.Credentials != "" {
-			fmt.Printf("✓ Default credentials found: %s\n", result.Credentials)
-		} else if len(result.LoginPages) > 0 {
+		for _, l := range result.Logins {
+			fmt.Printf("✓ Default credentials found: %s (%s) at %s\n", l.Credential, l.Auth, l.URL)
+			if l.Proof != "" {
+				fmt.Printf("  Verified: %s\n", l.Proof)
+			}
+		}
+		if result.Lockout != "" {
+			fmt.Printf("⚠ Credential testing stopped: %s\n", result.Lockout)
+		}
+		for _, c := range result.CredsRefused {
+			fmt.Printf("⚠ Login page took %s but the device information endpoint refused it\n", c)
+		}
+		if c := result.ONVIFCred; c.Username != "" {
+			fmt.Printf("✓ ONVIF default credentials found: %s:%s at %s (%s)\n", c.Username, c.Password, c.URL, strings.Join(c.Operations, ", "))
+		} else if len(result.LoginPages) > 0 && result.Credentials == "" {
 			fmt.Println("✗ No default credentials found")
 		}
 
@@ -187,24 +1319,279 @@ func (p *OptimizedProcessor) PrintResults(results []HostResult) {
 		if len(result.HTTPPorts) > 0 {
 			fmt.Println("Checking for MJPEG streams...")
 		}
+		if len(result.HLSStreams) > 0 {
+			fmt.Println("HLS streams:")
+			for _, u := range result.HLSStreams {
+				fmt.Printf("  %s\n", u)
+			}
+		}
 
 		// ONVIF
-		if result.ONVIFResult != "" {
-			fmt.Printf("ONVIF: %s\n", result.ONVIFResult)
+		if result.ONVIFInfo.Answered {
+			fmt.Printf("ONVIF: %s\n", result.ONVIFInfo)
+		}
+		for _, s := range result.ONVIFServices {
+			fmt.Printf("ONVIF device service: %s", s.URL)
+			if !s.DeviceTime.IsZero() {
+				fmt.Printf(" (clock %s, skew %s)", s.DeviceTime.Format(time.RFC3339), s.ClockSkew)
+			}
+			fmt.Println()
+		}
+		if i := result.ISAPI; i.Found() {
+			fmt.Printf("ISAPI at %s:", i.Base)
+			for _, e := range i.Endpoints {
+				fmt.Printf(" %s=%d", e.Path, e.Status)
+			}
+			fmt.Println()
+			if open := i.OpenEndpoints(); len(open) > 0 {
+				fmt.Printf("‼ ISAPI without credentials: %s\n", strings.Join(open, ", "))
+			}
+			if i.Bypass != "" {
+				fmt.Printf("‼ %s auth bypass: snapshot served at %s\n", probe.ISAPIBypassCVE, i.Bypass)
+			}
+		}
+		if g := result.GSOAP; g.Found() {
+			fmt.Printf("gSOAP %s at %s (%s), Devil's Ivy %s: %s\n", g.Version, g.URL, g.Evidence, probe.DevilsIvyCVE, g.DevilsIvy())
+		}
+		for _, m := range result.Nuclei {
+			mark := ""
+			if m.Severity == "high" || m.Severity == "critical" {
+				mark = "‼ "
+			}
+			fmt.Printf("%sNuclei %s\n", mark, m)
+		}
+		if d := result.ONVIFDevice; d.Found() {
+			fmt.Printf("ONVIF device: %s %s (firmware %s, serial %s, hardware %s) via %s",
+				d.Manufacturer, d.Model, d.FirmwareVersion, d.SerialNumber, d.HardwareID, d.URL)
+			if d.Authenticated {
+				fmt.Print(" [authenticated]")
+			}
+			fmt.Println()
+		}
+		for _, s := range result.SnapshotURIs {
+			fmt.Printf("ONVIF snapshot URI (%s): %s\n", s.Profile, s.URI)
+		}
+		if result.ONVIFSnapshot != "" {
+			fmt.Printf("ONVIF snapshot saved: %s\n", result.ONVIFSnapshot)
+		}
+		if d := result.DeviceDetails; d.Found() {
+			fmt.Printf("Device info: %s (firmware %s, serial %s", d.Model, d.Firmware, d.Serial)
+			if d.MAC != "" {
+				fmt.Printf(", MAC %s", d.MAC)
+			}
+			fmt.Printf(") via %s", d.URL)
+			if d.Authenticated {
+				fmt.Print(" [authenticated]")
+			}
+			fmt.Println()
+		}
+		for _, port := range sortedPorts(result.Latency) {
+			l := result.Latency[port]
+			if !l.Up() {
+				fmt.Printf("Latency (%d): no answer to %d connects\n", port, l.Attempts)
+				continue
+			}
+			fmt.Printf("Latency (%d): connect %s", port, l.Connect.Round(time.Millisecond))
+			if l.TTFB > 0 {
+				fmt.Printf(", TTFB %s", l.TTFB.Round(time.Millisecond))
+			}
+			if l.Flaky() {
+				fmt.Printf(" [flaky: %d/%d connects failed]", l.Failures, l.Attempts)
+			}
+			fmt.Println()
+		}
+		for _, i := range result.P2P {
+			fmt.Printf("P2P cloud: %s\n", i)
+		}
+		for _, f := range result.ProbeFindings {
+			fmt.Printf("Probe %s\n", f)
+		}
+		if s := result.SNMP; s.Found() {
+			fmt.Printf("‼ SNMP answers community %q: %s (sysName %s, sysObjectID %s)\n",
+				s.Community, s.SysDescr, s.SysName, s.SysObjectID)
+		}
+		for _, port := range sortedPorts(result.Telnet) {
+			fmt.Printf("Telnet banner (%d):\n", port)
+			for _, line := range strings.Split(result.Telnet[port], "\n") {
+				fmt.Printf("  %s\n", line)
+			}
+		}
+		if s := result.SSH; s.Found() {
+			fmt.Printf("SSH (%d): %s", s.Port, s.Banner)
+			if s.Fingerprint != "" {
+				fmt.Printf(" [%s %s]", s.HostKeyType, s.Fingerprint)
+			}
+			fmt.Println()
+		}
+		if f := result.FTP; f.Found() {
+			fmt.Printf("FTP (%d): %s\n", f.Port, f.Banner)
+			if f.Anonymous {
+				fmt.Println("‼ FTP allows anonymous login")
+			}
+		}
+		if s := result.SIP; s.Found() {
+			fmt.Printf("SIP (%s/%d): %s", s.Transport, s.Port, s.Status)
+			if s.Server != "" {
+				fmt.Printf(" [%s]", s.Server)
+			}
+			fmt.Println()
+			if s.GB28181 {
+				fmt.Printf("GB28181 endpoint, realm %q\n", s.Realm)
+			}
+			for _, id := range s.DeviceIDs {
+				fmt.Printf("  GB28181 device %s (%s)\n", id, probe.GB28181DeviceType(id))
+			}
+		}
+		for _, svc := range result.MDNSServices {
+			fmt.Printf("mDNS: %s (%s, %s:%d)\n", svc.Instance, svc.Service, svc.Host, svc.Port)
+		}
+		if d := result.SADPDevice; d.Found() {
+			fmt.Printf("SADP: %s %s (firmware %s, serial %s, MAC %s)\n",
+				d.DeviceType, d.Model, d.FirmwareVersion, d.SerialNumber, d.MAC)
+			if d.ActivationKnown && !d.Activated {
+				fmt.Println("‼ Device is NOT activated: anyone on the LAN can set the admin password")
+			}
 		}
 
 		fmt.Println()
 	}
 }
 
+// DeviceIdentity returns the most specific model and firmware found: the brand's
+// own endpoint, then ONVIF, then SADP, then the model and firmware from discovery
+// scopes and web pages
+func (r HostResult) DeviceIdentity() (model, firmware string) {
+	model, firmware = r.DeviceDetails.Model, r.DeviceDetails.Firmware
+	if model == "" {
+		model, firmware = r.ONVIFDevice.Model, r.ONVIFDevice.FirmwareVersion
+	}
+	if model == "" {
+		model, firmware = r.SADPDevice.Model, r.SADPDevice.FirmwareVersion
+	}
+	if model == "" {
+		model = r.Model
+	}
+	if firmware == "" {
+		firmware = r.Firmware
+	}
+	return model, firmware
+}
+
+// EndOfLife returns the EoL entry covering the device's model or firmware line
+func (r HostResult) EndOfLife() (eol.Entry, bool) {
+	model, firmware := r.DeviceIdentity()
+	return eol.Lookup(r.Brand, model, firmware)
+}
+
+// MeanConnect is the mean TCP connect time over the ports that answered; ok is false
+// when none did
+func (r HostResult) MeanConnect() (mean time.Duration, ok bool) {
+	var total time.Duration
+	n := 0
+	for _, l := range r.Latency {
+		if l.Up() {
+			total += l.Connect
+			n++
+		}
+	}
+	if n == 0 {
+		return 0, false
+	}
+	return total / time.Duration(n), true
+}
+
+// SortByLatency orders results from the most to the least responsive host; hosts
+// without a measurement go last
+func SortByLatency(results []HostResult) {
+	sort.SliceStable(results, func(i, j int) bool {
+		a, aok := results[i].MeanConnect()
+		b, bok := results[j].MeanConnect()
+		if aok != bok {
+			return aok
+		}
+		return a < b
+	})
+}
+
+// MaxEPSS returns the highest EPSS score of the host's CVEs, false when none is
+// scored
+func (r HostResult) MaxEPSS() (float64, bool) {
+	highest, ok := 0.0, false
+	for _, cve := range r.CVEs {
+		if e, found := cvedb.EPSSFor(cve); found {
+			highest, ok = max(highest, e.Score), true
+		}
+	}
+	return highest, ok
+}
+
+// SortByEPSS orders results from the host whose CVEs are the most likely to be
+// exploited to the least; hosts without a scored CVE go last
+func SortByEPSS(results []HostResult) {
+	sort.SliceStable(results, func(i, j int) bool {
+		a, aok := results[i].MaxEPSS()
+		b, bok := results[j].MaxEPSS()
+		if aok != bok {
+			return aok
+		}
+		return a > b
+	})
+}
+
+// FilterEPSS drops the CVEs whose EPSS score is below threshold; CVEs without a
+// score are kept, nothing is known about them
+func FilterEPSS(results []HostResult, threshold float64) {
+	for i := range results {
+		results[i].CVEs = slices.DeleteFunc(results[i].CVEs, func(cve string) bool {
+			e, ok := cvedb.EPSSFor(cve)
+			return ok && e.Score < threshold
+		})
+	}
+}
+
+// FilterSeverity drops the CVEs rated below minimum, e.g. HIGH. CVEs in the KEV
+// catalog count as CRITICAL; those without a score are dropped, since monitoring
+// asking for a minimum wants no noise.
+func FilterSeverity(results []HostResult, minimum string) {
+	rank := cvedb.SeverityRank(minimum)
+	for i := range results {
+		results[i].CVEs = slices.DeleteFunc(results[i].CVEs, func(cve string) bool {
+			if _, ok := cvedb.KEV(cve); ok {
+				return false
+			}
+			e, _ := cvedb.Lookup(cve)
+			return cvedb.SeverityRank(e.Severity) < rank
+		})
+	}
+}
+
+// HasFindings reports whether any host has a CVE or working default credentials
+func HasFindings(results []HostResult) bool {
+	return slices.ContainsFunc(results, func(r HostResult) bool { return len(r.CVEs) > 0 || r.Credentials != "" || r.ONVIFCred.Username != "" })
+}
+
+// sortedPorts returns the keys of a per-port map in ascending order
+func sortedPorts[V any](m map[int]V) []int {
+	ports := make([]int, 0, len(m))
+	for port := range m {
+		ports = append(ports, port)
+	}
+	sort.Ints(ports)
+	return ports
+}
+
 // GetPerformanceStats returns performance statistics
 func GetPerformanceStats() map[string]interface{} {
 	stats := make(map[string]interface{})
 
 	// Brand cache stats
-	totalEntries, cveEntries := fingerprint.GetCacheStats()
-	stats["brand_cache_entries"] = totalEntries
-	stats["cve_cache_entries"] = cveEntries
+	cache := fingerprint.GetCacheStats()
+	stats["brand_cache_entries"] = cache.Entries
+	stats["brand_cache_capacity"] = cache.Capacity
+	stats["brand_cache_hits"] = cache.Hits
+	stats["brand_cache_misses"] = cache.Misses
+	stats["brand_cache_evictions"] = cache.Evictions
+	stats["cve_cache_entries"] = cache.CVEEntries
 
 	return stats
 }
@@ -0,0 +1,798 @@
+package processor
+
+import (
+	"context"
+	"io"
+	"maps"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/postfix/cctvscan/internal/credbrute"
+	"github.com/postfix/cctvscan/internal/cvedb"
+	"github.com/postfix/cctvscan/internal/fingerprint"
+	"github.com/postfix/cctvscan/internal/nuclei"
+	"github.com/postfix/cctvscan/internal/probe"
+)
+
+func TestAttachPortStates(t *testing.T) {
+	results := []HostResult{{Host: "192.0.2.1", Ports: []int{80}}}
+	closed := map[string][]int{"192.0.2.1": {8080}}
+	filtered := map[string][]int{"192.0.2.1": {554}, "192.0.2.2": {80, 443}}
+
+	results = AttachPortStates(results, closed, filtered)
+	if len(results) != 2 {
+		t.Fatalf("want 2 results, got %d", len(results))
+	}
+	if len(results[0].ClosedPorts) != 1 || len(results[0].FilteredPorts) != 1 {
+		t.Errorf("states not attached to existing host: %+v", results[0])
+	}
+	if results[1].Host != "192.0.2.2" || len(results[1].Ports) != 0 || len(results[1].FilteredPorts) != 2 {
+		t.Errorf("filtered-only host not added: %+v", results[1])
+	}
+}
+
+func TestProcessHostTimeout(t *testing.T) {
+	// A tar pit accepts connections and never answers
+	tarpit, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("cannot listen: %v", err)
+	}
+	defer tarpit.Close()
+	go func() {
+		for {
+			conn, err := tarpit.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+	port := tarpit.Addr().(*net.TCPAddr).Port
+
+	// The background snapshot grabber may still be writing when the test ends,
+	// so clean up without failing the test the way t.TempDir would
+	outputDir, err := os.MkdirTemp("", "cctvscan-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(outputDir)
+
+	proc := NewOptimizedProcessor(false, "", outputDir)
+	proc.SetHostTimeout(200 * time.Millisecond)
+
+	start := time.Now()
+	result := proc.processHost(context.Background(), "127.0.0.1", []int{port})
+	if !result.Partial || result.Error == nil {
+		t.Errorf("processHost() on a tar pit should be partial, got %+v", result)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("processHost() took %s despite a 200ms host timeout", elapsed)
+	}
+}
+
+func TestAttachSCTPPorts(t *testing.T) {
+	results := []HostResult{{Host: "192.0.2.1", Ports: []int{80}}}
+	sctp := map[string][]int{"192.0.2.1": {2905}, "192.0.2.3": {38412}}
+
+	results = AttachSCTPPorts(results, sctp)
+	if len(results) != 2 {
+		t.Fatalf("want 2 results, got %d", len(results))
+	}
+	if len(results[0].SCTPPorts) != 1 || results[0].SCTPPorts[0] != 2905 {
+		t.Errorf("SCTP ports not attached to existing host: %+v", results[0])
+	}
+	if results[1].Host != "192.0.2.3" || len(results[1].Ports) != 0 {
+		t.Errorf("SCTP-only host not added: %+v", results[1])
+	}
+}
+
+func TestApplyONVIFBrand(t *testing.T) {
+	result := HostResult{Brand: "Unknown cam"}
+	result.ONVIFDevice.Manufacturer = "HIKVISION"
+	result.ONVIFDevice.Model = "DS-2CD2042WD-I"
+
+	if !applyDetector(&result, onvifDetector) || result.Brand != "Hikvision" {
+		t.Errorf("onvifDetector brand = %q, expected Hikvision", result.Brand)
+	}
+
+	// A brand guessed from HTTP keywords gives way, and the conflict is noted
+	result = HostResult{Brand: "Axis", BrandNote: "axis"}
+	result.ONVIFDevice.Manufacturer = "HIKVISION"
+	result.ONVIFDevice.Model = "DS-2CD2042WD-I"
+	if !applyDetector(&result, onvifDetector) || result.Brand != "Hikvision" || result.BrandNote != "ONVIF: DS-2CD2042WD-I; HTTP suggested Axis (axis)" {
+		t.Errorf("onvifDetector over HTTP brand = %q (%q)", result.Brand, result.BrandNote)
+	}
+
+	// The platform of a white-label brand confirms it
+	result = HostResult{Brand: "Lorex", BrandNote: "lorex", BrandScore: 0.6}
+	result.ONVIFDevice.Manufacturer = "Dahua"
+	result.ONVIFDevice.Model = "LNB8005"
+	if !applyDetector(&result, onvifDetector) || result.Brand != "Lorex" || result.BrandNote != "lorex; ONVIF: LNB8005 (Dahua platform)" {
+		t.Errorf("onvifDetector over OEM brand = %q (%q)", result.Brand, result.BrandNote)
+	}
+
+	// Brands from device endpoints and placeholder manufacturers don't give way
+	result = HostResult{Brand: "Axis", BrandScore: confidenceDevice}
+	result.ONVIFDevice.Manufacturer = "HIKVISION"
+	if applyDetector(&result, onvifDetector) || result.Brand != "Axis" {
+		t.Errorf("onvifDetector overrode device brand, got %q", result.Brand)
+	}
+	result = HostResult{Brand: "Axis", BrandNote: "axis"}
+	result.ONVIFDevice.Manufacturer = "General"
+	if applyDetector(&result, onvifDetector) || result.Brand != "Axis" || result.BrandNote != "axis; ONVIF manufacturer General" {
+		t.Errorf("onvifDetector with placeholder manufacturer = %q (%q)", result.Brand, result.BrandNote)
+	}
+
+	if entries := ToReport([]HostResult{{Host: "192.0.2.1", ONVIFDevice: result.ONVIFDevice}}); entries[0].ONVIFDevice == nil {
+		t.Error("ToReport() dropped ONVIF device information")
+	}
+
+	// Without GetDeviceInformation the WS-Discovery scopes are used
+	result = HostResult{Brand: "Unknown cam", ONVIFInfo: probe.ONVIFInfo{Name: "Lobby", Hardware: "DS-2CD2042WD-I", XAddrs: []string{"http://192.0.2.1/onvif/device_service"}}}
+	if !applyDetector(&result, onvifDetector) || result.Brand != "Hikvision" || result.BrandNote != "ONVIF scopes: DS-2CD2042WD-I" {
+		t.Errorf("onvifDetector from scopes = %q (%q), expected Hikvision", result.Brand, result.BrandNote)
+	}
+	if entries := ToReport([]HostResult{result}); entries[0].ONVIFDiscovery == nil || entries[0].ONVIFDiscovery.Hardware != "DS-2CD2042WD-I" {
+		t.Errorf("ToReport() ONVIF discovery = %+v", entries[0].ONVIFDiscovery)
+	}
+}
+
+func TestApplyPortBrand(t *testing.T) {
+	result := HostResult{Brand: "Unknown cam"}
+	result.HTTPMeta.Ports = map[int]probe.PortMeta{
+		80:   {Server: "lighttpd", Body: "<html>redirect</html>"},
+		8080: {Body: strings.Repeat(" ", 4096) + "<script src=\"/doc/script/hikvision/login.js\"></script>"},
+	}
+
+	if !applyPortBrand(&result) || result.Brand != "Hikvision" || !strings.Contains(result.BrandNote, "8080") {
+		t.Errorf("applyPortBrand() = %q (%q), expected Hikvision from port 8080", result.Brand, result.BrandNote)
+	}
+
+	// A specific brand from the merged snippet is kept
+	result.Brand = "Axis"
+	if applyPortBrand(&result) || result.Brand != "Axis" {
+		t.Errorf("applyPortBrand() overrode snippet brand, got %q", result.Brand)
+	}
+}
+
+func TestApplyCandidates(t *testing.T) {
+	// Panasonic shares the keyword "network camera" with Vivotek, which names neither
+	result := HostResult{}
+	result.HTTPMeta.Ports = map[int]probe.PortMeta{80: {Body: "<title>Vivotek</title> network camera"}}
+	applyCandidates(&result)
+	if result.Brand != "Vivotek" || result.BrandScore < lowConfidence || len(result.Candidates) != 1 {
+		t.Errorf("applyCandidates() = %q %.2f, candidates %v, expected Vivotek with confidence", result.Brand, result.BrandScore, result.Candidates)
+	}
+
+	// A guess from two letter keywords is flagged and gives way to a login redirect
+	result = HostResult{}
+	result.HTTPMeta.Ports = map[int]probe.PortMeta{80: {Body: "<td>FD8169A</td><td>SD9364</td>"}}
+	applyPortBrand(&result)
+	applyCandidates(&result)
+	if result.Brand != "Vivotek" || result.BrandScore >= lowConfidence {
+		t.Fatalf("applyCandidates() = %q %.2f, expected a low confidence Vivotek", result.Brand, result.BrandScore)
+	}
+	entries := ToReport([]HostResult{result})
+	if !strings.Contains(strings.Join(entries[0].Notes, "\n"), "LOW CONFIDENCE: brand Vivotek") || entries[0].BrandConfidence != result.BrandScore {
+		t.Errorf("ToReport() confidence %.2f, notes %v", entries[0].BrandConfidence, entries[0].Notes)
+	}
+	result.HTTPMeta.Ports[80] = probe.PortMeta{Body: "<td>FD8169A</td><td>SD9364</td>", Redirects: []string{"/doc/page/login.asp"}}
+	if !applyDetector(&result, redirectDetector) || result.Brand != "Hikvision" || result.BrandScore != confidenceRedirect {
+		t.Errorf("redirectDetector = %q %.2f, expected Hikvision to replace the guess", result.Brand, result.BrandScore)
+	}
+	if why := ToReport([]HostResult{result})[0].BrandWhy; len(why) != 1 || why[0].Method != "redirect" || !strings.Contains(why[0].Text, "login.asp") {
+		t.Errorf("ToReport() brand why = %+v, expected the redirect", why)
+	}
+}
+
+func TestApplyMACBrand(t *testing.T) {
+	result := HostResult{Brand: "Vivotek", BrandScore: 0.13, MAC: "28:57:be:12:34:56"}
+	if !applyDetector(&result, macDetector) || result.Brand != "Hikvision" || result.BrandNote != "MAC OUI: 28:57:be:12:34:56" {
+		t.Errorf("macDetector = %q (%q), expected Hikvision over a weak guess", result.Brand, result.BrandNote)
+	}
+	if entries := ToReport([]HostResult{result}); entries[0].MACVendor != "Hikvision" {
+		t.Errorf("ToReport() MAC vendor = %q", entries[0].MACVendor)
+	}
+
+	// ONVIF device information is more certain than the OUI of an OEM board
+	result.ONVIFDevice.Manufacturer = "Dahua"
+	result.ONVIFDevice.Model = "LNB8005"
+	if !applyDetector(&result, onvifDetector) || result.Brand != "Dahua" {
+		t.Errorf("onvifDetector = %q, expected Dahua over the OUI", result.Brand)
+	}
+	if applyDetector(&result, macDetector) {
+		t.Errorf("macDetector replaced ONVIF device information")
+	}
+}
+
+func TestApplyModel(t *testing.T) {
+	result := HostResult{Brand: "Hikvision"}
+	result.HTTPMeta.Ports = map[int]probe.PortMeta{
+		8080: {Title: "DS-7608NI-K2"},
+		80:   {Title: "Web Service", Body: `<div id="model">DS-7732NI-I4</div>`},
+	}
+	applyModel(&result)
+	if result.Model != "DS-7732NI-I4" || result.ModelLine != "DS-77xx NVR" || result.ModelNote != "HTTP port 80 page" {
+		t.Errorf("applyModel() = %q, %q (%q), expected the lowest port's page", result.Model, result.ModelLine, result.ModelNote)
+	}
+
+	result.ONVIFDevice.Model = "DS-2CD2042WD-I"
+	applyModel(&result)
+	if result.Model != "DS-2CD2042WD-I" || result.ModelNote != "ONVIF GetDeviceInformation" {
+		t.Errorf("applyModel() = %q (%q), expected ONVIF over the web pages", result.Model, result.ModelNote)
+	}
+}
+
+func TestApplyFirmware(t *testing.T) {
+	result := HostResult{Brand: "Hikvision"}
+	result.HTTPMeta.Ports = map[int]probe.PortMeta{
+		80: {Server: "App-webs/", Body: "<script src=\"jquery-v1.12.4.js\"></script> Hikvision Web Service v4.1.2"},
+	}
+	applyFirmware(&result)
+	if result.Firmware != "4.1.2" || result.FirmwareNote != "HTTP port 80 page" {
+		t.Errorf("applyFirmware() = %q (%q), expected the brand's pattern on the page", result.Firmware, result.FirmwareNote)
+	}
+
+	result.DeviceDetails = probe.DeviceDetails{URL: "http://192.0.2.1:80/ISAPI/System/deviceInfo", Firmware: "V5.5.0"}
+	applyFirmware(&result)
+	if result.Firmware != "V5.5.0" || result.FirmwareNote != "device endpoint http://192.0.2.1:80/ISAPI/System/deviceInfo" {
+		t.Errorf("applyFirmware() = %q (%q), expected the device endpoint over the page", result.Firmware, result.FirmwareNote)
+	}
+}
+
+func TestRunDetectors(t *testing.T) {
+	p := NewOptimizedProcessor(false, "", "")
+	if err := p.SetSkippedDetectors([]string{"mac", "favicon"}); err == nil {
+		t.Error("SetSkippedDetectors() accepted an unknown detector")
+	}
+	if err := p.SetSkippedDetectors([]string{"mac"}); err != nil {
+		t.Fatalf("SetSkippedDetectors() error = %v", err)
+	}
+	result := HostResult{Brand: "Unknown cam", MAC: "28:57:be:12:34:56"}
+	if p.runDetectors(&result) || result.Brand != "Unknown cam" {
+		t.Errorf("runDetectors() = %q, expected the skipped MAC detector to leave the brand", result.Brand)
+	}
+
+	result.RTSPStreams = []probe.RTSPStream{{Media: probe.SDPInfo{Session: []string{"s=Media Server"}}}}
+	if !p.runDetectors(&result) || result.Brand != "Dahua" || result.BrandScore != confidenceSDP {
+		t.Errorf("runDetectors() = %q %.2f, expected Dahua from the SDP", result.Brand, result.BrandScore)
+	}
+}
+
+func TestApplyPageBrand(t *testing.T) {
+	page := HostResult{}
+	page.HTTPMeta.Ports = map[int]probe.PortMeta{80: {Server: "Hikvision-Webs", Body: "<title>AXIS</title>"}}
+	if found := headerDetector.Detect(&page); len(found) != 1 || found[0].Brand != "Hikvision" {
+		t.Errorf("headerDetector = %+v, expected Hikvision alone", found)
+	}
+
+	for _, tc := range []struct {
+		skip     []string
+		expected string
+	}{
+		{[]string{"header"}, "Axis"},
+		{[]string{"title", "body"}, "Hikvision"},
+		{[]string{"header", "title", "body"}, ""},
+	} {
+		p := NewOptimizedProcessor(false, "", "")
+		if err := p.SetSkippedDetectors(tc.skip); err != nil {
+			t.Fatalf("SetSkippedDetectors(%q) error = %v", tc.skip, err)
+		}
+		result := page
+		p.applyPageBrand(&result)
+		if result.Brand != tc.expected {
+			t.Errorf("applyPageBrand() skipping %q = %q (candidates %v), expected %q", tc.skip, result.Brand, result.Candidates, tc.expected)
+		}
+	}
+}
+
+func TestApplySerial(t *testing.T) {
+	result := HostResult{}
+	result.HTTPMeta.Ports = map[int]probe.PortMeta{80: {Body: `<script>var deviceSN = "6J0A1B2PAZ12345";</script>`}}
+	applySerial(&result)
+	if result.Serial != "6J0A1B2PAZ12345" || result.SerialNote != "HTTP port 80 page" {
+		t.Errorf("applySerial() = %q (%q), expected the serial from the page script", result.Serial, result.SerialNote)
+	}
+
+	result.ONVIFDevice.SerialNumber = "6J0A1B2PAZ00001"
+	applySerial(&result)
+	if result.Serial != "6J0A1B2PAZ00001" || result.SerialNote != "ONVIF GetDeviceInformation" {
+		t.Errorf("applySerial() = %q (%q), expected ONVIF over the page", result.Serial, result.SerialNote)
+	}
+	if entries := ToReport([]HostResult{result}); entries[0].Serial != "6J0A1B2PAZ00001" {
+		t.Errorf("ToReport() serial = %q", entries[0].Serial)
+	}
+}
+
+func TestApplySoC(t *testing.T) {
+	result := HostResult{Ports: []int{80, 9530}, Telnet: map[int]string{23: "Ingenic T31 ISVP\r\nlogin: "}}
+	result.HTTPMeta.Ports = map[int]probe.PortMeta{80: {Body: "var path = '/mnt/mtd/web';"}}
+	applySoC(&result)
+	if result.SoC != "Ingenic" || result.SoCNote != `telnet port 23 banner "Ingenic"` {
+		t.Errorf("applySoC() = %q (%s), expected the telnet banner first", result.SoC, result.SoCNote)
+	}
+
+	result.Telnet = nil
+	applySoC(&result)
+	entries := ToReport([]HostResult{result})
+	if result.SoC != "HiSilicon" || entries[0].SoC != "HiSilicon" || !slices.ContainsFunc(entries[0].Notes, func(n string) bool { return strings.HasPrefix(n, "SOC: HiSilicon") }) {
+		t.Errorf("applySoC() = %q (%s), notes %v, expected HiSilicon from the page and its risk noted", result.SoC, result.SoCNote, entries[0].Notes)
+	}
+}
+
+func TestApplyClass(t *testing.T) {
+	result := HostResult{Brand: "Hikvision", Model: "DS-7608NI-K2", ModelLine: "DS-76xx NVR"}
+	result.ONVIFInfo.Types = []string{"dn:NetworkVideoTransmitter"}
+	result.HTTPMeta.Ports = map[int]probe.PortMeta{80: {Title: "IP Camera"}}
+	applyClass(&result)
+	if result.Class != fingerprint.ClassRecorder || result.ClassNote != `model line "NVR"` {
+		t.Errorf("applyClass() = %q (%s), expected a recorder from the model line", result.Class, result.ClassNote)
+	}
+
+	// ONVIF transmitters are cameras only when nothing else tells
+	result = HostResult{Ports: []int{80, 7563}}
+	result.ONVIFInfo.Types = []string{"dn:NetworkVideoTransmitter"}
+	applyClass(&result)
+	if result.Class != fingerprint.ClassVMS {
+		t.Errorf("applyClass() = %q (%s), expected a VMS from the port", result.Class, result.ClassNote)
+	}
+	result.Ports = []int{80}
+	applyClass(&result)
+	if entries := ToReport([]HostResult{result}); result.Class != fingerprint.ClassCamera || entries[0].Class != fingerprint.ClassCamera {
+		t.Errorf("applyClass() = %q (%s), expected a camera from the ONVIF type", result.Class, result.ClassNote)
+	}
+}
+
+func TestApplyCertBrand(t *testing.T) {
+	result := HostResult{Brand: "Unknown cam", TLSCerts: map[int]probe.TLSCert{
+		8443: {Subject: "CN=cam.example.com", SubjectCN: "cam.example.com", IssuerOrg: []string{"Let's Encrypt"}},
+		443:  {Subject: "CN=192.168.1.108,O=Dahua", SubjectCN: "192.168.1.108", Organization: []string{"Dahua"}, SelfSigned: true},
+	}}
+	if !applyDetector(&result, certDetector) || result.Brand != "Dahua" || result.BrandNote != "HTTPS port 443 certificate names Dahua" {
+		t.Errorf("certDetector = %q (%q), expected Dahua from the self-signed certificate", result.Brand, result.BrandNote)
+	}
+	if entries := ToReport([]HostResult{result}); len(entries[0].TLSCerts) != 2 || entries[0].TLSCerts[0].Port != 443 {
+		t.Errorf("ToReport() TLS certificates = %+v, expected both ports in order", entries[0].TLSCerts)
+	}
+}
+
+func TestApplySDPBrand(t *testing.T) {
+	result := HostResult{Brand: "Unknown cam", RTSPStreams: []probe.RTSPStream{
+		{URL: "rtsp://192.0.2.1:554/live", Media: probe.SDPInfo{Session: []string{"s=Session streamed by LIVE555"}}},
+		{URL: "rtsp://192.0.2.1:554/Streaming/Channels/101", Media: probe.SDPInfo{Session: []string{"s=Media Presentation"}}},
+	}}
+	if !applyDetector(&result, sdpDetector) || result.Brand != "Hikvision" || result.BrandNote != "RTSP SDP s=Media Presentation" {
+		t.Errorf("sdpDetector = %q (%q), expected Hikvision from the session name", result.Brand, result.BrandNote)
+	}
+	if applyDetector(&result, sdpDetector) {
+		t.Error("sdpDetector changed a settled brand")
+	}
+}
+
+func TestFlagHoneypots(t *testing.T) {
+	page := strings.Repeat("<div>login</div>", 32)
+	results := []HostResult{
+		{Host: "192.0.2.1", Ports: []int{22, 80}, SSH: probe.SSHInfo{Port: 22, Banner: "SSH-2.0-OpenSSH_6.0p1 Debian-4+deb7u2"}},
+		{Host: "192.0.2.2", Ports: []int{80, 135, 445, 1433, 3306, 37777, 34567}},
+		{Host: "192.0.2.3", Ports: []int{80}, Brand: "Hikvision", HTTPMeta: probe.HTTPMeta{Ports: map[int]probe.PortMeta{80: {ETag: `"5f1-5b2"`, Body: page}}}},
+		{Host: "192.0.2.4", Ports: []int{80}, Brand: "Dahua", HTTPMeta: probe.HTTPMeta{Ports: map[int]probe.PortMeta{80: {ETag: `"5f1-5b2"`}}}},
+		{Host: "192.0.2.5", Ports: []int{80}, Brand: "Annke", HTTPMeta: probe.HTTPMeta{Ports: map[int]probe.PortMeta{8080: {Body: page}}}},
+		{Host: "192.0.2.6", Ports: []int{80, 554}, Brand: "Axis", SSH: probe.SSHInfo{Banner: "SSH-2.0-OpenSSH_7.4"}},
+	}
+	FlagHoneypots(results)
+
+	expected := [][]string{
+		{`SSH banner "SSH-2.0-OpenSSH_6.0p1 Debian-4+deb7u2" is the Cowrie default`},
+		{"SDK ports of several vendors: 37777 (Dahua), 34567 (Xiongmai)", "ports [135 445 1433 3306] are services no camera runs"},
+		{`ETag "5f1-5b2" served by hosts of Dahua, Hikvision`},
+		{`ETag "5f1-5b2" served by hosts of Dahua, Hikvision`},
+		nil, // Annke runs Hikvision firmware, so sharing its page is expected
+		nil,
+	}
+	for i, r := range results {
+		if !slices.Equal(r.Honeypot, expected[i]) {
+			t.Errorf("FlagHoneypots() %s = %q, expected %q", r.Host, r.Honeypot, expected[i])
+		}
+	}
+	if entries := ToReport(results[:1]); len(entries[0].Honeypot) != 1 || !strings.HasPrefix(entries[0].Notes[len(entries[0].Notes)-1], "HONEYPOT: ") {
+		t.Errorf("ToReport() honeypot = %q, notes %q", entries[0].Honeypot, entries[0].Notes)
+	}
+}
+
+func TestApplyHTTPStackBrand(t *testing.T) {
+	result := HostResult{Brand: "Unknown cam", HTTPStacks: map[int]probe.HTTPFingerprint{
+		80:   {Status: 404, Body: "<html>Not Found</html>"},
+		8080: {Status: 404, Body: "<html><title>404</title>VIVOTEK web server</html>"},
+	}}
+	if !applyDetector(&result, httpStackDetector) || result.Brand != "Vivotek" || result.BrandNote != "HTTP port 8080 error page names Vivotek" {
+		t.Errorf("httpStackDetector = %q (%q), expected Vivotek from the 404 page", result.Brand, result.BrandNote)
+	}
+
+	result = HostResult{Brand: "Unknown cam", HTTPMeta: probe.HTTPMeta{Ports: map[int]probe.PortMeta{80: {StatusCode: 401, Body: "Geovision: access denied"}}}}
+	if !applyDetector(&result, httpStackDetector) || result.Brand != "Geovision" {
+		t.Errorf("httpStackDetector = %q, expected Geovision from the 401 page", result.Brand)
+	}
+}
+
+func TestAttachSADP(t *testing.T) {
+	results := []HostResult{{Host: "192.168.1.64", Ports: []int{80}, Brand: "Unknown cam"}}
+	devices := []probe.SADPDevice{
+		{Address: "192.168.1.64", Model: "DS-2CD2042WD-I", FirmwareVersion: "V5.4.5build 170124"},
+		{Address: "192.168.1.65", Model: "DS-7608NI-K2", ActivationKnown: true},
+	}
+
+	results = AttachSADP(results, devices)
+	if len(results) != 2 {
+		t.Fatalf("AttachSADP() returned %d results, expected 2", len(results))
+	}
+	if results[0].Brand != "Hikvision" || results[0].BrandNote != "SADP: DS-2CD2042WD-I V5.4.5build 170124" {
+		t.Errorf("AttachSADP() brand = %q (%q)", results[0].Brand, results[0].BrandNote)
+	}
+	if results[1].Host != "192.168.1.65" || !results[1].SADPDevice.Found() {
+		t.Errorf("AttachSADP() = %+v, expected a result for the SADP-only host", results[1])
+	}
+
+	if entries := ToReport(results[:1]); len(entries[0].CPEs) != 2 || entries[0].CPEs[0] != "cpe:2.3:o:hikvision:ds-2cd2042wd-i_firmware:5.4.5:*:*:*:*:*:*:*" {
+		t.Errorf("ToReport() CPEs = %v, expected them from the SADP model and firmware", entries[0].CPEs)
+	}
+	if results[0].Model != "DS-2CD2042WD-I" || results[0].ModelLine != "DS-2CD IP camera" || results[0].ModelNote != "SADP" {
+		t.Errorf("AttachSADP() model = %q, %q (%q)", results[0].Model, results[0].ModelLine, results[0].ModelNote)
+	}
+
+	old := HostResult{Host: "192.168.1.66", Brand: "Axis", DeviceDetails: probe.DeviceDetails{Model: "AXIS 211", Firmware: "4.47"}}
+	if e := ToReport([]HostResult{old})[0].EOL; e == nil || e.Status != "end-of-life" || e.Model != "AXIS 211" {
+		t.Errorf("ToReport() EOL = %+v, expected the AXIS 2xx series end of life", e)
+	}
+
+	entries := ToReport(results[1:])
+	if d := entries[0].SADPDevice; d == nil || d.Activated == nil || *d.Activated {
+		t.Errorf("ToReport() SADP device = %+v, expected not activated", d)
+	}
+}
+
+func TestSetBrandPlatform(t *testing.T) {
+	result := HostResult{Brand: "Annke", BrandNote: `port 80 title "<title>ANNKE</title>"`, BrandScore: 0.6}
+	applySADP(&result, probe.SADPDevice{Model: "DS-7608NI-K2"})
+	if result.Brand != "Annke" || result.BrandScore != confidenceDevice {
+		t.Errorf("applySADP() = %q [%.2f], expected the Annke label confirmed by its Hikvision platform", result.Brand, result.BrandScore)
+	}
+	if !strings.HasSuffix(result.BrandNote, "; SADP: DS-7608NI-K2 (Hikvision platform)") {
+		t.Errorf("applySADP() note = %q", result.BrandNote)
+	}
+	if entries := ToReport([]HostResult{result}); entries[0].Platform != "Hikvision" {
+		t.Errorf("ToReport() platform = %q, expected Hikvision", entries[0].Platform)
+	}
+}
+
+func TestAttachMDNS(t *testing.T) {
+	results := []HostResult{{Host: "169.254.10.20", Ports: []int{80}}}
+	devices := []probe.MDNSDevice{
+		{Address: "169.254.10.20", Services: []probe.MDNSService{{Instance: "AXIS M3045-V", Service: "_axis-video._tcp", Port: 80}}},
+		{Address: "169.254.10.21", Services: []probe.MDNSService{{Instance: "Doorbell", Service: "_rtsp._tcp", Port: 554}}},
+	}
+
+	results = AttachMDNS(results, devices)
+	if len(results) != 2 {
+		t.Fatalf("AttachMDNS() returned %d results, expected 2", len(results))
+	}
+	if results[0].Brand != "Axis" || len(results[0].MDNSServices) != 1 {
+		t.Errorf("AttachMDNS() = %+v, expected Axis with one service", results[0])
+	}
+	if results[1].Host != "169.254.10.21" || results[1].Brand != "" {
+		t.Errorf("AttachMDNS() = %+v, expected an unbranded result for the mDNS-only host", results[1])
+	}
+}
+
+func TestSortByLatency(t *testing.T) {
+	results := []HostResult{
+		{Host: "10.0.0.1", Latency: map[int]probe.PortLatency{80: {Attempts: 3, Failures: 3}}},
+		{Host: "10.0.0.2", Latency: map[int]probe.PortLatency{80: {Connect: 40 * time.Millisecond, Attempts: 3}}},
+		{Host: "10.0.0.3", Latency: map[int]probe.PortLatency{
+			80:  {Connect: 5 * time.Millisecond, Attempts: 3},
+			554: {Connect: 15 * time.Millisecond, Attempts: 3, Failures: 1},
+		}},
+	}
+
+	SortByLatency(results)
+	var order []string
+	for _, r := range results {
+		order = append(order, r.Host)
+	}
+	if strings.Join(order, " ") != "10.0.0.3 10.0.0.2 10.0.0.1" {
+		t.Errorf("SortByLatency() order = %v, expected 10.0.0.3 10.0.0.2 10.0.0.1", order)
+	}
+
+	entries := ToReport(results[:1])
+	if l := entries[0].Latency[554]; l.ConnectMs != 15 || l.Failures != 1 {
+		t.Errorf("ToReport() latency = %+v, expected 15 ms with one failure", l)
+	}
+	if !strings.Contains(strings.Join(entries[0].Notes, "\n"), "FLAKY: port 554 failed 1 of 3 connects") {
+		t.Errorf("ToReport() notes = %v, expected the flaky port", entries[0].Notes)
+	}
+}
+
+func TestReverseLookup(t *testing.T) {
+	p := NewOptimizedProcessor(false, "", t.TempDir())
+	if names := p.reverseLookup(context.Background(), "192.0.2.10"); names != nil {
+		t.Errorf("reverseLookup() = %v while disabled, expected nil", names)
+	}
+
+	lookups := 0
+	p.lookupAddr = func(ctx context.Context, addr string) ([]string, error) {
+		lookups++
+		if addr == "192.0.2.10" {
+			return []string{"cam-lobby.example.com.", "cam-lobby.example.com"}, nil
+		}
+		return nil, &net.DNSError{Err: "no such host", Name: addr, IsNotFound: true}
+	}
+	if names := p.reverseLookup(context.Background(), "192.0.2.10"); len(names) != 1 || names[0] != "cam-lobby.example.com" {
+		t.Errorf("reverseLookup() = %v, expected [cam-lobby.example.com]", names)
+	}
+	if names := p.reverseLookup(context.Background(), "192.0.2.11"); names != nil {
+		t.Errorf("reverseLookup() = %v for a host without PTR, expected nil", names)
+	}
+	if names := p.reverseLookup(context.Background(), "cam.example.com"); names != nil || lookups != 2 {
+		t.Errorf("reverseLookup() = %v after %d lookups, expected names to be skipped", names, lookups)
+	}
+
+	entries := ToReport([]HostResult{{Host: "192.0.2.10", Hostnames: []string{"cam-lobby.example.com"}}})
+	if len(entries[0].Hostnames) != 1 {
+		t.Errorf("ToReport() hostnames = %v", entries[0].Hostnames)
+	}
+}
+
+func TestApplyProbeCVEs(t *testing.T) {
+	result := HostResult{CVEs: []string{"CVE-2018-10660"}, GSOAP: probe.GSOAPInfo{URL: "http://192.0.2.1/onvif/device_service", Version: "2.8.47"}}
+	applyProbeCVEs(&result)
+	applyProbeCVEs(&result)
+	if len(result.CVEs) != 2 || result.CVEs[1] != probe.DevilsIvyCVE {
+		t.Errorf("applyProbeCVEs() CVEs = %v, expected %s added once", result.CVEs, probe.DevilsIvyCVE)
+	}
+
+	result = HostResult{GSOAP: probe.GSOAPInfo{URL: "http://192.0.2.1/onvif/device_service", Version: "2.8.48"}}
+	if applyProbeCVEs(&result); len(result.CVEs) != 0 {
+		t.Errorf("applyProbeCVEs() CVEs = %v for a patched release", result.CVEs)
+	}
+}
+
+func TestToReportKEV(t *testing.T) {
+	entries := ToReport([]HostResult{{Host: "192.0.2.1", Brand: "Hikvision", CVEs: []string{"CVE-2017-7921", "CVE-2021-36260"}}})
+	details := entries[0].CVEDetails
+	if len(details) != 2 || details[0].ID != "CVE-2021-36260" || details[0].KEV == "" || details[1].Summary == "" {
+		t.Fatalf("ToReport() CVE details = %+v, expected CVE-2021-36260 from the KEV catalog first, both summarized", details)
+	}
+	if !slices.ContainsFunc(entries[0].Notes, func(n string) bool { return strings.HasPrefix(n, "KEV: CVE-2021-36260 ") }) {
+		t.Errorf("ToReport() notes = %v, expected a KEV note", entries[0].Notes)
+	}
+	if labels := cveLabels([]string{"CVE-2021-36260"}); labels[0] != "CVE-2021-36260 (KEV)" {
+		t.Errorf("cveLabels() = %v", labels)
+	}
+}
+
+func TestToReportFixedIn(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "advisories.csv")
+	os.WriteFile(path, []byte("cve,brand,models,firmware_before\nHSRC-2099-21,Hikvision,ds-2cd2042,5.4.5\nHSRC-2099-22,Hikvision,ds-2cd,5.5.0\nHSRC-2099-23,Hikvision,ds-2cd2042,5.3.0\n"), 0o600)
+	if err := cvedb.LoadLocal(path); err != nil {
+		t.Fatal(err)
+	}
+	result := HostResult{Host: "192.0.2.1", Brand: "Annke", Model: "DS-2CD2042WD-I", Firmware: "V5.4.0 build 160530", CVEs: []string{"HSRC-2099-21", "HSRC-2099-22", "HSRC-2099-23"}}
+	fixed := make(map[string]string)
+	entries := ToReport([]HostResult{result})
+	for _, d := range entries[0].CVEDetails {
+		fixed[d.ID] = d.Running + " < " + d.FixedIn
+	}
+	expected := map[string]string{"HSRC-2099-21": "V5.4.0 build 160530 < 5.4.5", "HSRC-2099-22": "V5.4.0 build 160530 < 5.5.0", "HSRC-2099-23": " < 5.3.0"}
+	if !maps.Equal(fixed, expected) {
+		t.Errorf("ToReport() fixed in = %v, expected %v", fixed, expected)
+	}
+	if !slices.Contains(entries[0].Notes, "UPGRADE: running V5.4.0 build 160530, fixed in 5.5.0 (HSRC-2099-21, HSRC-2099-22)") {
+		t.Errorf("ToReport() notes = %v, expected the upgrade target", entries[0].Notes)
+	}
+}
+
+func TestToReportCVEChecks(t *testing.T) {
+	result := HostResult{Host: "192.0.2.1", Brand: "Hikvision", CVEs: []string{"CVE-2017-7921", "CVE-2021-36260", "CVE-2024-29947"}}
+	result.CVEChecks = []probe.CVECheck{
+		{CVE: "CVE-2017-7921", Status: probe.CVEConfirmed, URL: "http://192.0.2.1/onvif-http/snapshot?auth=YWRtaW46MTEK", Evidence: "snapshot served with the forged auth token"},
+		{CVE: "CVE-2021-36260", Status: probe.CVENotConfirmed},
+	}
+	status := make(map[string]string)
+	entries := ToReport([]HostResult{result})
+	for _, d := range entries[0].CVEDetails {
+		status[d.ID] = d.Status
+	}
+	expected := map[string]string{"CVE-2017-7921": "confirmed", "CVE-2021-36260": "not confirmed", "CVE-2024-29947": "inferred"}
+	if !maps.Equal(status, expected) {
+		t.Errorf("ToReport() CVE status = %v, expected %v", status, expected)
+	}
+	if !slices.ContainsFunc(entries[0].Notes, func(n string) bool { return strings.HasPrefix(n, "CVE CONFIRMED: CVE-2017-7921: ") }) {
+		t.Errorf("ToReport() notes = %v, expected the confirmed CVE", entries[0].Notes)
+	}
+
+	// Only checks that found the CVE add it
+	result = HostResult{CVEChecks: []probe.CVECheck{{CVE: "CVE-2021-33044", Status: probe.CVEConfirmed}, {CVE: "CVE-2021-36260", Status: probe.CVENotConfirmed}}}
+	if applyProbeCVEs(&result); !slices.Equal(result.CVEs, []string{"CVE-2021-33044"}) {
+		t.Errorf("applyProbeCVEs() CVEs = %v, expected the confirmed CVE only", result.CVEs)
+	}
+}
+
+func TestEPSS(t *testing.T) {
+	if err := cveStore(t).PutEPSS(map[string]cvedb.EPSS{"CVE-2021-36260": {Score: 0.94}, "CVE-2017-7921": {Score: 0.02}}); err != nil {
+		t.Fatal(err)
+	}
+
+	results := []HostResult{
+		{Host: "192.0.2.1"},
+		{Host: "192.0.2.2", CVEs: []string{"CVE-2017-7921"}},
+		{Host: "192.0.2.3", CVEs: []string{"CVE-2017-7921", "CVE-2021-36260", "CVE-2099-0001"}},
+	}
+	SortByEPSS(results)
+	if results[0].Host != "192.0.2.3" || results[1].Host != "192.0.2.2" || results[2].Host != "192.0.2.1" {
+		t.Errorf("SortByEPSS() = %s, %s, %s", results[0].Host, results[1].Host, results[2].Host)
+	}
+	FilterEPSS(results, 0.1)
+	if !slices.Equal(results[0].CVEs, []string{"CVE-2021-36260", "CVE-2099-0001"}) || len(results[1].CVEs) != 0 {
+		t.Errorf("FilterEPSS() = %v, %v, expected unscored CVEs kept", results[0].CVEs, results[1].CVEs)
+	}
+}
+
+// cveStore returns a new CVE store in use until the test ends
+func cveStore(t *testing.T) *cvedb.Store {
+	t.Helper()
+	s, err := cvedb.OpenStore(filepath.Join(t.TempDir(), "cves.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cvedb.Use(s)
+	t.Cleanup(func() { cvedb.Use(nil); s.Close() })
+	return s
+}
+
+func TestFilterSeverity(t *testing.T) {
+	f := cvedb.Feed{Updated: time.Now(), Brands: map[string][]cvedb.Entry{"acme": {
+		{ID: "CVE-2099-0001", CVSS: 9.8, Severity: "CRITICAL"},
+		{ID: "CVE-2099-0002", CVSS: 7.5, Severity: "HIGH"},
+		{ID: "CVE-2099-0003", CVSS: 5.3, Severity: "MEDIUM"},
+	}}}
+	if _, err := cveStore(t).Replace(f); err != nil {
+		t.Fatal(err)
+	}
+
+	// CVE-2021-36260 is in the KEV catalog, CVE-2099-0004 is not scored
+	results := []HostResult{
+		{Host: "192.0.2.1", CVEs: []string{"CVE-2099-0001", "CVE-2099-0002", "CVE-2099-0003", "CVE-2021-36260", "CVE-2099-0004"}},
+		{Host: "192.0.2.2", CVEs: []string{"CVE-2099-0003"}},
+	}
+	FilterSeverity(results, "high")
+	if !slices.Equal(results[0].CVEs, []string{"CVE-2099-0001", "CVE-2099-0002", "CVE-2021-36260"}) || len(results[1].CVEs) != 0 {
+		t.Errorf("FilterSeverity(high) = %v, %v", results[0].CVEs, results[1].CVEs)
+	}
+	if !HasFindings(results) || HasFindings(results[1:]) {
+		t.Error("HasFindings() misses the CVEs left")
+	}
+	if results[1].Credentials = "admin:12345"; !HasFindings(results[1:]) {
+		t.Error("HasFindings() misses default credentials")
+	}
+}
+
+func TestApplyDeviceCVEs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "advisories.csv")
+	os.WriteFile(path, []byte("cve,brand,models\nHSRC-2099-11,Hikvision,ds-76\nHSRC-2099-12,Hikvision,ds-2cd\n"), 0o600)
+	if err := cvedb.LoadLocal(path); err != nil {
+		t.Fatal(err)
+	}
+
+	// White-label brands get the advisories of their platform
+	result := HostResult{Brand: "Annke", CVEs: []string{"CVE-2017-7921"}, Model: "DS-7608NI-K2"}
+	applyDeviceCVEs(&result)
+	applyDeviceCVEs(&result)
+	if !slices.Equal(result.CVEs, []string{"CVE-2017-7921", "HSRC-2099-11"}) {
+		t.Errorf("applyDeviceCVEs() CVEs = %v, expected the NVR advisory added once", result.CVEs)
+	}
+
+	// Camera-only CVEs don't apply to a recorder, unless a probe confirmed them
+	result.Class = fingerprint.ClassRecorder
+	if applyDeviceCVEs(&result); !slices.Equal(result.CVEs, []string{"HSRC-2099-11"}) {
+		t.Errorf("applyDeviceCVEs() CVEs = %v for an NVR, expected the camera CVE dropped", result.CVEs)
+	}
+	result.CVEs = append(result.CVEs, probe.ISAPIBypassCVE)
+	result.ISAPI.Bypass = "/ISAPI/Security/userCheck?auth=YWRtaW46MTEK"
+	if applyDeviceCVEs(&result); !slices.Contains(result.CVEs, probe.ISAPIBypassCVE) {
+		t.Errorf("applyDeviceCVEs() CVEs = %v, expected the confirmed bypass kept", result.CVEs)
+	}
+}
+
+func TestApplyISAPIBrand(t *testing.T) {
+	result := HostResult{Brand: "Unknown cam", ISAPI: probe.ISAPIInfo{Base: "http://192.0.2.1:80", Bypass: "http://192.0.2.1:80/onvif-http/snapshot?auth=YWRtaW46MTEK"}}
+	if !applyDetector(&result, isapiDetector) || result.Brand != "Hikvision" {
+		t.Errorf("isapiDetector brand = %q, expected Hikvision", result.Brand)
+	}
+	if applyProbeCVEs(&result); !slices.Contains(result.CVEs, probe.ISAPIBypassCVE) {
+		t.Errorf("applyProbeCVEs() CVEs = %v, expected %s", result.CVEs, probe.ISAPIBypassCVE)
+	}
+	entries := ToReport([]HostResult{result})
+	if i := entries[0].ISAPI; i == nil || i.Bypass == "" || !strings.Contains(strings.Join(entries[0].Notes, "\n"), "ISAPI AUTH BYPASS") {
+		t.Errorf("ToReport() ISAPI = %+v, notes %v", i, entries[0].Notes)
+	}
+}
+
+func TestApplyNucleiBrand(t *testing.T) {
+	result := HostResult{Brand: "Unknown cam", Nuclei: []nuclei.Match{
+		{TemplateID: "exposed-panels-login", Severity: "info", Tags: []string{"panel"}, URL: "http://192.0.2.1/"},
+		{TemplateID: "CVE-2021-33044", Severity: "critical", Tags: []string{"cve", "dahua"}, CVEs: []string{"CVE-2021-33044"}, URL: "http://192.0.2.1/RPC2_Login"},
+	}}
+	if !applyDetector(&result, nucleiDetector) || result.Brand != "Dahua" || result.BrandNote != "nuclei: CVE-2021-33044" {
+		t.Errorf("nucleiDetector = %q (%q), expected Dahua from the CVE template", result.Brand, result.BrandNote)
+	}
+	if applyProbeCVEs(&result); !slices.Contains(result.CVEs, "CVE-2021-33044") {
+		t.Errorf("applyProbeCVEs() CVEs = %v, expected the nuclei CVE", result.CVEs)
+	}
+	entries := ToReport([]HostResult{result})
+	if len(entries[0].Nuclei) != 2 || !strings.Contains(strings.Join(entries[0].Notes, "\n"), "NUCLEI: critical CVE-2021-33044") {
+		t.Errorf("ToReport() nuclei = %+v, notes %v", entries[0].Nuclei, entries[0].Notes)
+	}
+
+	result = HostResult{Brand: "Axis", Nuclei: result.Nuclei}
+	if applyDetector(&result, nucleiDetector) || result.Brand != "Axis" {
+		t.Errorf("nucleiDetector replaced a specific brand with %q", result.Brand)
+	}
+}
+
+func TestCredentials(t *testing.T) {
+	dir := t.TempDir()
+	comments := filepath.Join(dir, "comments.txt")
+	os.WriteFile(comments, []byte("# admin:admin\n\n"), 0o600)
+	file := filepath.Join(dir, "creds.txt")
+	os.WriteFile(file, []byte("root:root\n"), 0o600)
+
+	// Brand defaults alone never start brute force
+	for _, path := range []string{"", filepath.Join(dir, "missing.txt"), comments, dir} {
+		if creds := NewOptimizedProcessor(false, path, "").credentials("192.0.2.1", "Hikvision"); len(creds) > 0 {
+			t.Errorf("credentials() = %q with credentials file %q, expected none", creds, path)
+		}
+	}
+	creds := NewOptimizedProcessor(false, file, "").credentials("192.0.2.1", "Hikvision")
+	if len(creds) < 2 || creds[len(creds)-1] != "root:root" || !slices.Contains(creds, "admin:12345") {
+		t.Errorf("credentials() = %q, expected the Hikvision defaults and then root:root", creds)
+	}
+}
+
+func TestVerifyCredentials(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "admin" || pass != "12345" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="DS-2CD2042WD-I"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		io.WriteString(w, `<DeviceInfo><model>DS-2CD2042WD-I</model><firmwareVersion>V5.4.5</firmwareVersion></DeviceInfo>`)
+	}))
+	defer server.Close()
+	port := server.Listener.Addr().(*net.TCPAddr).Port
+	p := NewOptimizedProcessor(false, "", t.TempDir())
+
+	login := server.URL + "/doc/page/login.asp"
+	r := HostResult{Host: "127.0.0.1", Brand: "Hikvision", HTTPPorts: []int{port}, Logins: []credbrute.Finding{
+		{URL: login, Credential: "admin:admin", Auth: "Basic"},
+		{URL: login, Credential: "admin:12345", Auth: "Basic"},
+		{URL: server.URL + "/", Credential: "admin:12345", Auth: "Basic"},
+	}}
+	p.verifyCredentials(context.Background(), &r)
+	proof := "DS-2CD2042WD-I V5.4.5 from " + server.URL + "/ISAPI/System/deviceInfo"
+	expected := []credbrute.Finding{
+		{URL: login, Credential: "admin:12345", Auth: "Basic", Proof: proof},
+		{URL: server.URL + "/", Credential: "admin:12345", Auth: "Basic", Proof: proof},
+	}
+	if !slices.Equal(r.Logins, expected) {
+		t.Errorf("verifyCredentials() kept %+v, expected %+v", r.Logins, expected)
+	}
+	if !slices.Equal(r.CredsRefused, []string{"admin:admin"}) {
+		t.Errorf("verifyCredentials() refused %q, expected admin:admin", r.CredsRefused)
+	}
+}
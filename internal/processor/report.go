@@ -0,0 +1,474 @@
+package processor
+
+import (
+	"cmp"
+	"crypto/tls"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/postfix/cctvscan/internal/cvedb"
+	"github.com/postfix/cctvscan/internal/fingerprint"
+	"github.com/postfix/cctvscan/internal/probe"
+	"github.com/postfix/cctvscan/internal/report"
+)
+
+// ToReport converts host results into report entries
+func ToReport(results []HostResult) []report.TargetResult {
+	out := make([]report.TargetResult, 0, len(results))
+	for _, r := range results {
+		tr := report.TargetResult{
+			Host:         r.Host,
+			Hostnames:    r.Hostnames,
+			OpenPorts:    r.Ports,
+			ServerHeader: r.HTTPMeta.Server,
+			Titles:       r.HTTPMeta.Titles,
+			LoginPages:   r.LoginPages,
+			Screenshots:  r.Screenshots,
+			HLSStreams:   r.HLSStreams,
+			Telnet:       r.Telnet,
+			Brand:        r.Brand,
+			CVEs:         r.CVEs,
+			CVELinks:     fingerprint.OptimizedCVELinks(r.CVEs),
+			CVEDetails:   cveDetails(r),
+			FoundCred:    r.Credentials,
+			CredProof:    r.CredsProof,
+			Lockout:      r.Lockout,
+		}
+		if r.Lockout != "" {
+			tr.Notes = append(tr.Notes, "LOCKOUT: credential testing stopped: "+r.Lockout)
+		}
+		for _, l := range r.Logins {
+			tr.Logins = append(tr.Logins, report.Login{URL: l.URL, Credential: l.Credential, Auth: l.Auth, Proof: l.Proof})
+		}
+		for _, c := range r.CredsRefused {
+			tr.Notes = append(tr.Notes, fmt.Sprintf("UNVERIFIED CREDENTIAL: the login page took %s but the %s device information endpoint refused it", c, fingerprint.Platform(r.Brand)))
+		}
+		tr.BrandConfidence = r.BrandScore
+		for _, d := range tr.CVEDetails {
+			if d.KEV != "" {
+				tr.Notes = append(tr.Notes, fmt.Sprintf("KEV: %s is exploited in the wild (CISA KEV since %s)", d.ID, d.KEV))
+			}
+		}
+		if note := upgradeNote(tr.CVEDetails); note != "" {
+			tr.Notes = append(tr.Notes, note)
+		}
+		for _, a := range r.Advisories {
+			tr.Advisories = append(tr.Advisories, report.Advisory{ID: a.ID, Title: a.Title, CVSS: a.CVSS, CVEs: a.CVEs})
+		}
+		for _, c := range r.CVEChecks {
+			if c.Status == probe.CVEConfirmed {
+				tr.Notes = append(tr.Notes, fmt.Sprintf("CVE CONFIRMED: %s: %s (%s)", c.CVE, c.Evidence, c.URL))
+			}
+		}
+		tr.Model, tr.ModelLine = r.Model, r.ModelLine
+		tr.Firmware, tr.Serial, tr.Locale = r.Firmware, r.Serial, r.Locale
+		tr.SoC, tr.Class = r.SoC, r.Class
+		if risk := fingerprint.SoCRisk(r.SoC); risk != "" {
+			tr.Notes = append(tr.Notes, fmt.Sprintf("SOC: %s (%s): %s", r.SoC, r.SoCNote, risk))
+		}
+		if fingerprint.IsOEM(r.Brand) {
+			tr.Platform = fingerprint.Platform(r.Brand)
+		}
+		tr.CPEs = hostCPEs(r)
+		if r.MAC != "" {
+			tr.MAC, tr.MACVendor = r.MAC, fingerprint.DetectFromMAC(r.MAC)
+		}
+		for _, m := range r.BrandWhy {
+			tr.BrandWhy = append(tr.BrandWhy, report.BrandMatch{Method: m.Method, Pattern: m.Pattern, Text: m.Text, Port: m.Port})
+		}
+		for _, c := range r.Candidates {
+			tr.BrandCandidates = append(tr.BrandCandidates, report.BrandCandidate{Brand: c.Brand, Confidence: c.Confidence, Evidence: c.Evidence})
+		}
+		if e, ok := r.EndOfLife(); ok {
+			model, firmware := r.DeviceIdentity()
+			tr.EOL = &report.EOLInfo{Status: e.Status, Since: e.Since, Note: e.Note, Model: model, Firmware: firmware}
+			tr.Notes = append(tr.Notes, fmt.Sprintf("UNSUPPORTED: %s %s is %s", r.Brand, strings.TrimSpace(model+" "+firmware), e))
+		}
+		if len(r.Honeypot) > 0 {
+			tr.Honeypot = r.Honeypot
+			tr.Notes = append(tr.Notes, "HONEYPOT: likely a honeypot posing as a camera: "+strings.Join(r.Honeypot, "; "))
+		}
+		if r.BrandScore > 0 && r.BrandScore < lowConfidence {
+			tr.Notes = append(tr.Notes, fmt.Sprintf("LOW CONFIDENCE: brand %s scored %.2f (%s)", r.Brand, r.BrandScore, r.BrandNote))
+		}
+		for port, pm := range r.HTTPMeta.Ports {
+			if len(pm.Redirects) > 0 {
+				if tr.Redirects == nil {
+					tr.Redirects = make(map[int][]string)
+				}
+				tr.Redirects[port] = pm.Redirects
+			}
+		}
+		for _, port := range sortedPorts(r.TLSCerts) {
+			c := r.TLSCerts[port]
+			tr.TLSCerts = append(tr.TLSCerts, report.TLSCert{
+				Port:       port,
+				Subject:    c.Subject,
+				Issuer:     c.Issuer,
+				DNSNames:   c.DNSNames,
+				SHA256:     c.SHA256,
+				NotAfter:   c.NotAfter.Format(time.DateOnly),
+				SelfSigned: c.SelfSigned,
+			})
+		}
+		for _, port := range sortedPorts(r.ServerHellos) {
+			h := r.ServerHellos[port]
+			tr.TLSHellos = append(tr.TLSHellos, report.TLSHello{
+				Port:    port,
+				Version: tls.VersionName(h.Version),
+				Cipher:  tls.CipherSuiteName(h.Cipher),
+				ALPN:    h.ALPN,
+				JA3S:    h.JA3S,
+				JA3SRaw: h.JA3SRaw,
+				JA4S:    h.JA4S,
+			})
+		}
+		for _, port := range sortedPorts(r.HTTPStacks) {
+			s := r.HTTPStacks[port]
+			tr.HTTPStacks = append(tr.HTTPStacks, report.HTTPStack{Port: port, Status: s.Status, HeaderOrder: s.Order(), Title: s.Title})
+		}
+		for _, l := range r.LoginStatus {
+			if tr.LoginStatus == nil {
+				tr.LoginStatus = make(map[string]report.PageStatus)
+			}
+			tr.LoginStatus[l.URL] = report.PageStatus{Status: l.Status, ContentType: l.ContentType}
+		}
+		for u, c := range r.LoginAuth {
+			if tr.LoginAuth == nil {
+				tr.LoginAuth = make(map[string]report.AuthInfo)
+			}
+			tr.LoginAuth[u] = report.AuthInfo{Scheme: c.Scheme, Realm: c.Realm}
+		}
+		for port, c := range r.RTSPAuth {
+			if tr.RTSPAuth == nil {
+				tr.RTSPAuth = make(map[int]report.AuthInfo)
+			}
+			tr.RTSPAuth[port] = report.AuthInfo{Scheme: c.Scheme, Realm: c.Realm}
+		}
+		if d := r.ONVIFDevice; d.Found() {
+			tr.ONVIFDevice = &report.ONVIFDevice{
+				Manufacturer:    d.Manufacturer,
+				Model:           d.Model,
+				FirmwareVersion: d.FirmwareVersion,
+				SerialNumber:    d.SerialNumber,
+				HardwareID:      d.HardwareID,
+				URL:             d.URL,
+				Authenticated:   d.Authenticated,
+			}
+			if c := r.ONVIFCred; c.Username != "" {
+				tr.ONVIFDevice.Credential, tr.ONVIFDevice.Operations = c.Username+":"+c.Password, c.Operations
+			}
+			for _, s := range r.SnapshotURIs {
+				tr.ONVIFDevice.SnapshotURIs = append(tr.ONVIFDevice.SnapshotURIs, s.URI)
+			}
+			tr.ONVIFDevice.Snapshot = r.ONVIFSnapshot
+		}
+		if i := r.ONVIFInfo; i.Found() {
+			tr.ONVIFDiscovery = &report.ONVIFDiscovery{Name: i.Name, Hardware: i.Hardware, Location: i.Location, XAddrs: i.XAddrs}
+		}
+		for _, s := range r.ONVIFServices {
+			tr.ONVIFServices = append(tr.ONVIFServices, s.URL)
+		}
+		if d := r.DeviceDetails; d.Found() {
+			tr.Device = &report.DeviceInfo{
+				Model:         d.Model,
+				Firmware:      d.Firmware,
+				SerialNumber:  d.Serial,
+				MAC:           d.MAC,
+				DeviceType:    d.DeviceType,
+				URL:           d.URL,
+				Authenticated: d.Authenticated,
+			}
+		}
+		if s := r.SNMP; s.Found() {
+			tr.SNMP = &report.SNMPInfo{
+				Community:   s.Community,
+				SysDescr:    s.SysDescr,
+				SysObjectID: s.SysObjectID,
+				SysName:     s.SysName,
+			}
+			tr.Notes = append(tr.Notes, fmt.Sprintf("SNMP readable with community %q", s.Community))
+		}
+		if s := r.SSH; s.Found() {
+			tr.SSH = &report.SSHInfo{
+				Port:        s.Port,
+				Banner:      s.Banner,
+				HostKeyType: s.HostKeyType,
+				Fingerprint: s.Fingerprint,
+			}
+		}
+		if f := r.FTP; f.Found() {
+			tr.FTP = &report.FTPInfo{Port: f.Port, Banner: f.Banner, Anonymous: f.Anonymous}
+			if f.Anonymous {
+				tr.Notes = append(tr.Notes, fmt.Sprintf("OPEN FTP: anonymous login accepted on port %d", f.Port))
+			}
+		}
+		if s := r.SIP; s.Found() {
+			tr.SIP = &report.SIPInfo{
+				Transport: s.Transport,
+				Port:      s.Port,
+				Status:    s.Status,
+				Server:    s.Server,
+				Realm:     s.Realm,
+				DeviceIDs: s.DeviceIDs,
+				GB28181:   s.GB28181,
+			}
+			if s.GB28181 {
+				tr.Notes = append(tr.Notes, fmt.Sprintf("GB28181 endpoint on %s/%d", s.Transport, s.Port))
+			}
+		}
+		for _, svc := range r.MDNSServices {
+			tr.MDNSServices = append(tr.MDNSServices, fmt.Sprintf("%s (%s, port %d)", svc.Instance, svc.Service, svc.Port))
+		}
+		if d := r.SADPDevice; d.Found() {
+			tr.SADPDevice = &report.SADPDevice{
+				DeviceType:      d.DeviceType,
+				Model:           d.Model,
+				FirmwareVersion: d.FirmwareVersion,
+				SerialNumber:    d.SerialNumber,
+				MAC:             d.MAC,
+			}
+			if d.ActivationKnown {
+				tr.SADPDevice.Activated = &d.Activated
+				if !d.Activated {
+					tr.Notes = append(tr.Notes, "NOT ACTIVATED: the admin password can be set by anyone on the LAN via SADP")
+				}
+			}
+		}
+		for _, s := range r.RTSPStreams {
+			tr.RTSPStreams = append(tr.RTSPStreams, toReportStream(s))
+		}
+		if len(r.RTSPStreams) > 0 {
+			note := fmt.Sprintf("OPEN RTSP: %d stream(s) play without authentication", len(r.RTSPStreams))
+			if viewable := countViewable(r.RTSPStreams); viewable > 0 {
+				note += fmt.Sprintf(", %d confirmed viewable", viewable)
+			}
+			tr.Notes = append(tr.Notes, note)
+		}
+		if len(r.HLSStreams) > 0 {
+			tr.Notes = append(tr.Notes, fmt.Sprintf("OPEN HLS: %d playlist(s) served without authentication", len(r.HLSStreams)))
+		}
+		for port, l := range r.Latency {
+			if tr.Latency == nil {
+				tr.Latency = make(map[int]report.PortLatency)
+			}
+			tr.Latency[port] = report.PortLatency{
+				ConnectMs: l.Connect.Milliseconds(),
+				TTFBMs:    l.TTFB.Milliseconds(),
+				Attempts:  l.Attempts,
+				Failures:  l.Failures,
+			}
+		}
+		for _, port := range sortedPorts(r.Latency) {
+			if l := r.Latency[port]; l.Flaky() {
+				tr.Notes = append(tr.Notes, fmt.Sprintf("FLAKY: port %d failed %d of %d connects", port, l.Failures, l.Attempts))
+			}
+		}
+		for _, f := range r.Notes {
+			tr.Exposure = append(tr.Exposure, report.ExposureFinding{Kind: f.Kind, Severity: f.Severity, URL: f.URL, Detail: f.Detail})
+			if f.Severity == "high" {
+				tr.Notes = append(tr.Notes, "EXPOSED: "+f.URL+" ("+f.Detail+")")
+			}
+		}
+		for _, m := range r.Nuclei {
+			tr.Nuclei = append(tr.Nuclei, report.NucleiMatch{Template: m.TemplateID, Name: m.Name, Severity: m.Severity,
+				URL: m.URL, CVEs: m.CVEs, Extracted: m.Extracted})
+			if m.Severity == "high" || m.Severity == "critical" {
+				tr.Notes = append(tr.Notes, "NUCLEI: "+m.Severity+" "+m.TemplateID+" at "+m.URL)
+			}
+		}
+		for _, f := range r.ProbeFindings {
+			tr.Findings = append(tr.Findings, f.String())
+		}
+		if i := r.ISAPI; i.Found() {
+			tr.ISAPI = &report.ISAPIInfo{Base: i.Base, Status: make(map[string]int), Open: i.OpenEndpoints(), Bypass: i.Bypass}
+			for _, e := range i.Endpoints {
+				tr.ISAPI.Status[e.Path] = e.Status
+			}
+			if len(tr.ISAPI.Open) > 0 {
+				tr.Notes = append(tr.Notes, "ISAPI OPEN: "+strings.Join(tr.ISAPI.Open, ", ")+" served without credentials")
+			}
+			if i.Bypass != "" {
+				tr.Notes = append(tr.Notes, "ISAPI AUTH BYPASS: "+probe.ISAPIBypassCVE+" snapshot served with a forged auth token")
+			}
+		}
+		if g := r.GSOAP; g.Found() {
+			tr.GSOAP = &report.GSOAPInfo{URL: g.URL, Version: g.Version, Evidence: g.Evidence, DevilsIvy: g.DevilsIvy()}
+			switch g.DevilsIvy() {
+			case "vulnerable":
+				tr.Notes = append(tr.Notes, "DEVIL'S IVY: gSOAP "+g.Version+" is affected by "+probe.DevilsIvyCVE)
+			case "possible":
+				tr.Notes = append(tr.Notes, "DEVIL'S IVY: gSOAP without a patch level may be affected by "+probe.DevilsIvyCVE)
+			}
+		}
+		for _, i := range r.P2P {
+			tr.P2P = append(tr.P2P, i.String())
+		}
+		if len(r.P2P) > 0 {
+			tr.Notes = append(tr.Notes, "P2P CLOUD: reachable through the vendor relay regardless of inbound filtering")
+		}
+		if r.BrandNote != "" {
+			tr.Notes = append(tr.Notes, r.BrandNote)
+		}
+		if len(r.FilteredPorts) > 0 {
+			tr.Notes = append(tr.Notes, fmt.Sprintf("Filtered ports: %v", r.FilteredPorts))
+		}
+		if len(r.ClosedPorts) > 0 {
+			tr.Notes = append(tr.Notes, fmt.Sprintf("Closed ports: %v", r.ClosedPorts))
+		}
+		if len(r.SCTPPorts) > 0 {
+			tr.Notes = append(tr.Notes, fmt.Sprintf("SCTP ports: %v", r.SCTPPorts))
+		}
+		if r.Partial {
+			tr.Notes = append(tr.Notes, fmt.Sprintf("Partial results: %v", r.Error))
+		}
+		out = append(out, tr)
+	}
+	return out
+}
+
+// toReportStream flattens the SDP tracks of an open stream
+func toReportStream(s probe.RTSPStream) report.RTSPStream {
+	rs := report.RTSPStream{URL: s.URL, Tracks: len(s.Media.Tracks), Audio: s.Media.HasAudio()}
+	if s.Checked {
+		rs.Viewable = &s.Viewable
+	}
+	for _, t := range s.Media.Tracks {
+		if t.Codec != "" {
+			rs.Codecs = append(rs.Codecs, t.Codec)
+		}
+		if t.Media == "video" && t.Width > 0 && rs.Resolution == "" {
+			rs.Resolution = fmt.Sprintf("%dx%d", t.Width, t.Height)
+		}
+	}
+	return rs
+}
+
+// hostCPEs names the device for vulnerability feeds
+func hostCPEs(r HostResult) []string {
+	model, firmware := r.DeviceIdentity()
+	return fingerprint.CPEs(r.Brand, model, firmware)
+}
+
+// upgradeNote names the firmware to upgrade to: the latest first fixed firmware
+// of the CVEs the running firmware is older than
+func upgradeNote(details []report.CVEInfo) string {
+	var running, target string
+	var fixes []string
+	for _, d := range details {
+		if d.Running == "" {
+			continue
+		}
+		running = d.Running
+		if target == "" || cvedb.FirmwareBefore(target, d.FixedIn) {
+			target = d.FixedIn
+		}
+		fixes = append(fixes, d.ID)
+	}
+	if target == "" {
+		return ""
+	}
+	return fmt.Sprintf("UPGRADE: running %s, fixed in %s (%s)", running, target, strings.Join(fixes, ", "))
+}
+
+// cveDetails returns the scores the CVE feed has for the CVEs of r, their EPSS
+// scores, the dates the KEV catalog added them, their public exploits, their
+// summaries, the notes of local feeds, the firmware fixing them and the outcome
+// of checks, the exploited and then the most severe first. Once a host was
+// checked, the CVEs no check covers are marked inferred.
+func cveDetails(r HostResult) []report.CVEInfo {
+	model, firmware := r.DeviceIdentity()
+	checks := r.CVEChecks
+	var details []report.CVEInfo
+	for _, id := range r.CVEs {
+		d := report.CVEInfo{ID: id}
+		d.FixedIn = cmp.Or(cvedb.FixedIn(id, r.Brand, model), cvedb.FixedIn(id, fingerprint.Platform(r.Brand), model))
+		if cvedb.FirmwareBefore(firmware, d.FixedIn) {
+			d.Running = firmware
+		}
+		if i := slices.IndexFunc(checks, func(c probe.CVECheck) bool { return c.CVE == id }); i >= 0 {
+			d.Status = checks[i].Status
+		} else if len(checks) > 0 {
+			d.Status = probe.CVEInferred
+		}
+		if e, ok := cvedb.Lookup(id); ok {
+			d.CVSS, d.Severity, d.Vector = e.CVSS, e.Severity, e.Vector
+		}
+		if k, ok := cvedb.KEV(id); ok {
+			d.KEV = k.DateAdded
+		}
+		if e, ok := cvedb.EPSSFor(id); ok {
+			d.EPSS, d.EPSSPercentile = e.Score, e.Percentile
+		}
+		x := cvedb.ExploitsFor(id)
+		d.Metasploit, d.ExploitDB = x.Metasploit, x.ExploitDB
+		d.Note, d.Summary = cvedb.LocalNote(id), cvedb.Summary(id)
+		if d.CVSS > 0 || d.KEV != "" || d.EPSS > 0 || !x.Empty() || d.Note != "" || d.Summary != "" || d.FixedIn != "" || d.Status != "" {
+			details = append(details, d)
+		}
+	}
+	exploited := func(d report.CVEInfo) int {
+		if d.KEV != "" {
+			return 1
+		}
+		return 0
+	}
+	slices.SortStableFunc(details, func(a, b report.CVEInfo) int {
+		return cmp.Or(cmp.Compare(exploited(b), exploited(a)), cmp.Compare(b.CVSS, a.CVSS))
+	})
+	return details
+}
+
+// cveLabels returns cves with the severity and score of those the CVE feed
+// scored, a mark on those exploited and the EPSS score, e.g. CVE-2021-36260
+// (CRITICAL 9.8, KEV, EPSS 0.944)
+func cveLabels(cves []string) []string {
+	labels := make([]string, len(cves))
+	for i, id := range cves {
+		var tags []string
+		if e, ok := cvedb.Lookup(id); ok && e.CVSS > 0 {
+			tags = append(tags, fmt.Sprintf("%s %.1f", e.Severity, e.CVSS))
+		}
+		if _, ok := cvedb.KEV(id); ok {
+			tags = append(tags, "KEV")
+		}
+		if e, ok := cvedb.EPSSFor(id); ok {
+			tags = append(tags, fmt.Sprintf("EPSS %.3f", e.Score))
+		}
+		labels[i] = id
+		if len(tags) > 0 {
+			labels[i] += " (" + strings.Join(tags, ", ") + ")"
+		}
+	}
+	return labels
+}
+
+// countViewable counts the streams that delivered RTP
+func countViewable(streams []probe.RTSPStream) int {
+	n := 0
+	for _, s := range streams {
+		if s.Viewable {
+			n++
+		}
+	}
+	return n
+}
+
+// WriteReports writes report.json and report.md to the processor's output directory
+func (p *OptimizedProcessor) WriteReports(results []HostResult) error {
+	if err := os.MkdirAll(p.outputDir, 0o755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+	entries := ToReport(results)
+	if err := report.WriteJSON(filepath.Join(p.outputDir, "report.json"), entries); err != nil {
+		return fmt.Errorf("failed to write JSON report: %w", err)
+	}
+	if err := report.WriteMarkdown(filepath.Join(p.outputDir, "report.md"), entries); err != nil {
+		return fmt.Errorf("failed to write Markdown report: %w", err)
+	}
+	return nil
+}
@@ -4,53 +4,657 @@ import (
 	"bytes"
 	"encoding/json"
 	"os"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
 )
 
 type TargetResult struct {
 	Host         string   `json:"host"`
+	Hostnames    []string `json:"hostnames,omitempty"` // Reverse DNS names
+	MAC          string   `json:"mac,omitempty"` // From the ARP cache, LAN targets only
+	MACVendor    string   `json:"mac_vendor,omitempty"` // Brand of the OUI
 	OpenPorts    []int    `json:"open_ports"`
 	ServerHeader string   `json:"server_header,omitempty"`
+	Titles       map[int]string `json:"titles,omitempty"` // HTML <title> per port
+	Redirects    map[int][]string `json:"redirects,omitempty"` // Redirect chain from / per port
+	TLSCerts     []TLSCert `json:"tls_certs,omitempty"` // Leaf certificate per HTTPS port
+	TLSHellos    []TLSHello `json:"tls_fingerprints,omitempty"` // ServerHello fingerprint per HTTPS port
+	HTTPStacks   []HTTPStack `json:"http_fingerprints,omitempty"` // Header order and 404 page per HTTP port
 	LoginPages   []string `json:"login_pages,omitempty"`
+	LoginAuth    map[string]AuthInfo `json:"login_auth,omitempty"` // Challenge per protected login URL
+	LoginStatus  map[string]PageStatus `json:"login_status,omitempty"` // Answer per login URL
+	Screenshots  map[string]string `json:"screenshots,omitempty"` // PNG per login URL, relative to the report
+	RTSPStreams  []RTSPStream `json:"rtsp_streams,omitempty"` // Play without authentication
+	HLSStreams   []string `json:"hls_streams,omitempty"` // Playlists served without authentication
+	P2P          []string `json:"p2p_cloud,omitempty"` // Vendor P2P cloud enrolment evidence
+	Latency      map[int]PortLatency `json:"latency,omitempty"` // Per port
+	Exposure     []ExposureFinding `json:"http_exposure,omitempty"` // Web UI audit findings
+	Findings     []string `json:"probe_findings,omitempty"` // From registered probes without a field of their own
+	RTSPAuth     map[int]AuthInfo `json:"rtsp_auth,omitempty"` // Challenge per RTSP port that answered 401
+	Class        string   `json:"class,omitempty"` // camera, recorder, encoder or vms
 	Brand        string   `json:"brand,omitempty"`
+	BrandConfidence float64 `json:"brand_confidence,omitempty"` // 0 to 1; absent when not scored
+	BrandWhy     []BrandMatch `json:"brand_why,omitempty"` // Patterns that named the brand
+	Platform     string   `json:"platform,omitempty"` // Manufacturer behind a white-label brand
+	BrandCandidates []BrandCandidate `json:"brand_candidates,omitempty"` // Most likely first
+	Model        string   `json:"model,omitempty"` // Most specific model number found
+	ModelLine    string   `json:"model_line,omitempty"` // Product line of the model, e.g. DS-76xx NVR
+	Firmware     string   `json:"firmware,omitempty"` // From the brand's device endpoint, ONVIF or SADP, else the brand's version pattern
+	Serial       string   `json:"serial,omitempty"`   // Serial number or device ID, to follow a device across address changes
+	Locale       string   `json:"locale,omitempty"`   // Language of the web UI, e.g. zh-CN
+	SoC          string   `json:"soc,omitempty"`      // Chip family the firmware is built on, e.g. HiSilicon
 	CVEs         []string `json:"cves,omitempty"`
 	CVELinks     []string `json:"cve_links,omitempty"`
+	CVEDetails   []CVEInfo `json:"cve_details,omitempty"` // Scored, summarized or exploited CVEs, exploited and most severe first
+	Advisories   []Advisory `json:"advisories,omitempty"` // Vulners bulletins for the firmware
+	CPEs         []string `json:"cpe,omitempty"` // cpe:2.3 names of the firmware and hardware
+	EOL          *EOLInfo `json:"end_of_life,omitempty"` // Model or firmware line no longer supported by the vendor
+	Honeypot     []string `json:"honeypot,omitempty"` // Signs the host is a honeypot posing as a camera
 	FoundCred    string   `json:"found_cred,omitempty"`
+	CredProof    string   `json:"found_cred_proof,omitempty"` // Model and firmware read with FoundCred, and where
+	Logins       []Login  `json:"logins,omitempty"` // Every credential that logged in; FoundCred is the first
+	Lockout      string   `json:"lockout,omitempty"` // Why credential testing stopped, e.g. lockout triggered at URL
+	ONVIFDevice  *ONVIFDevice `json:"onvif_device,omitempty"`
+	ONVIFDiscovery *ONVIFDiscovery `json:"onvif_discovery,omitempty"` // Unicast WS-Discovery ProbeMatch
+	ONVIFServices []string `json:"onvif_services,omitempty"` // Device services answering GetSystemDateAndTime
+	GSOAP        *GSOAPInfo `json:"gsoap,omitempty"` // SOAP stack of the ONVIF device service
+	ISAPI        *ISAPIInfo `json:"isapi,omitempty"` // Hikvision ISAPI resources
+	Nuclei       []NucleiMatch `json:"nuclei,omitempty"` // Matched nuclei templates
+	Device       *DeviceInfo `json:"device,omitempty"` // From the brand's own device information endpoint
+	SADPDevice   *SADPDevice `json:"sadp_device,omitempty"`
+	SNMP         *SNMPInfo `json:"snmp,omitempty"`
+	Telnet       map[int]string `json:"telnet_banners,omitempty"` // Pre-login banner per telnet port
+	SSH          *SSHInfo `json:"ssh,omitempty"`
+	FTP          *FTPInfo `json:"ftp,omitempty"`
+	SIP          *SIPInfo `json:"sip,omitempty"`
+	MDNSServices []string `json:"mdns_services,omitempty"` // Bonjour instances with service and port
 	Notes        []string `json:"notes,omitempty"`
 }
 
+// BrandCandidate is a brand the HTTP and RTSP evidence points to
+type BrandCandidate struct {
+	Brand      string   `json:"brand"`
+	Confidence float64  `json:"confidence"`
+	Evidence   []string `json:"evidence"` // e.g. port 80 header "hikvision"
+}
+
+// BrandMatch is a pattern that named the brand and the text it matched
+type BrandMatch struct {
+	Method  string `json:"method"` // e.g. header, title, body, rtsp, or the detector such as cert
+	Pattern string `json:"pattern,omitempty"` // Keyword or regexp of the signature
+	Text    string `json:"text"`
+	Port    int    `json:"port,omitempty"`
+}
+
+// Advisory is a bulletin Vulners lists for the firmware, such as a vendor advisory
+type Advisory struct {
+	ID    string   `json:"id"`
+	Title string   `json:"title,omitempty"`
+	CVSS  float64  `json:"cvss,omitempty"`
+	CVEs  []string `json:"cves,omitempty"`
+}
+
+// CVEInfo is the CVSS v3 score of a CVE, whether it is exploited in the wild, how
+// likely it is to be and the public exploits
+type CVEInfo struct {
+	ID             string   `json:"id"`
+	CVSS           float64  `json:"cvss,omitempty"`
+	Severity       string   `json:"severity,omitempty"` // CRITICAL, HIGH, MEDIUM or LOW
+	Vector         string   `json:"cvss_vector,omitempty"`
+	KEV            string   `json:"kev_added,omitempty"` // Date CISA added it to the Known Exploited Vulnerabilities catalog
+	EPSS           float64  `json:"epss,omitempty"`      // Probability of exploitation in the next 30 days
+	EPSSPercentile float64  `json:"epss_percentile,omitempty"`
+	Metasploit     []string `json:"metasploit,omitempty"` // Module names
+	ExploitDB      []string `json:"exploitdb,omitempty"`  // Exploit-DB IDs
+	Summary        string   `json:"summary,omitempty"`    // One-line description from the CVE feed
+	Note           string   `json:"note,omitempty"`       // From a local CVE file
+	FixedIn        string   `json:"fixed_in,omitempty"`   // First firmware fixing it for the model, from a local CVE file or the NVD
+	Running        string   `json:"running,omitempty"`    // Firmware of the host, when older than FixedIn
+	Status         string   `json:"status,omitempty"`     // confirmed, possible or not confirmed by -check-cves, else inferred; "" when not checked
+}
+
+// EOLInfo is the vendor's end of life or end of support covering the device
+type EOLInfo struct {
+	Status   string `json:"status"` // end-of-life or end-of-support
+	Since    string `json:"since,omitempty"`
+	Note     string `json:"note,omitempty"`
+	Model    string `json:"model,omitempty"`
+	Firmware string `json:"firmware,omitempty"`
+}
+
+// ONVIFDiscovery is what the device announced in its WS-Discovery scopes
+type ONVIFDiscovery struct {
+	Name     string   `json:"name,omitempty"`
+	Hardware string   `json:"hardware,omitempty"`
+	Location string   `json:"location,omitempty"`
+	XAddrs   []string `json:"xaddrs,omitempty"` // Device service URLs
+}
+
+// ISAPIInfo is how the Hikvision ISAPI resources answered without credentials
+type ISAPIInfo struct {
+	Base   string         `json:"base"`
+	Status map[string]int `json:"status"` // HTTP status per path
+	Open   []string       `json:"open,omitempty"` // Served without credentials
+	Bypass string         `json:"cve_2017_7921_snapshot,omitempty"` // Snapshot served through the forged auth token
+}
+
+// NucleiMatch is a nuclei template that matched
+type NucleiMatch struct {
+	Template  string   `json:"template"`
+	Name      string   `json:"name,omitempty"`
+	Severity  string   `json:"severity"`
+	URL       string   `json:"url"`
+	CVEs      []string `json:"cves,omitempty"`
+	Extracted []string `json:"extracted,omitempty"` // Values pulled out by the template's extractors
+}
+
+// GSOAPInfo is the gSOAP release behind the ONVIF device service
+type GSOAPInfo struct {
+	URL       string `json:"url"`
+	Version   string `json:"version,omitempty"`
+	Evidence  string `json:"evidence"`
+	DevilsIvy string `json:"devils_ivy"` // CVE-2017-9765: vulnerable, possible or patched
+}
+
+// Login is a credential that logged in to a host, and how
+type Login struct {
+	URL        string `json:"url"`
+	Credential string `json:"credential"` // user:pass
+	Auth       string `json:"auth"`       // Basic, Digest, RPC2 or DVRIP
+	Proof      string `json:"proof,omitempty"` // Model and firmware read with the credential, and where
+}
+
+// ONVIFDevice is the device identity returned by ONVIF GetDeviceInformation
+type ONVIFDevice struct {
+	Manufacturer    string   `json:"manufacturer,omitempty"`
+	Model           string   `json:"model,omitempty"`
+	FirmwareVersion string   `json:"firmware_version,omitempty"`
+	SerialNumber    string   `json:"serial_number,omitempty"`
+	HardwareID      string   `json:"hardware_id,omitempty"`
+	URL             string   `json:"url,omitempty"`
+	Authenticated   bool     `json:"authenticated,omitempty"`
+	Credential      string   `json:"credential,omitempty"` // Default user:pass the device service accepted in a UsernameToken
+	Operations      []string `json:"operations,omitempty"` // Calls the credential opens, e.g. GetUsers
+	SnapshotURIs    []string `json:"snapshot_uris,omitempty"` // GetSnapshotUri per media profile
+	Snapshot        string   `json:"snapshot,omitempty"`      // Saved image, relative to the report
+}
+
+// DeviceInfo is the model and firmware read from a brand specific endpoint such as
+// Hikvision ISAPI or Axis VAPIX
+type DeviceInfo struct {
+	Model         string `json:"model,omitempty"`
+	Firmware      string `json:"firmware,omitempty"`
+	SerialNumber  string `json:"serial_number,omitempty"`
+	MAC           string `json:"mac,omitempty"`
+	DeviceType    string `json:"device_type,omitempty"`
+	URL           string `json:"url,omitempty"`
+	Authenticated bool   `json:"authenticated,omitempty"`
+}
+
+// ExposureFinding is a security relevant observation about a web UI
+type ExposureFinding struct {
+	Kind     string `json:"kind"` // e.g. unauthenticated-admin, directory-listing, config-backup
+	Severity string `json:"severity"`
+	URL      string `json:"url"`
+	Detail   string `json:"detail,omitempty"`
+}
+
+// PortLatency is the responsiveness of one port
+type PortLatency struct {
+	ConnectMs int64 `json:"connect_ms"` // Mean TCP connect time
+	TTFBMs    int64 `json:"ttfb_ms,omitempty"` // HTTP time to first byte of GET /
+	Attempts  int   `json:"attempts"`
+	Failures  int   `json:"failures,omitempty"`
+}
+
+// SADPDevice is the identity a Hikvision device announced over SADP
+type SADPDevice struct {
+	DeviceType      string `json:"device_type,omitempty"`
+	Model           string `json:"model,omitempty"`
+	FirmwareVersion string `json:"firmware_version,omitempty"`
+	SerialNumber    string `json:"serial_number,omitempty"`
+	MAC             string `json:"mac,omitempty"`
+	Activated       *bool  `json:"activated,omitempty"` // nil when the firmware doesn't say
+}
+
+// SNMPInfo is the MIB-II system group read over SNMP
+type SNMPInfo struct {
+	Community   string `json:"community"`
+	SysDescr    string `json:"sys_descr,omitempty"`
+	SysObjectID string `json:"sys_object_id,omitempty"`
+	SysName     string `json:"sys_name,omitempty"`
+}
+
+// SSHInfo is the SSH version string and host key; identical keys across hosts point
+// at the same vendor firmware image
+type SSHInfo struct {
+	Port        int    `json:"port"`
+	Banner      string `json:"banner"`
+	HostKeyType string `json:"host_key_type,omitempty"`
+	Fingerprint string `json:"host_key_fingerprint,omitempty"`
+}
+
+// TLSCert is the certificate an HTTPS port presented
+type TLSCert struct {
+	Port       int      `json:"port"`
+	Subject    string   `json:"subject"`
+	Issuer     string   `json:"issuer,omitempty"`
+	DNSNames   []string `json:"dns_names,omitempty"`
+	SHA256     string   `json:"sha256"`
+	NotAfter   string   `json:"not_after,omitempty"` // YYYY-MM-DD
+	SelfSigned bool     `json:"self_signed,omitempty"`
+}
+
+// TLSHello is the TLS stack fingerprint of an HTTPS port
+type TLSHello struct {
+	Port    int    `json:"port"`
+	Version string `json:"version"` // e.g. TLS 1.2
+	Cipher  string `json:"cipher"`
+	ALPN    string `json:"alpn,omitempty"`
+	JA3S    string `json:"ja3s"`
+	JA3SRaw string `json:"ja3s_raw"` // Version, cipher and extensions the JA3S hash covers
+	JA4S    string `json:"ja4s"`
+}
+
+// HTTPStack is how the web server of a port answered a path that doesn't exist
+type HTTPStack struct {
+	Port        int    `json:"port"`
+	Status      int    `json:"status"`
+	HeaderOrder string `json:"header_order"` // Header names in the order and case sent
+	Title       string `json:"title,omitempty"` // Of the error page
+}
+
+// FTPInfo is the FTP greeting and the outcome of an anonymous login
+type FTPInfo struct {
+	Port      int    `json:"port"`
+	Banner    string `json:"banner"`
+	Anonymous bool   `json:"anonymous"`
+}
+
+// RTSPStream is a stream that plays without authentication and what its SDP carries
+type RTSPStream struct {
+	URL        string   `json:"url"`
+	Codecs     []string `json:"codecs,omitempty"`     // One per track, e.g. H264, PCMA
+	Resolution string   `json:"resolution,omitempty"` // Of the video track, e.g. 1920x1080
+	Tracks     int      `json:"tracks,omitempty"`
+	Audio      bool     `json:"audio,omitempty"`
+	Viewable   *bool    `json:"viewable,omitempty"` // RTP arrived after PLAY; nil when not checked
+}
+
+// SIPInfo is a SIP endpoint's answer to OPTIONS/REGISTER and its GB28181 identity
+type SIPInfo struct {
+	Transport string   `json:"transport"`
+	Port      int      `json:"port"`
+	Status    string   `json:"status"`
+	Server    string   `json:"server,omitempty"`
+	Realm     string   `json:"realm,omitempty"`
+	DeviceIDs []string `json:"gb28181_device_ids,omitempty"`
+	GB28181   bool     `json:"gb28181"`
+}
+
+// AuthInfo is the authentication a login URL or RTSP port asks for
+type AuthInfo struct {
+	Scheme string `json:"scheme"`
+	Realm  string `json:"realm,omitempty"`
+}
+
+// PageStatus is how a login URL answered
+type PageStatus struct {
+	Status      int    `json:"status"`
+	ContentType string `json:"content_type,omitempty"`
+}
+
+// WriteJSON writes all results as a single JSON array
+func WriteJSON(path string, results []TargetResult) error {
+	j, err := json.MarshalIndent(results, "", "  ")
+	if err != nil { return err }
+	return os.WriteFile(path, j, 0o644)
+}
+
+// classSections group hosts in the Markdown report from the widest exposure to
+// the narrowest: a VMS server or recorder holds the footage and credentials of
+// the cameras behind it
+var classSections = []struct{ class, title string }{
+	{"vms", "VMS servers"}, {"recorder", "Recorders (NVR/DVR)"}, {"encoder", "Encoders"}, {"camera", "Cameras"}, {"", "Unclassified"},
+}
+
+func classRank(class string) int {
+	for i, s := range classSections { if s.class == class { return i } }
+	return len(classSections) - 1
+}
+
 func WriteMarkdown(path string, results []TargetResult) error {
 	var b bytes.Buffer
 	b.WriteString("# CCTV Toolkit Report\n\n")
-	sort.Slice(results, func(i, j int) bool { return results[i].Host < results[j].Host })
+	sort.Slice(results, func(i, j int) bool {
+		if ri, rj := classRank(results[i].Class), classRank(results[j].Class); ri != rj { return ri < rj }
+		return results[i].Host < results[j].Host
+	})
+	if slices.ContainsFunc(results, func(r TargetResult) bool { return r.Class != "" }) {
+		b.WriteString("Hosts by class:\n")
+		for i, s := range classSections {
+			var hosts []string
+			for _, r := range results { if classRank(r.Class) == i { hosts = append(hosts, r.Host) } }
+			if len(hosts) > 0 { b.WriteString("- " + s.title + ": " + strings.Join(hosts, ", ") + "\n") }
+		}
+		b.WriteString("\n")
+	}
 	for _, r := range results {
 		b.WriteString("## " + r.Host + "\n\n")
+		if r.Class != "" { b.WriteString("Class: " + r.Class + "\n\n") }
+		if len(r.Hostnames) > 0 {
+			b.WriteString("Hostnames: " + strings.Join(r.Hostnames, ", ") + "\n\n")
+		}
+		if r.MAC != "" {
+			b.WriteString("MAC: " + r.MAC)
+			if r.MACVendor != "" { b.WriteString(" (" + r.MACVendor + ")") }
+			b.WriteString("\n\n")
+		}
 		if len(r.OpenPorts) > 0 {
 			b.WriteString("Open ports: " + intsToCSV(r.OpenPorts) + "\n\n")
 		}
 		if r.ServerHeader != "" {
 			b.WriteString("Server: " + r.ServerHeader + "\n\n")
 		}
+		if len(r.Titles) > 0 {
+			ports := make([]int, 0, len(r.Titles))
+			for p := range r.Titles { ports = append(ports, p) }
+			sort.Ints(ports)
+			b.WriteString("Page titles:\n")
+			for _, p := range ports { b.WriteString("- " + fmtInt(int64(p)) + ": " + r.Titles[p] + "\n") }
+			b.WriteString("\n")
+		}
+		if len(r.Redirects) > 0 {
+			ports := make([]int, 0, len(r.Redirects))
+			for p := range r.Redirects { ports = append(ports, p) }
+			sort.Ints(ports)
+			b.WriteString("Redirects:\n")
+			for _, p := range ports { b.WriteString("- " + fmtInt(int64(p)) + ": / -> " + strings.Join(r.Redirects[p], " -> ") + "\n") }
+			b.WriteString("\n")
+		}
 		if r.Brand != "" {
-			b.WriteString("Brand: " + r.Brand + "\n\n")
+			b.WriteString("Brand: " + r.Brand)
+			if r.BrandConfidence > 0 { b.WriteString(" (confidence " + strconv.FormatFloat(r.BrandConfidence, 'f', 2, 64) + ")") }
+			if r.Platform != "" { b.WriteString(", " + r.Platform + " platform") }
+			b.WriteString("\n\n")
+			if r.Model != "" {
+				b.WriteString("Model: " + r.Model)
+				if r.ModelLine != "" { b.WriteString(" (" + r.ModelLine + ")") }
+				b.WriteString("\n\n")
+			}
+			if r.Firmware != "" { b.WriteString("Firmware: " + r.Firmware + "\n\n") }
+			if r.Serial != "" { b.WriteString("Serial: " + r.Serial + "\n\n") }
+			if r.Locale != "" { b.WriteString("Web UI language: " + r.Locale + "\n\n") }
+			if r.SoC != "" { b.WriteString("SoC: " + r.SoC + "\n\n") }
+			if len(r.BrandCandidates) > 1 {
+				b.WriteString("Brand candidates:\n")
+				for _, c := range r.BrandCandidates {
+					b.WriteString("- " + c.Brand + " " + strconv.FormatFloat(c.Confidence, 'f', 2, 64) + ": " + strings.Join(c.Evidence, ", ") + "\n")
+				}
+				b.WriteString("\n")
+			}
+		}
+		if d := r.ONVIFDevice; d != nil {
+			b.WriteString("ONVIF device: " + d.Manufacturer + " " + d.Model)
+			if d.FirmwareVersion != "" { b.WriteString(", firmware " + d.FirmwareVersion) }
+			if d.SerialNumber != "" { b.WriteString(", serial " + d.SerialNumber) }
+			if d.Authenticated { b.WriteString(" (authenticated)") }
+			b.WriteString("\n\n")
+			if d.Credential != "" { b.WriteString("ONVIF default credential found: `" + d.Credential + "`, opens " + strings.Join(d.Operations, ", ") + "\n\n") }
+			if len(d.SnapshotURIs) > 0 {
+				b.WriteString("ONVIF snapshot URIs:\n")
+				for _, u := range d.SnapshotURIs { b.WriteString("- " + u + "\n") }
+				b.WriteString("\n")
+			}
+			if d.Snapshot != "" { b.WriteString("ONVIF snapshot: [" + d.Snapshot + "](" + d.Snapshot + ")\n\n") }
+		}
+		if d := r.ONVIFDiscovery; d != nil {
+			b.WriteString("ONVIF discovery:")
+			if d.Name != "" { b.WriteString(" name " + d.Name + ";") }
+			if d.Hardware != "" { b.WriteString(" hardware " + d.Hardware + ";") }
+			if d.Location != "" { b.WriteString(" location " + d.Location + ";") }
+			if len(d.XAddrs) > 0 { b.WriteString(" XAddrs " + strings.Join(d.XAddrs, " ")) }
+			b.WriteString("\n\n")
+		}
+		if i := r.ISAPI; i != nil {
+			paths := make([]string, 0, len(i.Status))
+			for p := range i.Status { paths = append(paths, p) }
+			sort.Strings(paths)
+			b.WriteString("ISAPI at " + i.Base + ":\n")
+			for _, p := range paths { b.WriteString("- " + p + ": " + fmtInt(int64(i.Status[p])) + "\n") }
+			if i.Bypass != "" { b.WriteString("- **CVE-2017-7921 snapshot:** " + i.Bypass + "\n") }
+			b.WriteString("\n")
+		}
+		if g := r.GSOAP; g != nil {
+			b.WriteString("gSOAP: " + g.Version + " at " + g.URL + " (" + g.Evidence + "); CVE-2017-9765 " + g.DevilsIvy + "\n\n")
+		}
+		if len(r.ONVIFServices) > 0 {
+			b.WriteString("ONVIF device services:\n")
+			for _, u := range r.ONVIFServices { b.WriteString("- " + u + "\n") }
+			b.WriteString("\n")
+		}
+		if d := r.Device; d != nil {
+			b.WriteString("Device: " + d.Model)
+			if d.Firmware != "" { b.WriteString(", firmware " + d.Firmware) }
+			if d.SerialNumber != "" { b.WriteString(", serial " + d.SerialNumber) }
+			if d.MAC != "" { b.WriteString(", MAC " + d.MAC) }
+			if d.Authenticated { b.WriteString(" (authenticated)") }
+			b.WriteString("\n\n")
+		}
+		if d := r.SADPDevice; d != nil {
+			b.WriteString("SADP device: " + d.Model)
+			if d.FirmwareVersion != "" { b.WriteString(", firmware " + d.FirmwareVersion) }
+			if d.SerialNumber != "" { b.WriteString(", serial " + d.SerialNumber) }
+			if d.MAC != "" { b.WriteString(", MAC " + d.MAC) }
+			if d.Activated != nil && !*d.Activated { b.WriteString(" (**not activated**)") }
+			b.WriteString("\n\n")
+		}
+		if s := r.SNMP; s != nil {
+			b.WriteString("SNMP (community `" + s.Community + "`): " + s.SysDescr)
+			if s.SysName != "" { b.WriteString(", sysName " + s.SysName) }
+			if s.SysObjectID != "" { b.WriteString(", sysObjectID " + s.SysObjectID) }
+			b.WriteString("\n\n")
+		}
+		if len(r.TLSCerts) > 0 {
+			b.WriteString("TLS certificates:\n")
+			for _, c := range r.TLSCerts {
+				b.WriteString("- " + fmtInt(int64(c.Port)) + ": `" + c.Subject + "`")
+				if c.SelfSigned { b.WriteString(" (self-signed)") } else if c.Issuer != "" { b.WriteString(", issuer `" + c.Issuer + "`") }
+				if c.NotAfter != "" { b.WriteString(", expires " + c.NotAfter) }
+				b.WriteString(", SHA-256 `" + c.SHA256 + "`\n")
+			}
+			b.WriteString("\n")
+		}
+		if len(r.TLSHellos) > 0 {
+			b.WriteString("TLS fingerprints:\n")
+			for _, h := range r.TLSHellos { b.WriteString("- " + fmtInt(int64(h.Port)) + ": JA4S `" + h.JA4S + "`, JA3S `" + h.JA3S + "` (" + h.Version + ", " + h.Cipher + ")\n") }
+			b.WriteString("\n")
+		}
+		if len(r.HTTPStacks) > 0 {
+			b.WriteString("HTTP fingerprints:\n")
+			for _, s := range r.HTTPStacks {
+				b.WriteString("- " + fmtInt(int64(s.Port)) + ": " + fmtInt(int64(s.Status)) + " `" + s.HeaderOrder + "`")
+				if s.Title != "" { b.WriteString(", " + s.Title) }
+				b.WriteString("\n")
+			}
+			b.WriteString("\n")
+		}
+		if s := r.SSH; s != nil {
+			b.WriteString("SSH (" + fmtInt(int64(s.Port)) + "): `" + s.Banner + "`")
+			if s.Fingerprint != "" { b.WriteString(", host key " + s.HostKeyType + " `" + s.Fingerprint + "`") }
+			b.WriteString("\n\n")
+		}
+		if f := r.FTP; f != nil {
+			b.WriteString("FTP (" + fmtInt(int64(f.Port)) + "): `" + f.Banner + "`")
+			if f.Anonymous { b.WriteString(" (**anonymous login allowed**)") }
+			b.WriteString("\n\n")
+		}
+		if s := r.SIP; s != nil {
+			b.WriteString("SIP (" + s.Transport + "/" + fmtInt(int64(s.Port)) + "): `" + s.Status + "`")
+			if s.Server != "" { b.WriteString(", server `" + s.Server + "`") }
+			if s.GB28181 && s.Realm != "" { b.WriteString(" (**GB28181**, realm " + s.Realm + ")") } else if s.GB28181 { b.WriteString(" (**GB28181**)") }
+			b.WriteString("\n\n")
+			for _, id := range s.DeviceIDs { b.WriteString("- GB28181 device `" + id + "`\n") }
+			if len(s.DeviceIDs) > 0 { b.WriteString("\n") }
+		}
+		if len(r.Telnet) > 0 {
+			ports := make([]int, 0, len(r.Telnet))
+			for p := range r.Telnet { ports = append(ports, p) }
+			sort.Ints(ports)
+			for _, p := range ports { b.WriteString("Telnet banner (" + fmtInt(int64(p)) + "):\n```\n" + r.Telnet[p] + "\n```\n\n") }
+		}
+		if len(r.MDNSServices) > 0 {
+			b.WriteString("mDNS services:\n")
+			for _, svc := range r.MDNSServices { b.WriteString("- " + svc + "\n") }
+			b.WriteString("\n")
+		}
+		if len(r.CPEs) > 0 {
+			b.WriteString("CPE:\n")
+			for _, c := range r.CPEs { b.WriteString("- `" + c + "`\n") }
+			b.WriteString("\n")
+		}
+		if len(r.Honeypot) > 0 {
+			b.WriteString("**Likely honeypot:**\n")
+			for _, s := range r.Honeypot { b.WriteString("- " + s + "\n") }
+			b.WriteString("\n")
+		}
+		if e := r.EOL; e != nil {
+			b.WriteString("**Unsupported device:** " + e.Status)
+			if e.Since != "" { b.WriteString(" since " + e.Since) }
+			if d := strings.TrimSpace(e.Model + " " + e.Firmware); d != "" { b.WriteString(" (" + d + ")") }
+			if e.Note != "" { b.WriteString(": " + e.Note) }
+			b.WriteString("\n\n")
 		}
 		if len(r.CVEs) > 0 {
 			b.WriteString("CVEs:\n")
 			for i := range r.CVEs {
 				b.WriteString("- " + r.CVEs[i])
+				for _, d := range r.CVEDetails {
+					if d.ID != r.CVEs[i] { continue }
+					if d.CVSS > 0 { b.WriteString(" **" + d.Severity + " " + strconv.FormatFloat(d.CVSS, 'f', 1, 64) + "**") }
+					if d.KEV != "" { b.WriteString(" **KNOWN EXPLOITED**") }
+					if d.Status == "confirmed" { b.WriteString(" **CONFIRMED**") } else if d.Status != "" { b.WriteString(" _" + d.Status + "_") }
+					if d.EPSS > 0 { b.WriteString(" EPSS " + strconv.FormatFloat(d.EPSS, 'f', 3, 64)) }
+					for _, m := range d.Metasploit { b.WriteString(" Metasploit `" + m + "`") }
+					for _, id := range d.ExploitDB { b.WriteString(" [EDB-" + id + "](https://www.exploit-db.com/exploits/" + id + ")") }
+					if d.Note != "" { b.WriteString(": " + d.Note) }
+					if d.Summary != "" { b.WriteString(" — " + d.Summary) }
+					if d.Running != "" { b.WriteString(" (running " + d.Running + ", fixed in " + d.FixedIn + ")") } else if d.FixedIn != "" { b.WriteString(" (fixed in " + d.FixedIn + ")") }
+				}
 				if i < len(r.CVELinks) { b.WriteString("  (" + r.CVELinks[i] + ")") }
 				b.WriteString("\n")
 			}
 			b.WriteString("\n")
 		}
+		if len(r.Advisories) > 0 {
+			b.WriteString("Advisories (Vulners):\n")
+			for _, a := range r.Advisories {
+				b.WriteString("- " + a.ID)
+				if a.CVSS > 0 { b.WriteString(" **" + strconv.FormatFloat(a.CVSS, 'f', 1, 64) + "**") }
+				if a.Title != "" { b.WriteString(": " + a.Title) }
+				if len(a.CVEs) > 0 { b.WriteString(" (" + strings.Join(a.CVEs, ", ") + ")") }
+				b.WriteString("\n")
+			}
+			b.WriteString("\n")
+		}
 		if len(r.LoginPages) > 0 {
 			b.WriteString("Login pages:\n")
-			for _, u := range r.LoginPages { b.WriteString("- " + u + "\n") }
+			for _, u := range r.LoginPages {
+				b.WriteString("- " + u)
+				if s, ok := r.LoginStatus[u]; ok {
+					b.WriteString(": " + fmtInt(int64(s.Status)))
+					if s.ContentType != "" { b.WriteString(" " + s.ContentType) }
+				}
+				if a, ok := r.LoginAuth[u]; ok { b.WriteString(" (" + authString(a) + ")") }
+				if shot, ok := r.Screenshots[u]; ok { b.WriteString(" [screenshot](" + shot + ")") }
+				b.WriteString("\n")
+			}
 			b.WriteString("\n")
 		}
-		if r.FoundCred != "" {
-			b.WriteString("Default credential found: `" + r.FoundCred + "`\n\n")
+		if len(r.RTSPStreams) > 0 {
+			b.WriteString("**Open RTSP streams (no authentication required):**\n")
+			for _, s := range r.RTSPStreams {
+				b.WriteString("- " + s.URL)
+				if len(s.Codecs) > 0 {
+					b.WriteString(" (" + strings.Join(s.Codecs, ", "))
+					if s.Resolution != "" { b.WriteString(", " + s.Resolution) }
+					b.WriteString(")")
+				}
+				if s.Viewable != nil && *s.Viewable { b.WriteString(" **viewable**") } else if s.Viewable != nil { b.WriteString(" advertised only") }
+				b.WriteString("\n")
+			}
+			b.WriteString("\n")
+		}
+		if len(r.HLSStreams) > 0 {
+			b.WriteString("**Open HLS streams (no authentication required):**\n")
+			for _, u := range r.HLSStreams { b.WriteString("- " + u + "\n") }
+			b.WriteString("\n")
+		}
+		if len(r.Exposure) > 0 {
+			b.WriteString("**HTTP exposure:**\n")
+			for _, f := range r.Exposure { b.WriteString("- " + f.Severity + " " + f.Kind + ": " + f.URL + " (" + f.Detail + ")\n") }
+			b.WriteString("\n")
+		}
+		if len(r.Nuclei) > 0 {
+			b.WriteString("Nuclei matches:\n")
+			for _, m := range r.Nuclei {
+				b.WriteString("- " + m.Severity + " " + m.Template + ": " + m.URL)
+				if len(m.Extracted) > 0 { b.WriteString(" [" + strings.Join(m.Extracted, ", ") + "]") }
+				b.WriteString("\n")
+			}
+			b.WriteString("\n")
+		}
+		if len(r.Findings) > 0 {
+			b.WriteString("Probe findings:\n")
+			for _, f := range r.Findings { b.WriteString("- " + f + "\n") }
+			b.WriteString("\n")
+		}
+		if len(r.Latency) > 0 {
+			ports := make([]int, 0, len(r.Latency))
+			for p := range r.Latency { ports = append(ports, p) }
+			sort.Ints(ports)
+			b.WriteString("Latency:\n")
+			for _, p := range ports {
+				l := r.Latency[p]
+				b.WriteString("- " + fmtInt(int64(p)) + ": ")
+				if l.Failures >= l.Attempts {
+					b.WriteString("no answer\n")
+					continue
+				}
+				b.WriteString("connect " + fmtInt(l.ConnectMs) + " ms")
+				if l.TTFBMs > 0 { b.WriteString(", TTFB " + fmtInt(l.TTFBMs) + " ms") }
+				if l.Failures > 0 { b.WriteString(", " + fmtInt(int64(l.Failures)) + "/" + fmtInt(int64(l.Attempts)) + " connects failed") }
+				b.WriteString("\n")
+			}
+			b.WriteString("\n")
+		}
+		if len(r.P2P) > 0 {
+			b.WriteString("**P2P cloud enrolment:**\n")
+			for _, p := range r.P2P { b.WriteString("- " + p + "\n") }
+			b.WriteString("\n")
+		}
+		if len(r.RTSPAuth) > 0 {
+			ports := make([]int, 0, len(r.RTSPAuth))
+			for p := range r.RTSPAuth { ports = append(ports, p) }
+			sort.Ints(ports)
+			b.WriteString("RTSP authentication:\n")
+			for _, p := range ports { b.WriteString("- " + fmtInt(int64(p)) + ": " + authString(r.RTSPAuth[p]) + "\n") }
+			b.WriteString("\n")
+		}
+		if len(r.Logins) > 0 {
+			b.WriteString("Default credentials found:\n")
+			for _, l := range r.Logins {
+				b.WriteString("- `" + l.Credential + "` (" + l.Auth + ") at " + l.URL)
+				if l.Proof != "" { b.WriteString(", verified: " + l.Proof) }
+				b.WriteString("\n")
+			}
+			b.WriteString("\n")
+		} else if r.FoundCred != "" {
+			b.WriteString("Default credential found: `" + r.FoundCred + "`")
+			if r.CredProof != "" { b.WriteString(" (verified: " + r.CredProof + ")") }
+			b.WriteString("\n\n")
 		}
 		if len(r.Notes) > 0 {
 			b.WriteString("Notes:\n")
@@ -61,6 +665,12 @@ func WriteMarkdown(path string, results []TargetResult) error {
 	return os.WriteFile(path, b.Bytes(), 0o644)
 }
 
+// authString formats a challenge as `Digest, realm "x"`
+func authString(a AuthInfo) string {
+	if a.Realm == "" { return a.Scheme }
+	return a.Scheme + `, realm "` + a.Realm + `"`
+}
+
 func intsToCSV(in []int) string {
 	var sb strings.Builder
 	for i, v := range in {
@@ -1,9 +1,75 @@
 package report
 
-import "testing"
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
 
 func TestJSON(t *testing.T) {
 	tr := TargetResult{Host:"1.2.3.4", OpenPorts: []int{80,554}}
 	if len(tr.JSON())==0 { t.Fatal("want json") }
 }
 
+
+func TestWriteMarkdownTitles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.md")
+	results := []TargetResult{{Host: "1.2.3.4", OpenPorts: []int{80, 8080}, Titles: map[int]string{8080: "WEB SERVICE", 80: "NETSurveillance WEB"}}}
+	if err := WriteMarkdown(path, results); err != nil { t.Fatal(err) }
+	b, err := os.ReadFile(path)
+	if err != nil { t.Fatal(err) }
+	if !strings.Contains(string(b), "- 80: NETSurveillance WEB\n- 8080: WEB SERVICE\n") {
+		t.Fatalf("titles missing or unordered:\n%s", b)
+	}
+}
+
+func TestWriteMarkdownScreenshots(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.md")
+	u := "http://1.2.3.4/doc/page/login.asp"
+	results := []TargetResult{{Host: "1.2.3.4", LoginPages: []string{u}, Screenshots: map[string]string{u: "screenshots/1.2.3.4_80_doc_page_login.asp.png"}}}
+	if err := WriteMarkdown(path, results); err != nil { t.Fatal(err) }
+	b, err := os.ReadFile(path)
+	if err != nil { t.Fatal(err) }
+	if !strings.Contains(string(b), "- "+u+" [screenshot](screenshots/1.2.3.4_80_doc_page_login.asp.png)\n") {
+		t.Fatalf("screenshot link missing:\n%s", b)
+	}
+}
+
+func TestWriteMarkdownRedirects(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.md")
+	results := []TargetResult{{Host: "1.2.3.4", Redirects: map[int][]string{80: {"https://1.2.3.4/", "https://1.2.3.4/doc/page/login.asp"}}}}
+	if err := WriteMarkdown(path, results); err != nil { t.Fatal(err) }
+	b, err := os.ReadFile(path)
+	if err != nil { t.Fatal(err) }
+	if !strings.Contains(string(b), "- 80: / -> https://1.2.3.4/ -> https://1.2.3.4/doc/page/login.asp\n") {
+		t.Fatalf("redirect chain missing:\n%s", b)
+	}
+}
+
+func TestWriteMarkdownClasses(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.md")
+	results := []TargetResult{{Host: "1.2.3.4", Class: "camera"}, {Host: "1.2.3.5"}, {Host: "1.2.3.6", Class: "recorder"}}
+	if err := WriteMarkdown(path, results); err != nil { t.Fatal(err) }
+	b, err := os.ReadFile(path)
+	if err != nil { t.Fatal(err) }
+	s := string(b)
+	if !strings.Contains(s, "- Recorders (NVR/DVR): 1.2.3.6\n- Cameras: 1.2.3.4\n- Unclassified: 1.2.3.5\n") {
+		t.Fatalf("class summary missing:\n%s", s)
+	}
+	if strings.Index(s, "## 1.2.3.6") > strings.Index(s, "## 1.2.3.4") || !strings.Contains(s, "## 1.2.3.6\n\nClass: recorder\n") {
+		t.Fatalf("recorders should come first:\n%s", s)
+	}
+}
+
+func TestWriteMarkdownCVSS(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.md")
+	results := []TargetResult{{Host: "1.2.3.4", CVEs: []string{"CVE-2017-7921", "CVE-2021-36260"},
+		CVEDetails: []CVEInfo{{ID: "CVE-2021-36260", CVSS: 9.8, Severity: "CRITICAL", KEV: "2022-01-10", Summary: "A command injection vulnerability."}}}}
+	if err := WriteMarkdown(path, results); err != nil { t.Fatal(err) }
+	b, err := os.ReadFile(path)
+	if err != nil { t.Fatal(err) }
+	if !strings.Contains(string(b), "- CVE-2017-7921\n- CVE-2021-36260 **CRITICAL 9.8** **KNOWN EXPLOITED** — A command injection vulnerability.\n") {
+		t.Fatalf("CVE severity missing:\n%s", b)
+	}
+}
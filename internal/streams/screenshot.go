@@ -0,0 +1,148 @@
+package streams
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/chromedp/chromedp"
+)
+
+// browserNames are the Chrome/Chromium binaries tried, in order, by FindBrowser
+var browserNames = []string{
+	"chromium", "chromium-browser", "google-chrome", "google-chrome-stable", "chrome", "headless-shell",
+}
+
+// screenshotTimeout bounds a single page render; camera UIs load slow plugins
+const screenshotTimeout = 20 * time.Second
+
+// loginFormWait bounds the wait for a login form to become visible after page load
+const loginFormWait = 8 * time.Second
+
+// loginFormSelector matches the password field or form of a rendered login page
+const loginFormSelector = `input[type=password], form`
+
+// FindBrowser returns the path of the first headless-capable Chrome/Chromium binary
+// on PATH. A missing browser is reported as an error wrapping exec.ErrNotFound.
+func FindBrowser() (string, error) {
+	for _, name := range browserNames {
+		if path, err := exec.LookPath(name); err == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("no Chrome/Chromium browser found (tried %s): %w",
+		strings.Join(browserNames, ", "), exec.ErrNotFound)
+}
+
+// CaptureLoginPages renders each page with browser in headless mode and saves a PNG
+// into outDir. It returns the file name written for each page, relative to outDir;
+// pages that fail to render are left out.
+func CaptureLoginPages(ctx context.Context, browser string, pages []string, outDir string) (map[string]string, error) {
+	path, err := exec.LookPath(browser)
+	if err != nil {
+		return nil, fmt.Errorf("browser %s not usable: %w", browser, err)
+	}
+	if err := os.MkdirAll(outDir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create screenshot directory: %w", err)
+	}
+
+	// One browser per host, one tab per page. The allocator creates and removes
+	// a throwaway profile so concurrent hosts don't fight over the profile lock.
+	opts := append(chromedp.DefaultExecAllocatorOptions[:],
+		chromedp.ExecPath(path),
+		chromedp.NoSandbox, // Scans usually run as root, where Chrome refuses to sandbox
+		chromedp.Flag("ignore-certificate-errors", true),
+		chromedp.WindowSize(1280, 800),
+	)
+	allocCtx, cancelAlloc := chromedp.NewExecAllocator(ctx, opts...)
+	defer cancelAlloc()
+	browserCtx, cancelBrowser := chromedp.NewContext(allocCtx)
+	defer cancelBrowser()
+
+	shots := make(map[string]string)
+	var lastErr error
+	for _, page := range pages {
+		if ctx.Err() != nil {
+			break // host budget spent
+		}
+		name := ScreenshotName(page)
+		if err := captureScreenshot(browserCtx, page, filepath.Join(outDir, name)); err != nil {
+			lastErr = err
+			continue
+		}
+		shots[page] = name
+	}
+	if len(shots) == 0 && lastErr != nil {
+		return nil, lastErr
+	}
+	return shots, nil
+}
+
+// captureScreenshot loads pageURL in a new tab of the browser in ctx and saves a PNG.
+// Camera login UIs are often built by JavaScript after the load event, so the capture
+// waits up to loginFormWait for a visible login form before it is taken.
+func captureScreenshot(ctx context.Context, pageURL, file string) error {
+	tabCtx, cancelTab := chromedp.NewContext(ctx)
+	defer cancelTab()
+	tabCtx, cancel := context.WithTimeout(tabCtx, screenshotTimeout)
+	defer cancel()
+
+	if err := chromedp.Run(tabCtx, chromedp.Navigate(pageURL)); err != nil {
+		return fmt.Errorf("failed to render %s: %w", pageURL, err)
+	}
+
+	// Pages without a recognizable form are captured once the wait runs out
+	waitCtx, cancelWait := context.WithTimeout(tabCtx, loginFormWait)
+	_ = chromedp.Run(waitCtx, chromedp.WaitVisible(loginFormSelector, chromedp.ByQuery))
+	cancelWait()
+
+	var png []byte
+	if err := chromedp.Run(tabCtx, chromedp.CaptureScreenshot(&png)); err != nil {
+		return fmt.Errorf("failed to render %s: %w", pageURL, err)
+	}
+	if err := os.WriteFile(file, png, 0o644); err != nil {
+		return fmt.Errorf("failed to save screenshot of %s: %w", pageURL, err)
+	}
+	return nil
+}
+
+// ScreenshotName derives a file name from a login URL, e.g.
+// http://10.0.0.5:8080/doc/page/login.asp -> 10.0.0.5_8080_doc_page_login.asp.png
+func ScreenshotName(pageURL string) string {
+	u, err := url.Parse(pageURL)
+	if err != nil || u.Host == "" {
+		return sanitizeName(pageURL) + ".png"
+	}
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	name := u.Hostname() + "_" + port
+	if path := strings.Trim(u.EscapedPath(), "/"); path != "" {
+		name += "_" + path
+	}
+	if u.RawQuery != "" {
+		name += "_" + u.RawQuery
+	}
+	return sanitizeName(name) + ".png"
+}
+
+// sanitizeName keeps letters, digits, dots and dashes and turns the rest into
+// underscores, which also covers IPv6 colons
+func sanitizeName(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-':
+			return r
+		}
+		return '_'
+	}, s)
+}
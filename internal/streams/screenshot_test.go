@@ -0,0 +1,35 @@
+package streams
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"testing"
+)
+
+func TestScreenshotName(t *testing.T) {
+	tests := []struct {
+		url      string
+		expected string
+	}{
+		{"http://10.0.0.5:8080/doc/page/login.asp", "10.0.0.5_8080_doc_page_login.asp.png"},
+		{"http://10.0.0.5/", "10.0.0.5_80.png"},
+		{"https://10.0.0.5/login.htm", "10.0.0.5_443_login.htm.png"},
+		{"http://10.0.0.5:81/cgi-bin/login.cgi?lang=en&x=1", "10.0.0.5_81_cgi-bin_login.cgi_lang_en_x_1.png"},
+		{"http://[fe80::1]:8000/", "fe80__1_8000.png"},
+	}
+
+	for _, test := range tests {
+		if result := ScreenshotName(test.url); result != test.expected {
+			t.Errorf("ScreenshotName(%q) = %q, expected %q", test.url, result, test.expected)
+		}
+	}
+}
+
+func TestCaptureLoginPagesMissingBrowser(t *testing.T) {
+	_, err := CaptureLoginPages(context.Background(), "cctvscan-no-such-browser",
+		[]string{"http://127.0.0.1/"}, t.TempDir())
+	if !errors.Is(err, exec.ErrNotFound) {
+		t.Errorf("CaptureLoginPages with a missing browser = %v, expected exec.ErrNotFound", err)
+	}
+}
@@ -0,0 +1,36 @@
+package streams
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFetchSnapshotBasic(t *testing.T) {
+	jpeg := []byte{0xFF, 0xD8, 0xFF, 0xE0, 0, 0x10, 'J', 'F', 'I', 'F', 0, 0xFF, 0xD9}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "admin" || pass != "12345" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="IPCamera"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Write(jpeg)
+	}))
+	defer server.Close()
+	file := filepath.Join(t.TempDir(), SnapshotName("10.0.0.5", "Profile_1"))
+
+	if _, err := FetchSnapshot(context.Background(), server.URL+"/onvif-http/snapshot?Profile_1", "", "", file); err == nil {
+		t.Error("FetchSnapshot() without credentials succeeded, expected HTTP 401")
+	}
+	authenticated, err := FetchSnapshot(context.Background(), server.URL+"/onvif-http/snapshot?Profile_1", "admin", "12345", file)
+	if err != nil || !authenticated {
+		t.Fatalf("FetchSnapshot() = %v, %v, expected an authenticated download", authenticated, err)
+	}
+	if data, _ := os.ReadFile(file); len(data) != len(jpeg) {
+		t.Errorf("saved %d bytes, expected %d", len(data), len(jpeg))
+	}
+}
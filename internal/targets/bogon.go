@@ -0,0 +1,99 @@
+package targets
+
+import (
+	"fmt"
+	"net"
+)
+
+// BogonMode controls how private, multicast, loopback and reserved addresses are filtered
+type BogonMode string
+
+const (
+	// BogonAuto drops bogons expanded from CIDRs that are not themselves bogon ranges,
+	// so public sweeps skip non-routable space while explicit LAN targets are kept.
+	BogonAuto BogonMode = "auto"
+	// BogonDrop drops every bogon address, including explicitly listed ones.
+	BogonDrop BogonMode = "drop"
+	// BogonKeep disables filtering.
+	BogonKeep BogonMode = "keep"
+)
+
+// ParseBogonMode validates a bogon filtering mode name
+func ParseBogonMode(s string) (BogonMode, error) {
+	switch mode := BogonMode(s); mode {
+	case BogonAuto, BogonDrop, BogonKeep:
+		return mode, nil
+	}
+	return "", fmt.Errorf("invalid bogon mode %q (want auto, drop or keep)", s)
+}
+
+// bogonRanges lists non-routable and reserved space (RFC 1918, RFC 6890 and friends)
+var bogonRanges = mustParseCIDRs(
+	"0.0.0.0/8",       // "this" network
+	"10.0.0.0/8",      // RFC 1918
+	"100.64.0.0/10",   // carrier-grade NAT
+	"127.0.0.0/8",     // loopback
+	"169.254.0.0/16",  // link-local
+	"172.16.0.0/12",   // RFC 1918
+	"192.0.0.0/24",    // IETF protocol assignments
+	"192.0.2.0/24",    // TEST-NET-1
+	"192.168.0.0/16",  // RFC 1918
+	"198.18.0.0/15",   // benchmarking
+	"198.51.100.0/24", // TEST-NET-2
+	"203.0.113.0/24",  // TEST-NET-3
+	"224.0.0.0/4",     // multicast
+	"240.0.0.0/4",     // reserved and limited broadcast
+	"::/128",          // unspecified
+	"::1/128",         // loopback
+	"100::/64",        // discard-only
+	"2001:db8::/32",   // documentation
+	"fc00::/7",        // unique local
+	"fe80::/10",       // link-local
+	"ff00::/8",        // multicast
+)
+
+// IsBogon reports whether ip falls in private, multicast, loopback or reserved space
+func IsBogon(ip net.IP) bool {
+	for _, bogon := range bogonRanges {
+		if bogon.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// isBogonNet reports whether the whole network lies inside a single bogon range
+func isBogonNet(ipnet *net.IPNet) bool {
+	ones, bits := ipnet.Mask.Size()
+	for _, bogon := range bogonRanges {
+		bogonOnes, bogonBits := bogon.Mask.Size()
+		if bogonBits == bits && bogonOnes <= ones && bogon.Contains(ipnet.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+// dropBogon decides whether an address expanded from spec should be filtered.
+// ipnet is nil for single-address specs.
+func dropBogon(mode BogonMode, ip net.IP, ipnet *net.IPNet) bool {
+	switch mode {
+	case BogonDrop:
+		return IsBogon(ip)
+	case BogonAuto:
+		return ipnet != nil && !isBogonNet(ipnet) && IsBogon(ip)
+	}
+	return false
+}
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, ipnet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, ipnet)
+	}
+	return nets
+}
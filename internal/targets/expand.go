@@ -12,15 +12,25 @@ import (
 	"github.com/postfix/cctvscan/internal/util"
 )
 
+// maxIPv6HostBits limits IPv6 CIDR expansion to at most a /112 (65536 addresses).
+const maxIPv6HostBits = 16
+
 // FromArgsOrFile processes targets from command-line arguments and/or a file.
 // It reads targets from the specified file (if provided), combines them with args,
 // expands CIDR notations to individual IPs, and validates all targets.
 // Returns a slice of unique target IP addresses or an error if any target is invalid.
 func FromArgsOrFile(args []string, file string) ([]string, error) {
+	out, _, err := FromArgsOrFileFiltered(args, file, BogonKeep)
+	return out, err
+}
+
+// FromArgsOrFileFiltered is FromArgsOrFile with bogon filtering applied during expansion.
+// It also returns the number of addresses that were dropped.
+func FromArgsOrFileFiltered(args []string, file string, mode BogonMode) ([]string, int, error) {
 	lines := make([]string, 0, len(args)+10)
 	if file != "" {
 		f, err := os.Open(file)
-		if err != nil { return nil, err }
+		if err != nil { return nil, 0, err }
 		defer f.Close()
 		sc := bufio.NewScanner(f)
 		for sc.Scan() {
@@ -28,25 +38,32 @@ func FromArgsOrFile(args []string, file string) ([]string, error) {
 			if s == "" || strings.HasPrefix(s, "#") { continue }
 			lines = append(lines, s)
 		}
-		if err := sc.Err(); err != nil { return nil, err }
+		if err := sc.Err(); err != nil { return nil, 0, err }
 	}
 	lines = append(lines, args...)
 	// Pre-allocate output slice with estimated capacity
 	out := make([]string, 0, len(lines)*4)
+	dropped := 0
 	for _, t := range lines {
 		if _, ipnet, err := net.ParseCIDR(t); err == nil {
+			// IPv6 prefixes are huge; only expand ranges small enough to enumerate
+			if ones, bits := ipnet.Mask.Size(); bits == 128 && bits-ones > maxIPv6HostBits {
+				return nil, 0, fmt.Errorf("IPv6 range %q too large to expand (max /%d)", t, 128-maxIPv6HostBits)
+			}
 			for ip := ipnet.IP.Mask(ipnet.Mask); ipnet.Contains(ip); incIP(ip) {
+				if dropBogon(mode, ip, ipnet) { dropped++; continue }
 				out = append(out, ip.String())
 			}
 			continue
 		}
 		if ip := net.ParseIP(t); ip != nil {
+			if dropBogon(mode, ip, nil) { dropped++; continue }
 			out = append(out, ip.String())
 			continue
 		}
-		return nil, fmt.Errorf("invalid target %q", t)
+		return nil, 0, fmt.Errorf("invalid target %q", t)
 	}
-	return util.Uniq(out), nil
+	return util.Uniq(out), dropped, nil
 }
 
 // incIP increments an IP address by one.
@@ -61,6 +78,13 @@ func incIP(ip net.IP) {
 // Expand processes targets from command-line arguments, handling both
 // individual IPs and files containing target lists.
 func Expand(args []string) ([]string, error) {
+	targets, _, err := ExpandFiltered(args, BogonKeep)
+	return targets, err
+}
+
+// ExpandFiltered is Expand with bogon filtering applied during CIDR expansion.
+// It also returns the number of addresses that were dropped.
+func ExpandFiltered(args []string, mode BogonMode) ([]string, int, error) {
 	var targets []string
 	
 	for _, arg := range args {
@@ -69,7 +93,7 @@ func Expand(args []string) ([]string, error) {
 			// Read targets from file
 			f, err := os.Open(arg)
 			if err != nil {
-				return nil, fmt.Errorf("failed to open file %s: %v", arg, err)
+				return nil, 0, fmt.Errorf("failed to open file %s: %v", arg, err)
 			}
 			defer f.Close()
 			
@@ -81,7 +105,7 @@ func Expand(args []string) ([]string, error) {
 				}
 			}
 			if err := scanner.Err(); err != nil {
-				return nil, fmt.Errorf("error reading file %s: %v", arg, err)
+				return nil, 0, fmt.Errorf("error reading file %s: %v", arg, err)
 			}
 		} else {
 			// Treat as direct target
@@ -90,7 +114,7 @@ func Expand(args []string) ([]string, error) {
 	}
 	
 	// Use FromArgsOrFile to handle CIDR expansion and validation
-	return FromArgsOrFile(targets, "")
+	return FromArgsOrFileFiltered(targets, "", mode)
 }
 
 
@@ -8,3 +8,30 @@ func TestFromArgsOrFileCIDR(t *testing.T) {
 	if len(got) != 4 { t.Fatalf("want 4, got %d", len(got)) }
 }
 
+
+func TestFromArgsOrFileIPv6(t *testing.T) {
+	got, err := FromArgsOrFile([]string{"2001:db8::/126", "2001:DB8:0:0::10"}, "")
+	if err != nil { t.Fatal(err) }
+	if len(got) != 5 { t.Fatalf("want 5, got %d", len(got)) }
+	if got[4] != "2001:db8::10" { t.Fatalf("want canonical 2001:db8::10, got %s", got[4]) }
+	if _, err := FromArgsOrFile([]string{"2001:db8::/64"}, ""); err == nil {
+		t.Fatal("want error for oversized IPv6 range")
+	}
+}
+
+func TestFromArgsOrFileBogons(t *testing.T) {
+	// 192.0.0.0/23 is public but contains 192.0.0.0/24; auto mode drops the reserved half
+	got, dropped, err := FromArgsOrFileFiltered([]string{"192.0.0.0/23", "192.168.1.10"}, "", BogonAuto)
+	if err != nil { t.Fatal(err) }
+	if len(got) != 257 || dropped != 256 { t.Fatalf("want 257 kept, 256 dropped, got %d (%d dropped)", len(got), dropped) }
+	if got[0] != "192.0.1.0" || got[256] != "192.168.1.10" { t.Fatalf("unexpected targets %s ... %s", got[0], got[256]) }
+
+	// Whole bogon CIDRs are intentional LAN scans in auto mode
+	got, _, err = FromArgsOrFileFiltered([]string{"192.168.1.0/30"}, "", BogonAuto)
+	if err != nil { t.Fatal(err) }
+	if len(got) != 4 { t.Fatalf("want 4, got %d", len(got)) }
+
+	got, dropped, err = FromArgsOrFileFiltered([]string{"192.168.1.0/30", "8.8.8.8", "ff02::1"}, "", BogonDrop)
+	if err != nil { t.Fatal(err) }
+	if len(got) != 1 || dropped != 5 { t.Fatalf("want only 8.8.8.8, got %v (%d dropped)", got, dropped) }
+}
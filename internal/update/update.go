@@ -0,0 +1,199 @@
+// Package update installs fingerprint bundles: the brand signatures and default
+// credentials cctvscan ships, published with every release so that a scanner
+// built months ago still knows this month's firmware. A bundle is only installed
+// when its ed25519 signature verifies against the release key.
+package update
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/postfix/cctvscan/internal/fingerprint"
+)
+
+// DefaultURL is the bundle of the latest release; its signature is at the same
+// URL with .sig appended
+const DefaultURL = "https://github.com/postfix/cctvscan/releases/latest/download/fingerprints.json"
+
+// DefaultKey is the base64 ed25519 public key release bundles are signed with.
+// Release builds set it with
+//
+//	-ldflags "-X github.com/postfix/cctvscan/internal/update.DefaultKey=..."
+var DefaultKey = ""
+
+// maxBundleSize bounds the download, the built-in signatures are some 40 KB
+const maxBundleSize = 16 << 20
+
+// Files of an installed bundle in the data directory
+const (
+	BundleFile      = "fingerprints.json" // The bundle as downloaded
+	SignaturesFile  = "signatures.json"   // Loaded like a -signatures file
+	CredentialsFile = "credentials.txt"   // Used when -creds is not given
+	CVEStoreFile    = "cves.db"           // NVD, KEV and EPSS data written by update-cves, see cvedb.Store
+	VulnersFile     = "vulners.json"      // Vulners answers cached by -vulners
+)
+
+// Bundle is the format of a fingerprint bundle. Certificate fingerprints and the
+// other per-brand strings are part of the signatures.
+type Bundle struct {
+	Version     string          `json:"version"` // e.g. 2026.10.1
+	Created     time.Time       `json:"created"`
+	Signatures  json.RawMessage `json:"signatures"`            // Signature file, see fingerprint.LoadSignatures
+	Credentials []string        `json:"credentials,omitempty"` // user:password, tried in order
+}
+
+// DataDir returns the directory bundles are installed to: $XDG_DATA_HOME/cctvscan,
+// ~/.local/share/cctvscan on Unix, or cctvscan in the user config directory on
+// macOS and Windows
+func DataDir() (string, error) {
+	if dir := os.Getenv("XDG_DATA_HOME"); dir != "" {
+		return filepath.Join(dir, "cctvscan"), nil
+	}
+	if runtime.GOOS == "darwin" || runtime.GOOS == "windows" {
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to find the data directory: %w", err)
+		}
+		return filepath.Join(dir, "cctvscan"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find the data directory: %w", err)
+	}
+	return filepath.Join(home, ".local", "share", "cctvscan"), nil
+}
+
+// Installed returns the path of file in the data directory, or "" when no bundle
+// installed it
+func Installed(file string) string {
+	dir, err := DataDir()
+	if err != nil {
+		return ""
+	}
+	path := filepath.Join(dir, file)
+	if _, err := os.Stat(path); err != nil {
+		return ""
+	}
+	return path
+}
+
+// Fetch downloads the bundle at url and its signature at url+".sig" and returns
+// the bundle once the signature verifies against key, a base64 ed25519 public key
+func Fetch(ctx context.Context, client *http.Client, url, key string) (Bundle, []byte, error) {
+	pub, err := base64.StdEncoding.DecodeString(strings.TrimSpace(key))
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return Bundle{}, nil, errors.New("invalid bundle key: must be a base64 ed25519 public key")
+	}
+	data, err := download(ctx, client, url)
+	if err != nil {
+		return Bundle{}, nil, err
+	}
+	sig, err := download(ctx, client, url+".sig")
+	if err != nil {
+		return Bundle{}, nil, err
+	}
+	if err := Verify(data, sig, ed25519.PublicKey(pub)); err != nil {
+		return Bundle{}, nil, err
+	}
+	b, err := Parse(data)
+	return b, data, err
+}
+
+// Verify checks the detached signature of a bundle, the base64 of the raw
+// ed25519 signature
+func Verify(data, sig []byte, key ed25519.PublicKey) error {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(sig)))
+	if err != nil || !ed25519.Verify(key, data, raw) {
+		return errors.New("bundle signature does not verify")
+	}
+	return nil
+}
+
+// Parse decodes a bundle and checks its signatures load
+func Parse(data []byte) (Bundle, error) {
+	var b Bundle
+	if err := json.Unmarshal(data, &b); err != nil {
+		return Bundle{}, fmt.Errorf("failed to parse bundle: %w", err)
+	}
+	if len(b.Signatures) == 0 {
+		return Bundle{}, errors.New("bundle has no signatures")
+	}
+	if err := fingerprint.ValidateSignatures(b.Signatures); err != nil {
+		return Bundle{}, fmt.Errorf("bundle %s: %w", b.Version, err)
+	}
+	for _, c := range b.Credentials {
+		if !strings.Contains(c, ":") || strings.ContainsAny(c, "\r\n") {
+			return Bundle{}, fmt.Errorf("bundle %s: invalid credential %q", b.Version, c)
+		}
+	}
+	return b, nil
+}
+
+// Install writes a verified bundle, as downloaded in data, and the files
+// extracted from it to dir. Each file is replaced whole, so a scan starting
+// meanwhile reads either the old bundle or the new one.
+func Install(dir string, b Bundle, data []byte) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+	var creds bytes.Buffer
+	fmt.Fprintf(&creds, "# Default credentials of fingerprint bundle %s\n", b.Version)
+	for _, c := range b.Credentials {
+		creds.WriteString(c + "\n")
+	}
+	files := []struct {
+		name string
+		data []byte
+	}{
+		{SignaturesFile, b.Signatures},
+		{CredentialsFile, creds.Bytes()},
+		{BundleFile, data},
+	}
+	for _, f := range files {
+		path := filepath.Join(dir, f.name)
+		tmp := path + ".tmp"
+		if err := os.WriteFile(tmp, f.data, 0o644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", path, err)
+		}
+		if err := os.Rename(tmp, path); err != nil {
+			return fmt.Errorf("failed to write %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// download fetches url, refusing anything but 200 and bodies over maxBundleSize
+func download(ctx context.Context, client *http.Client, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", url, err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download %s: %s", url, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxBundleSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", url, err)
+	}
+	if len(data) > maxBundleSize {
+		return nil, fmt.Errorf("failed to download %s: larger than %d bytes", url, maxBundleSize)
+	}
+	return data, nil
+}
@@ -0,0 +1,95 @@
+package update
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testBundle = `{"version": "2026.10.1", "created": "2026-10-01T00:00:00Z",
+ "signatures": {"brands": [{"brand": "Acme", "keywords": ["acmecam"]}]},
+ "credentials": ["admin:acme123"]}`
+
+// serveBundle serves bundle and sig at /fingerprints.json and its .sig
+func serveBundle(t *testing.T, bundle, sig string) string {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/fingerprints.json":
+			w.Write([]byte(bundle))
+		case "/fingerprints.json.sig":
+			w.Write([]byte(sig))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL + "/fingerprints.json"
+}
+
+func TestFetchInstall(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := base64.StdEncoding.EncodeToString(pub)
+	sig := base64.StdEncoding.EncodeToString(ed25519.Sign(priv, []byte(testBundle)))
+
+	url := serveBundle(t, testBundle, sig)
+	b, data, err := Fetch(context.Background(), http.DefaultClient, url, key)
+	if err != nil || b.Version != "2026.10.1" || len(b.Credentials) != 1 {
+		t.Fatalf("Fetch() = %+v, %v, expected bundle 2026.10.1", b, err)
+	}
+	dir := t.TempDir()
+	if err := Install(dir, b, data); err != nil {
+		t.Fatalf("Install() = %v", err)
+	}
+	creds, _ := os.ReadFile(filepath.Join(dir, CredentialsFile))
+	sigs, _ := os.ReadFile(filepath.Join(dir, SignaturesFile))
+	if !strings.HasSuffix(string(creds), "\nadmin:acme123\n") || !strings.Contains(string(sigs), "acmecam") {
+		t.Errorf("Install() wrote credentials %q, signatures %q", creds, sigs)
+	}
+
+	// Tampered bundles, other keys and broken signatures are refused
+	other, _, _ := ed25519.GenerateKey(nil)
+	tampered := strings.Replace(testBundle, "acme123", "acme124", 1)
+	broken := `{"version": "x", "signatures": {"brands": [{"brand": "Acme", "content": "("}]}}`
+	brokenSig := base64.StdEncoding.EncodeToString(ed25519.Sign(priv, []byte(broken)))
+	tests := []struct {
+		url, key string
+	}{
+		{serveBundle(t, tampered, sig), key},
+		{url, base64.StdEncoding.EncodeToString(other)},
+		{url, "not a key"},
+		{serveBundle(t, broken, brokenSig), key},
+		{strings.TrimSuffix(url, ".json"), key},
+	}
+	for _, test := range tests {
+		if _, _, err := Fetch(context.Background(), http.DefaultClient, test.url, test.key); err == nil {
+			t.Errorf("Fetch(%q, %q) succeeded, expected an error", test.url, test.key)
+		}
+	}
+}
+
+func TestDataDir(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	dir, err := DataDir()
+	if err != nil || filepath.Base(dir) != "cctvscan" {
+		t.Fatalf("DataDir() = %q, %v", dir, err)
+	}
+	if path := Installed(SignaturesFile); path != "" {
+		t.Errorf("Installed() = %q before Install", path)
+	}
+	if err := Install(dir, Bundle{Signatures: []byte(`{"brands": []}`)}, []byte("{}")); err != nil {
+		t.Fatal(err)
+	}
+	if path := Installed(SignaturesFile); path != filepath.Join(dir, SignaturesFile) {
+		t.Errorf("Installed() = %q after Install", path)
+	}
+}
@@ -2,8 +2,10 @@ package verify
 
 import (
 	"context"
+	"errors"
 	"net"
 	"sort"
+	"syscall"
 	"time"
 )
 
@@ -46,6 +48,33 @@ func (v *TCPVerifier) try(ctx context.Context, addr string) bool {
 	return false
 }
 
+// Port states reported by State
+const (
+	StateOpen     = "open"
+	StateClosed   = "closed"   // connection reset / refused
+	StateFiltered = "filtered" // no answer before the timeout
+)
+
+// State classifies a single port by how a TCP connect attempt ends:
+// success is open, an RST is closed, and silence until the timeout is filtered.
+func (v *TCPVerifier) State(ctx context.Context, host string, port int) string {
+	addr := net.JoinHostPort(host, itoa(port))
+	state := StateFiltered
+	for i := 0; i<=v.retries; i++ {
+		d := net.Dialer{ Timeout: v.timeout }
+		conn, err := d.DialContext(ctx, "tcp", addr)
+		if err == nil {
+			conn.Close()
+			return StateOpen
+		}
+		if errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) {
+			state = StateClosed
+		}
+		if ctx.Err() != nil { break }
+	}
+	return state
+}
+
 func itoa(i int) string { return fmtInt(int64(i)) }
 
 func fmtInt(i int64) string {